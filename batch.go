@@ -0,0 +1,227 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// batchCommands lists the commands which can be run in a batch in
+// addition to the commands the daemon can run.
+var batchCommands = []string{
+	"create",
+	"run",
+}
+
+// batchInput is where the batch commands are read from, unless a bundle
+// list is used.
+var batchInput io.Reader = os.Stdin
+
+// batchResult is the result of a command of a batch.
+type batchResult struct {
+	Args []string `json:"args"`
+	daemonResponse
+}
+
+func isBatchCommand(command string) bool {
+	if isDaemonCommand(command) {
+		return true
+	}
+
+	for _, c := range batchCommands {
+		if c == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// batch runs several commands in the same process, using the
+// configuration loaded for the "cc-batch" command.
+type batch struct {
+	// commands are the runtime commands. They come from the
+	// application as runtimeCommands includes "cc-batch".
+	commands []cli.Command
+	metadata map[string]interface{}
+}
+
+// before replaces beforeSubcommands for the commands of a batch.
+func (b batch) before(context *cli.Context) error {
+	if !isBatchCommand(context.Args().First()) {
+		return fmt.Errorf("Command %q cannot be run in a batch", context.Args().First())
+	}
+
+	if err := setOutputFormat(context); err != nil {
+		return err
+	}
+
+	setInstanceDirs(context, runtimeOptions)
+
+	context.App.Metadata = b.metadata
+
+	return nil
+}
+
+// run runs the commands one after the other, carrying on after a
+// failure.
+func (b batch) run(requests []daemonRequest) []batchResult {
+	// Failed commands must not terminate the batch.
+	savedOsExiter := cli.OsExiter
+	defer func() {
+		cli.OsExiter = savedOsExiter
+	}()
+
+	cli.OsExiter = func(int) {}
+
+	results := make([]batchResult, 0, len(requests))
+
+	for _, req := range requests {
+		ccLog.Debugf("Batch running %v", req.Args)
+
+		results = append(results, batchResult{
+			Args:           req.Args,
+			daemonResponse: runCaptured(b.commands, req.Args, b.before),
+		})
+	}
+
+	return results
+}
+
+// readBatch reads a JSON array of commands, each of the form
+// {"args": ["<command>", "<argument>", ...]}.
+func readBatch(r io.Reader) ([]daemonRequest, error) {
+	var requests []daemonRequest
+
+	if err := json.NewDecoder(r).Decode(&requests); err != nil {
+		return nil, fmt.Errorf("Invalid batch: %v", err)
+	}
+
+	return requests, nil
+}
+
+// readBundleList reads a file listing a container ID and a bundle path
+// per line, and returns the commands to create and start the containers.
+// Empty lines and lines starting with "#" are ignored.
+func readBundleList(path string) ([]daemonRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var requests []daemonRequest
+
+	scanner := bufio.NewScanner(f)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a container ID and a bundle path, got %q", path, n, line)
+		}
+
+		requests = append(requests, daemonRequest{
+			Args: []string{"run", "--detach", "--bundle", fields[1], fields[0]},
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+var batchCLICommand = cli.Command{
+	Name:  "cc-batch",
+	Usage: "run several commands in a single invocation",
+	Description: `The cc-batch command runs several runtime commands one after the
+   other in the same process, so that the runtime is started and its
+   configuration is loaded only once. This is much quicker when creating
+   many containers at once, for example in CI systems.
+
+   The commands are read from stdin as a JSON array of objects of the
+   form {"args": ["<command>", "<argument>", ...]}. Alternatively,
+   "--bundle-list" specifies a file listing a container ID and a bundle
+   path per line: each container is created and started detached, as
+   with "run --detach".
+
+   Only "create", "run" and the commands the daemon can run can be used
+   in a batch. All the commands are run, even if some fail, and their
+   results are written to stdout as a JSON array, in order. The command
+   fails if any command of the batch failed.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "bundle-list",
+			Usage: "file listing the IDs and bundle paths of the containers to run",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		var requests []daemonRequest
+		var err error
+
+		if path := context.String("bundle-list"); path != "" {
+			requests, err = readBundleList(path)
+		} else {
+			requests, err = readBatch(batchInput)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		b := batch{
+			commands: context.App.Commands,
+			metadata: context.App.Metadata,
+		}
+
+		results := b.run(requests)
+
+		bytes, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(defaultOutputFile, "%s\n", bytes); err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, r := range results {
+			if r.ExitCode != 0 {
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d batch commands failed", failed, len(results))
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestBatchCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, command := range []string{"create", "run", "start", "delete", "list"} {
+		assert.True(isBatchCommand(command), command)
+	}
+
+	for _, command := range []string{"", "exec", "cc-daemon", "cc-batch"} {
+		assert.False(isBatchCommand(command), command)
+	}
+}
+
+func TestReadBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	requests, err := readBatch(strings.NewReader(`[{"args": ["start", "foo"]}, {"args": ["state", "bar"]}]`))
+	assert.NoError(err)
+	assert.Equal([]daemonRequest{
+		{Args: []string{"start", "foo"}},
+		{Args: []string{"state", "bar"}},
+	}, requests)
+
+	requests, err = readBatch(strings.NewReader(`[]`))
+	assert.NoError(err)
+	assert.Empty(requests)
+
+	_, err = readBatch(strings.NewReader(`{"args": ["start", "foo"]}`))
+	assert.Error(err)
+
+	_, err = readBatch(strings.NewReader(""))
+	assert.Error(err)
+}
+
+func TestReadBundleList(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "batch-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bundles")
+
+	_, err = readBundleList(path)
+	assert.Error(err)
+
+	err = createFile(path, "# test containers\nfoo /bundles/foo\n\n  bar\t/bundles/bar  \n")
+	assert.NoError(err)
+
+	requests, err := readBundleList(path)
+	assert.NoError(err)
+	assert.Equal([]daemonRequest{
+		{Args: []string{"run", "--detach", "--bundle", "/bundles/foo", "foo"}},
+		{Args: []string{"run", "--detach", "--bundle", "/bundles/bar", "bar"}},
+	}, requests)
+
+	err = createFile(path, "foo /bundles/foo\nbar\n")
+	assert.NoError(err)
+
+	_, err = readBundleList(path)
+	assert.Error(err)
+	assert.True(strings.Contains(err.Error(), ":2:"), err.Error())
+}
+
+func TestBatchCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "batch-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	runtimeConfig, err := newTestRuntimeConfig(dir, testConsole, true)
+	assert.NoError(err)
+
+	outputFile, err := os.Create(filepath.Join(dir, "output"))
+	assert.NoError(err)
+	defer outputFile.Close()
+
+	savedOutputFile := defaultOutputFile
+	savedBatchInput := batchInput
+	defer func() {
+		defaultOutputFile = savedOutputFile
+		batchInput = savedBatchInput
+		testingImpl.ListPodFunc = nil
+	}()
+
+	defaultOutputFile = outputFile
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: testContainerID, Annotations: map[string]string{}},
+				},
+			},
+		}, nil
+	}
+
+	app := cli.NewApp()
+	app.Commands = runtimeCommands
+	app.Metadata = map[string]interface{}{
+		"runtimeConfig": runtimeConfig,
+	}
+
+	set := flag.NewFlagSet("", 0)
+	set.String("bundle-list", "", "")
+
+	ctx := cli.NewContext(app, set, nil)
+
+	fn, ok := batchCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	batchInput = strings.NewReader(`[
+		{"args": ["list", "--quiet"]},
+		{"args": ["state", "enoent"]},
+		{"args": ["exec", "` + testContainerID + `", "true"]}
+	]`)
+
+	err = fn(ctx)
+	assert.Error(err)
+	assert.True(strings.Contains(err.Error(), "2 of 3"), err.Error())
+
+	// the global state is restored
+	assert.Equal(outputFile, defaultOutputFile)
+
+	output, err := ioutil.ReadFile(outputFile.Name())
+	assert.NoError(err)
+
+	var results []batchResult
+	err = json.Unmarshal(output, &results)
+	assert.NoError(err)
+	assert.Len(results, 3)
+
+	assert.Equal([]string{"list", "--quiet"}, results[0].Args)
+	assert.Equal(testContainerID+"\n", results[0].Output)
+	assert.Equal(0, results[0].ExitCode)
+
+	assert.NotEmpty(results[1].Error)
+	assert.Equal(1, results[1].ExitCode)
+
+	assert.True(strings.Contains(results[2].Error, "cannot be run in a batch"), results[2].Error)
+
+	// invalid batch
+	batchInput = strings.NewReader("foo")
+	err = fn(ctx)
+	assert.Error(err)
+
+	// missing bundle list
+	set.Set("bundle-list", filepath.Join(dir, "enoent"))
+	err = fn(ctx)
+	assert.Error(err)
+}
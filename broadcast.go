@@ -0,0 +1,276 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+// broadcastMaxOutput is the amount of each output stream of a process
+// kept in the results of the cc-exec-all command.
+const broadcastMaxOutput = 64 * 1024
+
+// broadcastExec runs a process in a container. It is a variable rather
+// than a function to allow tests to modify it.
+var broadcastExec = runExec
+
+// broadcastTarget is a container the command is run in.
+type broadcastTarget struct {
+	podID       string
+	containerID string
+}
+
+// broadcastResult is the result of the command in a container.
+type broadcastResult struct {
+	PodID       string `json:"podID"`
+	ContainerID string `json:"containerID"`
+
+	// ExitCode is not set if the command could not be run.
+	ExitCode *int `json:"exitCode,omitempty"`
+
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+
+	// Truncated is set when the output exceeded broadcastMaxOutput.
+	Truncated bool `json:"truncated,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// limitedBuffer keeps the beginning of the data written to it. The
+// buffer is not embedded so that io.Copy cannot bypass Write with
+// ReadFrom.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	room := b.max - b.buf.Len()
+	if len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:room])
+	} else {
+		b.buf.Write(p)
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+var execAllCLICommand = cli.Command{
+	Name:    "cc-exec-all",
+	Aliases: []string{"exec-all"},
+	Usage:   "run a command in many containers",
+	ArgsUsage: `<command> [command options]
+
+   Where "<command>" is run in every running container selected by
+   "--pod" or "--filter".`,
+	Description: `The cc-exec-all command runs the same command in every container of a
+   pod, or of every pod with the labels selected by "--filter", and
+   displays the results as a JSON array: for each container, the exit
+   code and the standard output and error of the command, each
+   truncated to 64KiB. The command is run in one container at a time,
+   without a terminal or standard input.
+
+EXAMPLE:
+   # cc-runtime cc-exec-all --filter label=env=ci cat /etc/resolv.conf`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "pod",
+			Usage: "run the command in the containers of the pod of this container",
+		},
+		cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "run the command in the containers of the pods with a label, as label=<key>[=<value>] (may be repeated)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() == 0 {
+			return errors.New("Missing command")
+		}
+
+		filters, err := parseListFilters(context.StringSlice("filter"))
+		if err != nil {
+			return err
+		}
+
+		pod := context.String("pod")
+
+		if (pod == "") == (len(filters) == 0) {
+			return errors.New("Expecting either --pod or --filter")
+		}
+
+		podID := ""
+		if pod != "" {
+			if _, podID, err = getExistingContainerInfo(pod); err != nil {
+				return err
+			}
+		}
+
+		targets, err := broadcastTargets(podID, filters)
+		if err != nil {
+			return err
+		}
+
+		results := make([]broadcastResult, 0, len(targets))
+		for _, target := range targets {
+			results = append(results, broadcastCommand(target, context.Args()))
+		}
+
+		return writeJSON(results)
+	},
+}
+
+// broadcastTargets returns the running containers of the specified pod,
+// or of the pods matching all the filters.
+func broadcastTargets(podID string, filters []listFilter) ([]broadcastTarget, error) {
+	podStatusList, err := vci.ListPod()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []broadcastTarget
+
+	for _, podStatus := range podStatusList {
+		if podID != "" && podStatus.ID != podID {
+			continue
+		}
+
+		if len(filters) != 0 {
+			labels, err := loadPodLabels(podStatus.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			if !matchFilters(filters, labels) {
+				continue
+			}
+		}
+
+		for _, container := range podStatus.ContainersStatus {
+			if container.State.State != vc.StateRunning {
+				continue
+			}
+
+			targets = append(targets, broadcastTarget{
+				podID:       podStatus.ID,
+				containerID: container.ID,
+			})
+		}
+	}
+
+	return targets, nil
+}
+
+// broadcastCommand runs a command in a container, collecting its output.
+func broadcastCommand(target broadcastTarget, args []string) broadcastResult {
+	result := broadcastResult{
+		PodID:       target.podID,
+		ContainerID: target.containerID,
+	}
+
+	stdout := &limitedBuffer{max: broadcastMaxOutput}
+	stderr := &limitedBuffer{max: broadcastMaxOutput}
+
+	execResult, err := captureExecOutput(stdout, stderr, func() (execResult, error) {
+		return broadcastExec(target.containerID, func(specProcess *oci.CompatOCIProcess) (execParams, error) {
+			var process oci.CompatOCIProcess
+			if specProcess != nil {
+				process = *specProcess
+			}
+
+			process.Args = args
+			process.Terminal = false
+
+			return execParams{ociProcess: process}, nil
+		})
+	})
+
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+
+	if err != nil {
+		result.Error = err.Error()
+	} else if execResult.exited {
+		exitCode := execResult.exitCode
+		result.ExitCode = &exitCode
+	}
+
+	return result
+}
+
+// captureExecOutput runs fn with the standard output and error, which
+// the shim inherits, copied to stdout and stderr, and with no standard
+// input.
+func captureExecOutput(stdout, stderr io.Writer, fn func() (execResult, error)) (execResult, error) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return execResult{}, err
+	}
+	defer devNull.Close()
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return execResult{}, err
+	}
+
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return execResult{}, err
+	}
+
+	var wg sync.WaitGroup
+
+	copyStream := func(w io.Writer, r *os.File) {
+		defer wg.Done()
+		defer r.Close()
+		io.Copy(w, r)
+	}
+
+	wg.Add(2)
+	go copyStream(stdout, stdoutR)
+	go copyStream(stderr, stderrR)
+
+	savedStdin, savedStdout, savedStderr := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = devNull, stdoutW, stderrW
+
+	result, err := fn()
+
+	os.Stdin, os.Stdout, os.Stderr = savedStdin, savedStdout, savedStderr
+
+	// The output is complete once the shim, which holds its own
+	// copies, exited.
+	stdoutW.Close()
+	stderrW.Close()
+	wg.Wait()
+
+	return result, err
+}
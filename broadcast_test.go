@@ -0,0 +1,250 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func broadcastPodStatus(podID string, containers ...string) vc.PodStatus {
+	status := vc.PodStatus{
+		ID:    podID,
+		State: vc.State{State: vc.StateRunning},
+	}
+
+	for _, id := range containers {
+		status.ContainersStatus = append(status.ContainersStatus, vc.ContainerStatus{
+			ID:    id,
+			State: vc.State{State: vc.StateRunning},
+		})
+	}
+
+	return status
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &limitedBuffer{max: 5}
+
+	n, err := b.Write([]byte("abc"))
+	assert.NoError(err)
+	assert.Equal(3, n)
+	assert.False(b.truncated)
+
+	n, err = b.Write([]byte("defgh"))
+	assert.NoError(err)
+	assert.Equal(5, n)
+	assert.True(b.truncated)
+	assert.Equal("abcde", b.String())
+
+	_, err = b.Write([]byte("i"))
+	assert.NoError(err)
+	assert.Equal("abcde", b.String())
+}
+
+func TestCaptureExecOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	savedStdin, savedStdout, savedStderr := os.Stdin, os.Stdout, os.Stderr
+
+	var stdout, stderr bytes.Buffer
+
+	result, err := captureExecOutput(&stdout, &stderr, func() (execResult, error) {
+		input, err := ioutil.ReadAll(os.Stdin)
+		assert.NoError(err)
+		assert.Empty(input)
+
+		fmt.Fprint(os.Stdout, "out")
+		fmt.Fprint(os.Stderr, "err")
+
+		return execResult{exited: true, exitCode: 3}, nil
+	})
+	assert.NoError(err)
+	assert.Equal(execResult{exited: true, exitCode: 3}, result)
+	assert.Equal("out", stdout.String())
+	assert.Equal("err", stderr.String())
+
+	assert.Equal(savedStdin, os.Stdin)
+	assert.Equal(savedStdout, os.Stdout)
+	assert.Equal(savedStderr, os.Stderr)
+
+	_, err = captureExecOutput(&stdout, &stderr, func() (execResult, error) {
+		return execResult{}, errors.New("exec failed")
+	})
+	assert.Error(err)
+}
+
+func TestBroadcastTargets(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "broadcast-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		testingImpl.ListPodFunc = nil
+	}()
+
+	runtimeStateDir = dir
+
+	stopped := broadcastPodStatus("pod2", "pod2", "stopped")
+	stopped.ContainersStatus[1].State.State = vc.StateStopped
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			broadcastPodStatus("pod1", "pod1", "ctr1"),
+			stopped,
+			broadcastPodStatus("pod3", "pod3"),
+		}, nil
+	}
+
+	assert.NoError(setPodLabels("pod1", map[string]string{"env": "ci"}))
+	assert.NoError(setPodLabels("pod2", map[string]string{"env": "ci", "team": "ml"}))
+	assert.NoError(setPodLabels("pod3", map[string]string{"env": "prod"}))
+
+	targets, err := broadcastTargets("pod1", nil)
+	assert.NoError(err)
+	assert.Equal([]broadcastTarget{{"pod1", "pod1"}, {"pod1", "ctr1"}}, targets)
+
+	filters, err := parseListFilters([]string{"label=env=ci"})
+	assert.NoError(err)
+
+	targets, err = broadcastTargets("", filters)
+	assert.NoError(err)
+	assert.Equal([]broadcastTarget{{"pod1", "pod1"}, {"pod1", "ctr1"}, {"pod2", "pod2"}}, targets)
+
+	filters, err = parseListFilters([]string{"label=env=ci", "label=team"})
+	assert.NoError(err)
+
+	targets, err = broadcastTargets("", filters)
+	assert.NoError(err)
+	assert.Equal([]broadcastTarget{{"pod2", "pod2"}}, targets)
+}
+
+func TestBroadcastCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	savedBroadcastExec := broadcastExec
+	defer func() {
+		broadcastExec = savedBroadcastExec
+	}()
+
+	broadcastExec = func(containerID string, makeParams func(specProcess *oci.CompatOCIProcess) (execParams, error)) (execResult, error) {
+		params, err := makeParams(&oci.CompatOCIProcess{})
+		assert.NoError(err)
+		assert.Equal([]string{"cat", "/etc/resolv.conf"}, params.ociProcess.Args)
+		assert.False(params.ociProcess.Terminal)
+		assert.False(params.detach)
+
+		if containerID == "broken" {
+			return execResult{}, errors.New("Container broken is not running")
+		}
+
+		fmt.Fprint(os.Stdout, strings.Repeat("x", broadcastMaxOutput+1))
+		return execResult{exited: true, exitCode: 1}, nil
+	}
+
+	args := []string{"cat", "/etc/resolv.conf"}
+
+	result := broadcastCommand(broadcastTarget{testPodID, testContainerID}, args)
+	assert.Equal(testPodID, result.PodID)
+	assert.Equal(testContainerID, result.ContainerID)
+	assert.NotNil(result.ExitCode)
+	assert.Equal(1, *result.ExitCode)
+	assert.Len(result.Stdout, broadcastMaxOutput)
+	assert.True(result.Truncated)
+	assert.Empty(result.Error)
+
+	result = broadcastCommand(broadcastTarget{testPodID, "broken"}, args)
+	assert.Nil(result.ExitCode)
+	assert.Contains(result.Error, "not running")
+}
+
+func TestExecAllCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "broadcast-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, restore := setTestOutputFile(assert, dir)
+	defer restore()
+
+	savedBroadcastExec := broadcastExec
+	defer func() {
+		broadcastExec = savedBroadcastExec
+		testingImpl.ListPodFunc = nil
+	}()
+
+	broadcastExec = func(containerID string, makeParams func(specProcess *oci.CompatOCIProcess) (execParams, error)) (execResult, error) {
+		fmt.Fprint(os.Stdout, containerID)
+		return execResult{exited: true}, nil
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{broadcastPodStatus(testPodID, testPodID, testContainerID)}, nil
+	}
+
+	newFlagSet := func(args ...string) *flag.FlagSet {
+		set := flag.NewFlagSet("", 0)
+		set.String("pod", "", "")
+		set.Var(&cli.StringSlice{}, "filter", "")
+		assert.NoError(set.Parse(args))
+		return set
+	}
+
+	// no command
+	execCLICommandFunc(assert, execAllCLICommand, newFlagSet("--pod", testContainerID), true)
+
+	// neither --pod nor --filter
+	execCLICommandFunc(assert, execAllCLICommand, newFlagSet("true"), true)
+
+	// both
+	execCLICommandFunc(assert, execAllCLICommand, newFlagSet("--pod", testContainerID, "--filter", "label=a", "true"), true)
+
+	// invalid filter
+	execCLICommandFunc(assert, execAllCLICommand, newFlagSet("--filter", "name=a", "true"), true)
+
+	// unknown container
+	execCLICommandFunc(assert, execAllCLICommand, newFlagSet("--pod", "unknown", "true"), true)
+
+	execCLICommandFunc(assert, execAllCLICommand, newFlagSet("--pod", testContainerID, "hostname"), false)
+
+	contents, err := getFileContents(outputFile.Name())
+	assert.NoError(err)
+
+	var results []broadcastResult
+	assert.NoError(json.Unmarshal([]byte(contents), &results))
+	assert.Len(results, 2)
+	assert.Equal(testPodID, results[0].Stdout)
+	assert.Equal(testContainerID, results[1].Stdout)
+	assert.Equal(0, *results[1].ExitCode)
+}
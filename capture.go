@@ -0,0 +1,212 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	defaultCaptureDuration = time.Minute
+	defaultCapturePackets  = 100000
+)
+
+// captureCommand returns the command capturing the packets of the
+// specified interface of a network namespace to a pcap file. It is a
+// variable rather than a function to allow tests to modify it.
+var captureCommand = func(netNSPath, iface, file string, packets uint64, filter []string) *exec.Cmd {
+	args := []string{"--net=" + netNSPath, "tcpdump", "-i", iface, "-w", file, "-U",
+		"-c", strconv.FormatUint(packets, 10)}
+
+	return exec.Command("nsenter", append(args, filter...)...)
+}
+
+// captureFile returns the path of the capture of the specified tap
+// device of a pod, in the diagnostics directory of the pod.
+func captureFile(podID, iface string, start time.Time) string {
+	name := fmt.Sprintf("capture-%s-%s.pcap", start.UTC().Format("20060102T150405Z"), iface)
+	return filepath.Join(runtimeOptions.CoreDump.podDir(podID), name)
+}
+
+// capturePackets captures the packets exchanged by the VM of the pod of
+// the specified container with the host, on each tap device of the pod,
+// until the specified number of packets have been captured on each or
+// ctx is done. The filter is a pcap filter expression. It returns the
+// paths of the capture files.
+func capturePackets(ctx context.Context, containerID string, packets uint64, filter []string) ([]string, error) {
+	status, podID, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := containerNetNSPath(status)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		return nil, errors.New("The pod has no network namespace path: its tap devices cannot be found")
+	}
+
+	taps, err := netNSStats(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(taps) == 0 {
+		return nil, fmt.Errorf("No tap device in the network namespace %v of the pod", path)
+	}
+
+	if err := os.MkdirAll(runtimeOptions.CoreDump.podDir(podID), diagnosticsDirMode); err != nil {
+		return nil, err
+	}
+
+	start := timeNow()
+
+	var files []string
+	var cmds []*exec.Cmd
+
+	for _, tap := range taps {
+		file := captureFile(podID, tap.Name, start)
+
+		cmd := captureCommand(path, tap.Name, file, packets, filter)
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Start(); err != nil {
+			stopCaptures(cmds)
+			for _, started := range cmds {
+				started.Wait()
+			}
+
+			return nil, fmt.Errorf("Unable to capture the packets of %v: %v", tap.Name, err)
+		}
+
+		files = append(files, file)
+		cmds = append(cmds, cmd)
+	}
+
+	done := make(chan error, len(cmds))
+	for _, cmd := range cmds {
+		go func(cmd *exec.Cmd) {
+			done <- cmd.Wait()
+		}(cmd)
+	}
+
+	var captureErr error
+
+	interrupted := ctx.Done()
+
+	for running := len(cmds); running > 0; {
+		select {
+		case err := <-done:
+			running--
+			if err != nil && captureErr == nil {
+				captureErr = err
+			}
+		case <-interrupted:
+			// Interrupted captures flush their file and exit.
+			stopCaptures(cmds)
+			interrupted = nil
+		}
+	}
+
+	return files, captureErr
+}
+
+// stopCaptures interrupts the specified captures.
+func stopCaptures(cmds []*exec.Cmd) {
+	for _, cmd := range cmds {
+		// The captures which already completed cannot be signalled.
+		cmd.Process.Signal(syscall.SIGINT)
+	}
+}
+
+var captureCLICommand = cli.Command{
+	Name:  "capture",
+	Usage: "capture the network packets of the VM of a pod",
+	ArgsUsage: `<container-id> [<filter>...]
+
+   <container-id> is the name of a container of the pod
+   <filter> is a pcap filter expression, such as "tcp port 80"`,
+	Description: `The capture command captures the packets exchanged by the VM of the pod
+   with the host, on each tap device connecting the VM to the network of
+   the pod, with tcpdump. The captures are written as pcap files to the
+   diagnostics directory of the pod, whose paths are displayed.
+
+   The capture stops after --duration, once --count packets have been
+   captured on each tap device, or when the command is interrupted.
+
+   The captures are removed with the diagnostics of the pod: when the pod
+   is deleted without having dumped core if core dumps are enabled, and
+   not at all otherwise. The pod must have a network namespace path. The
+   packets are captured on the host side: capturing inside the guest is
+   not supported by the agent.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "duration",
+			Value: defaultCaptureDuration,
+			Usage: "maximum duration of the capture",
+		},
+		cli.Uint64Flag{
+			Name:  "count",
+			Value: defaultCapturePackets,
+			Usage: "maximum number of packets captured on each tap device",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() < 1 {
+			return errors.New("Missing container ID")
+		}
+
+		duration := context.Duration("duration")
+		if duration <= 0 {
+			return errors.New("The duration must be greater than zero")
+		}
+
+		if context.Uint64("count") == 0 {
+			return errors.New("The count must be greater than zero")
+		}
+
+		ctx, cancel := commandContext(duration)
+		defer cancel()
+
+		files, err := capturePackets(ctx, context.Args().First(), context.Uint64("count"), context.Args().Tail())
+
+		for _, file := range files {
+			fmt.Fprintln(defaultOutputFile, file)
+		}
+
+		return err
+	},
+}
+
+var debugCLICommand = cli.Command{
+	Name:    "cc-debug",
+	Aliases: []string{"debug"},
+	Usage:   "troubleshoot pods",
+	Subcommands: []cli.Command{
+		captureCLICommand,
+	},
+}
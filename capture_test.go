@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupCaptureTest makes the test container a pod with the specified
+// network namespace path and tap devices, whose captures are made by
+// the specified shell script, run with the interface and the file as
+// arguments.
+func setupCaptureTest(assert *assert.Assertions, dir, netNSPath string, taps []string, script string) func() {
+	savedCoreDump, savedNetNSStats, savedCaptureCommand := runtimeOptions.CoreDump, netNSStats, captureCommand
+
+	runtimeOptions.CoreDump.Dir = filepath.Join(dir, "diagnostics")
+
+	netNSStats = func(path string) ([]netStats, error) {
+		var stats []netStats
+		for _, tap := range taps {
+			stats = append(stats, netStats{Name: tap})
+		}
+
+		return stats, nil
+	}
+
+	captureCommand = func(netNSPath, iface, file string, packets uint64, filter []string) *exec.Cmd {
+		return exec.Command("sh", "-c", script, "capture", iface, file)
+	}
+
+	bundlePath := makeNetNSBundle(assert, dir, netNSPath)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, vc.State{State: vc.StateRunning},
+			vc.State{State: vc.StateRunning}, map[string]string{oci.BundlePathKey: bundlePath}), nil
+	}
+
+	return func() {
+		runtimeOptions.CoreDump, netNSStats, captureCommand = savedCoreDump, savedNetNSStats, savedCaptureCommand
+		testingImpl.ListPodFunc = nil
+	}
+}
+
+func TestCapturePackets(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "capture-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	defer setupCaptureTest(assert, dir, "/var/run/netns/pod", []string{"tap0", "tap1"}, `echo "$1" > "$2"`)()
+
+	files, err := capturePackets(context.Background(), testContainerID, 10, nil)
+	assert.NoError(err)
+	assert.Len(files, 2)
+
+	for i, tap := range []string{"tap0", "tap1"} {
+		assert.Equal(runtimeOptions.CoreDump.podDir(testPodID), filepath.Dir(files[i]))
+		assert.Contains(filepath.Base(files[i]), tap)
+
+		contents, err := getFileContents(files[i])
+		assert.NoError(err)
+		assert.Equal(tap+"\n", contents)
+	}
+}
+
+func TestCapturePacketsInterrupted(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "capture-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	script := `trap 'echo interrupted > "$2"; exit 0' INT; sleep 10 & wait`
+	defer setupCaptureTest(assert, dir, "/var/run/netns/pod", []string{"tap0"}, script)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	files, err := capturePackets(ctx, testContainerID, 10, nil)
+	assert.NoError(err)
+	assert.Len(files, 1)
+
+	contents, err := getFileContents(files[0])
+	assert.NoError(err)
+	assert.Equal("interrupted\n", contents)
+}
+
+func TestCapturePacketsFail(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "capture-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	restore := setupCaptureTest(assert, dir, "/var/run/netns/pod", []string{"tap0"}, "exit 1")
+	files, err := capturePackets(context.Background(), testContainerID, 10, nil)
+	assert.Error(err)
+	assert.Len(files, 1)
+	restore()
+
+	os.RemoveAll(filepath.Join(dir, "bundle"))
+
+	// no tap device
+	restore = setupCaptureTest(assert, dir, "/var/run/netns/pod", nil, "exit 0")
+	_, err = capturePackets(context.Background(), testContainerID, 10, nil)
+	assert.Error(err)
+	restore()
+
+	os.RemoveAll(filepath.Join(dir, "bundle"))
+
+	// no network namespace path
+	restore = setupCaptureTest(assert, dir, "", []string{"tap0"}, "exit 0")
+	_, err = capturePackets(context.Background(), testContainerID, 10, nil)
+	assert.Error(err)
+	restore()
+
+	_, err = capturePackets(context.Background(), testContainerID, 10, nil)
+	assert.Error(err)
+}
+
+func TestCaptureCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, args := range [][]string{
+		{},
+		{"--duration", "0", testContainerID},
+		{"--count", "0", testContainerID},
+	} {
+		set := flag.NewFlagSet("", 0)
+		set.Duration("duration", defaultCaptureDuration, "")
+		set.Uint64("count", defaultCapturePackets, "")
+		assert.NoError(set.Parse(args))
+
+		execCLICommandFunc(assert, captureCLICommand, set, true)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
@@ -241,11 +242,38 @@ func hostIsClearContainersCapable(cpuinfoFile string) error {
 	return nil
 }
 
+// checkResult describes the result of "cc-check" in JSON.
+type checkResult struct {
+	Capable bool   `json:"capable"`
+	Error   string `json:"error,omitempty"`
+}
+
 var checkCLICommand = cli.Command{
 	Name:  "cc-check",
 	Usage: "tests if system can run " + project,
 	Action: func(context *cli.Context) error {
 		err := hostIsClearContainersCapable(procCPUInfo)
+
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if err == nil && ok {
+			err = checkKernelVariants(runtimeOptions.Kernels)
+		}
+
+		if err == nil && ok && !runtimeOptions.DisableKernelCheck {
+			err = checkGuestKernels(runtimeConfig.HypervisorConfig, runtimeOptions.Kernels)
+		}
+
+		if wantJSONOutput() {
+			result := checkResult{Capable: err == nil}
+			if err != nil {
+				result.Error = err.Error()
+			}
+
+			if writeErr := writeJSON(result); writeErr != nil {
+				return writeErr
+			}
+		}
+
 		if err != nil {
 			return fmt.Errorf("ERROR: %v", err)
 		}
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
@@ -352,6 +353,11 @@ func getEnvInfo(configFile, logfilePath string, config oci.RuntimeConfig) (env E
 }
 
 func showSettings(ccEnv EnvInfo, file *os.File) error {
+	if wantJSONOutput() {
+		// The JSON fields have the same names as the TOML keys.
+		return json.NewEncoder(file).Encode(ccEnv)
+	}
+
 	encoder := toml.NewEncoder(file)
 
 	err := encoder.Encode(ccEnv)
@@ -393,7 +399,23 @@ func handleSettings(file *os.File, metadata map[string]interface{}) error {
 var envCLICommand = cli.Command{
 	Name:  "cc-env",
 	Usage: "display settings",
+	Description: `The cc-env command displays the settings of the runtime and the host.
+
+   With --fingerprint, it displays instead the capabilities of the pods
+   the runtime can create on the node, in JSON, and records them in the
+   ` + fingerprintFile + ` file of the runtime state directory, where
+   device plugins and scheduler extenders can read them.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "fingerprint",
+			Usage: "display and record the capabilities fingerprint of the node",
+		},
+	},
 	Action: func(context *cli.Context) error {
+		if context.Bool("fingerprint") {
+			return handleFingerprint(defaultOutputFile, context.App.Metadata)
+		}
+
 		return handleSettings(defaultOutputFile, context.App.Metadata)
 	},
 }
@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -647,10 +648,7 @@ func TestCCEnvGetEnvInfoInvalidProxy(t *testing.T) {
 	assert.NoError(t, err)
 
 	// convert to an invalid proxy type
-	replacer := strings.NewReplacer(
-		`proxy.cc`, `proxy.foo`,
-		`url = "`+testProxyURL+`"`, `bar = "wibble"`)
-	newConfigData := replacer.Replace(configData)
+	newConfigData := strings.Replace(configData, `proxy.cc`, `proxy.foo`, 1)
 
 	err = createFile(configFile, newConfigData)
 	assert.NoError(t, err)
@@ -1149,7 +1147,7 @@ func TestCCEnvCLIFunction(t *testing.T) {
 	assert.NoError(t, err)
 
 	app := cli.NewApp()
-	ctx := cli.NewContext(app, nil, nil)
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), nil)
 	app.Name = "foo"
 
 	ctx.App.Metadata = map[string]interface{}{
@@ -1192,7 +1190,7 @@ func TestCCEnvCLIFunctionFail(t *testing.T) {
 	assert.NoError(t, err)
 
 	app := cli.NewApp()
-	ctx := cli.NewContext(app, nil, nil)
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), nil)
 	app.Name = "foo"
 
 	ctx.App.Metadata = map[string]interface{}{
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// cgroupsPathVariableRE matches the variables of a cgroups path template.
+var cgroupsPathVariableRE = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// cgroupsPathVariables are the variables of a cgroups path template.
+var cgroupsPathVariables = map[string]bool{
+	"pod":          true,
+	"container":    true,
+	"cgroups_path": true,
+}
+
+// cgroups are the settings of the host cgroups the runtime creates for
+// the shims of the containers.
+type cgroups struct {
+	// PathTemplate replaces the cgroups path of the OCI spec, below
+	// the root of each controller. "{pod}", "{container}" and
+	// "{cgroups_path}" are replaced by the pod ID, the container ID
+	// and the cgroups path of the spec.
+	PathTemplate string `toml:"path_template"`
+
+	// SkipEmptyResources skips the controllers for which the spec
+	// sets no limit.
+	SkipEmptyResources bool `toml:"skip_empty_resources"`
+}
+
+func (c cgroups) validate() error {
+	for _, match := range cgroupsPathVariableRE.FindAllStringSubmatch(c.PathTemplate, -1) {
+		if !cgroupsPathVariables[match[1]] {
+			return fmt.Errorf("Invalid cgroups path template %q: unknown variable %q", c.PathTemplate, match[0])
+		}
+	}
+
+	for _, elem := range strings.Split(c.PathTemplate, "/") {
+		if elem == ".." {
+			return fmt.Errorf("Invalid cgroups path template %q: must not contain \"..\"", c.PathTemplate)
+		}
+	}
+
+	return nil
+}
+
+// expand returns the cgroups path of a container from the template, or
+// "" if there is no template. The IDs are valid, and so cannot escape
+// the controller hierarchy.
+func (c cgroups) expand(ociSpec oci.CompatOCISpec, containerID string, isPod bool) (string, error) {
+	if c.PathTemplate == "" {
+		return "", nil
+	}
+
+	podID := containerID
+	if !isPod && strings.Contains(c.PathTemplate, "{pod}") {
+		var err error
+
+		if podID, err = ociSpec.PodID(); err != nil {
+			return "", err
+		}
+	}
+
+	path := strings.NewReplacer(
+		"{pod}", podID,
+		"{container}", containerID,
+		"{cgroups_path}", ociSpec.Linux.CgroupsPath,
+	).Replace(c.PathTemplate)
+
+	// The spec path may be absolute, or contain "..".
+	return filepath.Join("/", path), nil
+}
+
+// skip returns true if the runtime must not create the cgroup of a
+// controller whose resources are specified by resources, a pointer to
+// the resources of the controller in the spec.
+func (c cgroups) skip(resources interface{}) bool {
+	v := reflect.ValueOf(resources)
+	if v.IsNil() {
+		return true
+	}
+
+	if !c.SkipEmptyResources {
+		return false
+	}
+
+	return reflect.DeepEqual(v.Elem().Interface(), reflect.Zero(v.Elem().Type()).Interface())
+}
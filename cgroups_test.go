@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroupsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, template := range []string{
+		"",
+		"/cc-runtime/{pod}/{container}",
+		"kubepods/{cgroups_path}",
+		"/static",
+	} {
+		assert.NoError(cgroups{PathTemplate: template}.validate(), template)
+	}
+
+	for _, template := range []string{
+		"/cc-runtime/{pod_id}",
+		"/cc-runtime/{}",
+		"/cc-runtime/../{container}",
+	} {
+		assert.Error(cgroups{PathTemplate: template}.validate(), template)
+	}
+}
+
+func TestCgroupsExpand(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := oci.CompatOCISpec{}
+	spec.Linux = &specs.Linux{CgroupsPath: "/kubepods/pod1234"}
+	spec.Annotations = map[string]string{
+		oci.CRISandboxNameKeyList[0]: testPodID,
+	}
+
+	path, err := cgroups{}.expand(spec, testContainerID, false)
+	assert.NoError(err)
+	assert.Empty(path)
+
+	c := cgroups{PathTemplate: "/cc-runtime/{pod}/{container}"}
+
+	path, err = c.expand(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Equal(filepath.Join("/cc-runtime", testContainerID, testContainerID), path)
+
+	path, err = c.expand(spec, testContainerID, false)
+	assert.NoError(err)
+	assert.Equal(filepath.Join("/cc-runtime", testPodID, testContainerID), path)
+
+	// the spec path cannot escape the template
+	spec.Linux.CgroupsPath = "../../escape"
+	c.PathTemplate = "{cgroups_path}/cc"
+
+	path, err = c.expand(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Equal("/escape/cc", path)
+
+	// no pod ID
+	spec.Annotations = nil
+	c.PathTemplate = "{pod}"
+
+	_, err = c.expand(spec, testContainerID, false)
+	assert.Error(err)
+}
+
+func TestCgroupsSkip(t *testing.T) {
+	assert := assert.New(t)
+
+	limit := uint64(1024)
+
+	assert.True(cgroups{}.skip((*specs.LinuxMemory)(nil)))
+	assert.False(cgroups{}.skip(&specs.LinuxMemory{}))
+	assert.False(cgroups{}.skip(&specs.LinuxMemory{Limit: &limit}))
+
+	c := cgroups{SkipEmptyResources: true}
+
+	assert.True(c.skip((*specs.LinuxCPU)(nil)))
+	assert.True(c.skip(&specs.LinuxCPU{}))
+	assert.True(c.skip(&specs.LinuxPids{}))
+	assert.False(c.skip(&specs.LinuxPids{Limit: 10}))
+	assert.False(c.skip(&specs.LinuxMemory{Limit: &limit}))
+	assert.False(c.skip(&specs.LinuxCPU{Cpus: "0-1"}))
+}
+
+func TestProcessCgroupsPathOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	limit := uint64(1024)
+
+	spec := oci.CompatOCISpec{}
+	spec.Linux = &specs.Linux{
+		CgroupsPath: "/kubepods/pod1234",
+		Resources: &specs.LinuxResources{
+			Memory: &specs.LinuxMemory{Limit: &limit},
+			CPU:    &specs.LinuxCPU{},
+		},
+	}
+
+	runtimeOptions.Cgroups = cgroups{
+		PathTemplate:       "/cc-runtime/{pod}/{container}",
+		SkipEmptyResources: true,
+	}
+
+	// an absolute spec path without cgroup mount is not an error with
+	// a template
+	paths, err := processCgroupsPath(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Equal([]string{
+		filepath.Join(cgroupsDirPath, "memory", "cc-runtime", testContainerID, testContainerID),
+	}, paths)
+
+	memoryCgroup, err := shimMemoryCgroup(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Equal(paths[0], memoryCgroup)
+
+	// no limit
+	spec.Linux.Resources.Memory = &specs.LinuxMemory{}
+
+	paths, err = processCgroupsPath(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Empty(paths)
+
+	memoryCgroup, err = shimMemoryCgroup(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Empty(memoryCgroup)
+
+	runtimeOptions.Cgroups.SkipEmptyResources = false
+
+	paths, err = processCgroupsPath(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Len(paths, 2)
+}
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	goruntime "runtime"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	vc "github.com/containers/virtcontainers"
@@ -39,11 +40,11 @@ const (
 // tables). The names of these tables are in dotted ("nested table")
 // form:
 //
-//   [<component>.<type>]
+//	[<component>.<type>]
 //
 // The components are hypervisor, proxy, shim and agent. For example,
 //
-//   [proxy.cc]
+//	[proxy.cc]
 //
 // The currently supported types are listed below:
 const (
@@ -53,6 +54,9 @@ const (
 	// supported proxy component types
 	ccProxyTableType = "cc"
 
+	// recognised but unsupported proxy component types
+	noopProxyTableType = "noop"
+
 	// supported shim component types
 	ccShimTableType = "cc"
 
@@ -63,8 +67,19 @@ const (
 var (
 	errUnknownHypervisor = errors.New("unknown hypervisor")
 	errUnknownAgent      = errors.New("unknown agent")
+
+	// The noop proxy of virtcontainers drops the commands sent to the
+	// agent: it is only usable with an agent reachable without a
+	// proxy, which hyperstart is not.
+	errNoopProxy = errors.New("the noop proxy requires an agent which does not need a proxy, and the hyperstart agent does")
 )
 
+// runtimeOptions stores the settings from the [runtime] table that are
+// consumed by the runtime itself rather than by virtcontainers. It is
+// set by loadConfiguration() and is a variable to allow the tests to
+// modify it.
+var runtimeOptions runtime
+
 type tomlConfig struct {
 	Hypervisor map[string]hypervisor
 	Proxy      map[string]proxy
@@ -82,14 +97,90 @@ type hypervisor struct {
 	DefaultVCPUs          int32  `toml:"default_vcpus"`
 	DefaultMemSz          uint32 `toml:"default_memory"`
 	DisableBlockDeviceUse bool   `toml:"disable_block_device_use"`
+	MemoryCompression     string `toml:"memory_compression"`
+	MemoryCompressor      string `toml:"memory_compressor"`
+	MemoryCompressionPct  uint32 `toml:"memory_compression_percent"`
+
+	SharedFSCache     string `toml:"shared_fs_cache"`
+	SharedFSCacheSize uint32 `toml:"shared_fs_cache_size"`
 }
 
 type proxy struct {
 	URL string `toml:"url"`
+
+	RestartCommand []string `toml:"restart_command"`
+	RestartTimeout string   `toml:"restart_timeout"`
 }
 
 type runtime struct {
-	GlobalLogPath string `toml:"global_log_path"`
+	Root      string `toml:"root"`
+	SocketDir string `toml:"socket_dir"`
+
+	GlobalLogPath   string `toml:"global_log_path"`
+	EnableKSM       bool   `toml:"enable_ksm"`
+	EnableGuestSwap bool   `toml:"enable_guest_swap"`
+	GuestSwapType   string `toml:"guest_swap_type"`
+
+	IdlePauseTimeout string `toml:"idle_pause_timeout"`
+
+	HealthCheckInterval string `toml:"health_check_interval"`
+	HealthCheckTimeout  string `toml:"health_check_timeout"`
+	HealthCheckRetries  uint32 `toml:"health_check_retries"`
+
+	EnableSandboxGroups bool `toml:"experimental_sandbox_groups"`
+
+	Strict bool `toml:"strict"`
+
+	DisableKernelCheck bool `toml:"disable_kernel_check"`
+
+	PolicyFile string `toml:"policy_file"`
+	PolicyKey  string `toml:"policy_key"`
+
+	ToolboxDir string `toml:"toolbox_dir"`
+
+	MountAllow []string `toml:"mount_allow"`
+	MountDeny  []string `toml:"mount_deny"`
+
+	Privileged string `toml:"privileged"`
+
+	ResourceManagement string `toml:"resource_management"`
+
+	HostCPUSet string `toml:"host_cpuset"`
+
+	CoreScheduling bool `toml:"core_scheduling"`
+
+	SecretVolumes string `toml:"secret_volumes"`
+
+	Profiles map[string]profile `toml:"profile"`
+
+	Kernels map[string]kernelVariant `toml:"kernel"`
+
+	Partitions map[string]partition `toml:"partition"`
+
+	Mitigations        map[string]mitigationProfile `toml:"mitigations"`
+	DefaultMitigations string                       `toml:"default_mitigations"`
+
+	Rlimits map[string]int64 `toml:"rlimits"`
+
+	CoreDump coreDump `toml:"coredump"`
+
+	ContainerLogs containerLogs `toml:"container_logs"`
+
+	NetworkFS networkFS `toml:"network_fs"`
+
+	Timeouts operationTimeouts `toml:"timeouts"`
+
+	Cgroups cgroups `toml:"cgroups"`
+
+	NetNS netNS `toml:"netns"`
+
+	GuestConsole guestConsole `toml:"guest_console"`
+
+	DeferredDelete deferredDelete `toml:"deferred_delete"`
+
+	SlowLog slowLog `toml:"slow_log"`
+
+	OOM guestOOM `toml:"oom"`
 }
 
 type shim struct {
@@ -186,6 +277,191 @@ func (a agent) pauseRootPath() string {
 	return a.PauseRootPath
 }
 
+func (r runtime) guestSwapType() string {
+	if r.GuestSwapType == "" {
+		return defaultGuestSwapType
+	}
+
+	return r.GuestSwapType
+}
+
+// validate checks the [runtime] settings.
+func (r runtime) validate() error {
+	if !validGuestSwapType(r.guestSwapType()) {
+		return fmt.Errorf("Invalid guest swap type %q", r.GuestSwapType)
+	}
+
+	if err := validInstanceDir("root", r.Root); err != nil {
+		return err
+	}
+
+	if err := validInstanceDir("socket_dir", r.SocketDir); err != nil {
+		return err
+	}
+
+	if !validPrivileged(r.privileged()) {
+		return fmt.Errorf("Invalid privileged container handling %q", r.Privileged)
+	}
+
+	if !validResourceManagement(r.resourceManagement()) {
+		return fmt.Errorf("Invalid resource management mode %q", r.ResourceManagement)
+	}
+
+	if !validSecretVolumes(r.secretVolumes()) {
+		return fmt.Errorf("Invalid secret volumes handling %q", r.SecretVolumes)
+	}
+
+	for _, patterns := range [][]string{r.MountAllow, r.MountDeny} {
+		if err := validMountPatterns(patterns); err != nil {
+			return err
+		}
+	}
+
+	if err := validProfiles(r.Profiles); err != nil {
+		return err
+	}
+
+	if err := validKernelVariants(r.Kernels); err != nil {
+		return err
+	}
+
+	if err := validPartitions(r.Partitions, r.HostCPUSet); err != nil {
+		return err
+	}
+
+	if err := validMitigationProfiles(r.Mitigations, r.DefaultMitigations); err != nil {
+		return err
+	}
+
+	if err := validRlimits(r.Rlimits); err != nil {
+		return err
+	}
+
+	if r.HostCPUSet != "" {
+		if _, err := parseCPUSet(r.HostCPUSet); err != nil {
+			return err
+		}
+	}
+
+	if err := r.CoreDump.validate(); err != nil {
+		return err
+	}
+
+	if err := r.ContainerLogs.validate(); err != nil {
+		return err
+	}
+
+	if err := r.NetworkFS.validate(); err != nil {
+		return err
+	}
+
+	if err := r.Timeouts.validate(); err != nil {
+		return err
+	}
+
+	if err := r.Cgroups.validate(); err != nil {
+		return err
+	}
+
+	if err := r.NetNS.validate(); err != nil {
+		return err
+	}
+
+	if err := r.GuestConsole.validate(); err != nil {
+		return err
+	}
+
+	if err := r.DeferredDelete.validate(); err != nil {
+		return err
+	}
+
+	if err := r.SlowLog.validate(); err != nil {
+		return err
+	}
+
+	if err := r.OOM.validate(); err != nil {
+		return err
+	}
+
+	if _, ok := r.Rlimits["core"]; ok && r.CoreDump.Enable {
+		return errors.New("The core resource limit cannot be set when core dumps are collected: use the coredump max_size")
+	}
+
+	if r.PolicyFile != "" && r.PolicyKey == "" {
+		return errors.New("A policy_key is required to verify the policy_file")
+	}
+
+	if r.ToolboxDir != "" && !filepath.IsAbs(r.ToolboxDir) {
+		return fmt.Errorf("Toolbox directory %q is not an absolute path", r.ToolboxDir)
+	}
+
+	if r.IdlePauseTimeout != "" {
+		timeout, err := time.ParseDuration(r.IdlePauseTimeout)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("Invalid idle pause timeout %q", r.IdlePauseTimeout)
+		}
+	}
+
+	if r.HealthCheckInterval != "" {
+		interval, err := time.ParseDuration(r.HealthCheckInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("Invalid health check interval %q", r.HealthCheckInterval)
+		}
+	}
+
+	if r.HealthCheckTimeout != "" {
+		timeout, err := time.ParseDuration(r.HealthCheckTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid health check timeout %q", r.HealthCheckTimeout)
+		}
+	}
+
+	return nil
+}
+
+// idlePauseTimeout returns how long a pod may be unused before
+// "cc-idle-pause --idle" pauses it. Zero means idle pods are never
+// paused.
+func (r runtime) idlePauseTimeout() time.Duration {
+	// validated by validate()
+	timeout, _ := time.ParseDuration(r.IdlePauseTimeout)
+	return timeout
+}
+
+// healthCheckInterval returns the time between each check of the pods
+// health by "cc-health".
+func (r runtime) healthCheckInterval() time.Duration {
+	if r.HealthCheckInterval == "" {
+		return defaultHealthCheckInterval
+	}
+
+	// validated by validate()
+	interval, _ := time.ParseDuration(r.HealthCheckInterval)
+	return interval
+}
+
+// healthCheckTimeout returns how long the hypervisor and the agent of a
+// pod have to answer a health check.
+func (r runtime) healthCheckTimeout() time.Duration {
+	if r.HealthCheckTimeout == "" {
+		return defaultHealthCheckTimeout
+	}
+
+	// validated by validate()
+	timeout, _ := time.ParseDuration(r.HealthCheckTimeout)
+	return timeout
+}
+
+// healthCheckRetries returns the number of consecutive failed health
+// checks after which a pod is considered unhealthy.
+func (r runtime) healthCheckRetries() uint32 {
+	if r.HealthCheckRetries == 0 {
+		return defaultHealthCheckRetries
+	}
+
+	return r.HealthCheckRetries
+}
+
 func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 	hypervisor := h.path()
 	kernel := h.kernel()
@@ -199,11 +475,29 @@ func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 				fmt.Errorf("File does not exist: %v", file)
 		}
 	}
+
+	params := vc.DeserializeParams(strings.Fields(kernelParams))
+
+	compressionParams, err := memoryCompressionKernelParams(h.MemoryCompression,
+		h.MemoryCompressor, h.MemoryCompressionPct)
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
+	params = append(params, compressionParams...)
+
+	sharedFSParams, err := sharedFSKernelParams(h.SharedFSCache, h.SharedFSCacheSize)
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
+	params = append(params, sharedFSParams...)
+
 	return vc.HypervisorConfig{
 		HypervisorPath:        hypervisor,
 		KernelPath:            kernel,
 		ImagePath:             image,
-		KernelParams:          vc.DeserializeParams(strings.Fields(kernelParams)),
+		KernelParams:          params,
 		HypervisorMachineType: machineType,
 		DefaultVCPUs:          h.defaultVCPUs(),
 		DefaultMemSz:          h.defaultMemSz(),
@@ -259,6 +553,10 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 	for k, proxy := range tomlConf.Proxy {
 		switch k {
 		case ccProxyTableType:
+			if err := proxy.validate(); err != nil {
+				return fmt.Errorf("%v: %v", configPath, err)
+			}
+
 			pConfig := vc.CCProxyConfig{
 				URL: proxy.url(),
 			}
@@ -267,6 +565,8 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 			config.ProxyConfig = pConfig
 
 			break
+		case noopProxyTableType:
+			return fmt.Errorf("%v: %v", configPath, errNoopProxy)
 		}
 	}
 
@@ -302,6 +602,30 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 	return nil
 }
 
+// checkUnknownOptions returns an error if the configuration has options
+// the runtime does not know, such as misspelt options or options of
+// another version, rather than silently ignoring them. The options
+// below an unknown table are not reported separately.
+func checkUnknownOptions(md toml.MetaData) error {
+	var unknown []string
+
+	for _, key := range md.Undecoded() {
+		name := key.String()
+
+		if len(unknown) > 0 && strings.HasPrefix(name, unknown[len(unknown)-1]+".") {
+			continue
+		}
+
+		unknown = append(unknown, name)
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("Unknown options: %v", strings.Join(unknown, ", "))
+}
+
 // loadConfiguration loads the configuration file and converts it into a
 // runtime configuration.
 //
@@ -351,12 +675,21 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 		return "", "", config, err
 	}
 
+	configData, err = expandConfig(configData)
+	if err != nil {
+		return "", "", config, fmt.Errorf("%v: %v", resolved, err)
+	}
+
 	var tomlConf tomlConfig
-	_, err = toml.Decode(string(configData), &tomlConf)
+	md, err := toml.Decode(string(configData), &tomlConf)
 	if err != nil {
 		return "", "", config, err
 	}
 
+	if err := checkUnknownOptions(md); err != nil {
+		return "", "", config, fmt.Errorf("%v: %v", resolved, err)
+	}
+
 	logfilePath = tomlConf.Runtime.GlobalLogPath
 
 	if !ignoreLogging {
@@ -370,9 +703,17 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 		ccLog.Debugf("TOML configuration: %v", tomlConf)
 	}
 
+	if err := tomlConf.Runtime.validate(); err != nil {
+		return "", "", config, fmt.Errorf("%v: %v", resolved, err)
+	}
+
+	runtimeOptions = tomlConf.Runtime
+
 	if err := updateRuntimeConfig(resolved, tomlConf, &config); err != nil {
 		return "", "", config, err
 	}
 
+	proxyOptions = tomlConf.Proxy[ccProxyTableType]
+
 	return resolved, logfilePath, config, nil
 }
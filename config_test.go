@@ -26,7 +26,9 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/stretchr/testify/assert"
@@ -705,6 +707,22 @@ func TestNewQemuHypervisorConfig(t *testing.T) {
 		t.Errorf("Expected value for disable block usage %v, got %v", disableBlock, config.DisableBlockDeviceUse)
 	}
 
+	hypervisor.MemoryCompression = memoryCompressionZswap
+	config, err = newQemuHypervisorConfig(hypervisor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedParams := []vc.Param{{Key: zswapEnabledParam, Value: "1"}}
+	if !reflect.DeepEqual(config.KernelParams, expectedParams) {
+		t.Errorf("Expected kernel parameters %v, got %v", expectedParams, config.KernelParams)
+	}
+
+	hypervisor.MemoryCompression = "floppy"
+	_, err = newQemuHypervisorConfig(hypervisor)
+	if err == nil {
+		t.Fatalf("Expected newQemuHypervisorConfig to fail with an invalid memory compression mode")
+	}
 }
 
 func TestNewHyperstartAgentConfig(t *testing.T) {
@@ -871,3 +889,170 @@ func TestAgentDefaults(t *testing.T) {
 	a.PauseRootPath = path
 	assert.Equal(t, a.pauseRootPath(), path, "custom agent pause root path wrong")
 }
+
+func TestConfigLoadConfigurationRuntimeOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	text, err := getFileContents(config.ConfigPath)
+	assert.NoError(err)
+
+	err = createFile(config.ConfigPath, text+"\nenable_ksm = true\n")
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+
+	assert.True(runtimeOptions.EnableKSM)
+	assert.Equal(config.LogPath, runtimeOptions.GlobalLogPath)
+}
+
+func TestConfigLoadConfigurationFailInvalidRuntimeOptions(t *testing.T) {
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	testLoadConfiguration(t, tmpdir,
+		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
+			expectFail := true
+
+			text, err := getFileContents(config.ConfigPath)
+			if err != nil {
+				return expectFail, err
+			}
+
+			err = createFile(config.ConfigPath, text+"\nguest_swap_type = \"floppy\"\n")
+			if err != nil {
+				return expectFail, err
+			}
+
+			return expectFail, nil
+		})
+}
+
+func TestConfigLoadConfigurationFailUnknownOption(t *testing.T) {
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	testLoadConfiguration(t, tmpdir,
+		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
+			expectFail := true
+
+			text, err := getFileContents(config.ConfigPath)
+			if err != nil {
+				return expectFail, err
+			}
+
+			err = createFile(config.ConfigPath, text+"\n[hypervisor.qemu.sandbox]\nseccomp = true\n")
+			if err != nil {
+				return expectFail, err
+			}
+
+			return expectFail, nil
+		})
+}
+
+func TestCheckUnknownOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	var tomlConf tomlConfig
+
+	md, err := toml.Decode(`
+[hypervisor.qemu]
+path = "/usr/bin/qemu-lite-system-x86_64"
+
+[runtime]
+enable_ksm = true
+`, &tomlConf)
+	assert.NoError(err)
+	assert.NoError(checkUnknownOptions(md))
+
+	md, err = toml.Decode(`
+[hypervisor.qemu]
+path = "/usr/bin/qemu-lite-system-x86_64"
+enable_nested_virt = true
+
+[runtime.jailer]
+enable = true
+`, &tomlConf)
+	assert.NoError(err)
+
+	err = checkUnknownOptions(md)
+	assert.Error(err)
+	assert.Equal("Unknown options: hypervisor.qemu.enable_nested_virt, runtime.jailer", err.Error())
+}
+
+func TestRuntimeIdlePauseTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	r := runtime{}
+	assert.NoError(r.validate())
+	assert.Equal(time.Duration(0), r.idlePauseTimeout())
+
+	r.IdlePauseTimeout = "90s"
+	assert.NoError(r.validate())
+	assert.Equal(90*time.Second, r.idlePauseTimeout())
+
+	for _, timeout := range []string{"foo", "10", "-1m"} {
+		r.IdlePauseTimeout = timeout
+		assert.Error(r.validate(), "%q", timeout)
+	}
+}
+
+func TestRuntimeHealthCheckSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	r := runtime{}
+	assert.NoError(r.validate())
+	assert.Equal(defaultHealthCheckInterval, r.healthCheckInterval())
+	assert.Equal(defaultHealthCheckTimeout, r.healthCheckTimeout())
+	assert.Equal(uint32(defaultHealthCheckRetries), r.healthCheckRetries())
+
+	r.HealthCheckInterval = "1m"
+	r.HealthCheckTimeout = "2s"
+	r.HealthCheckRetries = 1
+	assert.NoError(r.validate())
+	assert.Equal(time.Minute, r.healthCheckInterval())
+	assert.Equal(2*time.Second, r.healthCheckTimeout())
+	assert.Equal(uint32(1), r.healthCheckRetries())
+
+	for _, value := range []string{"foo", "10", "0s", "-1m"} {
+		r.HealthCheckInterval = value
+		assert.Error(r.validate(), "%q", value)
+	}
+
+	r.HealthCheckInterval = ""
+
+	for _, value := range []string{"foo", "10", "0s", "-1m"} {
+		r.HealthCheckTimeout = value
+		assert.Error(r.validate(), "%q", value)
+	}
+}
+
+func TestRuntimeValidatePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	r := runtime{PolicyFile: "/etc/policy.toml"}
+	assert.Error(r.validate())
+
+	r.PolicyKey = "/etc/policy.pub"
+	assert.NoError(r.validate())
+
+	r.ToolboxDir = "toolbox"
+	assert.Error(r.validate())
+
+	r.ToolboxDir = "/usr/libexec/clear-containers/toolbox"
+	assert.NoError(r.validate())
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configVariableRE matches the variables which may be used in the
+// configuration file: "@NAME@" and "${NAME}".
+var configVariableRE = regexp.MustCompile(`@([A-Za-z_][A-Za-z0-9_]*)@|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// configVariableNameRE matches a valid variable name.
+var configVariableNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// configValuesFile is the file defining the values of the configuration
+// variables not set in the environment. It is set from the global
+// "--cc-config-values" option. An empty path means no values file.
+var configValuesFile = ""
+
+// loadConfigValues reads a file of "NAME=value" lines. Empty lines and
+// lines starting with "#" are ignored.
+func loadConfigValues(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(fields[0])
+
+		if len(fields) != 2 || !configVariableNameRE.MatchString(name) {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value, got %q", path, n, line)
+		}
+
+		values[name] = strings.TrimSpace(fields[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// expandConfigVariables replaces the variables of the configuration file
+// by their value, taken from the environment or, failing that, from the
+// values. Comment lines are left untouched. Referencing an undefined
+// variable is an error.
+func expandConfigVariables(data []byte, values map[string]string) ([]byte, error) {
+	undefined := make(map[string]bool)
+
+	lookup := func(match []byte) []byte {
+		groups := configVariableRE.FindSubmatch(match)
+
+		name := string(groups[1])
+		if name == "" {
+			name = string(groups[2])
+		}
+
+		if value, ok := os.LookupEnv(name); ok {
+			return []byte(value)
+		}
+
+		if value, ok := values[name]; ok {
+			return []byte(value)
+		}
+
+		undefined[name] = true
+
+		return match
+	}
+
+	lines := bytes.SplitAfter(data, []byte("\n"))
+
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) {
+			continue
+		}
+
+		lines[i] = configVariableRE.ReplaceAllFunc(line, lookup)
+	}
+
+	if len(undefined) > 0 {
+		var names []string
+		for name := range undefined {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("Undefined configuration variables: %s", strings.Join(names, ", "))
+	}
+
+	return bytes.Join(lines, nil), nil
+}
+
+// expandConfig expands the variables of the configuration file, using
+// the values file if one was specified.
+func expandConfig(data []byte) ([]byte, error) {
+	var values map[string]string
+
+	if configValuesFile != "" {
+		var err error
+
+		values, err = loadConfigValues(configValuesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return expandConfigVariables(data, values)
+}
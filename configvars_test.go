@@ -0,0 +1,147 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigValues(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "config-values-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "values")
+
+	_, err = loadConfigValues(path)
+	assert.Error(err)
+
+	err = createFile(path, "# fleet values\nNODE_ARCH=x86_64\n\n KERNEL_VERSION = 4.14.1 \nEMPTY=\nPARAMS=a=b c\n")
+	assert.NoError(err)
+
+	values, err := loadConfigValues(path)
+	assert.NoError(err)
+	assert.Equal(map[string]string{
+		"NODE_ARCH":      "x86_64",
+		"KERNEL_VERSION": "4.14.1",
+		"EMPTY":          "",
+		"PARAMS":         "a=b c",
+	}, values)
+
+	for _, contents := range []string{"NODE_ARCH\n", "1ARCH=x\n", "NODE-ARCH=x\n", "=x\n"} {
+		err = createFile(path, contents)
+		assert.NoError(err)
+
+		_, err = loadConfigValues(path)
+		assert.Error(err, "%q", contents)
+	}
+}
+
+func TestExpandConfigVariables(t *testing.T) {
+	assert := assert.New(t)
+
+	const envName = "CC_RUNTIME_TEST_CONFIG_VARIABLE"
+
+	os.Setenv(envName, "from-env")
+	defer os.Unsetenv(envName)
+
+	values := map[string]string{
+		"KERNEL_VERSION": "4.14.1",
+		"NODE_ARCH":      "x86_64",
+		envName:          "from-values",
+	}
+
+	type testData struct {
+		data        string
+		expected    string
+		expectError bool
+	}
+
+	data := []testData{
+		{"", "", false},
+		{"path = \"/usr/bin/qemu\"\n", "path = \"/usr/bin/qemu\"\n", false},
+		{"kernel = \"/boot/vmlinuz-@KERNEL_VERSION@\"\n", "kernel = \"/boot/vmlinuz-4.14.1\"\n", false},
+		{"image = \"/images/${NODE_ARCH}/@KERNEL_VERSION@.img\"", "image = \"/images/x86_64/4.14.1.img\"", false},
+		{"foo = \"${" + envName + "}\"\n", "foo = \"from-env\"\n", false},
+		{"# comments are ignored: ${UNDEFINED}\nfoo = 1\n", "# comments are ignored: ${UNDEFINED}\nfoo = 1\n", false},
+		{"not_variables = \"@ @@ $NODE_ARCH ${1} @-@\"\n", "not_variables = \"@ @@ $NODE_ARCH ${1} @-@\"\n", false},
+		{"foo = \"${UNDEFINED}\"\n", "", true},
+	}
+
+	for _, d := range data {
+		result, err := expandConfigVariables([]byte(d.data), values)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, string(result), "%+v", d)
+	}
+
+	// all the undefined variables are reported
+	_, err := expandConfigVariables([]byte("a = \"${B_UNDEFINED}\"\nb = \"@A_UNDEFINED@ ${B_UNDEFINED}\"\n"), nil)
+	assert.Error(err)
+	assert.True(strings.HasSuffix(err.Error(), "A_UNDEFINED, B_UNDEFINED"), err.Error())
+}
+
+func TestConfigLoadConfigurationVariables(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	savedRuntimeOptions := runtimeOptions
+	savedConfigValuesFile := configValuesFile
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+		configValuesFile = savedConfigValuesFile
+	}()
+
+	text, err := getFileContents(config.ConfigPath)
+	assert.NoError(err)
+
+	err = createFile(config.ConfigPath, text+"\nguest_swap_type = \"${SWAP_TYPE}\"\n")
+	assert.NoError(err)
+
+	// undefined variable
+	configValuesFile = ""
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.Error(err)
+
+	// missing values file
+	configValuesFile = filepath.Join(tmpdir, "values")
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.Error(err)
+
+	err = createFile(configValuesFile, "SWAP_TYPE="+guestSwapFile+"\n")
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Equal(guestSwapFile, runtimeOptions.GuestSwapType)
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDiagnosticsDir = "/var/lib/clear-containers/diagnostics"
+
+	// defaultCoreDumpMaxSize is large enough for the core of a
+	// hypervisor running a guest with the default amount of memory.
+	defaultCoreDumpMaxSize = 4 * 1024 * 1024 * 1024
+
+	defaultCoreDumpMaxCount = 3
+	defaultCoreDumpMaxAge   = 7 * 24 * time.Hour
+
+	// coreFilePrefix is the prefix of the name of the files the kernel
+	// writes core dumps to, unless core_pattern is an absolute path or
+	// a pipe.
+	coreFilePrefix = "core"
+
+	diagnosticsDirMode = os.FileMode(0750)
+)
+
+// corePatternFile is the file holding the kernel core_pattern.
+var corePatternFile = "/proc/sys/kernel/core_pattern"
+
+// coreDump describes how the core dumps of the hypervisor and of the
+// shims are collected.
+//
+// The runtime launches them from the diagnostics directory of their pod
+// with a core file size limit of MaxSize. When core_pattern is a
+// relative path (like the default "core"), the kernel writes their core
+// dumps to that directory.
+type coreDump struct {
+	Enable bool `toml:"enable"`
+
+	// Dir is the directory below which the diagnostics directory of
+	// each pod is created.
+	Dir string `toml:"diagnostics_dir"`
+
+	// MaxSize is the size in bytes above which core dumps are
+	// truncated.
+	MaxSize uint64 `toml:"max_size"`
+
+	// MaxCount is the number of core dumps kept for each pod. The
+	// oldest ones are removed first.
+	MaxCount uint32 `toml:"max_count"`
+
+	// MaxAge is how long the diagnostics of a pod are kept after
+	// its last core dump.
+	MaxAge string `toml:"max_age"`
+}
+
+func (c coreDump) dir() string {
+	if c.Dir == "" {
+		return defaultDiagnosticsDir
+	}
+
+	return c.Dir
+}
+
+func (c coreDump) maxSize() uint64 {
+	if c.MaxSize == 0 {
+		return defaultCoreDumpMaxSize
+	}
+
+	return c.MaxSize
+}
+
+func (c coreDump) maxCount() int {
+	if c.MaxCount == 0 {
+		return defaultCoreDumpMaxCount
+	}
+
+	return int(c.MaxCount)
+}
+
+func (c coreDump) maxAge() time.Duration {
+	if c.MaxAge == "" {
+		return defaultCoreDumpMaxAge
+	}
+
+	// checked by validate()
+	age, _ := time.ParseDuration(c.MaxAge)
+	return age
+}
+
+// validate checks the core dump settings.
+func (c coreDump) validate() error {
+	if !filepath.IsAbs(c.dir()) {
+		return fmt.Errorf("Invalid core dump diagnostics_dir %q: must be an absolute path", c.Dir)
+	}
+
+	if c.MaxAge != "" {
+		age, err := time.ParseDuration(c.MaxAge)
+		if err != nil || age <= 0 {
+			return fmt.Errorf("Invalid core dump max_age %q", c.MaxAge)
+		}
+	}
+
+	return nil
+}
+
+// podDir returns the diagnostics directory of the specified pod.
+func (c coreDump) podDir(podID string) string {
+	return filepath.Join(c.dir(), podID)
+}
+
+// enter prepares the runtime to launch components of the specified pod
+// so that they dump core into the diagnostics directory of the pod. The
+// returned function must be called once they have been launched to
+// restore the working directory of the runtime.
+func (c coreDump) enter(podID string) (func(), error) {
+	noop := func() {}
+
+	if !c.Enable {
+		return noop, nil
+	}
+
+	dir := c.podDir(podID)
+	if err := os.MkdirAll(dir, diagnosticsDirMode); err != nil {
+		return noop, err
+	}
+
+	if err := setProcessRlimit("core", c.maxSize()); err != nil {
+		return noop, fmt.Errorf("Unable to set the core dump size limit: %v", err)
+	}
+
+	checkCorePattern(dir)
+
+	if err := c.prune(podID); err != nil {
+		// Not fatal: old diagnostics just use more disk space.
+		ccLog.Warnf("Unable to remove old diagnostics: %v", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return noop, err
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		return noop, err
+	}
+
+	return func() {
+		if err := os.Chdir(cwd); err != nil {
+			ccLog.Warnf("Unable to return to directory %v: %v", cwd, err)
+		}
+	}, nil
+}
+
+// checkCorePattern warns if the kernel does not write core dumps to the
+// working directory of the crashed process.
+func checkCorePattern(dir string) {
+	data, err := ioutil.ReadFile(corePatternFile)
+	if err != nil {
+		ccLog.Warnf("Unable to read core_pattern: %v", err)
+		return
+	}
+
+	pattern := strings.TrimSpace(string(data))
+	if strings.HasPrefix(pattern, "|") || filepath.IsAbs(pattern) {
+		warn(warningCorePattern, "Core dumps will not be written to %v: core_pattern is %q", dir, pattern)
+	}
+}
+
+// coreFiles returns the core dumps, the dump of the guest console and
+// the output of a hypervisor which failed to start found in the
+// specified directory, newest first.
+func coreFiles(dir string) ([]os.FileInfo, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var cores []os.FileInfo
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		if strings.HasPrefix(entry.Name(), coreFilePrefix) || entry.Name() == guestConsoleFile || entry.Name() == hypervisorLogFile {
+			cores = append(cores, entry)
+		}
+	}
+
+	sort.Slice(cores, func(i, j int) bool {
+		return cores[i].ModTime().After(cores[j].ModTime())
+	})
+
+	return cores, nil
+}
+
+// prune removes the oldest core dumps of the specified pod, and the
+// diagnostics of the other pods whose last core dump is older than the
+// maximum age.
+func (c coreDump) prune(podID string) error {
+	dir := c.podDir(podID)
+
+	cores, err := coreFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for i := c.maxCount(); i < len(cores); i++ {
+		if err := os.Remove(filepath.Join(dir, cores[i].Name())); err != nil {
+			return err
+		}
+	}
+
+	entries, err := ioutil.ReadDir(c.dir())
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == podID {
+			continue
+		}
+
+		// Only the diagnostics of crashed pods are kept after the
+		// pods are deleted.
+		cores, err := coreFiles(filepath.Join(c.dir(), entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		if len(cores) == 0 || time.Since(cores[0].ModTime()) <= c.maxAge() {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(c.dir(), entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove deletes the diagnostics directory of the specified pod if no
+// core dump was collected. Otherwise, it is kept until it gets too old.
+func (c coreDump) remove(podID string) error {
+	if !c.Enable {
+		return nil
+	}
+
+	cores, err := coreFiles(c.podDir(podID))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(cores) > 0 {
+		ccLog.Infof("Keeping %d core dumps of pod %v in %v", len(cores), podID, c.podDir(podID))
+		return nil
+	}
+
+	return os.RemoveAll(c.podDir(podID))
+}
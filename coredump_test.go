@@ -0,0 +1,229 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createCoreFile creates a fake core dump last modified at the
+// specified time.
+func createCoreFile(path string, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), testDirMode); err != nil {
+		return err
+	}
+
+	if err := createEmptyFile(path); err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, modTime, modTime)
+}
+
+func TestCoreDumpValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	c := coreDump{}
+	assert.NoError(c.validate())
+	assert.Equal(defaultDiagnosticsDir, c.dir())
+	assert.Equal(uint64(defaultCoreDumpMaxSize), c.maxSize())
+	assert.Equal(defaultCoreDumpMaxCount, c.maxCount())
+	assert.Equal(defaultCoreDumpMaxAge, c.maxAge())
+
+	c = coreDump{Dir: "/tmp/diags", MaxSize: 1024, MaxCount: 1, MaxAge: "1h"}
+	assert.NoError(c.validate())
+	assert.Equal("/tmp/diags", c.dir())
+	assert.Equal(uint64(1024), c.maxSize())
+	assert.Equal(1, c.maxCount())
+	assert.Equal(time.Hour, c.maxAge())
+
+	for _, invalid := range []coreDump{
+		{Dir: "diags"},
+		{MaxAge: "forever"},
+		{MaxAge: "-1h"},
+	} {
+		assert.Error(invalid.validate(), "%+v", invalid)
+	}
+
+	r := runtime{
+		Rlimits:  map[string]int64{"core": 0},
+		CoreDump: coreDump{Enable: true},
+	}
+	assert.Error(r.validate())
+
+	r.CoreDump.Enable = false
+	assert.NoError(r.validate())
+}
+
+func TestCoreDumpEnter(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "coredump-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedSetProcessRlimit := setProcessRlimit
+	savedCorePatternFile := corePatternFile
+	defer func() {
+		setProcessRlimit = savedSetProcessRlimit
+		corePatternFile = savedCorePatternFile
+	}()
+
+	limits := map[string]uint64{}
+	setProcessRlimit = func(name string, limit uint64) error {
+		limits[name] = limit
+		return nil
+	}
+
+	corePatternFile = filepath.Join(dir, "core_pattern")
+	err = createFile(corePatternFile, "core\n")
+	assert.NoError(err)
+
+	cwd, err := os.Getwd()
+	assert.NoError(err)
+
+	// disabled
+	c := coreDump{Dir: filepath.Join(dir, "diags"), MaxSize: 4096}
+
+	restore, err := c.enter(testPodID)
+	assert.NoError(err)
+	restore()
+
+	assert.Empty(limits)
+	assert.False(fileExists(c.podDir(testPodID)))
+
+	c.Enable = true
+
+	restore, err = c.enter(testPodID)
+	assert.NoError(err)
+
+	wd, err := os.Getwd()
+	assert.NoError(err)
+	assert.Equal(c.podDir(testPodID), wd)
+	assert.Equal(map[string]uint64{"core": 4096}, limits)
+
+	restore()
+
+	wd, err = os.Getwd()
+	assert.NoError(err)
+	assert.Equal(cwd, wd)
+}
+
+func TestCoreDumpPrune(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "coredump-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	c := coreDump{Enable: true, Dir: dir, MaxCount: 2, MaxAge: "1h"}
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	podDir := c.podDir(testPodID)
+	for i, name := range []string{"core.1", "core.2", "core.3"} {
+		err = createCoreFile(filepath.Join(podDir, name), now.Add(time.Duration(i)*time.Minute))
+		assert.NoError(err)
+	}
+
+	// not a core dump
+	err = createCoreFile(filepath.Join(podDir, "notes"), old)
+	assert.NoError(err)
+
+	err = createCoreFile(filepath.Join(c.podDir("crashed-long-ago"), "core"), old)
+	assert.NoError(err)
+
+	err = createCoreFile(filepath.Join(c.podDir("crashed-recently"), "core"), now)
+	assert.NoError(err)
+
+	err = os.MkdirAll(c.podDir("never-crashed"), testDirMode)
+	assert.NoError(err)
+	err = os.Chtimes(c.podDir("never-crashed"), old, old)
+	assert.NoError(err)
+
+	err = c.prune(testPodID)
+	assert.NoError(err)
+
+	// the oldest core dump is removed
+	assert.False(fileExists(filepath.Join(podDir, "core.1")))
+	assert.True(fileExists(filepath.Join(podDir, "core.2")))
+	assert.True(fileExists(filepath.Join(podDir, "core.3")))
+	assert.True(fileExists(filepath.Join(podDir, "notes")))
+
+	assert.False(fileExists(c.podDir("crashed-long-ago")))
+	assert.True(fileExists(c.podDir("crashed-recently")))
+	assert.True(fileExists(c.podDir("never-crashed")))
+}
+
+func TestCoreDumpRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "coredump-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	c := coreDump{Dir: dir}
+
+	err = os.MkdirAll(c.podDir(testPodID), testDirMode)
+	assert.NoError(err)
+
+	// disabled
+	err = c.remove(testPodID)
+	assert.NoError(err)
+	assert.True(fileExists(c.podDir(testPodID)))
+
+	c.Enable = true
+
+	// no core dump
+	err = c.remove(testPodID)
+	assert.NoError(err)
+	assert.False(fileExists(c.podDir(testPodID)))
+
+	// no diagnostics directory
+	err = c.remove(testPodID)
+	assert.NoError(err)
+
+	err = createCoreFile(filepath.Join(c.podDir(testPodID), "core"), time.Now())
+	assert.NoError(err)
+
+	err = c.remove(testPodID)
+	assert.NoError(err)
+	assert.True(fileExists(c.podDir(testPodID)))
+}
+
+func TestCoreDumpRemoveGuestConsole(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "coredump-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	c := coreDump{Enable: true, Dir: dir}
+
+	// the guest console was dumped when the VM died
+	err = createCoreFile(filepath.Join(c.podDir(testPodID), guestConsoleFile), time.Now())
+	assert.NoError(err)
+
+	err = c.remove(testPodID)
+	assert.NoError(err)
+	assert.True(fileExists(filepath.Join(c.podDir(testPodID), guestConsoleFile)))
+}
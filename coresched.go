@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// coreSchedAnnotation is the OCI annotation enabling or disabling the
+// core scheduling of a pod, overriding the configuration.
+const coreSchedAnnotation = ccAnnotationPrefix + "core_scheduling"
+
+// setCoreSchedCookie gives a process its own core scheduling cookie. It
+// is a variable rather than a function to allow tests to modify it.
+var setCoreSchedCookie = createCoreSchedCookie
+
+// podCoreScheduling returns true if the vCPUs of the pod must not share
+// a core with other processes.
+func podCoreScheduling(ociSpec oci.CompatOCISpec) (bool, error) {
+	value, ok := ociSpec.Annotations[coreSchedAnnotation]
+	if !ok {
+		return runtimeOptions.CoreScheduling, nil
+	}
+
+	enable, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid core scheduling setting %q: %v", value, err)
+	}
+
+	return enable, nil
+}
+
+// applyCoreScheduling gives the hypervisor running the VM of the pod
+// its own core scheduling cookie if requested, so that the sibling
+// hyperthreads of its vCPUs never run the code of other pods or of the
+// host. The threads the hypervisor creates later, such as hotplugged
+// vCPUs, inherit the cookie. If the host kernel does not support core
+// scheduling (Linux 5.14) or SMT is not available, the pod runs without
+// it with a warning, or is refused in strict mode.
+func applyCoreScheduling(ociSpec oci.CompatOCISpec, vmID string, strict bool) error {
+	enable, err := podCoreScheduling(ociSpec)
+	if err != nil || !enable {
+		return err
+	}
+
+	pid, err := findHypervisorPID(vmID)
+	if err != nil {
+		return err
+	}
+
+	var message string
+
+	if pid == 0 {
+		message = "Core scheduling not applied: hypervisor process not found"
+	} else if err := setCoreSchedCookie(pid); err != nil {
+		message = fmt.Sprintf("Core scheduling not applied: %v", err)
+	} else {
+		ccLog.WithField("pod", vmID).Infof("Core scheduling cookie given to hypervisor process %d", pid)
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("Strict mode refuses settings which cannot be enforced: %s (%s)", message, warningCoreSchedUnavailable)
+	}
+
+	warn(warningCoreSchedUnavailable, "%s", message)
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodCoreScheduling(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	spec := oci.CompatOCISpec{}
+
+	runtimeOptions.CoreScheduling = false
+
+	enable, err := podCoreScheduling(spec)
+	assert.NoError(err)
+	assert.False(enable)
+
+	runtimeOptions.CoreScheduling = true
+
+	enable, err = podCoreScheduling(spec)
+	assert.NoError(err)
+	assert.True(enable)
+
+	spec.Annotations = map[string]string{coreSchedAnnotation: "false"}
+
+	enable, err = podCoreScheduling(spec)
+	assert.NoError(err)
+	assert.False(enable)
+
+	spec.Annotations[coreSchedAnnotation] = "sometimes"
+
+	_, err = podCoreScheduling(spec)
+	assert.Error(err)
+}
+
+func TestApplyCoreScheduling(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, cleanup := setupCPUSetTest(t)
+	defer cleanup()
+
+	savedSetCoreSchedCookie := setCoreSchedCookie
+	defer func() {
+		setCoreSchedCookie = savedSetCoreSchedCookie
+	}()
+
+	var cookies []int
+	var cookieErr error
+
+	setCoreSchedCookie = func(pid int) error {
+		if cookieErr != nil {
+			return cookieErr
+		}
+
+		cookies = append(cookies, pid)
+		return nil
+	}
+
+	assert.NoError(os.MkdirAll(procDir, testDirMode))
+
+	spec := oci.CompatOCISpec{}
+	spec.Annotations = map[string]string{coreSchedAnnotation: "true"}
+
+	// no hypervisor
+	warnings = nil
+
+	assert.NoError(applyCoreScheduling(spec, testPodID, false))
+	assert.Equal([]string{warningCoreSchedUnavailable}, warningCodes(warnings))
+	assert.Error(applyCoreScheduling(spec, testPodID, true))
+
+	makeTestProcess(t, procDir, 10, []int{10, 11}, "qemu\x00-name\x00pod-"+testPodID+"\x00")
+
+	warnings = nil
+
+	assert.NoError(applyCoreScheduling(spec, testPodID, true))
+	assert.Equal([]int{10}, cookies)
+	assert.Empty(warnings)
+
+	// not enabled
+	cookies = nil
+	spec.Annotations[coreSchedAnnotation] = "false"
+
+	assert.NoError(applyCoreScheduling(spec, testPodID, true))
+	assert.Empty(cookies)
+
+	// not supported by the host
+	cookieErr = syscall.EINVAL
+	spec.Annotations[coreSchedAnnotation] = "true"
+
+	assert.NoError(applyCoreScheduling(spec, testPodID, false))
+	assert.Equal([]string{warningCoreSchedUnavailable}, warningCodes(warnings))
+	assert.Error(applyCoreScheduling(spec, testPodID, true))
+}
@@ -0,0 +1,407 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+// defaultCopyMaxSize is the default limit of the amount of file data
+// the cp command copies (1GiB).
+const defaultCopyMaxSize = 1 << 30
+
+// maxSymlinks is the maximum number of symbolic links followed when
+// resolving a path inside a container, as on Linux.
+const maxSymlinks = 40
+
+// containerFile is a file of a container, as seen from the host.
+type containerFile struct {
+	// path is the absolute path of the file inside the container, with
+	// the symbolic links resolved.
+	path string
+
+	// hostPath is the path of the file on the host.
+	hostPath string
+}
+
+// parseCopyPath splits a cp argument of the form "<container-id>:<path>".
+// Arguments without a container ID, or with a slash before the colon, are
+// host paths and are returned with an empty container ID.
+func parseCopyPath(arg string) (containerID, p string) {
+	i := strings.Index(arg, ":")
+	if i <= 0 || strings.Contains(arg[:i], "/") {
+		return "", arg
+	}
+
+	return arg[:i], arg[i+1:]
+}
+
+// resolveInRoot resolves p as if root was the root directory: symbolic
+// links, absolute or relative, cannot lead outside of root. The last
+// component does not have to exist. It returns the resolved path,
+// relative to root.
+func resolveInRoot(root, p string) (string, error) {
+	resolved := "/"
+	links := 0
+
+	remaining := p
+	for remaining != "" {
+		var name string
+
+		if i := strings.Index(remaining, "/"); i >= 0 {
+			name, remaining = remaining[:i], remaining[i+1:]
+		} else {
+			name, remaining = remaining, ""
+		}
+
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, name)
+
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if os.IsNotExist(err) {
+			resolved = next
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("Too many levels of symbolic links in %v", p)
+		}
+
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+
+		remaining = target + "/" + remaining
+	}
+
+	return resolved, nil
+}
+
+// resolveContainerPath returns the host path of the container path p. Paths
+// below the destination of a bind mount are resolved in the source of the
+// mount, other paths in the root filesystem of the container. Relative
+// paths are relative to the working directory of the container process.
+func resolveContainerPath(status vc.ContainerStatus, ociSpec oci.CompatOCISpec, p string) (containerFile, error) {
+	if !path.IsAbs(p) {
+		cwd := "/"
+		if ociSpec.Process != nil && ociSpec.Process.Cwd != "" {
+			cwd = ociSpec.Process.Cwd
+		}
+
+		p = path.Join(cwd, p)
+	}
+
+	p = path.Clean(p)
+
+	root := status.RootFs
+	dest := "/"
+
+	for _, m := range ociSpec.Mounts {
+		if !isBindMount(m) || len(m.Destination) <= len(dest) {
+			continue
+		}
+
+		if p == m.Destination || strings.HasPrefix(p, m.Destination+"/") {
+			root = m.Source
+			dest = m.Destination
+		}
+	}
+
+	resolved, err := resolveInRoot(root, strings.TrimPrefix(p, dest))
+	if err != nil {
+		return containerFile{}, err
+	}
+
+	return containerFile{
+		path:     path.Join(dest, resolved),
+		hostPath: filepath.Join(root, resolved),
+	}, nil
+}
+
+// treeSize returns the amount of file data below p.
+func treeSize(p string) (uint64, error) {
+	var size uint64
+
+	err := filepath.Walk(p, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// copyFile copies the regular file src to dst, without following a
+// symbolic link at dst. At most limit bytes are copied.
+func copyFile(src, dst string, mode os.FileMode, limit uint64) error {
+	in, err := os.OpenFile(src, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(out, io.LimitReader(in, int64(limit)+1))
+	if err == nil && uint64(n) > limit {
+		err = fmt.Errorf("%v grew beyond the copy size limit", src)
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// copyTree copies the file or directory src to dst. Symbolic links are
+// copied, not followed. resolve maps each destination path before it is
+// written, so that the files of a container are always written inside of
+// the container.
+func copyTree(src, dst string, limit uint64, resolve func(string) (string, error)) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		target, err := resolve(filepath.Join(dst, rel))
+		if err != nil {
+			return err
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.Mkdir(target, mode.Perm()); err != nil && !os.IsExist(err) {
+				return err
+			}
+		case mode.IsRegular():
+			size := uint64(info.Size())
+			if size > limit {
+				return fmt.Errorf("%v grew beyond the copy size limit", p)
+			}
+
+			if err := copyFile(p, target, mode, limit); err != nil {
+				return err
+			}
+
+			limit -= size
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+
+			os.Remove(target)
+
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		default:
+			ccLog.Warnf("Not copying %v: not a regular file, directory or symbolic link", p)
+		}
+
+		return nil
+	})
+}
+
+// copyLimit returns the maximum amount of file data that may be copied:
+// the smallest of the requested and policy limits, 0 meaning no limit.
+func copyLimit(requested uint64, p *policy) uint64 {
+	limit := requested
+
+	if p != nil && p.Copy.MaxSize > 0 && (limit == 0 || p.Copy.MaxSize < limit) {
+		limit = p.Copy.MaxSize
+	}
+
+	if limit == 0 {
+		limit = math.MaxInt64 - 1
+	}
+
+	return limit
+}
+
+// copyContainerFiles copies files between the host and a container. The
+// files are copied through the root filesystem and volumes of the
+// container on the host, which the guest shares, rather than by the
+// agent.
+func copyContainerFiles(src, dst string, maxSize uint64) error {
+	srcID, srcPath := parseCopyPath(src)
+	dstID, dstPath := parseCopyPath(dst)
+
+	if (srcID == "") == (dstID == "") {
+		return errors.New("Expecting exactly one of the source and destination to be a container path: <container-id>:<path>")
+	}
+
+	containerID, containerPath := srcID, srcPath
+	if dstID != "" {
+		containerID, containerPath = dstID, dstPath
+	}
+
+	if containerPath == "" {
+		return fmt.Errorf("Missing path in container %v", containerID)
+	}
+
+	status, _, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+
+	if status.State.State == vc.StateStopped {
+		return fmt.Errorf("Container %v is stopped", containerID)
+	}
+
+	ociSpec, err := oci.ParseConfigJSON(status.Annotations[oci.BundlePathKey])
+	if err != nil {
+		return err
+	}
+
+	policy, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+
+	file, err := resolveContainerPath(status, ociSpec, containerPath)
+	if err != nil {
+		return err
+	}
+
+	if err := policy.checkCopy(file.path); err != nil {
+		return err
+	}
+
+	if err := checkSecretCopy(file.hostPath, runtimeOptions.secretVolumes()); err != nil {
+		return err
+	}
+
+	limit := copyLimit(maxSize, policy)
+
+	hostSrc, hostDst := srcPath, dstPath
+	resolve := func(p string) (string, error) { return p, nil }
+
+	if srcID != "" {
+		hostSrc = file.hostPath
+	} else {
+		hostDst = file.hostPath
+
+		// Only the top of the destination was checked: resolve
+		// every path written, as the container may contain
+		// symbolic links.
+		resolve = func(p string) (string, error) {
+			f, err := resolveContainerPath(status, ociSpec, path.Join(file.path, strings.TrimPrefix(p, file.hostPath)))
+			return f.hostPath, err
+		}
+	}
+
+	if _, err := os.Lstat(hostSrc); err != nil {
+		return err
+	}
+
+	// Like cp, copy into existing directories.
+	if fi, err := os.Stat(hostDst); err == nil && fi.IsDir() {
+		hostDst = filepath.Join(hostDst, filepath.Base(hostSrc))
+	}
+
+	size, err := treeSize(hostSrc)
+	if err != nil {
+		return err
+	}
+
+	if size > limit {
+		return fmt.Errorf("Copying %d bytes exceeds the copy size limit of %d bytes", size, limit)
+	}
+
+	ccLog.WithField("container", containerID).Infof("Copying %v to %v (%d bytes)", src, dst, size)
+
+	return copyTree(hostSrc, hostDst, limit, resolve)
+}
+
+var copyCLICommand = cli.Command{
+	Name:  "cp",
+	Usage: "copy files between the host and a container",
+	ArgsUsage: `<source> <destination>
+
+   Exactly one of <source> and <destination> is a container path of the
+   form <container-id>:<path>, the other a host path.`,
+	Description: `The cp command copies a file or directory between the host and a
+   container, like "docker cp" and "kubectl cp" without running tar in the
+   container.
+
+   The files are copied through the root filesystem and volumes of the
+   container, which the host shares with the guest. Symbolic links of the
+   container are resolved inside the container, and copied, not
+   followed. The policy may deny copies, restrict the container paths and
+   limit the amount of data copied.`,
+	Flags: []cli.Flag{
+		cli.Uint64Flag{
+			Name:  "max-size",
+			Value: defaultCopyMaxSize,
+			Usage: "maximum amount of file data to copy, in bytes (0: no limit)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		args := context.Args()
+		if len(args) != 2 {
+			return fmt.Errorf("Expecting a source and a destination, got %d arguments: %v", len(args), []string(args))
+		}
+
+		return copyContainerFiles(args.Get(0), args.Get(1), context.Uint64("max-size"))
+	},
+}
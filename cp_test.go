@@ -0,0 +1,208 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCopyPath(t *testing.T) {
+	assert := assert.New(t)
+
+	for arg, expected := range map[string][2]string{
+		"foo:/etc/hosts": {"foo", "/etc/hosts"},
+		"foo:data":       {"foo", "data"},
+		"/tmp/foo:bar":   {"", "/tmp/foo:bar"},
+		"./foo:bar":      {"", "./foo:bar"},
+		":bar":           {"", ":bar"},
+		"bar":            {"", "bar"},
+	} {
+		containerID, p := parseCopyPath(arg)
+		assert.Equal(expected[0], containerID, arg)
+		assert.Equal(expected[1], p, arg)
+	}
+}
+
+func TestResolveInRoot(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := ioutil.TempDir(testDir, "root-")
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	assert.NoError(os.MkdirAll(filepath.Join(root, "etc"), testDirMode))
+	assert.NoError(os.MkdirAll(filepath.Join(root, "var/data"), testDirMode))
+	assert.NoError(os.Symlink("/etc", filepath.Join(root, "abs")))
+	assert.NoError(os.Symlink("../../etc", filepath.Join(root, "var/rel")))
+	assert.NoError(os.Symlink("../../../../../../etc", filepath.Join(root, "var/escape")))
+	assert.NoError(os.Symlink("loop", filepath.Join(root, "loop")))
+
+	for p, expected := range map[string]string{
+		"/":                   "/",
+		"/etc/passwd":         "/etc/passwd",
+		"/abs/passwd":         "/etc/passwd",
+		"/var/rel/passwd":     "/etc/passwd",
+		"/var/escape/passwd":  "/etc/passwd",
+		"/../../etc/passwd":   "/etc/passwd",
+		"/var/data/../../etc": "/etc",
+		"/missing/file":       "/missing/file",
+	} {
+		resolved, err := resolveInRoot(root, p)
+		assert.NoError(err, p)
+		assert.Equal(expected, resolved, p)
+	}
+
+	_, err = resolveInRoot(root, "/loop/file")
+	assert.Error(err)
+}
+
+func TestResolveContainerPath(t *testing.T) {
+	assert := assert.New(t)
+
+	status := vc.ContainerStatus{RootFs: "/rootfs"}
+	spec := oci.CompatOCISpec{}
+	spec.Process = &oci.CompatOCIProcess{}
+	spec.Process.Cwd = "/work"
+	spec.Mounts = []specs.Mount{
+		{Destination: "/data", Type: "bind", Source: "/srv/data"},
+		{Destination: "/data/logs", Type: "bind", Source: "/srv/logs"},
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+	}
+
+	for p, expected := range map[string]containerFile{
+		"/etc/hosts":         {"/etc/hosts", "/rootfs/etc/hosts"},
+		"file":               {"/work/file", "/rootfs/work/file"},
+		"/data/file":         {"/data/file", "/srv/data/file"},
+		"/data/logs/app.log": {"/data/logs/app.log", "/srv/logs/app.log"},
+		"/data/../etc":       {"/etc", "/rootfs/etc"},
+		"/database":          {"/database", "/rootfs/database"},
+		"/proc/cpuinfo":      {"/proc/cpuinfo", "/rootfs/proc/cpuinfo"},
+	} {
+		file, err := resolveContainerPath(status, spec, p)
+		assert.NoError(err, p)
+		assert.Equal(expected, file, p)
+	}
+}
+
+func TestCopyLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(uint64(100), copyLimit(100, nil))
+	assert.Equal(uint64(math.MaxInt64-1), copyLimit(0, nil))
+
+	p := &policy{}
+	assert.Equal(uint64(100), copyLimit(100, p))
+
+	p.Copy.MaxSize = 10
+	assert.Equal(uint64(10), copyLimit(100, p))
+	assert.Equal(uint64(10), copyLimit(0, p))
+	assert.Equal(uint64(5), copyLimit(5, p))
+}
+
+func TestCopyContainerFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+	assert.NoError(makeOCIBundle(bundlePath))
+
+	rootfs := filepath.Join(tmpdir, "rootfs")
+	assert.NoError(os.MkdirAll(filepath.Join(rootfs, "tmp"), testDirMode))
+	assert.NoError(os.MkdirAll(filepath.Join(rootfs, "etc"), testDirMode))
+	assert.NoError(os.Symlink("/etc", filepath.Join(rootfs, "tmp/etc")))
+
+	host := filepath.Join(tmpdir, "host")
+	assert.NoError(os.MkdirAll(filepath.Join(host, "dir/sub"), testDirMode))
+	assert.NoError(createFile(filepath.Join(host, "dir/file"), "hello"))
+	assert.NoError(createFile(filepath.Join(host, "dir/sub/other"), "world"))
+	assert.NoError(os.Symlink("file", filepath.Join(host, "dir/link")))
+
+	list := newSingleContainerPodStatusList(testPodID, testContainerID, vc.State{State: vc.StateRunning}, vc.State{State: vc.StateRunning}, map[string]string{
+		oci.ContainerTypeKey: string(vc.PodSandbox),
+		oci.BundlePathKey:    bundlePath,
+	})
+	list[0].ContainersStatus[0].RootFs = rootfs
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return list, nil
+	}
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	containerPath := func(p string) string {
+		return testContainerID + ":" + p
+	}
+
+	// copy a directory into the container
+	assert.NoError(copyContainerFiles(filepath.Join(host, "dir"), containerPath("/tmp"), 0))
+
+	data, err := ioutil.ReadFile(filepath.Join(rootfs, "tmp/dir/sub/other"))
+	assert.NoError(err)
+	assert.Equal("world", string(data))
+
+	link, err := os.Readlink(filepath.Join(rootfs, "tmp/dir/link"))
+	assert.NoError(err)
+	assert.Equal("file", link)
+
+	// a symbolic link of the container cannot lead out of it
+	assert.NoError(copyContainerFiles(filepath.Join(host, "dir/file"), containerPath("/tmp/etc/copied"), 0))
+	assert.True(fileExists(filepath.Join(rootfs, "etc/copied")))
+
+	// copy a file out of the container
+	out := filepath.Join(tmpdir, "out")
+	assert.NoError(copyContainerFiles(containerPath("/tmp/dir/file"), out, 0))
+
+	data, err = ioutil.ReadFile(out)
+	assert.NoError(err)
+	assert.Equal("hello", string(data))
+
+	// size limit
+	assert.Error(copyContainerFiles(filepath.Join(host, "dir"), containerPath("/tmp/limited"), 6))
+	assert.False(fileExists(filepath.Join(rootfs, "tmp/limited")))
+
+	// invalid arguments
+	assert.Error(copyContainerFiles(filepath.Join(host, "dir"), out, 0))
+	assert.Error(copyContainerFiles(containerPath("/tmp"), containerPath("/etc"), 0))
+	assert.Error(copyContainerFiles(filepath.Join(host, "dir"), containerPath(""), 0))
+	assert.Error(copyContainerFiles(filepath.Join(host, "missing"), containerPath("/tmp"), 0))
+
+	// stopped container
+	list[0].ContainersStatus[0].State.State = vc.StateStopped
+	assert.Error(copyContainerFiles(filepath.Join(host, "dir/file"), containerPath("/tmp"), 0))
+}
+
+func TestCopyCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	set := flag.NewFlagSet("", 0)
+	execCLICommandFunc(assert, copyCLICommand, set, true)
+
+	set.Parse([]string{"only-one-argument"})
+	execCLICommandFunc(assert, copyCLICommand, set, true)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// maxHostCPUs is the number of host CPUs a CPU set may refer to.
+const maxHostCPUs = 1024
+
+// variables rather than functions to allow tests to modify them
+var (
+	setTaskAffinity = setAffinity
+	procDir         = "/proc"
+)
+
+// parseCPUSet parses a list of host CPUs in the format of the cpuset
+// cgroup, like "0-3,8".
+func parseCPUSet(value string) ([]int, error) {
+	seen := make(map[int]bool)
+
+	for _, item := range strings.Split(value, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(item), "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CPU set %q", value)
+		}
+
+		last := first
+
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("Invalid CPU set %q", value)
+			}
+		}
+
+		if first < 0 || last < first || last >= maxHostCPUs {
+			return nil, fmt.Errorf("Invalid CPU range %q in CPU set %q", item, value)
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			seen[cpu] = true
+		}
+	}
+
+	var cpus []int
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+
+	sort.Ints(cpus)
+
+	return cpus, nil
+}
+
+// setProcessAffinity restricts all the threads of a process to the
+// specified CPUs.
+func setProcessAffinity(pid int, cpus []int) error {
+	tasks, err := ioutil.ReadDir(filepath.Join(procDir, strconv.Itoa(pid), "task"))
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+
+		// The thread may have exited since the directory was read.
+		if err := setTaskAffinity(tid, cpus); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("Unable to set the CPU affinity of thread %d of process %d: %v", tid, pid, err)
+		}
+	}
+
+	return nil
+}
+
+// applyHostCPUSet restricts the runtime to the host CPU set of the
+// configuration file. The hypervisor and the shims inherit the CPU
+// affinity of the runtime when they are launched, like its resource
+// limits.
+func applyHostCPUSet(cpuset string) error {
+	if cpuset == "" {
+		return nil
+	}
+
+	// checked by runtime.validate()
+	cpus, _ := parseCPUSet(cpuset)
+
+	if err := setProcessAffinity(os.Getpid(), cpus); err != nil {
+		return err
+	}
+
+	ccLog.Debugf("Restricted to host CPUs %v", cpuset)
+
+	return nil
+}
+
+// findHypervisorPID returns the PID of the hypervisor running the VM of
+// the specified pod, which virtcontainers names "pod-<pod-id>", or 0 if
+// it is not running.
+func findHypervisorPID(vmID string) (int, error) {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return 0, err
+	}
+
+	name := []byte("\x00-name\x00pod-" + vmID + "\x00")
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join(procDir, entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+
+		if bytes.Contains(cmdline, name) {
+			return pid, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// reapplyHostCPUSet restricts the running hypervisor and shims of a pod
+// to the host CPU set of the configuration file, or to the CPUs of the
+// partition of the pod, which may have changed since they were launched.
+func reapplyHostCPUSet(podID string) error {
+	state, err := loadPodState(podID)
+	if err != nil {
+		return err
+	}
+
+	cpuset := runtimeOptions.HostCPUSet
+	if state.PartitionCPUs != "" {
+		cpuset = state.PartitionCPUs
+	}
+
+	if cpuset == "" {
+		return nil
+	}
+
+	// checked by runtime.validate() or when the pod was created
+	cpus, err := parseCPUSet(cpuset)
+	if err != nil {
+		return err
+	}
+
+	vmID, err := podVMID(podID)
+	if err != nil {
+		return err
+	}
+
+	status, err := vci.StatusPod(vmID)
+	if err != nil {
+		return err
+	}
+
+	var pids []int
+
+	for _, c := range status.ContainersStatus {
+		if c.PID > 0 {
+			pids = append(pids, c.PID)
+		}
+	}
+
+	hypervisor, err := findHypervisorPID(vmID)
+	if err != nil {
+		return err
+	}
+
+	if hypervisor > 0 {
+		pids = append(pids, hypervisor)
+	}
+
+	for _, pid := range pids {
+		if err := setProcessAffinity(pid, cpus); err != nil {
+			return err
+		}
+	}
+
+	ccLog.WithField("pod", podID).Infof("Restricted %d processes to host CPUs %v", len(pids), cpuset)
+
+	return nil
+}
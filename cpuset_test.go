@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUSet(t *testing.T) {
+	assert := assert.New(t)
+
+	for value, expected := range map[string][]int{
+		"0":         {0},
+		"0-3,8":     {0, 1, 2, 3, 8},
+		"8, 0-1, 1": {0, 1, 8},
+		"1023":      {1023},
+		"2-2,5-6,4": {2, 4, 5, 6},
+	} {
+		cpus, err := parseCPUSet(value)
+		assert.NoError(err, value)
+		assert.Equal(expected, cpus, value)
+	}
+
+	for _, invalid := range []string{"", "a", "3-1", "-1", "1-", "0,,1", "1024", "0-1024"} {
+		_, err := parseCPUSet(invalid)
+		assert.Error(err, invalid)
+	}
+
+	assert.NoError(runtime{HostCPUSet: "0-3"}.validate())
+	assert.Error(runtime{HostCPUSet: "0-a"}.validate())
+}
+
+// makeTestProcess adds a process with the specified threads and command
+// line to a fake /proc directory.
+func makeTestProcess(t *testing.T, dir string, pid int, tids []int, cmdline string) {
+	for _, tid := range tids {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, strconv.Itoa(pid), "task", strconv.Itoa(tid)), testDirMode))
+	}
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(pid), "cmdline"), []byte(cmdline), testFileMode))
+}
+
+func setupCPUSetTest(t *testing.T) (string, map[int][]int, func()) {
+	dir, err := ioutil.TempDir(testDir, "cpuset-")
+	assert.NoError(t, err)
+
+	savedProcDir := procDir
+	savedSetTaskAffinity := setTaskAffinity
+	savedRuntimeOptions := runtimeOptions
+
+	procDir = filepath.Join(dir, "proc")
+
+	affinity := make(map[int][]int)
+	setTaskAffinity = func(tid int, cpus []int) error {
+		if tid == 999 {
+			return syscall.ESRCH
+		}
+
+		affinity[tid] = cpus
+		return nil
+	}
+
+	return dir, affinity, func() {
+		procDir = savedProcDir
+		setTaskAffinity = savedSetTaskAffinity
+		runtimeOptions = savedRuntimeOptions
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSetProcessAffinity(t *testing.T) {
+	assert := assert.New(t)
+
+	_, affinity, cleanup := setupCPUSetTest(t)
+	defer cleanup()
+
+	makeTestProcess(t, procDir, 10, []int{10, 11, 999}, "")
+
+	assert.NoError(setProcessAffinity(10, []int{0, 1}))
+	assert.Equal(map[int][]int{10: {0, 1}, 11: {0, 1}}, affinity)
+
+	assert.Error(setProcessAffinity(20, []int{0, 1}))
+
+	setTaskAffinity = func(tid int, cpus []int) error {
+		return syscall.EINVAL
+	}
+
+	assert.Error(setProcessAffinity(10, []int{0, 1}))
+}
+
+func TestApplyHostCPUSet(t *testing.T) {
+	assert := assert.New(t)
+
+	_, affinity, cleanup := setupCPUSetTest(t)
+	defer cleanup()
+
+	pid := os.Getpid()
+	makeTestProcess(t, procDir, pid, []int{pid}, "")
+
+	assert.NoError(applyHostCPUSet(""))
+	assert.Empty(affinity)
+
+	assert.NoError(applyHostCPUSet("2-3"))
+	assert.Equal(map[int][]int{pid: {2, 3}}, affinity)
+}
+
+func TestFindHypervisorPID(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, cleanup := setupCPUSetTest(t)
+	defer cleanup()
+
+	makeTestProcess(t, procDir, 10, []int{10}, "/usr/bin/qemu-lite-system-x86_64\x00-name\x00pod-foobar\x00-uuid\x00")
+	makeTestProcess(t, procDir, 20, []int{20}, "/usr/bin/qemu-lite-system-x86_64\x00-name\x00pod-foo\x00-uuid\x00")
+	assert.NoError(os.MkdirAll(filepath.Join(procDir, "self"), testDirMode))
+
+	pid, err := findHypervisorPID("foo")
+	assert.NoError(err)
+	assert.Equal(20, pid)
+
+	pid, err = findHypervisorPID("bar")
+	assert.NoError(err)
+	assert.Equal(0, pid)
+}
+
+func TestReapplyHostCPUSet(t *testing.T) {
+	assert := assert.New(t)
+
+	_, affinity, cleanup := setupCPUSetTest(t)
+	defer cleanup()
+	defer setupIdlePauseTest(t, time.Now())()
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{
+			ID: podID,
+			ContainersStatus: []vc.ContainerStatus{
+				{ID: podID, PID: 30},
+				{ID: "stopped"},
+			},
+		}, nil
+	}
+	defer func() {
+		testingImpl.StatusPodFunc = nil
+	}()
+
+	makeTestProcess(t, procDir, 10, []int{10, 11}, "qemu\x00-name\x00pod-"+testPodID+"\x00")
+	makeTestProcess(t, procDir, 30, []int{30}, "cc-shim")
+
+	// no host CPU set
+	assert.NoError(reapplyHostCPUSet(testPodID))
+	assert.Empty(affinity)
+
+	runtimeOptions.HostCPUSet = "4"
+
+	assert.NoError(reapplyHostCPUSet(testPodID))
+	assert.Equal(map[int][]int{10: {4}, 11: {4}, 30: {4}}, affinity)
+
+	// the CPUs of the partition of the pod override the host CPU set
+	assert.NoError(setPodPartition(testPodID, "realtime", "6-7"))
+
+	assert.NoError(reapplyHostCPUSet(testPodID))
+	assert.Equal(map[int][]int{10: {6, 7}, 11: {6, 7}, 30: {6, 7}}, affinity)
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{}, errors.New("no such pod")
+	}
+
+	assert.Error(reapplyHostCPUSet(testPodID))
+}
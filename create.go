@@ -16,10 +16,12 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
@@ -62,6 +64,14 @@ var createCLICommand = cli.Command{
 			Value: "",
 			Usage: "specify the file to write the process id to",
 		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "set a label on the pod, as <key>=<value> (may be repeated)",
+		},
+		cli.StringFlag{
+			Name:  "progress",
+			Usage: `report the progress as JSON lines to "stderr" or to the unix socket at the specified path`,
+		},
 	},
 	Action: func(context *cli.Context) error {
 		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
@@ -74,22 +84,42 @@ var createCLICommand = cli.Command{
 			return err
 		}
 
-		return create(context.Args().First(),
-			context.String("bundle"),
-			console,
-			context.String("pid-file"),
-			true,
-			runtimeConfig,
-		)
+		containerID := context.Args().First()
+
+		ctx, cancel := commandContext(runtimeOptions.Timeouts.create())
+		defer cancel()
+
+		return withProgress(context.String("progress"), containerID, func() error {
+			return create(ctx, containerID,
+				context.String("bundle"),
+				console,
+				context.String("pid-file"),
+				true,
+				context.StringSlice("label"),
+				runtimeConfig,
+			)
+		})
 	},
 }
 
 // Use a variable to allow tests to modify its value
 var getKernelParamsFunc = getKernelParams
 
-func create(containerID, bundlePath, console, pidFilePath string, detach bool,
-	runtimeConfig oci.RuntimeConfig) error {
-	var err error
+func create(ctx context.Context, containerID, bundlePath, console, pidFilePath string, detach bool,
+	labels []string, runtimeConfig oci.RuntimeConfig) (err error) {
+	warnings = nil
+
+	reportProgress(progressCreating)
+
+	// A create which did not complete must not make the retries fail
+	// because the ID is in use.
+	if err := validateID("container", containerID); err != nil {
+		return err
+	}
+
+	if err := cleanStaleCreate(ctx, containerID); err != nil {
+		return err
+	}
 
 	// Checks the MUST and MUST NOT from OCI runtime specification
 	if bundlePath, err = validCreateParams(containerID, bundlePath); err != nil {
@@ -106,37 +136,185 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 		return err
 	}
 
+	policy, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+
+	// The host paths shared with the container are opened before they
+	// are checked, so that they cannot be replaced once checked.
+	mountSources, err := openMountSources(ociSpec)
+	if err != nil {
+		return err
+	}
+	defer closeMountSources(mountSources)
+
+	if err := policy.checkCreate(ociSpec, mountSources); err != nil {
+		return err
+	}
+
+	if err := checkHostMounts(ociSpec, mountSources, containerID); err != nil {
+		return err
+	}
+
+	if err := checkSecretVolumes(ociSpec, runtimeOptions.secretVolumes()); err != nil {
+		return err
+	}
+
+	if err := checkUnenforcedSpec(ociSpec, runtimeOptions.Strict); err != nil {
+		return err
+	}
+
+	// Everything provisioned from now on is removed if the creation
+	// fails, so that a failed create leaves nothing behind.
+	var undo undoLog
+	defer func() {
+		if err != nil {
+			undo.rollback()
+		}
+	}()
+
+	if err := markCreating(containerID); err != nil {
+		return err
+	}
+
+	undo.add("creation marker", func() error {
+		return unmarkCreating(containerID)
+	})
+
+	undo.add("shared host paths", func() error {
+		return unpinMountSources(containerID)
+	})
+
+	ociSpec, err = pinMountSources(ociSpec, containerID, mountSources)
+	if err != nil {
+		return err
+	}
+
+	undo.add("toolbox mount", func() error {
+		return removeToolboxMount(containerID)
+	})
+
+	ociSpec, err = addToolboxMount(ociSpec, containerID, policy)
+	if err != nil {
+		return err
+	}
+
+	undo.add("root filesystem copy", func() error {
+		return runtimeOptions.NetworkFS.remove(containerID)
+	})
+
+	err = timePhase("copy root filesystem", func() (err error) {
+		ociSpec, err = runtimeOptions.NetworkFS.prepare(ociSpec, containerID, bundlePath)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
 	disableOutput := noNeedForOutput(detach, ociSpec.Process.Terminal)
 
+	restoreOutput, err := runtimeOptions.ContainerLogs.capture(ociSpec, containerID, console, disableOutput)
+	if err != nil {
+		return err
+	}
+	defer restoreOutput()
+
+	undo.add("container logs", func() error {
+		return runtimeOptions.ContainerLogs.remove(containerID)
+	})
+
 	var process vc.Process
 
 	switch containerType {
 	case vc.PodSandbox:
-		process, err = createPod(ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput)
+		if err := checkNotDraining(); err != nil {
+			return err
+		}
+
+		podLabels, err := newPodLabels(ociSpec, labels)
 		if err != nil {
 			return err
 		}
+
+		group, err := getSandboxGroup(ociSpec)
+		if err != nil {
+			return err
+		}
+
+		if group != "" {
+			process, err = createGroupedPod(ctx, &undo, ociSpec, runtimeConfig, group, containerID, bundlePath, console, disableOutput)
+		} else {
+			process, err = createPod(ctx, &undo, ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := setPodLabels(containerID, podLabels); err != nil {
+			return err
+		}
 	case vc.PodContainer:
-		process, err = createContainer(ociSpec, containerID, bundlePath, console, disableOutput)
+		if len(labels) > 0 {
+			return errors.New("Labels can only be set on pods")
+		}
+
+		if err := checkContainerOOM(ociSpec, runtimeOptions.Strict); err != nil {
+			return err
+		}
+
+		process, err = createContainer(ctx, &undo, ociSpec, containerID, bundlePath, console, disableOutput)
 		if err != nil {
 			return err
 		}
 	}
 
+	undo.add("shim record", func() error {
+		return removeContainerShim(containerID)
+	})
+
+	if err := recordShim(containerID, process, console, runtimeConfig); err != nil {
+		return err
+	}
+
 	// config.json provides a cgroups path that has to be used to create "tasks"
 	// and "cgroups.procs" files. Those files have to be filled with a PID, which
 	// is shim's in our case. This is mandatory to make sure there is no one
 	// else (like Docker) trying to create those files on our behalf. We want to
 	// know those files location so that we can remove them when delete is called.
-	cgroupsPathList, err := processCgroupsPath(ociSpec, containerType.IsPod())
+	cgroupsPathList, err := processCgroupsPath(ociSpec, containerID, containerType.IsPod())
 	if err != nil {
 		return err
 	}
 
+	undo.add("cgroups", func() error {
+		return removeCgroupsPath(cgroupsPathList)
+	})
+
 	if err := createCgroupsFiles(cgroupsPathList, process.Pid); err != nil {
 		return err
 	}
 
+	memoryCgroup, err := shimMemoryCgroup(ociSpec, containerID, containerType.IsPod())
+	if err != nil {
+		return err
+	}
+
+	undo.add("lifecycle", func() error {
+		return removeLifecycle(containerID)
+	})
+
+	if err := recordCreated(containerID, memoryCgroup); err != nil {
+		return err
+	}
+
+	if pidFilePath != "" {
+		undo.add("PID file", func() error {
+			return os.RemoveAll(pidFilePath)
+		})
+	}
+
 	// Creation of PID file has to be the last thing done in the create
 	// because containerd considers the create complete after this file
 	// is created.
@@ -144,6 +322,16 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 		return err
 	}
 
+	if err := unmarkCreating(containerID); err != nil {
+		ccLog.Warnf("Unable to remove creation marker of container %v: %v", containerID, err)
+	}
+
+	if err := writeWarnings(defaultErrorFile, warnings); err != nil {
+		ccLog.Warnf("Unable to display the warnings: %v", err)
+	}
+
+	reportProgress(progressCreated)
+
 	return nil
 }
 
@@ -172,26 +360,223 @@ func getKernelParams(containerID string) []vc.Param {
 	}
 }
 
-func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
+// createPod creates a pod, recording in undo how to remove everything it
+// provisions.
+func createPod(ctx context.Context, undo *undoLog, ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
 	containerID, bundlePath, console string, disableOutput bool) (vc.Process, error) {
+	if err := applyNamespaceProfile(ociSpec, &runtimeConfig); err != nil {
+		return vc.Process{}, err
+	}
+
+	kernel, err := applyKernelVariant(ociSpec, &runtimeConfig)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	if err := applyMitigationProfile(ociSpec, &runtimeConfig); err != nil {
+		return vc.Process{}, err
+	}
+
+	if err := applyStaticResources(ociSpec, &runtimeConfig); err != nil {
+		return vc.Process{}, err
+	}
+
+	partition, err := applyPartition(ociSpec, &runtimeConfig)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	if err := applyGuestOOM(ociSpec, &runtimeConfig); err != nil {
+		return vc.Process{}, err
+	}
+
+	ttl, err := getPodTTL(ociSpec)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
 	ccKernelParams := getKernelParamsFunc(containerID)
 
+	swapKernelParams, err := getGuestSwapKernelParams(ociSpec, runtimeConfig)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	ccKernelParams = append(ccKernelParams, swapKernelParams...)
+
 	for _, p := range ccKernelParams {
 		if err := (&runtimeConfig).AddKernelParam(p); err != nil {
 			return vc.Process{}, err
 		}
 	}
 
+	cacheSize, err := getSharedFSCacheSize(ociSpec, runtimeConfig)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	if cacheSize != 0 {
+		runtimeConfig.HypervisorConfig.KernelParams = setKernelParam(runtimeConfig.HypervisorConfig.KernelParams,
+			vc.Param{Key: sharedFSCacheSizeParam, Value: strconv.FormatUint(cacheSize, 10)})
+	}
+
 	podConfig, err := oci.PodConfig(ociSpec, runtimeConfig, bundlePath, containerID, console, disableOutput)
 	if err != nil {
 		return vc.Process{}, err
 	}
 
-	pod, err := vci.CreatePod(podConfig)
+	if path := podConfig.NetworkConfig.NetNSPath; path != "" {
+		undo.add("network namespace", func() error {
+			return removePodNetNS(containerID)
+		})
+
+		err = timePhase("join network namespace", func() (err error) {
+			podConfig.NetworkConfig.NetNSPath, err = runtimeOptions.NetNS.join(ctx, containerID, path)
+			return err
+		})
+		if err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	undo.add("pod state", func() error {
+		return removePodState(containerID)
+	})
+
+	if agentConfig, ok := podConfig.AgentConfig.(vc.HyperConfig); ok {
+		undo.add("agent sockets", func() error {
+			return removeAgentSockets(containerID)
+		})
+
+		if err := setAgentSockets(&agentConfig, containerID); err != nil {
+			return vc.Process{}, err
+		}
+
+		podConfig.AgentConfig = agentConfig
+	}
+
+	if err := handlePrivileged(ociSpec, &podConfig.Containers[0]); err != nil {
+		return vc.Process{}, err
+	}
+
+	if runtimeOptions.EnableKSM {
+		// Not fatal: the pod works without memory deduplication.
+		if err := enableKSM(); err != nil {
+			warn(warningKSMUnavailable, "Unable to enable KSM: %v", err)
+		}
+	}
+
+	if err := applyDiskQuota(ociSpec, containerID, bundlePath); err != nil {
+		return vc.Process{}, err
+	}
+
+	undo.add("diagnostics directory", func() error {
+		return runtimeOptions.CoreDump.remove(containerID)
+	})
+
+	restoreDir, err := runtimeOptions.CoreDump.enter(containerID)
+	if err != nil {
+		return vc.Process{}, err
+	}
+	defer restoreDir()
+
+	undo.add("guest console reader", func() error {
+		return stopConsoleRing(containerID)
+	})
+
+	// Not fatal: the pod works without it.
+	if err := runtimeOptions.GuestConsole.start(containerID); err != nil {
+		warn(warningGuestConsole, "Unable to keep the guest console output of pod %v: %v", containerID, err)
+	}
+
+	if err := checkUnenforcedParams(podConfig.HypervisorConfig, !runtimeOptions.DisableKernelCheck, runtimeOptions.Strict); err != nil {
+		return vc.Process{}, err
+	}
+
+	if !runtimeOptions.DisableKernelCheck {
+		err = timePhase("check kernel", func() error {
+			return checkKernel(podConfig.HypervisorConfig, runtimeOptions.Strict)
+		})
+		if err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	resources, err := podReservation(podConfig.VMConfig, podConfig.HypervisorConfig)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	undo.add("resource reservation", func() error {
+		return releaseResources(containerID)
+	})
+
+	if err := reserveResources(containerID, resources); err != nil {
+		return vc.Process{}, err
+	}
+
+	reportProgress(progressVMBooting)
+
+	var pod vc.VCPod
+
+	err = vcCall(ctx, "create pod "+containerID, func() (err error) {
+		pod, err = vci.CreatePod(podConfig)
+		return err
+	})
 	if err != nil {
+		// The hypervisor may have been launched by the abandoned call.
+		if isInterrupted(err) {
+			if killErr := killHypervisor(containerID); killErr != nil {
+				ccLog.Warnf("Unable to kill the hypervisor of pod %v: %v", containerID, killErr)
+			}
+
+			return vc.Process{}, err
+		}
+
+		return vc.Process{}, checkHypervisorFailure(containerID, err)
+	}
+
+	undo.add("VM", func() error {
+		return destroyPodVM(containerID)
+	})
+
+	if err := applyCoreScheduling(ociSpec, containerID, runtimeOptions.Strict); err != nil {
 		return vc.Process{}, err
 	}
 
+	reportProgress(progressAgentConnected)
+
+	if cacheSize != 0 {
+		if err := setPodSharedFSCacheSize(containerID, cacheSize); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	if runtimeOptions.staticResources() {
+		if err := setPodStaticResources(containerID); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	if ttl != 0 {
+		if err := setPodExpiry(containerID, ttl); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	if kernel != "" {
+		if err := setPodKernel(containerID, runtimeConfig.HypervisorConfig.KernelPath); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	if partition != "" {
+		cpus, _ := kernelParamValue(runtimeConfig.HypervisorConfig.HypervisorParams, hostCPUsParam)
+		if err := setPodPartition(containerID, partition, cpus); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
 	containers := pod.GetAllContainers()
 	if len(containers) != 1 {
 		return vc.Process{}, fmt.Errorf("BUG: Container list from pod is wrong, expecting only one container, found %d containers", len(containers))
@@ -200,7 +585,9 @@ func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
 	return containers[0].Process(), nil
 }
 
-func createContainer(ociSpec oci.CompatOCISpec, containerID, bundlePath,
+// createContainer creates a container in an existing pod, recording in
+// undo how to remove it.
+func createContainer(ctx context.Context, undo *undoLog, ociSpec oci.CompatOCISpec, containerID, bundlePath,
 	console string, disableOutput bool) (vc.Process, error) {
 
 	contConfig, err := oci.ContainerConfig(ociSpec, bundlePath, containerID, console, disableOutput)
@@ -208,19 +595,78 @@ func createContainer(ociSpec oci.CompatOCISpec, containerID, bundlePath,
 		return vc.Process{}, err
 	}
 
+	if err := handlePrivileged(ociSpec, &contConfig); err != nil {
+		return vc.Process{}, err
+	}
+
 	podID, err := ociSpec.PodID()
 	if err != nil {
 		return vc.Process{}, err
 	}
 
-	_, c, err := vci.CreateContainer(podID, contConfig)
+	if err := validateID("pod", podID); err != nil {
+		return vc.Process{}, err
+	}
+
+	podID, err = podVMID(podID)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	if err := applyDiskQuota(ociSpec, containerID, bundlePath); err != nil {
+		return vc.Process{}, err
+	}
+
+	restoreDir, err := runtimeOptions.CoreDump.enter(podID)
+	if err != nil {
+		return vc.Process{}, err
+	}
+	defer restoreDir()
+
+	var c vc.VCContainer
+
+	err = vcCall(ctx, "create container "+containerID, func() (err error) {
+		_, c, err = vci.CreateContainer(podID, contConfig)
+		return err
+	})
 	if err != nil {
 		return vc.Process{}, err
 	}
 
+	undo.add("container", func() error {
+		return destroyContainer(podID, containerID)
+	})
+
 	return c.Process(), nil
 }
 
+// destroyPodVM stops and deletes the VM of a pod which could not be
+// created.
+func destroyPodVM(podID string) error {
+	ctx, cancel := rollbackContext()
+	defer cancel()
+
+	if err := vcCall(ctx, "stop pod "+podID, func() error {
+		_, err := vci.StopPod(podID)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return vcCall(ctx, "delete pod "+podID, func() error {
+		_, err := vci.DeletePod(podID)
+		return err
+	})
+}
+
+// destroyContainer deletes a container which could not be created.
+func destroyContainer(podID, containerID string) error {
+	ctx, cancel := rollbackContext()
+	defer cancel()
+
+	return deleteContainer(ctx, podID, containerID, false)
+}
+
 func createCgroupsFiles(cgroupsPathList []string, pid int) error {
 	if len(cgroupsPathList) == 0 {
 		ccLog.Info("Cgroups files not created because cgroupsPath was empty")
@@ -15,6 +15,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -22,6 +24,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
@@ -323,7 +326,7 @@ func TestCreateInvalidArgs(t *testing.T) {
 	}
 
 	for i, d := range data {
-		err := create(d.containerID, d.bundlePath, d.console, d.pidFilePath, d.detach, d.runtimeConfig)
+		err := create(context.Background(), d.containerID, d.bundlePath, d.console, d.pidFilePath, d.detach, nil, d.runtimeConfig)
 		assert.Error(err, "test %d (%+v)", i, d)
 	}
 }
@@ -366,7 +369,7 @@ func TestCreateInvalidConfigJSON(t *testing.T) {
 	f.Close()
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.Error(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -413,12 +416,67 @@ func TestCreateInvalidContainerType(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.Error(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
 }
 
+func TestCreateStrict(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		assert.Fail("pod created despite an unenforced setting")
+		return nil, errors.New("unexpected")
+	}
+
+	savedStrict := runtimeOptions.Strict
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+		runtimeOptions.Strict = savedStrict
+	}()
+
+	runtimeOptions.Strict = true
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	pidFilePath := filepath.Join(tmpdir, "pidfile.txt")
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = make(map[string]string)
+	spec.Annotations[testContainerTypeAnnotation] = testContainerTypePod
+	spec.Linux.Sysctl = map[string]string{"net.ipv4.ip_forward": "1"}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), warningSysctlNotApplied)
+	assert.False(fileExists(pidFilePath))
+}
+
 func TestCreateContainerInvalid(t *testing.T) {
 	assert := assert.New(t)
 
@@ -461,7 +519,7 @@ func TestCreateContainerInvalid(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.Error(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -546,7 +604,7 @@ func TestCreateProcessCgroupsPathFail(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.Error(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -631,7 +689,7 @@ func TestCreateCreateCgroupsFilesFail(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.Error(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -707,12 +765,91 @@ func TestCreateCreateCreatePidFileFail(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.Error(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
 }
 
+func TestCreateRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &vcMock.Pod{
+		MockID: testContainerID,
+		MockContainers: []*vcMock.Container{
+			{MockID: testContainerID},
+		},
+	}
+
+	var stopped, deleted []string
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		return pod, nil
+	}
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		stopped = append(stopped, podID)
+		return pod, nil
+	}
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		deleted = append(deleted, podID)
+		return pod, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+		testingImpl.StopPodFunc = nil
+		testingImpl.DeletePodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	// Force pod-type container
+	spec.Annotations = make(map[string]string)
+	spec.Annotations[testContainerTypeAnnotation] = testContainerTypePod
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	// The PID file cannot be created below a regular file, even by root,
+	// which makes the last step of the creation fail.
+	notDir := filepath.Join(tmpdir, "not-a-dir")
+	err = createEmptyFile(notDir)
+	assert.NoError(err)
+
+	pidFilePath := filepath.Join(notDir, "pidfile.txt")
+
+	err = create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
+	assert.Error(err)
+
+	// The VM is destroyed and no trace of the container is left behind
+	assert.Equal([]string{testContainerID}, stopped)
+	assert.Equal([]string{testContainerID}, deleted)
+	assert.False(fileExists(lifecyclePath(testContainerID)))
+}
+
 func TestCreate(t *testing.T) {
 	assert := assert.New(t)
 
@@ -773,7 +910,7 @@ func TestCreate(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.NoError(err, "%+v", detach)
 	}
 }
@@ -833,7 +970,7 @@ func TestCreateInvalidKernelParams(t *testing.T) {
 	}
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(context.Background(), testContainerID, bundlePath, testConsole, pidFilePath, true, nil, runtimeConfig)
 		assert.Error(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -881,7 +1018,7 @@ func TestCreateCreatePodPodConfigFail(t *testing.T) {
 		Quota: &quota,
 	}
 
-	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	_, err = createPod(context.Background(), &undoLog{}, spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 }
@@ -916,11 +1053,99 @@ func TestCreateCreatePodFail(t *testing.T) {
 	spec, err := readOCIConfigFile(ociConfigFile)
 	assert.NoError(err)
 
-	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	_, err = createPod(context.Background(), &undoLog{}, spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 }
 
+func TestCreateCreatePodHypervisorFail(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedCoreDump := runtimeOptions.CoreDump
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		return nil, errors.New("qemu-system-x86_64: failed to initialize KVM: No such file or directory")
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+		runtimeOptions.CoreDump = savedCoreDump
+	}()
+
+	runtimeOptions.CoreDump = coreDump{Dir: filepath.Join(tmpdir, "diagnostics")}
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	_, err = createPod(context.Background(), &undoLog{}, spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.True(isHypervisorError(err))
+	assert.Equal(hypervisorFailureKVM, err.(hypervisorError).kind)
+	assert.True(fileExists(filepath.Join(runtimeOptions.CoreDump.podDir(testContainerID), hypervisorLogFile)))
+}
+
+func TestCreateCreatePodInterrupted(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	// The hypervisor hangs
+	hung := make(chan struct{})
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		<-hung
+		return nil, errors.New("should be abandoned")
+	}
+
+	var killed []string
+
+	savedKillHypervisor := killHypervisor
+	killHypervisor = func(vmID string) error {
+		killed = append(killed, vmID)
+		return nil
+	}
+
+	defer func() {
+		// The abandoned call still uses the mock.
+		close(hung)
+		waitVCCalls()
+
+		testingImpl.CreatePodFunc = nil
+		killHypervisor = savedKillHypervisor
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = createPod(ctx, &undoLog{}, spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.True(isInterrupted(err))
+	assert.Equal([]string{testContainerID}, killed)
+}
+
 func TestCreateCreateContainerContainerConfigFail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -958,7 +1183,7 @@ func TestCreateCreateContainerContainerConfigFail(t *testing.T) {
 	assert.NoError(err)
 
 	for _, disableOutput := range []bool{true, false} {
-		_, err = createContainer(spec, testContainerID, bundlePath, testConsole, disableOutput)
+		_, err = createContainer(context.Background(), &undoLog{}, spec, testContainerID, bundlePath, testConsole, disableOutput)
 		assert.Error(err)
 		assert.False(vcMock.IsMockError(err))
 		assert.True(strings.Contains(err.Error(), containerType))
@@ -1002,7 +1227,7 @@ func TestCreateCreateContainerFail(t *testing.T) {
 	assert.NoError(err)
 
 	for _, disableOutput := range []bool{true, false} {
-		_, err = createContainer(spec, testContainerID, bundlePath, testConsole, disableOutput)
+		_, err = createContainer(context.Background(), &undoLog{}, spec, testContainerID, bundlePath, testConsole, disableOutput)
 		assert.Error(err)
 		assert.True(vcMock.IsMockError(err))
 	}
@@ -1050,7 +1275,7 @@ func TestCreateCreateContainer(t *testing.T) {
 	assert.NoError(err)
 
 	for _, disableOutput := range []bool{true, false} {
-		_, err = createContainer(spec, testContainerID, bundlePath, testConsole, disableOutput)
+		_, err = createContainer(context.Background(), &undoLog{}, spec, testContainerID, bundlePath, testConsole, disableOutput)
 		assert.NoError(err)
 	}
 }
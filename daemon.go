@@ -0,0 +1,437 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// daemonRunPath is the REST endpoint used to run a command.
+	daemonRunPath = "/v1/run"
+
+	// daemonSocketName is the name of the daemon socket below the
+	// state directory.
+	daemonSocketName = "daemon.sock"
+
+	daemonSocketMode = os.FileMode(0660)
+
+	// listenFdsStart is the first file descriptor passed by systemd.
+	listenFdsStart = 3
+)
+
+// daemonCommands lists the commands the daemon can run on behalf of the
+// command-line. Commands that need the terminal or the lifetime of the
+// calling process, such as "create" or "exec", always run locally, as
+// does "cc-health", which runs until it is stopped and reaps any child
+// of the process running it.
+var daemonCommands = []string{
+	"cc-idle-pause",
+	"cc-restart",
+	"delete",
+	"kill",
+	"list",
+	"pause",
+	"resume",
+	"start",
+	"state",
+}
+
+// daemonRequest asks the daemon to run a command. Args are the
+// command-line arguments, without the program name.
+type daemonRequest struct {
+	Args []string `json:"args"`
+}
+
+// daemonResponse is the result of a command run by the daemon.
+type daemonResponse struct {
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// daemon runs the runtime commands received on its socket, using the
+// configuration it loaded once at startup.
+type daemon struct {
+	// The commands modify the global state of the runtime so they
+	// are run one at a time.
+	sync.Mutex
+
+	metadata map[string]interface{}
+}
+
+func isDaemonCommand(command string) bool {
+	for _, c := range daemonCommands {
+		if c == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// before replaces beforeSubcommands for the commands run by the daemon:
+// the configuration has already been loaded.
+func (d *daemon) before(context *cli.Context) error {
+	if !isDaemonCommand(context.Args().First()) {
+		return fmt.Errorf("Command %q cannot be run by the daemon", context.Args().First())
+	}
+
+	if err := setOutputFormat(context); err != nil {
+		return err
+	}
+
+	setInstanceDirs(context, runtimeOptions)
+
+	context.App.Metadata = d.metadata
+
+	return nil
+}
+
+// run runs the specified command, capturing its output.
+func (d *daemon) run(args []string) daemonResponse {
+	d.Lock()
+	defer d.Unlock()
+
+	return runCaptured(timeCommands(runtimeCommands), args, d.before)
+}
+
+// runCaptured runs the specified command in-process, capturing its
+// output. The before function replaces beforeSubcommands: it must check
+// the command may be run and set up the application.
+func runCaptured(commands []cli.Command, args []string, before cli.BeforeFunc) daemonResponse {
+	out, err := ioutil.TempFile("", "cc-daemon-")
+	if err != nil {
+		return daemonResponse{Error: err.Error(), ExitCode: 1}
+	}
+
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	savedStdout := os.Stdout
+	savedOutputFile := defaultOutputFile
+	savedErrWriter := cli.ErrWriter
+	savedRuntimeStateDir := runtimeStateDir
+	savedAgentSocketDir := agentSocketDir
+	savedOutputFormat := outputFormat
+
+	defer func() {
+		os.Stdout = savedStdout
+		defaultOutputFile = savedOutputFile
+		cli.ErrWriter = savedErrWriter
+		runtimeStateDir = savedRuntimeStateDir
+		agentSocketDir = savedAgentSocketDir
+		outputFormat = savedOutputFormat
+	}()
+
+	os.Stdout = out
+	defaultOutputFile = out
+	cli.ErrWriter = ioutil.Discard
+
+	app := cli.NewApp()
+	app.Name = name
+	app.Writer = out
+	app.Flags = runtimeFlags
+	app.Commands = commands
+	app.Before = before
+
+	runErr := app.Run(append([]string{name}, args...))
+
+	// A command which timed out or was cancelled may have left a
+	// virtcontainers call running: the next command must not touch
+	// the pod before it returns.
+	waitVCCalls()
+
+	output, err := ioutil.ReadFile(out.Name())
+	if err != nil && runErr == nil {
+		runErr = err
+	}
+
+	resp := daemonResponse{Output: string(output)}
+
+	if runErr != nil {
+		resp.Error = runErr.Error()
+		resp.ExitCode = 1
+
+		if coder, ok := runErr.(cli.ExitCoder); ok {
+			resp.ExitCode = coder.ExitCode()
+		}
+	}
+
+	return resp
+}
+
+func (d *daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != daemonRunPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req daemonRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ccLog.Debugf("Daemon running %v", req.Args)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(d.run(req.Args)); err != nil {
+		ccLog.Warnf("Unable to send daemon response: %v", err)
+	}
+}
+
+// activationListener returns the socket passed by systemd when the
+// daemon is socket activated, or nil.
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds == 0 {
+		return nil, nil
+	}
+
+	if nfds != 1 {
+		return nil, fmt.Errorf("Expected a single socket from systemd, got %d", nfds)
+	}
+
+	syscall.CloseOnExec(listenFdsStart)
+
+	f := os.NewFile(uintptr(listenFdsStart), "")
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+// daemonListener returns the socket the daemon listens on.
+func daemonListener(path string) (net.Listener, error) {
+	l, err := activationListener()
+	if err != nil || l != nil {
+		return l, err
+	}
+
+	return unixListener(path, daemonSocketMode)
+}
+
+// unixListener listens on a UNIX socket with the specified permissions.
+func unixListener(path string, mode os.FileMode) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), podStateDirMode); err != nil {
+		return nil, err
+	}
+
+	// Remove the socket left by a previous instance.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// callDaemon asks the daemon listening on the specified socket to run a
+// command.
+func callDaemon(socket string, args []string) (daemonResponse, error) {
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	body, err := json.Marshal(daemonRequest{Args: args})
+	if err != nil {
+		return daemonResponse{}, err
+	}
+
+	resp, err := client.Post("http://"+name+daemonRunPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return daemonResponse{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return daemonResponse{}, fmt.Errorf("Daemon error: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var result daemonResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return daemonResponse{}, err
+	}
+
+	return result, nil
+}
+
+// runInDaemon runs the command in the daemon if one is configured and
+// can be reached. It returns false if the command must run locally.
+func runInDaemon(context *cli.Context, args []string) bool {
+	socket := context.GlobalString("cc-daemon-socket")
+	if socket == "" || !isDaemonCommand(context.Args().First()) {
+		return false
+	}
+
+	resp, err := callDaemon(socket, args)
+	if err != nil {
+		ccLog.Warnf("Unable to use daemon at %v, running %q locally: %v", socket, context.Args().First(), err)
+		return false
+	}
+
+	fmt.Fprint(defaultOutputFile, resp.Output)
+
+	if resp.Error != "" {
+		ccLog.Error(resp.Error)
+		fmt.Fprintln(defaultErrorFile, resp.Error)
+	}
+
+	exit(resp.ExitCode)
+
+	return true
+}
+
+var daemonCLICommand = cli.Command{
+	Name:  "cc-daemon",
+	Usage: "run the runtime daemon",
+	Description: `The cc-daemon command runs the runtime as a long-running daemon which
+   executes runtime commands received on a local socket, avoiding the
+   cost of starting the runtime and loading its configuration for each
+   operation.
+
+   The command-line becomes a thin client of the daemon when the global
+   "--cc-daemon-socket" option, or the CC_RUNTIME_DAEMON_SOCKET
+   environment variable, is set. Commands which cannot be run by the
+   daemon, and all commands when the daemon is not running, still run
+   locally.
+
+   The daemon uses the configuration file it loaded at startup. It can
+   be socket activated by systemd. The commands of a runtime handler,
+   selected with "--cc-handler" or the program name, always run locally
+   as their configuration may differ.
+
+   With "--state-socket", the daemon also serves the state of the
+   containers read-only on a second socket, for monitoring agents:
+
+       GET ` + stateContainersPath + `                   list of the containers
+       GET ` + stateContainersPath + `/<container-id>    state of a container
+       GET ` + stateContainersPath + `/<container-id>/stats
+       GET ` + stateMetricsPath + `                      metrics (Prometheus)
+
+   The access to the state socket is only controlled by its permissions.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "socket",
+			Usage: "path of the daemon socket (default: <root>/" + daemonSocketName + ")",
+		},
+		cli.StringFlag{
+			Name:  "state-socket",
+			Usage: "path of the read-only state socket (default: none)",
+		},
+		cli.StringFlag{
+			Name:  "state-socket-mode",
+			Value: defaultStateSocketMode,
+			Usage: "permissions of the state socket",
+		},
+		cli.StringFlag{
+			Name:  "state-socket-group",
+			Usage: "group owning the state socket",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		path := context.String("socket")
+		if path == "" {
+			path = filepath.Join(runtimeStateDir, daemonSocketName)
+		}
+
+		l, err := daemonListener(path)
+		if err != nil {
+			return err
+		}
+
+		defer l.Close()
+
+		// Errors are returned to the clients, they must not
+		// terminate the daemon.
+		cli.OsExiter = func(int) {}
+
+		d := &daemon{
+			metadata: context.App.Metadata,
+		}
+
+		if runtimeOptions.DeferredDelete.Enable {
+			teardowns = newTeardownQueue(runtimeStateDir, runtimeOptions.DeferredDelete, d)
+			go teardowns.run(nil)
+		}
+
+		errCh := make(chan error, 2)
+
+		if statePath := context.String("state-socket"); statePath != "" {
+			sl, err := stateListener(statePath, context.String("state-socket-mode"), context.String("state-socket-group"))
+			if err != nil {
+				return err
+			}
+
+			defer sl.Close()
+
+			ccLog.Infof("Daemon serving the state on %v", sl.Addr())
+
+			go func() {
+				errCh <- http.Serve(sl, &stateServer{d: d})
+			}()
+		}
+
+		ccLog.Infof("Daemon listening on %v", l.Addr())
+
+		go func() {
+			errCh <- http.Serve(l, d)
+		}()
+
+		return <-errCh
+	},
+}
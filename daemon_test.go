@@ -0,0 +1,232 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func newTestDaemon(t *testing.T, dir string) *daemon {
+	runtimeConfig, err := newTestRuntimeConfig(dir, testConsole, true)
+	assert.NoError(t, err)
+
+	return &daemon{
+		metadata: map[string]interface{}{
+			"runtimeConfig": runtimeConfig,
+		},
+	}
+}
+
+func TestDaemonCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, command := range []string{"state", "kill", "list"} {
+		assert.True(isDaemonCommand(command), command)
+	}
+
+	for _, command := range []string{"", "create", "exec", "run", "cc-daemon", "cc-health"} {
+		assert.False(isDaemonCommand(command), command)
+	}
+}
+
+func TestDaemonRun(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "daemon-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	d := newTestDaemon(t, dir)
+
+	savedStdout := os.Stdout
+	savedOutputFile := defaultOutputFile
+	savedRuntimeStateDir := runtimeStateDir
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: testContainerID, Annotations: map[string]string{}},
+				},
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	resp := d.run([]string{"--root", filepath.Join(dir, "state"), "list", "--quiet"})
+	assert.Equal(daemonResponse{Output: testContainerID + "\n"}, resp)
+
+	// the global state is restored
+	assert.Equal(savedStdout, os.Stdout)
+	assert.Equal(savedOutputFile, defaultOutputFile)
+	assert.Equal(savedRuntimeStateDir, runtimeStateDir)
+
+	// command failure
+	resp = d.run([]string{"state", "enoent"})
+	assert.NotEmpty(resp.Error)
+	assert.Equal(1, resp.ExitCode)
+
+	// commands needing the caller process are not allowed
+	resp = d.run([]string{"exec", testContainerID, "true"})
+	assert.True(strings.Contains(resp.Error, "cannot be run by the daemon"), resp.Error)
+	assert.Equal(1, resp.ExitCode)
+
+	// cc-health would never return, holding the daemon
+	done := make(chan daemonResponse)
+	go func() {
+		done <- d.run([]string{"--root", filepath.Join(dir, "state"), "cc-health"})
+	}()
+
+	select {
+	case resp = <-done:
+		assert.True(strings.Contains(resp.Error, "cannot be run by the daemon"), resp.Error)
+		assert.Equal(1, resp.ExitCode)
+	case <-time.After(10 * time.Second):
+		t.Fatal("cc-health run by the daemon did not return")
+	}
+}
+
+func TestDaemonServeHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "daemon-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	server := newTestDaemon(t, dir)
+
+	type testData struct {
+		method   string
+		path     string
+		body     string
+		expected int
+	}
+
+	data := []testData{
+		{"GET", daemonRunPath, "", http.StatusMethodNotAllowed},
+		{"POST", "/v1/foo", "", http.StatusNotFound},
+		{"POST", daemonRunPath, "{", http.StatusBadRequest},
+		{"POST", daemonRunPath, `{"args":["exec"]}`, http.StatusOK},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, strings.NewReader(d.body))
+		w := httptest.NewRecorder()
+
+		server.ServeHTTP(w, req)
+		assert.Equal(d.expected, w.Code, "%+v", d)
+	}
+}
+
+func TestDaemonCall(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "daemon-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "sockets", daemonSocketName)
+
+	// no daemon
+	_, err = callDaemon(socket, []string{"list"})
+	assert.Error(err)
+
+	// stale socket
+	assert.NoError(os.MkdirAll(filepath.Dir(socket), testDirMode))
+	assert.NoError(createEmptyFile(socket))
+
+	l, err := daemonListener(socket)
+	assert.NoError(err)
+	defer l.Close()
+
+	info, err := os.Stat(socket)
+	assert.NoError(err)
+	assert.Equal(daemonSocketMode, info.Mode().Perm())
+
+	go http.Serve(l, newTestDaemon(t, dir))
+
+	resp, err := callDaemon(socket, []string{"exec"})
+	assert.NoError(err)
+	assert.Equal(1, resp.ExitCode)
+	assert.NotEmpty(resp.Error)
+}
+
+func TestDaemonActivationListener(t *testing.T) {
+	assert := assert.New(t)
+
+	savedPid := os.Getenv("LISTEN_PID")
+	savedFds := os.Getenv("LISTEN_FDS")
+	defer func() {
+		os.Setenv("LISTEN_PID", savedPid)
+		os.Setenv("LISTEN_FDS", savedFds)
+	}()
+
+	// not activated
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+
+	l, err := activationListener()
+	assert.NoError(err)
+	assert.Nil(l)
+
+	os.Setenv("LISTEN_PID", "")
+
+	l, err = activationListener()
+	assert.NoError(err)
+	assert.Nil(l)
+}
+
+func TestDaemonRunInDaemon(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "daemon-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	newContext := func(socket string, args ...string) *cli.Context {
+		set := flag.NewFlagSet("", 0)
+		set.String("cc-daemon-socket", socket, "")
+		assert.NoError(set.Parse(args))
+
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+
+	// no daemon configured
+	assert.False(runInDaemon(newContext("", "list"), []string{"list"}))
+
+	socket := filepath.Join(dir, daemonSocketName)
+
+	// command not supported by the daemon
+	assert.False(runInDaemon(newContext(socket, "exec"), []string{"exec"}))
+
+	// daemon not running
+	assert.False(runInDaemon(newContext(socket, "list"), []string{"list"}))
+}
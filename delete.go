@@ -16,9 +16,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	ccruntime "github.com/clearcontainers/runtime/pkg/runtime"
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
@@ -36,7 +38,10 @@ EXAMPLE:
    status of "ubuntu01" as "stopped" the following will delete resources held
    for "ubuntu01" removing "ubuntu01" from the ` + name + ` list of containers:
 
-       # ` + name + ` delete ubuntu01`,
+       # ` + name + ` delete ubuntu01
+
+   When run by the daemon with deferred_delete enabled in the
+   configuration, the deletion of a pod is completed in the background.`,
 	Flags: []cli.Flag{
 		cli.BoolFlag{
 			Name:  "force, f",
@@ -49,9 +54,24 @@ EXAMPLE:
 			return fmt.Errorf("Missing container ID, should at least provide one")
 		}
 
+		ctx, cancel := commandContext(runtimeOptions.Timeouts.delete())
+		defer cancel()
+
 		force := context.Bool("force")
 		for _, cID := range []string(args) {
-			if err := delete(cID, force); err != nil {
+			var err error
+
+			if teardowns != nil {
+				err = teardowns.request(ctx, cID, force)
+			} else {
+				err = delete(ctx, cID, force)
+			}
+
+			// The container was already deleted, for instance by
+			// a delete whose result the caller did not get.
+			if isNotFound(err) {
+				ccLog.Info(err)
+			} else if err != nil {
 				return err
 			}
 		}
@@ -60,13 +80,27 @@ EXAMPLE:
 	},
 }
 
-func delete(containerID string, force bool) error {
-	// Checks the MUST and MUST NOT from OCI runtime specification
-	status, podID, err := getExistingContainerInfo(containerID)
+// delete deletes a container. Deleting a container which does not exist
+// removes what the runtime may have left of it and returns a
+// NotFoundError, so that retried deletes are harmless.
+func delete(ctx context.Context, containerID string, force bool) error {
+	status, podID, err := getContainerInfo(containerID)
 	if err != nil {
 		return err
 	}
 
+	if status.ID == "" {
+		if err := validateID("container", containerID); err != nil {
+			return err
+		}
+
+		if err := removeLeftovers(containerID); err != nil {
+			return err
+		}
+
+		return ccruntime.NotFoundError{ID: containerID}
+	}
+
 	containerID = status.ID
 
 	containerType, err := oci.GetContainerType(status.Annotations)
@@ -91,21 +125,45 @@ func delete(containerID string, force bool) error {
 
 	switch containerType {
 	case vc.PodSandbox:
-		if err := deletePod(podID); err != nil {
+		if err := deleteSandbox(ctx, podID, containerID, forceStop); err != nil {
 			return err
 		}
 	case vc.PodContainer:
-		if err := deleteContainer(podID, containerID, forceStop); err != nil {
+		if err := deleteContainer(ctx, podID, containerID, forceStop); err != nil {
 			return err
 		}
 	default:
 		return fmt.Errorf("Invalid container type found")
 	}
 
+	if err := runtimeOptions.ContainerLogs.remove(containerID); err != nil {
+		return err
+	}
+
+	if err := removeLifecycle(containerID); err != nil {
+		return err
+	}
+
+	if err := removeContainerShim(containerID); err != nil {
+		return err
+	}
+
+	if err := runtimeOptions.NetworkFS.remove(containerID); err != nil {
+		return err
+	}
+
+	if err := unpinMountSources(containerID); err != nil {
+		return err
+	}
+
+	if err := removeToolboxMount(containerID); err != nil {
+		return err
+	}
+
 	// In order to prevent any file descriptor leak related to cgroups files
 	// that have been previously created, we have to remove them before this
 	// function returns.
-	cgroupsPathList, err := processCgroupsPath(ociSpec, containerType.IsPod())
+	cgroupsPathList, err := processCgroupsPath(ociSpec, containerID, containerType.IsPod())
 	if err != nil {
 		return err
 	}
@@ -113,30 +171,59 @@ func delete(containerID string, force bool) error {
 	return removeCgroupsPath(cgroupsPathList)
 }
 
-func deletePod(podID string) error {
-	if _, err := vci.StopPod(podID); err != nil {
+func deletePod(ctx context.Context, podID string) error {
+	// The console closed by the VM shutdown does not need saving.
+	if err := stopConsoleRing(podID); err != nil {
+		ccLog.Warnf("Unable to stop the guest console reader of pod %v: %v", podID, err)
+	}
+
+	if err := vcCall(ctx, "stop pod "+podID, func() error {
+		_, err := vci.StopPod(podID)
+		return err
+	}); err != nil {
 		return err
 	}
 
-	if _, err := vci.DeletePod(podID); err != nil {
+	if err := vcCall(ctx, "delete pod "+podID, func() error {
+		_, err := vci.DeletePod(podID)
+		return err
+	}); err != nil {
 		return err
 	}
 
-	return nil
+	if err := releaseResources(podID); err != nil {
+		return err
+	}
+
+	if err := removePodNetNS(podID); err != nil {
+		return err
+	}
+
+	if err := removeAgentSockets(podID); err != nil {
+		return err
+	}
+
+	if err := runtimeOptions.CoreDump.remove(podID); err != nil {
+		return err
+	}
+
+	return removePodState(podID)
 }
 
-func deleteContainer(podID, containerID string, forceStop bool) error {
+func deleteContainer(ctx context.Context, podID, containerID string, forceStop bool) error {
 	if forceStop {
-		if _, err := vci.StopContainer(podID, containerID); err != nil {
+		if err := vcCall(ctx, "stop container "+containerID, func() error {
+			_, err := vci.StopContainer(podID, containerID)
+			return err
+		}); err != nil {
 			return err
 		}
 	}
 
-	if _, err := vci.DeleteContainer(podID, containerID); err != nil {
+	return vcCall(ctx, "delete container "+containerID, func() error {
+		_, err := vci.DeleteContainer(podID, containerID)
 		return err
-	}
-
-	return nil
+	})
 }
 
 func removeCgroupsPath(cgroupsPathList []string) error {
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"io/ioutil"
 	"os"
@@ -59,12 +60,12 @@ func TestDeleteInvalidContainer(t *testing.T) {
 	assert := assert.New(t)
 
 	// Missing container id
-	err := delete("", false)
+	err := delete(context.Background(), "", false)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 
 	// Mock Listpod error
-	err = delete(testContainerID, false)
+	err = delete(context.Background(), testContainerID, false)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -77,9 +78,15 @@ func TestDeleteInvalidContainer(t *testing.T) {
 	}()
 
 	// Container missing in ListPod
-	err = delete(testContainerID, false)
+	err = delete(context.Background(), testContainerID, false)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
+	assert.True(isNotFound(err))
+
+	// Invalid ID of a missing container
+	err = delete(context.Background(), "../"+testContainerID, false)
+	assert.Error(err)
+	assert.False(isNotFound(err))
 }
 
 func TestDeleteMissingContainerTypeAnnotation(t *testing.T) {
@@ -107,7 +114,7 @@ func TestDeleteMissingContainerTypeAnnotation(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	err := delete(pod.ID(), false)
+	err := delete(context.Background(), pod.ID(), false)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 }
@@ -139,7 +146,7 @@ func TestDeleteInvalidConfig(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	err := delete(pod.ID(), false)
+	err := delete(context.Background(), pod.ID(), false)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 }
@@ -195,7 +202,7 @@ func TestDeletePod(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	err := delete(pod.ID(), false)
+	err := delete(context.Background(), pod.ID(), false)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -207,7 +214,7 @@ func TestDeletePod(t *testing.T) {
 		testingImpl.StopPodFunc = nil
 	}()
 
-	err = delete(pod.ID(), false)
+	err = delete(context.Background(), pod.ID(), false)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -219,8 +226,14 @@ func TestDeletePod(t *testing.T) {
 		testingImpl.DeletePodFunc = nil
 	}()
 
-	err = delete(pod.ID(), false)
+	assert.NoError(reserveResources(pod.ID(), reservation{VCPUs: 1}))
+
+	err = delete(context.Background(), pod.ID(), false)
 	assert.Nil(err)
+
+	ledger, err := loadReservations()
+	assert.NoError(err)
+	assert.NotContains(ledger.Pods, pod.ID())
 }
 
 func TestDeleteInvalidContainerType(t *testing.T) {
@@ -257,7 +270,7 @@ func TestDeleteInvalidContainerType(t *testing.T) {
 	}()
 
 	// Delete an invalid container type
-	err := delete(pod.ID(), false)
+	err := delete(context.Background(), pod.ID(), false)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 }
@@ -296,7 +309,7 @@ func TestDeletePodRunning(t *testing.T) {
 	}()
 
 	// Delete on a running pod should fail
-	err := delete(pod.ID(), false)
+	err := delete(context.Background(), pod.ID(), false)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 
@@ -309,7 +322,7 @@ func TestDeletePodRunning(t *testing.T) {
 	}()
 
 	// Force delete a running pod
-	err = delete(pod.ID(), true)
+	err = delete(context.Background(), pod.ID(), true)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -321,7 +334,7 @@ func TestDeletePodRunning(t *testing.T) {
 		testingImpl.DeletePodFunc = nil
 	}()
 
-	err = delete(pod.ID(), true)
+	err = delete(context.Background(), pod.ID(), true)
 	assert.Nil(err)
 }
 
@@ -366,12 +379,12 @@ func TestDeleteRunningContainer(t *testing.T) {
 	}()
 
 	// Delete on a running container should fail.
-	err := delete(pod.MockContainers[0].ID(), false)
+	err := delete(context.Background(), pod.MockContainers[0].ID(), false)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 
 	// force delete
-	err = delete(pod.MockContainers[0].ID(), true)
+	err = delete(context.Background(), pod.MockContainers[0].ID(), true)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -383,7 +396,7 @@ func TestDeleteRunningContainer(t *testing.T) {
 		testingImpl.StopContainerFunc = nil
 	}()
 
-	err = delete(pod.MockContainers[0].ID(), true)
+	err = delete(context.Background(), pod.MockContainers[0].ID(), true)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -395,7 +408,7 @@ func TestDeleteRunningContainer(t *testing.T) {
 		testingImpl.DeleteContainerFunc = nil
 	}()
 
-	err = delete(pod.MockContainers[0].ID(), true)
+	err = delete(context.Background(), pod.MockContainers[0].ID(), true)
 	assert.Nil(err)
 }
 
@@ -439,7 +452,7 @@ func TestDeleteContainer(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	err := delete(pod.MockContainers[0].ID(), false)
+	err := delete(context.Background(), pod.MockContainers[0].ID(), false)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -451,7 +464,7 @@ func TestDeleteContainer(t *testing.T) {
 		testingImpl.StopContainerFunc = nil
 	}()
 
-	err = delete(pod.MockContainers[0].ID(), false)
+	err = delete(context.Background(), pod.MockContainers[0].ID(), false)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -463,7 +476,7 @@ func TestDeleteContainer(t *testing.T) {
 		testingImpl.DeleteContainerFunc = nil
 	}()
 
-	err = delete(pod.MockContainers[0].ID(), false)
+	err = delete(context.Background(), pod.MockContainers[0].ID(), false)
 	assert.Nil(err)
 }
 
@@ -491,3 +504,25 @@ func TestDeleteCLIFunction(t *testing.T) {
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 }
+
+func TestDeleteCLIFunctionNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	fn, ok := deleteCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	flagSet := flag.NewFlagSet("container-id", flag.ContinueOnError)
+	flagSet.Parse([]string{testContainerID})
+	ctx := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+	err := fn(ctx)
+	assert.NoError(err)
+}
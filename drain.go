@@ -0,0 +1,180 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// drainFile is the name of the file, below the runtime state directory,
+// whose presence puts the runtime in drain mode.
+const drainFile = "drain.json"
+
+// drainState is the contents of the drain file.
+type drainState struct {
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// drainingError is returned when creating a pod while the runtime is
+// draining.
+type drainingError struct {
+	drainState
+}
+
+func (e drainingError) Error() string {
+	msg := fmt.Sprintf("The runtime is draining since %v: new pods cannot be created", e.Since.Format(time.RFC3339))
+	if e.Reason != "" {
+		msg += " (" + e.Reason + ")"
+	}
+
+	return msg
+}
+
+func isDraining(err error) bool {
+	_, ok := err.(drainingError)
+	return ok
+}
+
+func drainFilePath() string {
+	return filepath.Join(runtimeStateDir, drainFile)
+}
+
+// getDrainState returns the drain state of the runtime and whether it
+// is draining.
+func getDrainState() (drainState, bool, error) {
+	var state drainState
+
+	bytes, err := ioutil.ReadFile(drainFilePath())
+	if os.IsNotExist(err) {
+		return state, false, nil
+	} else if err != nil {
+		return state, false, err
+	}
+
+	// The file may also be created by hand, empty.
+	if len(bytes) > 0 {
+		if err := json.Unmarshal(bytes, &state); err != nil {
+			return state, false, fmt.Errorf("Invalid drain file %v: %v", drainFilePath(), err)
+		}
+	}
+
+	return state, true, nil
+}
+
+// checkNotDraining returns a drainingError if the runtime is draining.
+func checkNotDraining() error {
+	state, draining, err := getDrainState()
+	if err != nil {
+		return err
+	}
+
+	if draining {
+		return drainingError{state}
+	}
+
+	return nil
+}
+
+// drain puts the runtime in drain mode, or takes it out of it.
+func drain(enable bool, reason string) error {
+	if !enable {
+		err := os.Remove(drainFilePath())
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if _, draining, err := getDrainState(); err != nil || draining {
+		return err
+	}
+
+	bytes, err := json.Marshal(drainState{
+		Since:  timeNow().UTC(),
+		Reason: reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(runtimeStateDir, podStateDirMode); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(drainFilePath(), bytes, podStateFileMode)
+}
+
+var drainCLICommand = cli.Command{
+	Name:  "cc-drain",
+	Usage: "stop accepting new pods",
+	Description: `The cc-drain command puts the runtime in drain mode: creating a new pod
+   fails, but the existing pods keep working. Containers can still be
+   created in, started in, executed in and deleted from the existing pods,
+   so that they can finish. This allows maintenance tooling to cordon a
+   node independently of the orchestrator.
+
+   The runtime is draining while the "drain.json" file exists in the
+   runtime state directory, which may also be created by hand.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "reason",
+			Usage: "why the runtime is drained, reported when creating a pod fails",
+		},
+		cli.BoolFlag{
+			Name:  "undo",
+			Usage: "accept new pods again",
+		},
+		cli.BoolFlag{
+			Name:  "status",
+			Usage: "only report whether the runtime is draining",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.Bool("status") {
+			if context.Bool("undo") || context.String("reason") != "" {
+				return errors.New("Cannot change the drain mode with --status")
+			}
+
+			state, draining, err := getDrainState()
+			if err != nil {
+				return err
+			}
+
+			if draining {
+				_, err = fmt.Fprintln(defaultOutputFile, drainingError{state}.Error())
+			} else {
+				_, err = fmt.Fprintln(defaultOutputFile, "The runtime is not draining")
+			}
+
+			return err
+		}
+
+		if context.Bool("undo") && context.String("reason") != "" {
+			return errors.New("Cannot specify a reason with --undo")
+		}
+
+		return drain(!context.Bool("undo"), context.String("reason"))
+	},
+}
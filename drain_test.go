@@ -0,0 +1,200 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "drain-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	now := time.Unix(1000, 0).UTC()
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedTimeNow := timeNow
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		timeNow = savedTimeNow
+	}()
+
+	runtimeStateDir = filepath.Join(dir, "state")
+	timeNow = func() time.Time { return now }
+
+	assert.NoError(checkNotDraining())
+
+	// not draining
+	err = drain(false, "")
+	assert.NoError(err)
+
+	err = drain(true, "kernel upgrade")
+	assert.NoError(err)
+
+	err = checkNotDraining()
+	assert.Error(err)
+	assert.True(isDraining(err))
+	assert.Contains(err.Error(), "kernel upgrade")
+
+	// draining again keeps the original state
+	timeNow = func() time.Time { return now.Add(time.Hour) }
+	err = drain(true, "")
+	assert.NoError(err)
+
+	state, draining, err := getDrainState()
+	assert.NoError(err)
+	assert.True(draining)
+	assert.Equal(drainState{Since: now, Reason: "kernel upgrade"}, state)
+
+	err = drain(false, "")
+	assert.NoError(err)
+	assert.NoError(checkNotDraining())
+
+	// created by hand
+	err = createEmptyFile(drainFilePath())
+	assert.NoError(err)
+	assert.True(isDraining(checkNotDraining()))
+
+	err = createFile(drainFilePath(), "not json")
+	assert.NoError(err)
+
+	err = checkNotDraining()
+	assert.Error(err)
+	assert.False(isDraining(err))
+}
+
+func TestDrainCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "drain-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, err := os.Create(filepath.Join(dir, "output"))
+	assert.NoError(err)
+	defer outputFile.Close()
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedOutputFile := defaultOutputFile
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		defaultOutputFile = savedOutputFile
+	}()
+
+	runtimeStateDir = filepath.Join(dir, "state")
+	defaultOutputFile = outputFile
+
+	set := flag.NewFlagSet("", 0)
+	set.String("reason", "", "")
+	set.Bool("undo", false, "")
+	set.Bool("status", true, "")
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+	fn, ok := drainCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(ctx)
+	assert.NoError(err)
+	assert.NoError(grep("not draining", outputFile.Name()))
+
+	set.Set("reason", "maintenance")
+
+	// cannot change the mode when reporting the status
+	err = fn(ctx)
+	assert.Error(err)
+
+	set.Set("status", "false")
+
+	err = fn(ctx)
+	assert.NoError(err)
+	assert.True(fileExists(drainFilePath()))
+
+	// a reason is meaningless when undoing
+	set.Set("undo", "true")
+	err = fn(ctx)
+	assert.Error(err)
+
+	set.Set("reason", "")
+	err = fn(ctx)
+	assert.NoError(err)
+	assert.False(fileExists(drainFilePath()))
+}
+
+func TestCreateDraining(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+	}()
+
+	runtimeStateDir = filepath.Join(tmpdir, "state")
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		assert.Fail("pod created while draining")
+		return nil, nil
+	}
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = drain(true, "")
+	assert.NoError(err)
+
+	err = create(context.Background(), testContainerID, bundlePath, testConsole, "", true, nil, runtimeConfig)
+	assert.Error(err)
+	assert.True(isDraining(err))
+}
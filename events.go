@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const defaultEventsInterval = 5 * time.Second
+
+// stats are the statistics of a container. The JSON form follows the
+// one of the "events" command of runc. Only the network statistics of
+// the host side of the VM are available.
+type stats struct {
+	NetworkInterfaces []netStats `json:"network_interfaces,omitempty"`
+}
+
+// event is a container event, as printed by the events command.
+type event struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+func containerStats(containerID string) (stats, error) {
+	// Checks the MUST and MUST NOT from OCI runtime specification
+	status, _, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return stats{}, err
+	}
+
+	network, err := containerNetStats(status)
+	if err != nil {
+		return stats{}, err
+	}
+
+	return stats{NetworkInterfaces: network}, nil
+}
+
+func writeStatsEvent(containerID string) error {
+	s, err := containerStats(containerID)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(event{Type: "stats", ID: containerID, Data: s})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(defaultOutputFile, "%s\n", bytes)
+	return err
+}
+
+var eventsCLICommand = cli.Command{
+	Name:  "events",
+	Usage: "display container events such as resource usage statistics",
+	ArgsUsage: `<container-id>
+
+   <container-id> is your name for the instance of the container`,
+	Description: `The events command displays the resource usage statistics of a
+   container at regular intervals, as JSON, until the container goes away.
+
+   The statistics include the network interfaces of the pod, as seen by
+   the tap devices connecting the VM to the network.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: defaultEventsInterval,
+			Usage: "set the stats collection interval",
+		},
+		cli.BoolFlag{
+			Name:  "stats",
+			Usage: "display the container's stats then exit",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		containerID := context.Args().First()
+
+		if context.Bool("stats") {
+			return writeStatsEvent(containerID)
+		}
+
+		interval := context.Duration("interval")
+		if interval <= 0 {
+			return errors.New("The interval must be greater than zero")
+		}
+
+		for {
+			if err := writeStatsEvent(containerID); err != nil {
+				return err
+			}
+
+			time.Sleep(interval)
+		}
+	},
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsCLIFunctionStats(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "events-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedOutputFile := defaultOutputFile
+	savedNetNSStats := netNSStats
+	defer func() {
+		defaultOutputFile = savedOutputFile
+		netNSStats = savedNetNSStats
+	}()
+
+	outputPath := filepath.Join(dir, "output")
+	defaultOutputFile, err = os.Create(outputPath)
+	assert.NoError(err)
+	defer defaultOutputFile.Close()
+
+	netNSStats = func(path string) ([]netStats, error) {
+		return []netStats{{Name: "tap0", RxBytes: 42}}, nil
+	}
+
+	bundlePath := makeNetNSBundle(assert, dir, "/var/run/netns/pod")
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testContainerID,
+						Annotations: map[string]string{
+							oci.BundlePathKey: bundlePath,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	set := flag.NewFlagSet("", 0)
+	set.Bool("stats", false, "")
+	set.Parse([]string{"--stats", testContainerID})
+
+	execCLICommandFunc(assert, eventsCLICommand, set, false)
+
+	data, err := ioutil.ReadFile(outputPath)
+	assert.NoError(err)
+
+	var e struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Data stats  `json:"data"`
+	}
+
+	assert.NoError(json.Unmarshal(data, &e))
+	assert.Equal("stats", e.Type)
+	assert.Equal(testContainerID, e.ID)
+	assert.Equal([]netStats{{Name: "tap0", RxBytes: 42}}, e.Data.NetworkInterfaces)
+
+	// unknown container
+	set = flag.NewFlagSet("", 0)
+	set.Bool("stats", false, "")
+	set.Parse([]string{"--stats", "enoent"})
+
+	execCLICommandFunc(assert, eventsCLICommand, set, true)
+
+	// the interval must be positive
+	set = flag.NewFlagSet("", 0)
+	set.Duration("interval", 0, "")
+	set.Parse([]string{testContainerID})
+
+	execCLICommandFunc(assert, eventsCLICommand, set, true)
+}
@@ -28,6 +28,16 @@ import (
 	"github.com/urfave/cli"
 )
 
+// execResult is the result of an exec.
+type execResult struct {
+	pid int
+
+	// exited is true when the runtime waited for the process, in
+	// which case exitCode is its exit status.
+	exited   bool
+	exitCode int
+}
+
 type execParams struct {
 	ociProcess   oci.CompatOCIProcess
 	cID          string
@@ -37,6 +47,7 @@ type execParams struct {
 	detach       bool
 	processLabel string
 	noSubreaper  bool
+	toolbox      bool
 }
 
 var execCLICommand = cli.Command{
@@ -48,6 +59,20 @@ var execCLICommand = cli.Command{
    is the command to be executed in the container. <command> can't be empty
    unless a "-p" flag provided.
 
+   The processes are tracked as exec sessions until they exit, or until
+   they are reaped when the exec command does not wait for them. With
+   "--list", "--kill" or "--reap", the exec command manages the exec
+   sessions of the container instead of running a process.
+
+   With "--toolbox", the static binaries of the toolbox_dir of the
+   configuration are copied to the ` + toolboxPath + ` directory of the
+   container, which is appended to the PATH of the process, to debug
+   containers without tools. The directory is a read only mount added to
+   the containers created while toolbox_dir is set, so the root
+   filesystem of the container is not modified. The binaries are removed
+   when the last process using them exits, if the exec command waits for
+   it.
+
 EXAMPLE:
    If the container is configured to run the linux ps command the following
    will output a list of processes running in the container:
@@ -109,6 +134,27 @@ EXAMPLE:
 			Value: &cli.StringSlice{},
 			Usage: "add a capability to the bounding set for the process",
 		},
+		cli.BoolFlag{
+			Name:  "toolbox",
+			Usage: "make the static binaries of the toolbox_dir of the configuration available to the process",
+		},
+		cli.BoolFlag{
+			Name:  "list",
+			Usage: "list the exec sessions of the container",
+		},
+		cli.StringFlag{
+			Name:  "kill",
+			Usage: "send a signal to the process of the specified exec session",
+		},
+		cli.StringFlag{
+			Name:  "signal",
+			Value: "SIGKILL",
+			Usage: "signal sent by --kill",
+		},
+		cli.BoolFlag{
+			Name:  "reap",
+			Usage: "forget the exec sessions whose process exited",
+		},
 		cli.BoolFlag{
 			Name:   "no-subreaper",
 			Usage:  "disable the use of the subreaper used to reap reparented processes",
@@ -116,6 +162,10 @@ EXAMPLE:
 		},
 	},
 	Action: func(context *cli.Context) error {
+		if wantExecSessions(context) {
+			return manageExecSessions(context)
+		}
+
 		return execute(context)
 	},
 }
@@ -131,6 +181,7 @@ func generateExecParams(context *cli.Context, specProcess *oci.CompatOCIProcess)
 		detach:       context.Bool("detach"),
 		processLabel: context.String("process-label"),
 		noSubreaper:  context.Bool("no-subreaper"),
+		toolbox:      context.Bool("toolbox"),
 	}
 
 	if context.String("process") != "" {
@@ -186,38 +237,82 @@ func generateExecParams(context *cli.Context, specProcess *oci.CompatOCIProcess)
 }
 
 func execute(context *cli.Context) error {
-	containerID := context.Args().First()
+	result, err := runExec(context.Args().First(), func(specProcess *oci.CompatOCIProcess) (execParams, error) {
+		return generateExecParams(context, specProcess)
+	})
+	if err != nil || !result.exited {
+		return err
+	}
+
+	// Exit code has to be forwarded in this case.
+	return cli.NewExitError("", result.exitCode)
+}
+
+// runExec runs a new process in the specified container. The parameters
+// are obtained from makeParams, given the process of the container.
+func runExec(containerID string, makeParams func(specProcess *oci.CompatOCIProcess) (execParams, error)) (execResult, error) {
 	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
-		return err
+		return execResult{}, err
+	}
+
+	policy, err := loadPolicy()
+	if err != nil {
+		return execResult{}, err
+	}
+
+	if err := policy.checkExec(); err != nil {
+		return execResult{}, err
+	}
+
+	// The pod may have been paused because it was idle.
+	status, err = wakeContainer(status, podID)
+	if err != nil {
+		return execResult{}, err
 	}
 
 	// Retrieve OCI spec configuration.
 	ociSpec, err := oci.GetOCIConfig(status)
 	if err != nil {
-		return err
+		return execResult{}, err
 	}
 
-	params, err := generateExecParams(context, ociSpec.Process)
+	params, err := makeParams(ociSpec.Process)
 	if err != nil {
-		return err
+		return execResult{}, err
 	}
 
 	params.cID = status.ID
 
 	// container MUST be running
 	if status.State.State != vc.StateRunning {
-		return fmt.Errorf("Container %s is not running", params.cID)
+		return execResult{}, fmt.Errorf("Container %s is not running", params.cID)
+	}
+
+	if params.toolbox {
+		if err := setupExecToolbox(status.ID, policy, &params); err != nil {
+			return execResult{}, err
+		}
+
+		// Registered first to run after the session is
+		// unregistered.
+		if !params.detach {
+			defer func() {
+				if err := removeToolbox(podID, status.ID); err != nil {
+					ccLog.WithError(err).Warn("Unable to remove the toolbox")
+				}
+			}()
+		}
 	}
 
 	envVars, err := oci.EnvVars(params.ociProcess.Env)
 	if err != nil {
-		return err
+		return execResult{}, err
 	}
 
 	consolePath, err := setupConsole(params.console, params.consoleSock)
 	if err != nil {
-		return err
+		return execResult{}, err
 	}
 
 	cmd := vc.Cmd{
@@ -230,33 +325,74 @@ func execute(context *cli.Context) error {
 		Detach:      noNeedForOutput(params.detach, params.ociProcess.Terminal),
 	}
 
+	restoreDir, err := runtimeOptions.CoreDump.enter(podID)
+	if err != nil {
+		return execResult{}, err
+	}
+	defer restoreDir()
+
 	_, _, process, err := vci.EnterContainer(podID, params.cID, cmd)
 	if err != nil {
-		return err
+		return execResult{}, err
 	}
 
+	result := execResult{pid: process.Pid}
+
 	// Creation of PID file has to be the last thing done in the exec
 	// because containerd considers the exec to have finished starting
 	// after this file is created.
 	if err := createPIDFile(params.pidFile, process.Pid); err != nil {
-		return err
+		return result, err
+	}
+
+	// The process runs: failing to track it is not fatal.
+	session, err := registerExecSession(podID, params.cID, process.Pid, params.ociProcess.Args, params.detach, params.toolbox)
+	if err != nil {
+		ccLog.WithError(err).Warn("Unable to record the exec session")
+	} else if !params.detach {
+		defer unregisterExecSession(podID, session)
 	}
 
-	if !params.detach {
+	if params.detach {
+		return result, nil
+	}
+
+	if params.noSubreaper {
 		p, err := os.FindProcess(process.Pid)
 		if err != nil {
-			return err
+			return result, err
 		}
 
 		ps, err := p.Wait()
 		if err != nil {
-			return fmt.Errorf("Process state %s, container info %+v: %v",
+			return result, fmt.Errorf("Process state %s, container info %+v: %v",
 				ps.String(), status, err)
 		}
 
-		// Exit code has to be forwarded in this case.
-		return cli.NewExitError("", ps.Sys().(syscall.WaitStatus).ExitStatus())
+		result.exited = true
+		result.exitCode = ps.Sys().(syscall.WaitStatus).ExitStatus()
+
+		return result, nil
 	}
 
-	return nil
+	// Reap the processes reparented to the runtime while waiting for
+	// the process to exit.
+	if err := setSubreaper(true); err != nil {
+		return result, err
+	}
+
+	r := newReaper()
+	r.track(process.Pid, podID, "shim")
+	r.start()
+	defer r.stop()
+
+	ws, err := r.wait(process.Pid)
+	if err != nil {
+		return result, err
+	}
+
+	result.exited = true
+	result.exitCode = ws.ExitStatus()
+
+	return result, nil
 }
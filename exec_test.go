@@ -582,6 +582,7 @@ func TestGenerateExecParams(t *testing.T) {
 	flagSet.String("user", user, "")
 	flagSet.String("cwd", cwd, "")
 	flagSet.String("apparmor", apparmor, "")
+	flagSet.Bool("toolbox", true, "")
 
 	ctx := cli.NewContext(cli.NewApp(), flagSet, nil)
 	process := &oci.CompatOCIProcess{}
@@ -594,6 +595,7 @@ func TestGenerateExecParams(t *testing.T) {
 	assert.Equal(params.processLabel, processLabel)
 	assert.Equal(params.noSubreaper, false)
 	assert.Equal(params.detach, false)
+	assert.Equal(params.toolbox, true)
 
 	assert.Equal(params.ociProcess.Terminal, false)
 	assert.Equal(params.ociProcess.User.UID, uint32(0))
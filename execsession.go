@@ -0,0 +1,289 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// execSession is a process run in a container by the exec command. The
+// shim of the process forwards the signals it receives to the process.
+type execSession struct {
+	ID          string `json:"id"`
+	ContainerID string `json:"containerID"`
+
+	// PID is the PID of the shim of the process.
+	PID int `json:"pid"`
+
+	// ShimStart is the start time of the shim, in clock ticks after
+	// boot, which tells a shim from a process reusing its PID.
+	ShimStart uint64 `json:"shimStart"`
+
+	Args     []string  `json:"args"`
+	Created  time.Time `json:"created"`
+	Detached bool      `json:"detached,omitempty"`
+
+	// Toolbox is true when the process may use the toolbox of the
+	// container.
+	Toolbox bool `json:"toolbox,omitempty"`
+}
+
+// variable rather than a function to allow tests to modify it
+var procStartTime = getProcStartTime
+
+// getProcStartTime returns the start time of a process, in clock ticks
+// after boot.
+func getProcStartTime(pid int) (uint64, error) {
+	data, err := readProcStat(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name may contain spaces and parentheses: the
+	// fields after it start after the last parenthesis, with the
+	// state, the third field.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+
+	const startTimeField = 22
+
+	if len(fields) < startTimeField-2 {
+		return 0, fmt.Errorf("Invalid stat file for process %d", pid)
+	}
+
+	return strconv.ParseUint(fields[startTimeField-3], 10, 64)
+}
+
+// running returns true if the shim of the session is still running.
+func (s execSession) running() bool {
+	start, err := procStartTime(s.PID)
+	return err == nil && start == s.ShimStart
+}
+
+func (s execSession) status() string {
+	if s.running() {
+		return "running"
+	}
+
+	return "exited"
+}
+
+func newExecSessionID() (string, error) {
+	id := make([]byte, 6)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// registerExecSession records a process run in a container in the state
+// of its pod.
+func registerExecSession(podID, containerID string, shimPID int, args []string, detached, toolbox bool) (execSession, error) {
+	id, err := newExecSessionID()
+	if err != nil {
+		return execSession{}, err
+	}
+
+	start, err := procStartTime(shimPID)
+	if err != nil {
+		return execSession{}, err
+	}
+
+	session := execSession{
+		ID:          id,
+		ContainerID: containerID,
+		PID:         shimPID,
+		ShimStart:   start,
+		Args:        args,
+		Created:     timeNow(),
+		Detached:    detached,
+		Toolbox:     toolbox,
+	}
+
+	err = updatePodState(podID, func(state *podState) error {
+		state.Execs = append(state.Execs, session)
+		return nil
+	})
+
+	return session, err
+}
+
+// removeExecSessions removes from the state of the pod the sessions of
+// the container for which remove returns true, and returns them.
+func removeExecSessions(podID, containerID string, remove func(execSession) bool) ([]execSession, error) {
+	var removed []execSession
+
+	err := updatePodState(podID, func(state *podState) error {
+		var kept []execSession
+
+		for _, s := range state.Execs {
+			if s.ContainerID == containerID && remove(s) {
+				removed = append(removed, s)
+			} else {
+				kept = append(kept, s)
+			}
+		}
+
+		state.Execs = kept
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+// unregisterExecSession removes a session from the state of its pod.
+func unregisterExecSession(podID string, session execSession) error {
+	_, err := removeExecSessions(podID, session.ContainerID, func(s execSession) bool {
+		return s.ID == session.ID
+	})
+
+	return err
+}
+
+// reapExecSessions removes the sessions of the container whose process
+// exited, and returns them.
+func reapExecSessions(podID, containerID string) ([]execSession, error) {
+	return removeExecSessions(podID, containerID, func(s execSession) bool {
+		return !s.running()
+	})
+}
+
+// listExecSessions returns the sessions of the container.
+func listExecSessions(podID, containerID string) ([]execSession, error) {
+	state, err := loadPodState(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []execSession{}
+
+	for _, s := range state.Execs {
+		if s.ContainerID == containerID {
+			sessions = append(sessions, s)
+		}
+	}
+
+	return sessions, nil
+}
+
+// killExecSession sends a signal to the process of a session of the
+// container.
+func killExecSession(podID, containerID, id string, signal syscall.Signal) error {
+	sessions, err := listExecSessions(podID, containerID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if s.ID != id {
+			continue
+		}
+
+		if !s.running() {
+			return fmt.Errorf("Exec session %v of container %v has exited", id, containerID)
+		}
+
+		return syscall.Kill(s.PID, signal)
+	}
+
+	return fmt.Errorf("No exec session %v in container %v", id, containerID)
+}
+
+func writeExecSessions(sessions []execSession) error {
+	if wantJSONOutput() {
+		return writeJSON(sessions)
+	}
+
+	w := tabwriter.NewWriter(defaultOutputFile, 12, 1, 3, ' ', 0)
+
+	fmt.Fprintln(w, "ID\tPID\tSTATUS\tCREATED\tCOMMAND")
+
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			s.ID,
+			s.PID,
+			s.status(),
+			s.Created.Format(time.RFC3339Nano),
+			strings.Join(s.Args, " "))
+	}
+
+	return w.Flush()
+}
+
+// wantExecSessions returns true if the exec command is asked to manage
+// the exec sessions rather than to run a process.
+func wantExecSessions(context *cli.Context) bool {
+	return context.Bool("list") || context.String("kill") != "" || context.Bool("reap")
+}
+
+// manageExecSessions lists, signals or reaps the exec sessions of a
+// container.
+func manageExecSessions(context *cli.Context) error {
+	containerID := context.Args().First()
+	if containerID == "" {
+		return errors.New("Missing container ID")
+	}
+
+	// Checks the MUST and MUST NOT from OCI runtime specification
+	status, podID, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+
+	containerID = status.ID
+
+	switch {
+	case context.String("kill") != "":
+		signum, err := processSignal(context.String("signal"))
+		if err != nil {
+			return err
+		}
+
+		return killExecSession(podID, containerID, context.String("kill"), signum)
+	case context.Bool("reap"):
+		reaped, err := reapExecSessions(podID, containerID)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range reaped {
+			fmt.Fprintln(defaultOutputFile, s.ID)
+		}
+
+		return nil
+	}
+
+	sessions, err := listExecSessions(podID, containerID)
+	if err != nil {
+		return err
+	}
+
+	return writeExecSessions(sessions)
+}
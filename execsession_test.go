@@ -0,0 +1,244 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProcStartTime(t *testing.T) {
+	assert := assert.New(t)
+
+	start, err := getProcStartTime(os.Getpid())
+	assert.NoError(err)
+	assert.NotZero(start)
+
+	again, err := getProcStartTime(os.Getpid())
+	assert.NoError(err)
+	assert.Equal(start, again)
+
+	_, err = getProcStartTime(-1)
+	assert.Error(err)
+}
+
+func TestExecSessions(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "execs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedProcStartTime := procStartTime
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		procStartTime = savedProcStartTime
+	}()
+
+	runtimeStateDir = dir
+
+	running := map[int]uint64{100: 1000, 200: 2000}
+	procStartTime = func(pid int) (uint64, error) {
+		start, ok := running[pid]
+		if !ok {
+			return 0, os.ErrNotExist
+		}
+
+		return start, nil
+	}
+
+	s1, err := registerExecSession(testPodID, testContainerID, 100, []string{"sh"}, false, false)
+	assert.NoError(err)
+	s2, err := registerExecSession(testPodID, testContainerID, 200, []string{"sleep", "1000"}, true, false)
+	assert.NoError(err)
+	other, err := registerExecSession(testPodID, "other", 200, []string{"top"}, true, false)
+	assert.NoError(err)
+
+	assert.NotEqual(s1.ID, s2.ID)
+
+	_, err = registerExecSession(testPodID, testContainerID, 300, []string{"true"}, false, false)
+	assert.Error(err)
+
+	sessions, err := listExecSessions(testPodID, testContainerID)
+	assert.NoError(err)
+	assert.Len(sessions, 2)
+	assert.Equal([]string{"sleep", "1000"}, sessions[1].Args)
+	assert.Equal("running", sessions[1].status())
+
+	// the PID of the shim of s2 is reused
+	running[200] = 2001
+	assert.Equal("exited", s2.status())
+	assert.Error(killExecSession(testPodID, testContainerID, s2.ID, syscall.SIGKILL))
+
+	reaped, err := reapExecSessions(testPodID, testContainerID)
+	assert.NoError(err)
+	assert.Len(reaped, 1)
+	assert.Equal(s2.ID, reaped[0].ID)
+
+	assert.NoError(unregisterExecSession(testPodID, s1))
+
+	sessions, err = listExecSessions(testPodID, testContainerID)
+	assert.NoError(err)
+	assert.Empty(sessions)
+
+	// the sessions of the other containers are kept
+	sessions, err = listExecSessions(testPodID, "other")
+	assert.NoError(err)
+	assert.Len(sessions, 1)
+	assert.Equal(other.ID, sessions[0].ID)
+
+	assert.Error(killExecSession(testPodID, testContainerID, "unknown", syscall.SIGKILL))
+}
+
+func TestRegisterExecSessionConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "execs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedProcStartTime := procStartTime
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		procStartTime = savedProcStartTime
+	}()
+
+	runtimeStateDir = dir
+	procStartTime = func(pid int) (uint64, error) {
+		return uint64(pid), nil
+	}
+
+	// concurrent execs in the same pod all keep their session
+	const execs = 20
+
+	errs := make(chan error, execs)
+	for i := 0; i < execs; i++ {
+		go func(pid int) {
+			_, err := registerExecSession(testPodID, testContainerID, pid, []string{"true"}, false, false)
+			errs <- err
+		}(100 + i)
+	}
+
+	for i := 0; i < execs; i++ {
+		assert.NoError(<-errs)
+	}
+
+	sessions, err := listExecSessions(testPodID, testContainerID)
+	assert.NoError(err)
+	assert.Len(sessions, execs)
+}
+
+func TestKillExecSession(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "execs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	// stands for the shim of the session
+	cmd := exec.Command("sleep", "60")
+	assert.NoError(cmd.Start())
+
+	session, err := registerExecSession(testPodID, testContainerID, cmd.Process.Pid, []string{"sleep", "60"}, true, false)
+	assert.NoError(err)
+	assert.True(session.running())
+
+	assert.NoError(killExecSession(testPodID, testContainerID, session.ID, syscall.SIGTERM))
+
+	err = cmd.Wait()
+	assert.Error(err)
+	assert.Equal(syscall.SIGTERM, cmd.ProcessState.Sys().(syscall.WaitStatus).Signal())
+
+	assert.False(session.running())
+}
+
+func TestExecSessionsCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "execs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedOutputFile := defaultOutputFile
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		defaultOutputFile = savedOutputFile
+		testingImpl.ListPodFunc = nil
+	}()
+
+	runtimeStateDir = dir
+
+	output, err := ioutil.TempFile(dir, "output-")
+	assert.NoError(err)
+	defer output.Close()
+
+	defaultOutputFile = output
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, vc.State{}, vc.State{}, map[string]string{}), nil
+	}
+
+	// a session whose shim exited
+	assert.NoError(savePodState(testPodID, podState{Execs: []execSession{
+		{ID: "abc", ContainerID: testContainerID, PID: -1, Args: []string{"sh"}},
+	}}))
+
+	set := flag.NewFlagSet("", 0)
+	set.Bool("list", true, "")
+	set.Parse([]string{testContainerID})
+	execCLICommandFunc(assert, execCLICommand, set, false)
+
+	data, err := ioutil.ReadFile(output.Name())
+	assert.NoError(err)
+	assert.Contains(string(data), "abc")
+	assert.Contains(string(data), "exited")
+
+	set = flag.NewFlagSet("", 0)
+	set.String("kill", "abc", "")
+	set.String("signal", "SIGKILL", "")
+	set.Parse([]string{testContainerID})
+	execCLICommandFunc(assert, execCLICommand, set, true)
+
+	set = flag.NewFlagSet("", 0)
+	set.Bool("reap", true, "")
+	set.Parse([]string{testContainerID})
+	execCLICommandFunc(assert, execCLICommand, set, false)
+
+	sessions, err := listExecSessions(testPodID, testContainerID)
+	assert.NoError(err)
+	assert.Empty(sessions)
+
+	// missing container ID
+	set = flag.NewFlagSet("", 0)
+	set.Bool("list", true, "")
+	execCLICommandFunc(assert, execCLICommand, set, true)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// fingerprintFile is the file, below the runtime state directory,
+// recording the capabilities fingerprint of the node.
+const fingerprintFile = "fingerprint.json"
+
+// the fingerprint is read by unprivileged scheduling components.
+const fingerprintFileMode = os.FileMode(0644)
+
+// Classes of host devices which can be passed through to pods.
+const (
+	// Block devices hotplugged to the VM rather than shared over 9p.
+	passthroughBlock = "block"
+)
+
+// vhostVsockDevice is checked to determine whether the node can provide
+// vsock devices. It is a variable to allow tests to modify it.
+var vhostVsockDevice = "/dev/vhost-vsock"
+
+// fingerprint describes the capabilities of the pods the runtime can
+// create on the node, for the components placing pods on nodes.
+type fingerprint struct {
+	Runtime     string `json:"runtime"`
+	Hypervisor  string `json:"hypervisor"`
+	MachineType string `json:"machineType,omitempty"`
+
+	// Vsock is set if the host can provide vsock devices to VMs.
+	Vsock bool `json:"vsock"`
+
+	// Devices are the classes of host devices which can be passed
+	// through to pods.
+	Devices []string `json:"devices"`
+}
+
+// getFingerprint returns the capabilities fingerprint of the node for
+// the specified configuration.
+func getFingerprint(runtimeConfig oci.RuntimeConfig) fingerprint {
+	f := fingerprint{
+		Runtime:     version,
+		Hypervisor:  string(runtimeConfig.HypervisorType),
+		MachineType: runtimeConfig.HypervisorConfig.HypervisorMachineType,
+		Vsock:       fileExists(vhostVsockDevice),
+	}
+
+	if !runtimeConfig.HypervisorConfig.DisableBlockDeviceUse {
+		f.Devices = append(f.Devices, passthroughBlock)
+	}
+
+	return f
+}
+
+func fingerprintPath() string {
+	return filepath.Join(runtimeStateDir, fingerprintFile)
+}
+
+// saveFingerprint atomically replaces the fingerprint of the node.
+func saveFingerprint(f fingerprint) error {
+	bytes, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	path := fingerprintPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), podStateDirMode); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, bytes, fingerprintFileMode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// handleFingerprint records the fingerprint of the node and displays
+// it.
+func handleFingerprint(w io.Writer, metadata map[string]interface{}) error {
+	runtimeConfig, ok := metadata["runtimeConfig"].(oci.RuntimeConfig)
+	if !ok {
+		return errors.New("cannot determine runtime config")
+	}
+
+	f := getFingerprint(runtimeConfig)
+
+	if err := saveFingerprint(f); err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(f)
+}
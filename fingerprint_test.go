@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupFingerprintTest(t *testing.T, dir string) func() {
+	savedVsock := vhostVsockDevice
+
+	vhostVsockDevice = filepath.Join(dir, "vhost-vsock")
+
+	return func() {
+		vhostVsockDevice = savedVsock
+	}
+}
+
+func TestGetFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "fingerprint-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	defer setupFingerprintTest(t, dir)()
+
+	runtimeConfig := oci.RuntimeConfig{
+		HypervisorType: vc.QemuHypervisor,
+		HypervisorConfig: vc.HypervisorConfig{
+			HypervisorMachineType: "pc",
+			DisableBlockDeviceUse: true,
+		},
+	}
+
+	f := getFingerprint(runtimeConfig)
+	assert.Equal(version, f.Runtime)
+	assert.Equal("qemu", f.Hypervisor)
+	assert.Equal("pc", f.MachineType)
+	assert.False(f.Vsock)
+	assert.Empty(f.Devices)
+
+	assert.NoError(createEmptyFile(vhostVsockDevice))
+
+	runtimeConfig.HypervisorConfig.DisableBlockDeviceUse = false
+
+	f = getFingerprint(runtimeConfig)
+	assert.True(f.Vsock)
+	assert.Equal([]string{passthroughBlock}, f.Devices)
+}
+
+func TestHandleFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "fingerprint-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	defer setupFingerprintTest(t, dir)()
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+	runtimeStateDir = filepath.Join(dir, "state")
+
+	var b bytes.Buffer
+	assert.Error(handleFingerprint(&b, map[string]interface{}{}))
+
+	metadata := map[string]interface{}{
+		"runtimeConfig": oci.RuntimeConfig{HypervisorType: vc.QemuHypervisor},
+	}
+
+	assert.NoError(handleFingerprint(&b, metadata))
+
+	var displayed fingerprint
+	assert.NoError(json.Unmarshal(b.Bytes(), &displayed))
+	assert.Equal("qemu", displayed.Hypervisor)
+
+	contents, err := ioutil.ReadFile(filepath.Join(runtimeStateDir, fingerprintFile))
+	assert.NoError(err)
+
+	var recorded fingerprint
+	assert.NoError(json.Unmarshal(contents, &recorded))
+	assert.Equal(displayed, recorded)
+
+	info, err := os.Stat(filepath.Join(runtimeStateDir, fingerprintFile))
+	assert.NoError(err)
+	assert.Equal(fingerprintFileMode, info.Mode())
+}
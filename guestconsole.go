@@ -0,0 +1,300 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// consoleRingCommand is the hidden command keeping the recent
+	// output of the console of a guest.
+	consoleRingCommand = "cc-console-ring"
+
+	// guestConsoleFile is the file of the diagnostics directory of a
+	// pod the recent output of the guest console is dumped to.
+	guestConsoleFile = "console.log"
+
+	// virtcontainers serves the console of the guest on this socket.
+	guestConsoleSocket = "console.sock"
+
+	defaultConsoleRingSize = 64 * 1024
+	maxConsoleRingSize     = 16 * 1024 * 1024
+)
+
+// consoleConnectTimeout is how long the console reader waits for the
+// hypervisor to create the console socket. It is a variable to allow
+// tests to modify it.
+var consoleConnectTimeout = time.Minute
+
+// launchConsoleRing starts the console reader of the specified pod in a
+// new session, so that it outlives the runtime, and returns its PID. It
+// is a variable rather than a function to allow tests to modify it.
+var launchConsoleRing = func(podID string, size uint32) (int, error) {
+	cmd := exec.Command("/proc/self/exe", consoleRingCommand, "--size", strconv.FormatUint(uint64(size), 10),
+		filepath.Join(vcRunStoragePath, podID, guestConsoleSocket),
+		filepath.Join(runtimeOptions.CoreDump.podDir(podID), guestConsoleFile))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+
+	pid := cmd.Process.Pid
+
+	return pid, cmd.Process.Release()
+}
+
+// guestConsole describes how the output of the console of the guests is
+// kept, to diagnose guest kernel panics and hangs after the fact.
+//
+// A reader process keeps the last RingSize bytes of the console output
+// of each pod in memory, and dumps them to the diagnostics directory of
+// the pod when the VM dies or when the health checks find the pod
+// unhealthy.
+type guestConsole struct {
+	Disable bool `toml:"disable"`
+
+	// RingSize is the number of bytes of console output kept.
+	RingSize uint32 `toml:"ring_size"`
+}
+
+func (g guestConsole) ringSize() uint32 {
+	if g.RingSize == 0 {
+		return defaultConsoleRingSize
+	}
+
+	return g.RingSize
+}
+
+// validate checks the guest console settings.
+func (g guestConsole) validate() error {
+	if g.ringSize() > maxConsoleRingSize {
+		return fmt.Errorf("Invalid guest console ring_size %d: must be at most %d", g.RingSize, maxConsoleRingSize)
+	}
+
+	return nil
+}
+
+// start starts the console reader of the specified pod, before its VM
+// is created so that the boot messages are kept too.
+func (g guestConsole) start(podID string) error {
+	if g.Disable {
+		return nil
+	}
+
+	pid, err := launchConsoleRing(podID, g.ringSize())
+	if err != nil || pid <= 0 {
+		return err
+	}
+
+	start, err := procStartTime(pid)
+	if err != nil {
+		return err
+	}
+
+	return updatePodState(podID, func(state *podState) error {
+		state.ConsoleRingPID = pid
+		state.ConsoleRingStart = start
+		return nil
+	})
+}
+
+// signalConsoleRing sends a signal to the console reader of the
+// specified pod, if it still runs.
+func signalConsoleRing(podID string, sig syscall.Signal) error {
+	state, err := loadPodState(podID)
+	if err != nil || state.ConsoleRingPID <= 0 {
+		return err
+	}
+
+	// The PID may have been reused since the reader exited.
+	if start, err := procStartTime(state.ConsoleRingPID); err != nil || start != state.ConsoleRingStart {
+		return nil
+	}
+
+	if err := syscall.Kill(state.ConsoleRingPID, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	return nil
+}
+
+// stopConsoleRing stops the console reader of a pod being deleted,
+// without dumping the console output.
+func stopConsoleRing(podID string) error {
+	return signalConsoleRing(podID, syscall.SIGTERM)
+}
+
+// dumpConsoleRing makes the console reader of a pod dump the console
+// output.
+func dumpConsoleRing(podID string) error {
+	return signalConsoleRing(podID, syscall.SIGUSR1)
+}
+
+// ringBuffer keeps the last bytes written to it.
+type ringBuffer struct {
+	sync.Mutex
+	data []byte
+	size int
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	n := len(p)
+	if n > r.size {
+		p = p[n-r.size:]
+	}
+
+	if excess := len(r.data) + len(p) - r.size; excess > 0 {
+		r.data = r.data[:copy(r.data, r.data[excess:])]
+	}
+
+	r.data = append(r.data, p...)
+
+	return n, nil
+}
+
+// Bytes returns a copy of the bytes kept.
+func (r *ringBuffer) Bytes() []byte {
+	r.Lock()
+	defer r.Unlock()
+
+	return append([]byte(nil), r.data...)
+}
+
+// dump atomically replaces the specified file with the contents of the
+// ring, if any.
+func (r *ringBuffer) dump(path string) error {
+	data := r.Bytes()
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), diagnosticsDirMode); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, podStateFileMode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// connectConsole connects to the console socket of a guest, waiting
+// for the hypervisor to create it.
+func connectConsole(socket string) (net.Conn, error) {
+	deadline := time.Now().Add(consoleConnectTimeout)
+
+	for {
+		conn, err := net.Dial("unix", socket)
+		if err == nil || time.Now().After(deadline) {
+			return conn, err
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// runConsoleRing keeps the last output of the console of a guest in a
+// ring of the specified size, dumping it to output on SIGUSR1 and when
+// the console is closed, which means the VM died. It returns on SIGTERM,
+// sent when the pod is deleted, or once the console is closed.
+func runConsoleRing(socket, output string, size int, sigCh <-chan os.Signal) error {
+	conn, err := connectConsole(socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ring := newRingBuffer(size)
+
+	closed := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(ring, conn)
+		closed <- err
+	}()
+
+	for {
+		select {
+		case sig := <-sigCh:
+			if sig != syscall.SIGUSR1 {
+				return nil
+			}
+
+			if err := ring.dump(output); err != nil {
+				ccLog.Warnf("Unable to dump the guest console to %v: %v", output, err)
+			}
+		case err := <-closed:
+			if err != nil {
+				ccLog.Warnf("Unable to read the guest console %v: %v", socket, err)
+			}
+
+			return ring.dump(output)
+		}
+	}
+}
+
+var consoleRingCLICommand = cli.Command{
+	Name:      consoleRingCommand,
+	Hidden:    true,
+	Usage:     "keep the recent output of a guest console (internal)",
+	ArgsUsage: "<console-socket> <output-file>",
+	Flags: []cli.Flag{
+		cli.UintFlag{
+			Name:  "size",
+			Value: defaultConsoleRingSize,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 2 {
+			return errors.New("Expecting a console socket and an output file")
+		}
+
+		size := context.Uint("size")
+		if size == 0 || size > maxConsoleRingSize {
+			return fmt.Errorf("Invalid ring size %d", size)
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGTERM, syscall.SIGINT)
+		signal.Ignore(syscall.SIGHUP)
+
+		return runConsoleRing(context.Args()[0], context.Args()[1], int(size), sigCh)
+	},
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRingBuffer(8)
+	assert.Empty(r.Bytes())
+
+	n, err := r.Write([]byte("abc"))
+	assert.NoError(err)
+	assert.Equal(3, n)
+	assert.Equal("abc", string(r.Bytes()))
+
+	r.Write([]byte("defgh"))
+	assert.Equal("abcdefgh", string(r.Bytes()))
+
+	r.Write([]byte("ij"))
+	assert.Equal("cdefghij", string(r.Bytes()))
+
+	n, err = r.Write([]byte("0123456789"))
+	assert.NoError(err)
+	assert.Equal(10, n)
+	assert.Equal("23456789", string(r.Bytes()))
+}
+
+func TestGuestConsoleValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(guestConsole{}.validate())
+	assert.Equal(uint32(defaultConsoleRingSize), guestConsole{}.ringSize())
+	assert.NoError(guestConsole{RingSize: maxConsoleRingSize}.validate())
+	assert.Error(guestConsole{RingSize: maxConsoleRingSize + 1}.validate())
+}
+
+func TestRunConsoleRing(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "console-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "console.sock")
+	output := filepath.Join(dir, "diagnostics", guestConsoleFile)
+
+	savedTimeout := consoleConnectTimeout
+	defer func() {
+		consoleConnectTimeout = savedTimeout
+	}()
+	consoleConnectTimeout = 50 * time.Millisecond
+
+	// no console
+	assert.Error(runConsoleRing(socket, output, 4, nil))
+
+	l, err := net.Listen("unix", socket)
+	assert.NoError(err)
+	defer l.Close()
+
+	sigCh := make(chan os.Signal, 1)
+	result := make(chan error, 1)
+
+	go func() {
+		result <- runConsoleRing(socket, output, 4, sigCh)
+	}()
+
+	conn, err := l.Accept()
+	assert.NoError(err)
+
+	_, err = conn.Write([]byte("booting"))
+	assert.NoError(err)
+
+	// the output is dumped on request
+	var contents string
+	for i := 0; i < 100 && contents != "ting"; i++ {
+		sigCh <- syscall.SIGUSR1
+		time.Sleep(10 * time.Millisecond)
+		contents, _ = getFileContents(output)
+	}
+	assert.Equal("ting", contents)
+
+	_, err = conn.Write([]byte("panic"))
+	assert.NoError(err)
+
+	// and when the VM dies
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	assert.NoError(<-result)
+
+	contents, err = getFileContents(output)
+	assert.NoError(err)
+	assert.Equal("anic", contents)
+
+	// the pod is deleted
+	assert.NoError(os.Remove(output))
+
+	go func() {
+		result <- runConsoleRing(socket, output, 4, sigCh)
+	}()
+
+	conn, err = l.Accept()
+	assert.NoError(err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("shutdown"))
+	assert.NoError(err)
+
+	sigCh <- syscall.SIGTERM
+	assert.NoError(<-result)
+	assert.False(fileExists(output))
+}
+
+func TestGuestConsoleStartStop(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "console-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir, savedLaunch := runtimeStateDir, launchConsoleRing
+	defer func() {
+		runtimeStateDir, launchConsoleRing = savedRuntimeStateDir, savedLaunch
+	}()
+
+	runtimeStateDir = dir
+
+	var reader *exec.Cmd
+	launchConsoleRing = func(podID string, size uint32) (int, error) {
+		assert.Equal(uint32(1024), size)
+
+		reader = exec.Command("sleep", "10")
+		if err := reader.Start(); err != nil {
+			return -1, err
+		}
+
+		return reader.Process.Pid, nil
+	}
+
+	assert.NoError(guestConsole{Disable: true}.start(testPodID))
+	assert.Nil(reader)
+
+	// nothing to stop
+	assert.NoError(stopConsoleRing(testPodID))
+
+	assert.NoError(guestConsole{RingSize: 1024}.start(testPodID))
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(reader.Process.Pid, state.ConsoleRingPID)
+
+	assert.NoError(stopConsoleRing(testPodID))
+
+	err = reader.Wait()
+	assert.Error(err)
+	assert.Equal(syscall.SIGTERM, reader.ProcessState.Sys().(syscall.WaitStatus).Signal())
+
+	// the reader is gone
+	assert.NoError(dumpConsoleRing(testPodID))
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// handlerRE matches the valid handler names, which name the runtime
+// handler of a RuntimeClass.
+var handlerRE = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// handlerFromProgram returns the handler named by the program name: the
+// runtime installed, or linked, as "cc-runtime-<handler>" runs the
+// handler, as RuntimeClasses select runtimes by path.
+func handlerFromProgram(program string) string {
+	return strings.TrimPrefix(filepath.Base(program), name+"-")
+}
+
+// runtimeHandler returns the handler requested by the command-line, if
+// any. The global option takes precedence over the program name.
+func runtimeHandler(context *cli.Context, program string) (string, error) {
+	handler := context.GlobalString("cc-handler")
+	requested := handler != ""
+
+	if !requested && strings.HasPrefix(filepath.Base(program), name+"-") {
+		handler = handlerFromProgram(program)
+		requested = true
+	}
+
+	if requested && !handlerRE.MatchString(handler) {
+		return "", fmt.Errorf("Invalid runtime handler %q", handler)
+	}
+
+	return handler, nil
+}
+
+// handlerConfiguration returns the configuration file of the handler:
+// "configuration-<handler>.toml", next to the default configuration
+// file.
+func handlerConfiguration(handler string) string {
+	dir, file := filepath.Split(defaultRuntimeConfiguration)
+	ext := filepath.Ext(file)
+
+	return filepath.Join(dir, strings.TrimSuffix(file, ext)+"-"+handler+ext)
+}
+
+// runtimeConfigPath returns the configuration file to load: the one of
+// the command-line, else the one of the handler, else the default one
+// (empty). A handler without a configuration file is an error rather
+// than running it with the configuration of another hypervisor.
+func runtimeConfigPath(context *cli.Context, handler string) (string, error) {
+	if configPath := context.GlobalString("cc-config"); configPath != "" {
+		return configPath, nil
+	}
+
+	if handler == "" {
+		return "", nil
+	}
+
+	configPath := handlerConfiguration(handler)
+
+	if _, err := os.Stat(configPath); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("No configuration file %v for runtime handler %q", configPath, handler)
+		}
+
+		return "", err
+	}
+
+	return configPath, nil
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func newHandlerContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("", 0)
+	set.String("cc-config", "", "")
+	set.String("cc-handler", "", "")
+	assert.NoError(t, set.Parse(args))
+
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func TestRuntimeHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		args     []string
+		program  string
+		expected string
+	}{
+		{nil, "/usr/bin/cc-runtime", ""},
+		{nil, "cc-runtime", ""},
+		{nil, "/usr/bin/runc", ""},
+		{nil, "/usr/bin/cc-runtime-qemu-lite", "qemu-lite"},
+		{nil, "/usr/bin/cc-runtime-qemu/lite", ""},
+		{[]string{"--cc-handler", "fast"}, "/usr/bin/cc-runtime", "fast"},
+		{[]string{"--cc-handler", "fast"}, "/usr/bin/cc-runtime-qemu-lite", "fast"},
+	} {
+		handler, err := runtimeHandler(newHandlerContext(t, test.args...), test.program)
+		assert.NoError(err, "%+v", test)
+		assert.Equal(test.expected, handler, "%+v", test)
+	}
+
+	for _, test := range []struct {
+		args    []string
+		program string
+	}{
+		{[]string{"--cc-handler", "../qemu"}, "cc-runtime"},
+		{[]string{"--cc-handler", "Qemu"}, "cc-runtime"},
+		{nil, "/usr/bin/cc-runtime-"},
+		{nil, "/usr/bin/cc-runtime-Qemu"},
+	} {
+		_, err := runtimeHandler(newHandlerContext(t, test.args...), test.program)
+		assert.Error(err, "%+v", test)
+	}
+}
+
+func TestHandlerConfiguration(t *testing.T) {
+	assert := assert.New(t)
+
+	savedDefault := defaultRuntimeConfiguration
+	defer func() {
+		defaultRuntimeConfiguration = savedDefault
+	}()
+
+	defaultRuntimeConfiguration = "/etc/clear-containers/configuration.toml"
+	assert.Equal("/etc/clear-containers/configuration-qemu-lite.toml", handlerConfiguration("qemu-lite"))
+
+	defaultRuntimeConfiguration = "/etc/clear-containers/config"
+	assert.Equal("/etc/clear-containers/config-qemu-lite", handlerConfiguration("qemu-lite"))
+}
+
+func TestRuntimeConfigPath(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "handler-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedDefault := defaultRuntimeConfiguration
+	defer func() {
+		defaultRuntimeConfiguration = savedDefault
+	}()
+
+	defaultRuntimeConfiguration = filepath.Join(dir, "configuration.toml")
+
+	handlerConfig := filepath.Join(dir, "configuration-qemu-lite.toml")
+	assert.NoError(createEmptyFile(handlerConfig))
+
+	// default configuration
+	configPath, err := runtimeConfigPath(newHandlerContext(t), "")
+	assert.NoError(err)
+	assert.Equal("", configPath)
+
+	configPath, err = runtimeConfigPath(newHandlerContext(t), "qemu-lite")
+	assert.NoError(err)
+	assert.Equal(handlerConfig, configPath)
+
+	// the configuration option takes precedence
+	configPath, err = runtimeConfigPath(newHandlerContext(t, "--cc-config", "/etc/other.toml"), "qemu-lite")
+	assert.NoError(err)
+	assert.Equal("/etc/other.toml", configPath)
+
+	// no configuration for the handler
+	_, err = runtimeConfigPath(newHandlerContext(t), "qemu")
+	assert.Error(err)
+}
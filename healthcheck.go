@@ -0,0 +1,540 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	ciaoQemu "github.com/01org/ciao/qemu"
+	"github.com/clearcontainers/proxy/client"
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/hyperstart"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+// pod health states
+const (
+	healthUnknown   = "unknown"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+// health check event types
+const (
+	healthEventFailed    = "health-check-failed"
+	healthEventUnhealthy = "unhealthy"
+	healthEventRecovered = "recovered"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultHealthCheckRetries  = 3
+
+	// hypervisorControlSocket is the name of the QMP socket
+	// virtcontainers creates for each pod.
+	hypervisorControlSocket = "ctrl.sock"
+)
+
+// vcRunStoragePath is the directory below which virtcontainers keeps
+// the runtime files of each pod.
+var vcRunStoragePath = "/run/virtcontainers/pods"
+
+// podHealth is the result of the health checks of a pod.
+type podHealth struct {
+	// Status is one of healthHealthy or healthUnhealthy.
+	Status string `json:"status"`
+
+	// Failures is the number of consecutive failed checks.
+	Failures uint32 `json:"failures,omitempty"`
+
+	// CheckedAt is the time of the last check.
+	CheckedAt time.Time `json:"checkedAt"`
+
+	// LastError describes why the last check failed.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// healthEvent is emitted when a health check fails or when the health
+// of a pod changes.
+type healthEvent struct {
+	Type  string    `json:"type"`
+	PodID string    `json:"podID,omitempty"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// healthChecker checks that the hypervisor and the agent of pods are
+// responsive.
+type healthChecker struct {
+	proxyURL string
+	timeout  time.Duration
+
+	// proxy are the settings of the proxy, restarted when it does
+	// not answer if it has a restart command.
+	proxy proxy
+
+	// shimPath is the shim relaunched when the shim of a running
+	// container dies, and reaper, if not nil, records the exit of
+	// the relaunched shims.
+	shimPath string
+	reaper   *reaper
+
+	// retries is the number of consecutive failed checks after which
+	// a pod is considered unhealthy.
+	retries uint32
+}
+
+// checkHypervisor checks that the hypervisor of the specified pod
+// answers on its QMP control socket.
+var checkHypervisor = func(ctx context.Context, podID string) error {
+	path := filepath.Join(vcRunStoragePath, podID, hypervisorControlSocket)
+	disconnectedCh := make(chan struct{})
+
+	qmp, _, err := ciaoQemu.QMPStart(ctx, path, ciaoQemu.QMPConfig{}, disconnectedCh)
+	if err != nil {
+		return fmt.Errorf("hypervisor not responding: %v", err)
+	}
+
+	defer func() {
+		qmp.Shutdown()
+		<-disconnectedCh
+	}()
+
+	if err := qmp.ExecuteQMPCapabilities(ctx); err != nil {
+		return fmt.Errorf("hypervisor not responding: %v", err)
+	}
+
+	return nil
+}
+
+// pingAgent sends a ping to the agent of the specified pod through the
+// proxy.
+var pingAgent = func(ctx context.Context, proxyURL, podID string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "unix" {
+		return fmt.Errorf("Unsupported proxy URL %q", proxyURL)
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", u.Path)
+	if err != nil {
+		return fmt.Errorf("proxy not responding: %v", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	c := client.NewClient(conn)
+	defer c.Close()
+
+	if _, err := c.AttachVM(podID, nil); err != nil {
+		return fmt.Errorf("agent not responding: %v", err)
+	}
+
+	if _, err := c.Hyper(hyperstart.Ping, nil); err != nil {
+		return fmt.Errorf("agent not responding: %v", err)
+	}
+
+	return nil
+}
+
+// check checks the hypervisor, then the agent, of the specified pod.
+func (h healthChecker) check(podID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	if err := checkHypervisor(ctx, podID); err != nil {
+		return err
+	}
+
+	return pingAgent(ctx, h.proxyURL, podID)
+}
+
+// update records the result of a check in the pod state and returns the
+// events it caused.
+func (h healthChecker) update(podID string, checkErr error) ([]healthEvent, error) {
+	var events []healthEvent
+
+	err := updatePodState(podID, func(state *podState) error {
+		events = h.record(state, podID, checkErr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		// The guest may have panicked or hung.
+		if event.Type == healthEventUnhealthy {
+			if err := dumpConsoleRing(podID); err != nil {
+				ccLog.Warnf("Unable to dump the guest console of pod %v: %v", podID, err)
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// record updates the health of the pod in its state with the result of
+// a check, and returns the events it caused.
+func (h healthChecker) record(state *podState, podID string, checkErr error) []healthEvent {
+	health := podHealth{Status: healthHealthy}
+	if state.Health != nil {
+		health = *state.Health
+	}
+
+	now := timeNow()
+	health.CheckedAt = now
+
+	var events []healthEvent
+
+	if checkErr == nil {
+		if health.Status == healthUnhealthy {
+			events = append(events, healthEvent{Type: healthEventRecovered, PodID: podID, Time: now})
+		}
+
+		health.Status = healthHealthy
+		health.Failures = 0
+		health.LastError = ""
+	} else {
+		health.Failures++
+		health.LastError = checkErr.Error()
+
+		events = append(events, healthEvent{
+			Type:  healthEventFailed,
+			PodID: podID,
+			Time:  now,
+			Error: health.LastError,
+		})
+
+		if health.Failures >= h.retries && health.Status != healthUnhealthy {
+			health.Status = healthUnhealthy
+			events = append(events, healthEvent{
+				Type:  healthEventUnhealthy,
+				PodID: podID,
+				Time:  now,
+				Error: health.LastError,
+			})
+		}
+	}
+
+	state.Health = &health
+
+	return events
+}
+
+// checkProxy checks the proxy, restarting it if it does not answer and
+// it can be restarted, and returns the events this caused.
+func (h healthChecker) checkProxy() []healthEvent {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	checkErr := checkProxy(ctx, h.proxyURL)
+	if checkErr == nil {
+		return nil
+	}
+
+	events := []healthEvent{{Type: healthEventProxyFailed, Time: timeNow(), Error: checkErr.Error()}}
+
+	if len(h.proxy.RestartCommand) == 0 {
+		return events
+	}
+
+	if err := h.proxy.restart(h.proxyURL); err != nil {
+		ccLog.Warnf("Failed to restart the proxy: %v", err)
+		return events
+	}
+
+	// The pods registered with the previous instance of the proxy are
+	// unknown to the new one, and so fail their checks.
+	return append(events, healthEvent{Type: healthEventProxyRestarted, Time: timeNow()})
+}
+
+// logHealthEvent logs a health event and writes it as JSON.
+func logHealthEvent(encoder *json.Encoder, event healthEvent) error {
+	ccLog.WithFields(map[string]interface{}{
+		"event": event.Type,
+		"pod":   event.PodID,
+		"error": event.Error,
+	}).Warn("Pod health check")
+
+	return encoder.Encode(event)
+}
+
+// run checks the proxy, if any, and all the running pods once, writing
+// the resulting events to the specified writer as JSON, one per line.
+func (h healthChecker) run(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+
+	if h.proxyURL != "" {
+		for _, event := range h.checkProxy() {
+			if err := logHealthEvent(encoder, event); err != nil {
+				return err
+			}
+		}
+	}
+
+	podStatusList, err := vci.ListPod()
+	if err != nil {
+		return err
+	}
+
+	pods := make(map[string]bool)
+	for _, podStatus := range podStatusList {
+		pods[podStatus.ID] = true
+	}
+
+	reclaimed, err := reclaimPodNetNS(pods)
+	if err != nil {
+		return err
+	}
+
+	for _, podID := range reclaimed {
+		if err := logHealthEvent(encoder, healthEvent{Type: healthEventNetNSReclaimed, PodID: podID, Time: timeNow()}); err != nil {
+			return err
+		}
+	}
+
+	expired, err := expirePods(podStatusList)
+	if err != nil {
+		return err
+	}
+
+	deleted := make(map[string]bool)
+	for _, event := range expired {
+		if event.Error == "" {
+			deleted[event.PodID] = true
+		}
+
+		if err := logHealthEvent(encoder, event); err != nil {
+			return err
+		}
+	}
+
+	for _, podStatus := range podStatusList {
+		// Paused pods cannot answer.
+		if podStatus.State.State != vc.StateRunning || deleted[podStatus.ID] {
+			continue
+		}
+
+		checkErr := h.check(podStatus.ID)
+
+		events, err := h.update(podStatus.ID, checkErr)
+		if err != nil {
+			return err
+		}
+
+		events = append(events, h.checkShims(podStatus)...)
+
+		for _, event := range events {
+			if err := logHealthEvent(encoder, event); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkShims relaunches the dead shims of the running containers of a
+// pod, and returns the events this caused.
+func (h healthChecker) checkShims(podStatus vc.PodStatus) []healthEvent {
+	var events []healthEvent
+
+	for _, containerStatus := range podStatus.ContainersStatus {
+		if containerStatus.State.State != vc.StateRunning {
+			continue
+		}
+
+		s, err := relaunchShim(podStatus.ID, containerStatus.ID, h.shimPath, h.reaper)
+		if err != nil {
+			events = append(events, healthEvent{
+				Type:  healthEventFailed,
+				PodID: podStatus.ID,
+				Time:  timeNow(),
+				Error: err.Error(),
+			})
+		} else if s != nil {
+			events = append(events, healthEvent{
+				Type:  healthEventShimRelaunched,
+				PodID: podStatus.ID,
+				Time:  timeNow(),
+			})
+		}
+	}
+
+	return events
+}
+
+// getPodHealth returns the health status of the specified pod as
+// recorded by the last check.
+func getPodHealth(podID string) (string, error) {
+	state, err := loadPodState(podID)
+	if err != nil {
+		return "", err
+	}
+
+	if state.Health == nil {
+		return healthUnknown, nil
+	}
+
+	return state.Health.Status, nil
+}
+
+func newHealthChecker(runtimeConfig oci.RuntimeConfig) healthChecker {
+	h := healthChecker{
+		timeout: runtimeOptions.healthCheckTimeout(),
+		retries: runtimeOptions.healthCheckRetries(),
+		proxy:   proxyOptions,
+	}
+
+	if config, ok := runtimeConfig.ProxyConfig.(vc.CCProxyConfig); ok {
+		h.proxyURL = config.URL
+	}
+
+	if config, ok := runtimeConfig.ShimConfig.(vc.CCShimConfig); ok {
+		h.shimPath = config.Path
+	}
+
+	return h
+}
+
+var healthCLICommand = cli.Command{
+	Name:  "cc-health",
+	Usage: "check the health of pods",
+	ArgsUsage: `[<container-id>...]
+
+   Where "<container-id>" is the name of a container whose pod health
+   should be displayed.`,
+	Description: `The cc-health command checks that the hypervisor and the agent of
+   every running pod are responsive. A pod is considered unhealthy after
+   "health_check_retries" consecutive failed checks.
+
+   An event is written to stdout, as one JSON object per line, each time
+   a check fails and each time a pod becomes unhealthy or recovers, so
+   that node agents can restart broken pods proactively. The proxy is
+   checked too, and restarted if it does not answer and the proxy
+   configuration has a "restart_command".
+
+   The shim of a running container which died is relaunched, claiming
+   the IO session the proxy keeps for it: the terminal or the FIFOs and
+   files the container was created with are reopened, while pipes are
+   replaced by /dev/null. The exit of a relaunched shim is recorded in
+   the pod state, as its parent is not the container manager anymore.
+
+   The network namespaces the runtime still holds for deleted pods, such
+   as pods whose deletion failed, are released with the tap devices they
+   contain. Pods whose lifetime, set by the
+   "com.github.clearcontainers.runtime.ttl" annotation, expired are
+   deleted with an "expired" event. The checks run every
+   "health_check_interval" until the command is stopped.
+
+   When container IDs are specified, the result of the last check of
+   their pods is displayed instead.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "once",
+			Usage: "check the pods once and exit",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 0 {
+			return showPodHealth(context.Args())
+		}
+
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		h := newHealthChecker(runtimeConfig)
+
+		if context.Bool("once") {
+			return h.run(defaultOutputFile)
+		}
+
+		interval := runtimeOptions.healthCheckInterval()
+
+		// Record the exit of the relaunched shims.
+		h.reaper = newReaper()
+		h.reaper.start()
+		defer h.reaper.stop()
+
+		for {
+			if err := h.run(defaultOutputFile); err != nil {
+				ccLog.Warnf("Failed to check pods health: %v", err)
+			}
+
+			time.Sleep(interval)
+		}
+	},
+}
+
+// showPodHealth displays the health of the pods of the specified
+// containers.
+func showPodHealth(containerIDs []string) error {
+	type containerHealth struct {
+		ID     string     `json:"id"`
+		PodID  string     `json:"podID"`
+		Health *podHealth `json:"health"`
+	}
+
+	var result []containerHealth
+
+	for _, containerID := range containerIDs {
+		_, podID, err := getExistingContainerInfo(containerID)
+		if err != nil {
+			return err
+		}
+
+		state, err := loadPodState(podID)
+		if err != nil {
+			return err
+		}
+
+		result = append(result, containerHealth{
+			ID:     containerID,
+			PodID:  podID,
+			Health: state.Health,
+		})
+	}
+
+	bytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(defaultOutputFile, "%s\n", bytes)
+	return err
+}
@@ -0,0 +1,355 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// setupHealthTest creates a private state directory, a fake clock and
+// fake probes, returning a function to undo the changes.
+func setupHealthTest(t *testing.T, now time.Time, probeErr *error) func() {
+	dir, err := ioutil.TempDir(testDir, "health-")
+	assert.NoError(t, err)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedTimeNow := timeNow
+	savedCheckHypervisor := checkHypervisor
+	savedPingAgent := pingAgent
+
+	runtimeStateDir = dir
+	timeNow = func() time.Time {
+		return now
+	}
+
+	checkHypervisor = func(ctx context.Context, podID string) error {
+		return nil
+	}
+
+	pingAgent = func(ctx context.Context, proxyURL, podID string) error {
+		return *probeErr
+	}
+
+	return func() {
+		runtimeStateDir = savedRuntimeStateDir
+		timeNow = savedTimeNow
+		checkHypervisor = savedCheckHypervisor
+		pingAgent = savedPingAgent
+		testingImpl.ListPodFunc = nil
+		os.RemoveAll(dir)
+	}
+}
+
+func decodeHealthEvents(t *testing.T, buf *bytes.Buffer) []healthEvent {
+	var events []healthEvent
+
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var event healthEvent
+		assert.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestHealthCheckerUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	var probeErr error
+	now := time.Unix(10000, 0).UTC()
+	defer setupHealthTest(t, now, &probeErr)()
+
+	h := healthChecker{retries: 2}
+
+	status, err := getPodHealth(testPodID)
+	assert.NoError(err)
+	assert.Equal(healthUnknown, status)
+
+	events, err := h.update(testPodID, nil)
+	assert.NoError(err)
+	assert.Empty(events)
+
+	status, err = getPodHealth(testPodID)
+	assert.NoError(err)
+	assert.Equal(healthHealthy, status)
+
+	// first failure: still healthy
+	checkErr := errors.New("agent not responding")
+	events, err = h.update(testPodID, checkErr)
+	assert.NoError(err)
+	assert.Equal([]healthEvent{
+		{Type: healthEventFailed, PodID: testPodID, Time: now, Error: checkErr.Error()},
+	}, events)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(podHealth{
+		Status:    healthHealthy,
+		Failures:  1,
+		CheckedAt: now,
+		LastError: checkErr.Error(),
+	}, *state.Health)
+
+	// retries reached
+	events, err = h.update(testPodID, checkErr)
+	assert.NoError(err)
+	assert.Len(events, 2)
+	assert.Equal(healthEventUnhealthy, events[1].Type)
+
+	status, err = getPodHealth(testPodID)
+	assert.NoError(err)
+	assert.Equal(healthUnhealthy, status)
+
+	// the pod is only reported as unhealthy once
+	events, err = h.update(testPodID, checkErr)
+	assert.NoError(err)
+	assert.Len(events, 1)
+
+	events, err = h.update(testPodID, nil)
+	assert.NoError(err)
+	assert.Equal([]healthEvent{{Type: healthEventRecovered, PodID: testPodID, Time: now}}, events)
+
+	state, err = loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(podHealth{Status: healthHealthy, CheckedAt: now}, *state.Health)
+}
+
+func TestHealthCheckerRun(t *testing.T) {
+	assert := assert.New(t)
+
+	probeErr := errors.New("agent not responding")
+	now := time.Unix(10000, 0).UTC()
+	defer setupHealthTest(t, now, &probeErr)()
+
+	h := healthChecker{timeout: time.Second, retries: 1}
+	buf := &bytes.Buffer{}
+
+	// ListPod fails
+	err := h.run(buf)
+	assert.Error(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{ID: testPodID, State: vc.State{State: vc.StateRunning}},
+			{ID: "paused", State: vc.State{State: vc.StatePaused}},
+		}, nil
+	}
+
+	err = h.run(buf)
+	assert.NoError(err)
+
+	events := decodeHealthEvents(t, buf)
+	assert.Len(events, 2)
+
+	for _, event := range events {
+		assert.Equal(testPodID, event.PodID)
+	}
+
+	assert.Equal(healthEventFailed, events[0].Type)
+	assert.Equal(healthEventUnhealthy, events[1].Type)
+
+	// paused pods are not checked
+	status, err := getPodHealth("paused")
+	assert.NoError(err)
+	assert.Equal(healthUnknown, status)
+
+	probeErr = nil
+
+	err = h.run(buf)
+	assert.NoError(err)
+
+	events = decodeHealthEvents(t, buf)
+	assert.Len(events, 1)
+	assert.Equal(healthEventRecovered, events[0].Type)
+}
+
+func TestHealthCheckerRunReclaimNetNS(t *testing.T) {
+	assert := assert.New(t)
+
+	var probeErr error
+	now := time.Unix(10000, 0).UTC()
+	defer setupHealthTest(t, now, &probeErr)()
+
+	savedUnbind := unbindNetNS
+	defer func() {
+		unbindNetNS = savedUnbind
+	}()
+
+	unbindNetNS = func(target string) error {
+		return nil
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: testPodID, State: vc.State{State: vc.StateRunning}}}, nil
+	}
+
+	for _, podID := range []string{testPodID, "deleted"} {
+		assert.NoError(os.MkdirAll(filepath.Dir(podNetNSPath(podID)), testDirMode))
+		assert.NoError(createEmptyFile(podNetNSPath(podID)))
+	}
+
+	h := healthChecker{timeout: time.Second, retries: 1}
+	buf := &bytes.Buffer{}
+
+	assert.NoError(h.run(buf))
+
+	events := decodeHealthEvents(t, buf)
+	assert.Len(events, 1)
+	assert.Equal(healthEventNetNSReclaimed, events[0].Type)
+	assert.Equal("deleted", events[0].PodID)
+
+	assert.True(fileExists(podNetNSPath(testPodID)))
+	assert.False(fileExists(podNetNSPath("deleted")))
+}
+
+func TestHealthCheckHypervisor(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "health-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedVCRunStoragePath := vcRunStoragePath
+	defer func() {
+		vcRunStoragePath = savedVCRunStoragePath
+	}()
+
+	vcRunStoragePath = dir
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// no QMP socket
+	err = checkHypervisor(ctx, testPodID)
+	assert.Error(err)
+}
+
+func TestHealthPingAgent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "health-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, proxyURL := range []string{
+		"tcp://127.0.0.1:1234",
+		":foo",
+		"unix://" + filepath.Join(dir, "proxy.sock"),
+	} {
+		err = pingAgent(ctx, proxyURL, testPodID)
+		assert.Error(err, "%s", proxyURL)
+	}
+}
+
+func TestNewHealthChecker(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	savedProxyOptions := proxyOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+		proxyOptions = savedProxyOptions
+	}()
+
+	runtimeOptions = runtime{}
+	proxyOptions = proxy{}
+
+	h := newHealthChecker(oci.RuntimeConfig{})
+	assert.Equal(healthChecker{
+		timeout: defaultHealthCheckTimeout,
+		retries: defaultHealthCheckRetries,
+	}, h)
+
+	runtimeOptions.HealthCheckTimeout = "1s"
+	runtimeOptions.HealthCheckRetries = 5
+	proxyOptions.RestartCommand = []string{"/bin/true"}
+
+	h = newHealthChecker(oci.RuntimeConfig{
+		ProxyConfig: vc.CCProxyConfig{URL: "unix:///run/proxy.sock"},
+	})
+	assert.Equal(healthChecker{
+		proxyURL: "unix:///run/proxy.sock",
+		timeout:  time.Second,
+		retries:  5,
+		proxy:    proxy{RestartCommand: []string{"/bin/true"}},
+	}, h)
+}
+
+func TestHealthCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	probeErr := errors.New("agent not responding")
+	now := time.Unix(10000, 0).UTC()
+	defer setupHealthTest(t, now, &probeErr)()
+
+	outputFile, err := ioutil.TempFile(testDir, "health-")
+	assert.NoError(err)
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+
+	savedOutputFile := defaultOutputFile
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	defaultOutputFile = outputFile
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{ID: testPodID, State: vc.State{State: vc.StateRunning}},
+		}, nil
+	}
+
+	set := flag.NewFlagSet("", 0)
+	set.Bool("once", true, "")
+
+	app := cli.NewApp()
+	ctx := cli.NewContext(app, set, nil)
+
+	fn, ok := healthCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// no runtime config
+	err = fn(ctx)
+	assert.Error(err)
+
+	app.Metadata = map[string]interface{}{
+		"runtimeConfig": oci.RuntimeConfig{},
+	}
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	err = grep(`"type":"`+healthEventFailed+`"`, outputFile.Name())
+	assert.NoError(err)
+}
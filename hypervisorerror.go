@@ -0,0 +1,193 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// hypervisorLogFile is the file, in the diagnostics directory of a pod,
+// holding the error output of a hypervisor which failed to start.
+const hypervisorLogFile = "hypervisor.log"
+
+const hypervisorLogFileMode = os.FileMode(0640)
+
+// hypervisorOutputRE matches the lines QEMU writes to its standard
+// error, which are prefixed with the name of its binary.
+var hypervisorOutputRE = regexp.MustCompile(`(?m)^\S*qemu\S*: `)
+
+// Kinds of hypervisor failures.
+const (
+	hypervisorFailureGuestMemory = "guest-memory"
+	hypervisorFailureKVM         = "kvm"
+	hypervisorFailureVhostNet    = "vhost-net"
+	hypervisorFailureTap         = "tap"
+	hypervisorFailureImage       = "image"
+	hypervisorFailureImageLock   = "image-lock"
+	hypervisorFailureKernel      = "kernel"
+	hypervisorFailureUnknown     = "unknown"
+)
+
+// hypervisorFailure describes a known fatal error of the hypervisor.
+type hypervisorFailure struct {
+	kind    string
+	pattern *regexp.Regexp
+	hint    string
+}
+
+// hypervisorFailures lists the known fatal errors of the hypervisor, the
+// most specific first.
+var hypervisorFailures = []hypervisorFailure{
+	{
+		kind:    hypervisorFailureGuestMemory,
+		pattern: regexp.MustCompile(`(?i)cannot set up guest memory|cannot allocate memory|unable to map backing store`),
+		hint:    "the host lacks free memory or huge pages for the guest: lower default_memory or free memory on the host",
+	},
+	{
+		kind:    hypervisorFailureKVM,
+		pattern: regexp.MustCompile(`(?i)/dev/kvm|could not access kvm|failed to initialize kvm|kvm.*not supported`),
+		hint:    "KVM is not usable: load the kvm modules, check the permissions of /dev/kvm and run \"cc-runtime cc-check\"",
+	},
+	{
+		kind:    hypervisorFailureVhostNet,
+		pattern: regexp.MustCompile(`(?i)vhost[-_]?net`),
+		hint:    "vhost-net is not usable: load the vhost_net module or disable vhost in the network configuration",
+	},
+	{
+		kind:    hypervisorFailureTap,
+		pattern: regexp.MustCompile(`(?i)/dev/net/tun|could not configure tap|tap\S*: `),
+		hint:    "the tap device of the pod cannot be used: check the tun module and the network namespace of the pod",
+	},
+	{
+		kind:    hypervisorFailureImageLock,
+		pattern: regexp.MustCompile(`(?i)failed to get .*"write" lock`),
+		hint:    "another hypervisor uses the image read-write: share it read-only or give each pod its own copy",
+	},
+	{
+		kind:    hypervisorFailureImage,
+		pattern: regexp.MustCompile(`(?i)could not open .*image|could not open '`),
+		hint:    "the guest image cannot be opened: check the image path of the configuration file",
+	},
+	{
+		kind:    hypervisorFailureKernel,
+		pattern: regexp.MustCompile(`(?i)could not (load|open) kernel|linux kernel too old`),
+		hint:    "the guest kernel cannot be loaded: check the kernel path of the configuration file",
+	},
+}
+
+// hypervisorError is returned when the hypervisor of a pod fails to
+// start.
+type hypervisorError struct {
+	kind string
+
+	// message is the line of output describing the failure.
+	message string
+	hint    string
+
+	// log is the file holding the whole output, if it could be saved.
+	log string
+}
+
+func (e hypervisorError) Error() string {
+	msg := fmt.Sprintf("Hypervisor failed to start (%s): %s", e.kind, e.message)
+
+	if e.hint != "" {
+		msg += ": " + e.hint
+	}
+
+	if e.log != "" {
+		msg += fmt.Sprintf(" (see %v)", e.log)
+	}
+
+	return msg
+}
+
+func isHypervisorError(err error) bool {
+	_, ok := err.(hypervisorError)
+	return ok
+}
+
+// classifyHypervisorOutput returns the failure described by the error
+// output of the hypervisor.
+func classifyHypervisorOutput(output string) hypervisorError {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+
+	for _, f := range hypervisorFailures {
+		for _, line := range lines {
+			if f.pattern.MatchString(line) {
+				return hypervisorError{
+					kind:    f.kind,
+					message: strings.TrimSpace(line),
+					hint:    f.hint,
+				}
+			}
+		}
+	}
+
+	return hypervisorError{
+		kind:    hypervisorFailureUnknown,
+		message: strings.TrimSpace(lines[len(lines)-1]),
+	}
+}
+
+// saveHypervisorLog saves the error output of the hypervisor of a pod in
+// its diagnostics directory, and returns the path of the file.
+func saveHypervisorLog(podID, output string) (string, error) {
+	dir := runtimeOptions.CoreDump.podDir(podID)
+
+	if err := os.MkdirAll(dir, diagnosticsDirMode); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, hypervisorLogFile)
+
+	if err := ioutil.WriteFile(path, []byte(output), hypervisorLogFileMode); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// checkHypervisorFailure turns the failure to create a pod into a
+// hypervisorError if it carries the error output of the hypervisor,
+// which is then saved. Other errors are returned unchanged.
+func checkHypervisorFailure(podID string, err error) error {
+	output := err.Error()
+
+	if !hypervisorOutputRE.MatchString(output) {
+		return err
+	}
+
+	hypervisorErr := classifyHypervisorOutput(output)
+
+	path, saveErr := saveHypervisorLog(podID, output)
+	if saveErr != nil {
+		ccLog.Warnf("Unable to save the output of the hypervisor of pod %v: %v", podID, saveErr)
+	} else {
+		hypervisorErr.log = path
+	}
+
+	ccLog.WithFields(map[string]interface{}{
+		"pod":     podID,
+		"failure": hypervisorErr.kind,
+	}).Error(output)
+
+	return hypervisorErr
+}
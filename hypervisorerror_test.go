@@ -0,0 +1,124 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyHypervisorOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []struct {
+		output string
+		kind   string
+	}{
+		{"qemu-lite-system-x86_64: cannot set up guest memory 'pc.ram': Cannot allocate memory", hypervisorFailureGuestMemory},
+		{"Could not access KVM kernel module: Permission denied\nqemu-system-x86_64: failed to initialize KVM: Permission denied", hypervisorFailureKVM},
+		{"qemu-system-x86_64: -netdev tap,id=net0,vhost=on,vhostfds=3: vhost-net requested but could not be initialized", hypervisorFailureVhostNet},
+		{"qemu-system-x86_64: -netdev tap,id=net0: could not configure /dev/net/tun: Operation not permitted", hypervisorFailureTap},
+		{`qemu-system-x86_64: -drive file=/img: Failed to get "write" lock`, hypervisorFailureImageLock},
+		{"qemu-system-x86_64: -drive file=/img: Could not open '/img': No such file or directory", hypervisorFailureImage},
+		{"qemu-system-x86_64: could not load kernel '/vmlinux'", hypervisorFailureKernel},
+		{"qemu-system-x86_64: warning: host doesn't support requested feature\nqemu-system-x86_64: something new", hypervisorFailureUnknown},
+	}
+
+	for _, d := range data {
+		err := classifyHypervisorOutput(d.output)
+		assert.Equal(d.kind, err.kind, "%q", d.output)
+
+		if d.kind == hypervisorFailureUnknown {
+			assert.Equal("qemu-system-x86_64: something new", err.message)
+			assert.Empty(err.hint)
+		} else {
+			assert.NotEmpty(err.hint, "%q", d.output)
+		}
+	}
+
+	// the line describing the failure is reported
+	err := classifyHypervisorOutput("qemu: warning: TSC unstable\nqemu: cannot set up guest memory 'pc.ram'\n")
+	assert.Equal("qemu: cannot set up guest memory 'pc.ram'", err.message)
+}
+
+func TestHypervisorErrorString(t *testing.T) {
+	assert := assert.New(t)
+
+	err := hypervisorError{
+		kind:    hypervisorFailureKernel,
+		message: "qemu: could not load kernel",
+		hint:    "check the kernel",
+		log:     "/diag/pod/hypervisor.log",
+	}
+
+	assert.Equal("Hypervisor failed to start (kernel): qemu: could not load kernel: check the kernel (see /diag/pod/hypervisor.log)", err.Error())
+	assert.True(isHypervisorError(err))
+	assert.False(isHypervisorError(errors.New("qemu: could not load kernel")))
+
+	err.hint = ""
+	err.log = ""
+	assert.Equal("Hypervisor failed to start (kernel): qemu: could not load kernel", err.Error())
+}
+
+func TestCheckHypervisorFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "hypervisor-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedCoreDump := runtimeOptions.CoreDump
+	defer func() {
+		runtimeOptions.CoreDump = savedCoreDump
+	}()
+
+	runtimeOptions.CoreDump = coreDump{Dir: dir}
+
+	// not an output of the hypervisor
+	vcErr := errors.New("Proxy URL cannot be empty")
+	assert.Equal(vcErr, checkHypervisorFailure(testPodID, vcErr))
+	assert.False(fileExists(filepath.Join(dir, testPodID)))
+
+	output := "qemu-system-x86_64: cannot set up guest memory 'pc.ram': Cannot allocate memory\n"
+
+	err = checkHypervisorFailure(testPodID, errors.New(output))
+	assert.True(isHypervisorError(err))
+
+	path := filepath.Join(dir, testPodID, hypervisorLogFile)
+	assert.Equal(path, err.(hypervisorError).log)
+	assert.Equal(hypervisorFailureGuestMemory, err.(hypervisorError).kind)
+
+	contents, err := getFileContents(path)
+	assert.NoError(err)
+	assert.Equal(output, contents)
+
+	// kept with the diagnostics of the pod
+	files, err := coreFiles(filepath.Join(dir, testPodID))
+	assert.NoError(err)
+	assert.Len(files, 1)
+
+	// the classified error is returned even if the output cannot be
+	// saved
+	runtimeOptions.CoreDump = coreDump{Dir: path}
+
+	err = checkHypervisorFailure(testPodID, errors.New(output))
+	assert.True(isHypervisorError(err))
+	assert.Empty(err.(hypervisorError).log)
+}
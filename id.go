@@ -0,0 +1,52 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	ccruntime "github.com/clearcontainers/runtime/pkg/runtime"
+)
+
+// reservedIDs are the names of the files of the runtime state directory,
+// where the state of each pod is stored in a directory named after it.
+var reservedIDs = map[string]bool{
+	drainFile:        true,
+	daemonSocketName: true,
+}
+
+func isIDInUse(err error) bool {
+	return ccruntime.IsIDInUse(err)
+}
+
+// validateID checks the syntax of a container or pod ID. The kind of
+// ID is used in error messages.
+func validateID(kind, id string) error {
+	if err := ccruntime.ValidateID(kind, id); err != nil {
+		return err
+	}
+
+	if reservedIDs[id] {
+		return fmt.Errorf("Invalid %s ID %q: reserved name", kind, id)
+	}
+
+	return nil
+}
+
+// checkIDAvailable returns an IDInUseError if a container or a pod has
+// the specified ID.
+func checkIDAvailable(id string) error {
+	return ccruntime.CheckIDAvailable(vci, id)
+}
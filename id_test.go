@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	ccruntime "github.com/clearcontainers/runtime/pkg/runtime"
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateID(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, id := range []string{
+		testContainerID,
+		"a",
+		"_",
+		"f4f2a0b3c9e1d8",
+		"my-pod.v1+build_2",
+		strings.Repeat("a", ccruntime.MaxIDLength),
+	} {
+		assert.NoError(validateID("container", id), id)
+	}
+
+	for _, id := range []string{
+		"",
+		".",
+		"..",
+		".devices",
+		"-rm",
+		"a/b",
+		"../pod",
+		"a b",
+		"pod:1",
+		"drain.json",
+		"daemon.sock",
+		strings.Repeat("a", ccruntime.MaxIDLength+1),
+	} {
+		assert.Error(validateID("container", id), id)
+	}
+}
+
+func TestCheckIDAvailable(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: "pod1",
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: "pod1"},
+					{ID: "container1"},
+				},
+			},
+			{
+				// pod without containers
+				ID: "pod2",
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	err := checkIDAvailable("container1")
+	assert.True(isIDInUse(err))
+	assert.Equal(ccruntime.IDInUseError{ID: "container1", Owner: "container"}, err)
+
+	err = checkIDAvailable("pod1")
+	assert.True(isIDInUse(err))
+	assert.Equal(ccruntime.IDInUseError{ID: "pod1", Owner: "container"}, err)
+
+	err = checkIDAvailable("pod2")
+	assert.True(isIDInUse(err))
+	assert.Equal(ccruntime.IDInUseError{ID: "pod2", Owner: "pod"}, err)
+
+	// prefixes are not conflicts
+	assert.NoError(checkIDAvailable("container"))
+	assert.NoError(checkIDAvailable("container12"))
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return nil, errors.New("list failed")
+	}
+
+	err = checkIDAvailable("pod3")
+	assert.Error(err)
+	assert.False(isIDInUse(err))
+}
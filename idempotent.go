@@ -0,0 +1,287 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	ccruntime "github.com/clearcontainers/runtime/pkg/runtime"
+)
+
+// createMarkerDir is the directory below runtimeStateDir holding a
+// marker for each container being created, which names the process
+// creating it. The leading dot avoids clashes with pod IDs.
+const createMarkerDir = ".creating"
+
+func isNotFound(err error) bool {
+	return ccruntime.IsNotFound(err)
+}
+
+// processAlive returns true if the process exists. It is a variable
+// rather than a function to allow tests to modify it.
+var processAlive = func(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func createMarkerPath(containerID string) string {
+	return filepath.Join(runtimeStateDir, createMarkerDir, containerID)
+}
+
+// lockCreateMarkers takes the lock serializing the changes to the
+// creation markers with the other runtime instances. Closing the
+// returned file releases the lock.
+func lockCreateMarkers() (*os.File, error) {
+	dir := filepath.Join(runtimeStateDir, createMarkerDir)
+
+	if err := os.MkdirAll(dir, podStateDirMode); err != nil {
+		return nil, err
+	}
+
+	// The leading dot avoids clashes with container IDs.
+	lock, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_CREATE|os.O_RDWR, podStateFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// markCreating records that the current process is creating the
+// specified container. The marker is removed once the container is
+// created, or once its creation is rolled back: a marker left behind
+// means the runtime died while creating the container. A concurrent
+// create of the same ID fails with an IDInUseError rather than take
+// over the marker, and so does a create racing with one which created
+// the container since the ID was checked.
+func markCreating(containerID string) error {
+	lock, err := lockCreateMarkers()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	exists, alive, err := createMarkerOwner(containerID)
+	if err != nil {
+		return err
+	}
+
+	if alive {
+		return ccruntime.IDInUseError{ID: containerID, Owner: "container"}
+	}
+
+	// The creating process died after cleanStaleCreate looked for
+	// its marker: the lock guarantees no other create replaced it.
+	if exists {
+		if err := unmarkCreating(containerID); err != nil {
+			return err
+		}
+	}
+
+	path := createMarkerPath(containerID)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, podStateFileMode)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	// A create holding the marker before this one may have completed
+	// after the caller checked the ID was available.
+	if err == nil {
+		err = checkIDAvailable(containerID)
+	}
+
+	if err != nil {
+		os.Remove(path)
+	}
+
+	return err
+}
+
+// unmarkStaleCreate removes the creation marker of a container if the
+// process which wrote it died, but not if another create took it over
+// since.
+func unmarkStaleCreate(containerID string) error {
+	lock, err := lockCreateMarkers()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	stale, err := staleCreate(containerID)
+	if err != nil || !stale {
+		return err
+	}
+
+	return unmarkCreating(containerID)
+}
+
+// unmarkCreating removes the creation marker of a container.
+func unmarkCreating(containerID string) error {
+	if err := os.Remove(createMarkerPath(containerID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// createMarkerOwner returns whether the creation marker of a container
+// exists and, if so, whether the process which wrote it is alive.
+func createMarkerOwner(containerID string) (exists, alive bool, err error) {
+	contents, err := ioutil.ReadFile(createMarkerPath(containerID))
+	if os.IsNotExist(err) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil || pid <= 0 {
+		// Unreadable marker: the process which wrote it is gone.
+		return true, false, nil
+	}
+
+	return true, processAlive(pid), nil
+}
+
+// staleCreate returns true if a previous create of the container did
+// not complete because the process creating it died.
+func staleCreate(containerID string) (bool, error) {
+	exists, alive, err := createMarkerOwner(containerID)
+	return exists && !alive, err
+}
+
+// createInProgress returns true if a live process is creating the
+// container.
+func createInProgress(containerID string) (bool, error) {
+	_, alive, err := createMarkerOwner(containerID)
+	return alive, err
+}
+
+// cleanStaleCreate deletes what a previous create of the container left
+// behind if it did not complete, so that the create can be retried. It
+// does nothing if there was no such create.
+func cleanStaleCreate(ctx context.Context, containerID string) error {
+	stale, err := staleCreate(containerID)
+	if err != nil || !stale {
+		return err
+	}
+
+	ccLog.Warnf("Cleaning up incomplete creation of container %v", containerID)
+
+	if err := delete(ctx, containerID, true); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return unmarkStaleCreate(containerID)
+}
+
+// removeLeftovers removes what the runtime may have kept of a container
+// which does not exist (anymore), such as a container whose deletion
+// was interrupted. A container being created does not exist yet but
+// its files are not leftovers: an IDInUseError is returned instead.
+func removeLeftovers(containerID string) error {
+	inProgress, err := createInProgress(containerID)
+	if err != nil {
+		return err
+	}
+
+	if inProgress {
+		return ccruntime.IDInUseError{ID: containerID, Owner: "container"}
+	}
+
+	if err := runtimeOptions.ContainerLogs.remove(containerID); err != nil {
+		return err
+	}
+
+	if err := removeLifecycle(containerID); err != nil {
+		return err
+	}
+
+	if err := removeContainerShim(containerID); err != nil {
+		return err
+	}
+
+	if err := runtimeOptions.NetworkFS.remove(containerID); err != nil {
+		return err
+	}
+
+	if err := unpinMountSources(containerID); err != nil {
+		return err
+	}
+
+	if err := removeToolboxMount(containerID); err != nil {
+		return err
+	}
+
+	// The state of a pod still known to virtcontainers is not a
+	// leftover, even if the pod has no container of its ID.
+	if err := checkIDAvailable(containerID); err != nil {
+		if isIDInUse(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	state, err := loadPodState(containerID)
+	if err != nil {
+		return err
+	}
+
+	if state.SandboxVM != "" {
+		if _, err := leaveSandboxGroup(state.SandboxVM, containerID); err != nil {
+			return err
+		}
+	}
+
+	if err := stopConsoleRing(containerID); err != nil {
+		return err
+	}
+
+	if err := releaseResources(containerID); err != nil {
+		return err
+	}
+
+	if err := removePodNetNS(containerID); err != nil {
+		return err
+	}
+
+	if err := removeAgentSockets(containerID); err != nil {
+		return err
+	}
+
+	if err := runtimeOptions.CoreDump.remove(containerID); err != nil {
+		return err
+	}
+
+	return removePodState(containerID)
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupIdempotentTest(t *testing.T) func() {
+	dir, err := ioutil.TempDir(testDir, "idempotent-")
+	assert.NoError(t, err)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedProcessAlive := processAlive
+
+	runtimeStateDir = dir
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{}, nil
+	}
+
+	return func() {
+		runtimeStateDir = savedRuntimeStateDir
+		processAlive = savedProcessAlive
+		testingImpl.ListPodFunc = nil
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStaleCreate(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdempotentTest(t)()
+
+	// no create
+	stale, err := staleCreate(testContainerID)
+	assert.NoError(err)
+	assert.False(stale)
+
+	assert.NoError(markCreating(testContainerID))
+
+	// create in progress
+	processAlive = func(pid int) bool {
+		assert.Equal(os.Getpid(), pid)
+		return true
+	}
+
+	stale, err = staleCreate(testContainerID)
+	assert.NoError(err)
+	assert.False(stale)
+
+	// the creating process died
+	processAlive = func(pid int) bool {
+		return false
+	}
+
+	stale, err = staleCreate(testContainerID)
+	assert.NoError(err)
+	assert.True(stale)
+
+	// corrupted marker
+	assert.NoError(ioutil.WriteFile(createMarkerPath(testContainerID), []byte("garbage"), testFileMode))
+
+	stale, err = staleCreate(testContainerID)
+	assert.NoError(err)
+	assert.True(stale)
+
+	// created
+	assert.NoError(unmarkCreating(testContainerID))
+	assert.NoError(unmarkCreating(testContainerID))
+
+	stale, err = staleCreate(testContainerID)
+	assert.NoError(err)
+	assert.False(stale)
+}
+
+func TestMarkCreatingInUse(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdempotentTest(t)()
+
+	assert.NoError(markCreating(testContainerID))
+
+	// a concurrent create must not take over the marker
+	processAlive = func(pid int) bool {
+		return true
+	}
+
+	err := markCreating(testContainerID)
+	assert.Error(err)
+	assert.True(isIDInUse(err))
+
+	err = removeLeftovers(testContainerID)
+	assert.Error(err)
+	assert.True(isIDInUse(err))
+	assert.True(fileExists(createMarkerPath(testContainerID)))
+
+	// the creating process died
+	processAlive = func(pid int) bool {
+		return false
+	}
+
+	assert.NoError(markCreating(testContainerID))
+	assert.NoError(removeLeftovers(testContainerID))
+}
+
+func TestMarkCreatingStaleRace(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdempotentTest(t)()
+
+	assert.NoError(os.MkdirAll(filepath.Dir(createMarkerPath(testContainerID)), testDirMode))
+	assert.NoError(ioutil.WriteFile(createMarkerPath(testContainerID), []byte("999999"), testFileMode))
+
+	processAlive = func(pid int) bool {
+		return pid == os.Getpid()
+	}
+
+	// Only one of the creates retrying at once takes over the stale
+	// marker, the others find it taken.
+	const creates = 8
+
+	errs := make(chan error, creates)
+	for i := 0; i < creates; i++ {
+		go func() {
+			errs <- markCreating(testContainerID)
+		}()
+	}
+
+	marked := 0
+	for i := 0; i < creates; i++ {
+		err := <-errs
+		if err == nil {
+			marked++
+		} else {
+			assert.True(isIDInUse(err))
+		}
+	}
+
+	assert.Equal(1, marked)
+
+	// a late cleanup must not remove the marker taken over
+	assert.NoError(unmarkStaleCreate(testContainerID))
+	assert.True(fileExists(createMarkerPath(testContainerID)))
+}
+
+func TestMarkCreatingCreated(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdempotentTest(t)()
+
+	// Another create held the marker when the ID was checked, and
+	// created the container before this create took the marker.
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: testContainerID},
+				},
+			},
+		}, nil
+	}
+
+	err := markCreating(testContainerID)
+	assert.Error(err)
+	assert.True(isIDInUse(err))
+	assert.False(fileExists(createMarkerPath(testContainerID)))
+}
+
+func TestCleanStaleCreate(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdempotentTest(t)()
+
+	processAlive = func(pid int) bool {
+		return false
+	}
+
+	assert.NoError(markCreating(testContainerID))
+	assert.NoError(recordCreated(testContainerID, ""))
+	assert.NoError(savePodState(testContainerID, podState{}))
+
+	assert.NoError(cleanStaleCreate(context.Background(), testContainerID))
+
+	assert.False(fileExists(createMarkerPath(testContainerID)))
+	assert.False(fileExists(lifecyclePath(testContainerID)))
+	assert.False(fileExists(podStateDir(testContainerID)))
+
+	// nothing left to clean
+	assert.NoError(cleanStaleCreate(context.Background(), testContainerID))
+}
+
+func TestRemoveLeftoversPodInUse(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdempotentTest(t)()
+
+	// a pod whose containers were all deleted
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: testPodID}}, nil
+	}
+
+	assert.NoError(recordCreated(testPodID, ""))
+	assert.NoError(savePodState(testPodID, podState{}))
+
+	assert.NoError(removeLeftovers(testPodID))
+
+	assert.False(fileExists(lifecyclePath(testPodID)))
+	assert.True(fileExists(podStateDir(testPodID)))
+}
+
+func TestRemoveLeftoversSandboxGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdempotentTest(t)()
+
+	assert.NoError(savePodState("vm", podState{SandboxGroup: "web", GroupPods: []string{"vm", "pod2"}}))
+	assert.NoError(savePodState("pod2", podState{SandboxVM: "vm"}))
+
+	assert.NoError(removeLeftovers("pod2"))
+
+	state, err := loadPodState("vm")
+	assert.NoError(err)
+	assert.Equal([]string{"vm"}, state.GroupPods)
+	assert.False(fileExists(podStateDir("pod2")))
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/urfave/cli"
+)
+
+// timeNow is the function used to obtain the current time (for testing).
+var timeNow = time.Now
+
+var idlePauseCLICommand = cli.Command{
+	Name:  "cc-idle-pause",
+	Usage: "pause idle pods",
+	ArgsUsage: `[<container-id>...]
+
+   Where "<container-id>" is the name of a container whose pod should be
+   paused.`,
+	Description: `The cc-idle-pause command pauses pods to release the host CPU they use.
+   A pod paused by this command is resumed transparently the next time
+   one of its containers is started, a process is executed in it, or a
+   signal is sent to it. Network traffic does not resume it: the runtime
+   is not running while the pod is paused, so connections to a paused
+   pod hang until one of these commands or "resume" is run.
+
+   When "--idle" is specified, all pods which have not been used for
+   longer than the "idle_pause_timeout" configuration option are
+   paused. This is designed to be run periodically, for example from a
+   systemd timer.
+
+   The virtual CPUs are stopped, but the hypervisor keeps running and the
+   pod memory is not released. The VM cannot be saved to disk and the
+   hypervisor stopped: virtcontainers launches the hypervisor itself and
+   cannot start it again from a saved state.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "idle",
+			Usage: "pause all idle pods",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.Bool("idle") {
+			if context.NArg() != 0 {
+				return errors.New("Cannot specify container IDs with --idle")
+			}
+
+			return pauseIdlePods(runtimeOptions.idlePauseTimeout())
+		}
+
+		if context.NArg() == 0 {
+			return errors.New("Missing container ID")
+		}
+
+		for _, containerID := range context.Args() {
+			status, podID, err := getExistingContainerInfo(containerID)
+			if err != nil {
+				return err
+			}
+
+			if status.State.State != vc.StateRunning {
+				return fmt.Errorf("Container %s is not running", status.ID)
+			}
+
+			if err := idlePausePod(podID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+// idlePausePod pauses the specified pod and records that the runtime, not
+// the user, paused it so that it can be resumed on demand.
+func idlePausePod(podID string) error {
+	return updatePodState(podID, func(state *podState) error {
+		if state.IdlePaused {
+			return nil
+		}
+
+		if _, err := vci.PausePod(podID); err != nil {
+			return err
+		}
+
+		state.IdlePaused = true
+		state.IdlePausedAt = timeNow()
+
+		ccLog.Infof("Paused idle pod %s", podID)
+
+		return nil
+	})
+}
+
+// pauseIdlePods pauses all running pods that have not been used for
+// longer than the specified timeout.
+func pauseIdlePods(timeout time.Duration) error {
+	if timeout == 0 {
+		return errors.New("Pausing idle pods is not enabled in the configuration file")
+	}
+
+	podStatusList, err := vci.ListPod()
+	if err != nil {
+		return err
+	}
+
+	now := timeNow()
+
+	for _, podStatus := range podStatusList {
+		if podStatus.State.State != vc.StateRunning {
+			continue
+		}
+
+		idle := false
+
+		err := updatePodState(podStatus.ID, func(state *podState) error {
+			if state.LastActivity.IsZero() {
+				// Activity not recorded yet: start the idle
+				// period now.
+				state.LastActivity = now
+			}
+
+			idle = now.Sub(state.LastActivity) >= timeout
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if !idle {
+			continue
+		}
+
+		if err := idlePausePod(podStatus.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resumeIdlePausedPod resumes the specified pod if it was paused by
+// the runtime and records the activity that caused the pod to be
+// needed. It returns true if the pod had to be resumed.
+func resumeIdlePausedPod(podID string) (bool, error) {
+	resumed := false
+
+	err := updatePodState(podID, func(state *podState) error {
+		if state.IdlePaused {
+			if _, err := vci.ResumePod(podID); err != nil {
+				return err
+			}
+
+			ccLog.Infof("Resumed idle pod %s", podID)
+
+			state.IdlePaused = false
+			state.IdlePausedAt = time.Time{}
+			resumed = true
+		}
+
+		state.LastActivity = timeNow()
+		return nil
+	})
+
+	return resumed, err
+}
+
+// wakeContainer ensures the pod of the specified container is not
+// paused because it was idle, returning the up to date container status.
+func wakeContainer(status vc.ContainerStatus, podID string) (vc.ContainerStatus, error) {
+	resumed, err := resumeIdlePausedPod(podID)
+	if err != nil {
+		return vc.ContainerStatus{}, err
+	}
+
+	if !resumed {
+		return status, nil
+	}
+
+	status, _, err = getExistingContainerInfo(status.ID)
+	return status, err
+}
+
+// clearPodIdlePaused records that the specified pod is no longer
+// paused because it was idle, since it was resumed explicitly by the user.
+func clearPodIdlePaused(podID string) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.IdlePaused = false
+		state.IdlePausedAt = time.Time{}
+		return nil
+	})
+}
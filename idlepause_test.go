@@ -0,0 +1,271 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// setupIdlePauseTest creates a private state directory and a fake clock,
+// returning a function to undo the changes.
+func setupIdlePauseTest(t *testing.T, now time.Time) func() {
+	dir, err := ioutil.TempDir(testDir, "idlepause-")
+	assert.NoError(t, err)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedTimeNow := timeNow
+
+	runtimeStateDir = dir
+	timeNow = func() time.Time {
+		return now
+	}
+
+	return func() {
+		runtimeStateDir = savedRuntimeStateDir
+		timeNow = savedTimeNow
+		testingImpl.ListPodFunc = nil
+		testingImpl.PausePodFunc = nil
+		testingImpl.ResumePodFunc = nil
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIdlePausePod(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	// PausePod fails
+	err := idlePausePod(testPodID)
+	assert.Error(err)
+
+	paused := 0
+	testingImpl.PausePodFunc = func(podID string) (vc.VCPod, error) {
+		paused++
+		return &vcMock.Pod{}, nil
+	}
+
+	err = idlePausePod(testPodID)
+	assert.NoError(err)
+	assert.Equal(1, paused)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.True(state.IdlePaused)
+	assert.Equal(now, state.IdlePausedAt)
+
+	// already paused
+	err = idlePausePod(testPodID)
+	assert.NoError(err)
+	assert.Equal(1, paused)
+}
+
+func TestPauseIdlePods(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	// not enabled
+	err := pauseIdlePods(0)
+	assert.Error(err)
+
+	// ListPod fails
+	err = pauseIdlePods(time.Minute)
+	assert.Error(err)
+
+	running := vc.State{State: vc.StateRunning}
+	ready := vc.State{State: vc.StateReady}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{ID: "idle", State: running},
+			{ID: "busy", State: running},
+			{ID: "unknown", State: running},
+			{ID: "ready", State: ready},
+		}, nil
+	}
+
+	var pausedPods []string
+	testingImpl.PausePodFunc = func(podID string) (vc.VCPod, error) {
+		pausedPods = append(pausedPods, podID)
+		return &vcMock.Pod{}, nil
+	}
+
+	err = savePodState("idle", podState{LastActivity: now.Add(-time.Hour)})
+	assert.NoError(err)
+	err = savePodState("busy", podState{LastActivity: now.Add(-time.Second)})
+	assert.NoError(err)
+	err = savePodState("ready", podState{LastActivity: now.Add(-time.Hour)})
+	assert.NoError(err)
+
+	err = pauseIdlePods(time.Minute)
+	assert.NoError(err)
+	assert.Equal([]string{"idle"}, pausedPods)
+
+	// the idle period of pods without recorded activity starts now
+	state, err := loadPodState("unknown")
+	assert.NoError(err)
+	assert.False(state.IdlePaused)
+	assert.Equal(now, state.LastActivity)
+}
+
+func TestResumeIdlePausedPod(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	// pod not paused: only the activity is recorded
+	resumed, err := resumeIdlePausedPod(testPodID)
+	assert.NoError(err)
+	assert.False(resumed)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(podState{LastActivity: now}, state)
+
+	err = savePodState(testPodID, podState{IdlePaused: true, IdlePausedAt: now})
+	assert.NoError(err)
+
+	// ResumePod fails
+	_, err = resumeIdlePausedPod(testPodID)
+	assert.Error(err)
+
+	testingImpl.ResumePodFunc = testResumePodFuncReturnNil
+
+	resumed, err = resumeIdlePausedPod(testPodID)
+	assert.NoError(err)
+	assert.True(resumed)
+
+	state, err = loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(podState{LastActivity: now}, state)
+}
+
+func TestWakeContainer(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	paused := vc.State{State: vc.StatePaused}
+	running := vc.State{State: vc.StateRunning}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, running, running, map[string]string{}), nil
+	}
+	testingImpl.ResumePodFunc = testResumePodFuncReturnNil
+
+	status := vc.ContainerStatus{ID: testContainerID, State: paused}
+
+	// paused by the user: not resumed
+	newStatus, err := wakeContainer(status, testPodID)
+	assert.NoError(err)
+	assert.Equal(status, newStatus)
+
+	err = savePodState(testPodID, podState{IdlePaused: true, IdlePausedAt: now})
+	assert.NoError(err)
+
+	newStatus, err = wakeContainer(status, testPodID)
+	assert.NoError(err)
+	assert.Equal(vc.StateRunning, newStatus.State.State)
+}
+
+func TestClearPodIdlePaused(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	err := clearPodIdlePaused(testPodID)
+	assert.NoError(err)
+
+	err = savePodState(testPodID, podState{IdlePaused: true, IdlePausedAt: now, LastActivity: now})
+	assert.NoError(err)
+
+	err = clearPodIdlePaused(testPodID)
+	assert.NoError(err)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(podState{LastActivity: now}, state)
+}
+
+func TestIdlePauseCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	fn, ok := idlePauseCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	running := vc.State{State: vc.StateRunning}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, running, running, map[string]string{}), nil
+	}
+	testingImpl.PausePodFunc = testPausePodFuncReturnNil
+
+	// no container ID
+	set := flag.NewFlagSet("", 0)
+	set.Bool("idle", false, "")
+	err := fn(cli.NewContext(cli.NewApp(), set, nil))
+	assert.Error(err)
+
+	set = flag.NewFlagSet("", 0)
+	set.Bool("idle", false, "")
+	set.Parse([]string{testContainerID})
+	err = fn(cli.NewContext(cli.NewApp(), set, nil))
+	assert.NoError(err)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.True(state.IdlePaused)
+
+	// container IDs cannot be combined with --idle
+	set = flag.NewFlagSet("", 0)
+	set.Bool("idle", false, "")
+	set.Parse([]string{"--idle", testContainerID})
+	err = fn(cli.NewContext(cli.NewApp(), set, nil))
+	assert.Error(err)
+
+	// idle pausing not enabled
+	set = flag.NewFlagSet("", 0)
+	set.Bool("idle", false, "")
+	set.Parse([]string{"--idle"})
+	err = fn(cli.NewContext(cli.NewApp(), set, nil))
+	assert.Error(err)
+
+	runtimeOptions.IdlePauseTimeout = "1m"
+	err = fn(cli.NewContext(cli.NewApp(), set, nil))
+	assert.NoError(err)
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+const (
+	criCRIO       = "crio"
+	criContainerd = "containerd"
+
+	defaultRuntimeHandler = "cc"
+
+	// the CRI configuration is not secret.
+	installFileMode = os.FileMode(0644)
+)
+
+// runtimeHandlerRE matches a valid RuntimeClass handler: a DNS label.
+var runtimeHandlerRE = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// criSnippetTemplates are the configuration snippets registering the
+// runtime as a handler of each CRI implementation.
+var criSnippetTemplates = map[string]string{
+	criCRIO: `# CRI-O runtime handler for {{.Name}}
+[crio.runtime.runtimes.{{.Handler}}]
+runtime_path = "{{.RuntimePath}}"
+runtime_type = "oci"
+`,
+	criContainerd: `# containerd CRI runtime handler for {{.Name}}
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.{{.Handler}}]
+  runtime_type = "io.containerd.runc.v1"
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.{{.Handler}}.options]
+    BinaryName = "{{.RuntimePath}}"
+`,
+}
+
+// criDropInNames are the names of the drop-in files holding the
+// snippets. CRI-O reads every file of /etc/crio/crio.conf.d, containerd
+// the files listed by the "imports" setting of its configuration.
+var criDropInNames = map[string]string{
+	criCRIO:       "50-{{.Handler}}.conf",
+	criContainerd: "{{.Handler}}.toml",
+}
+
+const runtimeClassTemplate = `# Kubernetes RuntimeClass selecting {{.Name}}
+apiVersion: node.k8s.io/v1
+kind: RuntimeClass
+metadata:
+  name: {{.Handler}}
+handler: {{.Handler}}
+`
+
+// installInfo describes how the runtime is registered.
+type installInfo struct {
+	Name        string
+	Handler     string
+	RuntimePath string
+}
+
+// expandInstallTemplate returns the specified template expanded for
+// the registration.
+func expandInstallTemplate(text string, info installInfo) (string, error) {
+	tmpl, err := template.New("install").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, info); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// checkInstall checks the runtime can be registered: the CRI must be
+// supported and the handler valid, and the CRI must find the runtime,
+// its configuration and the components it refers to. As the CRI runs
+// the runtime without global options, the configuration must be the
+// default one.
+func checkInstall(cri string, info installInfo, configFile string, runtimeConfig oci.RuntimeConfig) error {
+	if _, ok := criSnippetTemplates[cri]; !ok {
+		return fmt.Errorf("Unsupported CRI %q (supported: %s, %s)", cri, criCRIO, criContainerd)
+	}
+
+	if !runtimeHandlerRE.MatchString(info.Handler) {
+		return fmt.Errorf("Invalid runtime handler %q: expecting a DNS label", info.Handler)
+	}
+
+	if !filepath.IsAbs(info.RuntimePath) {
+		return fmt.Errorf("Runtime path %q is not absolute", info.RuntimePath)
+	}
+
+	if _, err := resolvePath(info.RuntimePath); err != nil {
+		return fmt.Errorf("Invalid runtime path %q: %v", info.RuntimePath, err)
+	}
+
+	defaultConfig, err := resolvePath(defaultRuntimeConfiguration)
+	if err != nil || defaultConfig != configFile {
+		return fmt.Errorf("Configuration %v is not the default configuration %v used when the CRI runs the runtime",
+			configFile, defaultRuntimeConfiguration)
+	}
+
+	if _, err := getHypervisorDetails(runtimeConfig); err != nil {
+		return err
+	}
+
+	shimConfig, ok := runtimeConfig.ShimConfig.(vc.CCShimConfig)
+	if !ok {
+		return errors.New("cannot determine shim config")
+	}
+
+	if _, err := resolvePath(shimConfig.Path); err != nil {
+		return fmt.Errorf("Invalid shim path %q: %v", shimConfig.Path, err)
+	}
+
+	return nil
+}
+
+// writeInstall writes the configuration registering the runtime with
+// the CRI: the snippet declaring the runtime handler, to the drop-in
+// directory if specified, and the RuntimeClass selecting it.
+func writeInstall(w io.Writer, cri, dropInDir string, info installInfo) error {
+	snippet, err := expandInstallTemplate(criSnippetTemplates[cri], info)
+	if err != nil {
+		return err
+	}
+
+	if dropInDir != "" {
+		name, err := expandInstallTemplate(criDropInNames[cri], info)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dropInDir, name)
+		tmp := path + ".tmp"
+
+		if err := ioutil.WriteFile(tmp, []byte(snippet), installFileMode); err != nil {
+			return err
+		}
+
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+
+		snippet = fmt.Sprintf("# Runtime handler written to %s\n", path)
+	}
+
+	runtimeClass, err := expandInstallTemplate(runtimeClassTemplate, info)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n%s", snippet, runtimeClass)
+	return err
+}
+
+var installCLICommand = cli.Command{
+	Name:    "cc-install",
+	Aliases: []string{"install"},
+	Usage:   "generate the configuration registering the runtime with a CRI",
+	Description: `The cc-install command checks the runtime can be used by a Container
+   Runtime Interface (CRI) implementation, CRI-O or containerd, and writes
+   the configuration snippet declaring the runtime handler and the
+   Kubernetes RuntimeClass selecting it.
+
+   The CRI runs the runtime without global options, so the runtime must
+   use the default configuration, whose hypervisor, kernel, image and
+   shim must exist. With --drop-in, the snippet is written to a file of
+   the specified directory, such as /etc/crio/crio.conf.d, rather than
+   displayed.
+
+EXAMPLE:
+       # ` + name + ` cc-install --cri crio --drop-in /etc/crio/crio.conf.d | kubectl apply -f -`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "cri",
+			Usage: "CRI implementation: crio or containerd",
+		},
+		cli.StringFlag{
+			Name:  "handler",
+			Value: defaultRuntimeHandler,
+			Usage: "name of the runtime handler and RuntimeClass",
+		},
+		cli.StringFlag{
+			Name:  "runtime-path",
+			Usage: "path of the runtime run by the CRI (default: this runtime)",
+		},
+		cli.StringFlag{
+			Name:  "drop-in",
+			Usage: "directory to write the runtime handler configuration to",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		configFile, ok := context.App.Metadata["configFile"].(string)
+		if !ok {
+			return errors.New("cannot determine config file")
+		}
+
+		info := installInfo{
+			Name:        name,
+			Handler:     context.String("handler"),
+			RuntimePath: context.String("runtime-path"),
+		}
+
+		if info.RuntimePath == "" {
+			path, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			info.RuntimePath = path
+		}
+
+		cri := context.String("cri")
+		if err := checkInstall(cri, info, configFile, runtimeConfig); err != nil {
+			return err
+		}
+
+		return writeInstall(defaultOutputFile, cri, context.String("drop-in"), info)
+	},
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckInstall(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	savedDefault := defaultRuntimeConfiguration
+	defer func() {
+		defaultRuntimeConfiguration = savedDefault
+	}()
+	defaultRuntimeConfiguration = config.ConfigPathLink
+
+	runtimePath := filepath.Join(tmpdir, "runtime")
+	assert.NoError(createEmptyFile(runtimePath))
+
+	info := installInfo{Name: name, Handler: "cc", RuntimePath: runtimePath}
+
+	assert.NoError(checkInstall(criCRIO, info, config.ConfigPath, config.RuntimeConfig))
+	assert.NoError(checkInstall(criContainerd, info, config.ConfigPath, config.RuntimeConfig))
+
+	assert.Error(checkInstall("docker", info, config.ConfigPath, config.RuntimeConfig))
+	assert.Error(checkInstall(criCRIO, info, filepath.Join(tmpdir, "other.toml"), config.RuntimeConfig))
+
+	for _, handler := range []string{"", "CC", "-cc", "cc_runtime", "cc.runtime"} {
+		bad := info
+		bad.Handler = handler
+		assert.Error(checkInstall(criCRIO, bad, config.ConfigPath, config.RuntimeConfig), handler)
+	}
+
+	for _, path := range []string{"runtime", filepath.Join(tmpdir, "missing")} {
+		bad := info
+		bad.RuntimePath = path
+		assert.Error(checkInstall(criCRIO, bad, config.ConfigPath, config.RuntimeConfig), path)
+	}
+
+	badConfig := config.RuntimeConfig
+	badConfig.HypervisorConfig.KernelPath = filepath.Join(tmpdir, "missing")
+	assert.Error(checkInstall(criCRIO, info, config.ConfigPath, badConfig))
+
+	badConfig = config.RuntimeConfig
+	badConfig.ShimConfig = nil
+	assert.Error(checkInstall(criCRIO, info, config.ConfigPath, badConfig))
+}
+
+func TestWriteInstall(t *testing.T) {
+	assert := assert.New(t)
+
+	info := installInfo{Name: name, Handler: "clear", RuntimePath: "/usr/bin/cc-runtime"}
+
+	var b bytes.Buffer
+	assert.NoError(writeInstall(&b, criCRIO, "", info))
+	assert.Contains(b.String(), "[crio.runtime.runtimes.clear]\nruntime_path = \"/usr/bin/cc-runtime\"\n")
+	assert.Contains(b.String(), "kind: RuntimeClass\nmetadata:\n  name: clear\nhandler: clear\n")
+
+	b.Reset()
+	assert.NoError(writeInstall(&b, criContainerd, "", info))
+	assert.Contains(b.String(), `[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.clear]`)
+	assert.Contains(b.String(), `BinaryName = "/usr/bin/cc-runtime"`)
+	assert.Contains(b.String(), "handler: clear\n")
+}
+
+func TestWriteInstallDropIn(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	info := installInfo{Name: name, Handler: "cc", RuntimePath: "/usr/bin/cc-runtime"}
+
+	var b bytes.Buffer
+	assert.NoError(writeInstall(&b, criCRIO, tmpdir, info))
+
+	path := filepath.Join(tmpdir, "50-cc.conf")
+	contents, err := getFileContents(path)
+	assert.NoError(err)
+	assert.Contains(contents, "[crio.runtime.runtimes.cc]\n")
+
+	assert.NotContains(b.String(), "[crio.runtime.runtimes.cc]")
+	assert.Contains(b.String(), path)
+	assert.Contains(b.String(), "handler: cc\n")
+
+	assert.Error(writeInstall(&b, criContainerd, filepath.Join(tmpdir, "missing"), info))
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/urfave/cli"
+)
+
+const (
+	// agent socket names, as used by virtcontainers
+	agentCtlSocket = "hyper.sock"
+	agentTtySocket = "tty.sock"
+
+	socketDirMode = os.FileMode(0750)
+)
+
+// agentSocketDir is the directory below which the sockets used to
+// communicate with the agent of each pod are created. If empty, the
+// virtcontainers default is used.
+var agentSocketDir = ""
+
+// setInstanceDirs sets the locations used by this runtime instance. The
+// global options take precedence over the configuration file, so that
+// independent instances may share a configuration file.
+func setInstanceDirs(context *cli.Context, r runtime) {
+	root := context.GlobalString("root")
+	if r.Root != "" && !context.GlobalIsSet("root") {
+		root = r.Root
+	}
+
+	applyInstanceDirs(r, root, context.GlobalString("cc-socket-dir"))
+}
+
+// applyInstanceDirs sets the state directory to root and the agent
+// socket directory to socketDir, or to the one of the configuration
+// file. Empty directories leave the defaults unchanged.
+func applyInstanceDirs(r runtime, root, socketDir string) {
+	if root != "" {
+		runtimeStateDir = root
+	}
+
+	agentSocketDir = r.SocketDir
+
+	if socketDir != "" {
+		agentSocketDir = socketDir
+	}
+}
+
+// validInstanceDir checks a directory set in the configuration file.
+func validInstanceDir(option, dir string) error {
+	if dir != "" && !filepath.IsAbs(dir) {
+		return fmt.Errorf("Invalid %s %q: must be an absolute path", option, dir)
+	}
+
+	return nil
+}
+
+func podSocketDir(podID string) string {
+	return filepath.Join(agentSocketDir, podID)
+}
+
+// setAgentSockets makes the agent of the specified pod use sockets in
+// the agent socket directory rather than in the virtcontainers
+// directory shared by all runtime instances.
+func setAgentSockets(config *vc.HyperConfig, podID string) error {
+	if agentSocketDir == "" {
+		return nil
+	}
+
+	dir := podSocketDir(podID)
+
+	if err := os.MkdirAll(dir, socketDirMode); err != nil {
+		return err
+	}
+
+	config.SockCtlName = filepath.Join(dir, agentCtlSocket)
+	config.SockTtyName = filepath.Join(dir, agentTtySocket)
+
+	// Same layout as the default virtcontainers sockets.
+	config.Sockets = nil
+	for i, path := range []string{config.SockCtlName, config.SockTtyName} {
+		config.Sockets = append(config.Sockets, vc.Socket{
+			DeviceID: fmt.Sprintf("channel%d", i),
+			ID:       fmt.Sprintf("charch%d", i),
+			HostPath: path,
+			Name:     fmt.Sprintf("sh.hyper.channel.%d", i),
+		})
+	}
+
+	return nil
+}
+
+// removeAgentSockets removes the agent socket directory of the specified
+// pod.
+func removeAgentSockets(podID string) error {
+	if agentSocketDir == "" {
+		return nil
+	}
+
+	return os.RemoveAll(podSocketDir(podID))
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestSetInstanceDirs(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedAgentSocketDir := agentSocketDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("", 0)
+		set.String("root", defaultRootDirectory, "")
+		set.String("cc-socket-dir", "", "")
+		assert.NoError(set.Parse(args))
+
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+
+	// defaults
+	setInstanceDirs(newContext(), runtime{})
+	assert.Equal(defaultRootDirectory, runtimeStateDir)
+	assert.Equal("", agentSocketDir)
+
+	// configuration file
+	r := runtime{Root: "/run/instance/state", SocketDir: "/run/instance/sockets"}
+	setInstanceDirs(newContext(), r)
+	assert.Equal(r.Root, runtimeStateDir)
+	assert.Equal(r.SocketDir, agentSocketDir)
+
+	// options take precedence
+	setInstanceDirs(newContext("--root", "/run/other/state", "--cc-socket-dir", "/run/other/sockets"), r)
+	assert.Equal("/run/other/state", runtimeStateDir)
+	assert.Equal("/run/other/sockets", agentSocketDir)
+}
+
+func TestRuntimeValidateInstanceDirs(t *testing.T) {
+	assert := assert.New(t)
+
+	r := runtime{Root: "/run/instance/state", SocketDir: "/run/instance/sockets"}
+	assert.NoError(r.validate())
+
+	r.Root = "state"
+	assert.Error(r.validate())
+
+	r.Root = ""
+	r.SocketDir = "sockets"
+	assert.Error(r.validate())
+}
+
+func TestSetAgentSockets(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "sockets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedAgentSocketDir := agentSocketDir
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	// virtcontainers default
+	agentSocketDir = ""
+
+	config := vc.HyperConfig{PauseBinPath: "/pause"}
+	err = setAgentSockets(&config, testPodID)
+	assert.NoError(err)
+	assert.Equal(vc.HyperConfig{PauseBinPath: "/pause"}, config)
+	assert.NoError(removeAgentSockets(testPodID))
+
+	agentSocketDir = dir
+
+	err = setAgentSockets(&config, testPodID)
+	assert.NoError(err)
+
+	podDir := filepath.Join(dir, testPodID)
+	assert.True(fileExists(podDir))
+
+	expected := vc.HyperConfig{
+		SockCtlName:  filepath.Join(podDir, agentCtlSocket),
+		SockTtyName:  filepath.Join(podDir, agentTtySocket),
+		PauseBinPath: "/pause",
+		Sockets: []vc.Socket{
+			{
+				DeviceID: "channel0",
+				ID:       "charch0",
+				HostPath: filepath.Join(podDir, agentCtlSocket),
+				Name:     "sh.hyper.channel.0",
+			},
+			{
+				DeviceID: "channel1",
+				ID:       "charch1",
+				HostPath: filepath.Join(podDir, agentTtySocket),
+				Name:     "sh.hyper.channel.1",
+			},
+		},
+	}
+
+	assert.Equal(expected, config)
+
+	// idempotent
+	err = setAgentSockets(&config, testPodID)
+	assert.NoError(err)
+	assert.Equal(expected, config)
+
+	err = removeAgentSockets(testPodID)
+	assert.NoError(err)
+	assert.False(fileExists(podDir))
+}
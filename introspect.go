@@ -0,0 +1,360 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli"
+)
+
+// commandInfo describes a runtime command.
+type commandInfo struct {
+	Name    string     `json:"name"`
+	Aliases []string   `json:"aliases,omitempty"`
+	Usage   string     `json:"usage"`
+	Hidden  bool       `json:"hidden,omitempty"`
+	Flags   []flagInfo `json:"flags"`
+}
+
+// flagInfo describes a command-line option.
+type flagInfo struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	Type    string   `json:"type"`
+	Usage   string   `json:"usage"`
+	Default string   `json:"default,omitempty"`
+	EnvVar  string   `json:"envVar,omitempty"`
+	Hidden  bool     `json:"hidden,omitempty"`
+}
+
+// exitCodeInfo describes the exit codes of the runtime.
+type exitCodeInfo struct {
+	Codes       string   `json:"codes"`
+	Description string   `json:"description"`
+	Commands    []string `json:"commands,omitempty"`
+}
+
+// cliInfo describes the command-line interface of the runtime.
+type cliInfo struct {
+	Name        string         `json:"name"`
+	Version     string         `json:"version"`
+	GlobalFlags []flagInfo     `json:"globalFlags"`
+	Commands    []commandInfo  `json:"commands"`
+	ExitCodes   []exitCodeInfo `json:"exitCodes"`
+}
+
+var runtimeExitCodes = []exitCodeInfo{
+	{Codes: "0", Description: "success"},
+	{Codes: "1", Description: "error"},
+	{Codes: "0-255", Description: "exit status of the workload when not detached", Commands: []string{"exec", "run"}},
+}
+
+// introspectionCommands are the commands which only describe the
+// command-line and so do not need the runtime configuration.
+var introspectionCommands = []string{"cc-completion", "cc-introspect", "introspect"}
+
+func isIntrospectionCommand(command string) bool {
+	for _, c := range introspectionCommands {
+		if c == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitFlagName returns the name and the aliases of an option, as given
+// to cli ("name, n").
+func splitFlagName(name string) (string, []string) {
+	var names []string
+
+	for _, n := range strings.Split(name, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return "", nil
+	case 1:
+		return names[0], nil
+	}
+
+	return names[0], names[1:]
+}
+
+func newFlagInfo(flag cli.Flag) flagInfo {
+	var info flagInfo
+	var name string
+
+	switch f := flag.(type) {
+	case cli.BoolFlag:
+		info = flagInfo{Type: "bool", Usage: f.Usage, EnvVar: f.EnvVar, Hidden: f.Hidden}
+		name = f.Name
+	case cli.StringFlag:
+		info = flagInfo{Type: "string", Usage: f.Usage, Default: f.Value, EnvVar: f.EnvVar, Hidden: f.Hidden}
+		name = f.Name
+	case cli.StringSliceFlag:
+		info = flagInfo{Type: "string-slice", Usage: f.Usage, EnvVar: f.EnvVar, Hidden: f.Hidden}
+		name = f.Name
+	case cli.DurationFlag:
+		info = flagInfo{Type: "duration", Usage: f.Usage, Default: f.Value.String(), EnvVar: f.EnvVar, Hidden: f.Hidden}
+		name = f.Name
+	case cli.Uint64Flag:
+		info = flagInfo{Type: "uint64", Usage: f.Usage, Default: fmt.Sprint(f.Value), EnvVar: f.EnvVar, Hidden: f.Hidden}
+		name = f.Name
+	default:
+		info = flagInfo{Type: fmt.Sprintf("%T", flag)}
+		name = flag.GetName()
+	}
+
+	info.Name, info.Aliases = splitFlagName(name)
+
+	return info
+}
+
+func newFlagInfos(flags []cli.Flag) []flagInfo {
+	infos := []flagInfo{}
+
+	for _, f := range flags {
+		infos = append(infos, newFlagInfo(f))
+	}
+
+	return infos
+}
+
+// getCLIInfo describes the command-line interface of the specified
+// application.
+func getCLIInfo(app *cli.App) cliInfo {
+	info := cliInfo{
+		Name:        app.Name,
+		Version:     version,
+		GlobalFlags: newFlagInfos(app.Flags),
+		Commands:    []commandInfo{},
+		ExitCodes:   runtimeExitCodes,
+	}
+
+	for _, c := range app.Commands {
+		info.Commands = append(info.Commands, commandInfo{
+			Name:    c.Name,
+			Aliases: c.Aliases,
+			Usage:   c.Usage,
+			Hidden:  c.Hidden,
+			Flags:   newFlagInfos(c.Flags),
+		})
+	}
+
+	sort.Slice(info.Commands, func(i, j int) bool {
+		return info.Commands[i].Name < info.Commands[j].Name
+	})
+
+	return info
+}
+
+// completionCommand is the data used to complete the options of a
+// command.
+type completionCommand struct {
+	Name  string
+	Flags string
+}
+
+// completionData is the data used to generate the completion scripts.
+type completionData struct {
+	Name        string
+	Function    string
+	Commands    string
+	GlobalFlags string
+	ValueFlags  string
+	PerCommand  []completionCommand
+}
+
+// completionFlags returns the options of a flag list, as given on the
+// command-line. Hidden options are not completed.
+func completionFlags(flags []flagInfo, valuesOnly bool) string {
+	var words []string
+
+	for _, f := range flags {
+		if f.Hidden || (valuesOnly && f.Type == "bool") {
+			continue
+		}
+
+		for _, n := range append([]string{f.Name}, f.Aliases...) {
+			if len(n) == 1 {
+				words = append(words, "-"+n)
+			} else {
+				words = append(words, "--"+n)
+			}
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+func newCompletionData(info cliInfo) completionData {
+	data := completionData{
+		Name:        info.Name,
+		Function:    "_" + strings.Replace(info.Name, "-", "_", -1),
+		GlobalFlags: completionFlags(info.GlobalFlags, false),
+		ValueFlags:  completionFlags(info.GlobalFlags, true),
+	}
+
+	var commands []string
+
+	for _, c := range info.Commands {
+		if c.Hidden {
+			continue
+		}
+
+		commands = append(commands, c.Name)
+		commands = append(commands, c.Aliases...)
+
+		data.PerCommand = append(data.PerCommand, completionCommand{
+			Name:  strings.Join(append([]string{c.Name}, c.Aliases...), "|"),
+			Flags: strings.TrimSpace(completionFlags(c.Flags, false) + " --help"),
+		})
+	}
+
+	data.Commands = strings.Join(commands, " ")
+
+	return data
+}
+
+const bashCompletionTemplate = `# bash completion for {{.Name}}
+
+{{.Function}}() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local commands="{{.Commands}}"
+	local global_flags="{{.GlobalFlags}}"
+	local value_flags=" {{.ValueFlags}} "
+	local command=""
+	local i
+
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "${COMP_WORDS[i]}" in
+		-*=*)
+			;;
+		-*)
+			if [[ "$value_flags" == *" ${COMP_WORDS[i]} "* ]]; then
+				((i++))
+			fi
+			;;
+		*)
+			command="${COMP_WORDS[i]}"
+			break
+			;;
+		esac
+	done
+
+	case "$command" in
+	"")
+		COMPREPLY=($(compgen -W "$commands $global_flags" -- "$cur"))
+		;;
+{{- range .PerCommand}}
+	{{.Name}})
+		COMPREPLY=($(compgen -W "{{.Flags}}" -- "$cur"))
+		;;
+{{- end}}
+	*)
+		COMPREPLY=()
+		;;
+	esac
+}
+
+complete -o default -F {{.Function}} {{.Name}}
+`
+
+const zshCompletionTemplate = `#compdef {{.Name}}
+
+# zsh completion for {{.Name}}, using the bash completion.
+autoload -U +X bashcompinit && bashcompinit
+
+`
+
+// writeCompletion writes the completion script for the specified shell.
+func writeCompletion(w io.Writer, shell string, info cliInfo) error {
+	var text string
+
+	switch shell {
+	case "bash":
+		text = bashCompletionTemplate
+	case "zsh":
+		text = zshCompletionTemplate + bashCompletionTemplate
+	default:
+		return fmt.Errorf("Unsupported shell %q (supported: bash, zsh)", shell)
+	}
+
+	tmpl, err := template.New(shell).Parse(text)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, newCompletionData(info))
+}
+
+var completionCLICommand = cli.Command{
+	Name:  "cc-completion",
+	Usage: "generate a shell completion script",
+	ArgsUsage: `<shell>
+
+   <shell> is "bash" or "zsh"`,
+	Description: `The cc-completion command writes a script to complete the commands and
+   options of the runtime for the specified shell.
+
+EXAMPLE:
+       # ` + name + ` cc-completion bash > /etc/bash_completion.d/` + name,
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 1 {
+			return errors.New("Expecting a shell name")
+		}
+
+		return writeCompletion(defaultOutputFile, context.Args().First(), getCLIInfo(context.App))
+	},
+}
+
+var introspectCLICommand = cli.Command{
+	Name:    "cc-introspect",
+	Aliases: []string{"introspect"},
+	Usage:   "describe the commands, options and exit codes of the runtime",
+	Hidden:  true,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "display the description in JSON",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		info := getCLIInfo(context.App)
+
+		if context.Bool("json") || wantJSONOutput() {
+			return json.NewEncoder(defaultOutputFile).Encode(info)
+		}
+
+		for _, c := range info.Commands {
+			if _, err := fmt.Fprintf(defaultOutputFile, "%s\t%s\n", c.Name, c.Usage); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
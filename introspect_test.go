@@ -0,0 +1,213 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func newTestIntrospectApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "test-runtime"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "root", Value: "/run/test", Usage: "root usage"},
+		cli.BoolFlag{Name: "debug"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "list",
+			Usage: "list usage",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "format, f", Value: "table"},
+				cli.BoolFlag{Name: "secret", Hidden: true},
+			},
+		},
+		{
+			Name:    "debug-dump",
+			Aliases: []string{"dump"},
+			Hidden:  true,
+		},
+	}
+
+	return app
+}
+
+func TestIntrospectSplitFlagName(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		name            string
+		expectedName    string
+		expectedAliases []string
+	}
+
+	data := []testData{
+		{"", "", nil},
+		{"root", "root", nil},
+		{"format, f", "format", []string{"f"}},
+		{"quiet,q, Q", "quiet", []string{"q", "Q"}},
+	}
+
+	for _, d := range data {
+		name, aliases := splitFlagName(d.name)
+		assert.Equal(d.expectedName, name, "%+v", d)
+		assert.Equal(d.expectedAliases, aliases, "%+v", d)
+	}
+}
+
+func TestIntrospectNewFlagInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		flag     cli.Flag
+		expected flagInfo
+	}
+
+	data := []testData{
+		{cli.BoolFlag{Name: "all, a", Usage: "u", Hidden: true}, flagInfo{Name: "all", Aliases: []string{"a"}, Type: "bool", Usage: "u", Hidden: true}},
+		{cli.StringFlag{Name: "root", Value: "/run", EnvVar: "ROOT"}, flagInfo{Name: "root", Type: "string", Default: "/run", EnvVar: "ROOT"}},
+		{cli.StringSliceFlag{Name: "env"}, flagInfo{Name: "env", Type: "string-slice"}},
+		{cli.DurationFlag{Name: "interval", Value: time.Minute}, flagInfo{Name: "interval", Type: "duration", Default: "1m0s"}},
+		{cli.Uint64Flag{Name: "pages", Value: 10}, flagInfo{Name: "pages", Type: "uint64", Default: "10"}},
+		{cli.IntFlag{Name: "count"}, flagInfo{Name: "count", Type: "cli.IntFlag"}},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, newFlagInfo(d.flag), "%+v", d)
+	}
+}
+
+func TestIntrospectGetCLIInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	info := getCLIInfo(newTestIntrospectApp())
+
+	assert.Equal("test-runtime", info.Name)
+	assert.Equal(version, info.Version)
+	assert.Equal(runtimeExitCodes, info.ExitCodes)
+	assert.Len(info.GlobalFlags, 2)
+
+	// sorted by name
+	assert.Len(info.Commands, 2)
+	assert.Equal("debug-dump", info.Commands[0].Name)
+	assert.Equal([]string{"dump"}, info.Commands[0].Aliases)
+	assert.True(info.Commands[0].Hidden)
+	assert.Equal("list", info.Commands[1].Name)
+	assert.Len(info.Commands[1].Flags, 2)
+}
+
+func TestIntrospectWriteCompletion(t *testing.T) {
+	assert := assert.New(t)
+
+	info := getCLIInfo(newTestIntrospectApp())
+
+	buf := &bytes.Buffer{}
+	err := writeCompletion(buf, "bash", info)
+	assert.NoError(err)
+
+	script := buf.String()
+	assert.Contains(script, "_test_runtime() {")
+	assert.Contains(script, `local commands="list"`)
+	assert.Contains(script, `local value_flags=" --root "`)
+	assert.Contains(script, `COMPREPLY=($(compgen -W "--format -f --help" -- "$cur"))`)
+	assert.Contains(script, "complete -o default -F _test_runtime test-runtime")
+
+	// hidden commands and options are not completed
+	assert.False(strings.Contains(script, "dump"))
+	assert.False(strings.Contains(script, "--secret"))
+
+	buf.Reset()
+	err = writeCompletion(buf, "zsh", info)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(buf.String(), "#compdef test-runtime\n"))
+	assert.Contains(buf.String(), "_test_runtime() {")
+
+	err = writeCompletion(buf, "fish", info)
+	assert.Error(err)
+}
+
+func TestIntrospectIsIntrospectionCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, command := range []string{"cc-completion", "cc-introspect", "introspect"} {
+		assert.True(isIntrospectionCommand(command), command)
+	}
+
+	for _, command := range []string{"", "list", "cc-check"} {
+		assert.False(isIntrospectionCommand(command), command)
+	}
+}
+
+func TestIntrospectCLIFunctions(t *testing.T) {
+	assert := assert.New(t)
+
+	outputFile, err := ioutil.TempFile(testDir, "introspect-")
+	assert.NoError(err)
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+
+	savedOutputFile := defaultOutputFile
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	defaultOutputFile = outputFile
+
+	app := newTestIntrospectApp()
+
+	set := flag.NewFlagSet("", 0)
+	set.Bool("json", true, "")
+	ctx := cli.NewContext(app, set, nil)
+
+	fn, ok := introspectCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	bytes, err := ioutil.ReadFile(outputFile.Name())
+	assert.NoError(err)
+
+	var info cliInfo
+	err = json.Unmarshal(bytes, &info)
+	assert.NoError(err)
+	assert.Equal(getCLIInfo(app), info)
+
+	fn, ok = completionCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// no shell
+	set = flag.NewFlagSet("", 0)
+	ctx = cli.NewContext(app, set, nil)
+	err = fn(ctx)
+	assert.Error(err)
+
+	set.Parse([]string{"bash"})
+	err = fn(ctx)
+	assert.NoError(err)
+
+	err = grep("complete -o default -F _test_runtime test-runtime", outputFile.Name())
+	assert.NoError(err)
+}
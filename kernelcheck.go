@@ -0,0 +1,226 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+)
+
+// kernelConfigSuffix is appended to the path of a guest kernel to obtain
+// the path of its build configuration.
+const kernelConfigSuffix = ".config"
+
+// Markers of the build configuration embedded in kernels built with
+// CONFIG_IKCONFIG. The configuration between them is gzip compressed.
+var (
+	ikconfigStart = []byte("IKCFG_ST")
+	ikconfigEnd   = []byte("IKCFG_ED")
+)
+
+// kernelRequirement is a kernel option required by a feature of the
+// guest.
+type kernelRequirement struct {
+	option  string
+	feature string
+}
+
+// baseKernelRequirements are the kernel options required by every
+// guest.
+var baseKernelRequirements = []kernelRequirement{
+	{option: "CONFIG_VIRTIO_PCI", feature: "virtio devices"},
+	{option: "CONFIG_VIRTIO_CONSOLE", feature: "console and agent channels"},
+	{option: "CONFIG_VIRTIO_NET", feature: "networking"},
+	{option: "CONFIG_BLK_DEV_PMEM", feature: "guest image"},
+	{option: "CONFIG_NET_9P_VIRTIO", feature: "9p shared filesystem"},
+	{option: "CONFIG_9P_FS", feature: "9p shared filesystem"},
+}
+
+// kernelRequirements returns the kernel options required by the guest
+// of a pod created with the specified hypervisor configuration.
+func kernelRequirements(config vc.HypervisorConfig) []kernelRequirement {
+	reqs := append([]kernelRequirement(nil), baseKernelRequirements...)
+
+	hasParam := func(params []vc.Param, key string) bool {
+		_, ok := kernelParamValue(params, key)
+		return ok
+	}
+
+	if mode, _ := kernelParamValue(config.KernelParams, sharedFSCacheParam); mode == sharedFSCacheFSCache {
+		reqs = append(reqs, kernelRequirement{option: "CONFIG_9P_FSCACHE", feature: "shared filesystem cache"})
+	}
+
+	if hasParam(config.KernelParams, zramDevsParam) {
+		reqs = append(reqs, kernelRequirement{option: "CONFIG_ZRAM", feature: "zram swap"})
+	}
+
+	if hasParam(config.KernelParams, zswapEnabledParam) {
+		reqs = append(reqs, kernelRequirement{option: "CONFIG_ZSWAP", feature: "zswap"})
+	}
+
+	return reqs
+}
+
+// parseKernelConfig returns the options set by a kernel build
+// configuration and their values.
+func parseKernelConfig(r io.Reader) (map[string]string, error) {
+	options := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "CONFIG_") {
+			return nil, fmt.Errorf("Invalid kernel configuration line %q", line)
+		}
+
+		options[fields[0]] = fields[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// embeddedKernelConfig returns the build configuration embedded in a
+// kernel, or nil if there is none. The configuration cannot be found in
+// compressed kernels.
+func embeddedKernelConfig(kernelPath string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(kernelPath)
+	if err != nil {
+		return nil, err
+	}
+
+	start := bytes.Index(data, ikconfigStart)
+	if start < 0 {
+		return nil, nil
+	}
+
+	data = data[start+len(ikconfigStart):]
+
+	end := bytes.Index(data, ikconfigEnd)
+	if end < 0 {
+		return nil, fmt.Errorf("Truncated configuration embedded in kernel %v", kernelPath)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data[:end]))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid configuration embedded in kernel %v: %v", kernelPath, err)
+	}
+	defer gz.Close()
+
+	return parseKernelConfig(gz)
+}
+
+// loadKernelConfig returns the build configuration of a guest kernel,
+// read from the file next to the kernel or from the kernel itself, and
+// where it was found. The configuration is nil if it was not found.
+func loadKernelConfig(kernelPath string) (map[string]string, string, error) {
+	path := kernelPath + kernelConfigSuffix
+
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+
+		options, err := parseKernelConfig(f)
+		if err != nil {
+			return nil, "", fmt.Errorf("Invalid kernel configuration %v: %v", path, err)
+		}
+
+		return options, path, nil
+	} else if !os.IsNotExist(err) {
+		return nil, "", err
+	}
+
+	options, err := embeddedKernelConfig(kernelPath)
+	if err != nil || options == nil {
+		return nil, "", err
+	}
+
+	return options, kernelPath, nil
+}
+
+// checkKernel checks that the guest kernel of the hypervisor
+// configuration has the options required by the guest, so that a guest
+// which cannot work fails before the VM boots rather than time out. A
+// kernel whose configuration cannot be found is not checked, unless in
+// strict mode.
+func checkKernel(config vc.HypervisorConfig, strict bool) error {
+	options, source, err := loadKernelConfig(config.KernelPath)
+	if err != nil {
+		return err
+	}
+
+	if options == nil {
+		message := fmt.Sprintf("Unable to check guest kernel %v: no %v file and no configuration embedded in the kernel",
+			config.KernelPath, config.KernelPath+kernelConfigSuffix)
+
+		if strict {
+			return fmt.Errorf("Strict mode refuses settings which cannot be enforced: %s (%s)", message, warningKernelUnchecked)
+		}
+
+		warn(warningKernelUnchecked, "%s", message)
+
+		return nil
+	}
+
+	var missing []string
+
+	for _, req := range kernelRequirements(config) {
+		if value := options[req.option]; value != "y" && value != "m" {
+			missing = append(missing, fmt.Sprintf("%s (%s)", req.option, req.feature))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Guest kernel %v lacks options required by the guest, according to %v: %s. Rebuild the kernel with these options or select another kernel",
+			config.KernelPath, source, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// checkGuestKernels checks the default guest kernel and the kernels of
+// the variants.
+func checkGuestKernels(config vc.HypervisorConfig, kernels map[string]kernelVariant) error {
+	if err := checkKernel(config, false); err != nil {
+		return err
+	}
+
+	for _, name := range sortedKernelVariants(kernels) {
+		variantConfig := config
+		variantConfig.KernelPath = kernels[name].Path
+
+		if err := checkKernel(variantConfig, false); err != nil {
+			return fmt.Errorf("Invalid kernel variant %q: %v", name, err)
+		}
+	}
+
+	return nil
+}
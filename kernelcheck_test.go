@@ -0,0 +1,216 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKernelConfig = `#
+# Automatically generated file; DO NOT EDIT.
+#
+CONFIG_VIRTIO_PCI=y
+CONFIG_VIRTIO_CONSOLE=y
+CONFIG_VIRTIO_NET=y
+CONFIG_BLK_DEV_PMEM=y
+CONFIG_NET_9P_VIRTIO=y
+CONFIG_9P_FS=y
+CONFIG_VIRTIO_VSOCKETS=m
+# CONFIG_ZRAM is not set
+CONFIG_LOCALVERSION=""
+`
+
+func writeTestKernel(t *testing.T, dir, name string, contents []byte) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, contents, 0644))
+
+	return path
+}
+
+func embedTestKernelConfig(t *testing.T, config string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("kernel code")
+	buf.Write(ikconfigStart)
+
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(config))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+
+	buf.Write(ikconfigEnd)
+	buf.WriteString("more kernel code")
+
+	return buf.Bytes()
+}
+
+func TestParseKernelConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := parseKernelConfig(strings.NewReader(testKernelConfig))
+	assert.NoError(err)
+	assert.Equal("y", options["CONFIG_9P_FS"])
+	assert.Equal("m", options["CONFIG_VIRTIO_VSOCKETS"])
+	assert.Equal(`""`, options["CONFIG_LOCALVERSION"])
+	assert.NotContains(options, "CONFIG_ZRAM")
+
+	_, err = parseKernelConfig(strings.NewReader("foo\n"))
+	assert.Error(err)
+}
+
+func TestKernelRequirements(t *testing.T) {
+	assert := assert.New(t)
+
+	options := func(reqs []kernelRequirement) []string {
+		var list []string
+		for _, req := range reqs {
+			list = append(list, req.option)
+		}
+		return list
+	}
+
+	assert.Equal(options(baseKernelRequirements), options(kernelRequirements(vc.HypervisorConfig{})))
+
+	config := vc.HypervisorConfig{
+		KernelParams: []vc.Param{
+			{Key: sharedFSCacheParam, Value: sharedFSCacheFSCache},
+			{Key: zramDevsParam, Value: "1"},
+			{Key: zswapEnabledParam, Value: "1"},
+		},
+	}
+
+	list := options(kernelRequirements(config))
+	for _, option := range []string{"CONFIG_9P_FSCACHE", "CONFIG_ZRAM", "CONFIG_ZSWAP"} {
+		assert.Contains(list, option)
+	}
+}
+
+func TestLoadKernelConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "kernelcheck-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// neither a configuration file nor an embedded configuration
+	kernel := writeTestKernel(t, dir, "vmlinuz", []byte("kernel"))
+
+	options, source, err := loadKernelConfig(kernel)
+	assert.NoError(err)
+	assert.Nil(options)
+	assert.Empty(source)
+
+	// embedded configuration
+	kernel = writeTestKernel(t, dir, "vmlinux", embedTestKernelConfig(t, testKernelConfig))
+
+	options, source, err = loadKernelConfig(kernel)
+	assert.NoError(err)
+	assert.Equal(kernel, source)
+	assert.Equal("y", options["CONFIG_9P_FS"])
+
+	// the configuration file is preferred
+	config := writeTestKernel(t, dir, "vmlinux"+kernelConfigSuffix, []byte("CONFIG_9P_FS=m\n"))
+
+	options, source, err = loadKernelConfig(kernel)
+	assert.NoError(err)
+	assert.Equal(config, source)
+	assert.Equal("m", options["CONFIG_9P_FS"])
+
+	// truncated embedded configuration
+	data := embedTestKernelConfig(t, testKernelConfig)
+	kernel = writeTestKernel(t, dir, "truncated", data[:bytes.Index(data, ikconfigEnd)])
+
+	_, _, err = loadKernelConfig(kernel)
+	assert.Error(err)
+}
+
+func TestCheckKernel(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "kernelcheck-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedWarnings := warnings
+	defer func() {
+		warnings = savedWarnings
+	}()
+
+	warnings = nil
+
+	config := vc.HypervisorConfig{
+		KernelPath: writeTestKernel(t, dir, "vmlinux", embedTestKernelConfig(t, testKernelConfig)),
+	}
+
+	assert.NoError(checkKernel(config, true))
+
+	config.KernelParams = append(config.KernelParams, vc.Param{Key: zramDevsParam, Value: "1"})
+
+	err = checkKernel(config, false)
+	assert.Error(err)
+	assert.Contains(err.Error(), "CONFIG_ZRAM (zram swap)")
+
+	// a kernel which cannot be checked
+	config.KernelPath = writeTestKernel(t, dir, "vmlinuz", []byte("kernel"))
+
+	assert.NoError(checkKernel(config, false))
+	assert.Equal([]string{warningKernelUnchecked}, warningCodes(warnings))
+
+	warnings = nil
+
+	err = checkKernel(config, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), warningKernelUnchecked)
+	assert.Empty(warnings)
+
+	config.KernelPath = filepath.Join(dir, "missing")
+	assert.Error(checkKernel(config, false))
+}
+
+func TestCheckGuestKernels(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "kernelcheck-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := vc.HypervisorConfig{
+		KernelPath: writeTestKernel(t, dir, "vmlinux", embedTestKernelConfig(t, testKernelConfig)),
+	}
+
+	kernels := map[string]kernelVariant{
+		"rt": {Path: writeTestKernel(t, dir, "vmlinux-rt", embedTestKernelConfig(t, testKernelConfig))},
+	}
+
+	assert.NoError(checkGuestKernels(config, kernels))
+
+	kernels["gpu"] = kernelVariant{
+		Path: writeTestKernel(t, dir, "vmlinux-gpu", embedTestKernelConfig(t, "CONFIG_VIRTIO_PCI=y\n")),
+	}
+
+	err = checkGuestKernels(config, kernels)
+	assert.Error(err)
+	assert.Contains(err.Error(), `"gpu"`)
+	assert.Contains(err.Error(), "CONFIG_9P_FS")
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// kernelAnnotation is the OCI annotation selecting the kernel variant
+// the guest of a pod boots.
+const kernelAnnotation = ccAnnotationPrefix + "kernel"
+
+// kernelVariantNameRegex matches the names of kernel variants.
+var kernelVariantNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+
+// kernelVariant is a guest kernel approved for the pods selecting it,
+// such as a kernel with GPU drivers or a real-time kernel.
+type kernelVariant struct {
+	Path string `toml:"path"`
+
+	// KernelParams are added to the hypervisor kernel parameters.
+	KernelParams string `toml:"kernel_params"`
+}
+
+// sortedKernelVariants returns the names of the kernel variants,
+// sorted to report errors consistently.
+func sortedKernelVariants(kernels map[string]kernelVariant) []string {
+	var names []string
+	for name := range kernels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// validKernelVariants checks the kernel variants of the configuration.
+// The kernels themselves are checked by checkKernelVariants.
+func validKernelVariants(kernels map[string]kernelVariant) error {
+	for _, name := range sortedKernelVariants(kernels) {
+		k := kernels[name]
+
+		if !kernelVariantNameRegex.MatchString(name) {
+			return fmt.Errorf("Invalid kernel variant name %q", name)
+		}
+
+		if !filepath.IsAbs(k.Path) {
+			return fmt.Errorf("Kernel variant %q: expecting the absolute path of the kernel, got %q", name, k.Path)
+		}
+	}
+
+	return nil
+}
+
+// check checks that the kernel of the variant is a regular file.
+func (k kernelVariant) check() error {
+	info, err := os.Stat(k.Path)
+	if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%v is not a regular file", k.Path)
+	}
+
+	return nil
+}
+
+// checkKernelVariants checks that the kernels of all the variants can be
+// booted.
+func checkKernelVariants(kernels map[string]kernelVariant) error {
+	for _, name := range sortedKernelVariants(kernels) {
+		if err := kernels[name].check(); err != nil {
+			return fmt.Errorf("Invalid kernel variant %q: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// podKernelVariant returns the name and the settings of the kernel
+// variant selected by a pod, or "" if it boots the default kernel.
+func podKernelVariant(ociSpec oci.CompatOCISpec) (string, kernelVariant, error) {
+	name, ok := ociSpec.Annotations[kernelAnnotation]
+	if !ok {
+		return "", kernelVariant{}, nil
+	}
+
+	k, ok := runtimeOptions.Kernels[name]
+	if !ok {
+		return "", kernelVariant{}, fmt.Errorf("Unknown kernel variant %q: expecting one of %v",
+			name, strings.Join(sortedKernelVariants(runtimeOptions.Kernels), ", "))
+	}
+
+	if err := k.check(); err != nil {
+		return "", kernelVariant{}, fmt.Errorf("Invalid kernel variant %q: %v", name, err)
+	}
+
+	return name, k, nil
+}
+
+// applyKernelVariant applies the kernel variant selected by a pod, if
+// any, to the runtime configuration used to create it, returning its
+// name.
+func applyKernelVariant(ociSpec oci.CompatOCISpec, runtimeConfig *oci.RuntimeConfig) (string, error) {
+	name, k, err := podKernelVariant(ociSpec)
+	if err != nil || name == "" {
+		return "", err
+	}
+
+	ccLog.Infof("Using kernel variant %q", name)
+
+	runtimeConfig.HypervisorConfig.KernelPath = k.Path
+
+	for _, param := range vc.DeserializeParams(strings.Fields(k.KernelParams)) {
+		if err := runtimeConfig.AddKernelParam(param); err != nil {
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+// setPodKernel records in the pod state the kernel its guest boots.
+func setPodKernel(podID, path string) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.KernelPath = path
+		return nil
+	})
+}
+
+// getPodKernel returns the kernel the guest of the pod boots, or "" for
+// the default kernel.
+func getPodKernel(podID string) (string, error) {
+	state, err := loadPodState(podID)
+	if err != nil {
+		return "", err
+	}
+
+	return state.KernelPath, nil
+}
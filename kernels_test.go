@@ -0,0 +1,190 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestValidKernelVariants(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validKernelVariants(nil))
+
+	assert.NoError(validKernelVariants(map[string]kernelVariant{
+		"gpu":      {Path: "/usr/share/vmlinuz-gpu"},
+		"rt-4.14":  {Path: "/usr/share/vmlinuz-rt", KernelParams: "isolcpus=1"},
+		"hardened": {Path: "/usr/share/vmlinuz-hardened"},
+	}))
+
+	for name, k := range map[string]kernelVariant{
+		"GPU":  {Path: "/usr/share/vmlinuz-gpu"},
+		"-rt":  {Path: "/usr/share/vmlinuz-rt"},
+		"a b":  {Path: "/usr/share/vmlinuz"},
+		"gpu":  {Path: "vmlinuz-gpu"},
+		"none": {},
+	} {
+		assert.Error(validKernelVariants(map[string]kernelVariant{name: k}), name)
+	}
+}
+
+func TestCheckKernelVariants(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "kernels-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	kernel := filepath.Join(dir, "vmlinuz-gpu")
+	assert.NoError(ioutil.WriteFile(kernel, []byte("kernel"), 0644))
+
+	assert.NoError(checkKernelVariants(map[string]kernelVariant{
+		"gpu": {Path: kernel},
+	}))
+
+	err = checkKernelVariants(map[string]kernelVariant{
+		"gpu": {Path: kernel},
+		"rt":  {Path: filepath.Join(dir, "vmlinuz-rt")},
+	})
+	assert.Error(err)
+	assert.Contains(err.Error(), `"rt"`)
+
+	err = checkKernelVariants(map[string]kernelVariant{
+		"dir": {Path: dir},
+	})
+	assert.Error(err)
+	assert.Contains(err.Error(), "not a regular file")
+}
+
+func TestApplyKernelVariant(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "kernels-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	kernel := filepath.Join(dir, "vmlinuz-rt")
+	assert.NoError(ioutil.WriteFile(kernel, []byte("kernel"), 0644))
+
+	savedKernels := runtimeOptions.Kernels
+	defer func() {
+		runtimeOptions.Kernels = savedKernels
+	}()
+
+	runtimeOptions.Kernels = map[string]kernelVariant{
+		"rt":      {Path: kernel, KernelParams: "isolcpus=1 nohz_full=1"},
+		"missing": {Path: filepath.Join(dir, "vmlinuz-missing")},
+	}
+
+	runtimeConfig := oci.RuntimeConfig{
+		HypervisorConfig: vc.HypervisorConfig{KernelPath: "/usr/share/vmlinuz"},
+	}
+
+	var ociSpec oci.CompatOCISpec
+
+	name, err := applyKernelVariant(ociSpec, &runtimeConfig)
+	assert.NoError(err)
+	assert.Empty(name)
+	assert.Equal("/usr/share/vmlinuz", runtimeConfig.HypervisorConfig.KernelPath)
+
+	ociSpec.Spec = specs.Spec{
+		Annotations: map[string]string{kernelAnnotation: "rt"},
+	}
+
+	name, err = applyKernelVariant(ociSpec, &runtimeConfig)
+	assert.NoError(err)
+	assert.Equal("rt", name)
+	assert.Equal(kernel, runtimeConfig.HypervisorConfig.KernelPath)
+	assert.Equal([]vc.Param{
+		{Key: "isolcpus", Value: "1"},
+		{Key: "nohz_full", Value: "1"},
+	}, runtimeConfig.HypervisorConfig.KernelParams)
+
+	ociSpec.Annotations[kernelAnnotation] = "gpu"
+
+	_, err = applyKernelVariant(ociSpec, &runtimeConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "missing, rt")
+
+	ociSpec.Annotations[kernelAnnotation] = "missing"
+
+	_, err = applyKernelVariant(ociSpec, &runtimeConfig)
+	assert.Error(err)
+}
+
+func TestListGetContainersPodKernel(t *testing.T) {
+	assert := assert.New(t)
+
+	var probeErr error
+	defer setupHealthTest(t, time.Unix(10000, 0), &probeErr)()
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID:          testPodID,
+						Annotations: map[string]string{},
+					},
+				},
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	kernel := filepath.Join(tmpdir, "vmlinuz-rt")
+	assert.NoError(ioutil.WriteFile(kernel, []byte("kernel"), 0644))
+
+	kernel, err = filepath.EvalSymlinks(kernel)
+	assert.NoError(err)
+
+	assert.NoError(setPodKernel(testPodID, kernel))
+
+	path, err := getPodKernel(testPodID)
+	assert.NoError(err)
+	assert.Equal(kernel, path)
+
+	app := cli.NewApp()
+	ctx := cli.NewContext(app, nil, nil)
+	ctx.App.Metadata = map[string]interface{}{
+		"runtimeConfig": runtimeConfig,
+	}
+
+	containers, err := getContainers(ctx)
+	assert.NoError(err)
+	assert.Len(containers, 1)
+	assert.Equal(kernel, containers[0].KernelPath)
+}
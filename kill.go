@@ -104,6 +104,12 @@ func kill(containerID, signal string, all bool) error {
 		return err
 	}
 
+	// The pod may have been paused because it was idle.
+	status, err = wakeContainer(status, podID)
+	if err != nil {
+		return err
+	}
+
 	containerID = status.ID
 
 	signum, err := processSignal(signal)
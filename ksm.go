@@ -0,0 +1,300 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// KSM run modes, as documented in
+// https://www.kernel.org/doc/Documentation/vm/ksm.txt
+const (
+	ksmStop  = "0"
+	ksmStart = "1"
+)
+
+const (
+	ksmRunFile         = "run"
+	ksmPagesToScanFile = "pages_to_scan"
+	ksmSleepFile       = "sleep_millisecs"
+
+	// ksmFileMode is the mode used when writing KSM control files
+	ksmFileMode = os.FileMode(0644)
+
+	// defaults for the KSM throttling service
+	defaultKSMInterval      = 5 * time.Second
+	defaultKSMMinPages      = 100
+	defaultKSMMaxPages      = 1250
+	defaultKSMSleepMillisec = 200
+
+	// memory availability (percentage of total memory) below which
+	// KSM scans at its maximum rate.
+	defaultKSMPressureThreshold = 20
+)
+
+// variables rather than consts to allow tests to modify them
+var (
+	ksmSysfsDir = "/sys/kernel/mm/ksm"
+	procMeminfo = "/proc/meminfo"
+	pageSize    = os.Getpagesize()
+)
+
+// ksmStats stores the KSM counters exposed by the host kernel.
+type ksmStats struct {
+	Running       bool
+	PagesShared   uint64
+	PagesSharing  uint64
+	PagesUnshared uint64
+	PagesVolatile uint64
+	FullScans     uint64
+}
+
+// savedBytes returns the amount of memory KSM is currently saving by
+// deduplicating pages.
+func (s ksmStats) savedBytes() uint64 {
+	return s.PagesSharing * uint64(pageSize)
+}
+
+// ksmThrottle describes the policy used by the KSM throttling service.
+type ksmThrottle struct {
+	minPages  uint64
+	maxPages  uint64
+	threshold uint64
+}
+
+func readKSMValue(name string) (uint64, error) {
+	contents, err := getFileContents(filepath.Join(ksmSysfsDir, name))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(contents), 10, 64)
+}
+
+func writeKSMValue(name, value string) error {
+	return ioutil.WriteFile(filepath.Join(ksmSysfsDir, name), []byte(value), ksmFileMode)
+}
+
+// ksmAvailable determines if the host kernel supports KSM.
+func ksmAvailable() bool {
+	return fileExists(filepath.Join(ksmSysfsDir, ksmRunFile))
+}
+
+// getKSMStats returns the current KSM counters.
+func getKSMStats() (ksmStats, error) {
+	var stats ksmStats
+
+	if !ksmAvailable() {
+		return stats, fmt.Errorf("KSM not supported by host kernel (%v not found)", ksmSysfsDir)
+	}
+
+	run, err := readKSMValue(ksmRunFile)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Running = run == 1
+
+	for name, value := range map[string]*uint64{
+		"pages_shared":   &stats.PagesShared,
+		"pages_sharing":  &stats.PagesSharing,
+		"pages_unshared": &stats.PagesUnshared,
+		"pages_volatile": &stats.PagesVolatile,
+		"full_scans":     &stats.FullScans,
+	} {
+		*value, err = readKSMValue(name)
+		if err != nil {
+			return ksmStats{}, err
+		}
+	}
+
+	return stats, nil
+}
+
+// enableKSM starts the KSM daemon on the host.
+func enableKSM() error {
+	if !ksmAvailable() {
+		return fmt.Errorf("KSM not supported by host kernel (%v not found)", ksmSysfsDir)
+	}
+
+	return writeKSMValue(ksmRunFile, ksmStart)
+}
+
+// getMemAvailablePercent returns the percentage of the host memory
+// that is currently available.
+func getMemAvailablePercent() (uint64, error) {
+	contents, err := getFileContents(procMeminfo)
+	if err != nil {
+		return 0, err
+	}
+
+	var total, available uint64
+
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		var value *uint64
+
+		switch fields[0] {
+		case "MemTotal:":
+			value = &total
+		case "MemAvailable:":
+			value = &available
+		default:
+			continue
+		}
+
+		*value, err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if total == 0 {
+		return 0, fmt.Errorf("failed to find memory details in %v", procMeminfo)
+	}
+
+	return (available * 100) / total, nil
+}
+
+// pagesToScan returns the number of pages KSM should scan on each run
+// given the percentage of host memory available. The scan rate grows
+// linearly from minPages (plenty of memory) to maxPages (memory
+// availability at or below the threshold).
+func (t ksmThrottle) pagesToScan(availablePercent uint64) uint64 {
+	if availablePercent <= t.threshold {
+		return t.maxPages
+	}
+
+	if availablePercent >= 100 || t.threshold >= 100 {
+		return t.minPages
+	}
+
+	pressure := 100 - availablePercent
+	scale := 100 - t.threshold
+
+	return t.minPages + ((t.maxPages-t.minPages)*pressure)/scale
+}
+
+// adjust updates the KSM scan rate according to the current memory
+// pressure. KSM is only kept running while pods exist.
+func (t ksmThrottle) adjust() error {
+	pods, err := vci.ListPod()
+	if err != nil {
+		return err
+	}
+
+	if len(pods) == 0 {
+		ccLog.Debug("No pods running, stopping KSM")
+		return writeKSMValue(ksmRunFile, ksmStop)
+	}
+
+	available, err := getMemAvailablePercent()
+	if err != nil {
+		return err
+	}
+
+	pages := t.pagesToScan(available)
+
+	ccLog.Debugf("Memory available: %d%%, setting KSM pages to scan to %d", available, pages)
+
+	if err := writeKSMValue(ksmPagesToScanFile, strconv.FormatUint(pages, 10)); err != nil {
+		return err
+	}
+
+	if err := writeKSMValue(ksmSleepFile, strconv.Itoa(defaultKSMSleepMillisec)); err != nil {
+		return err
+	}
+
+	return writeKSMValue(ksmRunFile, ksmStart)
+}
+
+var ksmCLICommand = cli.Command{
+	Name:  "cc-ksm",
+	Usage: "run the node-wide KSM throttling service",
+	Description: `The cc-ksm command tunes the host KSM (Kernel Samepage Merging) daemon
+   according to the memory pressure on the host: the busier the host
+   memory, the more aggressively KSM scans for duplicate guest pages. KSM
+   is stopped when no pods are running.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: defaultKSMInterval,
+			Usage: "time between each adjustment of the KSM settings",
+		},
+		cli.Uint64Flag{
+			Name:  "min-pages",
+			Value: defaultKSMMinPages,
+			Usage: "pages to scan per run when the host has plenty of available memory",
+		},
+		cli.Uint64Flag{
+			Name:  "max-pages",
+			Value: defaultKSMMaxPages,
+			Usage: "pages to scan per run when the host is under memory pressure",
+		},
+		cli.Uint64Flag{
+			Name:  "threshold",
+			Value: defaultKSMPressureThreshold,
+			Usage: "available memory percentage below which KSM scans at its maximum rate",
+		},
+		cli.BoolFlag{
+			Name:  "once",
+			Usage: "adjust the KSM settings once and exit",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		t := ksmThrottle{
+			minPages:  context.Uint64("min-pages"),
+			maxPages:  context.Uint64("max-pages"),
+			threshold: context.Uint64("threshold"),
+		}
+
+		if t.minPages > t.maxPages {
+			return fmt.Errorf("min-pages (%d) cannot be greater than max-pages (%d)", t.minPages, t.maxPages)
+		}
+
+		if !ksmAvailable() {
+			return fmt.Errorf("KSM not supported by host kernel (%v not found)", ksmSysfsDir)
+		}
+
+		if context.Bool("once") {
+			return t.adjust()
+		}
+
+		interval := context.Duration("interval")
+		if interval <= 0 {
+			return fmt.Errorf("Invalid interval %v", interval)
+		}
+
+		for {
+			if err := t.adjust(); err != nil {
+				ccLog.Warnf("Failed to adjust KSM settings: %v", err)
+			}
+
+			time.Sleep(interval)
+		}
+	},
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func createKSMSysfs(dir string, values map[string]string) error {
+	for name, value := range values {
+		if err := createFile(filepath.Join(dir, name), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func testKSMValues() map[string]string {
+	return map[string]string{
+		"run":             "1",
+		"pages_shared":    "10",
+		"pages_sharing":   "25",
+		"pages_unshared":  "3",
+		"pages_volatile":  "4",
+		"full_scans":      "7",
+		"pages_to_scan":   "100",
+		"sleep_millisecs": "20",
+	}
+}
+
+func TestKSMGetStats(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "ksm-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedKSMSysfsDir := ksmSysfsDir
+	defer func() {
+		ksmSysfsDir = savedKSMSysfsDir
+	}()
+
+	ksmSysfsDir = filepath.Join(dir, "enoent")
+
+	assert.False(ksmAvailable())
+	_, err = getKSMStats()
+	assert.Error(err)
+	assert.Error(enableKSM())
+
+	ksmSysfsDir = dir
+
+	values := testKSMValues()
+	err = createKSMSysfs(dir, values)
+	assert.NoError(err)
+
+	stats, err := getKSMStats()
+	assert.NoError(err)
+
+	expected := ksmStats{
+		Running:       true,
+		PagesShared:   10,
+		PagesSharing:  25,
+		PagesUnshared: 3,
+		PagesVolatile: 4,
+		FullScans:     7,
+	}
+
+	assert.Equal(expected, stats)
+	assert.Equal(uint64(25*pageSize), stats.savedBytes())
+
+	// invalid value
+	err = createFile(filepath.Join(dir, "pages_sharing"), "foo")
+	assert.NoError(err)
+
+	_, err = getKSMStats()
+	assert.Error(err)
+}
+
+func TestKSMEnable(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "ksm-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedKSMSysfsDir := ksmSysfsDir
+	defer func() {
+		ksmSysfsDir = savedKSMSysfsDir
+	}()
+
+	ksmSysfsDir = dir
+
+	err = createKSMSysfs(dir, map[string]string{"run": ksmStop})
+	assert.NoError(err)
+
+	err = enableKSM()
+	assert.NoError(err)
+
+	run, err := readKSMValue(ksmRunFile)
+	assert.NoError(err)
+	assert.Equal(uint64(1), run)
+}
+
+func TestKSMGetMemAvailablePercent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "ksm-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedProcMeminfo := procMeminfo
+	defer func() {
+		procMeminfo = savedProcMeminfo
+	}()
+
+	procMeminfo = filepath.Join(dir, "meminfo")
+
+	_, err = getMemAvailablePercent()
+	assert.Error(err)
+
+	type testData struct {
+		contents    string
+		expected    uint64
+		expectError bool
+	}
+
+	data := []testData{
+		{"", 0, true},
+		{"MemFree: 10 kB\n", 0, true},
+		{"MemTotal: foo kB\n", 0, true},
+		{"MemTotal: 1000 kB\nMemAvailable: 250 kB\n", 25, false},
+		{"MemTotal: 1000 kB\nMemFree: 100 kB\nMemAvailable: 1000 kB\n", 100, false},
+	}
+
+	for _, d := range data {
+		err = createFile(procMeminfo, d.contents)
+		assert.NoError(err)
+
+		percent, err := getMemAvailablePercent()
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, percent, "%+v", d)
+	}
+}
+
+func TestKSMPagesToScan(t *testing.T) {
+	assert := assert.New(t)
+
+	throttle := ksmThrottle{
+		minPages:  100,
+		maxPages:  1100,
+		threshold: 20,
+	}
+
+	type testData struct {
+		available uint64
+		expected  uint64
+	}
+
+	data := []testData{
+		{0, 1100},
+		{20, 1100},
+		{60, 600},
+		{100, 100},
+		{150, 100},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, throttle.pagesToScan(d.available), "%+v", d)
+	}
+}
+
+func TestKSMAdjust(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "ksm-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedKSMSysfsDir := ksmSysfsDir
+	savedProcMeminfo := procMeminfo
+	defer func() {
+		ksmSysfsDir = savedKSMSysfsDir
+		procMeminfo = savedProcMeminfo
+		testingImpl.ListPodFunc = nil
+	}()
+
+	ksmSysfsDir = dir
+	procMeminfo = filepath.Join(dir, "meminfo")
+
+	err = createKSMSysfs(dir, testKSMValues())
+	assert.NoError(err)
+
+	err = createFile(procMeminfo, "MemTotal: 1000 kB\nMemAvailable: 100 kB\n")
+	assert.NoError(err)
+
+	throttle := ksmThrottle{
+		minPages:  100,
+		maxPages:  1000,
+		threshold: 20,
+	}
+
+	// no pods: KSM is stopped
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{}, nil
+	}
+
+	err = throttle.adjust()
+	assert.NoError(err)
+
+	run, err := readKSMValue(ksmRunFile)
+	assert.NoError(err)
+	assert.Equal(uint64(0), run)
+
+	// a pod under memory pressure: maximum scan rate
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: testPodID}}, nil
+	}
+
+	err = throttle.adjust()
+	assert.NoError(err)
+
+	run, err = readKSMValue(ksmRunFile)
+	assert.NoError(err)
+	assert.Equal(uint64(1), run)
+
+	pages, err := readKSMValue(ksmPagesToScanFile)
+	assert.NoError(err)
+	assert.Equal(uint64(1000), pages)
+
+	// ListPod fails
+	testingImpl.ListPodFunc = nil
+	err = throttle.adjust()
+	assert.Error(err)
+}
+
+func TestKSMCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "ksm-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedKSMSysfsDir := ksmSysfsDir
+	savedProcMeminfo := procMeminfo
+	defer func() {
+		ksmSysfsDir = savedKSMSysfsDir
+		procMeminfo = savedProcMeminfo
+		testingImpl.ListPodFunc = nil
+	}()
+
+	ksmSysfsDir = filepath.Join(dir, "enoent")
+	procMeminfo = filepath.Join(dir, "meminfo")
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: testPodID}}, nil
+	}
+
+	err = createFile(procMeminfo, "MemTotal: 1000 kB\nMemAvailable: 1000 kB\n")
+	assert.NoError(err)
+
+	set := flag.NewFlagSet("", 0)
+	set.Uint64("min-pages", 10, "")
+	set.Uint64("max-pages", 20, "")
+	set.Uint64("threshold", 20, "")
+	set.Bool("once", true, "")
+
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+	fn, ok := ksmCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// KSM not available
+	err = fn(ctx)
+	assert.Error(err)
+
+	ksmSysfsDir = dir
+	err = createKSMSysfs(dir, testKSMValues())
+	assert.NoError(err)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	contents, err := getFileContents(filepath.Join(dir, ksmPagesToScanFile))
+	assert.NoError(err)
+	assert.Equal("10", strings.TrimSpace(contents))
+
+	// min greater than max
+	set.Set("min-pages", "100")
+	err = fn(ctx)
+	assert.Error(err)
+}
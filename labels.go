@@ -0,0 +1,243 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// labelAnnotationPrefix is the prefix of the OCI annotations setting the
+// labels of a pod: "<prefix>team=ml" gives the pod the label "team=ml".
+const labelAnnotationPrefix = ccAnnotationPrefix + "label."
+
+// labelKeyRE matches the valid label keys, as for Kubernetes labels.
+var labelKeyRE = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_./-]*[A-Za-z0-9])?$`)
+
+// metricLabelRE matches the characters not allowed in the name of a
+// metric label.
+var metricLabelRE = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func validLabel(key, value string) error {
+	if !labelKeyRE.MatchString(key) {
+		return fmt.Errorf("Invalid label key %q", key)
+	}
+
+	if strings.ContainsAny(value, ",\n") {
+		return fmt.Errorf("Invalid value %q for label %q: must not contain commas or newlines", value, key)
+	}
+
+	return nil
+}
+
+// parseLabel splits a "key=value" label. A label without value has an
+// empty value.
+func parseLabel(label string) (string, string, error) {
+	fields := strings.SplitN(label, "=", 2)
+
+	key := fields[0]
+	value := ""
+	if len(fields) == 2 {
+		value = fields[1]
+	}
+
+	if err := validLabel(key, value); err != nil {
+		return "", "", err
+	}
+
+	return key, value, nil
+}
+
+// newPodLabels returns the labels of a pod, from the OCI annotations and
+// from the "--label" options, which take precedence.
+func newPodLabels(ociSpec oci.CompatOCISpec, options []string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for name, value := range ociSpec.Annotations {
+		if !strings.HasPrefix(name, labelAnnotationPrefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(name, labelAnnotationPrefix)
+		if err := validLabel(key, value); err != nil {
+			return nil, err
+		}
+
+		labels[key] = value
+	}
+
+	for _, option := range options {
+		key, value, err := parseLabel(option)
+		if err != nil {
+			return nil, err
+		}
+
+		labels[key] = value
+	}
+
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return labels, nil
+}
+
+func setPodLabels(podID string, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return updatePodState(podID, func(state *podState) error {
+		state.Labels = labels
+		return nil
+	})
+}
+
+func loadPodLabels(podID string) (map[string]string, error) {
+	state, err := loadPodState(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.Labels, nil
+}
+
+// formatPodLabels returns the labels as a sorted, comma-separated list
+// of "key=value".
+func formatPodLabels(labels map[string]string) string {
+	var pairs []string
+	for _, key := range sortedKeys(labels) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// podMetricLabels returns the metric labels identifying a pod: its ID
+// and a "label_<key>" dimension for each of its labels.
+func podMetricLabels(podID string, labels map[string]string) map[string]string {
+	metricLabels := map[string]string{"pod": podID}
+
+	for key, value := range labels {
+		metricLabels["label_"+metricLabelRE.ReplaceAllString(key, "_")] = value
+	}
+
+	return metricLabels
+}
+
+// listFilter selects the containers whose pod has a label, optionally
+// with a specific value.
+type listFilter struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// parseListFilters parses the "--filter" options of the list command,
+// "label=<key>" or "label=<key>=<value>".
+func parseListFilters(filters []string) ([]listFilter, error) {
+	var parsed []listFilter
+
+	for _, filter := range filters {
+		fields := strings.SplitN(filter, "=", 2)
+		if len(fields) != 2 || fields[0] != "label" {
+			return nil, fmt.Errorf("Invalid filter %q: expecting label=<key>[=<value>]", filter)
+		}
+
+		label := strings.SplitN(fields[1], "=", 2)
+
+		f := listFilter{key: label[0]}
+		if len(label) == 2 {
+			f.value = label[1]
+			f.hasValue = true
+		}
+
+		if !labelKeyRE.MatchString(f.key) {
+			return nil, fmt.Errorf("Invalid filter %q: invalid label key %q", filter, f.key)
+		}
+
+		parsed = append(parsed, f)
+	}
+
+	return parsed, nil
+}
+
+func (f listFilter) match(labels map[string]string) bool {
+	value, ok := labels[f.key]
+	if !ok {
+		return false
+	}
+
+	return !f.hasValue || value == f.value
+}
+
+// matchFilters returns true if the labels match all the filters.
+func matchFilters(filters []listFilter, labels map[string]string) bool {
+	for _, f := range filters {
+		if !f.match(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterContainers returns the containers matching all the filters.
+func filterContainers(states []fullContainerState, filters []listFilter) []fullContainerState {
+	if len(filters) == 0 {
+		return states
+	}
+
+	var filtered []fullContainerState
+
+	for _, state := range states {
+		if matchFilters(filters, state.Labels) {
+			filtered = append(filtered, state)
+		}
+	}
+
+	return filtered
+}
+
+// getPodMetrics returns an information metric for each pod, carrying
+// its labels, to be joined with the other per-pod metrics.
+func getPodMetrics() ([]metric, error) {
+	podStatusList, err := vci.ListPod()
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []metric
+
+	for _, podStatus := range podStatusList {
+		labels, err := loadPodLabels(podStatus.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		metrics = append(metrics, metric{
+			name:   "pod_info",
+			help:   "Information about a pod, with its labels",
+			kind:   "gauge",
+			labels: podMetricLabels(podStatus.ID, labels),
+			value:  1,
+		})
+	}
+
+	return metrics, nil
+}
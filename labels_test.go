@@ -0,0 +1,278 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPodLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := oci.CompatOCISpec{}
+
+	labels, err := newPodLabels(spec, nil)
+	assert.NoError(err)
+	assert.Nil(labels)
+
+	spec.Annotations = map[string]string{
+		labelAnnotationPrefix + "team": "ml",
+		labelAnnotationPrefix + "app":  "trainer",
+		"unrelated":                    "annotation",
+	}
+
+	labels, err = newPodLabels(spec, []string{"app=server", "example.com/canary"})
+	assert.NoError(err)
+	assert.Equal(map[string]string{
+		"team":               "ml",
+		"app":                "server",
+		"example.com/canary": "",
+	}, labels)
+
+	for _, invalid := range []string{"", "=value", "-team=ml", "team=a,b", "te am=ml"} {
+		_, err = newPodLabels(oci.CompatOCISpec{}, []string{invalid})
+		assert.Error(err, invalid)
+	}
+
+	spec.Annotations[labelAnnotationPrefix+"bad key"] = "value"
+	_, err = newPodLabels(spec, nil)
+	assert.Error(err)
+}
+
+func TestPodLabelsState(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "labels-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	labels, err := loadPodLabels(testPodID)
+	assert.NoError(err)
+	assert.Empty(labels)
+
+	// no labels, no state
+	err = setPodLabels(testPodID, nil)
+	assert.NoError(err)
+	assert.False(fileExists(podStatePath(testPodID)))
+
+	expected := map[string]string{"team": "ml"}
+
+	err = setPodLabels(testPodID, expected)
+	assert.NoError(err)
+
+	labels, err = loadPodLabels(testPodID)
+	assert.NoError(err)
+	assert.Equal(expected, labels)
+}
+
+func TestFormatPodLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", formatPodLabels(nil))
+	assert.Equal("app=trainer,canary=,team=ml",
+		formatPodLabels(map[string]string{"team": "ml", "app": "trainer", "canary": ""}))
+}
+
+func TestPodMetricLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(map[string]string{"pod": testPodID}, podMetricLabels(testPodID, nil))
+
+	assert.Equal(map[string]string{
+		"pod":                     testPodID,
+		"label_team":              "ml",
+		"label_example_com_owner": "alice",
+	}, podMetricLabels(testPodID, map[string]string{
+		"team":              "ml",
+		"example.com/owner": "alice",
+	}))
+}
+
+func TestListFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	filters, err := parseListFilters(nil)
+	assert.NoError(err)
+	assert.Empty(filters)
+
+	for _, invalid := range []string{"team=ml", "label", "label=", "label==ml", "status=running"} {
+		_, err = parseListFilters([]string{invalid})
+		assert.Error(err, invalid)
+	}
+
+	states := []fullContainerState{
+		{containerState: containerState{ID: "1"}, Labels: map[string]string{"team": "ml", "app": "trainer"}},
+		{containerState: containerState{ID: "2"}, Labels: map[string]string{"team": "ml", "app": "server"}},
+		{containerState: containerState{ID: "3"}, Labels: map[string]string{"team": "web"}},
+		{containerState: containerState{ID: "4"}},
+	}
+
+	ids := func(states []fullContainerState) []string {
+		var ids []string
+		for _, s := range states {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	type testData struct {
+		filters  []string
+		expected []string
+	}
+
+	data := []testData{
+		{nil, []string{"1", "2", "3", "4"}},
+		{[]string{"label=team"}, []string{"1", "2", "3"}},
+		{[]string{"label=team=ml"}, []string{"1", "2"}},
+		{[]string{"label=team=ml", "label=app=server"}, []string{"2"}},
+		{[]string{"label=app="}, nil},
+		{[]string{"label=owner"}, nil},
+	}
+
+	for _, d := range data {
+		filters, err := parseListFilters(d.filters)
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, ids(filterContainers(states, filters)), "%+v", d)
+	}
+}
+
+func TestGetPodMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "labels-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		testingImpl.ListPodFunc = nil
+	}()
+
+	runtimeStateDir = dir
+
+	// ListPod fails
+	_, err = getPodMetrics()
+	assert.Error(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: "labelled"}, {ID: "plain"}}, nil
+	}
+
+	err = setPodLabels("labelled", map[string]string{"team": "ml"})
+	assert.NoError(err)
+
+	metrics, err := getPodMetrics()
+	assert.NoError(err)
+	assert.Len(metrics, 2)
+
+	assert.Equal("pod_info", metrics[0].name)
+	assert.Equal(uint64(1), metrics[0].value)
+	assert.Equal(map[string]string{"pod": "labelled", "label_team": "ml"}, metrics[0].labels)
+	assert.Equal(map[string]string{"pod": "plain"}, metrics[1].labels)
+}
+
+func TestCreateLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	pod := &vcMock.Pod{
+		MockID: testContainerID,
+		MockContainers: []*vcMock.Container{
+			{MockID: testContainerID},
+		},
+	}
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+	}()
+
+	runtimeStateDir = filepath.Join(tmpdir, "state")
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		return pod, nil
+	}
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation:    testContainerTypePod,
+		labelAnnotationPrefix + "team": "ml",
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	// invalid label
+	err = create(context.Background(), testContainerID, bundlePath, testConsole, "", true, []string{"bad key"}, runtimeConfig)
+	assert.Error(err)
+
+	err = create(context.Background(), testContainerID, bundlePath, testConsole, "", true, []string{"app=trainer"}, runtimeConfig)
+	assert.NoError(err)
+
+	labels, err := loadPodLabels(testContainerID)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"team": "ml", "app": "trainer"}, labels)
+
+	// labels belong to pods
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypeContainer,
+		testSandboxIDAnnotation:     testPodID,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = create(context.Background(), testContainerID, bundlePath, testConsole, "", true, []string{"app=trainer"}, runtimeConfig)
+	assert.Error(err)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ccruntime "github.com/clearcontainers/runtime/pkg/runtime"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// lifecycleDir is the directory below runtimeStateDir holding the
+// lifecycle of each container. The leading dot avoids clashes with pod
+// IDs.
+const lifecycleDir = ".lifecycle"
+
+// memoryOOMControlFile is the file of a cgroup v1 memory cgroup
+// counting the processes killed by the OOM killer.
+const memoryOOMControlFile = "memory.oom_control"
+
+// containerLifecycle records when a container went through each of its
+// transitions.
+type containerLifecycle = ccruntime.Lifecycle
+
+func lifecyclePath(containerID string) string {
+	return filepath.Join(runtimeStateDir, lifecycleDir, containerID+".json")
+}
+
+// loadLifecycle returns the lifecycle of the specified container. A
+// container without any recorded transition is not an error.
+func loadLifecycle(containerID string) (containerLifecycle, error) {
+	var l containerLifecycle
+
+	bytes, err := ioutil.ReadFile(lifecyclePath(containerID))
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return l, err
+	}
+
+	if err := json.Unmarshal(bytes, &l); err != nil {
+		return l, fmt.Errorf("Invalid lifecycle of container %v: %v", containerID, err)
+	}
+
+	return l, nil
+}
+
+// saveLifecycle atomically replaces the lifecycle of the specified
+// container.
+func saveLifecycle(containerID string, l containerLifecycle) error {
+	bytes, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	path := lifecyclePath(containerID)
+
+	if err := os.MkdirAll(filepath.Dir(path), podStateDirMode); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, bytes, podStateFileMode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// removeLifecycle removes the lifecycle of a deleted container.
+func removeLifecycle(containerID string) error {
+	if err := os.Remove(lifecyclePath(containerID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// shimMemoryCgroup returns the host memory cgroup the shim of a
+// container is moved to, or "" if there is none.
+func shimMemoryCgroup(ociSpec oci.CompatOCISpec, containerID string, isPod bool) (string, error) {
+	if ociSpec.Linux == nil || ociSpec.Linux.CgroupsPath == "" ||
+		ociSpec.Linux.Resources == nil || runtimeOptions.Cgroups.skip(ociSpec.Linux.Resources.Memory) {
+		return "", nil
+	}
+
+	return processCgroupsPathForResource(ociSpec, containerID, "memory", isPod)
+}
+
+// recordCreated records the creation of a container.
+func recordCreated(containerID, memoryCgroup string) error {
+	now := timeNow().UTC()
+
+	return saveLifecycle(containerID, containerLifecycle{
+		Created:      &now,
+		MemoryCgroup: memoryCgroup,
+	})
+}
+
+// recordStarted records the start, or the restart, of a container.
+func recordStarted(containerID string) error {
+	l, err := loadLifecycle(containerID)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow().UTC()
+	l.Started = &now
+	l.Finished = nil
+	l.OOMKilled = nil
+
+	return saveLifecycle(containerID, l)
+}
+
+// oomKills returns the number of processes of a memory cgroup killed by
+// the OOM killer.
+func oomKills(memoryCgroup string) (uint64, error) {
+	contents, err := getFileContents(filepath.Join(memoryCgroup, memoryOOMControlFile))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	// kernels older than 4.13 do not count the OOM kills
+	return 0, nil
+}
+
+// recordFinished records that a container was found stopped, and
+// whether it was killed by the OOM killer, unless its end was already
+// recorded. The runtime does not watch the containers, so the finish
+// time is when the runtime first found the container stopped.
+func recordFinished(containerID string) (containerLifecycle, error) {
+	l, err := loadLifecycle(containerID)
+	if err != nil || l.Finished != nil {
+		return l, err
+	}
+
+	now := timeNow().UTC()
+	l.Finished = &now
+
+	if l.MemoryCgroup != "" {
+		kills, err := oomKills(l.MemoryCgroup)
+		if err != nil {
+			ccLog.Warnf("Unable to find out whether container %v was OOM killed: %v", containerID, err)
+		} else if kills > 0 {
+			l.OOMKilled = &now
+		}
+	}
+
+	return l, saveLifecycle(containerID, l)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerLifecycle(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "lifecycle-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedTimeNow := timeNow
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		timeNow = savedTimeNow
+	}()
+
+	runtimeStateDir = dir
+
+	now := time.Date(2017, 11, 2, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	memoryCgroup := filepath.Join(dir, "memory", "pod")
+	assert.NoError(os.MkdirAll(memoryCgroup, testDirMode))
+
+	oomControl := filepath.Join(memoryCgroup, memoryOOMControlFile)
+	assert.NoError(createFile(oomControl, "oom_kill_disable 0\nunder_oom 0\noom_kill 0\n"))
+
+	// nothing recorded yet
+	l, err := loadLifecycle(testContainerID)
+	assert.NoError(err)
+	assert.Equal(containerLifecycle{}, l)
+
+	assert.NoError(recordCreated(testContainerID, memoryCgroup))
+
+	created := now
+	now = now.Add(time.Second)
+	assert.NoError(recordStarted(testContainerID))
+
+	started := now
+	now = now.Add(time.Minute)
+	l, err = recordFinished(testContainerID)
+	assert.NoError(err)
+
+	finished := now
+	assert.Equal(containerLifecycle{
+		Created:      &created,
+		Started:      &started,
+		Finished:     &finished,
+		MemoryCgroup: memoryCgroup,
+	}, l)
+
+	// the end is recorded once
+	now = now.Add(time.Minute)
+	l, err = recordFinished(testContainerID)
+	assert.NoError(err)
+	assert.Equal(&finished, l.Finished)
+
+	// restarted, then OOM killed
+	assert.NoError(recordStarted(testContainerID))
+	assert.NoError(createFile(oomControl, "oom_kill_disable 0\nunder_oom 0\noom_kill 1\n"))
+
+	restarted := now
+	now = now.Add(time.Minute)
+	l, err = recordFinished(testContainerID)
+	assert.NoError(err)
+
+	killed := now
+	assert.Equal(containerLifecycle{
+		Created:      &created,
+		Started:      &restarted,
+		Finished:     &killed,
+		OOMKilled:    &killed,
+		MemoryCgroup: memoryCgroup,
+	}, l)
+
+	saved, err := loadLifecycle(testContainerID)
+	assert.NoError(err)
+	assert.Equal(l, saved)
+
+	assert.NoError(removeLifecycle(testContainerID))
+	assert.NoError(removeLifecycle(testContainerID))
+
+	l, err = loadLifecycle(testContainerID)
+	assert.NoError(err)
+	assert.Equal(containerLifecycle{}, l)
+}
+
+func TestOOMKills(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "lifecycle-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, err = oomKills(dir)
+	assert.Error(err)
+
+	// older kernels
+	assert.NoError(createFile(filepath.Join(dir, memoryOOMControlFile), "oom_kill_disable 0\nunder_oom 0\n"))
+	kills, err := oomKills(dir)
+	assert.NoError(err)
+	assert.Equal(uint64(0), kills)
+
+	assert.NoError(createFile(filepath.Join(dir, memoryOOMControlFile), "oom_kill_disable 0\nunder_oom 0\noom_kill 3\n"))
+	kills, err = oomKills(dir)
+	assert.NoError(err)
+	assert.Equal(uint64(3), kills)
+}
+
+func TestShimMemoryCgroup(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := oci.CompatOCISpec{}
+
+	path, err := shimMemoryCgroup(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Empty(path)
+
+	spec.Linux = &specs.Linux{CgroupsPath: "pod"}
+
+	path, err = shimMemoryCgroup(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Empty(path)
+
+	spec.Linux.Resources = &specs.LinuxResources{Memory: &specs.LinuxMemory{}}
+
+	path, err = shimMemoryCgroup(spec, testContainerID, true)
+	assert.NoError(err)
+	assert.Equal(filepath.Join(cgroupsDirPath, "memory", "pod"), path)
+}
@@ -63,10 +63,13 @@ type hypervisorDetails struct {
 }
 
 // fullContainerState specifies the core state plus the hypervisor
-// details
+// details, the health, the restart count and the labels of the pod
 type fullContainerState struct {
 	containerState
 	hypervisorDetails `json:"hypervisor"`
+	Health            string            `json:"health,omitempty"`
+	Restarts          uint32            `json:"restarts,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
 }
 
 type formatState interface {
@@ -106,6 +109,10 @@ To list containers created using a non-default value for "--root":
 			Name:  "cc-all",
 			Usage: "display all available " + project + " information",
 		},
+		cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "only display the containers of the pods with a label, as label=<key>[=<value>] (may be repeated)",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		s, err := getContainers(context)
@@ -113,6 +120,13 @@ To list containers created using a non-default value for "--root":
 			return err
 		}
 
+		filters, err := parseListFilters(context.StringSlice("filter"))
+		if err != nil {
+			return err
+		}
+
+		s = filterContainers(s, filters)
+
 		file := defaultOutputFile
 		showAll := context.Bool("cc-all")
 
@@ -120,7 +134,12 @@ To list containers created using a non-default value for "--root":
 			return (&formatIDList{}).Write(s, showAll, file)
 		}
 
-		switch context.String("format") {
+		format := context.String("format")
+		if wantJSONOutput() {
+			format = "json"
+		}
+
+		switch format {
 		case "table":
 			return (&formatTabular{}).Write(s, showAll, file)
 
@@ -155,7 +174,7 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 	fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER")
 
 	if showAll {
-		fmt.Fprint(w, "\tHYPERVISOR\tKERNEL\tIMAGE\n")
+		fmt.Fprint(w, "\tHYPERVISOR\tKERNEL\tIMAGE\tHEALTH\tRESTARTS\tLABELS\n")
 	} else {
 		fmt.Fprintf(w, "\n")
 	}
@@ -170,10 +189,13 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 			item.Owner)
 
 		if showAll {
-			fmt.Fprintf(w, "\t%s\t%s\t%s\n",
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%d\t%s\n",
 				item.HypervisorPath,
 				item.KernelPath,
-				item.ImagePath)
+				item.ImagePath,
+				item.Health,
+				item.Restarts,
+				formatPodLabels(item.Labels))
 		} else {
 			fmt.Fprintf(w, "\n")
 		}
@@ -212,6 +234,32 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 			continue
 		}
 
+		health, err := getPodHealth(pod.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		restarts, err := getRestartCount(pod.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		labels, err := loadPodLabels(pod.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		podHypervisorDetails := hypervisorDetails
+
+		kernelPath, err := getPodKernel(pod.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if kernelPath != "" {
+			podHypervisorDetails.KernelPath = kernelPath
+		}
+
 		for _, container := range pod.ContainersStatus {
 			ociState := oci.StatusToOCIState(container)
 
@@ -228,7 +276,10 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 
 					// FIXME: Owner,
 				},
-				hypervisorDetails: hypervisorDetails,
+				hypervisorDetails: podHypervisorDetails,
+				Health:            health,
+				Restarts:          restarts,
+				Labels:            labels,
 			})
 		}
 	}
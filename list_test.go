@@ -57,6 +57,9 @@ var testStatuses = []fullContainerState{
 			ImagePath:      "/image/path",
 			KernelPath:     "/kernel/path",
 		},
+		Health:   "healthy",
+		Restarts: 2,
+		Labels:   map[string]string{"team": "ml", "app": "trainer"},
 	},
 	{
 		containerState: containerState{
@@ -74,6 +77,7 @@ var testStatuses = []fullContainerState{
 			ImagePath:      "/image/path2",
 			KernelPath:     "/kernel/path2",
 		},
+		Health: "unknown",
 	},
 	{
 		containerState: containerState{
@@ -91,6 +95,7 @@ var testStatuses = []fullContainerState{
 			ImagePath:      "/image/path3",
 			KernelPath:     "/kernel/path3",
 		},
+		Health: "unhealthy",
 	},
 }
 
@@ -228,7 +233,7 @@ func TestStateToTabular(t *testing.T) {
 	expectedLength := len(testStatuses) + 1
 
 	expectedDefaultHeaderPattern := `\AID\s+PID\s+STATUS\s+BUNDLE\s+CREATED\s+OWNER`
-	expectedExtendedHeaderPattern := `HYPERVISOR\s+KERNEL\s+IMAGE`
+	expectedExtendedHeaderPattern := `HYPERVISOR\s+KERNEL\s+IMAGE\s+HEALTH\s+RESTARTS\s+LABELS`
 	endingPattern := `\s*\z`
 
 	lines, err := formatListDataAsString(&formatTabular{}, testStatuses, false)
@@ -310,7 +315,7 @@ func TestStateToTabular(t *testing.T) {
 		lineIndex := i + 1
 		line := lines[lineIndex]
 
-		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s*\z`,
+		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%d\s+%s\s*\z`,
 			regexp.QuoteMeta(status.ID),
 			status.InitProcessPid,
 			regexp.QuoteMeta(status.Status),
@@ -319,7 +324,10 @@ func TestStateToTabular(t *testing.T) {
 			regexp.QuoteMeta(status.Owner),
 			regexp.QuoteMeta(status.hypervisorDetails.HypervisorPath),
 			regexp.QuoteMeta(status.hypervisorDetails.KernelPath),
-			regexp.QuoteMeta(status.hypervisorDetails.ImagePath))
+			regexp.QuoteMeta(status.hypervisorDetails.ImagePath),
+			regexp.QuoteMeta(status.Health),
+			status.Restarts,
+			regexp.QuoteMeta(formatPodLabels(status.Labels)))
 
 		expectedLineRE := regexp.MustCompile(expectedLinePattern)
 
@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Locks are files below runtimeStateDir holding the ID of the pod which
+// took them. Lock directories start with a dot to avoid clashes with pod
+// IDs.
+
+func lockPath(dir, name string) string {
+	return filepath.Join(runtimeStateDir, dir, name)
+}
+
+// lockOwner returns the ID of the pod holding the specified lock, or an
+// empty string if the lock is free.
+func lockOwner(dir, name string) (string, error) {
+	bytes, err := ioutil.ReadFile(lockPath(dir, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(bytes)), nil
+}
+
+// takeLock takes the specified lock for a pod. It returns false if the
+// lock is held by another pod, which ID is returned.
+func takeLock(dir, name, podID string) (bool, string, error) {
+	path := lockPath(dir, name)
+
+	if err := os.MkdirAll(filepath.Dir(path), podStateDirMode); err != nil {
+		return false, "", err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, podStateFileMode)
+	if os.IsExist(err) {
+		owner, err := lockOwner(dir, name)
+		if err != nil {
+			return false, "", err
+		}
+
+		return owner == podID, owner, nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	_, err = f.WriteString(podID)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path)
+		return false, "", err
+	}
+
+	return true, podID, nil
+}
+
+// releaseLocks removes the specified locks held by a pod. Locks taken
+// by other pods are never released.
+func releaseLocks(dir string, names []string, podID string) error {
+	for _, name := range names {
+		owner, err := lockOwner(dir, name)
+		if err != nil {
+			return err
+		}
+
+		if owner != podID {
+			continue
+		}
+
+		if err := os.Remove(lockPath(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
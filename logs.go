@@ -0,0 +1,699 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+const (
+	defaultContainerLogsDir = "/var/lib/clear-containers/logs"
+
+	// logFormatJSON is the format of the json-file logging driver of
+	// Docker, logFormatCRI the format of the CRI container logs.
+	logFormatJSON = "json"
+	logFormatCRI  = "cri"
+
+	// logWriterCommand is the hidden command copying the output of a
+	// container to its log file.
+	logWriterCommand = "cc-log-writer"
+
+	// maxLogLineSize is the size above which lines are split into
+	// several log entries.
+	maxLogLineSize = 16 * 1024
+
+	logDirMode  = os.FileMode(0750)
+	logFileMode = os.FileMode(0640)
+)
+
+// logPathAnnotation is the annotation giving the path of a log file the
+// output of the container is written to in the CRI format, for
+// integrations which do not collect the output themselves.
+var logPathAnnotation = ccAnnotationPrefix + "log_path"
+
+// defaultCRILogDirs is where the kubelet expects the log files of the
+// containers.
+var defaultCRILogDirs = []string{"/var/log/pods"}
+
+// variables rather than functions or constants to allow tests to modify
+// them
+var (
+	startLogWriter    = startLogWriterProcess
+	logFollowInterval = 250 * time.Millisecond
+)
+
+// containerLogs describes how the output of the containers is saved to
+// log files. Only the output of containers without a terminal is saved,
+// as the shim of the container writes it to the standard output and
+// error of the runtime.
+type containerLogs struct {
+	Enable bool `toml:"enable"`
+
+	// Dir is the directory of the log files.
+	Dir string `toml:"log_dir"`
+
+	// Format is the format of the log files.
+	Format string `toml:"format"`
+
+	// CRILogDirs are the directories below which the log path
+	// annotation of a container may point.
+	CRILogDirs []string `toml:"cri_log_dirs"`
+}
+
+func (l containerLogs) dir() string {
+	if l.Dir == "" {
+		return defaultContainerLogsDir
+	}
+
+	return l.Dir
+}
+
+func (l containerLogs) criLogDirs() []string {
+	if len(l.CRILogDirs) == 0 {
+		return defaultCRILogDirs
+	}
+
+	return l.CRILogDirs
+}
+
+func (l containerLogs) format() string {
+	if l.Format == "" {
+		return logFormatJSON
+	}
+
+	return l.Format
+}
+
+// validate checks the container logs settings.
+func (l containerLogs) validate() error {
+	if !filepath.IsAbs(l.dir()) {
+		return fmt.Errorf("Invalid container logs log_dir %q: must be an absolute path", l.Dir)
+	}
+
+	if l.format() != logFormatJSON && l.format() != logFormatCRI {
+		return fmt.Errorf("Invalid container logs format %q: expecting %q or %q", l.Format, logFormatJSON, logFormatCRI)
+	}
+
+	for _, dir := range l.CRILogDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("Invalid container logs cri_log_dirs entry %q: must be an absolute path", dir)
+		}
+	}
+
+	return nil
+}
+
+// path returns the path of the log file of the specified container.
+func (l containerLogs) path(containerID string) string {
+	return filepath.Join(l.dir(), containerID+".log")
+}
+
+// remove removes the log file of the specified container.
+func (l containerLogs) remove(containerID string) error {
+	if err := os.Remove(l.path(containerID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// annotatedPath returns the log file path given by the annotation of the
+// container, or an empty string. The path must be below one of the CRI log
+// directories, as the log writer runs with the privileges of the runtime.
+func (l containerLogs) annotatedPath(ociSpec oci.CompatOCISpec) (string, error) {
+	path := ociSpec.Annotations[logPathAnnotation]
+	if path == "" {
+		return "", nil
+	}
+
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("Invalid log path %q: must be an absolute path", path)
+	}
+
+	// The directory of the log file is created by the orchestrator.
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+
+	for _, logDir := range l.criLogDirs() {
+		if resolved, err := filepath.EvalSymlinks(logDir); err == nil {
+			logDir = resolved
+		}
+
+		if dir == logDir || strings.HasPrefix(dir, logDir+"/") {
+			return filepath.Join(dir, filepath.Base(path)), nil
+		}
+	}
+
+	return "", fmt.Errorf("Invalid log path %q: not below the cri_log_dirs %v", path, l.criLogDirs())
+}
+
+// capture starts saving the output of the container about to be created:
+// in the CRI format to the path given by its log path annotation, or to
+// its log file when the container logs are enabled.
+func (l containerLogs) capture(ociSpec oci.CompatOCISpec, containerID, console string, disableOutput bool) (func(), error) {
+	noop := func() {}
+
+	path, err := l.annotatedPath(ociSpec)
+	if err != nil {
+		return noop, err
+	}
+
+	if path == "" && !l.Enable {
+		return noop, nil
+	}
+
+	if console != "" || disableOutput {
+		ccLog.WithField("container", containerID).Info("Not saving the output of the container: it uses a terminal")
+		return noop, nil
+	}
+
+	if path != "" {
+		return captureOutput(path, logFormatCRI)
+	}
+
+	if err := os.MkdirAll(l.dir(), logDirMode); err != nil {
+		return noop, err
+	}
+
+	return captureOutput(l.path(containerID), l.format())
+}
+
+// captureOutput starts a log writer process writing to the log file path.
+// The shim of the container about to be created inherits the standard
+// output and error of the runtime: they are replaced by pipes to the log
+// writer until the returned function is called, once the container has
+// been created.
+func captureOutput(path, format string) (func(), error) {
+	noop := func() {}
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return noop, err
+	}
+
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return noop, err
+	}
+
+	err = startLogWriter(path, format, stdoutR, stderrR)
+
+	// Only the log writer reads from the pipes.
+	stdoutR.Close()
+	stderrR.Close()
+
+	if err != nil {
+		stdoutW.Close()
+		stderrW.Close()
+		return noop, err
+	}
+
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutW, stderrW
+
+	return func() {
+		os.Stdout, os.Stderr = savedStdout, savedStderr
+
+		// The shim holds its own copies.
+		stdoutW.Close()
+		stderrW.Close()
+	}, nil
+}
+
+// startLogWriterProcess starts the log writer in a new session, so that it
+// outlives the runtime. It copies the data it reads from stdout and stderr
+// to the log file and to the standard output and error of the runtime.
+func startLogWriterProcess(path, format string, stdout, stderr *os.File) error {
+	cmd := exec.Command("/proc/self/exe", logWriterCommand, "--format", format, path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{stdout, stderr}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	return cmd.Process.Release()
+}
+
+// logEntry is an entry of a log file: a line of output of a container,
+// or part of it for lines longer than maxLogLineSize.
+type logEntry struct {
+	Time   time.Time
+	Stream string
+
+	// Partial is set when the line continues in the next entry of the
+	// stream.
+	Partial bool
+
+	// Log is the output, without the end of line.
+	Log []byte
+}
+
+// jsonLogEntry is a log entry in the json-file logging driver format.
+type jsonLogEntry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// encode returns the entry as a line of a log file of the specified
+// format.
+func (e logEntry) encode(format string) ([]byte, error) {
+	if format == logFormatCRI {
+		tag := "F"
+		if e.Partial {
+			tag = "P"
+		}
+
+		return []byte(fmt.Sprintf("%s %s %s %s\n", e.Time.Format(time.RFC3339Nano), e.Stream, tag, e.Log)), nil
+	}
+
+	log := string(e.Log)
+	if !e.Partial {
+		log += "\n"
+	}
+
+	data, err := json.Marshal(jsonLogEntry{Log: log, Stream: e.Stream, Time: e.Time})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// parseLogEntry parses a line of a log file, without the end of line, in
+// either format.
+func parseLogEntry(line []byte) (logEntry, error) {
+	if bytes.HasPrefix(line, []byte("{")) {
+		var j jsonLogEntry
+
+		if err := json.Unmarshal(line, &j); err != nil {
+			return logEntry{}, err
+		}
+
+		return logEntry{
+			Time:    j.Time,
+			Stream:  j.Stream,
+			Partial: !strings.HasSuffix(j.Log, "\n"),
+			Log:     []byte(strings.TrimSuffix(j.Log, "\n")),
+		}, nil
+	}
+
+	fields := bytes.SplitN(line, []byte(" "), 4)
+	if len(fields) < 3 {
+		return logEntry{}, fmt.Errorf("Invalid log entry %q", line)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+	if err != nil {
+		return logEntry{}, err
+	}
+
+	entry := logEntry{
+		Time:    t,
+		Stream:  string(fields[1]),
+		Partial: string(fields[2]) == "P",
+	}
+
+	if len(fields) == 4 {
+		entry.Log = fields[3]
+	}
+
+	return entry, nil
+}
+
+// logWriter writes the entries of all the streams of a container to its
+// log file.
+type logWriter struct {
+	sync.Mutex
+	out    io.Writer
+	format string
+}
+
+func (w *logWriter) write(entry logEntry) error {
+	data, err := entry.encode(w.format)
+	if err != nil {
+		return err
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	_, err = w.out.Write(data)
+	return err
+}
+
+// copyStream logs the lines read from r until the end of the stream,
+// copying them to tee if not nil.
+func (w *logWriter) copyStream(stream string, r io.Reader, tee io.Writer) error {
+	reader := bufio.NewReaderSize(r, maxLogLineSize)
+
+	for {
+		line, err := reader.ReadSlice('\n')
+
+		if len(line) > 0 {
+			if tee != nil {
+				// Stop copying once the reader of the output
+				// of the runtime is gone, but keep logging.
+				if _, err := tee.Write(line); err != nil {
+					tee = nil
+				}
+			}
+
+			entry := logEntry{
+				Time:    timeNow().UTC(),
+				Stream:  stream,
+				Partial: line[len(line)-1] != '\n',
+				Log:     bytes.TrimSuffix(line, []byte("\n")),
+			}
+
+			if err := w.write(entry); err != nil {
+				return err
+			}
+		}
+
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// logStream is a stream of output of a container.
+type logStream struct {
+	name   string
+	reader io.Reader
+	tee    io.Writer
+}
+
+// copyStreams logs the streams until they all end.
+func (w *logWriter) copyStreams(streams []logStream) error {
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(streams))
+
+	for i, s := range streams {
+		wg.Add(1)
+
+		go func(i int, s logStream) {
+			defer wg.Done()
+			errs[i] = w.copyStream(s.name, s.reader, s.tee)
+		}(i, s)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logWriterRunning returns true if the log writer of the log file f is
+// still running: it holds an exclusive lock on the file.
+func logWriterRunning(f *os.File) bool {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	return false
+}
+
+// logsOptions selects the log entries shown by the logs command.
+type logsOptions struct {
+	follow bool
+
+	// since is the time of the oldest entry shown.
+	since time.Time
+
+	// tail is the number of entries shown from the end of the log
+	// file, or a negative number for all the entries.
+	tail int
+}
+
+// parseSince parses a timestamp or a duration relative to now.
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("Invalid time %q: expecting an RFC 3339 timestamp or a duration", value)
+	}
+
+	return timeNow().Add(-d), nil
+}
+
+// showLogs writes the output of the container saved in the log file f to
+// stdout and stderr. When following the log file, it waits for more
+// entries until its log writer exits.
+func showLogs(f *os.File, opts logsOptions, stdout, stderr io.Writer) error {
+	var tail []logEntry
+
+	tailing := opts.tail >= 0
+
+	show := func(e logEntry) {
+		if e.Time.Before(opts.since) {
+			return
+		}
+
+		if tailing {
+			tail = append(tail, e)
+			if len(tail) > opts.tail {
+				tail = tail[1:]
+			}
+
+			return
+		}
+
+		out := stdout
+		if e.Stream == "stderr" {
+			out = stderr
+		}
+
+		out.Write(e.Log)
+
+		if !e.Partial {
+			out.Write([]byte("\n"))
+		}
+	}
+
+	reader := bufio.NewReader(f)
+
+	// pending holds the start of an entry being written.
+	var pending []byte
+
+	readEntries := func() error {
+		for {
+			line, err := reader.ReadBytes('\n')
+			pending = append(pending, line...)
+
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			entry, err := parseLogEntry(bytes.TrimSuffix(pending, []byte("\n")))
+			pending = nil
+
+			if err != nil {
+				ccLog.Warnf("Ignoring invalid log entry in %v: %v", f.Name(), err)
+				continue
+			}
+
+			show(entry)
+		}
+	}
+
+	if err := readEntries(); err != nil {
+		return err
+	}
+
+	if tailing {
+		tailing = false
+
+		for _, e := range tail {
+			show(e)
+		}
+	}
+
+	for opts.follow {
+		// Read the last entries after the writer exited.
+		running := logWriterRunning(f)
+
+		if err := readEntries(); err != nil {
+			return err
+		}
+
+		if !running {
+			break
+		}
+
+		time.Sleep(logFollowInterval)
+	}
+
+	return nil
+}
+
+var logsCLICommand = cli.Command{
+	Name:  "logs",
+	Usage: "show the output of a container",
+	ArgsUsage: `<container-id>
+
+   <container-id> is your name for the instance of the container`,
+	Description: `The logs command shows the output of a container saved to its log file.
+   The output of the containers is only saved when container_logs are
+   enabled in the configuration file, and for containers without a
+   terminal. The log file is removed when the container is deleted.
+
+   The output of a container with a log path annotation is shown from
+   the file of the annotation instead.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow, f",
+			Usage: "keep showing the output until the container exits",
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "only show the output since an RFC 3339 timestamp or a duration (e.g. 10m)",
+		},
+		cli.IntFlag{
+			Name:  "tail",
+			Value: -1,
+			Usage: "number of lines to show from the end of the output (-1: all)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		containerID := context.Args().First()
+		if containerID == "" {
+			return errors.New("Missing container ID")
+		}
+
+		// Checks the MUST and MUST NOT from OCI runtime specification
+		status, _, err := getExistingContainerInfo(containerID)
+		if err != nil {
+			return err
+		}
+
+		opts := logsOptions{
+			follow: context.Bool("follow"),
+			tail:   context.Int("tail"),
+		}
+
+		if since := context.String("since"); since != "" {
+			if opts.since, err = parseSince(since); err != nil {
+				return err
+			}
+		}
+
+		ociSpec, err := oci.GetOCIConfig(status)
+		if err != nil {
+			return err
+		}
+
+		path, err := runtimeOptions.ContainerLogs.annotatedPath(ociSpec)
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			path = runtimeOptions.ContainerLogs.path(status.ID)
+		}
+
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("No output saved for container %v: container_logs were not enabled when it was created, or it has a terminal", status.ID)
+		} else if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return showLogs(f, opts, defaultOutputFile, defaultErrorFile)
+	},
+}
+
+var logWriterCLICommand = cli.Command{
+	Name:      logWriterCommand,
+	Hidden:    true,
+	Usage:     "save the output of a container (internal)",
+	ArgsUsage: "<log-file>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format",
+			Value: logFormatJSON,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		path := context.Args().First()
+		if path == "" {
+			return errors.New("Missing log file")
+		}
+
+		// Keep logging if the reader of the output of the runtime
+		// goes away.
+		signal.Ignore(syscall.SIGPIPE)
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFileMode)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// Let the logs command know the writer is running.
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			return err
+		}
+
+		w := &logWriter{out: f, format: context.String("format")}
+
+		// The pipes are passed as the first extra files.
+		return w.copyStreams([]logStream{
+			{name: "stdout", reader: os.NewFile(3, "stdout"), tee: os.Stdout},
+			{name: "stderr", reader: os.NewFile(4, "stderr"), tee: os.Stderr},
+		})
+	},
+}
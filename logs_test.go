@@ -0,0 +1,399 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerLogsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	l := containerLogs{}
+	assert.NoError(l.validate())
+	assert.Equal(defaultContainerLogsDir, l.dir())
+	assert.Equal(logFormatJSON, l.format())
+	assert.Equal(filepath.Join(defaultContainerLogsDir, "foo.log"), l.path("foo"))
+
+	l.Format = logFormatCRI
+	assert.NoError(l.validate())
+
+	l.Format = "syslog"
+	assert.Error(l.validate())
+
+	l = containerLogs{Dir: "logs"}
+	assert.Error(l.validate())
+}
+
+func TestLogEntryEncode(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2017, 11, 2, 10, 30, 0, 500, time.UTC)
+
+	for _, format := range []string{logFormatJSON, logFormatCRI} {
+		for _, entry := range []logEntry{
+			{Time: now, Stream: "stdout", Log: []byte("hello world")},
+			{Time: now, Stream: "stderr", Partial: true, Log: []byte("partial \"line\"")},
+			{Time: now, Stream: "stdout", Log: []byte{}},
+		} {
+			data, err := entry.encode(format)
+			assert.NoError(err)
+			assert.True(bytes.HasSuffix(data, []byte("\n")))
+
+			parsed, err := parseLogEntry(bytes.TrimSuffix(data, []byte("\n")))
+			assert.NoError(err, string(data))
+			assert.True(entry.Time.Equal(parsed.Time))
+			assert.Equal(entry.Stream, parsed.Stream)
+			assert.Equal(entry.Partial, parsed.Partial)
+			assert.Equal(string(entry.Log), string(parsed.Log))
+		}
+	}
+
+	data, err := logEntry{Time: now, Stream: "stdout", Log: []byte("hello")}.encode(logFormatCRI)
+	assert.NoError(err)
+	assert.Equal("2017-11-02T10:30:00.0000005Z stdout F hello\n", string(data))
+
+	data, err = logEntry{Time: now, Stream: "stdout", Log: []byte("hello")}.encode(logFormatJSON)
+	assert.NoError(err)
+	assert.Equal(`{"log":"hello\n","stream":"stdout","time":"2017-11-02T10:30:00.0000005Z"}`+"\n", string(data))
+
+	for _, invalid := range []string{"", "{", "2017-11-02 stdout", "yesterday stdout F hello"} {
+		_, err := parseLogEntry([]byte(invalid))
+		assert.Error(err, invalid)
+	}
+}
+
+func TestLogWriterCopyStreams(t *testing.T) {
+	assert := assert.New(t)
+
+	savedTimeNow := timeNow
+	defer func() {
+		timeNow = savedTimeNow
+	}()
+
+	now := time.Date(2017, 11, 2, 10, 30, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	var out, tee bytes.Buffer
+
+	long := strings.Repeat("x", maxLogLineSize+10)
+
+	w := &logWriter{out: &out, format: logFormatCRI}
+	assert.NoError(w.copyStreams([]logStream{
+		{name: "stdout", reader: strings.NewReader("one\n" + long + "\nunterminated"), tee: &tee},
+	}))
+
+	assert.Equal("one\n"+long+"\nunterminated", tee.String())
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Equal([]string{
+		"2017-11-02T10:30:00Z stdout F one",
+		"2017-11-02T10:30:00Z stdout P " + long[:maxLogLineSize],
+		"2017-11-02T10:30:00Z stdout F " + long[maxLogLineSize:],
+		"2017-11-02T10:30:00Z stdout P unterminated",
+	}, lines)
+
+	// both streams are logged to the same file
+	out.Reset()
+	assert.NoError(w.copyStreams([]logStream{
+		{name: "stdout", reader: strings.NewReader("out\n")},
+		{name: "stderr", reader: strings.NewReader("err\n")},
+	}))
+
+	assert.Contains(out.String(), "stdout F out\n")
+	assert.Contains(out.String(), "stderr F err\n")
+}
+
+func TestContainerLogsCapture(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "logs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedStartLogWriter := startLogWriter
+	defer func() {
+		startLogWriter = savedStartLogWriter
+	}()
+
+	var started string
+
+	startLogWriter = func(path, format string, stdout, stderr *os.File) error {
+		started = path
+		return nil
+	}
+
+	l := containerLogs{Enable: true, Dir: filepath.Join(dir, "logs")}
+
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+
+	// terminal
+	restore, err := l.capture(oci.CompatOCISpec{}, testContainerID, "/dev/pts/0", false)
+	assert.NoError(err)
+	restore()
+	assert.Empty(started)
+
+	restore, err = l.capture(oci.CompatOCISpec{}, testContainerID, "", false)
+	assert.NoError(err)
+	assert.Equal(l.path(testContainerID), started)
+	assert.True(os.Stdout != savedStdout)
+	assert.True(os.Stderr != savedStderr)
+
+	restore()
+	assert.True(os.Stdout == savedStdout)
+	assert.True(os.Stderr == savedStderr)
+	assert.True(fileExists(l.dir()))
+
+	// disabled
+	started = ""
+	l.Enable = false
+	restore, err = l.capture(oci.CompatOCISpec{}, testContainerID, "", false)
+	assert.NoError(err)
+	restore()
+	assert.Empty(started)
+
+	assert.NoError(createFile(l.path(testContainerID), ""))
+	assert.NoError(l.remove(testContainerID))
+	assert.False(fileExists(l.path(testContainerID)))
+	assert.NoError(l.remove(testContainerID))
+}
+
+func TestContainerLogsAnnotatedPath(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "logs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	podLogs := filepath.Join(dir, "pods", "pod1")
+	assert.NoError(os.MkdirAll(podLogs, testDirMode))
+	assert.NoError(os.Symlink("/etc", filepath.Join(dir, "pods", "escape")))
+
+	l := containerLogs{CRILogDirs: []string{filepath.Join(dir, "pods")}}
+	assert.NoError(l.validate())
+
+	spec := oci.CompatOCISpec{}
+
+	path, err := l.annotatedPath(spec)
+	assert.NoError(err)
+	assert.Empty(path)
+
+	spec.Annotations = map[string]string{logPathAnnotation: filepath.Join(podLogs, "container.log")}
+
+	path, err = l.annotatedPath(spec)
+	assert.NoError(err)
+	assert.Equal(filepath.Join(podLogs, "container.log"), path)
+
+	for _, invalid := range []string{
+		"container.log",
+		filepath.Join(dir, "container.log"),
+		filepath.Join(dir, "pods", "escape", "passwd"),
+		filepath.Join(dir, "pods", "missing", "container.log"),
+	} {
+		spec.Annotations[logPathAnnotation] = invalid
+		_, err = l.annotatedPath(spec)
+		assert.Error(err, invalid)
+	}
+
+	// the output is written in the CRI format even if the container
+	// logs are disabled
+	savedStartLogWriter := startLogWriter
+	defer func() {
+		startLogWriter = savedStartLogWriter
+	}()
+
+	var started, format string
+
+	startLogWriter = func(p, f string, stdout, stderr *os.File) error {
+		started, format = p, f
+		return nil
+	}
+
+	spec.Annotations[logPathAnnotation] = filepath.Join(podLogs, "container.log")
+
+	restore, err := l.capture(spec, testContainerID, "", false)
+	assert.NoError(err)
+	restore()
+	assert.Equal(filepath.Join(podLogs, "container.log"), started)
+	assert.Equal(logFormatCRI, format)
+
+	spec.Annotations[logPathAnnotation] = "container.log"
+	_, err = l.capture(spec, testContainerID, "", false)
+	assert.Error(err)
+
+	l.CRILogDirs = []string{"pods"}
+	assert.Error(l.validate())
+}
+
+func TestParseSince(t *testing.T) {
+	assert := assert.New(t)
+
+	savedTimeNow := timeNow
+	defer func() {
+		timeNow = savedTimeNow
+	}()
+
+	now := time.Date(2017, 11, 2, 10, 30, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	since, err := parseSince("2017-11-02T10:00:00Z")
+	assert.NoError(err)
+	assert.True(since.Equal(now.Add(-30 * time.Minute)))
+
+	since, err = parseSince("10m")
+	assert.NoError(err)
+	assert.True(since.Equal(now.Add(-10 * time.Minute)))
+
+	_, err = parseSince("-10m")
+	assert.Error(err)
+
+	_, err = parseSince("yesterday")
+	assert.Error(err)
+}
+
+func writeTestLogFile(t *testing.T, path string, entries []logEntry) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFileMode)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	w := &logWriter{out: f, format: logFormatJSON}
+	for _, e := range entries {
+		assert.NoError(t, w.write(e))
+	}
+}
+
+func TestShowLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "logs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2017, 11, 2, 10, 30, 0, 0, time.UTC)
+
+	path := filepath.Join(dir, "container.log")
+	writeTestLogFile(t, path, []logEntry{
+		{Time: start, Stream: "stdout", Log: []byte("one")},
+		{Time: start.Add(time.Second), Stream: "stderr", Log: []byte("error")},
+		{Time: start.Add(2 * time.Second), Stream: "stdout", Partial: true, Log: []byte("tw")},
+		{Time: start.Add(2 * time.Second), Stream: "stdout", Log: []byte("o")},
+	})
+
+	show := func(opts logsOptions) (string, string) {
+		f, err := os.Open(path)
+		assert.NoError(err)
+		defer f.Close()
+
+		var stdout, stderr bytes.Buffer
+		assert.NoError(showLogs(f, opts, &stdout, &stderr))
+
+		return stdout.String(), stderr.String()
+	}
+
+	stdout, stderr := show(logsOptions{tail: -1})
+	assert.Equal("one\ntwo\n", stdout)
+	assert.Equal("error\n", stderr)
+
+	stdout, stderr = show(logsOptions{tail: 2})
+	assert.Equal("two\n", stdout)
+	assert.Empty(stderr)
+
+	stdout, stderr = show(logsOptions{tail: 0})
+	assert.Empty(stdout)
+	assert.Empty(stderr)
+
+	stdout, stderr = show(logsOptions{tail: -1, since: start.Add(time.Second)})
+	assert.Equal("two\n", stdout)
+	assert.Equal("error\n", stderr)
+
+	// no writer running
+	stdout, _ = show(logsOptions{tail: -1, follow: true})
+	assert.Equal("one\ntwo\n", stdout)
+}
+
+func TestShowLogsFollow(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "logs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedLogFollowInterval := logFollowInterval
+	defer func() {
+		logFollowInterval = savedLogFollowInterval
+	}()
+
+	logFollowInterval = 10 * time.Millisecond
+
+	now := time.Now()
+
+	path := filepath.Join(dir, "container.log")
+	writeTestLogFile(t, path, []logEntry{{Time: now, Stream: "stdout", Log: []byte("one")}})
+
+	// act as the log writer
+	writer, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, logFileMode)
+	assert.NoError(err)
+	defer writer.Close()
+	assert.NoError(syscall.Flock(int(writer.Fd()), syscall.LOCK_EX))
+
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+
+	assert.True(logWriterRunning(f))
+
+	var stdout, stderr bytes.Buffer
+	done := make(chan error)
+
+	go func() {
+		done <- showLogs(f, logsOptions{tail: -1, follow: true}, &stdout, &stderr)
+	}()
+
+	time.Sleep(5 * logFollowInterval)
+
+	w := &logWriter{out: writer, format: logFormatJSON}
+	assert.NoError(w.write(logEntry{Time: now, Stream: "stdout", Log: []byte("two")}))
+
+	select {
+	case <-done:
+		t.Fatal("showLogs returned while the writer was running")
+	case <-time.After(5 * logFollowInterval):
+	}
+
+	assert.NoError(syscall.Flock(int(writer.Fd()), syscall.LOCK_UN))
+	assert.NoError(<-done)
+	assert.Equal("one\ntwo\n", stdout.String())
+	assert.False(logWriterRunning(f))
+}
+
+func TestLogsCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	set := flag.NewFlagSet("", 0)
+	execCLICommandFunc(assert, logsCLICommand, set, true)
+
+	execCLICommandFunc(assert, logWriterCLICommand, set, true)
+}
@@ -23,7 +23,6 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	vc "github.com/containers/virtcontainers"
-	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
 
@@ -72,6 +71,15 @@ var runtimeFlags = []cli.Flag{
 		Name:  "cc-config",
 		Usage: project + " config file path",
 	},
+	cli.StringFlag{
+		Name:   "cc-config-values",
+		Usage:  "file defining the values of the variables used in the config file",
+		EnvVar: "CC_RUNTIME_CONFIG_VALUES",
+	},
+	cli.StringFlag{
+		Name:  "cc-handler",
+		Usage: "runtime handler, selecting the configuration-<handler>.toml config file (default: the <handler> of a program named " + name + "-<handler>)",
+	},
 	cli.BoolFlag{
 		Name:  "debug",
 		Usage: "enable debug output for logging",
@@ -86,11 +94,25 @@ var runtimeFlags = []cli.Flag{
 		Value: "text",
 		Usage: "set the format used by logs ('text' (default), or 'json')",
 	},
+	cli.StringFlag{
+		Name:  "output",
+		Value: outputText,
+		Usage: "set the format of the output of the informational commands ('text' (default), or 'json')",
+	},
 	cli.StringFlag{
 		Name:  "root",
 		Value: defaultRootDirectory,
 		Usage: "root directory for storage of container state (this should be located in tmpfs)",
 	},
+	cli.StringFlag{
+		Name:  "cc-socket-dir",
+		Usage: "directory for the sockets used to communicate with the agents",
+	},
+	cli.StringFlag{
+		Name:   "cc-daemon-socket",
+		Usage:  "run the commands in the daemon listening on the specified socket",
+		EnvVar: "CC_RUNTIME_DAEMON_SOCKET",
+	},
 }
 
 // runtimeCommands is the list of supported command-line (sub-)
@@ -102,12 +124,35 @@ var runtimeCommands = []cli.Command{
 	deleteCLICommand,
 	execCLICommand,
 	killCLICommand,
+	ksmCLICommand,
 	listCLICommand,
+	metricsCLICommand,
 	runCLICommand,
 	pauseCLICommand,
 	resumeCLICommand,
 	startCLICommand,
 	stateCLICommand,
+	updateCLICommand,
+	portForwardCLICommand,
+	copyCLICommand,
+	logsCLICommand,
+	logWriterCLICommand,
+	consoleRingCLICommand,
+	eventsCLICommand,
+	idlePauseCLICommand,
+	healthCLICommand,
+	restartCLICommand,
+	migrateStateCLICommand,
+	drainCLICommand,
+	daemonCLICommand,
+	batchCLICommand,
+	snapshotCLICommand,
+	completionCLICommand,
+	installCLICommand,
+	osBuilderCLICommand,
+	debugCLICommand,
+	execAllCLICommand,
+	introspectCLICommand,
 	versionCLICommand,
 }
 
@@ -130,7 +175,14 @@ var savedCLIErrWriter = cli.ErrWriter
 // beforeSubcommands is the function to perform preliminary checks
 // before command-line parsing occurs.
 func beforeSubcommands(context *cli.Context) error {
-	if userWantsUsage(context) || (context.NArg() == 1 && (context.Args()[0] == "cc-check")) {
+	if err := setOutputFormat(context); err != nil {
+		return err
+	}
+
+	if userWantsUsage(context) || (context.NArg() == 1 && (context.Args()[0] == "cc-check")) ||
+		context.Args().First() == logWriterCommand ||
+		context.Args().First() == consoleRingCommand ||
+		isIntrospectionCommand(context.Args().First()) {
 		// No setup required if the user just
 		// wants to see the usage statement or are
 		// running a command that does not manipulate
@@ -158,6 +210,19 @@ func beforeSubcommands(context *cli.Context) error {
 		return fmt.Errorf("unknown log-format %q", context.GlobalString("log-format"))
 	}
 
+	handler, err := runtimeHandler(context, os.Args[0])
+	if err != nil {
+		return err
+	}
+
+	// Let the daemon run the command, if there is one, to avoid
+	// loading the configuration. The daemon runs with the
+	// configuration it loaded, which may not be the one of the
+	// handler.
+	if handler == "" && runInDaemon(context, os.Args[1:]) {
+		return nil
+	}
+
 	// Set virtcontainers logger.
 	vci.SetLogger(ccLog)
 
@@ -167,7 +232,14 @@ func beforeSubcommands(context *cli.Context) error {
 		ignoreLogging = true
 	}
 
-	configFile, logfilePath, runtimeConfig, err := loadConfiguration(context.GlobalString("cc-config"), ignoreLogging)
+	configValuesFile = context.GlobalString("cc-config-values")
+
+	configPath, err := runtimeConfigPath(context, handler)
+	if err != nil {
+		fatal(err)
+	}
+
+	configFile, logfilePath, runtimeConfig, err := loadConfiguration(configPath, ignoreLogging)
 	if err != nil {
 		fatal(err)
 	}
@@ -175,6 +247,22 @@ func beforeSubcommands(context *cli.Context) error {
 	ccLog.Infof("%v (version %v, commit %v) called as: %v", name, version, commit, context.Args())
 	ccLog.Infof("Using configuration file %q", configFile)
 
+	if handler != "" {
+		ccLog.Infof("Using runtime handler %q", handler)
+	}
+
+	setInstanceDirs(context, runtimeOptions)
+
+	if isRlimitCommand(context.Args().First()) {
+		if err := applyRlimits(runtimeOptions.Rlimits); err != nil {
+			fatal(err)
+		}
+
+		if err := applyHostCPUSet(runtimeOptions.HostCPUSet); err != nil {
+			fatal(err)
+		}
+	}
+
 	// make the data accessible to the sub-commands.
 	context.App.Metadata = map[string]interface{}{
 		"runtimeConfig": runtimeConfig,
@@ -195,24 +283,12 @@ func commandNotFound(c *cli.Context, command string) {
 // makeVersionString returns a multi-line string describing the runtime
 // version along with the version of the OCI specification it supports.
 func makeVersionString() string {
-	v := make([]string, 0, 3)
-
-	if version != "" {
-		v = append(v, name+"  : "+version)
-	} else {
-		v = append(v, name+"  : "+unknown)
-	}
-
-	if commit != "" {
-		v = append(v, "   commit   : "+commit)
-	} else {
-		v = append(v, "   commit   : "+unknown)
-	}
+	info := getVersionInfo()
 
-	if specs.Version != "" {
-		v = append(v, "   OCI specs: "+specs.Version)
-	} else {
-		v = append(v, "   OCI specs: "+unknown)
+	v := []string{
+		name + "  : " + info.Version,
+		"   commit   : " + info.Commit,
+		"   OCI specs: " + info.OCIVersion,
 	}
 
 	return strings.Join(v, "\n")
@@ -246,7 +322,7 @@ func createRuntimeApp(args []string) error {
 	app.CommandNotFound = runtimeCommandNotFound
 	app.Version = runtimeVersion()
 	app.Flags = runtimeFlags
-	app.Commands = runtimeCommands
+	app.Commands = timeCommands(runtimeCommands)
 	app.Before = runtimeBeforeSubcommands
 
 	return app.Run(args)
@@ -93,6 +93,14 @@ func init() {
 
 	fmt.Printf("INFO: test directory is %v\n", testDir)
 
+	// Avoid writing pod state to the default root directory
+	runtimeStateDir = filepath.Join(testDir, "state")
+
+	// Avoid running the tests again as the guest console readers
+	launchConsoleRing = func(podID string, size uint32) (int, error) {
+		return 0, nil
+	}
+
 	// Do this now to avoid hitting the test timeout value due to
 	// slow network response.
 	fmt.Printf("INFO: ensuring required docker image (%v) is available\n", testDockerImage)
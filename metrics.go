@@ -0,0 +1,156 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// metricsPrefix is the prefix used for all metric names.
+const metricsPrefix = "cc_runtime_"
+
+// metric represents a single value in the Prometheus text exposition
+// format.
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	labels map[string]string
+	value  uint64
+}
+
+// metricsCollectors is the list of functions that gather metrics. Each
+// collector returns the metrics it knows about or an error if they
+// could not be gathered.
+var metricsCollectors = []func() ([]metric, error){
+	getKSMMetrics,
+	getSharedFSMetrics,
+	getPodMetrics,
+	getNetworkMetrics,
+}
+
+func getKSMMetrics() ([]metric, error) {
+	if !ksmAvailable() {
+		// Not an error: KSM is optional
+		return nil, nil
+	}
+
+	stats, err := getKSMStats()
+	if err != nil {
+		return nil, err
+	}
+
+	var running uint64
+	if stats.Running {
+		running = 1
+	}
+
+	return []metric{
+		{name: "ksm_running", help: "Whether KSM is running on the host", kind: "gauge", value: running},
+		{name: "ksm_pages_shared", help: "Number of shared pages in use", kind: "gauge", value: stats.PagesShared},
+		{name: "ksm_pages_sharing", help: "Number of sites sharing pages", kind: "gauge", value: stats.PagesSharing},
+		{name: "ksm_pages_unshared", help: "Number of unique pages repeatedly checked for merging", kind: "gauge", value: stats.PagesUnshared},
+		{name: "ksm_pages_volatile", help: "Number of pages changing too fast to be merged", kind: "gauge", value: stats.PagesVolatile},
+		{name: "ksm_full_scans_total", help: "Number of times all mergeable areas have been scanned", kind: "counter", value: stats.FullScans},
+		{name: "ksm_saved_bytes", help: "Memory saved by KSM deduplication", kind: "gauge", value: stats.savedBytes()},
+	}, nil
+}
+
+// writeMetrics writes the specified metrics in the Prometheus text
+// exposition format.
+func writeMetrics(w io.Writer, metrics []metric) error {
+	described := make(map[string]bool)
+
+	for _, m := range metrics {
+		name := metricsPrefix + m.name
+
+		if !described[name] {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.kind); err != nil {
+				return err
+			}
+
+			described[name] = true
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(m.labels), m.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatLabels returns the labels in Prometheus form, sorted by name.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var pairs []string
+	for _, k := range sortedKeys(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func getMetrics() ([]metric, error) {
+	var all []metric
+
+	for _, collector := range metricsCollectors {
+		metrics, err := collector()
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, metrics...)
+	}
+
+	return all, nil
+}
+
+var metricsCLICommand = cli.Command{
+	Name:  "cc-metrics",
+	Usage: "display runtime metrics in Prometheus text format",
+	Action: func(context *cli.Context) error {
+		if defaultOutputFile == nil {
+			return errors.New("Invalid output file specified")
+		}
+
+		metrics, err := getMetrics()
+		if err != nil {
+			return err
+		}
+
+		return writeMetrics(defaultOutputFile, metrics)
+	},
+}
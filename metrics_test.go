@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := []metric{
+		{name: "foo", help: "foo help", kind: "gauge", value: 3},
+		{name: "bar", help: "bar help", kind: "gauge", labels: map[string]string{"b": "2", "a": "1"}, value: 1},
+		{name: "bar", help: "bar help", kind: "gauge", labels: map[string]string{"a": "3"}, value: 2},
+	}
+
+	buf := &bytes.Buffer{}
+
+	err := writeMetrics(buf, metrics)
+	assert.NoError(err)
+
+	expected := `# HELP cc_runtime_foo foo help
+# TYPE cc_runtime_foo gauge
+cc_runtime_foo 3
+# HELP cc_runtime_bar bar help
+# TYPE cc_runtime_bar gauge
+cc_runtime_bar{a="1",b="2"} 1
+cc_runtime_bar{a="3"} 2
+`
+
+	assert.Equal(expected, buf.String())
+}
+
+func TestMetricsGetKSMMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "metrics-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedKSMSysfsDir := ksmSysfsDir
+	defer func() {
+		ksmSysfsDir = savedKSMSysfsDir
+	}()
+
+	// KSM is optional
+	ksmSysfsDir = filepath.Join(dir, "enoent")
+	metrics, err := getKSMMetrics()
+	assert.NoError(err)
+	assert.Empty(metrics)
+
+	ksmSysfsDir = dir
+	err = createKSMSysfs(dir, testKSMValues())
+	assert.NoError(err)
+
+	metrics, err = getKSMMetrics()
+	assert.NoError(err)
+
+	found := false
+	for _, m := range metrics {
+		if m.name == "ksm_saved_bytes" {
+			assert.Equal(uint64(25*pageSize), m.value)
+			found = true
+		}
+	}
+
+	assert.True(found)
+}
+
+func TestMetricsCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "metrics-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, err := os.Create(filepath.Join(dir, "output"))
+	assert.NoError(err)
+	defer outputFile.Close()
+
+	savedOutputFile := defaultOutputFile
+	savedCollectors := metricsCollectors
+	defer func() {
+		defaultOutputFile = savedOutputFile
+		metricsCollectors = savedCollectors
+	}()
+
+	defaultOutputFile = outputFile
+
+	metricsCollectors = []func() ([]metric, error){
+		func() ([]metric, error) {
+			return []metric{{name: "test", help: "help", kind: "gauge", value: 42}}, nil
+		},
+	}
+
+	ctx := cli.NewContext(cli.NewApp(), nil, nil)
+
+	fn, ok := metricsCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	err = grep(fmt.Sprintf(`(?m)^%stest 42$`, metricsPrefix), outputFile.Name())
+	assert.NoError(err)
+
+	// failing collector
+	metricsCollectors = append(metricsCollectors, func() ([]metric, error) {
+		return nil, errors.New("collector failed")
+	})
+
+	err = fn(ctx)
+	assert.Error(err)
+}
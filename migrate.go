@@ -0,0 +1,231 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+)
+
+// podStateVersion is the version of the format of the pod state files
+// written by this runtime. It must be increased, and a migration added
+// to podStateMigrations, whenever podState changes in a way older
+// runtimes would misread.
+const podStateVersion = 1
+
+// podStateMigrations upgrade the contents of a pod state file: the
+// migration at index n converts a state of version n to version n+1.
+var podStateMigrations = []func(state map[string]interface{}) error{
+	// 0 -> 1: the state only gained its version.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+}
+
+// versionedPodState is the contents of a pod state file.
+type versionedPodState struct {
+	// Version is the version of the format of the file. Files
+	// written before the format was versioned have version 0.
+	Version uint32 `json:"version"`
+
+	podState
+}
+
+// incompatiblePodStateError is returned when the state of a pod was
+// written by a newer runtime.
+type incompatiblePodStateError struct {
+	podID   string
+	version uint32
+}
+
+func (e incompatiblePodStateError) Error() string {
+	return fmt.Sprintf("The state of pod %s has version %d but this runtime only supports versions up to %d: it was written by a newer runtime. Upgrade the runtime again, or delete the pod with the newer runtime before downgrading",
+		e.podID, e.version, podStateVersion)
+}
+
+func isIncompatiblePodState(err error) bool {
+	_, ok := err.(incompatiblePodStateError)
+	return ok
+}
+
+// podStateFileVersion returns the version of the decoded contents of a
+// pod state file.
+func podStateFileVersion(state map[string]interface{}) (uint32, error) {
+	value, ok := state["version"]
+	if !ok {
+		return 0, nil
+	}
+
+	version, ok := value.(float64)
+	if !ok || version < 0 || version != float64(uint32(version)) {
+		return 0, fmt.Errorf("Invalid pod state version %v", value)
+	}
+
+	return uint32(version), nil
+}
+
+// upgradePodState decodes the contents of the state file of the
+// specified pod, applying the migrations required by its version. It
+// also returns the version the file had.
+func upgradePodState(podID string, data []byte) (podState, uint32, error) {
+	var fields map[string]interface{}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return podState{}, 0, err
+	}
+
+	version, err := podStateFileVersion(fields)
+	if err != nil {
+		return podState{}, 0, err
+	}
+
+	if version > podStateVersion {
+		return podState{}, version, incompatiblePodStateError{podID: podID, version: version}
+	}
+
+	for v := version; v < podStateVersion; v++ {
+		if err := podStateMigrations[v](fields); err != nil {
+			return podState{}, version, fmt.Errorf("Unable to migrate the state of pod %s from version %d: %v",
+				podID, v, err)
+		}
+	}
+
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return podState{}, version, err
+	}
+
+	var state versionedPodState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return podState{}, version, err
+	}
+
+	return state.podState, version, nil
+}
+
+// migratePodState rewrites the state file of the specified pod in the
+// current format. It returns the version the file had.
+func migratePodState(podID string, dryRun bool) (uint32, error) {
+	lock, err := lockPodState(podID)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Close()
+
+	data, err := ioutil.ReadFile(podStatePath(podID))
+	if err != nil {
+		return 0, err
+	}
+
+	state, version, err := upgradePodState(podID, data)
+	if err != nil {
+		return version, err
+	}
+
+	if version == podStateVersion || dryRun {
+		return version, nil
+	}
+
+	return version, savePodState(podID, state)
+}
+
+// listPodStates returns the IDs of the pods which have a state file.
+func listPodStates() ([]string, error) {
+	entries, err := ioutil.ReadDir(runtimeStateDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var podIDs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if fileExists(filepath.Join(runtimeStateDir, entry.Name(), podStateFile)) {
+			podIDs = append(podIDs, entry.Name())
+		}
+	}
+
+	return podIDs, nil
+}
+
+// migrateState upgrades the state of all the pods, reporting what was
+// done for each of them.
+func migrateState(dryRun bool) error {
+	podIDs, err := listPodStates()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+
+	for _, podID := range podIDs {
+		version, err := migratePodState(podID, dryRun)
+
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(defaultOutputFile, "%s: %v\n", podID, err)
+
+		case version == podStateVersion:
+			fmt.Fprintf(defaultOutputFile, "%s: up to date (version %d)\n", podID, version)
+
+		case dryRun:
+			fmt.Fprintf(defaultOutputFile, "%s: would migrate from version %d to %d\n", podID, version, podStateVersion)
+
+		default:
+			fmt.Fprintf(defaultOutputFile, "%s: migrated from version %d to %d\n", podID, version, podStateVersion)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Unable to migrate the state of %d of %d pods", failed, len(podIDs))
+	}
+
+	return nil
+}
+
+var migrateStateCLICommand = cli.Command{
+	Name:    "cc-migrate-state",
+	Aliases: []string{"migrate-state"},
+	Usage:   "upgrade the state of the pods to the format of this runtime",
+	Description: `The cc-migrate-state command rewrites the state the runtime keeps for each
+   pod in the format used by this version of the runtime. It should be run
+   after upgrading the runtime on a node with running pods.
+
+   Although the runtime upgrades older state when reading it, migrating all
+   pods at once reports any pod whose state cannot be used, such as the
+   state written by a newer runtime, which the runtime refuses to use.
+
+   Only the state of the runtime itself is migrated, not the state kept by
+   virtcontainers.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "report what would be migrated without changing anything",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return migrateState(context.Bool("dry-run"))
+	},
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// legacyPodState is a state file written before the format was
+// versioned.
+const legacyPodState = `{"suspended":true,"suspendedAt":"1970-01-01T00:16:40Z","lastActivity":"1970-01-01T00:08:20Z"}`
+
+func writePodStateFile(podID, contents string) error {
+	dir := podStateDir(podID)
+	if err := os.MkdirAll(dir, testDirMode); err != nil {
+		return err
+	}
+
+	return createFile(filepath.Join(dir, podStateFile), contents)
+}
+
+func TestUpgradePodState(t *testing.T) {
+	assert := assert.New(t)
+
+	expected := podState{
+		IdlePaused:   true,
+		IdlePausedAt: time.Unix(1000, 0).UTC(),
+		LastActivity: time.Unix(500, 0).UTC(),
+	}
+
+	state, version, err := upgradePodState(testPodID, []byte(legacyPodState))
+	assert.NoError(err)
+	assert.Equal(uint32(0), version)
+	assert.Equal(expected, state)
+
+	state, version, err = upgradePodState(testPodID, []byte(`{"version":1,"restarts":2}`))
+	assert.NoError(err)
+	assert.Equal(uint32(1), version)
+	assert.Equal(podState{Restarts: 2}, state)
+
+	_, version, err = upgradePodState(testPodID, []byte(`{"version":1000}`))
+	assert.Error(err)
+	assert.True(isIncompatiblePodState(err))
+	assert.Equal(uint32(1000), version)
+	assert.Contains(err.Error(), testPodID)
+
+	for _, invalid := range []string{``, `[]`, `{"version":"1"}`, `{"version":-1}`, `{"version":1.5}`} {
+		_, _, err = upgradePodState(testPodID, []byte(invalid))
+		assert.Error(err, invalid)
+		assert.False(isIncompatiblePodState(err), invalid)
+	}
+}
+
+func TestPodStateVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Len(podStateMigrations, podStateVersion)
+
+	dir, err := ioutil.TempDir(testDir, "migrate-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	err = savePodState(testPodID, podState{Restarts: 1})
+	assert.NoError(err)
+
+	err = grep(`"version":1\b`, podStatePath(testPodID))
+	assert.NoError(err)
+
+	// the state of a newer runtime is refused
+	err = writePodStateFile(testPodID, `{"version":1000}`)
+	assert.NoError(err)
+
+	_, err = loadPodState(testPodID)
+	assert.True(isIncompatiblePodState(err))
+}
+
+func TestMigrateState(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "migrate-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, err := os.Create(filepath.Join(dir, "output"))
+	assert.NoError(err)
+	defer outputFile.Close()
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedOutputFile := defaultOutputFile
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		defaultOutputFile = savedOutputFile
+	}()
+
+	runtimeStateDir = filepath.Join(dir, "state")
+	defaultOutputFile = outputFile
+
+	// no pods
+	err = migrateState(false)
+	assert.NoError(err)
+
+	err = writePodStateFile("legacy", legacyPodState)
+	assert.NoError(err)
+
+	err = savePodState("current", podState{Restarts: 3})
+	assert.NoError(err)
+
+	// not a pod state
+	err = os.MkdirAll(filepath.Join(runtimeStateDir, "other"), testDirMode)
+	assert.NoError(err)
+
+	set := flag.NewFlagSet("", 0)
+	set.Bool("dry-run", true, "")
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+	fn, ok := migrateStateCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	err = grep(`(?m)^legacy: would migrate from version 0 to 1$`, outputFile.Name())
+	assert.NoError(err)
+	err = grep(`(?m)^current: up to date \(version 1\)$`, outputFile.Name())
+	assert.NoError(err)
+	err = grep(`other`, outputFile.Name())
+	assert.Error(err)
+
+	contents, err := getFileContents(podStatePath("legacy"))
+	assert.NoError(err)
+	assert.Equal(legacyPodState, contents)
+
+	set.Set("dry-run", "false")
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	err = grep(`(?m)^legacy: migrated from version 0 to 1$`, outputFile.Name())
+	assert.NoError(err)
+
+	err = grep(`"version":1\b`, podStatePath("legacy"))
+	assert.NoError(err)
+
+	state, err := loadPodState("legacy")
+	assert.NoError(err)
+	assert.True(state.IdlePaused)
+
+	// a newer runtime wrote the state
+	err = writePodStateFile("newer", `{"version":1000}`)
+	assert.NoError(err)
+
+	err = fn(ctx)
+	assert.Error(err)
+
+	err = grep(`(?m)^newer: .*newer runtime`, outputFile.Name())
+	assert.NoError(err)
+}
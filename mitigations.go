@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// mitigationsAnnotation is the OCI annotation selecting the speculative
+// execution mitigation profile of a pod.
+const mitigationsAnnotation = ccAnnotationPrefix + "mitigations"
+
+// mitigationProfile is a set of speculative execution mitigations a pod
+// may select, trading performance for isolation per workload rather
+// than for the whole node.
+type mitigationProfile struct {
+	// KernelParams are added to the kernel parameters of the guest,
+	// such as "mitigations=auto,nosmt" or "mitigations=off".
+	KernelParams string `toml:"kernel_params"`
+}
+
+// sortedMitigationProfiles returns the names of the mitigation profiles,
+// sorted to report errors consistently.
+func sortedMitigationProfiles(profiles map[string]mitigationProfile) []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// validMitigationProfiles checks the mitigation profiles of the
+// configuration and the default profile, if any.
+func validMitigationProfiles(profiles map[string]mitigationProfile, defaultProfile string) error {
+	for _, name := range sortedMitigationProfiles(profiles) {
+		if !kernelVariantNameRegex.MatchString(name) {
+			return fmt.Errorf("Invalid mitigation profile name %q", name)
+		}
+	}
+
+	if _, ok := profiles[defaultProfile]; defaultProfile != "" && !ok {
+		return fmt.Errorf("Unknown default mitigation profile %q", defaultProfile)
+	}
+
+	return nil
+}
+
+// podMitigationProfile returns the name and the settings of the
+// mitigation profile of a pod, selected by its annotation or else the
+// default profile, or "" if it has none.
+func podMitigationProfile(ociSpec oci.CompatOCISpec) (string, mitigationProfile, error) {
+	name, ok := ociSpec.Annotations[mitigationsAnnotation]
+	if !ok {
+		name = runtimeOptions.DefaultMitigations
+	}
+
+	if name == "" {
+		return "", mitigationProfile{}, nil
+	}
+
+	m, ok := runtimeOptions.Mitigations[name]
+	if !ok {
+		return "", mitigationProfile{}, fmt.Errorf("Unknown mitigation profile %q: expecting one of %v",
+			name, strings.Join(sortedMitigationProfiles(runtimeOptions.Mitigations), ", "))
+	}
+
+	return name, m, nil
+}
+
+// applyMitigationProfile applies the mitigation profile of a pod, if
+// any, to the runtime configuration used to create it.
+func applyMitigationProfile(ociSpec oci.CompatOCISpec, runtimeConfig *oci.RuntimeConfig) error {
+	name, m, err := podMitigationProfile(ociSpec)
+	if err != nil || name == "" {
+		return err
+	}
+
+	ccLog.Infof("Using mitigation profile %q", name)
+
+	for _, param := range vc.DeserializeParams(strings.Fields(m.KernelParams)) {
+		if err := runtimeConfig.AddKernelParam(param); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
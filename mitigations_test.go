@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMitigationProfiles = map[string]mitigationProfile{
+	"isolated": {
+		KernelParams: "mitigations=auto,nosmt",
+	},
+	"fast": {
+		KernelParams: "mitigations=off",
+	},
+}
+
+func TestValidMitigationProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validMitigationProfiles(nil, ""))
+	assert.NoError(validMitigationProfiles(testMitigationProfiles, ""))
+	assert.NoError(validMitigationProfiles(testMitigationProfiles, "fast"))
+
+	assert.Error(validMitigationProfiles(testMitigationProfiles, "slow"))
+	assert.Error(validMitigationProfiles(map[string]mitigationProfile{"Fast!": {}}, ""))
+}
+
+func TestApplyMitigationProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	runtimeOptions.Mitigations = testMitigationProfiles
+	runtimeOptions.DefaultMitigations = ""
+
+	spec := oci.CompatOCISpec{}
+	spec.Annotations = map[string]string{}
+
+	// no profile
+	runtimeConfig := oci.RuntimeConfig{}
+	assert.NoError(applyMitigationProfile(spec, &runtimeConfig))
+	assert.Equal(oci.RuntimeConfig{}, runtimeConfig)
+
+	// default profile
+	runtimeOptions.DefaultMitigations = "fast"
+
+	assert.NoError(applyMitigationProfile(spec, &runtimeConfig))
+	assert.Equal([]vc.Param{{Key: "mitigations", Value: "off"}}, runtimeConfig.HypervisorConfig.KernelParams)
+
+	// selected by the pod
+	spec.Annotations[mitigationsAnnotation] = "isolated"
+
+	runtimeConfig = oci.RuntimeConfig{}
+	assert.NoError(applyMitigationProfile(spec, &runtimeConfig))
+	assert.Equal([]vc.Param{{Key: "mitigations", Value: "auto,nosmt"}}, runtimeConfig.HypervisorConfig.KernelParams)
+
+	spec.Annotations[mitigationsAnnotation] = "unknown"
+
+	assert.Error(applyMitigationProfile(spec, &runtimeConfig))
+}
@@ -0,0 +1,332 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// defaultMountDeny lists the host paths that may not be shared with the
+// guest unless permitted by the mount_allow option.
+var defaultMountDeny = []string{
+	"/etc",
+	"/run/docker.sock",
+	"/var/run/docker.sock",
+}
+
+// mountDeny returns the patterns of host paths that may not be bind
+// mounted into containers.
+func (r runtime) mountDeny() []string {
+	if r.MountDeny == nil {
+		return defaultMountDeny
+	}
+
+	return r.MountDeny
+}
+
+func validMountPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if !path.IsAbs(pattern) {
+			return fmt.Errorf("Invalid mount pattern %q: must be absolute", pattern)
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid mount pattern %q", pattern)
+		}
+	}
+
+	return nil
+}
+
+// mountPatternMatch returns true if the path, or one of the directories
+// containing it, matches one of the patterns. Hence a pattern covers
+// everything below the paths it matches.
+func mountPatternMatch(patterns []string, p string) bool {
+	for p = filepath.Clean(p); ; p = filepath.Dir(p) {
+		if matchAny(patterns, p) {
+			return true
+		}
+
+		if p == "/" || p == "." {
+			return false
+		}
+	}
+}
+
+// mountPatternBelow returns true if a path matching one of the patterns
+// may lie below the path, in which case sharing the path would share it
+// too. For instance "/var/run/*.sock" lies below "/", "/var" and
+// "/var/run".
+func mountPatternBelow(patterns []string, p string) bool {
+	parts := splitPath(filepath.Clean(p))
+
+	for _, pattern := range patterns {
+		patternParts := splitPath(path.Clean(pattern))
+		if len(patternParts) <= len(parts) {
+			continue
+		}
+
+		below := true
+		for i, part := range parts {
+			if matched, _ := path.Match(patternParts[i], part); !matched {
+				below = false
+				break
+			}
+		}
+
+		if below {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitPath returns the components of an absolute, clean path.
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
+
+// pinnedMountsDir is the directory below runtimeStateDir holding, for
+// each container, a bind mount of each host path it shares. The leading
+// dot avoids clashes with pod IDs.
+const pinnedMountsDir = ".mounts"
+
+// mountSource is the host path shared by a bind mount, opened when it
+// is checked so that it cannot be replaced before it is used.
+type mountSource struct {
+	// paths are the clean source and, if it differs, the path it
+	// resolves to. Checking both prevents using ".." or symbolic links
+	// to bypass the checks.
+	paths []string
+
+	// file refers to the resolved path, opened without following
+	// symbolic links.
+	file *os.File
+}
+
+// openMountSource opens the source of a bind mount.
+func openMountSource(source string) (*mountSource, error) {
+	clean, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := filepath.EvalSymlinks(clean)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid mount source %v: %v", source, err)
+	}
+
+	// A symbolic link created since it was resolved makes this fail.
+	file, err := openPathNoFollow(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid mount source %v: %v", source, err)
+	}
+
+	s := &mountSource{paths: []string{clean}, file: file}
+	if resolved != clean {
+		s.paths = append(s.paths, resolved)
+	}
+
+	return s, nil
+}
+
+// openMountSources opens the sources of the bind mounts of a container.
+// The sources of the other mounts are nil.
+func openMountSources(ociSpec oci.CompatOCISpec) ([]*mountSource, error) {
+	sources := make([]*mountSource, len(ociSpec.Mounts))
+
+	for i, m := range ociSpec.Mounts {
+		if !isBindMount(m) {
+			continue
+		}
+
+		s, err := openMountSource(m.Source)
+		if err != nil {
+			closeMountSources(sources)
+			return nil, err
+		}
+
+		sources[i] = s
+	}
+
+	return sources, nil
+}
+
+func closeMountSources(sources []*mountSource) {
+	for _, s := range sources {
+		if s != nil {
+			s.file.Close()
+		}
+	}
+}
+
+func pinnedMountsPath(containerID string) string {
+	return filepath.Join(runtimeStateDir, pinnedMountsDir, containerID)
+}
+
+// pinMount bind mounts the opened file source on target. It is a
+// variable rather than a function to allow tests to modify it.
+var pinMount = func(source *os.File, target string) error {
+	return bindMount(fileDescriptorPath(source), target)
+}
+
+// pinMountSources bind mounts the opened sources of the bind mounts of a
+// container below the runtime state directory, and returns the
+// specification sharing these instead. virtcontainers bind mounts the
+// sources by path when the container starts: by then the checked paths
+// may have been replaced by symbolic links, but not the runtime copies.
+func pinMountSources(ociSpec oci.CompatOCISpec, containerID string, sources []*mountSource) (oci.CompatOCISpec, error) {
+	dir := pinnedMountsPath(containerID)
+
+	mounts := make([]specs.Mount, len(ociSpec.Mounts))
+	copy(mounts, ociSpec.Mounts)
+
+	for i, s := range sources {
+		if s == nil {
+			continue
+		}
+
+		if err := os.MkdirAll(dir, podStateDirMode); err != nil {
+			return ociSpec, err
+		}
+
+		info, err := s.file.Stat()
+		if err != nil {
+			return ociSpec, err
+		}
+
+		target := filepath.Join(dir, strconv.Itoa(i))
+
+		if info.IsDir() {
+			err = os.Mkdir(target, podStateDirMode)
+		} else {
+			var f *os.File
+			if f, err = os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_RDONLY, podStateFileMode); err == nil {
+				f.Close()
+			}
+		}
+		if err != nil {
+			return ociSpec, err
+		}
+
+		if err := pinMount(s.file, target); err != nil {
+			return ociSpec, fmt.Errorf("Unable to share host path %v: %v", mounts[i].Source, err)
+		}
+
+		mounts[i].Source = target
+	}
+
+	ociSpec.Mounts = mounts
+
+	return ociSpec, nil
+}
+
+// unpinMountSources removes the bind mounts of the host paths shared
+// with a container.
+func unpinMountSources(containerID string) error {
+	dir := pinnedMountsPath(containerID)
+
+	if !strings.HasPrefix(dir, filepath.Join(runtimeStateDir, pinnedMountsDir)+"/") {
+		// not below the pinned mounts directory: an invalid ID
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		target := filepath.Join(dir, entry.Name())
+
+		if err := unpinMount(target); err != nil && !isNotMountPoint(err) {
+			return err
+		}
+
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Remove(dir)
+}
+
+// unpinMount removes a bind mount made by pinMount. It is a variable
+// rather than a function to allow tests to modify it.
+var unpinMount = detachMount
+
+// isBindMount returns true if the mount shares a host path with the
+// container.
+func isBindMount(m specs.Mount) bool {
+	return m.Type == "bind" || hasBindOption(m.Options)
+}
+
+// checkHostMounts returns an error if the container bind mounts a host
+// path denied by the configuration, or a directory containing one,
+// unless it is explicitly allowed.
+// Symbolic links are resolved so that they cannot be used to bypass the
+// checks. Every decision involving a denied path is logged for auditing.
+func checkHostMounts(ociSpec oci.CompatOCISpec, sources []*mountSource, containerID string) error {
+	deny := runtimeOptions.mountDeny()
+	allow := runtimeOptions.MountAllow
+
+	for i, m := range ociSpec.Mounts {
+		if sources[i] == nil {
+			continue
+		}
+
+		for _, source := range sources[i].paths {
+			if !mountPatternMatch(deny, source) && !mountPatternBelow(deny, source) {
+				continue
+			}
+
+			audit := ccLog.WithFields(logrus.Fields{
+				"audit":       true,
+				"container":   containerID,
+				"source":      m.Source,
+				"destination": m.Destination,
+			})
+
+			if mountPatternMatch(allow, source) {
+				audit.Info("Host path mount explicitly permitted")
+				continue
+			}
+
+			audit.Warn("Host path mount rejected")
+
+			return fmt.Errorf("Mounting host path %v into the container is not permitted", m.Source)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountPatternMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	patterns := []string{"/etc", "/var/run/*.sock"}
+
+	assert.True(mountPatternMatch(patterns, "/etc"))
+	assert.True(mountPatternMatch(patterns, "/etc/"))
+	assert.True(mountPatternMatch(patterns, "/etc/ssl/certs"))
+	assert.True(mountPatternMatch(patterns, "/etc/../etc/passwd"))
+	assert.True(mountPatternMatch(patterns, "/var/run/docker.sock"))
+	assert.False(mountPatternMatch(patterns, "/etcetera"))
+	assert.False(mountPatternMatch(patterns, "/"))
+	assert.False(mountPatternMatch(patterns, "/var/run"))
+	assert.False(mountPatternMatch(nil, "/etc"))
+}
+
+func TestMountPatternBelow(t *testing.T) {
+	assert := assert.New(t)
+
+	patterns := []string{"/etc", "/var/run/*.sock"}
+
+	assert.True(mountPatternBelow(patterns, "/"))
+	assert.True(mountPatternBelow(patterns, "/var"))
+	assert.True(mountPatternBelow(patterns, "/var/run/"))
+	assert.True(mountPatternBelow(patterns, "/var/lib/../run"))
+	assert.False(mountPatternBelow(patterns, "/etc"))
+	assert.False(mountPatternBelow(patterns, "/etc/ssl"))
+	assert.False(mountPatternBelow(patterns, "/var/lib"))
+	assert.False(mountPatternBelow(patterns, "/var/run/docker.sock"))
+	assert.False(mountPatternBelow(nil, "/"))
+}
+
+func TestValidMountPatterns(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validMountPatterns(nil))
+	assert.NoError(validMountPatterns([]string{"/etc", "/srv/*"}))
+	assert.Error(validMountPatterns([]string{"etc"}))
+	assert.Error(validMountPatterns([]string{"/["}))
+
+	r := runtime{MountDeny: []string{"relative"}}
+	assert.Error(r.validate())
+
+	r = runtime{MountAllow: []string{"/["}}
+	assert.Error(r.validate())
+}
+
+// checkSpecHostMounts opens the sources of the bind mounts of spec and
+// checks them.
+func checkSpecHostMounts(spec oci.CompatOCISpec) error {
+	sources, err := openMountSources(spec)
+	if err != nil {
+		return err
+	}
+	defer closeMountSources(sources)
+
+	return checkHostMounts(spec, sources, testContainerID)
+}
+
+func TestCheckHostMounts(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "mounts-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	runtimeOptions = runtime{}
+	assert.Equal(defaultMountDeny, runtimeOptions.mountDeny())
+
+	hosts := filepath.Join(dir, "hosts")
+	assert.NoError(createEmptyFile(hosts))
+
+	var spec oci.CompatOCISpec
+
+	spec.Mounts = []specs.Mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/etc/hosts", Type: "bind", Source: hosts},
+	}
+	assert.NoError(checkSpecHostMounts(spec))
+
+	// denied by default
+	for _, m := range []specs.Mount{
+		{Destination: "/host", Type: "bind", Source: "/etc"},
+		{Destination: "/host", Source: "/etc/../etc", Options: []string{"rbind"}},
+		{Destination: "/host", Type: "bind", Source: "/"},
+		{Destination: "/host", Type: "bind", Source: "/run"},
+		{Destination: "/host", Type: "bind", Source: "/var/run"},
+	} {
+		spec.Mounts = []specs.Mount{m}
+		assert.Error(checkSpecHostMounts(spec), "%+v", m)
+	}
+
+	// symbolic links are resolved
+	link := filepath.Join(dir, "link")
+	err = os.Symlink("/etc", link)
+	assert.NoError(err)
+
+	spec.Mounts = []specs.Mount{{Destination: "/host", Type: "bind", Source: link}}
+	assert.Error(checkSpecHostMounts(spec))
+
+	// explicitly allowed
+	runtimeOptions.MountAllow = []string{"/etc"}
+	assert.NoError(checkSpecHostMounts(spec))
+
+	// deny list disabled
+	runtimeOptions = runtime{MountDeny: []string{}}
+	spec.Mounts = []specs.Mount{{Destination: "/host", Type: "bind", Source: "/etc"}}
+	assert.NoError(checkSpecHostMounts(spec))
+
+	runtimeOptions = runtime{MountDeny: []string{dir}}
+	spec.Mounts = []specs.Mount{{Destination: "/host", Type: "bind", Source: hosts}}
+	assert.Error(checkSpecHostMounts(spec))
+
+	// sources which do not exist are refused
+	runtimeOptions = runtime{}
+	spec.Mounts = []specs.Mount{{Destination: "/host", Type: "bind", Source: filepath.Join(dir, "foo")}}
+	assert.Error(checkSpecHostMounts(spec))
+}
+
+func TestOpenMountSources(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "mounts-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data")
+	assert.NoError(os.Mkdir(data, testDirMode))
+
+	link := filepath.Join(dir, "link")
+	assert.NoError(os.Symlink(data, link))
+
+	var spec oci.CompatOCISpec
+	spec.Mounts = []specs.Mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/data", Type: "bind", Source: data + "/"},
+		{Destination: "/link", Source: link, Options: []string{"rbind"}},
+	}
+
+	sources, err := openMountSources(spec)
+	assert.NoError(err)
+	defer closeMountSources(sources)
+
+	assert.Len(sources, 3)
+	assert.Nil(sources[0])
+	assert.Equal([]string{data}, sources[1].paths)
+	assert.Equal([]string{link, data}, sources[2].paths)
+
+	// the opened sources designate the resolved paths, even once a
+	// path is replaced by a symbolic link
+	assert.NoError(os.Rename(data, data+".old"))
+	assert.NoError(os.Symlink("/etc", data))
+
+	for _, s := range sources[1:] {
+		info, err := os.Stat(fileDescriptorPath(s.file))
+		assert.NoError(err)
+
+		old, err := os.Stat(data + ".old")
+		assert.NoError(err)
+		assert.True(os.SameFile(old, info))
+	}
+
+	// a path with a symbolic link is not opened
+	_, err = openPathNoFollow(filepath.Join(data, "passwd"))
+	assert.Error(err)
+	_, err = openPathNoFollow(data)
+	assert.Error(err)
+}
+
+func TestPinMountSources(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "mounts-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir, savedPin, savedUnpin := runtimeStateDir, pinMount, unpinMount
+	defer func() {
+		runtimeStateDir, pinMount, unpinMount = savedRuntimeStateDir, savedPin, savedUnpin
+	}()
+
+	runtimeStateDir = filepath.Join(dir, "state")
+
+	pinned := map[string]string{}
+	pinMount = func(source *os.File, target string) error {
+		pinned[target] = source.Name()
+		return nil
+	}
+	var unpinned []string
+	unpinMount = func(target string) error {
+		unpinned = append(unpinned, target)
+		return nil
+	}
+
+	hosts := filepath.Join(dir, "hosts")
+	assert.NoError(createEmptyFile(hosts))
+
+	spec := oci.CompatOCISpec{}
+	spec.Mounts = []specs.Mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/data", Type: "bind", Source: dir},
+		{Destination: "/etc/hosts", Type: "bind", Source: hosts},
+	}
+
+	sources, err := openMountSources(spec)
+	assert.NoError(err)
+	defer closeMountSources(sources)
+
+	pinnedSpec, err := pinMountSources(spec, testContainerID, sources)
+	assert.NoError(err)
+
+	// the original specification is left alone
+	assert.Equal(dir, spec.Mounts[1].Source)
+
+	assert.Equal("proc", pinnedSpec.Mounts[0].Source)
+
+	for i, source := range []string{dir, hosts} {
+		target := pinnedSpec.Mounts[i+1].Source
+		assert.Equal(filepath.Join(pinnedMountsPath(testContainerID), strconv.Itoa(i+1)), target)
+		assert.Equal(source, pinned[target])
+	}
+
+	info, err := os.Stat(pinnedSpec.Mounts[1].Source)
+	assert.NoError(err)
+	assert.True(info.IsDir())
+
+	info, err = os.Stat(pinnedSpec.Mounts[2].Source)
+	assert.NoError(err)
+	assert.False(info.IsDir())
+
+	assert.NoError(unpinMountSources(testContainerID))
+	assert.Equal([]string{pinnedSpec.Mounts[1].Source, pinnedSpec.Mounts[2].Source}, unpinned)
+	assert.False(fileExists(pinnedMountsPath(testContainerID)))
+
+	// nothing left to remove
+	assert.NoError(unpinMountSources(testContainerID))
+	assert.NoError(unpinMountSources("../" + testContainerID))
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// Strategies for the root filesystems on network filesystems, which
+// cannot be reliably shared with the guest over 9p.
+const (
+	// networkFSRefuse refuses to create the container.
+	networkFSRefuse = "refuse"
+
+	// networkFSCopy copies the root filesystem to a local directory
+	// and shares the copy with the guest.
+	networkFSCopy = "copy"
+
+	// networkFSAllow shares the root filesystem with the guest anyway.
+	networkFSAllow = "allow"
+)
+
+const (
+	defaultNetworkFSStrategy = networkFSRefuse
+	defaultRootfsCopyDir     = "/var/lib/clear-containers/rootfs"
+
+	rootfsCopyDirMode = os.FileMode(0700)
+)
+
+// networkFSTypes are the types of the network filesystems.
+var networkFSTypes = map[string]bool{
+	"nfs":            true,
+	"nfs4":           true,
+	"cifs":           true,
+	"smb3":           true,
+	"smbfs":          true,
+	"ceph":           true,
+	"glusterfs":      true,
+	"fuse.glusterfs": true,
+	"fuse.sshfs":     true,
+	"lustre":         true,
+	"afs":            true,
+}
+
+// copyRootfsTree copies a root filesystem, preserving the ownership,
+// permissions, links and special files. It is a variable rather than a
+// function to allow tests to modify it.
+var copyRootfsTree = func(src, dst string) error {
+	if out, err := runCommandFull([]string{"cp", "-a", "--", src + "/.", dst}, true); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+
+	return nil
+}
+
+// networkFS describes how the root filesystems on network filesystems,
+// such as kubelet root directories on NFS, are handled.
+type networkFS struct {
+	// Strategy is "refuse" (default), "copy" or "allow".
+	Strategy string `toml:"strategy"`
+
+	// CopyDir is the directory below which the root filesystems are
+	// copied with the "copy" strategy.
+	CopyDir string `toml:"copy_dir"`
+
+	// MaxCopySize is the size in bytes of the largest root filesystem
+	// copied (default: no limit).
+	MaxCopySize uint64 `toml:"max_copy_size"`
+}
+
+func (n networkFS) strategy() string {
+	if n.Strategy == "" {
+		return defaultNetworkFSStrategy
+	}
+
+	return n.Strategy
+}
+
+func (n networkFS) copyDir() string {
+	if n.CopyDir == "" {
+		return defaultRootfsCopyDir
+	}
+
+	return n.CopyDir
+}
+
+// validate checks the network filesystem settings.
+func (n networkFS) validate() error {
+	switch n.strategy() {
+	case networkFSRefuse, networkFSCopy, networkFSAllow:
+	default:
+		return fmt.Errorf("Invalid network filesystem strategy %q (valid: %s, %s, %s)",
+			n.Strategy, networkFSRefuse, networkFSCopy, networkFSAllow)
+	}
+
+	if !filepath.IsAbs(n.copyDir()) {
+		return fmt.Errorf("Invalid network filesystem copy_dir %q: must be an absolute path", n.CopyDir)
+	}
+
+	return nil
+}
+
+// networkFSPath returns the first of the specified paths on a network
+// filesystem and the type of that filesystem, or "" if there is none.
+func networkFSPath(mounts []mountEntry, paths []string) (string, string) {
+	for _, p := range paths {
+		m, err := findMount(mounts, p)
+		if err != nil {
+			continue
+		}
+
+		if networkFSTypes[m.fsType] {
+			return p, m.fsType
+		}
+	}
+
+	return "", ""
+}
+
+// rootfsBackingPaths returns the directories holding the contents of a
+// root filesystem: the root filesystem itself and, for an overlay, its
+// layers.
+func rootfsBackingPaths(mounts []mountEntry, rootfs string) ([]string, error) {
+	paths := []string{rootfs}
+
+	lowerDirs, err := overlayLowerDirs(mounts, rootfs)
+	if err != nil || len(lowerDirs) == 0 {
+		return paths, err
+	}
+
+	upperDir, err := writableLayerDir(mounts, rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(paths, upperDir), lowerDirs...), nil
+}
+
+func (n networkFS) rootfsCopyPath(containerID string) string {
+	return filepath.Join(n.copyDir(), containerID)
+}
+
+// prepare applies the network filesystem strategy to the root filesystem
+// of a container, returning the OCI specification to create it with.
+func (n networkFS) prepare(ociSpec oci.CompatOCISpec, containerID, bundlePath string) (oci.CompatOCISpec, error) {
+	rootfs, err := filepath.EvalSymlinks(rootfsPath(ociSpec, bundlePath))
+	if err != nil {
+		return ociSpec, err
+	}
+
+	mounts, err := getMounts()
+	if err != nil {
+		return ociSpec, err
+	}
+
+	paths, err := rootfsBackingPaths(mounts, rootfs)
+	if err != nil {
+		return ociSpec, err
+	}
+
+	path, fsType := networkFSPath(mounts, paths)
+	if path == "" {
+		return ociSpec, nil
+	}
+
+	switch n.strategy() {
+	case networkFSAllow:
+		warn(warningNetworkFS, "Root filesystem %v of container %v is on a %s network filesystem: sharing it with the guest may fail",
+			path, containerID, fsType)
+		return ociSpec, nil
+	case networkFSRefuse:
+		return ociSpec, fmt.Errorf("Root filesystem %v is on a %s network filesystem, which cannot be shared with the guest: move it to a local filesystem or set the network_fs strategy to %q",
+			path, fsType, networkFSCopy)
+	}
+
+	if n.MaxCopySize != 0 {
+		size, err := treeSize(rootfs)
+		if err != nil {
+			return ociSpec, err
+		}
+
+		if size > n.MaxCopySize {
+			return ociSpec, fmt.Errorf("Root filesystem %v on a %s network filesystem is too large to be copied: %d bytes (maximum %d)",
+				rootfs, fsType, size, n.MaxCopySize)
+		}
+	}
+
+	dst := n.rootfsCopyPath(containerID)
+
+	if err := os.MkdirAll(n.copyDir(), rootfsCopyDirMode); err != nil {
+		return ociSpec, err
+	}
+
+	if err := os.Mkdir(dst, rootfsCopyDirMode); err != nil {
+		return ociSpec, err
+	}
+
+	ccLog.Infof("Copying root filesystem %v of container %v from a %s network filesystem to %v", rootfs, containerID, fsType, dst)
+
+	if err := copyRootfsTree(rootfs, dst); err != nil {
+		os.RemoveAll(dst)
+		return ociSpec, fmt.Errorf("Unable to copy root filesystem %v: %v", rootfs, err)
+	}
+
+	ociSpec.Root.Path = dst
+
+	return ociSpec, nil
+}
+
+// remove removes the copy of the root filesystem of a container, if any.
+func (n networkFS) remove(containerID string) error {
+	dst := n.rootfsCopyPath(containerID)
+
+	if !strings.HasPrefix(dst, n.copyDir()+"/") {
+		// not below the copy directory: an invalid ID
+		return nil
+	}
+
+	return os.RemoveAll(dst)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkFSValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(networkFS{}.validate())
+	assert.Equal(networkFSRefuse, networkFS{}.strategy())
+	assert.Equal(defaultRootfsCopyDir, networkFS{}.copyDir())
+
+	for _, s := range []string{networkFSRefuse, networkFSCopy, networkFSAllow} {
+		assert.NoError(networkFS{Strategy: s}.validate(), s)
+	}
+
+	assert.Error(networkFS{Strategy: "block"}.validate())
+	assert.Error(networkFS{CopyDir: "rootfs"}.validate())
+}
+
+func TestNetworkFSPath(t *testing.T) {
+	assert := assert.New(t)
+
+	mounts := []mountEntry{
+		{mountPoint: "/", fsType: "ext4"},
+		{mountPoint: "/var/lib/kubelet", fsType: "nfs4"},
+		{mountPoint: "/var/lib/docker/overlay2/abc/merged", fsType: "overlay",
+			options: []string{"rw", "lowerdir=/mnt/smb/l1:/var/lib/docker/l2", "upperdir=/var/lib/docker/u", "workdir=/var/lib/docker/w"}},
+		{mountPoint: "/mnt/smb", fsType: "cifs"},
+	}
+
+	path, fsType := networkFSPath(mounts, []string{"/bundle/rootfs"})
+	assert.Empty(path)
+	assert.Empty(fsType)
+
+	path, fsType = networkFSPath(mounts, []string{"/bundle/rootfs", "/var/lib/kubelet/pods/x/rootfs"})
+	assert.Equal("/var/lib/kubelet/pods/x/rootfs", path)
+	assert.Equal("nfs4", fsType)
+
+	paths, err := rootfsBackingPaths(mounts, "/var/lib/docker/overlay2/abc/merged")
+	assert.NoError(err)
+	assert.Equal([]string{
+		"/var/lib/docker/overlay2/abc/merged",
+		"/var/lib/docker/u",
+		"/mnt/smb/l1",
+		"/var/lib/docker/l2",
+	}, paths)
+
+	path, fsType = networkFSPath(mounts, paths)
+	assert.Equal("/mnt/smb/l1", path)
+	assert.Equal("cifs", fsType)
+
+	paths, err = rootfsBackingPaths(mounts, "/bundle/rootfs")
+	assert.NoError(err)
+	assert.Equal([]string{"/bundle/rootfs"}, paths)
+}
+
+func TestNetworkFSPrepare(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "netfs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedProcMounts := procMounts
+	savedCopyRootfsTree := copyRootfsTree
+	defer func() {
+		procMounts = savedProcMounts
+		copyRootfsTree = savedCopyRootfsTree
+	}()
+
+	copyRootfsTree = func(src, dst string) error {
+		return createFile(filepath.Join(dst, "copied"), src)
+	}
+
+	bundlePath := filepath.Join(dir, "bundle")
+	rootfs := filepath.Join(bundlePath, "rootfs")
+	assert.NoError(os.MkdirAll(rootfs, testDirMode))
+	assert.NoError(createFile(filepath.Join(rootfs, "file"), "12345"))
+
+	procMounts = filepath.Join(dir, "mounts")
+	assert.NoError(createFile(procMounts, "/dev/sda1 / ext4 rw 0 0\n"))
+
+	spec := oci.CompatOCISpec{}
+	spec.Root.Path = "rootfs"
+
+	n := networkFS{CopyDir: filepath.Join(dir, "copies")}
+
+	// local root filesystem
+	result, err := n.prepare(spec, testContainerID, bundlePath)
+	assert.NoError(err)
+	assert.Equal(spec, result)
+
+	assert.NoError(createFile(procMounts, fmt.Sprintf("/dev/sda1 / ext4 rw 0 0\nserver:/export %s nfs4 rw 0 0\n", bundlePath)))
+
+	_, err = n.prepare(spec, testContainerID, bundlePath)
+	assert.Error(err)
+
+	n.Strategy = networkFSAllow
+	result, err = n.prepare(spec, testContainerID, bundlePath)
+	assert.NoError(err)
+	assert.Equal(spec, result)
+
+	n.Strategy = networkFSCopy
+	n.MaxCopySize = 4
+	_, err = n.prepare(spec, testContainerID, bundlePath)
+	assert.Error(err)
+
+	n.MaxCopySize = 0
+	result, err = n.prepare(spec, testContainerID, bundlePath)
+	assert.NoError(err)
+
+	copyPath := filepath.Join(n.CopyDir, testContainerID)
+	assert.Equal(copyPath, result.Root.Path)
+
+	contents, err := getFileContents(filepath.Join(copyPath, "copied"))
+	assert.NoError(err)
+	assert.Equal(rootfs, contents)
+
+	// already copied
+	_, err = n.prepare(spec, testContainerID, bundlePath)
+	assert.Error(err)
+
+	assert.NoError(n.remove(testContainerID))
+	assert.False(fileExists(copyPath))
+	assert.NoError(n.remove(testContainerID))
+
+	// failed copy
+	copyRootfsTree = func(src, dst string) error {
+		return errors.New("copy failed")
+	}
+
+	_, err = n.prepare(spec, testContainerID, bundlePath)
+	assert.Error(err)
+	assert.False(fileExists(copyPath))
+}
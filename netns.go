@@ -0,0 +1,257 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+// netNSDir is the directory, below the runtime state directory, holding
+// the private references to the network namespaces joined by the pods.
+const netNSDir = ".netns"
+
+// healthEventNetNSReclaimed is the type of the health event reporting
+// the release of the network namespace of a deleted pod.
+const healthEventNetNSReclaimed = "netns-reclaimed"
+
+// The interfaces of a joined network namespace are scanned every
+// netNSPollInterval, and considered complete once they have not changed
+// for netNSSettleTime. They are variables to allow tests to modify them.
+var (
+	netNSPollInterval = 100 * time.Millisecond
+	netNSSettleTime   = time.Second
+)
+
+// netNSInterfaces returns the sorted names of the interfaces of the
+// specified network namespace, but the loopback. It fails if the path is
+// not a network namespace. It is a variable rather than a function to
+// allow tests to modify it.
+var netNSInterfaces = func(path string) ([]string, error) {
+	netNS, err := ns.GetNS(path)
+	if err != nil {
+		return nil, err
+	}
+	defer netNS.Close()
+
+	var names []string
+
+	err = netNS.Do(func(ns.NetNS) error {
+		ifaces, err := net.Interfaces()
+		if err != nil {
+			return err
+		}
+
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagLoopback == 0 {
+				names = append(names, iface.Name)
+			}
+		}
+
+		return nil
+	})
+
+	sort.Strings(names)
+
+	return names, err
+}
+
+// bindNetNS makes target a reference to the network namespace source.
+// It is a variable rather than a function to allow tests to modify it.
+var bindNetNS = func(source, target string) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_RDONLY, podStateFileMode)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return bindMount(source, target)
+}
+
+// unbindNetNS removes a reference to a network namespace. It is a
+// variable rather than a function to allow tests to modify it.
+var unbindNetNS = func(target string) error {
+	if err := detachMount(target); err != nil && !isNotMountPoint(err) {
+		return err
+	}
+
+	return nil
+}
+
+// netNS describes how the pods join the network namespaces created by
+// their callers, such as the CNI plugins of a CRI implementation.
+type netNS struct {
+	// GracePeriod is how long the creation of a pod waits for the
+	// interfaces of its network namespace to appear, for slow network
+	// plugins (default: no wait).
+	GracePeriod string `toml:"grace_period"`
+}
+
+func (n netNS) gracePeriod() time.Duration {
+	return parseTimeout(n.GracePeriod, 0)
+}
+
+// validate checks the network namespace settings.
+func (n netNS) validate() error {
+	if n.GracePeriod == "" {
+		return nil
+	}
+
+	if d, err := time.ParseDuration(n.GracePeriod); err != nil || d < 0 {
+		return fmt.Errorf("Invalid network namespace grace_period %q", n.GracePeriod)
+	}
+
+	return nil
+}
+
+// waitInterfaces returns the interfaces of the specified network
+// namespace, once they have stopped changing or the grace period has
+// elapsed. The VM is given the interfaces present when it is created:
+// later ones are not added to it.
+func (n netNS) waitInterfaces(ctx context.Context, path string) ([]string, error) {
+	ifaces, err := netNSInterfaces(path)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid network namespace %v: %v", path, err)
+	}
+
+	deadline := time.Now().Add(n.gracePeriod())
+	changed := time.Now()
+
+	for time.Now().Before(deadline) {
+		if len(ifaces) > 0 && time.Since(changed) >= netNSSettleTime {
+			return ifaces, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(netNSPollInterval):
+		}
+
+		current, err := netNSInterfaces(path)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid network namespace %v: %v", path, err)
+		}
+
+		if !reflect.DeepEqual(current, ifaces) {
+			ccLog.Debugf("Interfaces of network namespace %v: %v", path, current)
+			ifaces = current
+			changed = time.Now()
+		}
+	}
+
+	if len(ifaces) == 0 && n.gracePeriod() > 0 {
+		warn(warningNetNSNoInterface, "No interface appeared in network namespace %v within %v", path, n.gracePeriod())
+	}
+
+	return ifaces, nil
+}
+
+func podNetNSPath(podID string) string {
+	return filepath.Join(runtimeStateDir, netNSDir, podID)
+}
+
+// join waits for the interfaces of the network namespace of a pod, and
+// returns a private reference to the namespace, for virtcontainers,
+// which removes the namespace of a pod when deleting it: the namespace
+// of the caller is left alone.
+func (n netNS) join(ctx context.Context, podID, path string) (string, error) {
+	ifaces, err := n.waitInterfaces(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	ccLog.Infof("Pod %v joins network namespace %v with interfaces %v", podID, path, ifaces)
+
+	private := podNetNSPath(podID)
+
+	if err := os.MkdirAll(filepath.Dir(private), podStateDirMode); err != nil {
+		return "", err
+	}
+
+	if err := bindNetNS(path, private); err != nil {
+		os.Remove(private)
+		return "", fmt.Errorf("Unable to join network namespace %v: %v", path, err)
+	}
+
+	return private, nil
+}
+
+// removePodNetNS removes the private reference to the network namespace
+// of a pod, if virtcontainers left it.
+func removePodNetNS(podID string) error {
+	path := podNetNSPath(podID)
+
+	if !fileExists(path) {
+		return nil
+	}
+
+	if err := unbindNetNS(path); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// reclaimPodNetNS removes the network namespace references left behind
+// by the pods which no longer exist, such as pods whose deletion failed
+// half way, so that the namespaces and the tap devices virtcontainers
+// created in them are released. Pods being created are left alone. It
+// returns the IDs of the pods whose reference was removed.
+func reclaimPodNetNS(pods map[string]bool) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(runtimeStateDir, netNSDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var reclaimed []string
+
+	for _, entry := range entries {
+		podID := entry.Name()
+		if pods[podID] {
+			continue
+		}
+
+		if _, err := os.Stat(createMarkerPath(podID)); err == nil {
+			if stale, err := staleCreate(podID); err != nil || !stale {
+				continue
+			}
+		}
+
+		if err := removePodNetNS(podID); err != nil {
+			ccLog.Warnf("Unable to reclaim the network namespace of pod %v: %v", podID, err)
+			continue
+		}
+
+		reclaimed = append(reclaimed, podID)
+	}
+
+	return reclaimed, nil
+}
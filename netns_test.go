@@ -0,0 +1,218 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetNSValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, grace := range []string{"", "0", "5s", "1m"} {
+		assert.NoError(netNS{GracePeriod: grace}.validate(), grace)
+	}
+
+	for _, grace := range []string{"5", "-1s", "soon"} {
+		assert.Error(netNS{GracePeriod: grace}.validate(), grace)
+	}
+
+	assert.Equal(time.Duration(0), netNS{}.gracePeriod())
+	assert.Equal(5*time.Second, netNS{GracePeriod: "5s"}.gracePeriod())
+}
+
+// setupNetNSTest makes netNSInterfaces return the specified scans in
+// turn, the last one repeatedly.
+func setupNetNSTest(scans [][]string, err error) func() {
+	savedInterfaces, savedPoll, savedSettle := netNSInterfaces, netNSPollInterval, netNSSettleTime
+
+	netNSPollInterval = time.Millisecond
+	netNSSettleTime = 5 * time.Millisecond
+
+	netNSInterfaces = func(path string) ([]string, error) {
+		if err != nil {
+			return nil, err
+		}
+
+		ifaces := scans[0]
+		if len(scans) > 1 {
+			scans = scans[1:]
+		}
+
+		return ifaces, nil
+	}
+
+	return func() {
+		netNSInterfaces, netNSPollInterval, netNSSettleTime = savedInterfaces, savedPoll, savedSettle
+	}
+}
+
+func TestNetNSWaitInterfaces(t *testing.T) {
+	assert := assert.New(t)
+
+	// no grace period: the interfaces present are used.
+	restore := setupNetNSTest([][]string{nil, {"eth0"}}, nil)
+	ifaces, err := netNS{}.waitInterfaces(context.Background(), "/netns")
+	assert.NoError(err)
+	assert.Empty(ifaces)
+	restore()
+
+	// late interfaces are waited for.
+	restore = setupNetNSTest([][]string{nil, nil, {"eth0"}, {"eth0", "eth1"}}, nil)
+	ifaces, err = netNS{GracePeriod: "10s"}.waitInterfaces(context.Background(), "/netns")
+	assert.NoError(err)
+	assert.Equal([]string{"eth0", "eth1"}, ifaces)
+	restore()
+
+	// the grace period bounds the wait.
+	restore = setupNetNSTest([][]string{nil}, nil)
+	ifaces, err = netNS{GracePeriod: "20ms"}.waitInterfaces(context.Background(), "/netns")
+	assert.NoError(err)
+	assert.Empty(ifaces)
+	restore()
+
+	restore = setupNetNSTest([][]string{nil}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = netNS{GracePeriod: "10s"}.waitInterfaces(ctx, "/netns")
+	assert.Equal(context.Canceled, err)
+	restore()
+
+	restore = setupNetNSTest(nil, errors.New("not a network namespace"))
+	_, err = netNS{}.waitInterfaces(context.Background(), "/netns")
+	assert.Error(err)
+	restore()
+}
+
+func TestNetNSInterfacesInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "netns-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, err = netNSInterfaces(filepath.Join(dir, "missing"))
+	assert.Error(err)
+
+	path := filepath.Join(dir, "file")
+	assert.NoError(createEmptyFile(path))
+
+	_, err = netNSInterfaces(path)
+	assert.Error(err)
+}
+
+func TestNetNSJoin(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "netns-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir, savedBind, savedUnbind := runtimeStateDir, bindNetNS, unbindNetNS
+	defer func() {
+		runtimeStateDir, bindNetNS, unbindNetNS = savedRuntimeStateDir, savedBind, savedUnbind
+	}()
+
+	runtimeStateDir = dir
+
+	defer setupNetNSTest([][]string{{"eth0"}}, nil)()
+
+	bindErr := errors.New("bind failed")
+	bindNetNS = func(source, target string) error {
+		if err := createEmptyFile(target); err != nil {
+			return err
+		}
+
+		return bindErr
+	}
+
+	var unbound []string
+	unbindNetNS = func(target string) error {
+		unbound = append(unbound, target)
+		return nil
+	}
+
+	_, err = netNS{}.join(context.Background(), testPodID, "/var/run/netns/cni")
+	assert.Error(err)
+	assert.False(fileExists(podNetNSPath(testPodID)))
+
+	bindErr = nil
+
+	private, err := netNS{}.join(context.Background(), testPodID, "/var/run/netns/cni")
+	assert.NoError(err)
+	assert.Equal(podNetNSPath(testPodID), private)
+	assert.True(fileExists(private))
+
+	assert.NoError(removePodNetNS(testPodID))
+	assert.Equal([]string{private}, unbound)
+	assert.False(fileExists(private))
+
+	// virtcontainers already removed it.
+	assert.NoError(removePodNetNS(testPodID))
+	assert.Len(unbound, 1)
+}
+
+func TestReclaimPodNetNS(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "netns-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir, savedUnbind, savedAlive := runtimeStateDir, unbindNetNS, processAlive
+	defer func() {
+		runtimeStateDir, unbindNetNS, processAlive = savedRuntimeStateDir, savedUnbind, savedAlive
+	}()
+
+	runtimeStateDir = dir
+	unbindNetNS = func(target string) error {
+		return nil
+	}
+
+	reclaimed, err := reclaimPodNetNS(nil)
+	assert.NoError(err)
+	assert.Empty(reclaimed)
+
+	for _, podID := range []string{"running", "creating", "deleted", "crashed"} {
+		assert.NoError(os.MkdirAll(filepath.Dir(podNetNSPath(podID)), testDirMode))
+		assert.NoError(createEmptyFile(podNetNSPath(podID)))
+	}
+
+	assert.NoError(os.MkdirAll(filepath.Dir(createMarkerPath("creating")), testDirMode))
+	assert.NoError(ioutil.WriteFile(createMarkerPath("creating"), []byte(strconv.Itoa(os.Getpid())), testFileMode))
+	assert.NoError(ioutil.WriteFile(createMarkerPath("crashed"), []byte("999999"), testFileMode))
+
+	processAlive = func(pid int) bool {
+		return pid == os.Getpid()
+	}
+
+	reclaimed, err = reclaimPodNetNS(map[string]bool{"running": true})
+	assert.NoError(err)
+	assert.Equal([]string{"crashed", "deleted"}, reclaimed)
+
+	assert.True(fileExists(podNetNSPath("running")))
+	assert.True(fileExists(podNetNSPath("creating")))
+	assert.False(fileExists(podNetNSPath("deleted")))
+	assert.False(fileExists(podNetNSPath("crashed")))
+}
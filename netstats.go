@@ -0,0 +1,207 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/vishvananda/netlink"
+)
+
+// netStats are the statistics of a network interface. The JSON form is
+// the one of the "events" command of runc.
+type netStats struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// variable rather than a function to allow tests to modify it
+var netNSStats = getNetNSStats
+
+// networkNamespacePath returns the path of the network namespace of an
+// OCI spec, or an empty string if virtcontainers creates the namespace.
+func networkNamespacePath(ociSpec oci.CompatOCISpec) string {
+	if ociSpec.Linux != nil {
+		for _, n := range ociSpec.Linux.Namespaces {
+			if n.Type == specs.NetworkNamespace {
+				return n.Path
+			}
+		}
+	}
+
+	return ""
+}
+
+// containerNetNSPath returns the path of the network namespace of a
+// container, read from its bundle.
+func containerNetNSPath(status vc.ContainerStatus) (string, error) {
+	ociSpec, err := oci.ParseConfigJSON(status.Annotations[oci.BundlePathKey])
+	if err != nil {
+		return "", err
+	}
+
+	return networkNamespacePath(ociSpec), nil
+}
+
+// getNetNSStats returns the statistics of the tap devices of the
+// specified network namespace, which connect the VM of a pod to the
+// network. Received and transmitted are from the point of view of the
+// host: what the host receives, the guest transmits.
+func getNetNSStats(path string) ([]netStats, error) {
+	netNS, err := ns.GetNS(path)
+	if err != nil {
+		return nil, err
+	}
+	defer netNS.Close()
+
+	var stats []netStats
+
+	err = netNS.Do(func(ns.NetNS) error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+
+		for _, link := range links {
+			attrs := link.Attrs()
+			if link.Type() != "tuntap" || attrs.Statistics == nil {
+				continue
+			}
+
+			stats = append(stats, netStats{
+				Name:      attrs.Name,
+				RxBytes:   attrs.Statistics.RxBytes,
+				RxPackets: attrs.Statistics.RxPackets,
+				RxErrors:  attrs.Statistics.RxErrors,
+				RxDropped: attrs.Statistics.RxDropped,
+				TxBytes:   attrs.Statistics.TxBytes,
+				TxPackets: attrs.Statistics.TxPackets,
+				TxErrors:  attrs.Statistics.TxErrors,
+				TxDropped: attrs.Statistics.TxDropped,
+			})
+		}
+
+		return nil
+	})
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	return stats, err
+}
+
+// containerNetStats returns the network statistics of the pod of a
+// container, or nothing if the network namespace of the pod is not
+// known.
+func containerNetStats(status vc.ContainerStatus) ([]netStats, error) {
+	path, err := containerNetNSPath(status)
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	return netNSStats(path)
+}
+
+// podNetStatsContainer returns the container holding the network
+// configuration of a pod: the pod container, named after the pod.
+func podNetStatsContainer(podStatus vc.PodStatus) (vc.ContainerStatus, bool) {
+	for _, status := range podStatus.ContainersStatus {
+		if status.ID == podStatus.ID {
+			return status, true
+		}
+	}
+
+	if len(podStatus.ContainersStatus) > 0 {
+		return podStatus.ContainersStatus[0], true
+	}
+
+	return vc.ContainerStatus{}, false
+}
+
+// networkMetrics describes the network metrics and how to get their
+// value from the statistics of an interface.
+var networkMetrics = []struct {
+	name  string
+	help  string
+	value func(netStats) uint64
+}{
+	{"network_receive_bytes_total", "Bytes received by the host from the guest", func(s netStats) uint64 { return s.RxBytes }},
+	{"network_receive_packets_total", "Packets received by the host from the guest", func(s netStats) uint64 { return s.RxPackets }},
+	{"network_receive_drops_total", "Packets from the guest dropped by the host", func(s netStats) uint64 { return s.RxDropped }},
+	{"network_transmit_bytes_total", "Bytes transmitted by the host to the guest", func(s netStats) uint64 { return s.TxBytes }},
+	{"network_transmit_packets_total", "Packets transmitted by the host to the guest", func(s netStats) uint64 { return s.TxPackets }},
+	{"network_transmit_drops_total", "Packets to the guest dropped by the host", func(s netStats) uint64 { return s.TxDropped }},
+}
+
+func getNetworkMetrics() ([]metric, error) {
+	podStatusList, err := vci.ListPod()
+	if err != nil {
+		return nil, err
+	}
+
+	// The samples of a metric must be grouped together.
+	families := make([][]metric, len(networkMetrics))
+
+	for _, podStatus := range podStatusList {
+		status, ok := podNetStatsContainer(podStatus)
+		if !ok {
+			continue
+		}
+
+		stats, err := containerNetStats(status)
+		if err != nil {
+			// Not fatal: the pod may be going away.
+			ccLog.Warnf("Unable to get network statistics of pod %v: %v", podStatus.ID, err)
+			continue
+		}
+
+		podLabels, err := loadPodLabels(podStatus.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range stats {
+			labels := podMetricLabels(podStatus.ID, podLabels)
+			labels["interface"] = s.Name
+
+			for i, m := range networkMetrics {
+				families[i] = append(families[i], metric{
+					name:   m.name,
+					help:   m.help,
+					kind:   "counter",
+					labels: labels,
+					value:  m.value(s),
+				})
+			}
+		}
+	}
+
+	var metrics []metric
+	for _, family := range families {
+		metrics = append(metrics, family...)
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeNetNSBundle creates an OCI bundle joining the network namespace
+// with the specified path.
+func makeNetNSBundle(assert *assert.Assertions, dir, netNSPath string) string {
+	bundlePath := filepath.Join(dir, "bundle")
+	assert.NoError(makeOCIBundle(bundlePath))
+
+	configPath := filepath.Join(bundlePath, "config.json")
+	spec, err := readOCIConfigFile(configPath)
+	assert.NoError(err)
+
+	for i, n := range spec.Linux.Namespaces {
+		if n.Type == specs.NetworkNamespace {
+			spec.Linux.Namespaces[i].Path = netNSPath
+		}
+	}
+
+	assert.NoError(writeOCIConfigFile(spec, configPath))
+
+	return bundlePath
+}
+
+func TestNetworkNamespacePath(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := oci.CompatOCISpec{}
+	assert.Empty(networkNamespacePath(spec))
+
+	spec.Linux = &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{
+			{Type: specs.PIDNamespace, Path: "/proc/1/ns/pid"},
+			{Type: specs.NetworkNamespace},
+		},
+	}
+
+	// virtcontainers creates the namespace when there is no path
+	assert.Empty(networkNamespacePath(spec))
+
+	spec.Linux.Namespaces[1].Path = "/var/run/netns/pod"
+	assert.Equal("/var/run/netns/pod", networkNamespacePath(spec))
+}
+
+func TestContainerNetStats(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "netstats-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedNetNSStats := netNSStats
+	defer func() {
+		netNSStats = savedNetNSStats
+	}()
+
+	var statsPath string
+	netNSStats = func(path string) ([]netStats, error) {
+		statsPath = path
+		return []netStats{{Name: "tap0", RxBytes: 1}}, nil
+	}
+
+	status := vc.ContainerStatus{
+		Annotations: map[string]string{
+			oci.BundlePathKey: filepath.Join(dir, "enoent"),
+		},
+	}
+
+	_, err = containerNetStats(status)
+	assert.Error(err)
+
+	status.Annotations[oci.BundlePathKey] = makeNetNSBundle(assert, dir, "/var/run/netns/pod")
+
+	stats, err := containerNetStats(status)
+	assert.NoError(err)
+	assert.Equal("/var/run/netns/pod", statsPath)
+	assert.Equal([]netStats{{Name: "tap0", RxBytes: 1}}, stats)
+}
+
+func TestGetNetNSStats(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := getNetNSStats("/enoent/netns")
+	assert.Error(err)
+}
+
+func TestPodNetStatsContainer(t *testing.T) {
+	assert := assert.New(t)
+
+	_, ok := podNetStatsContainer(vc.PodStatus{ID: testPodID})
+	assert.False(ok)
+
+	podStatus := vc.PodStatus{
+		ID: testPodID,
+		ContainersStatus: []vc.ContainerStatus{
+			{ID: testContainerID},
+			{ID: testPodID},
+		},
+	}
+
+	status, ok := podNetStatsContainer(podStatus)
+	assert.True(ok)
+	assert.Equal(testPodID, status.ID)
+
+	podStatus.ContainersStatus = podStatus.ContainersStatus[:1]
+
+	status, ok = podNetStatsContainer(podStatus)
+	assert.True(ok)
+	assert.Equal(testContainerID, status.ID)
+}
+
+func TestGetNetworkMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "netstats-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedNetNSStats := netNSStats
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		netNSStats = savedNetNSStats
+	}()
+
+	runtimeStateDir = filepath.Join(dir, "state")
+
+	netNSStats = func(path string) ([]netStats, error) {
+		return []netStats{
+			{Name: "tap0", RxBytes: 10, TxBytes: 20},
+			{Name: "tap1", RxBytes: 30, TxBytes: 40},
+		}, nil
+	}
+
+	bundlePath := makeNetNSBundle(assert, dir, "/var/run/netns/pod")
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testPodID,
+						Annotations: map[string]string{
+							oci.BundlePathKey: bundlePath,
+						},
+					},
+				},
+			},
+			{
+				// the bundle of this pod is gone
+				ID: "gone",
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: "gone"},
+				},
+			},
+		}, nil
+	}
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	metrics, err := getNetworkMetrics()
+	assert.NoError(err)
+	assert.Len(metrics, 12)
+
+	// the samples of a metric are grouped
+	assert.Equal("network_receive_bytes_total", metrics[0].name)
+	assert.Equal("network_receive_bytes_total", metrics[1].name)
+	assert.Equal(map[string]string{"pod": testPodID, "interface": "tap1"}, metrics[1].labels)
+	assert.Equal(uint64(30), metrics[1].value)
+	assert.Equal("network_transmit_bytes_total", metrics[6].name)
+	assert.Equal(uint64(20), metrics[6].value)
+}
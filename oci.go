@@ -21,7 +21,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
@@ -49,6 +48,10 @@ var (
 
 var cgroupsDirPath = "/sys/fs/cgroup"
 
+// ccAnnotationPrefix is the prefix of the OCI annotations understood by
+// the runtime.
+const ccAnnotationPrefix = "com.github.clearcontainers.runtime."
+
 // getContainerInfo returns the container status and its pod ID.
 // It internally expands the container ID from the prefix provided.
 // An error is returned if >1 containers are found with the specified
@@ -67,13 +70,18 @@ func getContainerInfo(containerID string) (vc.ContainerStatus, string, error) {
 		return vc.ContainerStatus{}, "", err
 	}
 
-	matchFound := false
+	// An exact match wins over prefix matches.
 	for _, podStatus := range podStatusList {
 		for _, containerStatus := range podStatus.ContainersStatus {
 			if containerStatus.ID == containerID {
 				return containerStatus, podStatus.ID, nil
 			}
+		}
+	}
 
+	matchFound := false
+	for _, podStatus := range podStatusList {
+		for _, containerStatus := range podStatus.ContainersStatus {
 			if strings.HasPrefix(containerStatus.ID, containerID) {
 				if matchFound {
 					return vc.ContainerStatus{}, "", errPrefixContIDNotUnique
@@ -108,21 +116,16 @@ func getExistingContainerInfo(containerID string) (vc.ContainerStatus, string, e
 }
 
 func validCreateParams(containerID, bundlePath string) (string, error) {
-	// container ID MUST be provided.
-	if containerID == "" {
-		return "", fmt.Errorf("Missing container ID")
+	// container ID MUST be provided and valid.
+	if err := validateID("container", containerID); err != nil {
+		return "", err
 	}
 
 	// container ID MUST be unique.
-	cStatus, _, err := getContainerInfo(containerID)
-	if err != nil {
+	if err := checkIDAvailable(containerID); err != nil {
 		return "", err
 	}
 
-	if cStatus.ID != "" {
-		return "", fmt.Errorf("ID already in use, unique ID should be provided")
-	}
-
 	// bundle path MUST be provided.
 	if bundlePath == "" {
 		return "", fmt.Errorf("Missing bundle path")
@@ -148,7 +151,7 @@ func validCreateParams(containerID, bundlePath string) (string, error) {
 // processCgroupsPath process the cgroups path as expected from the
 // OCI runtime specification. It returns a list of complete paths
 // that should be created and used for every specified resource.
-func processCgroupsPath(ociSpec oci.CompatOCISpec, isPod bool) ([]string, error) {
+func processCgroupsPath(ociSpec oci.CompatOCISpec, containerID string, isPod bool) ([]string, error) {
 	var cgroupsPathList []string
 
 	if ociSpec.Linux.CgroupsPath == "" {
@@ -159,58 +162,49 @@ func processCgroupsPath(ociSpec oci.CompatOCISpec, isPod bool) ([]string, error)
 		return []string{}, nil
 	}
 
-	if ociSpec.Linux.Resources.Memory != nil {
-		memCgroupsPath, err := processCgroupsPathForResource(ociSpec, "memory", isPod)
-		if err != nil {
-			return []string{}, err
-		}
+	resources := ociSpec.Linux.Resources
 
-		if memCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, memCgroupsPath)
+	for _, r := range []struct {
+		name      string
+		resources interface{}
+	}{
+		{"memory", resources.Memory},
+		{"cpu", resources.CPU},
+		{"pids", resources.Pids},
+		{"blkio", resources.BlockIO},
+	} {
+		if runtimeOptions.Cgroups.skip(r.resources) {
+			continue
 		}
-	}
 
-	if ociSpec.Linux.Resources.CPU != nil {
-		cpuCgroupsPath, err := processCgroupsPathForResource(ociSpec, "cpu", isPod)
+		cgroupsPath, err := processCgroupsPathForResource(ociSpec, containerID, r.name, isPod)
 		if err != nil {
 			return []string{}, err
 		}
 
-		if cpuCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, cpuCgroupsPath)
-		}
-	}
-
-	if ociSpec.Linux.Resources.Pids != nil {
-		pidsCgroupsPath, err := processCgroupsPathForResource(ociSpec, "pids", isPod)
-		if err != nil {
-			return []string{}, err
-		}
-
-		if pidsCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, pidsCgroupsPath)
-		}
-	}
-
-	if ociSpec.Linux.Resources.BlockIO != nil {
-		blkIOCgroupsPath, err := processCgroupsPathForResource(ociSpec, "blkio", isPod)
-		if err != nil {
-			return []string{}, err
-		}
-
-		if blkIOCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, blkIOCgroupsPath)
+		if cgroupsPath != "" {
+			cgroupsPathList = append(cgroupsPathList, cgroupsPath)
 		}
 	}
 
 	return cgroupsPathList, nil
 }
 
-func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, isPod bool) (string, error) {
+func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, containerID, resource string, isPod bool) (string, error) {
 	if resource == "" {
 		return "", errNeedLinuxResource
 	}
 
+	// Path set by the configuration, below the root of the controller.
+	templatePath, err := runtimeOptions.Cgroups.expand(ociSpec, containerID, isPod)
+	if err != nil {
+		return "", err
+	}
+
+	if templatePath != "" {
+		return filepath.Join(cgroupsDirPath, resource, templatePath), nil
+	}
+
 	// Relative cgroups path provided.
 	if filepath.IsAbs(ociSpec.Linux.CgroupsPath) == false {
 		return filepath.Join(cgroupsDirPath, resource, ociSpec.Linux.CgroupsPath), nil
@@ -257,20 +251,6 @@ func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, i
 	return filepath.Join(cgroupPath, ociSpec.Linux.CgroupsPath), nil
 }
 
-func isCgroupMounted(cgroupPath string) bool {
-	var statFs syscall.Statfs_t
-
-	if err := syscall.Statfs(cgroupPath, &statFs); err != nil {
-		return false
-	}
-
-	if statFs.Type != int64(cgroupFsType) {
-		return false
-	}
-
-	return true
-}
-
 func setupConsole(consolePath, consoleSockPath string) (string, error) {
 	if consolePath != "" {
 		return consolePath, nil
@@ -321,3 +301,13 @@ func noNeedForOutput(detach bool, tty bool) bool {
 
 	return true
 }
+
+// rootfsPath returns the absolute path of the container root
+// filesystem.
+func rootfsPath(ociSpec oci.CompatOCISpec, bundlePath string) string {
+	if filepath.IsAbs(ociSpec.Root.Path) {
+		return ociSpec.Root.Path
+	}
+
+	return filepath.Join(bundlePath, ociSpec.Root.Path)
+}
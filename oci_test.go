@@ -154,6 +154,36 @@ func TestGetContainerInfo(t *testing.T) {
 	assert.Equal(podID, pod.ID())
 	assert.Equal(status, containerStatus)
 }
+
+func TestGetContainerInfoExactMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	// the exact match comes after containers matching the prefix
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: "pod1",
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: testContainerID + "1"},
+					{ID: testContainerID + "2"},
+				},
+			},
+			{
+				ID:               "pod2",
+				ContainersStatus: []vc.ContainerStatus{{ID: testContainerID}},
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	status, podID, err := getContainerInfo(testContainerID)
+	assert.NoError(err)
+	assert.Equal("pod2", podID)
+	assert.Equal(testContainerID, status.ID)
+}
 func TestValidCreateParamsContainerIDEmptyFailure(t *testing.T) {
 	assert := assert.New(t)
 	_, err := validCreateParams("", "")
@@ -246,6 +276,32 @@ func TestValidCreateParamsContainerIDNotUnique2(t *testing.T) {
 	assert.False(vcMock.IsMockError(err))
 }
 
+func TestValidCreateParamsIDInUse(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: testContainerID}}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	_, err = validCreateParams(testContainerID, tmpdir)
+	assert.True(isIDInUse(err))
+
+	_, err = validCreateParams("../"+testContainerID, tmpdir)
+	assert.Error(err)
+	assert.False(isIDInUse(err))
+
+	_, err = validCreateParams(testContainerID+"2", tmpdir)
+	assert.NoError(err)
+}
+
 func TestValidCreateParamsInvalidBundle(t *testing.T) {
 	assert := assert.New(t)
 
@@ -296,7 +352,7 @@ func TestValidCreateParamsBundleIsAFile(t *testing.T) {
 
 func testProcessCgroupsPath(t *testing.T, ociSpec oci.CompatOCISpec, expected []string) {
 	assert := assert.New(t)
-	result, err := processCgroupsPath(ociSpec, true)
+	result, err := processCgroupsPath(ociSpec, testContainerID, true)
 
 	assert.NoError(err)
 
@@ -357,7 +413,7 @@ func TestProcessCgroupsPathAbsoluteNoCgroupMountFailure(t *testing.T) {
 	for _, d := range cgroupTestData {
 		ociSpec.Linux.Resources = d.linuxSpec
 
-		_, err := processCgroupsPath(ociSpec, true)
+		_, err := processCgroupsPath(ociSpec, testContainerID, true)
 		assert.Error(err, "This test should fail because no cgroup mount provided (%+v)", d)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -382,7 +438,7 @@ func TestProcessCgroupsPathAbsoluteNoCgroupMountDestinationFailure(t *testing.T)
 		},
 	}
 
-	_, err := processCgroupsPath(ociSpec, true)
+	_, err := processCgroupsPath(ociSpec, testContainerID, true)
 	assert.Error(err, "This test should fail because no cgroup mount destination provided")
 }
 
@@ -561,7 +617,7 @@ func TestProcessCgroupsPathForResource(t *testing.T) {
 	assert.NoError(err)
 
 	for _, isPod := range []bool{true, false} {
-		_, err := processCgroupsPathForResource(spec, "", isPod)
+		_, err := processCgroupsPathForResource(spec, testContainerID, "", isPod)
 		assert.Error(err)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -0,0 +1,187 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// The OOM annotations of a pod sandbox override the [runtime.oom]
+// settings of the configuration file for the pod.
+const (
+	oomScoreAdjAnnotation    = ccAnnotationPrefix + "oom.score_adj"
+	oomKillDisableAnnotation = ccAnnotationPrefix + "oom.kill_disable"
+	oomPanicAnnotation       = ccAnnotationPrefix + "oom.panic"
+)
+
+// Guest kernel parameters applying the OOM settings of a pod. The agent
+// applies its parameters to the workloads it starts.
+const (
+	oomScoreAdjParam    = "agent.oom_score_adj"
+	oomKillDisableParam = "agent.oom_kill_disable"
+	panicOnOOMParam     = "sysctl.vm.panic_on_oom"
+)
+
+const (
+	minOOMScoreAdj = -1000
+	maxOOMScoreAdj = 1000
+)
+
+// guestOOM describes how the guest of a pod handles running out of
+// memory. Containers share the guest, so the settings apply to all the
+// containers of the pod.
+type guestOOM struct {
+	// ScoreAdj is the oom_score_adj of the workloads in the guest.
+	ScoreAdj int `toml:"score_adj"`
+
+	// KillDisable disables the OOM killer for the workloads: they
+	// block until memory is freed.
+	KillDisable bool `toml:"kill_disable"`
+
+	// Panic panics the guest kernel on OOM. The VM then stops rather
+	// than run with some of its processes killed.
+	Panic bool `toml:"panic"`
+}
+
+func validOOMScoreAdj(scoreAdj int) error {
+	if scoreAdj < minOOMScoreAdj || scoreAdj > maxOOMScoreAdj {
+		return fmt.Errorf("Invalid OOM score adjustment %d: expecting %d to %d",
+			scoreAdj, minOOMScoreAdj, maxOOMScoreAdj)
+	}
+
+	return nil
+}
+
+// validate checks the OOM settings.
+func (o guestOOM) validate() error {
+	return validOOMScoreAdj(o.ScoreAdj)
+}
+
+// kernelParams returns the guest kernel parameters applying the OOM
+// settings.
+func (o guestOOM) kernelParams() []vc.Param {
+	var params []vc.Param
+
+	if o.ScoreAdj != 0 {
+		params = append(params, vc.Param{Key: oomScoreAdjParam, Value: strconv.Itoa(o.ScoreAdj)})
+	}
+
+	if o.KillDisable {
+		params = append(params, vc.Param{Key: oomKillDisableParam, Value: "1"})
+	}
+
+	if o.Panic {
+		params = append(params, vc.Param{Key: panicOnOOMParam, Value: "1"})
+	}
+
+	return params
+}
+
+// podOOM returns the OOM settings of a pod: the configuration file
+// settings, overridden by the OCI resources of the pod sandbox, then by
+// its annotations.
+func podOOM(ociSpec oci.CompatOCISpec) (guestOOM, error) {
+	o := runtimeOptions.OOM
+
+	if ociSpec.Linux != nil && ociSpec.Linux.Resources != nil {
+		resources := ociSpec.Linux.Resources
+
+		if resources.OOMScoreAdj != nil {
+			o.ScoreAdj = *resources.OOMScoreAdj
+		}
+
+		if resources.DisableOOMKiller != nil {
+			o.KillDisable = *resources.DisableOOMKiller
+		}
+	}
+
+	if value, ok := ociSpec.Annotations[oomScoreAdjAnnotation]; ok {
+		scoreAdj, err := strconv.Atoi(value)
+		if err != nil {
+			return guestOOM{}, fmt.Errorf("Invalid OOM score adjustment %q: %v", value, err)
+		}
+
+		o.ScoreAdj = scoreAdj
+	}
+
+	for annotation, setting := range map[string]*bool{
+		oomKillDisableAnnotation: &o.KillDisable,
+		oomPanicAnnotation:       &o.Panic,
+	} {
+		value, ok := ociSpec.Annotations[annotation]
+		if !ok {
+			continue
+		}
+
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return guestOOM{}, fmt.Errorf("Invalid %s annotation %q: %v", annotation, value, err)
+		}
+
+		*setting = enabled
+	}
+
+	if err := o.validate(); err != nil {
+		return guestOOM{}, err
+	}
+
+	return o, nil
+}
+
+// applyGuestOOM applies the OOM settings of a pod to the runtime
+// configuration used to create it.
+func applyGuestOOM(ociSpec oci.CompatOCISpec, runtimeConfig *oci.RuntimeConfig) error {
+	o, err := podOOM(ociSpec)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range o.kernelParams() {
+		if err := runtimeConfig.AddKernelParam(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkContainerOOM warns about the OOM settings of a container of a
+// pod, which cannot be applied to the container alone, or refuses them
+// in strict mode.
+func checkContainerOOM(ociSpec oci.CompatOCISpec, strict bool) error {
+	if ociSpec.Linux == nil || ociSpec.Linux.Resources == nil {
+		return nil
+	}
+
+	resources := ociSpec.Linux.Resources
+
+	if resources.OOMScoreAdj == nil && resources.DisableOOMKiller == nil {
+		return nil
+	}
+
+	message := "The OOM settings of the container are not applied: they can only be set for the whole pod, on its sandbox"
+
+	if strict {
+		return fmt.Errorf("Strict mode refuses settings which cannot be enforced: %s (%s)", message, warningOOMNotApplied)
+	}
+
+	warn(warningOOMNotApplied, "%s", message)
+
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuestOOMValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, scoreAdj := range []int{-1000, 0, 1000} {
+		assert.NoError(guestOOM{ScoreAdj: scoreAdj}.validate(), scoreAdj)
+	}
+
+	for _, scoreAdj := range []int{-1001, 1001} {
+		assert.Error(guestOOM{ScoreAdj: scoreAdj}.validate(), scoreAdj)
+	}
+}
+
+func TestGuestOOMKernelParams(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(guestOOM{}.kernelParams())
+
+	o := guestOOM{
+		ScoreAdj:    -500,
+		KillDisable: true,
+		Panic:       true,
+	}
+
+	assert.Equal([]vc.Param{
+		{Key: oomScoreAdjParam, Value: "-500"},
+		{Key: oomKillDisableParam, Value: "1"},
+		{Key: panicOnOOMParam, Value: "1"},
+	}, o.kernelParams())
+}
+
+func TestPodOOM(t *testing.T) {
+	assert := assert.New(t)
+
+	savedOOM := runtimeOptions.OOM
+	defer func() {
+		runtimeOptions.OOM = savedOOM
+	}()
+
+	runtimeOptions.OOM = guestOOM{ScoreAdj: 100, Panic: true}
+
+	var ociSpec oci.CompatOCISpec
+
+	o, err := podOOM(ociSpec)
+	assert.NoError(err)
+	assert.Equal(runtimeOptions.OOM, o)
+
+	scoreAdj := 200
+	disable := true
+
+	ociSpec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			OOMScoreAdj:      &scoreAdj,
+			DisableOOMKiller: &disable,
+		},
+	}
+
+	o, err = podOOM(ociSpec)
+	assert.NoError(err)
+	assert.Equal(guestOOM{ScoreAdj: 200, KillDisable: true, Panic: true}, o)
+
+	ociSpec.Annotations = map[string]string{
+		oomScoreAdjAnnotation:    "-300",
+		oomKillDisableAnnotation: "false",
+		oomPanicAnnotation:       "false",
+	}
+
+	o, err = podOOM(ociSpec)
+	assert.NoError(err)
+	assert.Equal(guestOOM{ScoreAdj: -300}, o)
+
+	for annotation, value := range map[string]string{
+		oomScoreAdjAnnotation:    "foo",
+		oomKillDisableAnnotation: "foo",
+		oomPanicAnnotation:       "foo",
+	} {
+		ociSpec.Annotations = map[string]string{annotation: value}
+
+		_, err = podOOM(ociSpec)
+		assert.Error(err, annotation)
+	}
+
+	ociSpec.Annotations = map[string]string{oomScoreAdjAnnotation: "2000"}
+
+	_, err = podOOM(ociSpec)
+	assert.Error(err)
+}
+
+func TestApplyGuestOOM(t *testing.T) {
+	assert := assert.New(t)
+
+	savedOOM := runtimeOptions.OOM
+	defer func() {
+		runtimeOptions.OOM = savedOOM
+	}()
+
+	runtimeOptions.OOM = guestOOM{}
+
+	ociSpec := oci.CompatOCISpec{
+		Spec: specs.Spec{
+			Annotations: map[string]string{oomPanicAnnotation: "true"},
+		},
+	}
+
+	var runtimeConfig oci.RuntimeConfig
+
+	assert.NoError(applyGuestOOM(ociSpec, &runtimeConfig))
+	assert.Equal([]vc.Param{{Key: panicOnOOMParam, Value: "1"}}, runtimeConfig.HypervisorConfig.KernelParams)
+
+	ociSpec.Annotations[oomScoreAdjAnnotation] = "foo"
+	assert.Error(applyGuestOOM(ociSpec, &runtimeConfig))
+}
+
+func TestCheckContainerOOM(t *testing.T) {
+	assert := assert.New(t)
+
+	savedWarnings := warnings
+	defer func() {
+		warnings = savedWarnings
+	}()
+
+	warnings = nil
+
+	var ociSpec oci.CompatOCISpec
+	assert.NoError(checkContainerOOM(ociSpec, true))
+
+	ociSpec.Linux = &specs.Linux{Resources: &specs.LinuxResources{}}
+	assert.NoError(checkContainerOOM(ociSpec, true))
+
+	scoreAdj := 500
+	ociSpec.Linux.Resources.OOMScoreAdj = &scoreAdj
+
+	assert.NoError(checkContainerOOM(ociSpec, false))
+	assert.Equal([]string{warningOOMNotApplied}, warningCodes(warnings))
+
+	warnings = nil
+
+	err := checkContainerOOM(ociSpec, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), warningOOMNotApplied)
+	assert.Empty(warnings)
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+const defaultOSBuilderDistro = "clearlinux"
+
+// osBuilderNameRE matches the distributions and image versions.
+var osBuilderNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// osBuilderPackageRE matches the names of the distribution packages.
+var osBuilderPackageRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.+_:-]*$`)
+
+// osBuild describes a build of the guest image with the osbuilder
+// scripts.
+type osBuild struct {
+	// BuilderDir is the directory of the osbuilder scripts.
+	BuilderDir string
+
+	// Distro is the distribution of the guest root filesystem, and
+	// OSVersion its version (default: the osbuilder default).
+	Distro    string
+	OSVersion string
+
+	// AgentPath is the agent binary included in the image (default:
+	// the osbuilder default).
+	AgentPath string
+
+	// ExtraPackages are the distribution packages added to the image.
+	ExtraPackages []string
+
+	// Version names the installed image.
+	Version string
+}
+
+func (b osBuild) validate() error {
+	if !filepath.IsAbs(b.BuilderDir) {
+		return fmt.Errorf("osbuilder directory %q is not absolute", b.BuilderDir)
+	}
+
+	if _, err := os.Stat(filepath.Join(b.BuilderDir, "Makefile")); err != nil {
+		return fmt.Errorf("Invalid osbuilder directory %v: %v", b.BuilderDir, err)
+	}
+
+	for _, name := range []string{b.Distro, b.Version} {
+		if !osBuilderNameRE.MatchString(name) {
+			return fmt.Errorf("Invalid distribution or image version %q", name)
+		}
+	}
+
+	if b.OSVersion != "" && !osBuilderNameRE.MatchString(b.OSVersion) {
+		return fmt.Errorf("Invalid distribution version %q", b.OSVersion)
+	}
+
+	for _, p := range b.ExtraPackages {
+		if !osBuilderPackageRE.MatchString(p) {
+			return fmt.Errorf("Invalid package name %q", p)
+		}
+	}
+
+	if b.AgentPath != "" {
+		info, err := os.Stat(b.AgentPath)
+		if err != nil {
+			return fmt.Errorf("Invalid agent: %v", err)
+		}
+
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("Invalid agent: %v is not a regular file", b.AgentPath)
+		}
+	}
+
+	return nil
+}
+
+// makeArgs returns the command building the image to output.
+func (b osBuild) makeArgs(output string) []string {
+	args := []string{
+		"make", "-C", b.BuilderDir, "image",
+		"IMAGE=" + output,
+		"DISTRO=" + b.Distro,
+	}
+
+	if b.OSVersion != "" {
+		args = append(args, "OS_VERSION="+b.OSVersion)
+	}
+
+	if len(b.ExtraPackages) != 0 {
+		args = append(args, "EXTRA_PKGS="+strings.Join(b.ExtraPackages, " "))
+	}
+
+	if b.AgentPath != "" {
+		args = append(args, "AGENT_SOURCE_BIN="+b.AgentPath)
+	}
+
+	return args
+}
+
+// runOSBuilder runs the command building the guest image. It is a
+// variable rather than a function to allow tests to modify it.
+var runOSBuilder = func(args []string) error {
+	if out, err := runCommandFull(args, true); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+
+	return nil
+}
+
+// versionedImagePath returns the path of the specified version of the
+// guest image, next to the configured image: "clear-containers.img"
+// becomes "clear-containers-<distro>-<version>.img".
+func versionedImagePath(imagePath, distro, version string) string {
+	ext := filepath.Ext(imagePath)
+	stem := strings.TrimSuffix(filepath.Base(imagePath), ext)
+
+	return filepath.Join(filepath.Dir(imagePath), fmt.Sprintf("%s-%s-%s%s", stem, distro, version, ext))
+}
+
+// installGuestImage points the configured image, which must be a
+// symbolic link if it exists, to the specified image of the same
+// directory. The link is replaced atomically so that the pods being
+// created boot either image.
+func installGuestImage(imagePath, image string) error {
+	if info, err := os.Lstat(imagePath); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("Guest image %v is not a symbolic link: not replacing it", imagePath)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp := imagePath + ".tmp"
+
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+
+	if err := os.Symlink(filepath.Base(image), tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, imagePath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// buildGuestImage builds the guest image and installs it as the
+// configured image, returning its versioned path. The previous images
+// are kept to allow rolling back.
+func buildGuestImage(b osBuild, imagePath string) (string, error) {
+	if err := b.validate(); err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(imagePath) {
+		return "", fmt.Errorf("Guest image path %q is not absolute", imagePath)
+	}
+
+	image := versionedImagePath(imagePath, b.Distro, b.Version)
+
+	if _, err := os.Lstat(image); err == nil {
+		return "", fmt.Errorf("Guest image %v already exists", image)
+	}
+
+	tmp := image + ".tmp"
+
+	ccLog.Infof("Building guest image %v with %v", image, b.BuilderDir)
+
+	if err := runOSBuilder(b.makeArgs(tmp)); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("Unable to build guest image: %v", err)
+	}
+
+	if err := os.Rename(tmp, image); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	if err := installGuestImage(imagePath, image); err != nil {
+		return "", err
+	}
+
+	return image, nil
+}
+
+// writeGuestImageBuild reports the installed image.
+func writeGuestImageBuild(w io.Writer, imagePath, image string) error {
+	_, err := fmt.Fprintf(w, "Guest image %s installed as %s\n", image, imagePath)
+	return err
+}
+
+var osBuilderCLICommand = cli.Command{
+	Name:    "cc-osbuilder",
+	Aliases: []string{"osbuilder"},
+	Usage:   "build and install a custom guest image",
+	Description: `The cc-osbuilder command builds a guest root filesystem image with the
+   osbuilder scripts, from the specified distribution with the agent and
+   the extra packages, and installs it next to the image of the
+   configuration as "<image>-<distro>-<version>.img". The image of the
+   configuration, which must be a symbolic link if it exists, is then
+   atomically pointed to the new image. The previous images are kept:
+   point the link back to one of them to roll back.
+
+EXAMPLE:
+       # ` + name + ` cc-osbuilder --builder-dir /usr/src/osbuilder --extra-packages "strace iproute2"`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "builder-dir",
+			Usage: "directory of the osbuilder scripts",
+		},
+		cli.StringFlag{
+			Name:  "distro",
+			Value: defaultOSBuilderDistro,
+			Usage: "distribution of the guest root filesystem",
+		},
+		cli.StringFlag{
+			Name:  "os-version",
+			Usage: "version of the distribution (default: the osbuilder default)",
+		},
+		cli.StringFlag{
+			Name:  "agent",
+			Usage: "agent binary to include (default: the osbuilder default)",
+		},
+		cli.StringFlag{
+			Name:  "extra-packages",
+			Usage: "space-separated list of packages to add to the image",
+		},
+		cli.StringFlag{
+			Name:  "image-version",
+			Usage: "version naming the image (default: the build time)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		b := osBuild{
+			BuilderDir:    context.String("builder-dir"),
+			Distro:        context.String("distro"),
+			OSVersion:     context.String("os-version"),
+			AgentPath:     context.String("agent"),
+			ExtraPackages: strings.Fields(context.String("extra-packages")),
+			Version:       context.String("image-version"),
+		}
+
+		if b.Version == "" {
+			b.Version = timeNow().UTC().Format("20060102150405")
+		}
+
+		imagePath := runtimeConfig.HypervisorConfig.ImagePath
+
+		image, err := buildGuestImage(b, imagePath)
+		if err != nil {
+			return err
+		}
+
+		return writeGuestImageBuild(defaultOutputFile, imagePath, image)
+	},
+}
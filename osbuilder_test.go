@@ -0,0 +1,236 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupOSBuilderTest fakes an osbuilder directory and a builder writing
+// the image to the IMAGE make variable. It returns the temporary
+// directory and the commands run.
+func setupOSBuilderTest(t *testing.T) (string, *[][]string, func()) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "osbuilder-")
+	assert.NoError(err)
+
+	builderDir := filepath.Join(dir, "osbuilder")
+	assert.NoError(os.MkdirAll(builderDir, testDirMode))
+	assert.NoError(createEmptyFile(filepath.Join(builderDir, "Makefile")))
+
+	var commands [][]string
+
+	savedRunOSBuilder := runOSBuilder
+	runOSBuilder = func(args []string) error {
+		commands = append(commands, args)
+
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "EXTRA_PKGS=") && strings.Contains(arg, "broken") {
+				return errors.New("package not found")
+			}
+		}
+
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "IMAGE=") {
+				return createFile(strings.TrimPrefix(arg, "IMAGE="), "image")
+			}
+		}
+
+		return nil
+	}
+
+	return dir, &commands, func() {
+		runOSBuilder = savedRunOSBuilder
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOSBuildValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _, cleanup := setupOSBuilderTest(t)
+	defer cleanup()
+
+	agent := filepath.Join(dir, "agent")
+	assert.NoError(createEmptyFile(agent))
+
+	b := osBuild{
+		BuilderDir:    filepath.Join(dir, "osbuilder"),
+		Distro:        "fedora",
+		OSVersion:     "38",
+		AgentPath:     agent,
+		ExtraPackages: []string{"strace", "iproute2", "libstdc++"},
+		Version:       "1.0",
+	}
+
+	assert.NoError(b.validate())
+
+	for _, bad := range []osBuild{
+		{BuilderDir: "osbuilder"},
+		{BuilderDir: dir},
+		{Distro: "../fedora"},
+		{Distro: ""},
+		{Version: "1 0"},
+		{OSVersion: "$(reboot)"},
+		{ExtraPackages: []string{"-rf"}},
+		{AgentPath: filepath.Join(dir, "missing")},
+		{AgentPath: dir},
+	} {
+		build := b
+
+		if bad.BuilderDir != "" {
+			build.BuilderDir = bad.BuilderDir
+		}
+
+		if bad.Distro != "fedora" {
+			build.Distro = bad.Distro
+		}
+
+		if bad.Version != "" {
+			build.Version = bad.Version
+		}
+
+		if bad.OSVersion != "" {
+			build.OSVersion = bad.OSVersion
+		}
+
+		if bad.ExtraPackages != nil {
+			build.ExtraPackages = bad.ExtraPackages
+		}
+
+		if bad.AgentPath != "" {
+			build.AgentPath = bad.AgentPath
+		}
+
+		assert.Error(build.validate(), "%+v", bad)
+	}
+}
+
+func TestOSBuildMakeArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	b := osBuild{
+		BuilderDir: "/usr/src/osbuilder",
+		Distro:     "clearlinux",
+		Version:    "1",
+	}
+
+	assert.Equal([]string{"make", "-C", "/usr/src/osbuilder", "image", "IMAGE=/tmp/image", "DISTRO=clearlinux"},
+		b.makeArgs("/tmp/image"))
+
+	b.OSVersion = "30000"
+	b.ExtraPackages = []string{"strace", "iproute2"}
+	b.AgentPath = "/usr/bin/cc-agent"
+
+	assert.Equal([]string{"make", "-C", "/usr/src/osbuilder", "image", "IMAGE=/tmp/image", "DISTRO=clearlinux",
+		"OS_VERSION=30000", "EXTRA_PKGS=strace iproute2", "AGENT_SOURCE_BIN=/usr/bin/cc-agent"},
+		b.makeArgs("/tmp/image"))
+}
+
+func TestVersionedImagePath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/usr/share/clear-containers/clear-containers-fedora-1.0.img",
+		versionedImagePath("/usr/share/clear-containers/clear-containers.img", "fedora", "1.0"))
+	assert.Equal("/images/guest-clearlinux-2",
+		versionedImagePath("/images/guest", "clearlinux", "2"))
+}
+
+func TestBuildGuestImage(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, commands, cleanup := setupOSBuilderTest(t)
+	defer cleanup()
+
+	imagePath := filepath.Join(dir, "clear-containers.img")
+
+	b := osBuild{
+		BuilderDir: filepath.Join(dir, "osbuilder"),
+		Distro:     defaultOSBuilderDistro,
+		Version:    "1",
+	}
+
+	image, err := buildGuestImage(b, imagePath)
+	assert.NoError(err)
+	assert.Equal(filepath.Join(dir, "clear-containers-clearlinux-1.img"), image)
+	assert.Len(*commands, 1)
+
+	target, err := os.Readlink(imagePath)
+	assert.NoError(err)
+	assert.Equal("clear-containers-clearlinux-1.img", target)
+
+	contents, err := getFileContents(imagePath)
+	assert.NoError(err)
+	assert.Equal("image", contents)
+
+	// a new version replaces the link and keeps the previous image
+	b.Version = "2"
+
+	image, err = buildGuestImage(b, imagePath)
+	assert.NoError(err)
+
+	target, err = os.Readlink(imagePath)
+	assert.NoError(err)
+	assert.Equal(filepath.Base(image), target)
+
+	_, err = os.Stat(filepath.Join(dir, "clear-containers-clearlinux-1.img"))
+	assert.NoError(err)
+
+	// existing version
+	_, err = buildGuestImage(b, imagePath)
+	assert.Error(err)
+
+	// failed build
+	b.Version = "3"
+	b.ExtraPackages = []string{"broken"}
+
+	_, err = buildGuestImage(b, imagePath)
+	assert.Error(err)
+
+	_, err = os.Stat(versionedImagePath(imagePath, b.Distro, b.Version) + ".tmp")
+	assert.True(os.IsNotExist(err))
+
+	target, err = os.Readlink(imagePath)
+	assert.NoError(err)
+	assert.Equal(filepath.Base(image), target)
+
+	// the configured image is not a link
+	b.ExtraPackages = nil
+	imagePath = filepath.Join(dir, "other.img")
+	assert.NoError(createFile(imagePath, "image"))
+
+	_, err = buildGuestImage(b, imagePath)
+	assert.Error(err)
+
+	_, err = buildGuestImage(b, "clear-containers.img")
+	assert.Error(err)
+}
+
+func TestWriteGuestImageBuild(t *testing.T) {
+	assert := assert.New(t)
+
+	var b bytes.Buffer
+	assert.NoError(writeGuestImageBuild(&b, "/images/cc.img", "/images/cc-fedora-1.img"))
+	assert.Equal("Guest image /images/cc-fedora-1.img installed as /images/cc.img\n", b.String())
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+// supported values of the global "--output" option
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFormat is the format informational commands display their
+// results in. It is set from the global "--output" option.
+var outputFormat = outputText
+
+// setOutputFormat sets the output format from the global "--output"
+// option.
+func setOutputFormat(context *cli.Context) error {
+	format := context.GlobalString("output")
+
+	switch format {
+	case "":
+		outputFormat = outputText
+	case outputText, outputJSON:
+		outputFormat = format
+	default:
+		return fmt.Errorf("Invalid output format %q (supported: %s, %s)", format, outputText, outputJSON)
+	}
+
+	return nil
+}
+
+func wantJSONOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// writeJSON displays the specified value in JSON.
+func writeJSON(v interface{}) error {
+	return json.NewEncoder(defaultOutputFile).Encode(v)
+}
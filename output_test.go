@@ -0,0 +1,221 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// setTestOutputFile redirects the output of the commands to a new file
+// in dir, returning a function to restore the defaults.
+func setTestOutputFile(assert *assert.Assertions, dir string) (*os.File, func()) {
+	outputFile, err := os.Create(filepath.Join(dir, "output"))
+	assert.NoError(err)
+
+	savedOutputFile := defaultOutputFile
+	savedOutputFormat := outputFormat
+
+	defaultOutputFile = outputFile
+
+	return outputFile, func() {
+		defaultOutputFile = savedOutputFile
+		outputFormat = savedOutputFormat
+		outputFile.Close()
+	}
+}
+
+func TestSetOutputFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	savedOutputFormat := outputFormat
+	defer func() {
+		outputFormat = savedOutputFormat
+	}()
+
+	// option not defined
+	ctx := cli.NewContext(cli.NewApp(), flag.NewFlagSet("", 0), nil)
+	assert.NoError(setOutputFormat(ctx))
+	assert.False(wantJSONOutput())
+
+	set := flag.NewFlagSet("", 0)
+	set.String("output", outputJSON, "")
+	ctx = cli.NewContext(cli.NewApp(), set, nil)
+
+	assert.NoError(setOutputFormat(ctx))
+	assert.True(wantJSONOutput())
+
+	set.Set("output", outputText)
+	assert.NoError(setOutputFormat(ctx))
+	assert.False(wantJSONOutput())
+
+	set.Set("output", "yaml")
+	assert.Error(setOutputFormat(ctx))
+}
+
+func TestVersionJSONOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "output-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, restore := setTestOutputFile(assert, dir)
+	defer restore()
+
+	outputFormat = outputJSON
+
+	fn, ok := versionCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(cli.NewContext(cli.NewApp(), nil, nil))
+	assert.NoError(err)
+
+	contents, err := ioutil.ReadFile(outputFile.Name())
+	assert.NoError(err)
+
+	var info versionInfo
+	err = json.Unmarshal(contents, &info)
+	assert.NoError(err)
+	assert.Equal(getVersionInfo(), info)
+	assert.Equal(name, info.Name)
+	assert.NotEmpty(info.Version)
+	assert.NotEmpty(info.OCIVersion)
+}
+
+func TestCCCheckJSONOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "output-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, restore := setTestOutputFile(assert, dir)
+	defer restore()
+
+	savedProcCPUInfo := procCPUInfo
+	defer func() {
+		procCPUInfo = savedProcCPUInfo
+	}()
+
+	// doesn't exist
+	procCPUInfo = filepath.Join(dir, "cpuinfo")
+	outputFormat = outputJSON
+
+	fn, ok := checkCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(cli.NewContext(cli.NewApp(), nil, nil))
+	assert.Error(err)
+
+	contents, err := ioutil.ReadFile(outputFile.Name())
+	assert.NoError(err)
+
+	var result checkResult
+	err = json.Unmarshal(contents, &result)
+	assert.NoError(err)
+	assert.False(result.Capable)
+	assert.NotEmpty(result.Error)
+}
+
+func TestEnvJSONOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "output-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, restore := setTestOutputFile(assert, dir)
+	defer restore()
+
+	outputFormat = outputJSON
+
+	env := EnvInfo{
+		Meta: getMetaInfo(),
+		Host: HostInfo{Kernel: "4.14", CCCapable: true},
+	}
+
+	err = showSettings(env, outputFile)
+	assert.NoError(err)
+
+	contents, err := ioutil.ReadFile(outputFile.Name())
+	assert.NoError(err)
+
+	// the field names are those of the TOML output
+	var fields map[string]map[string]interface{}
+	err = json.Unmarshal(contents, &fields)
+	assert.NoError(err)
+	assert.Equal(formatVersion, fields["Meta"]["Version"])
+	assert.Equal("4.14", fields["Host"]["Kernel"])
+	assert.Equal(true, fields["Host"]["CCCapable"])
+}
+
+func TestListJSONOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "output-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	outputFile, restore := setTestOutputFile(assert, dir)
+	defer restore()
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{}, nil
+	}
+
+	runtimeConfig, err := newTestRuntimeConfig(dir, testConsole, true)
+	assert.NoError(err)
+
+	set := flag.NewFlagSet("", 0)
+	set.String("format", "table", "")
+	set.Bool("quiet", false, "")
+	set.Bool("cc-all", false, "")
+
+	app := cli.NewApp()
+	ctx := cli.NewContext(app, set, nil)
+	app.Metadata = map[string]interface{}{
+		"runtimeConfig": runtimeConfig,
+	}
+
+	outputFormat = outputJSON
+
+	fn, ok := listCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	contents, err := ioutil.ReadFile(outputFile.Name())
+	assert.NoError(err)
+
+	// JSON rather than the table selected by "--format"
+	var states []fullContainerState
+	err = json.Unmarshal(contents, &states)
+	assert.NoError(err)
+	assert.Empty(states)
+}
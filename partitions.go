@@ -0,0 +1,254 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// partitionAnnotation is the OCI annotation selecting the host partition
+// a pod runs on.
+const partitionAnnotation = ccAnnotationPrefix + "partition"
+
+// runtimeClassAnnotations are the annotations set by the container
+// managers to the runtime handler of the RuntimeClass of a pod.
+var runtimeClassAnnotations = []string{
+	"io.kubernetes.cri-o.RuntimeHandler",
+	"io.kubernetes.cri.runtime-handler",
+}
+
+// hostCPUsParam is the hypervisor parameter listing the host CPUs the
+// hypervisor is pinned to, when they differ from host_cpuset.
+const hostCPUsParam = "cpu.host_cpus"
+
+// sysCPUDir is the sysfs directory describing the CPUs of the host.
+var sysCPUDir = "/sys/devices/system/cpu"
+
+// partition is a set of host CPUs isolated from the scheduler (isolcpus)
+// reserved for some pods, such as latency-critical pods on nodes also
+// running best-effort pods.
+type partition struct {
+	// CPUs are the isolated host CPUs the hypervisor and the shims of
+	// the pods are pinned to, like "4-7".
+	CPUs string `toml:"cpus"`
+
+	// RuntimeClasses are the runtime handlers of the RuntimeClasses
+	// whose pods run on the partition.
+	RuntimeClasses []string `toml:"runtime_classes"`
+}
+
+// sortedPartitions returns the names of the partitions, sorted to
+// report errors consistently.
+func sortedPartitions(partitions map[string]partition) []string {
+	var names []string
+	for name := range partitions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// validPartitions checks the partitions of the configuration: their CPUs
+// may not overlap with each other nor with the host CPU set, and a
+// RuntimeClass may select a single partition. Whether the CPUs are
+// isolated is checked when a pod is created, see checkPartitionCPUs.
+func validPartitions(partitions map[string]partition, hostCPUSet string) error {
+	owners := make(map[int]string)
+	classes := make(map[string]string)
+
+	if hostCPUSet != "" {
+		cpus, err := parseCPUSet(hostCPUSet)
+		if err != nil {
+			return err
+		}
+
+		for _, cpu := range cpus {
+			owners[cpu] = "host_cpuset"
+		}
+	}
+
+	for _, name := range sortedPartitions(partitions) {
+		p := partitions[name]
+
+		if !kernelVariantNameRegex.MatchString(name) {
+			return fmt.Errorf("Invalid partition name %q", name)
+		}
+
+		if p.CPUs == "" {
+			return fmt.Errorf("Partition %q: cpus is not set", name)
+		}
+
+		cpus, err := parseCPUSet(p.CPUs)
+		if err != nil {
+			return fmt.Errorf("Partition %q: %v", name, err)
+		}
+
+		for _, cpu := range cpus {
+			if owner, ok := owners[cpu]; ok {
+				return fmt.Errorf("Partition %q: CPU %d is already used by %s", name, cpu, owner)
+			}
+
+			owners[cpu] = fmt.Sprintf("partition %q", name)
+		}
+
+		for _, class := range p.RuntimeClasses {
+			if owner, ok := classes[class]; ok {
+				return fmt.Errorf("Partition %q: RuntimeClass %q is already selected by partition %q", name, class, owner)
+			}
+
+			classes[class] = name
+		}
+	}
+
+	return nil
+}
+
+// podPartition returns the name and the settings of the partition a pod
+// runs on, selected by its annotation or else by its RuntimeClass, or ""
+// if it runs on the host CPU set.
+func podPartition(ociSpec oci.CompatOCISpec) (string, partition, error) {
+	if name, ok := ociSpec.Annotations[partitionAnnotation]; ok {
+		p, ok := runtimeOptions.Partitions[name]
+		if !ok {
+			return "", partition{}, fmt.Errorf("Unknown partition %q: expecting one of %v",
+				name, strings.Join(sortedPartitions(runtimeOptions.Partitions), ", "))
+		}
+
+		return name, p, nil
+	}
+
+	for _, annotation := range runtimeClassAnnotations {
+		class, ok := ociSpec.Annotations[annotation]
+		if !ok {
+			continue
+		}
+
+		for _, name := range sortedPartitions(runtimeOptions.Partitions) {
+			p := runtimeOptions.Partitions[name]
+
+			for _, c := range p.RuntimeClasses {
+				if c == class {
+					return name, p, nil
+				}
+			}
+		}
+	}
+
+	return "", partition{}, nil
+}
+
+// readHostCPUSet returns the host CPUs listed by a file of sysCPUDir.
+func readHostCPUSet(name string) (map[int]bool, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(sysCPUDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[int]bool)
+
+	value := strings.TrimSpace(string(bytes))
+	if value == "" {
+		return set, nil
+	}
+
+	cpus, err := parseCPUSet(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cpu := range cpus {
+		set[cpu] = true
+	}
+
+	return set, nil
+}
+
+// checkPartitionCPUs checks that the CPUs of a partition exist and are
+// isolated from the scheduler of the host.
+func checkPartitionCPUs(cpus []int) error {
+	online, err := readHostCPUSet("online")
+	if err != nil {
+		return err
+	}
+
+	isolated, err := readHostCPUSet("isolated")
+	if err != nil {
+		return err
+	}
+
+	for _, cpu := range cpus {
+		if !online[cpu] {
+			return fmt.Errorf("CPU %d is not online", cpu)
+		}
+
+		if !isolated[cpu] {
+			return fmt.Errorf("CPU %d is not isolated (isolcpus)", cpu)
+		}
+	}
+
+	return nil
+}
+
+// applyPartition pins the pod to the partition it selected, if any: the
+// runtime restricts itself to the CPUs of the partition so that the
+// hypervisor and the shims it launches inherit them. The pod is not
+// created if the partition is not set up on the host. It returns the
+// name of the partition.
+func applyPartition(ociSpec oci.CompatOCISpec, runtimeConfig *oci.RuntimeConfig) (string, error) {
+	name, p, err := podPartition(ociSpec)
+	if err != nil || name == "" {
+		return "", err
+	}
+
+	// checked by runtime.validate()
+	cpus, _ := parseCPUSet(p.CPUs)
+
+	if err := checkPartitionCPUs(cpus); err != nil {
+		return "", fmt.Errorf("Partition %q is not available: %v", name, err)
+	}
+
+	hypervisorConfig := &runtimeConfig.HypervisorConfig
+
+	params := removeParam(hypervisorConfig.HypervisorParams, hostCPUsParam)
+	params = append(params, vc.Param{Key: hostCPUsParam, Value: p.CPUs})
+
+	if err := setProcessAffinity(os.Getpid(), cpus); err != nil {
+		return "", err
+	}
+
+	hypervisorConfig.HypervisorParams = params
+
+	return name, nil
+}
+
+// setPodPartition records in the pod state the partition the pod runs
+// on and its CPUs.
+func setPodPartition(podID, name, cpus string) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.Partition = name
+		state.PartitionCPUs = cpus
+		return nil
+	})
+}
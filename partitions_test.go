@@ -0,0 +1,209 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupPartitionsTest fakes a host whose CPUs 2-3 are isolated. It
+// returns the CPUs the runtime was restricted to.
+func setupPartitionsTest(t *testing.T) (map[int][]int, func()) {
+	assert := assert.New(t)
+
+	dir, affinity, cleanupCPUSet := setupCPUSetTest(t)
+
+	savedSysCPUDir := sysCPUDir
+	sysCPUDir = filepath.Join(dir, "cpu")
+
+	assert.NoError(os.MkdirAll(sysCPUDir, testDirMode))
+	assert.NoError(createFile(filepath.Join(sysCPUDir, "online"), "0-3\n"))
+	assert.NoError(createFile(filepath.Join(sysCPUDir, "isolated"), "2-3\n"))
+
+	pid := os.Getpid()
+	makeTestProcess(t, procDir, pid, []int{pid}, "")
+
+	runtimeOptions.HostCPUSet = "0-1"
+	runtimeOptions.Partitions = map[string]partition{
+		"realtime": {
+			CPUs:           "2-3",
+			RuntimeClasses: []string{"cc-realtime"},
+		},
+		"besteffort": {
+			CPUs: "1",
+		},
+	}
+
+	return affinity, func() {
+		sysCPUDir = savedSysCPUDir
+		cleanupCPUSet()
+	}
+}
+
+func TestValidPartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validPartitions(nil, "0-1"))
+
+	partitions := map[string]partition{
+		"realtime": {
+			CPUs:           "4-7",
+			RuntimeClasses: []string{"cc-realtime"},
+		},
+		"dpdk": {
+			CPUs: "8,9",
+		},
+	}
+
+	assert.NoError(validPartitions(partitions, "0-3"))
+
+	valid := partitions
+
+	for _, p := range []partition{
+		{},
+		{CPUs: "four"},
+		{CPUs: "3-4"},
+		{CPUs: "10", RuntimeClasses: []string{"cc-realtime"}},
+	} {
+		partitions = map[string]partition{"other": p}
+		for name, v := range valid {
+			partitions[name] = v
+		}
+
+		assert.Error(validPartitions(partitions, "0-3"), "%+v", p)
+	}
+
+	assert.Error(validPartitions(map[string]partition{"Real Time": {CPUs: "10"}}, ""))
+}
+
+func TestPodPartition(t *testing.T) {
+	assert := assert.New(t)
+
+	_, cleanup := setupPartitionsTest(t)
+	defer cleanup()
+
+	ociSpec := oci.CompatOCISpec{}
+	ociSpec.Annotations = map[string]string{}
+
+	name, _, err := podPartition(ociSpec)
+	assert.NoError(err)
+	assert.Empty(name)
+
+	ociSpec.Annotations["io.kubernetes.cri.runtime-handler"] = "cc-realtime"
+
+	name, p, err := podPartition(ociSpec)
+	assert.NoError(err)
+	assert.Equal("realtime", name)
+	assert.Equal("2-3", p.CPUs)
+
+	// the annotation overrides the RuntimeClass
+	ociSpec.Annotations[partitionAnnotation] = "besteffort"
+
+	name, _, err = podPartition(ociSpec)
+	assert.NoError(err)
+	assert.Equal("besteffort", name)
+
+	ociSpec.Annotations[partitionAnnotation] = "unknown"
+
+	_, _, err = podPartition(ociSpec)
+	assert.Error(err)
+}
+
+func TestCheckPartitionCPUs(t *testing.T) {
+	assert := assert.New(t)
+
+	_, cleanup := setupPartitionsTest(t)
+	defer cleanup()
+
+	assert.NoError(checkPartitionCPUs([]int{2, 3}))
+
+	// not isolated
+	assert.Error(checkPartitionCPUs([]int{1}))
+
+	// not online
+	assert.Error(checkPartitionCPUs([]int{4}))
+
+	assert.NoError(createFile(filepath.Join(sysCPUDir, "isolated"), "\n"))
+	assert.Error(checkPartitionCPUs([]int{2}))
+
+	assert.NoError(os.Remove(filepath.Join(sysCPUDir, "isolated")))
+	assert.Error(checkPartitionCPUs([]int{2}))
+}
+
+func TestApplyPartition(t *testing.T) {
+	assert := assert.New(t)
+
+	affinity, cleanup := setupPartitionsTest(t)
+	defer cleanup()
+
+	ociSpec := oci.CompatOCISpec{}
+	ociSpec.Annotations = map[string]string{}
+
+	runtimeConfig := oci.RuntimeConfig{}
+	runtimeConfig.HypervisorConfig.HypervisorParams = []vc.Param{
+		{Key: "debug", Value: "on"},
+	}
+
+	// no partition
+	name, err := applyPartition(ociSpec, &runtimeConfig)
+	assert.NoError(err)
+	assert.Empty(name)
+	assert.Empty(affinity)
+	assert.Len(runtimeConfig.HypervisorConfig.HypervisorParams, 1)
+
+	ociSpec.Annotations["io.kubernetes.cri-o.RuntimeHandler"] = "cc-realtime"
+
+	name, err = applyPartition(ociSpec, &runtimeConfig)
+	assert.NoError(err)
+	assert.Equal("realtime", name)
+
+	pid := os.Getpid()
+	assert.Equal(map[int][]int{pid: {2, 3}}, affinity)
+
+	assert.Equal([]vc.Param{
+		{Key: "debug", Value: "on"},
+		{Key: hostCPUsParam, Value: "2-3"},
+	}, runtimeConfig.HypervisorConfig.HypervisorParams)
+
+	r, err := podReservation(runtimeConfig.VMConfig, runtimeConfig.HypervisorConfig)
+	assert.NoError(err)
+	assert.Equal([]int{2, 3}, r.CPUs)
+
+	// CPUs not isolated
+	ociSpec.Annotations[partitionAnnotation] = "besteffort"
+
+	_, err = applyPartition(ociSpec, &runtimeConfig)
+	assert.Error(err)
+}
+
+func TestSetPodPartition(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupIdlePauseTest(t, time.Now())()
+
+	assert.NoError(setPodPartition(testPodID, "realtime", "2-3"))
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal("realtime", state.Partition)
+	assert.Equal("2-3", state.PartitionCPUs)
+}
@@ -58,9 +58,12 @@ func toggleContainerPause(containerID string, pause bool) (err error) {
 
 	if pause {
 		_, err = vci.PausePod(podID)
-	} else {
-		_, err = vci.ResumePod(podID)
+		return err
+	}
+
+	if _, err = vci.ResumePod(podID); err != nil {
+		return err
 	}
 
-	return err
+	return clearPodIdlePaused(podID)
 }
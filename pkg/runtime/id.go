@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+
+	vc "github.com/containers/virtcontainers"
+)
+
+// MaxIDLength is the maximum length of a container or pod ID. The IDs
+// name files and sockets, whose paths have a limited length.
+const MaxIDLength = 128
+
+// idRegex matches the valid container and pod IDs. The IDs may not
+// start with a dot, which names the internal directories of the
+// runtime, nor with a dash, which would make them look like options.
+var idRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]*$`)
+
+// IDInUseError is returned when creating a container or a pod with the
+// ID of an existing container or pod.
+type IDInUseError struct {
+	ID string
+
+	// Owner is "container" or "pod".
+	Owner string
+}
+
+func (e IDInUseError) Error() string {
+	return fmt.Sprintf("ID %q already in use by a %s, unique ID should be provided", e.ID, e.Owner)
+}
+
+// IsIDInUse returns true if err is an IDInUseError.
+func IsIDInUse(err error) bool {
+	_, ok := err.(IDInUseError)
+	return ok
+}
+
+// NotFoundError is returned when deleting a container which does not
+// exist, because it was already deleted or was never created. Callers
+// retrying a delete may consider it a success.
+type NotFoundError struct {
+	ID string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("Container %q does not exist", e.ID)
+}
+
+// IsNotFound returns true if err is a NotFoundError.
+func IsNotFound(err error) bool {
+	_, ok := err.(NotFoundError)
+	return ok
+}
+
+// ValidateID checks the syntax of a container or pod ID. The kind of
+// ID is used in error messages.
+func ValidateID(kind, id string) error {
+	if id == "" {
+		return fmt.Errorf("Missing %s ID", kind)
+	}
+
+	if len(id) > MaxIDLength {
+		return fmt.Errorf("Invalid %s ID %q: longer than %d characters", kind, id, MaxIDLength)
+	}
+
+	if !idRegex.MatchString(id) {
+		return fmt.Errorf("Invalid %s ID %q: must start with a letter, a digit or an underscore and only contain letters, digits and the characters _.+-", kind, id)
+	}
+
+	return nil
+}
+
+// CheckIDAvailable returns an IDInUseError if a container or a pod
+// managed by v has the specified ID. Unlike the commands acting on
+// existing containers, which accept unique ID prefixes, only exact
+// matches are conflicts.
+func CheckIDAvailable(v vc.VC, id string) error {
+	podStatusList, err := v.ListPod()
+	if err != nil {
+		return err
+	}
+
+	for _, podStatus := range podStatusList {
+		for _, containerStatus := range podStatus.ContainersStatus {
+			if containerStatus.ID == id {
+				return IDInUseError{ID: id, Owner: "container"}
+			}
+		}
+
+		// The pods joining a sandbox group, and the pods whose
+		// containers have all been deleted, have no container of
+		// the ID of the pod.
+		if podStatus.ID == id {
+			return IDInUseError{ID: id, Owner: "pod"}
+		}
+	}
+
+	return nil
+}
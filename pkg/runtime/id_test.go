@@ -0,0 +1,106 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateID(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, id := range []string{
+		"a",
+		"_",
+		"f4f2a0b3c9e1d8",
+		"my-pod.v1+build_2",
+		strings.Repeat("a", MaxIDLength),
+	} {
+		assert.NoError(ValidateID("container", id), id)
+	}
+
+	for _, id := range []string{
+		"",
+		".",
+		"..",
+		".devices",
+		"-rm",
+		"a/b",
+		"../pod",
+		"a b",
+		"pod:1",
+		strings.Repeat("a", MaxIDLength+1),
+	} {
+		assert.Error(ValidateID("container", id), id)
+	}
+}
+
+func TestCheckIDAvailable(t *testing.T) {
+	assert := assert.New(t)
+
+	v := &vcMock.VCMock{
+		ListPodFunc: func() ([]vc.PodStatus, error) {
+			return []vc.PodStatus{
+				{
+					ID: "pod1",
+					ContainersStatus: []vc.ContainerStatus{
+						{ID: "pod1"},
+						{ID: "container1"},
+					},
+				},
+				{
+					// pod without containers
+					ID: "pod2",
+				},
+			}, nil
+		},
+	}
+
+	err := CheckIDAvailable(v, "container1")
+	assert.True(IsIDInUse(err))
+	assert.Equal(IDInUseError{ID: "container1", Owner: "container"}, err)
+
+	err = CheckIDAvailable(v, "pod2")
+	assert.True(IsIDInUse(err))
+	assert.Equal(IDInUseError{ID: "pod2", Owner: "pod"}, err)
+
+	// prefixes are not conflicts
+	assert.NoError(CheckIDAvailable(v, "container"))
+
+	v.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return nil, errors.New("list failed")
+	}
+
+	err = CheckIDAvailable(v, "pod3")
+	assert.Error(err)
+	assert.False(IsIDInUse(err))
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	err := error(NotFoundError{ID: "container1"})
+	assert.True(IsNotFound(err))
+	assert.Equal(`Container "container1" does not exist`, err.Error())
+
+	assert.False(IsNotFound(errors.New("Container does not exist")))
+	assert.False(IsNotFound(IDInUseError{ID: "container1", Owner: "container"}))
+}
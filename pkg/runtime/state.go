@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Lifecycle records when a container went through each of its
+// transitions. A nil time means the transition did not happen (yet).
+type Lifecycle struct {
+	Created   *time.Time `json:"created,omitempty"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	OOMKilled *time.Time `json:"oomKilled,omitempty"`
+
+	// MemoryCgroup is the host memory cgroup of the shim of the
+	// container, used to find out whether the container was killed
+	// by the OOM killer.
+	MemoryCgroup string `json:"memoryCgroup,omitempty"`
+}
+
+// ContainerState is the state of a container, as printed by the state
+// command: the OCI state with the lifecycle timestamps of the
+// container, in RFC3339 format like the state of runc.
+type ContainerState struct {
+	specs.State
+
+	Created   string `json:"created,omitempty"`
+	Started   string `json:"started,omitempty"`
+	Finished  string `json:"finished,omitempty"`
+	OOMKilled string `json:"oomKilled,omitempty"`
+}
+
+func formatLifecycleTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// NewContainerState returns the state of a container from its OCI state
+// and its lifecycle.
+func NewContainerState(state specs.State, l Lifecycle) ContainerState {
+	return ContainerState{
+		State:     state,
+		Created:   formatLifecycleTime(l.Created),
+		Started:   formatLifecycleTime(l.Started),
+		Finished:  formatLifecycleTime(l.Finished),
+		OOMKilled: formatLifecycleTime(l.OOMKilled),
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewContainerState(t *testing.T) {
+	assert := assert.New(t)
+
+	created := time.Date(2017, 11, 2, 10, 0, 0, 0, time.UTC)
+	started := created.Add(time.Second)
+
+	state := NewContainerState(specs.State{ID: "foo", Status: "running"},
+		Lifecycle{Created: &created, Started: &started})
+
+	bytes, err := json.Marshal(state)
+	assert.NoError(err)
+
+	var fields map[string]interface{}
+	assert.NoError(json.Unmarshal(bytes, &fields))
+
+	assert.Equal("foo", fields["id"])
+	assert.Equal("running", fields["status"])
+	assert.Equal("2017-11-02T10:00:00Z", fields["created"])
+	assert.Equal("2017-11-02T10:00:01Z", fields["started"])
+	assert.NotContains(fields, "finished")
+	assert.NotContains(fields, "oomKilled")
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// prSetChildSubreaper is PR_SET_CHILD_SUBREAPER from linux/prctl.h
+const prSetChildSubreaper = 36
+
+// setSubreaper makes the processes orphaned by the children of the
+// runtime be reparented to the runtime rather than to init.
+func setSubreaper(enable bool) error {
+	var arg uintptr
+	if enable {
+		arg = 1
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, arg, 0); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// Core scheduling constants from linux/prctl.h and linux/pid.h
+const (
+	prSchedCore       = 62
+	prSchedCoreCreate = 1
+	pidTypeTGID       = 1
+)
+
+// createCoreSchedCookie gives all the threads of a process a new core
+// scheduling cookie: they only share a core with threads of the same
+// cookie, and so with none of the other processes.
+func createCoreSchedCookie(pid int) error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSchedCore, prSchedCoreCreate, uintptr(pid), pidTypeTGID, 0, 0); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// bindMount makes target a bind mount of source.
+func bindMount(source, target string) error {
+	return syscall.Mount(source, target, "", syscall.MS_BIND, "")
+}
+
+// detachMount lazily unmounts target.
+func detachMount(target string) error {
+	return syscall.Unmount(target, syscall.MNT_DETACH)
+}
+
+// isNotMountPoint returns true if detachMount failed because its target
+// is not a mount point.
+func isNotMountPoint(err error) bool {
+	return err == syscall.EINVAL
+}
+
+// openPathNoFollow opens an absolute path as a reference to the file,
+// which cannot be read or written. It fails if a component of the path
+// is a symbolic link.
+func openPathNoFollow(p string) (*os.File, error) {
+	fd, err := unix.Open("/", unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: "/", Err: err}
+	}
+
+	for _, name := range splitPath(filepath.Clean(p)) {
+		next, err := unix.Openat(fd, name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		unix.Close(fd)
+		if err != nil {
+			return nil, &os.PathError{Op: "openat", Path: p, Err: err}
+		}
+
+		fd = next
+	}
+
+	// With O_NOFOLLOW, a link as the last component is opened itself.
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "fstat", Path: p, Err: err}
+	}
+
+	if st.Mode&unix.S_IFMT == unix.S_IFLNK {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "open", Path: p, Err: unix.ELOOP}
+	}
+
+	return os.NewFile(uintptr(fd), p), nil
+}
+
+// fileDescriptorPath returns a path designating the file opened by the
+// runtime, whatever its original path now designates.
+func fileDescriptorPath(f *os.File) string {
+	return fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+}
+
+// readProcStat returns the status information of a process, in the
+// format of proc(5).
+func readProcStat(pid int) ([]byte, error) {
+	return ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+}
+
+// processFDPath returns what a file descriptor of a process refers to:
+// a path, or a description such as "pipe:[1234]" for pipes and sockets.
+func processFDPath(pid, fd int) (string, error) {
+	return os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, fd))
+}
+
+func isCgroupMounted(cgroupPath string) bool {
+	var statFs syscall.Statfs_t
+
+	if err := syscall.Statfs(cgroupPath, &statFs); err != nil {
+		return false
+	}
+
+	if statFs.Type != int64(cgroupFsType) {
+		return false
+	}
+
+	return true
+}
+
+// fileDevice returns the number of the device holding the specified
+// file.
+func fileDevice(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, err
+	}
+
+	return uint64(st.Dev), nil
+}
+
+// rlimitResources maps the resource names used in the configuration
+// file to the setrlimit(2) resources.
+var rlimitResources = map[string]int{
+	"core":    unix.RLIMIT_CORE,
+	"memlock": unix.RLIMIT_MEMLOCK,
+	"nofile":  unix.RLIMIT_NOFILE,
+}
+
+// setRlimit sets both the soft and the hard limit of the runtime for the
+// specified resource.
+func setRlimit(name string, limit uint64) error {
+	resource, ok := rlimitResources[name]
+	if !ok {
+		return fmt.Errorf("Unknown resource limit %q", name)
+	}
+
+	return unix.Setrlimit(resource, &unix.Rlimit{Cur: limit, Max: limit})
+}
+
+// setAffinity restricts a thread to the specified CPUs.
+func setAffinity(tid int, cpus []int) error {
+	var mask [maxHostCPUs / 64]uint64
+
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << uint(cpu%64)
+	}
+
+	_, _, errno := syscall.RawSyscall(unix.SYS_SCHED_SETAFFINITY, uintptr(tid), uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "platform-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	dev, err := fileDevice(dir)
+	assert.NoError(err)
+
+	other, err := fileDevice(testDir)
+	assert.NoError(err)
+	assert.Equal(other, dev)
+
+	_, err = fileDevice("/this/file/does/not/exist")
+	assert.Error(err)
+}
+
+func TestSetRlimit(t *testing.T) {
+	assert := assert.New(t)
+
+	var saved syscall.Rlimit
+	err := syscall.Getrlimit(syscall.RLIMIT_CORE, &saved)
+	assert.NoError(err)
+	defer syscall.Setrlimit(syscall.RLIMIT_CORE, &saved)
+
+	// raising the soft limit up to the hard limit is always allowed
+	err = setRlimit("core", saved.Max)
+	assert.NoError(err)
+
+	var limit syscall.Rlimit
+	err = syscall.Getrlimit(syscall.RLIMIT_CORE, &limit)
+	assert.NoError(err)
+	assert.Equal(saved.Max, limit.Cur)
+	assert.Equal(saved.Max, limit.Max)
+
+	err = setRlimit("frobs", 1)
+	assert.Error(err)
+}
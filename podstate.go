@@ -0,0 +1,228 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// podStateFile is the name of the file holding the runtime state
+	// of a pod.
+	podStateFile = "state.json"
+
+	// podStateLockFile is the name of the file locked while the
+	// runtime state of a pod is updated.
+	podStateLockFile = "state.lock"
+
+	podStateDirMode  = os.FileMode(0750)
+	podStateFileMode = os.FileMode(0640)
+)
+
+// runtimeStateDir is the directory below which the runtime stores its
+// own state for each pod. It is set from the global "--root" option.
+var runtimeStateDir = defaultRootDirectory
+
+// podState is the state the runtime keeps for a pod, in addition to the
+// state kept by virtcontainers.
+type podState struct {
+	// IdlePaused is set when the pod was paused by the runtime because
+	// it was idle, rather than at the request of the user. The JSON
+	// names are those of older versions of the runtime.
+	IdlePaused bool `json:"suspended,omitempty"`
+
+	// IdlePausedAt is the time the pod was paused because it was idle.
+	IdlePausedAt time.Time `json:"suspendedAt"`
+
+	// LastActivity is the last time the runtime started, entered or
+	// signalled a container of the pod.
+	LastActivity time.Time `json:"lastActivity"`
+
+	// SharedFSCacheSize is the size cap in MiB of the guest cache of
+	// the filesystems shared with the host. Zero means no cap.
+	SharedFSCacheSize uint64 `json:"sharedFSCacheSize,omitempty"`
+
+	// Exits records how the most recent processes of the pod reaped
+	// by the runtime exited: the shims of the attached exec sessions.
+	Exits []processExit `json:"exits,omitempty"`
+
+	// Health is the result of the last health check of the pod.
+	Health *podHealth `json:"health,omitempty"`
+
+	// Restarts is the number of times "cc-restart" or a restart policy
+	// restarted the pod or one of its containers.
+	Restarts uint32 `json:"restarts,omitempty"`
+
+	// LastRestart is the time of the last restart.
+	LastRestart time.Time `json:"lastRestart"`
+
+	// Labels are the labels given to the pod when it was created.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// StaticResources is set when the VM of the pod was sized from its
+	// resources at creation and cannot be resized.
+	StaticResources bool `json:"staticResources,omitempty"`
+
+	// SandboxGroup is the sandbox group sharing the VM of the pod, and
+	// GroupPods the pods of the group still running in the VM.
+	SandboxGroup string   `json:"sandboxGroup,omitempty"`
+	GroupPods    []string `json:"groupPods,omitempty"`
+
+	// SandboxVM is the ID of the VM of the sandbox group the pod joined.
+	SandboxVM string `json:"sandboxVM,omitempty"`
+
+	// Execs lists the processes run in the containers of the pod by
+	// the exec command which have not been waited for or reaped.
+	Execs []execSession `json:"execs,omitempty"`
+
+	// ConsoleRingPID is the PID of the process keeping the recent
+	// output of the guest console, and ConsoleRingStart its start time,
+	// in clock ticks after boot.
+	ConsoleRingPID   int    `json:"consoleRingPID,omitempty"`
+	ConsoleRingStart uint64 `json:"consoleRingStart,omitempty"`
+
+	// ExpiresAt is the time after which the pod is deleted, if its
+	// lifetime is limited.
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// KernelPath is the kernel the guest of the pod boots, if the pod
+	// selected a kernel variant.
+	KernelPath string `json:"kernelPath,omitempty"`
+
+	// Partition is the host partition the pod runs on, and
+	// PartitionCPUs its CPUs when the pod was created.
+	Partition     string `json:"partition,omitempty"`
+	PartitionCPUs string `json:"partitionCPUs,omitempty"`
+}
+
+func podStateDir(podID string) string {
+	return filepath.Join(runtimeStateDir, podID)
+}
+
+func podStatePath(podID string) string {
+	return filepath.Join(podStateDir(podID), podStateFile)
+}
+
+// loadPodState returns the runtime state of the specified pod. A pod
+// without any state yet is not an error. The state written by older
+// versions of the runtime is upgraded, but the state written by newer
+// versions is refused.
+func loadPodState(podID string) (podState, error) {
+	bytes, err := ioutil.ReadFile(podStatePath(podID))
+	if os.IsNotExist(err) {
+		return podState{}, nil
+	} else if err != nil {
+		return podState{}, err
+	}
+
+	state, _, err := upgradePodState(podID, bytes)
+	return state, err
+}
+
+// lockPodState takes the lock serializing the updates of the runtime
+// state of the specified pod with the other runtime instances. Closing
+// the returned file releases the lock.
+func lockPodState(podID string) (*os.File, error) {
+	dir := podStateDir(podID)
+
+	if err := os.MkdirAll(dir, podStateDirMode); err != nil {
+		return nil, err
+	}
+
+	lock, err := os.OpenFile(filepath.Join(dir, podStateLockFile), os.O_CREATE|os.O_RDWR, podStateFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// updatePodState applies fn to the runtime state of the specified pod
+// and saves the result, unless fn fails. The update is serialized with
+// the other runtime instances by a lock, so fn must not update the
+// state of the same pod itself.
+func updatePodState(podID string, fn func(state *podState) error) error {
+	lock, err := lockPodState(podID)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	state, err := loadPodState(podID)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&state); err != nil {
+		return err
+	}
+
+	return savePodState(podID, state)
+}
+
+// savePodState atomically replaces the runtime state of the specified
+// pod. Use updatePodState rather than saving a state loaded before, or
+// concurrent updates are lost.
+func savePodState(podID string, state podState) error {
+	bytes, err := json.Marshal(versionedPodState{
+		Version:  podStateVersion,
+		podState: state,
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := podStateDir(podID)
+
+	if err := os.MkdirAll(dir, podStateDirMode); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, podStateFile+".")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(bytes)
+	if err == nil {
+		err = tmp.Chmod(podStateFileMode)
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), podStatePath(podID))
+}
+
+// removePodState deletes all runtime state of the specified pod.
+func removePodState(podID string) error {
+	return os.RemoveAll(podStateDir(podID))
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodStateLoadSaveRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "podstate-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	// no state yet
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(podState{}, state)
+
+	expected := podState{
+		IdlePaused:   true,
+		IdlePausedAt: time.Unix(1000, 0).UTC(),
+		LastActivity: time.Unix(500, 0).UTC(),
+	}
+
+	err = savePodState(testPodID, expected)
+	assert.NoError(err)
+	assert.True(fileExists(filepath.Join(dir, testPodID, podStateFile)))
+
+	state, err = loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(expected, state)
+
+	// no temporary files left behind
+	files, err := ioutil.ReadDir(filepath.Join(dir, testPodID))
+	assert.NoError(err)
+	assert.Len(files, 1)
+
+	err = removePodState(testPodID)
+	assert.NoError(err)
+	assert.False(fileExists(filepath.Join(dir, testPodID)))
+
+	// invalid state
+	err = os.MkdirAll(filepath.Join(dir, testPodID), testDirMode)
+	assert.NoError(err)
+	err = createFile(podStatePath(testPodID), "{")
+	assert.NoError(err)
+
+	_, err = loadPodState(testPodID)
+	assert.Error(err)
+}
+
+func TestUpdatePodStateConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "podstate-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	// no update is lost
+	const updates = 20
+
+	errs := make(chan error, updates)
+	for i := 0; i < updates; i++ {
+		go func() {
+			errs <- updatePodState(testPodID, func(state *podState) error {
+				state.Restarts++
+				return nil
+			})
+		}()
+	}
+
+	for i := 0; i < updates; i++ {
+		assert.NoError(<-errs)
+	}
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(uint32(updates), state.Restarts)
+
+	// a failed update is not saved
+	err = updatePodState(testPodID, func(state *podState) error {
+		state.Restarts = 0
+		return errors.New("update failed")
+	})
+	assert.Error(err)
+
+	state, err = loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(uint32(updates), state.Restarts)
+}
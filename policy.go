@@ -0,0 +1,275 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path"
+
+	"github.com/BurntSushi/toml"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// policySignatureSuffix is appended to the policy file path to obtain
+// the path of its signature.
+const policySignatureSuffix = ".sig"
+
+// policy restricts what sandboxes may do. Patterns use the syntax of
+// path.Match. Empty allow lists allow everything.
+type policy struct {
+	// Images.Annotation is the OCI annotation holding the image of a
+	// container, which must be set by the container engine: the image
+	// is only known to the caller of the runtime.
+	Images struct {
+		Allowed    []string `toml:"allowed"`
+		Annotation string   `toml:"annotation"`
+	} `toml:"images"`
+
+	Exec struct {
+		Deny bool `toml:"deny"`
+	} `toml:"exec"`
+
+	Mounts struct {
+		AllowedHostPaths []string `toml:"allowed_host_paths"`
+	} `toml:"mounts"`
+
+	Annotations struct {
+		Denied []string `toml:"denied"`
+	} `toml:"annotations"`
+
+	Copy struct {
+		Deny         bool     `toml:"deny"`
+		AllowedPaths []string `toml:"allowed_paths"`
+		MaxSize      uint64   `toml:"max_size"`
+	} `toml:"copy"`
+
+	Toolbox struct {
+		Deny    bool     `toml:"deny"`
+		Allowed []string `toml:"allowed"`
+	} `toml:"toolbox"`
+}
+
+// verifyPolicySignature checks that sig is a valid ECDSA signature of
+// the SHA-256 hash of data for the PEM encoded public key.
+func verifyPolicySignature(data, sig, keyPEM []byte) error {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return errors.New("Invalid policy key: no PEM data found")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Invalid policy key: %v", err)
+	}
+
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("Invalid policy key: not an ECDSA public key")
+	}
+
+	var esig struct {
+		R, S *big.Int
+	}
+
+	if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+		return fmt.Errorf("Invalid policy signature: %v", err)
+	}
+
+	hash := sha256.Sum256(data)
+
+	if !ecdsa.Verify(key, hash[:], esig.R, esig.S) {
+		return errors.New("Policy signature verification failed")
+	}
+
+	return nil
+}
+
+// loadPolicy returns the policy configured in the configuration file,
+// or nil if no policy is configured. The policy is only used if its
+// signature is valid.
+func loadPolicy() (*policy, error) {
+	if runtimeOptions.PolicyFile == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(runtimeOptions.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := ioutil.ReadFile(runtimeOptions.PolicyFile + policySignatureSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := ioutil.ReadFile(runtimeOptions.PolicyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyPolicySignature(data, sig, keyPEM); err != nil {
+		return nil, fmt.Errorf("%v: %v", runtimeOptions.PolicyFile, err)
+	}
+
+	var p policy
+
+	if _, err := toml.Decode(string(data), &p); err != nil {
+		return nil, fmt.Errorf("%v: %v", runtimeOptions.PolicyFile, err)
+	}
+
+	if len(p.Images.Allowed) > 0 && p.Images.Annotation == "" {
+		return nil, fmt.Errorf("%v: restricting images requires the annotation of the container engine holding the image in images.annotation",
+			runtimeOptions.PolicyFile)
+	}
+
+	for _, patterns := range [][]string{p.Images.Allowed, p.Mounts.AllowedHostPaths, p.Annotations.Denied, p.Copy.AllowedPaths, p.Toolbox.Allowed} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%v: invalid pattern %q", runtimeOptions.PolicyFile, pattern)
+			}
+		}
+	}
+
+	return &p, nil
+}
+
+// matchAny returns true if name matches one of the patterns. The
+// patterns have been validated by loadPolicy().
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkCreate returns an error if the policy forbids creating the
+// container. sources are the opened sources of its bind mounts.
+func (p *policy) checkCreate(ociSpec oci.CompatOCISpec, sources []*mountSource) error {
+	if p == nil {
+		return nil
+	}
+
+	if len(p.Images.Allowed) > 0 {
+		// Only the annotation of the container engine is trusted:
+		// it overwrites the value set by its own caller, unlike the
+		// annotations of other engines.
+		image := ociSpec.Annotations[p.Images.Annotation]
+		if image == "" {
+			return errors.New("Policy violation: unable to determine container image")
+		}
+
+		if !matchAny(p.Images.Allowed, image) {
+			return fmt.Errorf("Policy violation: image %q not allowed", image)
+		}
+	}
+
+	if len(p.Mounts.AllowedHostPaths) > 0 {
+		for i, m := range ociSpec.Mounts {
+			if sources[i] == nil {
+				continue
+			}
+
+			for _, source := range sources[i].paths {
+				if !matchAny(p.Mounts.AllowedHostPaths, source) {
+					return fmt.Errorf("Policy violation: host path %v not allowed", m.Source)
+				}
+			}
+		}
+	}
+
+	for name := range ociSpec.Annotations {
+		if matchAny(p.Annotations.Denied, name) {
+			return fmt.Errorf("Policy violation: annotation %v not allowed", name)
+		}
+	}
+
+	return nil
+}
+
+// checkExec returns an error if the policy forbids running new
+// processes inside containers.
+func (p *policy) checkExec() error {
+	if p != nil && p.Exec.Deny {
+		return errors.New("Policy violation: exec not allowed")
+	}
+
+	return nil
+}
+
+// checkToolbox returns an error if the policy forbids installing the
+// toolbox in containers.
+func (p *policy) checkToolbox() error {
+	if p != nil && p.Toolbox.Deny {
+		return errors.New("Policy violation: toolbox not allowed")
+	}
+
+	return nil
+}
+
+// allowToolbox returns true if the policy allows installing the toolbox
+// binary name.
+func (p *policy) allowToolbox(name string) bool {
+	return p == nil || len(p.Toolbox.Allowed) == 0 || matchAny(p.Toolbox.Allowed, name)
+}
+
+// checkCopy returns an error if the policy forbids copying files to or
+// from the container path p. A path is allowed if it, or one of its
+// parent directories, matches an allowed pattern.
+func (p *policy) checkCopy(containerPath string) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.Copy.Deny {
+		return errors.New("Policy violation: copy not allowed")
+	}
+
+	if len(p.Copy.AllowedPaths) == 0 {
+		return nil
+	}
+
+	for dir := containerPath; ; dir = path.Dir(dir) {
+		if matchAny(p.Copy.AllowedPaths, dir) {
+			return nil
+		}
+
+		if dir == "/" {
+			break
+		}
+	}
+
+	return fmt.Errorf("Policy violation: copying %v not allowed", containerPath)
+}
+
+func hasBindOption(options []string) bool {
+	for _, opt := range options {
+		if opt == "bind" || opt == "rbind" {
+			return true
+		}
+	}
+
+	return false
+}
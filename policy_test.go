@@ -0,0 +1,318 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicy = `
+[images]
+allowed = ["docker.io/library/*"]
+annotation = "io.kubernetes.cri.image-name"
+
+[exec]
+deny = true
+
+[mounts]
+allowed_host_paths = ["/srv/data/*"]
+
+[annotations]
+denied = ["com.github.clearcontainers.runtime.*"]
+`
+
+func signTestPolicy(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(struct{ R, S interface{} }{r, s})
+}
+
+// createTestPolicy writes a policy file, its signature and the public
+// key into dir, and configures the runtime to use them.
+func createTestPolicy(t *testing.T, dir, text string) *ecdsa.PrivateKey {
+	assert := assert.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(err)
+
+	runtimeOptions.PolicyFile = filepath.Join(dir, "policy.toml")
+	runtimeOptions.PolicyKey = filepath.Join(dir, "policy.pub")
+
+	err = ioutil.WriteFile(runtimeOptions.PolicyKey, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), testFileMode)
+	assert.NoError(err)
+
+	err = createFile(runtimeOptions.PolicyFile, text)
+	assert.NoError(err)
+
+	sig, err := signTestPolicy(key, []byte(text))
+	assert.NoError(err)
+
+	err = ioutil.WriteFile(runtimeOptions.PolicyFile+policySignatureSuffix, sig, testFileMode)
+	assert.NoError(err)
+
+	return key
+}
+
+func TestLoadPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "policy-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	// no policy
+	runtimeOptions = runtime{}
+	p, err := loadPolicy()
+	assert.NoError(err)
+	assert.Nil(p)
+
+	createTestPolicy(t, dir, testPolicy)
+
+	p, err = loadPolicy()
+	assert.NoError(err)
+	assert.NotNil(p)
+	assert.Equal([]string{"docker.io/library/*"}, p.Images.Allowed)
+	assert.Equal("io.kubernetes.cri.image-name", p.Images.Annotation)
+	assert.True(p.Exec.Deny)
+	assert.Equal([]string{"/srv/data/*"}, p.Mounts.AllowedHostPaths)
+
+	// modified policy
+	err = createFile(runtimeOptions.PolicyFile, "[exec]\ndeny = false\n")
+	assert.NoError(err)
+
+	_, err = loadPolicy()
+	assert.Error(err)
+
+	// signed with another key
+	key := createTestPolicy(t, dir, testPolicy)
+	otherKey := createTestPolicy(t, dir, testPolicy)
+	assert.NotEqual(key, otherKey)
+
+	sig, err := signTestPolicy(key, []byte(testPolicy))
+	assert.NoError(err)
+	err = ioutil.WriteFile(runtimeOptions.PolicyFile+policySignatureSuffix, sig, testFileMode)
+	assert.NoError(err)
+
+	_, err = loadPolicy()
+	assert.Error(err)
+
+	// images restricted without their annotation
+	createTestPolicy(t, dir, "[images]\nallowed = [\"docker.io/library/*\"]\n")
+	_, err = loadPolicy()
+	assert.Error(err)
+
+	// invalid pattern
+	createTestPolicy(t, dir, "[images]\nallowed = [\"[\"]\nannotation = \"image\"\n")
+	_, err = loadPolicy()
+	assert.Error(err)
+
+	// invalid TOML
+	createTestPolicy(t, dir, "[images")
+	_, err = loadPolicy()
+	assert.Error(err)
+
+	// missing signature
+	createTestPolicy(t, dir, testPolicy)
+	err = os.Remove(runtimeOptions.PolicyFile + policySignatureSuffix)
+	assert.NoError(err)
+
+	_, err = loadPolicy()
+	assert.Error(err)
+
+	// invalid key
+	createTestPolicy(t, dir, testPolicy)
+	err = createFile(runtimeOptions.PolicyKey, "foo")
+	assert.NoError(err)
+
+	_, err = loadPolicy()
+	assert.Error(err)
+}
+
+func TestVerifyPolicySignature(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(err)
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+
+	data := []byte("foo")
+	sig, err := signTestPolicy(key, data)
+	assert.NoError(err)
+
+	assert.NoError(verifyPolicySignature(data, sig, keyPEM))
+	assert.Error(verifyPolicySignature([]byte("bar"), sig, keyPEM))
+	assert.Error(verifyPolicySignature(data, []byte("sig"), keyPEM))
+	assert.Error(verifyPolicySignature(data, sig, []byte("key")))
+	assert.Error(verifyPolicySignature(data, sig, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("key")})))
+}
+
+func TestPolicyCheckCreate(t *testing.T) {
+	assert := assert.New(t)
+
+	var p *policy
+
+	// no policy
+	assert.NoError(p.checkCreate(oci.CompatOCISpec{}, nil))
+	assert.NoError(p.checkExec())
+
+	dir, err := ioutil.TempDir(testDir, "policy-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data")
+	assert.NoError(os.MkdirAll(filepath.Join(data, "foo"), testDirMode))
+
+	const imageAnnotation = "io.kubernetes.cri.image-name"
+
+	p = &policy{}
+	p.Images.Allowed = []string{"docker.io/library/*"}
+	p.Images.Annotation = imageAnnotation
+	p.Mounts.AllowedHostPaths = []string{data + "/*"}
+	p.Annotations.Denied = []string{sharedFSCacheSizeAnnotation}
+	p.Exec.Deny = true
+
+	assert.Error(p.checkExec())
+
+	checkCreate := func(spec oci.CompatOCISpec) error {
+		sources, err := openMountSources(spec)
+		if err != nil {
+			return err
+		}
+		defer closeMountSources(sources)
+
+		return p.checkCreate(spec, sources)
+	}
+
+	var spec oci.CompatOCISpec
+
+	// unknown image
+	assert.Error(checkCreate(spec))
+
+	spec.Annotations = map[string]string{
+		imageAnnotation: "docker.io/library/busybox",
+	}
+	assert.NoError(checkCreate(spec))
+
+	spec.Annotations[imageAnnotation] = "quay.io/evil/busybox"
+	assert.Error(checkCreate(spec))
+
+	// the annotations of other container engines are not trusted
+	spec.Annotations["io.kubernetes.cri-o.ImageName"] = "docker.io/library/busybox"
+	assert.Error(checkCreate(spec))
+
+	spec.Annotations[imageAnnotation] = "docker.io/library/busybox"
+
+	spec.Mounts = []specs.Mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/data", Type: "bind", Source: filepath.Join(data, "foo")},
+	}
+	assert.NoError(checkCreate(spec))
+
+	spec.Mounts = append(spec.Mounts, specs.Mount{Destination: "/etc", Source: "/etc", Options: []string{"rbind", "ro"}})
+	assert.Error(checkCreate(spec))
+
+	// the source is cleaned and its symbolic links resolved
+	spec.Mounts = []specs.Mount{{Destination: "/data", Type: "bind", Source: filepath.Join(data, "foo", "..")}}
+	assert.Error(checkCreate(spec))
+
+	link := filepath.Join(data, "link")
+	assert.NoError(os.Symlink("/etc", link))
+
+	spec.Mounts = []specs.Mount{{Destination: "/data", Type: "bind", Source: link}}
+	assert.Error(checkCreate(spec))
+
+	spec.Mounts = nil
+
+	// denied annotation
+	spec.Annotations[sharedFSCacheSizeAnnotation] = "1024"
+	assert.Error(checkCreate(spec))
+}
+
+func TestPolicyCheckCopy(t *testing.T) {
+	assert := assert.New(t)
+
+	var p *policy
+
+	// no policy
+	assert.NoError(p.checkCopy("/etc/passwd"))
+
+	p = &policy{}
+	assert.NoError(p.checkCopy("/etc/passwd"))
+
+	p.Copy.AllowedPaths = []string{"/tmp", "/var/log/*"}
+
+	assert.NoError(p.checkCopy("/tmp"))
+	assert.NoError(p.checkCopy("/tmp/foo/bar"))
+	assert.NoError(p.checkCopy("/var/log/app/app.log"))
+	assert.Error(p.checkCopy("/var/log"))
+	assert.Error(p.checkCopy("/etc/passwd"))
+	assert.Error(p.checkCopy("/"))
+
+	p.Copy.Deny = true
+	assert.Error(p.checkCopy("/tmp"))
+}
+
+func TestPolicyToolbox(t *testing.T) {
+	assert := assert.New(t)
+
+	var p *policy
+
+	// no policy
+	assert.NoError(p.checkToolbox())
+	assert.True(p.allowToolbox("strace"))
+
+	p = &policy{}
+	assert.NoError(p.checkToolbox())
+	assert.True(p.allowToolbox("strace"))
+
+	p.Toolbox.Allowed = []string{"busybox", "tcp*"}
+	assert.True(p.allowToolbox("busybox"))
+	assert.True(p.allowToolbox("tcpdump"))
+	assert.False(p.allowToolbox("strace"))
+
+	p.Toolbox.Deny = true
+	assert.Error(p.checkToolbox())
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/urfave/cli"
+)
+
+// defaultForwardAddress is the host address port-forward listens on by
+// default, so that the forwarded port is not exposed outside of the
+// host unless explicitly asked.
+const defaultForwardAddress = "127.0.0.1"
+
+// portForward describes a TCP port of the guest forwarded from the host.
+type portForward struct {
+	// hostAddr is the host address and port to listen on.
+	hostAddr string
+
+	// guestPort is the guest port to connect to.
+	guestPort uint16
+}
+
+// variable rather than a function to allow tests to modify it
+var podGuestIP = getPodGuestIP
+
+func parsePort(port string) (uint16, error) {
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("Invalid port %q", port)
+	}
+
+	return uint16(value), nil
+}
+
+// parsePortForward parses a port forwarding of the form
+// "[<host-address>:]<host-port>:<guest-port>".
+func parsePortForward(value string) (portForward, error) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return portForward{}, fmt.Errorf("Invalid port forwarding %q: expecting [<host-address>:]<host-port>:<guest-port>", value)
+	}
+
+	guestPort, err := parsePort(value[i+1:])
+	if err != nil {
+		return portForward{}, err
+	}
+
+	host := value[:i]
+	address := defaultForwardAddress
+
+	if j := strings.LastIndex(host, ":"); j >= 0 {
+		address = strings.Trim(host[:j], "[]")
+		host = host[j+1:]
+
+		if net.ParseIP(address) == nil {
+			return portForward{}, fmt.Errorf("Invalid host address %q", address)
+		}
+	}
+
+	hostPort, err := parsePort(host)
+	if err != nil {
+		return portForward{}, err
+	}
+
+	return portForward{
+		hostAddr:  net.JoinHostPort(address, strconv.FormatUint(uint64(hostPort), 10)),
+		guestPort: guestPort,
+	}, nil
+}
+
+// getPodGuestIP returns the IPv4 address of the guest of a pod. The
+// network plugin configured the address on an interface of the network
+// namespace of the pod before it was handed over to the guest.
+func getPodGuestIP(containerID string) (net.IP, error) {
+	status, _, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := containerNetNSPath(status)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		return nil, errors.New("The pod has no network namespace path: use --address to specify the guest address")
+	}
+
+	netNS, err := ns.GetNS(path)
+	if err != nil {
+		return nil, err
+	}
+	defer netNS.Close()
+
+	var ip net.IP
+
+	err = netNS.Do(func(ns.NetNS) error {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return err
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.To4() != nil && ipNet.IP.IsGlobalUnicast() {
+				ip = ipNet.IP
+				return nil
+			}
+		}
+
+		return fmt.Errorf("No IPv4 address found in the network namespace %v of the pod", path)
+	})
+
+	return ip, err
+}
+
+// forwardConn copies data both ways between two connections, until both
+// directions are closed.
+func forwardConn(client, guest net.Conn) {
+	var wg sync.WaitGroup
+
+	copyData := func(dst, src net.Conn) {
+		defer wg.Done()
+
+		io.Copy(dst, src)
+
+		// Let the other end know no more data is coming.
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	wg.Add(2)
+	go copyData(guest, client)
+	go copyData(client, guest)
+	wg.Wait()
+
+	client.Close()
+	guest.Close()
+}
+
+// servePortForward accepts connections on the listener and forwards
+// them to the guest address, until the listener is closed.
+func servePortForward(l net.Listener, guestAddr string) error {
+	for {
+		client, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			guest, err := net.Dial("tcp", guestAddr)
+			if err != nil {
+				ccLog.Warnf("Unable to connect to %v: %v", guestAddr, err)
+				client.Close()
+				return
+			}
+
+			forwardConn(client, guest)
+		}()
+	}
+}
+
+var portForwardCLICommand = cli.Command{
+	Name:  "port-forward",
+	Usage: "forward a host TCP port to a container",
+	ArgsUsage: `<container-id> [<host-address>:]<host-port>:<guest-port>
+
+   <container-id> is your name for the instance of the container`,
+	Description: `The port-forward command forwards the connections to a TCP port of the
+   host to a port of the guest of the pod of the container, until it is
+   interrupted. By default, the host port is only reachable from the host
+   (` + defaultForwardAddress + `).
+
+   The guest is reached through the pod network: its address is the one
+   the network plugin configured in the network namespace of the pod.
+   This is meant for using the runtime without an orchestrator.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "address",
+			Usage: "guest IP address to connect to (default: address of the pod network)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		args := context.Args()
+		if len(args) != 2 {
+			return fmt.Errorf("Expecting a container ID and a port forwarding, got %d arguments: %v", len(args), []string(args))
+		}
+
+		forward, err := parsePortForward(args.Get(1))
+		if err != nil {
+			return err
+		}
+
+		var ip net.IP
+
+		if address := context.String("address"); address != "" {
+			if ip = net.ParseIP(address); ip == nil {
+				return fmt.Errorf("Invalid guest address %q", address)
+			}
+
+			// Checks the MUST and MUST NOT from OCI runtime specification
+			if _, _, err := getExistingContainerInfo(args.First()); err != nil {
+				return err
+			}
+		} else {
+			ip, err = podGuestIP(args.First())
+			if err != nil {
+				return err
+			}
+		}
+
+		guestAddr := net.JoinHostPort(ip.String(), strconv.FormatUint(uint64(forward.guestPort), 10))
+
+		l, err := net.Listen("tcp", forward.hostAddr)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+
+		fmt.Fprintf(defaultOutputFile, "Forwarding %v -> %v\n", l.Addr(), guestAddr)
+
+		return servePortForward(l, guestAddr)
+	},
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"net"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePortForward(t *testing.T) {
+	assert := assert.New(t)
+
+	for value, expected := range map[string]portForward{
+		"8080:80":             {hostAddr: "127.0.0.1:8080", guestPort: 80},
+		"0.0.0.0:8080:80":     {hostAddr: "0.0.0.0:8080", guestPort: 80},
+		"[::1]:8443:443":      {hostAddr: "[::1]:8443", guestPort: 443},
+		"192.168.1.2:22:2222": {hostAddr: "192.168.1.2:22", guestPort: 2222},
+	} {
+		forward, err := parsePortForward(value)
+		assert.NoError(err, value)
+		assert.Equal(expected, forward, value)
+	}
+
+	for _, value := range []string{"", "8080", "8080:", ":80", "0:80", "8080:65536", "host:8080:80", "8080:http"} {
+		_, err := parsePortForward(value)
+		assert.Error(err, value)
+	}
+}
+
+func TestServePortForward(t *testing.T) {
+	assert := assert.New(t)
+
+	// echo server standing for the guest
+	guest, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer guest.Close()
+
+	go func() {
+		for {
+			conn, err := guest.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				conn.Write([]byte("echo: " + line))
+				conn.Close()
+			}()
+		}
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+
+	done := make(chan error)
+	go func() {
+		done <- servePortForward(l, guest.Addr().String())
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(err)
+
+	_, err = conn.Write([]byte("hello\n"))
+	assert.NoError(err)
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("echo: hello\n", reply)
+	conn.Close()
+
+	l.Close()
+	assert.Error(<-done)
+}
+
+func TestPortForwardCLIFunctionFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	savedPodGuestIP := podGuestIP
+	defer func() {
+		podGuestIP = savedPodGuestIP
+	}()
+
+	podGuestIP = func(containerID string) (net.IP, error) {
+		return net.ParseIP("10.0.0.2"), nil
+	}
+
+	state := vc.State{
+		State: vc.StateRunning,
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, state, state, map[string]string{}), nil
+	}
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	for _, args := range [][]string{
+		{},
+		{testContainerID},
+		{testContainerID, "8080"},
+		{testContainerID, "8080:80", "extra"},
+	} {
+		set := flag.NewFlagSet("", 0)
+		set.Parse(args)
+
+		execCLICommandFunc(assert, portForwardCLICommand, set, true)
+	}
+
+	set := flag.NewFlagSet("", 0)
+	set.String("address", "", "")
+	set.Parse([]string{"--address", "not-an-ip", testContainerID, "8080:80"})
+
+	execCLICommandFunc(assert, portForwardCLICommand, set, true)
+
+	// the host port cannot be listened on
+	set = flag.NewFlagSet("", 0)
+	set.Parse([]string{testContainerID, "192.0.2.1:8080:80"})
+
+	execCLICommandFunc(assert, portForwardCLICommand, set, true)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// Supported ways of handling privileged containers. Since a container
+// runs inside a VM, it can never be given access to the host, unlike
+// with runc.
+const (
+	// privilegedGuest gives privileged containers all the devices and
+	// all the capabilities inside the guest only.
+	privilegedGuest = "guest"
+
+	// privilegedReject refuses to create privileged containers.
+	privilegedReject = "reject"
+
+	defaultPrivileged = privilegedGuest
+)
+
+// privilegedAnnotation is the container annotation asking the guest
+// agent to give the container all the guest devices and capabilities.
+const privilegedAnnotation = ccAnnotationPrefix + "privileged"
+
+// privilegedCapabilities are the capabilities that, when all granted,
+// identify a privileged container (as created by "docker run
+// --privileged" for example). The OCI specification has no explicit
+// notion of privileged container.
+var privilegedCapabilities = []string{"CAP_SYS_ADMIN", "CAP_SYS_MODULE", "CAP_SYS_RAWIO"}
+
+func (r runtime) privileged() string {
+	if r.Privileged == "" {
+		return defaultPrivileged
+	}
+
+	return r.Privileged
+}
+
+func validPrivileged(mode string) bool {
+	return mode == privilegedGuest || mode == privilegedReject
+}
+
+// boundingCapabilities returns the bounding capabilities of the
+// process. Older specifications use a plain list of capabilities.
+func boundingCapabilities(process *oci.CompatOCIProcess) []string {
+	if process == nil {
+		return nil
+	}
+
+	var list []interface{}
+
+	switch caps := process.Capabilities.(type) {
+	case []interface{}:
+		list = caps
+	case map[string]interface{}:
+		list, _ = caps["bounding"].([]interface{})
+	case []string:
+		return caps
+	}
+
+	var result []string
+	for _, c := range list {
+		if s, ok := c.(string); ok {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// isPrivileged returns true if the container requests the privileges
+// of a privileged container.
+func isPrivileged(ociSpec oci.CompatOCISpec) bool {
+	caps := make(map[string]bool)
+	for _, c := range boundingCapabilities(ociSpec.Process) {
+		caps[c] = true
+	}
+
+	for _, c := range privilegedCapabilities {
+		if !caps[c] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handlePrivileged applies the configured semantics to privileged
+// containers.
+func handlePrivileged(ociSpec oci.CompatOCISpec, contConfig *vc.ContainerConfig) error {
+	if !isPrivileged(ociSpec) {
+		return nil
+	}
+
+	switch runtimeOptions.privileged() {
+	case privilegedReject:
+		return fmt.Errorf("Privileged container %v rejected by configuration", contConfig.ID)
+
+	case privilegedGuest:
+		ccLog.Infof("Privileged container %v: granting all devices and capabilities inside the guest only", contConfig.ID)
+
+		if contConfig.Annotations == nil {
+			contConfig.Annotations = make(map[string]string)
+		}
+
+		contConfig.Annotations[privilegedAnnotation] = "true"
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPrivilegedSpec(t *testing.T, capsJSON string) oci.CompatOCISpec {
+	var spec oci.CompatOCISpec
+
+	err := json.Unmarshal([]byte(`{"process": {"capabilities": `+capsJSON+`}}`), &spec)
+	assert.NoError(t, err)
+
+	return spec
+}
+
+func TestIsPrivileged(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		caps     string
+		expected bool
+	}
+
+	data := []testData{
+		{`null`, false},
+		{`["CAP_CHOWN"]`, false},
+		{`["CAP_SYS_ADMIN"]`, false},
+		{`["CAP_SYS_ADMIN", "CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_CHOWN"]`, true},
+		{`{"effective": ["CAP_SYS_ADMIN", "CAP_SYS_MODULE", "CAP_SYS_RAWIO"]}`, false},
+		{`{"bounding": ["CAP_SYS_ADMIN", "CAP_SYS_MODULE", "CAP_SYS_RAWIO"]}`, true},
+		{`{"bounding": "foo"}`, false},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, isPrivileged(newTestPrivilegedSpec(t, d.caps)), "%+v", d)
+	}
+
+	assert.False(isPrivileged(oci.CompatOCISpec{}))
+}
+
+func TestHandlePrivileged(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	runtimeOptions = runtime{}
+	assert.Equal(privilegedGuest, runtimeOptions.privileged())
+	assert.NoError(runtimeOptions.validate())
+
+	privileged := newTestPrivilegedSpec(t, `["CAP_SYS_ADMIN", "CAP_SYS_MODULE", "CAP_SYS_RAWIO"]`)
+	unprivileged := newTestPrivilegedSpec(t, `["CAP_CHOWN"]`)
+
+	contConfig := vc.ContainerConfig{ID: testContainerID}
+	assert.NoError(handlePrivileged(unprivileged, &contConfig))
+	assert.Empty(contConfig.Annotations)
+
+	assert.NoError(handlePrivileged(privileged, &contConfig))
+	assert.Equal("true", contConfig.Annotations[privilegedAnnotation])
+
+	runtimeOptions.Privileged = privilegedReject
+	assert.NoError(runtimeOptions.validate())
+
+	contConfig = vc.ContainerConfig{ID: testContainerID}
+	assert.Error(handlePrivileged(privileged, &contConfig))
+	assert.NoError(handlePrivileged(unprivileged, &contConfig))
+
+	runtimeOptions.Privileged = "host"
+	assert.Error(runtimeOptions.validate())
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// namespaceAnnotation is the OCI annotation which may be used to set the
+// namespace of a pod explicitly.
+const namespaceAnnotation = ccAnnotationPrefix + "namespace"
+
+// namespaceAnnotations lists the OCI annotations holding the namespace
+// of a pod, in order of preference. The other annotations are set by
+// the container managers of Kubernetes.
+var namespaceAnnotations = []string{
+	namespaceAnnotation,
+	"io.kubernetes.pod.namespace",
+	"io.kubernetes.cri.sandbox-namespace",
+}
+
+// profile overrides some settings of the configuration for the pods of
+// the listed namespaces.
+type profile struct {
+	Namespaces []string `toml:"namespaces"`
+
+	// DefaultVCPUs and DefaultMemSz override the hypervisor settings
+	// of the same name when set.
+	DefaultVCPUs int32  `toml:"default_vcpus"`
+	DefaultMemSz uint32 `toml:"default_memory"`
+
+	// KernelParams are added to the hypervisor kernel parameters.
+	KernelParams string `toml:"kernel_params"`
+
+	// SharedFSCacheSize overrides the hypervisor setting of the same
+	// name when set, as the best value differs between workloads, such
+	// as builds and databases.
+	SharedFSCacheSize uint32 `toml:"shared_fs_cache_size"`
+}
+
+// validProfiles checks that each namespace is mapped to a single profile.
+func validProfiles(profiles map[string]profile) error {
+	seen := make(map[string]string)
+
+	// sort the profiles to report errors consistently
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := profiles[name]
+
+		if len(p.Namespaces) == 0 {
+			return fmt.Errorf("Profile %q does not list any namespaces", name)
+		}
+
+		for _, ns := range p.Namespaces {
+			if ns == "" {
+				return fmt.Errorf("Profile %q lists an empty namespace", name)
+			}
+
+			if other, ok := seen[ns]; ok {
+				return fmt.Errorf("Namespace %q is listed by profiles %q and %q", ns, other, name)
+			}
+
+			seen[ns] = name
+		}
+	}
+
+	return nil
+}
+
+// podNamespace returns the namespace of a pod, or "" if it has none.
+func podNamespace(ociSpec oci.CompatOCISpec) string {
+	for _, annotation := range namespaceAnnotations {
+		if ns := ociSpec.Annotations[annotation]; ns != "" {
+			return ns
+		}
+	}
+
+	return ""
+}
+
+// namespaceProfile returns the name and the settings of the profile
+// of the specified namespace, or "" if there is none.
+func (r runtime) namespaceProfile(namespace string) (string, profile) {
+	if namespace == "" {
+		return "", profile{}
+	}
+
+	for name, p := range r.Profiles {
+		for _, ns := range p.Namespaces {
+			if ns == namespace {
+				return name, p
+			}
+		}
+	}
+
+	return "", profile{}
+}
+
+// applyProfile applies the settings of a profile to the runtime
+// configuration.
+func applyProfile(p profile, runtimeConfig *oci.RuntimeConfig) error {
+	if p.DefaultVCPUs != 0 {
+		runtimeConfig.HypervisorConfig.DefaultVCPUs = hypervisor{DefaultVCPUs: p.DefaultVCPUs}.defaultVCPUs()
+	}
+
+	if p.DefaultMemSz != 0 {
+		runtimeConfig.HypervisorConfig.DefaultMemSz = hypervisor{DefaultMemSz: p.DefaultMemSz}.defaultMemSz()
+	}
+
+	for _, param := range vc.DeserializeParams(strings.Fields(p.KernelParams)) {
+		if err := runtimeConfig.AddKernelParam(param); err != nil {
+			return err
+		}
+	}
+
+	hypervisorConfig := &runtimeConfig.HypervisorConfig
+
+	if p.SharedFSCacheSize != 0 {
+		hypervisorConfig.KernelParams = setKernelParam(hypervisorConfig.KernelParams,
+			vc.Param{Key: sharedFSCacheSizeParam, Value: strconv.FormatUint(uint64(p.SharedFSCacheSize), 10)})
+	}
+
+	return nil
+}
+
+// applyNamespaceProfile applies the profile of the namespace of a pod,
+// if any, to the runtime configuration used to create it.
+func applyNamespaceProfile(ociSpec oci.CompatOCISpec, runtimeConfig *oci.RuntimeConfig) error {
+	namespace := podNamespace(ociSpec)
+
+	name, p := runtimeOptions.namespaceProfile(namespace)
+	if name == "" {
+		return nil
+	}
+
+	ccLog.Infof("Using profile %q for namespace %q", name, namespace)
+
+	if err := applyProfile(p, runtimeConfig); err != nil {
+		return fmt.Errorf("Unable to apply profile %q: %v", name, err)
+	}
+
+	return nil
+}
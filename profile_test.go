@@ -0,0 +1,178 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validProfiles(nil))
+
+	profiles := map[string]profile{
+		"ml":    {Namespaces: []string{"ml", "training"}, DefaultMemSz: 8192},
+		"small": {Namespaces: []string{"ci"}, DefaultVCPUs: 1},
+	}
+
+	assert.NoError(validProfiles(profiles))
+
+	profiles["other"] = profile{Namespaces: []string{"training"}}
+	assert.Error(validProfiles(profiles))
+
+	profiles["other"] = profile{}
+	assert.Error(validProfiles(profiles))
+
+	profiles["other"] = profile{Namespaces: []string{""}}
+	assert.Error(validProfiles(profiles))
+
+	r := runtime{Profiles: profiles}
+	assert.Error(r.validate())
+}
+
+func TestPodNamespace(t *testing.T) {
+	assert := assert.New(t)
+
+	var spec oci.CompatOCISpec
+	assert.Equal("", podNamespace(spec))
+
+	spec.Annotations = map[string]string{"io.kubernetes.cri.sandbox-namespace": "cri"}
+	assert.Equal("cri", podNamespace(spec))
+
+	spec.Annotations["io.kubernetes.pod.namespace"] = "crio"
+	assert.Equal("crio", podNamespace(spec))
+
+	spec.Annotations[namespaceAnnotation] = "explicit"
+	assert.Equal("explicit", podNamespace(spec))
+}
+
+func TestApplyNamespaceProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	runtimeOptions = runtime{
+		Profiles: map[string]profile{
+			"ml": {
+				Namespaces:   []string{"ml"},
+				DefaultVCPUs: 300,
+				DefaultMemSz: 8192,
+				KernelParams: "foo=bar baz",
+			},
+			"ci": {
+				Namespaces: []string{"ci"},
+			},
+			"db": {
+				Namespaces:        []string{"db"},
+				SharedFSCacheSize: 256,
+			},
+		},
+	}
+
+	newConfig := func() oci.RuntimeConfig {
+		return oci.RuntimeConfig{
+			HypervisorConfig: vc.HypervisorConfig{
+				DefaultVCPUs: 2,
+				DefaultMemSz: 2048,
+				KernelParams: []vc.Param{{Key: "quiet"}},
+			},
+		}
+	}
+
+	spec := oci.CompatOCISpec{}
+
+	// no namespace
+	config := newConfig()
+	err := applyNamespaceProfile(spec, &config)
+	assert.NoError(err)
+	assert.Equal(newConfig(), config)
+
+	// no profile for the namespace
+	spec.Annotations = map[string]string{namespaceAnnotation: "default"}
+	err = applyNamespaceProfile(spec, &config)
+	assert.NoError(err)
+	assert.Equal(newConfig(), config)
+
+	// empty profile
+	spec.Annotations[namespaceAnnotation] = "ci"
+	err = applyNamespaceProfile(spec, &config)
+	assert.NoError(err)
+	assert.Equal(newConfig(), config)
+
+	spec.Annotations[namespaceAnnotation] = "ml"
+	err = applyNamespaceProfile(spec, &config)
+	assert.NoError(err)
+
+	assert.Equal(uint32(255), config.HypervisorConfig.DefaultVCPUs)
+	assert.Equal(uint32(8192), config.HypervisorConfig.DefaultMemSz)
+	assert.Equal([]vc.Param{{Key: "quiet"}, {Key: "foo", Value: "bar"}, {Key: "baz"}},
+		config.HypervisorConfig.KernelParams)
+
+	// shared filesystem settings
+	config = newConfig()
+
+	spec.Annotations[namespaceAnnotation] = "db"
+	err = applyNamespaceProfile(spec, &config)
+	assert.NoError(err)
+
+	assert.Equal([]vc.Param{{Key: "quiet"}, {Key: sharedFSCacheSizeParam, Value: "256"}},
+		config.HypervisorConfig.KernelParams)
+}
+
+func TestConfigLoadConfigurationProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	text, err := getFileContents(config.ConfigPath)
+	assert.NoError(err)
+
+	err = createFile(config.ConfigPath, text+`
+[runtime.profile.ml]
+namespaces = ["ml", "training"]
+default_memory = 16384
+`)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+
+	name, p := runtimeOptions.namespaceProfile("training")
+	assert.Equal("ml", name)
+	assert.Equal(uint32(16384), p.DefaultMemSz)
+
+	name, _ = runtimeOptions.namespaceProfile("default")
+	assert.Equal("", name)
+}
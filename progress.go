@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// progressStderr is the "--progress" value reporting the progress on
+// the standard error.
+const progressStderr = "stderr"
+
+// Phases of the creation and start of a container, in order. The
+// creation of a pod sandbox boots its VM: virtcontainers only returns
+// once the agent inside the VM is connected.
+const (
+	progressCreating       = "creating"
+	progressVMBooting      = "vm-booting"
+	progressAgentConnected = "agent-connected"
+	progressCreated        = "created"
+	progressStarting       = "starting"
+	progressStarted        = "started"
+	progressFailed         = "failed"
+)
+
+// progressEvent is the JSON line reported for each phase.
+type progressEvent struct {
+	Time  time.Time `json:"time"`
+	ID    string    `json:"id"`
+	Phase string    `json:"phase"`
+
+	// Elapsed is the time in milliseconds since the operation began.
+	Elapsed int64 `json:"elapsed"`
+
+	Error string `json:"error,omitempty"`
+
+	Warning *warning `json:"warning,omitempty"`
+}
+
+// progressReporter reports the progress of the operation on a
+// container.
+type progressReporter struct {
+	w     io.Writer
+	id    string
+	start time.Time
+}
+
+// progress is the reporter of the current operation, if its progress
+// was requested.
+var progress *progressReporter
+
+// report reports that the operation reached the specified phase.
+// Reporting is best effort: the operation goes on if the events cannot
+// be written.
+func (p *progressReporter) report(phase string, err error) {
+	if p == nil || p.w == nil {
+		return
+	}
+
+	event := p.event(phase)
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	p.write(event)
+}
+
+// reportWarning reports a warning of the operation.
+func (p *progressReporter) reportWarning(w warning) {
+	if p == nil || p.w == nil {
+		return
+	}
+
+	event := p.event(progressWarning)
+	event.Warning = &w
+
+	p.write(event)
+}
+
+func (p *progressReporter) event(phase string) progressEvent {
+	now := timeNow()
+
+	return progressEvent{
+		Time:    now.UTC(),
+		ID:      p.id,
+		Phase:   phase,
+		Elapsed: int64(now.Sub(p.start) / time.Millisecond),
+	}
+}
+
+func (p *progressReporter) write(event progressEvent) {
+	if writeErr := json.NewEncoder(p.w).Encode(event); writeErr != nil {
+		ccLog.Warnf("Unable to report progress: %v", writeErr)
+		p.w = nil
+	}
+}
+
+// reportProgress reports that the current operation reached the
+// specified phase, if its progress was requested.
+func reportProgress(phase string) {
+	progress.report(phase, nil)
+}
+
+// withProgress runs fn, an operation on the specified container,
+// reporting its progress to target: "stderr" or the path of a unix
+// socket. Nothing is reported if target is empty.
+func withProgress(target, containerID string, fn func() error) error {
+	if target == "" {
+		return fn()
+	}
+
+	p := &progressReporter{
+		id:    containerID,
+		start: timeNow(),
+	}
+
+	switch {
+	case target == progressStderr:
+		p.w = defaultErrorFile
+
+	case filepath.IsAbs(target):
+		conn, err := net.Dial("unix", target)
+		if err != nil {
+			return fmt.Errorf("Unable to connect to progress socket %v: %v", target, err)
+		}
+
+		defer conn.Close()
+		p.w = conn
+
+	default:
+		return fmt.Errorf("Invalid progress target %q: expecting %q or the absolute path of a unix socket",
+			target, progressStderr)
+	}
+
+	savedProgress := progress
+	progress = p
+	defer func() {
+		progress = savedProgress
+	}()
+
+	err := fn()
+
+	// The exit code of an attached container is not a failure.
+	if _, exited := err.(cli.ExitCoder); err != nil && !exited {
+		p.report(progressFailed, err)
+	}
+
+	return err
+}
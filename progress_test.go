@@ -0,0 +1,194 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+type failingWriter struct{}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func readProgressEvents(assert *assert.Assertions, contents string) []progressEvent {
+	var events []progressEvent
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		var event progressEvent
+		assert.NoError(json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func progressPhases(events []progressEvent) []string {
+	var phases []string
+	for _, e := range events {
+		phases = append(phases, e.Phase)
+	}
+
+	return phases
+}
+
+func TestWithProgressDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	called := false
+	err := withProgress("", testContainerID, func() error {
+		called = true
+		assert.Nil(progress)
+
+		// no-op
+		reportProgress(progressCreating)
+		return nil
+	})
+
+	assert.NoError(err)
+	assert.True(called)
+
+	err = withProgress("relative/socket", testContainerID, func() error {
+		assert.Fail("invalid target accepted")
+		return nil
+	})
+	assert.Error(err)
+}
+
+func TestWithProgressStderr(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "progress-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	errorFile, err := os.Create(filepath.Join(dir, "stderr"))
+	assert.NoError(err)
+	defer errorFile.Close()
+
+	start := time.Unix(1000, 0)
+	now := start
+
+	savedErrorFile := defaultErrorFile
+	savedTimeNow := timeNow
+	defer func() {
+		defaultErrorFile = savedErrorFile
+		timeNow = savedTimeNow
+	}()
+
+	defaultErrorFile = errorFile
+	timeNow = func() time.Time { return now }
+
+	err = withProgress(progressStderr, testContainerID, func() error {
+		reportProgress(progressCreating)
+		now = now.Add(1500 * time.Millisecond)
+		reportProgress(progressVMBooting)
+		return errors.New("boot failed")
+	})
+	assert.Error(err)
+	assert.Nil(progress)
+
+	// an attached container exiting is not a failure
+	err = withProgress(progressStderr, testContainerID, func() error {
+		return cli.NewExitError("", 3)
+	})
+	assert.Error(err)
+
+	contents, err := getFileContents(errorFile.Name())
+	assert.NoError(err)
+
+	events := readProgressEvents(assert, contents)
+	assert.Equal([]string{progressCreating, progressVMBooting, progressFailed}, progressPhases(events))
+
+	assert.Equal(testContainerID, events[0].ID)
+	assert.Equal(start.UTC(), events[0].Time)
+	assert.Equal(int64(0), events[0].Elapsed)
+	assert.Equal(int64(1500), events[1].Elapsed)
+	assert.Empty(events[1].Error)
+	assert.Equal("boot failed", events[2].Error)
+}
+
+func TestWithProgressSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "progress-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "progress.sock")
+
+	// nobody listening
+	err = withProgress(socket, testContainerID, func() error {
+		assert.Fail("progress socket not checked")
+		return nil
+	})
+	assert.Error(err)
+
+	l, err := net.Listen("unix", socket)
+	assert.NoError(err)
+	defer l.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+
+		contents, _ := ioutil.ReadAll(conn)
+		received <- string(contents)
+	}()
+
+	err = withProgress(socket, testContainerID, func() error {
+		reportProgress(progressStarting)
+		reportProgress(progressStarted)
+		return nil
+	})
+	assert.NoError(err)
+
+	events := readProgressEvents(assert, <-received)
+	assert.Equal([]string{progressStarting, progressStarted}, progressPhases(events))
+}
+
+func TestProgressReportWriteFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &progressReporter{w: failingWriter{}, id: testContainerID, start: timeNow()}
+
+	p.report(progressCreating, nil)
+	assert.Nil(p.w)
+
+	// further events are dropped
+	p.report(progressCreated, nil)
+
+	var nilReporter *progressReporter
+	nilReporter.report(progressCreated, nil)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/clearcontainers/proxy/client"
+)
+
+// proxy health event types
+const (
+	healthEventProxyFailed    = "proxy-failed"
+	healthEventProxyRestarted = "proxy-restarted"
+)
+
+const (
+	defaultProxyRestartTimeout = 10 * time.Second
+
+	// proxyCheckInterval is the time between the checks of a
+	// restarted proxy.
+	proxyCheckInterval = 100 * time.Millisecond
+)
+
+// proxyOptions stores the settings from the [proxy.cc] table that are
+// consumed by the runtime itself rather than by virtcontainers. It is
+// set by loadConfiguration() and is a variable to allow the tests to
+// modify it.
+var proxyOptions proxy
+
+func (p proxy) validate() error {
+	if len(p.RestartCommand) > 0 && !filepath.IsAbs(p.RestartCommand[0]) {
+		if _, err := exec.LookPath(p.RestartCommand[0]); err != nil {
+			return fmt.Errorf("Invalid proxy restart command %q: %v", p.RestartCommand[0], err)
+		}
+	}
+
+	if p.RestartTimeout != "" {
+		timeout, err := time.ParseDuration(p.RestartTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid proxy restart timeout %q", p.RestartTimeout)
+		}
+	}
+
+	return nil
+}
+
+// restartTimeout returns how long a restarted proxy has to answer.
+func (p proxy) restartTimeout() time.Duration {
+	if p.RestartTimeout == "" {
+		return defaultProxyRestartTimeout
+	}
+
+	timeout, _ := time.ParseDuration(p.RestartTimeout)
+	return timeout
+}
+
+// isProxyDown returns true if err shows the proxy did not answer, as
+// opposed to the proxy answering with an error.
+func isProxyDown(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// checkProxy checks that the proxy answers requests. It is a variable
+// rather than a function to allow tests to modify it.
+var checkProxy = func(ctx context.Context, proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "unix" {
+		return fmt.Errorf("Unsupported proxy URL %q", proxyURL)
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", u.Path)
+	if err != nil {
+		return fmt.Errorf("proxy not responding: %v", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	c := client.NewClient(conn)
+	defer c.Close()
+
+	// There is no VM without an ID: any answer, including the
+	// expected error, shows the proxy works.
+	if _, err := c.AttachVM("", nil); err != nil && isProxyDown(err) {
+		return fmt.Errorf("proxy not responding: %v", err)
+	}
+
+	return nil
+}
+
+// restart runs the restart command of the proxy and waits for the
+// proxy to answer.
+func (p proxy) restart(proxyURL string) error {
+	if len(p.RestartCommand) == 0 {
+		return errors.New("No proxy restart command configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.restartTimeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.RestartCommand[0], p.RestartCommand[1:]...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Unable to restart the proxy: %v: %s", err, output)
+	}
+
+	for {
+		err := checkProxy(ctx, proxyURL)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(proxyCheckInterval):
+		}
+	}
+}
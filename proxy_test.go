@@ -0,0 +1,209 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, p := range []proxy{
+		{},
+		{RestartCommand: []string{"/usr/bin/systemctl", "restart", "cc-proxy"}},
+		{RestartCommand: []string{"true"}, RestartTimeout: "1m"},
+	} {
+		assert.NoError(p.validate(), "%+v", p)
+	}
+
+	for _, p := range []proxy{
+		{RestartCommand: []string{"no-such-command-to-restart-the-proxy"}},
+		{RestartTimeout: "soon"},
+		{RestartTimeout: "0"},
+		{RestartTimeout: "-1s"},
+	} {
+		assert.Error(p.validate(), "%+v", p)
+	}
+}
+
+func TestProxyRestartTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(defaultProxyRestartTimeout, proxy{}.restartTimeout())
+	assert.Equal(3*time.Second, proxy{RestartTimeout: "3s"}.restartTimeout())
+}
+
+func TestConfigLoadConfigurationProxyOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	savedProxyOptions := proxyOptions
+	defer func() {
+		proxyOptions = savedProxyOptions
+	}()
+
+	text, err := getFileContents(config.ConfigPath)
+	assert.NoError(err)
+	assert.Contains(text, "[proxy.cc]")
+
+	restartText := strings.Replace(text, "[proxy.cc]",
+		"[proxy.cc]\nrestart_command = [\"/bin/true\"]\nrestart_timeout = \"3s\"", 1)
+	assert.NoError(createFile(config.ConfigPath, restartText))
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Equal([]string{"/bin/true"}, proxyOptions.RestartCommand)
+	assert.Equal(3*time.Second, proxyOptions.restartTimeout())
+
+	invalidText := strings.Replace(text, "[proxy.cc]", "[proxy.cc]\nrestart_timeout = \"never\"", 1)
+	assert.NoError(createFile(config.ConfigPath, invalidText))
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.Error(err)
+
+	noopText := strings.Replace(text, "[proxy.cc]", "[proxy.noop]", 1)
+	assert.NoError(createFile(config.ConfigPath, noopText))
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), errNoopProxy.Error())
+}
+
+func TestIsProxyDown(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isProxyDown(io.EOF))
+	assert.True(isProxyDown(io.ErrUnexpectedEOF))
+	assert.True(isProxyDown(&net.OpError{Op: "read", Err: errors.New("connection reset")}))
+	assert.False(isProxyDown(errors.New("unknown VM")))
+}
+
+func TestCheckProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "proxy-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.Error(checkProxy(ctx, "tcp://localhost:1234"))
+
+	path := filepath.Join(dir, "proxy.sock")
+
+	// no proxy
+	assert.Error(checkProxy(ctx, "unix://"+path))
+
+	// a proxy closing the connections without answering
+	l, err := net.Listen("unix", path)
+	assert.NoError(err)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	assert.Error(checkProxy(ctx, "unix://"+path))
+}
+
+func TestHealthCheckerCheckProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	var probeErr error
+	defer setupHealthTest(t, now, &probeErr)()
+
+	savedCheckProxy := checkProxy
+	defer func() {
+		checkProxy = savedCheckProxy
+	}()
+
+	checkProxy = func(ctx context.Context, proxyURL string) error {
+		assert.Equal(testProxyURL, proxyURL)
+		return errors.New("proxy not responding")
+	}
+
+	h := healthChecker{proxyURL: testProxyURL, timeout: time.Second, retries: 1}
+
+	// no restart command
+	events := h.checkProxy()
+	assert.Len(events, 1)
+	assert.Equal(healthEventProxyFailed, events[0].Type)
+	assert.Equal("proxy not responding", events[0].Error)
+
+	// the restart command fails
+	h.proxy.RestartCommand = []string{"false"}
+
+	events = h.checkProxy()
+	assert.Len(events, 1)
+
+	// the proxy is restarted
+	dir, err := ioutil.TempDir(testDir, "proxy-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	restarted := filepath.Join(dir, "restarted")
+	h.proxy.RestartCommand = []string{"touch", restarted}
+
+	checkProxy = func(ctx context.Context, proxyURL string) error {
+		if !fileExists(restarted) {
+			return errors.New("proxy not responding")
+		}
+
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	testingImpl.ListPodFunc = nil
+
+	// the events are written even when the pods cannot be listed
+	assert.Error(h.run(buf))
+
+	events = decodeHealthEvents(t, buf)
+	assert.Len(events, 2)
+	assert.Equal(healthEventProxyFailed, events[0].Type)
+	assert.Equal(healthEventProxyRestarted, events[1].Type)
+	assert.Empty(events[1].PodID)
+
+	// the proxy answers
+	events = h.checkProxy()
+	assert.Empty(events)
+}
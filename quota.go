@@ -0,0 +1,263 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// diskQuotaAnnotation is the OCI annotation used to limit the disk space
+// the writable layer of a container may use, for example "10G".
+const diskQuotaAnnotation = ccAnnotationPrefix + "disk_quota"
+
+const (
+	// Range of project IDs allocated to containers, chosen to avoid
+	// the IDs typically assigned by administrators.
+	minProjectID = 100000
+	maxProjectID = 1 << 31
+)
+
+// procMounts is the file listing the host mounts.
+var procMounts = "/proc/mounts"
+
+// sysDevBlockDir is the sysfs directory listing block devices by
+// number.
+var sysDevBlockDir = "/sys/dev/block"
+
+// setProjectQuota is the function used to limit the disk usage of a
+// directory (for testing).
+var setProjectQuota = setProjectQuotaFull
+
+// mountEntry describes a line of /proc/mounts.
+type mountEntry struct {
+	source     string
+	mountPoint string
+	fsType     string
+	options    []string
+}
+
+// parseSize converts a size such as "512M" or "10G" into bytes. Sizes
+// without a suffix are in bytes.
+func parseSize(size string) (uint64, error) {
+	multipliers := map[string]uint64{
+		"K": 1 << 10,
+		"M": 1 << 20,
+		"G": 1 << 30,
+		"T": 1 << 40,
+	}
+
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	multiplier := uint64(1)
+
+	if len(s) > 0 {
+		if m, ok := multipliers[s[len(s)-1:]]; ok {
+			multiplier = m
+			s = s[:len(s)-1]
+		}
+	}
+
+	value, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("Invalid size %q", size)
+	}
+
+	return value * multiplier, nil
+}
+
+func getMounts() ([]mountEntry, error) {
+	f, err := os.Open(procMounts)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Spaces and other special characters are octal-escaped
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+	var mounts []mountEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		mounts = append(mounts, mountEntry{
+			source:     unescape.Replace(fields[0]),
+			mountPoint: unescape.Replace(fields[1]),
+			fsType:     fields[2],
+			options:    strings.Split(fields[3], ","),
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+// findMount returns the mount containing the specified path. Later
+// entries take precedence as they may hide earlier ones.
+func findMount(mounts []mountEntry, path string) (mountEntry, error) {
+	var found *mountEntry
+
+	for i, m := range mounts {
+		if path != m.mountPoint && !strings.HasPrefix(path, strings.TrimSuffix(m.mountPoint, "/")+"/") {
+			continue
+		}
+
+		if found == nil || len(m.mountPoint) >= len(found.mountPoint) {
+			found = &mounts[i]
+		}
+	}
+
+	if found == nil {
+		return mountEntry{}, fmt.Errorf("Unable to find mount containing %v", path)
+	}
+
+	return *found, nil
+}
+
+// writableLayerDir returns the directory holding the writable layer of
+// the specified root filesystem: the upper directory of an overlay
+// mount, or the root filesystem itself.
+func writableLayerDir(mounts []mountEntry, rootfs string) (string, error) {
+	m, err := findMount(mounts, rootfs)
+	if err != nil {
+		return "", err
+	}
+
+	if m.fsType != "overlay" || m.mountPoint != rootfs {
+		return rootfs, nil
+	}
+
+	for _, opt := range m.options {
+		if strings.HasPrefix(opt, "upperdir=") {
+			return strings.TrimPrefix(opt, "upperdir="), nil
+		}
+	}
+
+	return "", fmt.Errorf("Overlay root filesystem %v has no writable layer", rootfs)
+}
+
+// overlayLowerDirs returns the lower directories of the overlay mounted
+// on the specified root filesystem, or nil if it is not an overlay.
+func overlayLowerDirs(mounts []mountEntry, rootfs string) ([]string, error) {
+	m, err := findMount(mounts, rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.fsType != "overlay" || m.mountPoint != rootfs {
+		return nil, nil
+	}
+
+	for _, opt := range m.options {
+		if !strings.HasPrefix(opt, "lowerdir=") {
+			continue
+		}
+
+		// colons in the directory names are escaped
+		value := strings.Replace(strings.TrimPrefix(opt, "lowerdir="), `\:`, "\x00", -1)
+
+		var dirs []string
+		for _, dir := range strings.Split(value, ":") {
+			dirs = append(dirs, strings.Replace(dir, "\x00", ":", -1))
+		}
+
+		return dirs, nil
+	}
+
+	return nil, nil
+}
+
+// isDeviceMapper returns true if the specified device is a device
+// mapper device, as used by the devicemapper storage driver.
+func isDeviceMapper(major, minor int64) bool {
+	return fileExists(filepath.Join(sysDevBlockDir, fmt.Sprintf("%d:%d", major, minor), "dm"))
+}
+
+// projectID returns the quota project ID used for the specified
+// container.
+func projectID(containerID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(containerID))
+
+	return minProjectID + h.Sum32()%(maxProjectID-minProjectID)
+}
+
+// applyDiskQuota limits the disk space the writable layer of the
+// container may use, as requested by the disk quota annotation.
+//
+// When the root filesystem is a device mapper device, it is passed to
+// the VM as a block device whose size already bounds the disk usage.
+// Otherwise the root filesystem is shared with the VM and a project
+// quota is set on the host directory holding the writable layer.
+func applyDiskQuota(ociSpec oci.CompatOCISpec, containerID, bundlePath string) error {
+	value, ok := ociSpec.Annotations[diskQuotaAnnotation]
+	if !ok {
+		return nil
+	}
+
+	quota, err := parseSize(value)
+	if err != nil {
+		return fmt.Errorf("Invalid value for annotation %v: %v", diskQuotaAnnotation, err)
+	}
+
+	rootfs := rootfsPath(ociSpec, bundlePath)
+
+	dev, err := fileDevice(rootfs)
+	if err != nil {
+		return err
+	}
+
+	major, minor := devMajorMinor(dev)
+	if isDeviceMapper(major, minor) {
+		ccLog.Infof("Root filesystem of container %v is a block device: disk usage limited by its size", containerID)
+		return nil
+	}
+
+	mounts, err := getMounts()
+	if err != nil {
+		return err
+	}
+
+	dir, err := writableLayerDir(mounts, rootfs)
+	if err != nil {
+		return err
+	}
+
+	m, err := findMount(mounts, dir)
+	if err != nil {
+		return err
+	}
+
+	return setProjectQuota(dir, m.source, projectID(containerID), quota)
+}
+
+// devMajorMinor splits a device number into its major and minor parts,
+// using the same encoding as glibc.
+func devMajorMinor(dev uint64) (int64, int64) {
+	major := int64((dev>>8)&0xfff | (dev>>32)&0xfffff000)
+	minor := int64(dev&0xff | (dev>>12)&0xffffff00)
+
+	return major, minor
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// from linux/fs.h
+	fsIocFsGetXattr    = 0x801c581f
+	fsIocFsSetXattr    = 0x401c5820
+	fsXflagProjInherit = 0x200
+
+	// from linux/quota.h
+	qSetQuota   = 0x800008
+	prjQuota    = 2
+	qifBLimits  = 1
+	quotaBlock  = 1024
+	subCmdShift = 8
+)
+
+// fsxattr is struct fsxattr from linux/fs.h.
+type fsxattr struct {
+	xflags     uint32
+	extsize    uint32
+	nextents   uint32
+	projid     uint32
+	cowextsize uint32
+	pad        [8]byte
+}
+
+// ifDqblk is struct if_dqblk from linux/quota.h.
+type ifDqblk struct {
+	bhardlimit uint64
+	bsoftlimit uint64
+	curspace   uint64
+	ihardlimit uint64
+	isoftlimit uint64
+	curinodes  uint64
+	btime      uint64
+	itime      uint64
+	valid      uint32
+}
+
+// setFileProjectID sets the project ID of a file, and makes new files
+// created below a directory inherit it.
+func setFileProjectID(path string, id uint32, dir bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var attr fsxattr
+
+	if err := ioctl(f.Fd(), fsIocFsGetXattr, uintptr(unsafe.Pointer(&attr))); err != nil {
+		return fmt.Errorf("Unable to get attributes of %v: %v", path, err)
+	}
+
+	attr.projid = id
+	if dir {
+		attr.xflags |= fsXflagProjInherit
+	}
+
+	if err := ioctl(f.Fd(), fsIocFsSetXattr, uintptr(unsafe.Pointer(&attr))); err != nil {
+		return fmt.Errorf("Unable to set project ID of %v: %v", path, err)
+	}
+
+	return nil
+}
+
+// setProjectQuotaFull limits the disk usage of dir, located on the
+// specified block device, using a project quota. The filesystem must be
+// mounted with project quotas enabled.
+func setProjectQuotaFull(dir, device string, id uint32, bytes uint64) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Only regular files and directories have project IDs
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		return setFileProjectID(path, id, info.IsDir())
+	})
+	if err != nil {
+		return err
+	}
+
+	devicePtr, err := syscall.BytePtrFromString(device)
+	if err != nil {
+		return err
+	}
+
+	limits := ifDqblk{
+		bhardlimit: (bytes + quotaBlock - 1) / quotaBlock,
+		bsoftlimit: (bytes + quotaBlock - 1) / quotaBlock,
+		valid:      qifBLimits,
+	}
+
+	cmd := uintptr(qSetQuota<<subCmdShift | prjQuota)
+
+	if _, _, errno := syscall.Syscall6(syscall.SYS_QUOTACTL, cmd, uintptr(unsafe.Pointer(devicePtr)),
+		uintptr(id), uintptr(unsafe.Pointer(&limits)), 0, 0); errno != 0 {
+		return fmt.Errorf("Unable to set project quota on %v (is the filesystem mounted with prjquota?): %v", device, errno)
+	}
+
+	return nil
+}
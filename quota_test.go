@@ -0,0 +1,239 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		size        string
+		expected    uint64
+		expectError bool
+	}
+
+	data := []testData{
+		{"", 0, true},
+		{"0", 0, true},
+		{"foo", 0, true},
+		{"-1G", 0, true},
+		{"G", 0, true},
+		{"4096", 4096, false},
+		{"1k", 1024, false},
+		{"512M", 512 << 20, false},
+		{"10G", 10 << 30, false},
+		{"10GB", 10 << 30, false},
+		{"2T", 2 << 40, false},
+	}
+
+	for _, d := range data {
+		size, err := parseSize(d.size)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, size, "%+v", d)
+	}
+}
+
+func TestGetMountsFindMount(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "quota-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedProcMounts := procMounts
+	defer func() {
+		procMounts = savedProcMounts
+	}()
+
+	procMounts = filepath.Join(dir, "mounts")
+
+	_, err = getMounts()
+	assert.Error(err)
+
+	err = createFile(procMounts, `/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sdb1 /var/lib xfs rw,prjquota 0 0
+overlay /var/lib/docker/overlay2/abc/merged overlay rw,lowerdir=/l,upperdir=/var/lib/docker/overlay2/abc/diff,workdir=/w 0 0
+/dev/sdc1 /mnt/with\040space ext4 rw 0 0
+`)
+	assert.NoError(err)
+
+	mounts, err := getMounts()
+	assert.NoError(err)
+	assert.Len(mounts, 4)
+	assert.Equal("/mnt/with space", mounts[3].mountPoint)
+
+	m, err := findMount(mounts, "/var/lib/docker/overlay2/abc/diff")
+	assert.NoError(err)
+	assert.Equal("/dev/sdb1", m.source)
+
+	m, err = findMount(mounts, "/var/library")
+	assert.NoError(err)
+	assert.Equal("/dev/sda1", m.source)
+
+	_, err = findMount(nil, "/")
+	assert.Error(err)
+
+	layer, err := writableLayerDir(mounts, "/var/lib/docker/overlay2/abc/merged")
+	assert.NoError(err)
+	assert.Equal("/var/lib/docker/overlay2/abc/diff", layer)
+
+	layer, err = writableLayerDir(mounts, "/var/lib/rootfs")
+	assert.NoError(err)
+	assert.Equal("/var/lib/rootfs", layer)
+
+	dirs, err := overlayLowerDirs(mounts, "/var/lib/docker/overlay2/abc/merged")
+	assert.NoError(err)
+	assert.Equal([]string{"/l"}, dirs)
+
+	// not an overlay
+	dirs, err = overlayLowerDirs(mounts, "/var/lib/rootfs")
+	assert.NoError(err)
+	assert.Empty(dirs)
+
+	// read-only overlay
+	mounts = append(mounts, mountEntry{source: "overlay", mountPoint: "/ro", fsType: "overlay", options: []string{`lowerdir=/a\:1:/b`}})
+	_, err = writableLayerDir(mounts, "/ro")
+	assert.Error(err)
+
+	// colons in the directory names are escaped
+	dirs, err = overlayLowerDirs(mounts, "/ro")
+	assert.NoError(err)
+	assert.Equal([]string{"/a:1", "/b"}, dirs)
+}
+
+func TestProjectID(t *testing.T) {
+	assert := assert.New(t)
+
+	id := projectID(testContainerID)
+	assert.True(id >= minProjectID)
+	assert.True(id < maxProjectID)
+	assert.Equal(id, projectID(testContainerID))
+	assert.NotEqual(id, projectID(testPodID))
+}
+
+func TestApplyDiskQuota(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "quota-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedProcMounts := procMounts
+	savedSysDevBlockDir := sysDevBlockDir
+	savedSetProjectQuota := setProjectQuota
+	defer func() {
+		procMounts = savedProcMounts
+		sysDevBlockDir = savedSysDevBlockDir
+		setProjectQuota = savedSetProjectQuota
+	}()
+
+	rootfs := filepath.Join(dir, "rootfs")
+	err = os.MkdirAll(rootfs, testDirMode)
+	assert.NoError(err)
+
+	procMounts = filepath.Join(dir, "mounts")
+	err = createFile(procMounts, fmt.Sprintf("/dev/sda1 / ext4 rw 0 0\n/dev/sdb1 %s xfs rw,prjquota 0 0\n", dir))
+	assert.NoError(err)
+
+	sysDevBlockDir = filepath.Join(dir, "sys")
+
+	type quotaCall struct {
+		dir    string
+		device string
+		id     uint32
+		bytes  uint64
+	}
+
+	var calls []quotaCall
+	setProjectQuota = func(dir, device string, id uint32, bytes uint64) error {
+		calls = append(calls, quotaCall{dir, device, id, bytes})
+		return nil
+	}
+
+	var spec oci.CompatOCISpec
+	spec.Root = specs.Root{Path: "rootfs"}
+
+	// not requested
+	err = applyDiskQuota(spec, testContainerID, dir)
+	assert.NoError(err)
+	assert.Empty(calls)
+
+	spec.Annotations = map[string]string{
+		diskQuotaAnnotation: "foo",
+	}
+
+	err = applyDiskQuota(spec, testContainerID, dir)
+	assert.Error(err)
+
+	spec.Annotations[diskQuotaAnnotation] = "1G"
+
+	err = applyDiskQuota(spec, testContainerID, dir)
+	assert.NoError(err)
+	assert.Equal([]quotaCall{{rootfs, "/dev/sdb1", projectID(testContainerID), 1 << 30}}, calls)
+
+	// device mapper root filesystem: nothing to do
+	var st syscall.Stat_t
+	err = syscall.Stat(rootfs, &st)
+	assert.NoError(err)
+
+	major, minor := devMajorMinor(uint64(st.Dev))
+	err = os.MkdirAll(filepath.Join(sysDevBlockDir, fmt.Sprintf("%d:%d", major, minor), "dm"), testDirMode)
+	assert.NoError(err)
+
+	calls = nil
+	err = applyDiskQuota(spec, testContainerID, dir)
+	assert.NoError(err)
+	assert.Empty(calls)
+}
+
+func TestDevMajorMinor(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		dev   uint64
+		major int64
+		minor int64
+	}
+
+	data := []testData{
+		{0x0801, 8, 1},
+		{0xfd00, 253, 0},
+		{0x10010303, 259, 0x10003},
+		{0x100000000801, 0x1008, 1},
+	}
+
+	for _, d := range data {
+		major, minor := devMajorMinor(d.dev)
+		assert.Equal(d.major, major, "%+v", d)
+		assert.Equal(d.minor, minor, "%+v", d)
+	}
+}
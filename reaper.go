@@ -0,0 +1,234 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxPodExits is the number of process exits kept in the pod state.
+const maxPodExits = 10
+
+// processExit records how a process related to a pod exited.
+type processExit struct {
+	Name   string    `json:"name"`
+	PID    int       `json:"pid"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// trackedProcess identifies a process whose exit is recorded in the
+// state of its pod.
+type trackedProcess struct {
+	podID string
+	name  string
+}
+
+// reaper reaps all the children of the runtime, including the
+// processes reparented to it when it is a subreaper, so that they do not
+// accumulate as zombies.
+//
+// Only an attached exec, which lives as long as its process, runs a
+// reaper. create and start return as soon as virtcontainers launched the
+// hypervisor, proxy and shims, which are then reaped by the parent of
+// the runtime or by init. A reaper in cc-daemon would steal the exit
+// status of the processes virtcontainers waits for with os/exec: see
+// "Hypervisor and proxy exits" in docs/limitations.md.
+type reaper struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	// exits holds the wait status of the reaped processes that may
+	// be waited for. Entries are set to nil once consumed (the
+	// builtin delete is shadowed in this package).
+	exits map[int]*syscall.WaitStatus
+
+	// tracked maps the PIDs of the processes whose exit should be
+	// recorded.
+	tracked map[int]*trackedProcess
+
+	// noChildren is set when the runtime has no children left to
+	// reap.
+	noChildren bool
+
+	sigCh chan os.Signal
+	done  chan struct{}
+}
+
+// exitReason describes how a process exited.
+func exitReason(ws syscall.WaitStatus) string {
+	switch {
+	case ws.Exited():
+		return fmt.Sprintf("exited with status %d", ws.ExitStatus())
+	case ws.Signaled() && ws.CoreDump():
+		return fmt.Sprintf("killed by signal %v (core dumped)", ws.Signal())
+	case ws.Signaled():
+		return fmt.Sprintf("killed by signal %v", ws.Signal())
+	}
+
+	return "unknown"
+}
+
+// recordPodExit adds a process exit to the pod state, keeping only the
+// most recent ones.
+func recordPodExit(podID string, exit processExit) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.Exits = append(state.Exits, exit)
+		if len(state.Exits) > maxPodExits {
+			state.Exits = state.Exits[len(state.Exits)-maxPodExits:]
+		}
+		return nil
+	})
+}
+
+// newReaper creates a reaper for the children of the runtime.
+func newReaper() *reaper {
+	r := &reaper{
+		exits:   make(map[int]*syscall.WaitStatus),
+		tracked: make(map[int]*trackedProcess),
+		sigCh:   make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+
+	r.cond = sync.NewCond(r)
+
+	return r
+}
+
+// start starts reaping children.
+func (r *reaper) start() {
+	signal.Notify(r.sigCh, syscall.SIGCHLD)
+
+	go r.loop()
+}
+
+func (r *reaper) loop() {
+	defer close(r.done)
+
+	// Children may have exited before SIGCHLD was handled.
+	r.reap()
+
+	for range r.sigCh {
+		r.reap()
+	}
+}
+
+// reap collects all the exited children.
+func (r *reaper) reap() {
+	for {
+		var ws syscall.WaitStatus
+
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+
+		if err != nil || pid <= 0 {
+			r.Lock()
+			r.noChildren = err == syscall.ECHILD
+			r.cond.Broadcast()
+			r.Unlock()
+			return
+		}
+
+		r.Lock()
+		r.exits[pid] = &ws
+		p := r.tracked[pid]
+		r.tracked[pid] = nil
+		r.cond.Broadcast()
+		r.Unlock()
+
+		ccLog.Debugf("Reaped process %d: %s", pid, exitReason(ws))
+
+		if p == nil {
+			continue
+		}
+
+		exit := processExit{
+			Name:   p.name,
+			PID:    pid,
+			Reason: exitReason(ws),
+			Time:   timeNow(),
+		}
+
+		if err := recordPodExit(p.podID, exit); err != nil {
+			ccLog.Warnf("Unable to record exit of %s process %d of pod %s: %v", p.name, pid, p.podID, err)
+		}
+	}
+}
+
+// track records the exit of the specified process in the state of its
+// pod. Processes that may already have exited must be tracked before
+// starting the reaper.
+func (r *reaper) track(pid int, podID, name string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.tracked[pid] = &trackedProcess{podID: podID, name: name}
+}
+
+// startTracked starts a process with start, which returns its PID, and
+// records its exit in the state of its pod, even if it exits before
+// startTracked returns.
+func (r *reaper) startTracked(podID, name string, start func() (int, error)) (int, error) {
+	// The reaper cannot look up the process before it is tracked.
+	r.Lock()
+	defer r.Unlock()
+
+	pid, err := start()
+	if err != nil {
+		return pid, err
+	}
+
+	r.tracked[pid] = &trackedProcess{podID: podID, name: name}
+
+	return pid, nil
+}
+
+// wait waits for the specified child process to exit. This must be used
+// instead of os.Process.Wait() while the reaper is running.
+func (r *reaper) wait(pid int) (syscall.WaitStatus, error) {
+	if pid <= 0 {
+		return 0, fmt.Errorf("Invalid process ID %d", pid)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for {
+		if ws := r.exits[pid]; ws != nil {
+			r.exits[pid] = nil
+			return *ws, nil
+		}
+
+		if r.noChildren {
+			return 0, fmt.Errorf("Process %d is not a child of the runtime", pid)
+		}
+
+		r.cond.Wait()
+	}
+}
+
+// stop stops reaping children.
+func (r *reaper) stop() {
+	signal.Stop(r.sigCh)
+	close(r.sigCh)
+	<-r.done
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaperExitReason(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		ws       syscall.WaitStatus
+		expected string
+	}
+
+	data := []testData{
+		{syscall.WaitStatus(0), "exited with status 0"},
+		{syscall.WaitStatus(3 << 8), "exited with status 3"},
+		{syscall.WaitStatus(syscall.SIGKILL), "killed by signal killed"},
+		{syscall.WaitStatus(syscall.SIGSEGV | 0x80), "killed by signal segmentation fault (core dumped)"},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, exitReason(d.ws), "%+v", d)
+	}
+}
+
+func TestReaperRecordPodExit(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "reaper-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	for i := 1; i <= maxPodExits+2; i++ {
+		err = recordPodExit(testPodID, processExit{Name: "shim", PID: i})
+		assert.NoError(err)
+	}
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Len(state.Exits, maxPodExits)
+
+	// only the most recent exits are kept
+	assert.Equal(3, state.Exits[0].PID)
+	assert.Equal(maxPodExits+2, state.Exits[maxPodExits-1].PID)
+}
+
+func TestReaperWait(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "reaper-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	tracked := exec.Command("sh", "-c", "exit 3")
+	err = tracked.Start()
+	assert.NoError(err)
+
+	untracked := exec.Command("true")
+	err = untracked.Start()
+	assert.NoError(err)
+
+	r := newReaper()
+	r.track(tracked.Process.Pid, testPodID, "shim")
+	r.start()
+	defer r.stop()
+
+	ws, err := r.wait(tracked.Process.Pid)
+	assert.NoError(err)
+	assert.Equal(3, ws.ExitStatus())
+
+	ws, err = r.wait(untracked.Process.Pid)
+	assert.NoError(err)
+	assert.True(ws.Exited())
+
+	_, err = r.wait(0)
+	assert.Error(err)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Len(state.Exits, 1)
+
+	exit := state.Exits[0]
+	assert.Equal("shim", exit.Name)
+	assert.Equal(tracked.Process.Pid, exit.PID)
+	assert.Equal("exited with status 3", exit.Reason)
+}
+
+func TestReaperStartTracked(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "reaper-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	r := newReaper()
+	r.start()
+
+	_, err = r.startTracked(testPodID, "shim", func() (int, error) {
+		return -1, errors.New("start failed")
+	})
+	assert.Error(err)
+
+	pid, err := r.startTracked(testPodID, "shim", func() (int, error) {
+		cmd := exec.Command("sh", "-c", "exit 4")
+		if err := cmd.Start(); err != nil {
+			return -1, err
+		}
+
+		return cmd.Process.Pid, nil
+	})
+	assert.NoError(err)
+
+	ws, err := r.wait(pid)
+	assert.NoError(err)
+	assert.Equal(4, ws.ExitStatus())
+
+	// The exit is recorded after the waiters are woken up.
+	r.stop()
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Len(state.Exits, 1)
+	assert.Equal(pid, state.Exits[0].PID)
+	assert.Equal("exited with status 4", state.Exits[0].Reason)
+}
+
+func TestReaperSetSubreaper(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(setSubreaper(true))
+	assert.NoError(setSubreaper(false))
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+)
+
+// reservationsFile is the file, below the runtime state directory,
+// listing the host resources committed to each pod. Other node agents
+// read it to avoid allocating the same resources.
+const reservationsFile = "reservations.json"
+
+const reservationsFileMode = os.FileMode(0644)
+
+// reservation lists the host resources committed to a pod.
+type reservation struct {
+	VCPUs     uint32 `json:"vcpus"`
+	MemoryMiB uint64 `json:"memoryMiB"`
+
+	// CPUs are the host CPUs the hypervisor is pinned to. Empty means
+	// any CPU.
+	CPUs []int `json:"cpus,omitempty"`
+}
+
+// reservationLedger is the content of the reservations file.
+type reservationLedger struct {
+	Updated time.Time              `json:"updated"`
+	Pods    map[string]reservation `json:"pods"`
+}
+
+func reservationsPath() string {
+	return filepath.Join(runtimeStateDir, reservationsFile)
+}
+
+// podReservation returns the host resources committed to a pod by its
+// hypervisor configuration.
+func podReservation(vmConfig vc.Resources, hypervisorConfig vc.HypervisorConfig) (reservation, error) {
+	r := reservation{
+		VCPUs:     uint32(vmConfig.VCPUs),
+		MemoryMiB: uint64(vmConfig.Memory),
+	}
+
+	if r.VCPUs == 0 {
+		r.VCPUs = hypervisorConfig.DefaultVCPUs
+	}
+
+	if r.MemoryMiB == 0 {
+		r.MemoryMiB = uint64(hypervisorConfig.DefaultMemSz)
+	}
+
+	hostCPUs := runtimeOptions.HostCPUSet
+
+	if value, ok := kernelParamValue(hypervisorConfig.HypervisorParams, hostCPUsParam); ok {
+		hostCPUs = value
+	}
+
+	if hostCPUs != "" {
+		cpus, err := parseCPUSet(hostCPUs)
+		if err != nil {
+			return reservation{}, err
+		}
+
+		r.CPUs = cpus
+	}
+
+	return r, nil
+}
+
+// updateReservations applies fn to the reservations file. The update is
+// serialized with the other runtime instances by a lock and atomic for
+// the readers of the file.
+func updateReservations(fn func(ledger *reservationLedger)) error {
+	path := reservationsPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), podStateDirMode); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, podStateFileMode)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	ledger, err := loadReservations()
+	if err != nil {
+		return err
+	}
+
+	fn(&ledger)
+
+	ledger.Updated = timeNow().UTC()
+
+	bytes, err := json.MarshalIndent(ledger, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, bytes, reservationsFileMode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// loadReservations reads the reservations file.
+func loadReservations() (reservationLedger, error) {
+	ledger := reservationLedger{
+		Pods: make(map[string]reservation),
+	}
+
+	bytes, err := ioutil.ReadFile(reservationsPath())
+	if os.IsNotExist(err) {
+		return ledger, nil
+	} else if err != nil {
+		return ledger, err
+	}
+
+	if err := json.Unmarshal(bytes, &ledger); err != nil {
+		return ledger, err
+	}
+
+	if ledger.Pods == nil {
+		ledger.Pods = make(map[string]reservation)
+	}
+
+	return ledger, nil
+}
+
+// reserveResources records the host resources committed to a pod.
+func reserveResources(podID string, r reservation) error {
+	return updateReservations(func(ledger *reservationLedger) {
+		ledger.Pods[podID] = r
+	})
+}
+
+// releaseResources removes the reservation of a pod, if any.
+func releaseResources(podID string) error {
+	ledger, err := loadReservations()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ledger.Pods[podID]; !ok {
+		return nil
+	}
+
+	return updateReservations(func(ledger *reservationLedger) {
+		// The builtin delete is shadowed in this package.
+		pods := make(map[string]reservation)
+		for id, r := range ledger.Pods {
+			if id != podID {
+				pods[id] = r
+			}
+		}
+
+		ledger.Pods = pods
+	})
+}
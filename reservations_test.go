@@ -0,0 +1,159 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodReservation(t *testing.T) {
+	assert := assert.New(t)
+
+	savedHostCPUSet := runtimeOptions.HostCPUSet
+	defer func() {
+		runtimeOptions.HostCPUSet = savedHostCPUSet
+	}()
+
+	runtimeOptions.HostCPUSet = ""
+
+	hypervisorConfig := vc.HypervisorConfig{
+		DefaultVCPUs: 1,
+		DefaultMemSz: 2048,
+	}
+
+	r, err := podReservation(vc.Resources{}, hypervisorConfig)
+	assert.NoError(err)
+	assert.Equal(reservation{VCPUs: 1, MemoryMiB: 2048}, r)
+
+	runtimeOptions.HostCPUSet = "2-3"
+
+	r, err = podReservation(vc.Resources{VCPUs: 4, Memory: 1025}, hypervisorConfig)
+	assert.NoError(err)
+	assert.Equal(reservation{
+		VCPUs:     4,
+		MemoryMiB: 1025,
+		CPUs:      []int{2, 3},
+	}, r)
+
+	// pod running on a partition
+	hypervisorConfig.HypervisorParams = []vc.Param{
+		{Key: hostCPUsParam, Value: "6-7"},
+	}
+
+	r, err = podReservation(vc.Resources{}, hypervisorConfig)
+	assert.NoError(err)
+	assert.Equal([]int{6, 7}, r.CPUs)
+
+	hypervisorConfig.HypervisorParams = []vc.Param{
+		{Key: hostCPUsParam, Value: "zero"},
+	}
+
+	_, err = podReservation(vc.Resources{}, hypervisorConfig)
+	assert.Error(err)
+}
+
+func TestReserveResources(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "reservations-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedTimeNow := timeNow
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		timeNow = savedTimeNow
+	}()
+
+	runtimeStateDir = dir
+
+	now := time.Unix(1000, 0)
+	timeNow = func() time.Time { return now }
+
+	ledger, err := loadReservations()
+	assert.NoError(err)
+	assert.Empty(ledger.Pods)
+
+	// nothing to release
+	assert.NoError(releaseResources("pod1"))
+	assert.False(fileExists(reservationsPath()))
+
+	r1 := reservation{VCPUs: 1, MemoryMiB: 512}
+	r2 := reservation{VCPUs: 2, MemoryMiB: 1024}
+
+	assert.NoError(reserveResources("pod1", r1))
+	assert.NoError(reserveResources("pod2", r2))
+
+	info, err := os.Stat(reservationsPath())
+	assert.NoError(err)
+	assert.Equal(reservationsFileMode, info.Mode())
+
+	// readable by other agents
+	var decoded reservationLedger
+	contents, err := getFileContents(reservationsPath())
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal([]byte(contents), &decoded))
+	assert.Equal(now.UTC(), decoded.Updated)
+	assert.Equal(map[string]reservation{"pod1": r1, "pod2": r2}, decoded.Pods)
+
+	assert.NoError(releaseResources("pod1"))
+
+	ledger, err = loadReservations()
+	assert.NoError(err)
+	assert.Equal(map[string]reservation{"pod2": r2}, ledger.Pods)
+
+	assert.NoError(ioutil.WriteFile(reservationsPath(), []byte("not JSON"), testFileMode))
+	assert.Error(reserveResources("pod1", r1))
+}
+
+func TestReserveResourcesConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "reservations-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	pods := []string{"pod1", "pod2", "pod3", "pod4", "pod5"}
+
+	var wg sync.WaitGroup
+	for _, id := range pods {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			assert.NoError(reserveResources(id, reservation{VCPUs: 1}))
+		}(id)
+	}
+	wg.Wait()
+
+	ledger, err := loadReservations()
+	assert.NoError(err)
+	assert.Len(ledger.Pods, len(pods))
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// Resource management modes.
+const (
+	// resourceManagementDynamic sizes the VM from the hypervisor
+	// settings, or from the pod resources when they are set.
+	resourceManagementDynamic = "dynamic"
+
+	// resourceManagementStatic sizes the VM exactly from the pod
+	// resources at creation. The size of the VM never changes:
+	// virtcontainers has no memory balloon and no CPU or memory
+	// hotplug, and the resources of the pod cannot be updated.
+	resourceManagementStatic = "static"
+)
+
+const defaultResourceManagement = resourceManagementDynamic
+
+func (r runtime) resourceManagement() string {
+	if r.ResourceManagement == "" {
+		return defaultResourceManagement
+	}
+
+	return r.ResourceManagement
+}
+
+func validResourceManagement(mode string) bool {
+	return mode == resourceManagementDynamic || mode == resourceManagementStatic
+}
+
+func (r runtime) staticResources() bool {
+	return r.resourceManagement() == resourceManagementStatic
+}
+
+// unsupportedUpdateError is returned when updating the resources of a
+// pod which resources cannot change.
+type unsupportedUpdateError struct {
+	podID  string
+	reason string
+}
+
+func (e unsupportedUpdateError) Error() string {
+	return fmt.Sprintf("Resources of pod %s cannot be updated: %s", e.podID, e.reason)
+}
+
+func isUnsupportedUpdate(err error) bool {
+	_, ok := err.(unsupportedUpdateError)
+	return ok
+}
+
+// podStaticResources returns the number of vCPUs and the memory in MiB
+// of the VM of a pod, derived from the resources of its spec. The pod
+// memory limit is required; without a CPU quota, the VM has the default
+// number of vCPUs.
+func podStaticResources(ociSpec oci.CompatOCISpec, defaultVCPUs uint32) (uint32, uint32, error) {
+	if ociSpec.Linux == nil || ociSpec.Linux.Resources == nil ||
+		ociSpec.Linux.Resources.Memory == nil || ociSpec.Linux.Resources.Memory.Limit == nil {
+		return 0, 0, errors.New("Static resource management requires a pod memory limit")
+	}
+
+	memBytes := *ociSpec.Linux.Resources.Memory.Limit
+	if memBytes == 0 {
+		return 0, 0, fmt.Errorf("Invalid OCI memory limit %d", memBytes)
+	}
+
+	// Round up to 1MiB, as the memory of the VM is set in MiB.
+	memMiB := uint32((memBytes + (1024*1024 - 1)) / (1024 * 1024))
+
+	cpu := ociSpec.Linux.Resources.CPU
+	if cpu == nil || cpu.Quota == nil || cpu.Period == nil {
+		return defaultVCPUs, memMiB, nil
+	}
+
+	if *cpu.Quota <= 0 {
+		return 0, 0, fmt.Errorf("Invalid OCI cpu quota %d", *cpu.Quota)
+	}
+
+	if *cpu.Period == 0 {
+		return 0, 0, fmt.Errorf("Invalid OCI cpu period %d", *cpu.Period)
+	}
+
+	// Round up to 1 vCPU.
+	vcpus := uint32((uint64(*cpu.Quota) + (*cpu.Period - 1)) / *cpu.Period)
+
+	return vcpus, memMiB, nil
+}
+
+// applyStaticResources sizes the VM of a pod from its spec, when the
+// static resource management mode is enabled.
+func applyStaticResources(ociSpec oci.CompatOCISpec, runtimeConfig *oci.RuntimeConfig) error {
+	if !runtimeOptions.staticResources() {
+		return nil
+	}
+
+	vcpus, memMiB, err := podStaticResources(ociSpec, runtimeConfig.HypervisorConfig.DefaultVCPUs)
+	if err != nil {
+		return err
+	}
+
+	runtimeConfig.HypervisorConfig.DefaultVCPUs = vcpus
+	runtimeConfig.HypervisorConfig.DefaultMemSz = memMiB
+	runtimeConfig.VMConfig.VCPUs = uint(vcpus)
+	runtimeConfig.VMConfig.Memory = uint(memMiB)
+
+	return nil
+}
+
+// setPodStaticResources records in the pod state that the resources of
+// the pod cannot change.
+func setPodStaticResources(podID string) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.StaticResources = true
+		return nil
+	})
+}
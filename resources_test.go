@@ -0,0 +1,145 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStaticResourcesSpec(memory *uint64, quota *int64, period *uint64) oci.CompatOCISpec {
+	spec := oci.CompatOCISpec{}
+	spec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{},
+	}
+
+	if memory != nil {
+		spec.Linux.Resources.Memory = &specs.LinuxMemory{Limit: memory}
+	}
+
+	if quota != nil || period != nil {
+		spec.Linux.Resources.CPU = &specs.LinuxCPU{Quota: quota, Period: period}
+	}
+
+	return spec
+}
+
+func TestResourceManagement(t *testing.T) {
+	assert := assert.New(t)
+
+	r := runtime{}
+	assert.Equal(resourceManagementDynamic, r.resourceManagement())
+	assert.False(r.staticResources())
+	assert.NoError(r.validate())
+
+	r.ResourceManagement = "static"
+	assert.True(r.staticResources())
+	assert.NoError(r.validate())
+
+	r.ResourceManagement = "elastic"
+	assert.Error(r.validate())
+}
+
+func TestPodStaticResources(t *testing.T) {
+	assert := assert.New(t)
+
+	memory := uint64(100*1024*1024 + 1)
+	quota := int64(150000)
+	period := uint64(100000)
+
+	_, _, err := podStaticResources(oci.CompatOCISpec{}, 1)
+	assert.Error(err)
+
+	vcpus, memMiB, err := podStaticResources(testStaticResourcesSpec(&memory, nil, nil), 3)
+	assert.NoError(err)
+	assert.Equal(uint32(3), vcpus)
+	assert.Equal(uint32(101), memMiB)
+
+	vcpus, _, err = podStaticResources(testStaticResourcesSpec(&memory, &quota, &period), 1)
+	assert.NoError(err)
+	assert.Equal(uint32(2), vcpus)
+
+	invalidMemory := uint64(0)
+	_, _, err = podStaticResources(testStaticResourcesSpec(&invalidMemory, nil, nil), 1)
+	assert.Error(err)
+
+	invalidQuota := int64(-1)
+	_, _, err = podStaticResources(testStaticResourcesSpec(&memory, &invalidQuota, &period), 1)
+	assert.Error(err)
+
+	invalidPeriod := uint64(0)
+	_, _, err = podStaticResources(testStaticResourcesSpec(&memory, &quota, &invalidPeriod), 1)
+	assert.Error(err)
+}
+
+func TestApplyStaticResources(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	memory := uint64(512 * 1024 * 1024)
+	quota := int64(200000)
+	period := uint64(100000)
+	spec := testStaticResourcesSpec(&memory, &quota, &period)
+
+	runtimeConfig := oci.RuntimeConfig{
+		HypervisorConfig: vc.HypervisorConfig{DefaultVCPUs: 1, DefaultMemSz: 2048},
+	}
+
+	// Nothing changes in dynamic mode.
+	runtimeOptions = runtime{}
+	assert.NoError(applyStaticResources(spec, &runtimeConfig))
+	assert.Equal(uint32(2048), runtimeConfig.HypervisorConfig.DefaultMemSz)
+	assert.Equal(vc.Resources{}, runtimeConfig.VMConfig)
+
+	runtimeOptions = runtime{ResourceManagement: resourceManagementStatic}
+	assert.Error(applyStaticResources(oci.CompatOCISpec{}, &runtimeConfig))
+
+	assert.NoError(applyStaticResources(spec, &runtimeConfig))
+	assert.Equal(uint32(2), runtimeConfig.HypervisorConfig.DefaultVCPUs)
+	assert.Equal(uint32(512), runtimeConfig.HypervisorConfig.DefaultMemSz)
+	assert.Equal(vc.Resources{VCPUs: 2, Memory: 512}, runtimeConfig.VMConfig)
+	assert.Empty(runtimeConfig.HypervisorConfig.HypervisorParams)
+}
+
+func TestSetPodStaticResources(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "resources-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	assert.NoError(setPodStaticResources(testPodID))
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.True(state.StaticResources)
+}
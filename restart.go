@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/urfave/cli"
+)
+
+var restartCLICommand = cli.Command{
+	Name:  "cc-restart",
+	Usage: "restart a container without destroying its pod",
+	ArgsUsage: `<container-id>
+
+   <container-id> is your name for the instance of the container`,
+	Description: `The cc-restart command stops and starts again the workload of a running
+   or stopped container, keeping the VM, the network and the hotplugged
+   devices of its pod. This is much quicker than deleting and recreating
+   the container, which helps containers stuck in a crash loop recover.
+
+   When "--pod" is specified, or when the container is the pod sandbox,
+   the pod is reset inside the guest instead: all its containers are
+   stopped and the guest agent restarts the whole pod, still without
+   restarting the VM.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "pod",
+			Usage: "restart all the containers of the pod",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		args := context.Args()
+		if len(args) != 1 {
+			return fmt.Errorf("Expecting only one container ID, got %d: %v", len(args), []string(args))
+		}
+
+		return restart(args.First(), context.Bool("pod"))
+	},
+}
+
+func restart(containerID string, wholePod bool) error {
+	// Checks the MUST and MUST NOT from OCI runtime specification
+	status, podID, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+
+	// The pod may have been paused because it was idle.
+	status, err = wakeContainer(status, podID)
+	if err != nil {
+		return err
+	}
+
+	ownsPod, err := ownsVM(status)
+	if err != nil {
+		return err
+	}
+
+	if wholePod || ownsPod {
+		err = restartPod(podID)
+	} else {
+		err = restartContainer(podID, status)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := recordStarted(status.ID); err != nil {
+		return err
+	}
+
+	return recordRestart(podID)
+}
+
+// restartContainer stops the workload of the specified container, if it
+// is still running, and starts it again.
+func restartContainer(podID string, status vc.ContainerStatus) error {
+	switch status.State.State {
+	case vc.StateRunning:
+		if _, err := vci.StopContainer(podID, status.ID); err != nil {
+			return err
+		}
+
+	case vc.StateStopped:
+
+	default:
+		return fmt.Errorf("Container %s is %s, only running or stopped containers can be restarted",
+			status.ID, status.State.State)
+	}
+
+	_, err := vci.StartContainer(podID, status.ID)
+	return err
+}
+
+// restartPod stops all the containers of the specified pod and the pod
+// inside the guest, and starts them again. The VM keeps running.
+func restartPod(podID string) error {
+	podStatus, err := vci.StatusPod(podID)
+	if err != nil {
+		return err
+	}
+
+	if podStatus.State.State == vc.StateRunning {
+		if _, err := vci.StopPod(podID); err != nil {
+			return err
+		}
+	}
+
+	_, err = vci.StartPod(podID)
+	return err
+}
+
+// recordRestart counts the restarts of the pod in its state.
+func recordRestart(podID string) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.Restarts++
+		state.LastRestart = timeNow()
+
+		ccLog.Infof("Restarted pod %s (%d restarts)", podID, state.Restarts)
+		return nil
+	})
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func testRestartListPod(containerType vc.ContainerType, state vc.State) func() ([]vc.PodStatus, error) {
+	return func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testContainerID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(containerType),
+						},
+						State: state,
+					},
+				},
+			},
+		}, nil
+	}
+}
+
+func TestRestartContainer(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	defer func() {
+		testingImpl.StopContainerFunc = nil
+		testingImpl.StartContainerFunc = nil
+	}()
+
+	// Mock ListPod error
+	err := restart(testContainerID, false)
+	assert.Error(err)
+	assert.True(vcMock.IsMockError(err))
+
+	testingImpl.ListPodFunc = testRestartListPod(vc.PodContainer, vc.State{State: vc.StateRunning})
+
+	// StopContainer fails
+	err = restart(testContainerID, false)
+	assert.Error(err)
+	assert.True(vcMock.IsMockError(err))
+
+	var calls []string
+
+	testingImpl.StopContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		calls = append(calls, "stop")
+		return &vcMock.Container{}, nil
+	}
+
+	testingImpl.StartContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		calls = append(calls, "start")
+		return &vcMock.Container{}, nil
+	}
+
+	err = restart(testContainerID, false)
+	assert.NoError(err)
+	assert.Equal([]string{"stop", "start"}, calls)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(uint32(1), state.Restarts)
+	assert.Equal(now, state.LastRestart)
+
+	// stopped containers are only started
+	calls = nil
+	testingImpl.ListPodFunc = testRestartListPod(vc.PodContainer, vc.State{State: vc.StateStopped})
+
+	err = restart(testContainerID, false)
+	assert.NoError(err)
+	assert.Equal([]string{"start"}, calls)
+
+	state, err = loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(uint32(2), state.Restarts)
+
+	// paused containers cannot be restarted
+	calls = nil
+	testingImpl.ListPodFunc = testRestartListPod(vc.PodContainer, vc.State{State: vc.StatePaused})
+
+	err = restart(testContainerID, false)
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+	assert.Empty(calls)
+}
+
+func TestRestartPod(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	var calls []string
+	podState := vc.StateRunning
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{ID: podID, State: vc.State{State: podState}}, nil
+	}
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		calls = append(calls, "stop")
+		return &vcMock.Pod{}, nil
+	}
+
+	testingImpl.StartPodFunc = func(podID string) (vc.VCPod, error) {
+		calls = append(calls, "start")
+		return &vcMock.Pod{}, nil
+	}
+
+	defer func() {
+		testingImpl.StatusPodFunc = nil
+		testingImpl.StopPodFunc = nil
+		testingImpl.StartPodFunc = nil
+	}()
+
+	// the pod sandbox restarts the whole pod
+	testingImpl.ListPodFunc = testRestartListPod(vc.PodSandbox, vc.State{State: vc.StateRunning})
+
+	err := restart(testContainerID, false)
+	assert.NoError(err)
+	assert.Equal([]string{"stop", "start"}, calls)
+
+	// as does --pod
+	calls = nil
+	podState = vc.StateStopped
+	testingImpl.ListPodFunc = testRestartListPod(vc.PodContainer, vc.State{State: vc.StateStopped})
+
+	err = restart(testContainerID, true)
+	assert.NoError(err)
+	assert.Equal([]string{"start"}, calls)
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(uint32(2), state.Restarts)
+
+	// StatusPod fails
+	testingImpl.StatusPodFunc = nil
+
+	err = restart(testContainerID, true)
+	assert.Error(err)
+	assert.True(vcMock.IsMockError(err))
+}
+
+func TestRestartCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	flagSet := flag.NewFlagSet("", flag.ContinueOnError)
+	flagSet.Bool("pod", false, "")
+	app := cli.NewApp()
+
+	ctx := cli.NewContext(app, flagSet, nil)
+
+	fn, ok := restartCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// no container id
+	err := fn(ctx)
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+
+	flagSet.Parse([]string{testContainerID})
+	ctx = cli.NewContext(app, flagSet, nil)
+
+	// Mock ListPod error
+	err = fn(ctx)
+	assert.Error(err)
+	assert.True(vcMock.IsMockError(err))
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// restartPolicyAnnotation is the OCI annotation selecting the restart
+// policy of a container started with "run".
+const restartPolicyAnnotation = ccAnnotationPrefix + "restart_policy"
+
+// restartCountAnnotation is added to the state of containers to report
+// how many times their pod was restarted.
+const restartCountAnnotation = ccAnnotationPrefix + "restart_count"
+
+// supported restart policies
+const (
+	restartPolicyNo        = "no"
+	restartPolicyOnFailure = "on-failure"
+	restartPolicyAlways    = "always"
+)
+
+const (
+	// minRestartBackoff is the delay before the first restart of a
+	// failing container. It doubles after each restart, up to
+	// maxRestartBackoff.
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+
+	// restartResetPeriod is how long a container must run for its
+	// restart delay to be reset.
+	restartResetPeriod = 10 * time.Second
+)
+
+// restartSleep waits before restarting a container (for testing).
+var restartSleep = time.Sleep
+
+// restartPolicy describes when the workload of a container should be
+// restarted after it exits.
+type restartPolicy struct {
+	// name is one of the restartPolicy* constants.
+	name string
+
+	// maxRetries is the maximum number of consecutive restarts of an
+	// "on-failure" container. Zero means no limit.
+	maxRetries uint32
+}
+
+// parseRestartPolicy parses a restart policy of the form "no", "always",
+// "on-failure" or "on-failure:<max-retries>". An empty string means "no".
+func parseRestartPolicy(s string) (restartPolicy, error) {
+	fields := strings.SplitN(s, ":", 2)
+
+	policy := restartPolicy{name: fields[0]}
+
+	switch policy.name {
+	case "":
+		policy.name = restartPolicyNo
+
+	case restartPolicyNo, restartPolicyAlways:
+
+	case restartPolicyOnFailure:
+		if len(fields) == 2 {
+			retries, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil || retries == 0 {
+				return restartPolicy{}, fmt.Errorf("Invalid maximum retry count in restart policy %q", s)
+			}
+
+			policy.maxRetries = uint32(retries)
+		}
+
+		return policy, nil
+
+	default:
+		return restartPolicy{}, fmt.Errorf("Invalid restart policy %q (supported: %s, %s[:<max-retries>], %s)",
+			s, restartPolicyNo, restartPolicyOnFailure, restartPolicyAlways)
+	}
+
+	if len(fields) == 2 {
+		return restartPolicy{}, fmt.Errorf("Restart policy %q does not take a retry count", policy.name)
+	}
+
+	return policy, nil
+}
+
+// getRestartPolicy returns the restart policy requested on the command
+// line or, failing that, by the restart policy annotation.
+func getRestartPolicy(flag string, ociSpec oci.CompatOCISpec) (restartPolicy, error) {
+	if flag != "" {
+		return parseRestartPolicy(flag)
+	}
+
+	policy, err := parseRestartPolicy(ociSpec.Annotations[restartPolicyAnnotation])
+	if err != nil {
+		return restartPolicy{}, fmt.Errorf("Invalid annotation %v: %v", restartPolicyAnnotation, err)
+	}
+
+	return policy, nil
+}
+
+// shouldRestart returns true if a workload which exited with the
+// specified code should be restarted, given the number of consecutive
+// restarts so far.
+func (p restartPolicy) shouldRestart(exitCode int, restarts uint32) bool {
+	switch p.name {
+	case restartPolicyAlways:
+		return true
+
+	case restartPolicyOnFailure:
+		if exitCode == 0 {
+			return false
+		}
+
+		return p.maxRetries == 0 || restarts < p.maxRetries
+	}
+
+	return false
+}
+
+// restartBackoff returns the delay before the next restart of a container
+// restarted the specified number of consecutive times.
+func restartBackoff(restarts uint32) time.Duration {
+	backoff := minRestartBackoff
+
+	for i := uint32(0); i < restarts && backoff < maxRestartBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxRestartBackoff {
+		backoff = maxRestartBackoff
+	}
+
+	return backoff
+}
+
+// waitProcess waits for the shim of a container to exit, and returns the
+// exit code of the workload.
+var waitProcess = func(pid int) (int, error) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	ps, err := p.Wait()
+	if err != nil {
+		return 0, fmt.Errorf("Process state %s: %s", ps.String(), err)
+	}
+
+	return ps.Sys().(syscall.WaitStatus).ExitStatus(), nil
+}
+
+// superviseContainer waits for the workload of the specified pod sandbox
+// container, restarting it as required by its restart policy. The shim
+// of the container is a child of the runtime, so its exit code is the one
+// of the workload. It returns the exit code of the last run.
+func superviseContainer(podID, containerID string, pid int, policy restartPolicy) (int, error) {
+	var restarts uint32
+
+	for {
+		started := timeNow()
+
+		exitCode, err := waitProcess(pid)
+		if err != nil {
+			return 0, err
+		}
+
+		// A container which ran long enough is not crash looping.
+		if timeNow().Sub(started) >= restartResetPeriod {
+			restarts = 0
+		}
+
+		if !policy.shouldRestart(exitCode, restarts) {
+			return exitCode, nil
+		}
+
+		backoff := restartBackoff(restarts)
+
+		ccLog.Infof("Container %s exited with code %d: restarting in %v (restart policy %q)",
+			containerID, exitCode, backoff, policy.name)
+
+		notifyStatus("Container %s exited with code %d: restarting in %v", containerID, exitCode, backoff)
+
+		restartSleep(backoff)
+
+		if err := restartPod(podID); err != nil {
+			return 0, err
+		}
+
+		if err := recordRestart(podID); err != nil {
+			return 0, err
+		}
+
+		restarts++
+
+		status, err := vci.StatusContainer(podID, containerID)
+		if err != nil {
+			return 0, err
+		}
+
+		pid = status.PID
+
+		notifyStatus("Container %s running (%d restarts)", containerID, restarts)
+	}
+}
+
+// getRestartCount returns the number of times the specified pod was
+// restarted.
+func getRestartCount(podID string) (uint32, error) {
+	state, err := loadPodState(podID)
+	if err != nil {
+		return 0, err
+	}
+
+	return state.Restarts, nil
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		value       string
+		expected    restartPolicy
+		expectError bool
+	}
+
+	data := []testData{
+		{"", restartPolicy{name: restartPolicyNo}, false},
+		{"no", restartPolicy{name: restartPolicyNo}, false},
+		{"always", restartPolicy{name: restartPolicyAlways}, false},
+		{"on-failure", restartPolicy{name: restartPolicyOnFailure}, false},
+		{"on-failure:5", restartPolicy{name: restartPolicyOnFailure, maxRetries: 5}, false},
+		{"on-failure:0", restartPolicy{}, true},
+		{"on-failure:-1", restartPolicy{}, true},
+		{"on-failure:foo", restartPolicy{}, true},
+		{"always:3", restartPolicy{}, true},
+		{"no:1", restartPolicy{}, true},
+		{"unless-stopped", restartPolicy{}, true},
+	}
+
+	for _, d := range data {
+		policy, err := parseRestartPolicy(d.value)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, policy, "%+v", d)
+	}
+}
+
+func TestGetRestartPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	var spec oci.CompatOCISpec
+
+	policy, err := getRestartPolicy("", spec)
+	assert.NoError(err)
+	assert.Equal(restartPolicyNo, policy.name)
+
+	spec.Annotations = map[string]string{restartPolicyAnnotation: "always"}
+
+	policy, err = getRestartPolicy("", spec)
+	assert.NoError(err)
+	assert.Equal(restartPolicyAlways, policy.name)
+
+	// the command line takes precedence
+	policy, err = getRestartPolicy("no", spec)
+	assert.NoError(err)
+	assert.Equal(restartPolicyNo, policy.name)
+
+	spec.Annotations[restartPolicyAnnotation] = "sometimes"
+	_, err = getRestartPolicy("", spec)
+	assert.Error(err)
+}
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		policy   restartPolicy
+		exitCode int
+		restarts uint32
+		expected bool
+	}
+
+	no := restartPolicy{name: restartPolicyNo}
+	always := restartPolicy{name: restartPolicyAlways}
+	onFailure := restartPolicy{name: restartPolicyOnFailure}
+	onFailure3 := restartPolicy{name: restartPolicyOnFailure, maxRetries: 3}
+
+	data := []testData{
+		{no, 0, 0, false},
+		{no, 1, 0, false},
+		{always, 0, 0, true},
+		{always, 1, 100, true},
+		{onFailure, 0, 0, false},
+		{onFailure, 1, 0, true},
+		{onFailure, -1, 1000, true},
+		{onFailure3, 0, 0, false},
+		{onFailure3, 2, 2, true},
+		{onFailure3, 2, 3, false},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, d.policy.shouldRestart(d.exitCode, d.restarts), "%+v", d)
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(minRestartBackoff, restartBackoff(0))
+	assert.Equal(2*minRestartBackoff, restartBackoff(1))
+	assert.Equal(8*minRestartBackoff, restartBackoff(3))
+	assert.Equal(maxRestartBackoff, restartBackoff(10))
+	assert.Equal(maxRestartBackoff, restartBackoff(1000))
+}
+
+func TestRunRestartPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "restart-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	configPath := filepath.Join(bundlePath, specConfig)
+
+	spec, err := readOCIConfigFile(configPath)
+	assert.NoError(err)
+
+	policy, err := runRestartPolicy(bundlePath, "on-failure:2", false)
+	assert.NoError(err)
+	assert.Equal(restartPolicy{name: restartPolicyOnFailure, maxRetries: 2}, policy)
+
+	spec.Annotations = map[string]string{restartPolicyAnnotation: "always"}
+	err = writeOCIConfigFile(spec, configPath)
+	assert.NoError(err)
+
+	policy, err = runRestartPolicy(bundlePath, "", false)
+	assert.NoError(err)
+	assert.Equal(restartPolicyAlways, policy.name)
+
+	// detached containers cannot be restarted, but the annotation
+	// is ignored
+	policy, err = runRestartPolicy(bundlePath, "", true)
+	assert.NoError(err)
+	assert.Equal(restartPolicyNo, policy.name)
+
+	_, err = runRestartPolicy(bundlePath, "always", true)
+	assert.Error(err)
+
+	_, err = runRestartPolicy(filepath.Join(tmpdir, "enoent"), "", false)
+	assert.Error(err)
+}
+
+func TestSuperviseContainer(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	defer setupIdlePauseTest(t, now)()
+
+	savedWaitProcess := waitProcess
+	savedRestartSleep := restartSleep
+	defer func() {
+		waitProcess = savedWaitProcess
+		restartSleep = savedRestartSleep
+		testingImpl.StatusPodFunc = nil
+		testingImpl.StopPodFunc = nil
+		testingImpl.StartPodFunc = nil
+		testingImpl.StatusContainerFunc = nil
+	}()
+
+	// exit codes of the workloads, indexed by the PID of their shim.
+	// Each restart creates a shim with the next PID.
+	exitCodes := []int{1, 2, 0}
+
+	var waited []int
+	waitProcess = func(pid int) (int, error) {
+		waited = append(waited, pid)
+		if pid >= len(exitCodes) {
+			return 0, errors.New("no such process")
+		}
+
+		return exitCodes[pid], nil
+	}
+
+	var delays []time.Duration
+	restartSleep = func(d time.Duration) {
+		delays = append(delays, d)
+	}
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{ID: podID, State: vc.State{State: vc.StateRunning}}, nil
+	}
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		return &vcMock.Pod{}, nil
+	}
+
+	testingImpl.StartPodFunc = func(podID string) (vc.VCPod, error) {
+		return &vcMock.Pod{}, nil
+	}
+
+	testingImpl.StatusContainerFunc = func(podID, containerID string) (vc.ContainerStatus, error) {
+		return vc.ContainerStatus{ID: containerID, PID: waited[len(waited)-1] + 1}, nil
+	}
+
+	// no restart
+	exitCode, err := superviseContainer(testPodID, testContainerID, 1, restartPolicy{name: restartPolicyNo})
+	assert.NoError(err)
+	assert.Equal(2, exitCode)
+	assert.Equal([]int{1}, waited)
+	assert.Empty(delays)
+
+	// restarted until it succeeds
+	waited = nil
+	exitCode, err = superviseContainer(testPodID, testContainerID, 0, restartPolicy{name: restartPolicyOnFailure})
+	assert.NoError(err)
+	assert.Equal(0, exitCode)
+	assert.Equal([]int{0, 1, 2}, waited)
+	assert.Equal([]time.Duration{minRestartBackoff, 2 * minRestartBackoff}, delays)
+
+	restarts, err := getRestartCount(testPodID)
+	assert.NoError(err)
+	assert.Equal(uint32(2), restarts)
+
+	// maximum number of retries reached
+	waited = nil
+	exitCode, err = superviseContainer(testPodID, testContainerID, 0,
+		restartPolicy{name: restartPolicyOnFailure, maxRetries: 1})
+	assert.NoError(err)
+	assert.Equal(2, exitCode)
+	assert.Equal([]int{0, 1}, waited)
+
+	// the new shim cannot be waited for
+	waited = nil
+	exitCode, err = superviseContainer(testPodID, testContainerID, 2, restartPolicy{name: restartPolicyAlways})
+	assert.Error(err)
+	assert.Equal([]int{2, 3}, waited)
+
+	// the restart fails
+	testingImpl.StartPodFunc = nil
+	_, err = superviseContainer(testPodID, testContainerID, 0, restartPolicy{name: restartPolicyAlways})
+	assert.Error(err)
+	assert.True(vcMock.IsMockError(err))
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// rlimitUnlimited is the value used in the configuration file to remove
+// a resource limit.
+const rlimitUnlimited = -1
+
+// launchRlimits lists the resource limits which may be set on the
+// components launched by the runtime.
+var launchRlimits = []string{"core", "memlock", "nofile"}
+
+// rlimitCommands lists the commands which may launch a hypervisor or a
+// shim, and so need the resource limits to be applied first.
+var rlimitCommands = []string{
+	"cc-batch",
+	"cc-daemon",
+	"cc-idle-pause",
+	"cc-restart",
+	"create",
+	"exec",
+	"resume",
+	"run",
+	"start",
+}
+
+// setProcessRlimit sets both the soft and the hard limit of the runtime
+// for the specified resource (for testing).
+var setProcessRlimit = setRlimit
+
+func validLaunchRlimit(name string) bool {
+	for _, r := range launchRlimits {
+		if r == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isRlimitCommand(command string) bool {
+	for _, c := range rlimitCommands {
+		if c == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validRlimits checks the resource limits of the configuration file.
+func validRlimits(rlimits map[string]int64) error {
+	for name, value := range rlimits {
+		if !validLaunchRlimit(name) {
+			return fmt.Errorf("Invalid resource limit %q (supported: %v)", name, launchRlimits)
+		}
+
+		if value < rlimitUnlimited {
+			return fmt.Errorf("Invalid %s resource limit %d", name, value)
+		}
+	}
+
+	return nil
+}
+
+func rlimitString(value int64) string {
+	if value == rlimitUnlimited {
+		return "unlimited"
+	}
+
+	return strconv.FormatInt(value, 10)
+}
+
+// applyRlimits sets the resource limits of the runtime. The hypervisor
+// and the shims inherit them when they are launched, rather than the
+// limits of whatever started the runtime. Raising a hard limit requires
+// CAP_SYS_RESOURCE.
+func applyRlimits(rlimits map[string]int64) error {
+	var names []string
+	for name := range rlimits {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := rlimits[name]
+
+		limit := ^uint64(0)
+		if value != rlimitUnlimited {
+			limit = uint64(value)
+		}
+
+		if err := setProcessRlimit(name, limit); err != nil {
+			return fmt.Errorf("Unable to set the %s resource limit to %s: %v",
+				name, rlimitString(value), err)
+		}
+
+		ccLog.Debugf("Set %s resource limit to %s", name, rlimitString(value))
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRlimits(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		rlimits     map[string]int64
+		expectError bool
+	}
+
+	data := []testData{
+		{nil, false},
+		{map[string]int64{"nofile": 1048576, "memlock": rlimitUnlimited, "core": 0}, false},
+		{map[string]int64{"nproc": 1024}, true},
+		{map[string]int64{"memlock": -2}, true},
+	}
+
+	for _, d := range data {
+		err := validRlimits(d.rlimits)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+		} else {
+			assert.NoError(err, "%+v", d)
+		}
+
+		r := runtime{Rlimits: d.rlimits}
+		assert.Equal(d.expectError, r.validate() != nil, "%+v", d)
+	}
+}
+
+func TestIsRlimitCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, command := range []string{"create", "run", "exec", "start", "cc-batch"} {
+		assert.True(isRlimitCommand(command), command)
+	}
+
+	for _, command := range []string{"", "state", "list", "cc-env", "delete"} {
+		assert.False(isRlimitCommand(command), command)
+	}
+}
+
+func TestApplyRlimits(t *testing.T) {
+	assert := assert.New(t)
+
+	savedSetProcessRlimit := setProcessRlimit
+	defer func() {
+		setProcessRlimit = savedSetProcessRlimit
+	}()
+
+	limits := map[string]uint64{}
+	var names []string
+
+	setProcessRlimit = func(name string, limit uint64) error {
+		names = append(names, name)
+		limits[name] = limit
+		return nil
+	}
+
+	err := applyRlimits(nil)
+	assert.NoError(err)
+	assert.Empty(names)
+
+	err = applyRlimits(map[string]int64{
+		"nofile":  1048576,
+		"memlock": rlimitUnlimited,
+		"core":    0,
+	})
+	assert.NoError(err)
+
+	// applied in a predictable order
+	assert.Equal([]string{"core", "memlock", "nofile"}, names)
+	assert.Equal(map[string]uint64{
+		"core":    0,
+		"memlock": ^uint64(0),
+		"nofile":  1048576,
+	}, limits)
+
+	setProcessRlimit = func(name string, limit uint64) error {
+		return errors.New("EPERM")
+	}
+
+	err = applyRlimits(map[string]int64{"memlock": rlimitUnlimited})
+	assert.Error(err)
+	assert.Contains(err.Error(), "memlock")
+	assert.Contains(err.Error(), "unlimited")
+}
@@ -18,8 +18,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"os"
-	"syscall"
 
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
@@ -35,7 +33,12 @@ var runCLICommand = cli.Command{
    on your host.`,
 	Description: `The run command creates an instance of a container for a bundle. The bundle
    is a directory with a specification file named "config.json" and a root
-   filesystem.`,
+   filesystem.
+
+   When run by a systemd service of type "notify", the runtime reports the
+   state of the container to systemd, and tells it when the container has
+   started. If the container is detached, its shim then becomes the main
+   process of the service.`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "bundle, b",
@@ -61,6 +64,19 @@ var runCLICommand = cli.Command{
 			Name:  "detach, d",
 			Usage: "detach from the container's process",
 		},
+		cli.StringFlag{
+			Name:  "restart",
+			Value: "",
+			Usage: `restart policy of the container: "no", "on-failure[:<max-retries>]" or "always" (requires an attached container)`,
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "set a label on the pod, as <key>=<value> (may be repeated)",
+		},
+		cli.StringFlag{
+			Name:  "progress",
+			Usage: `report the progress as JSON lines to "stderr" or to the unix socket at the specified path`,
+		},
 	},
 	Action: func(context *cli.Context) error {
 		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
@@ -68,57 +84,109 @@ var runCLICommand = cli.Command{
 			return errors.New("invalid runtime config")
 		}
 
-		return run(context.Args().First(),
-			context.String("bundle"),
-			context.String("console"),
-			context.String("console-socket"),
-			context.String("pid-file"),
-			context.Bool("detach"),
-			runtimeConfig)
+		containerID := context.Args().First()
+
+		return withProgress(context.String("progress"), containerID, func() error {
+			return run(containerID,
+				context.String("bundle"),
+				context.String("console"),
+				context.String("console-socket"),
+				context.String("pid-file"),
+				context.Bool("detach"),
+				context.String("restart"),
+				context.StringSlice("label"),
+				runtimeConfig)
+		})
 	},
 }
 
 func run(containerID, bundle, console, consoleSocket, pidFile string, detach bool,
-	runtimeConfig oci.RuntimeConfig) error {
+	restart string, labels []string, runtimeConfig oci.RuntimeConfig) error {
+
+	policy, err := runRestartPolicy(bundle, restart, detach)
+	if err != nil {
+		return err
+	}
 
 	consolePath, err := setupConsole(console, consoleSocket)
 	if err != nil {
 		return err
 	}
 
-	if err := create(containerID, bundle, consolePath, pidFile, detach, runtimeConfig); err != nil {
+	notifyStatus("Creating container %s", containerID)
+
+	createCtx, cancel := commandContext(runtimeOptions.Timeouts.create())
+	err = create(createCtx, containerID, bundle, consolePath, pidFile, detach, labels, runtimeConfig)
+	cancel()
+
+	if err != nil {
 		return err
 	}
 
-	pod, err := start(containerID)
+	reportProgress(progressStarting)
+	notifyStatus("Starting container %s", containerID)
+
+	startCtx, cancel := commandContext(runtimeOptions.Timeouts.start())
+	pod, err := start(startCtx, containerID)
+	cancel()
+
 	if err != nil {
 		return err
 	}
 
-	if !detach {
-		containers := pod.GetAllContainers()
-		if len(containers) == 0 {
-			return fmt.Errorf("There are no containers running in the pod: %s", pod.ID())
-		}
+	reportProgress(progressStarted)
 
-		p, err := os.FindProcess(containers[0].GetPid())
+	containers := pod.GetAllContainers()
+	if len(containers) == 0 {
+		return fmt.Errorf("There are no containers running in the pod: %s", pod.ID())
+	}
+
+	notifyReady(containerID, containers[0].GetPid(), detach)
+
+	if !detach {
+		exitCode, err := superviseContainer(pod.ID(), containers[0].ID(), containers[0].GetPid(), policy)
 		if err != nil {
 			return err
 		}
 
-		ps, err := p.Wait()
-		if err != nil {
-			return fmt.Errorf("Process state %s: %s", ps.String(), err)
-		}
+		notifySystemd("STOPPING=1", fmt.Sprintf("STATUS=Container %s exited with code %d", containerID, exitCode))
 
 		// delete container's resources
-		if err := delete(pod.ID(), true); err != nil {
+		deleteCtx, cancel := commandContext(runtimeOptions.Timeouts.delete())
+		defer cancel()
+
+		if err := delete(deleteCtx, pod.ID(), true); err != nil {
 			return err
 		}
 
 		//runtime should forward container exit code to the system
-		return cli.NewExitError("", ps.Sys().(syscall.WaitStatus).ExitStatus())
+		return cli.NewExitError("", exitCode)
 	}
 
 	return nil
 }
+
+// runRestartPolicy returns the restart policy of a container started by
+// "run". Only attached containers can be restarted, as the runtime must
+// wait for their shim.
+func runRestartPolicy(bundle, restart string, detach bool) (restartPolicy, error) {
+	if detach {
+		policy, err := parseRestartPolicy(restart)
+		if err != nil {
+			return restartPolicy{}, err
+		}
+
+		if policy.name != restartPolicyNo {
+			return restartPolicy{}, errors.New("Restart policies require an attached container")
+		}
+
+		return policy, nil
+	}
+
+	ociSpec, err := oci.ParseConfigJSON(bundle)
+	if err != nil {
+		return restartPolicy{}, err
+	}
+
+	return getRestartPolicy(restart, ociSpec)
+}
@@ -150,7 +150,7 @@ func TestRunInvalidArgs(t *testing.T) {
 	}
 
 	for i, a := range args {
-		err := run(a.containerID, a.bundle, a.console, a.consoleSocket, a.pidFile, a.detach, a.runtimeConfig)
+		err := run(a.containerID, a.bundle, a.console, a.consoleSocket, a.pidFile, a.detach, "", nil, a.runtimeConfig)
 		assert.Error(err, "test %d (%+v)", i, a)
 	}
 }
@@ -290,7 +290,7 @@ func TestRunContainerSuccessful(t *testing.T) {
 		testingImpl.DeleteContainerFunc = nil
 	}()
 
-	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, d.runtimeConfig)
+	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, "", nil, d.runtimeConfig)
 
 	// should return ExitError with the message and exit code
 	e, ok := err.(*cli.ExitError)
@@ -366,7 +366,7 @@ func TestRunContainerDetachSuccessful(t *testing.T) {
 		testingImpl.DeleteContainerFunc = nil
 	}()
 
-	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, true, d.runtimeConfig)
+	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, true, "", nil, d.runtimeConfig)
 
 	// should not return ExitError
 	assert.NoError(err)
@@ -441,7 +441,7 @@ func TestRunContainerDeleteFail(t *testing.T) {
 		testingImpl.DeleteContainerFunc = nil
 	}()
 
-	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, d.runtimeConfig)
+	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, "", nil, d.runtimeConfig)
 
 	// should not return ExitError
 	err, ok := err.(*cli.ExitError)
@@ -520,7 +520,7 @@ func TestRunContainerWaitFail(t *testing.T) {
 		testingImpl.DeleteContainerFunc = nil
 	}()
 
-	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, d.runtimeConfig)
+	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, "", nil, d.runtimeConfig)
 
 	// should not return ExitError
 	err, ok := err.(*cli.ExitError)
@@ -580,7 +580,7 @@ func TestRunContainerStartFail(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	err = run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, d.runtimeConfig)
+	err = run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, "", nil, d.runtimeConfig)
 
 	// should not return ExitError
 	err, ok := err.(*cli.ExitError)
@@ -0,0 +1,265 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// sandboxGroupAnnotation places a pod in the VM shared by all the pods
+// of the same group, when sandbox groups are enabled.
+const sandboxGroupAnnotation = ccAnnotationPrefix + "sandbox_group"
+
+// sandboxGroupLockDir is the directory below runtimeStateDir holding one
+// lock file per sandbox group, owned by the pod which VM the group
+// shares.
+const sandboxGroupLockDir = ".sandbox-groups"
+
+var sandboxGroupRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// getSandboxGroup returns the sandbox group of a pod, or an empty string
+// if the pod has its own VM.
+func getSandboxGroup(ociSpec oci.CompatOCISpec) (string, error) {
+	group := ociSpec.Annotations[sandboxGroupAnnotation]
+	if group == "" {
+		return "", nil
+	}
+
+	if !runtimeOptions.EnableSandboxGroups {
+		ccLog.Infof("Sandbox groups disabled: ignoring sandbox group %q", group)
+		return "", nil
+	}
+
+	if !sandboxGroupRegex.MatchString(group) {
+		return "", fmt.Errorf("Invalid sandbox group %q", group)
+	}
+
+	return group, nil
+}
+
+// podVMID returns the ID of the VM running a pod: the ID of the pod,
+// unless the pod joined the VM of its sandbox group.
+func podVMID(podID string) (string, error) {
+	state, err := loadPodState(podID)
+	if err != nil {
+		return "", err
+	}
+
+	if state.SandboxVM != "" {
+		return state.SandboxVM, nil
+	}
+
+	return podID, nil
+}
+
+// ownsVM returns true if starting or restarting the specified container
+// applies to the whole VM: the container is the sandbox of a pod, but
+// not of a pod which joined the VM of its sandbox group.
+func ownsVM(status vc.ContainerStatus) (bool, error) {
+	containerType, err := oci.GetContainerType(status.Annotations)
+	if err != nil || !containerType.IsPod() {
+		return false, err
+	}
+
+	vmID, err := podVMID(status.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return vmID == status.ID, nil
+}
+
+// createGroupedPod creates a pod of a sandbox group: the first pod of
+// the group creates the VM, the next ones join it. How to undo the
+// creation is recorded in undo.
+func createGroupedPod(ctx context.Context, undo *undoLog, ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig, group,
+	containerID, bundlePath, console string, disableOutput bool) (vc.Process, error) {
+	taken, vmID, err := takeLock(sandboxGroupLockDir, group, containerID)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	if !taken {
+		if _, err := vci.StatusPod(vmID); err == nil {
+			return joinSandboxGroup(ctx, undo, ociSpec, group, vmID, containerID, bundlePath, console, disableOutput)
+		}
+
+		// The VM of the group is gone: replace it.
+		ccLog.Warnf("VM %v of sandbox group %v not found, creating a new one", vmID, group)
+
+		if err := os.Remove(lockPath(sandboxGroupLockDir, group)); err != nil {
+			return vc.Process{}, err
+		}
+
+		if taken, vmID, err = takeLock(sandboxGroupLockDir, group, containerID); err != nil {
+			return vc.Process{}, err
+		} else if !taken {
+			return vc.Process{}, fmt.Errorf("Sandbox group %v was created concurrently by pod %v", group, vmID)
+		}
+	}
+
+	undo.add("sandbox group lock", func() error {
+		return releaseLocks(sandboxGroupLockDir, []string{group}, containerID)
+	})
+
+	process, err := createPod(ctx, undo, ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	if err := setPodSandboxGroup(containerID, group); err != nil {
+		return vc.Process{}, err
+	}
+
+	return process, nil
+}
+
+// joinSandboxGroup creates the sandbox of a pod as a container of the
+// VM of its sandbox group.
+func joinSandboxGroup(ctx context.Context, undo *undoLog, ociSpec oci.CompatOCISpec, group, vmID, containerID, bundlePath,
+	console string, disableOutput bool) (vc.Process, error) {
+	// The pod joins the guest of the group, created with the OOM
+	// settings of the first pod.
+	if err := checkContainerOOM(ociSpec, runtimeOptions.Strict); err != nil {
+		return vc.Process{}, err
+	}
+
+	contConfig, err := oci.ContainerConfig(ociSpec, bundlePath, containerID, console, disableOutput)
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	if err := handlePrivileged(ociSpec, &contConfig); err != nil {
+		return vc.Process{}, err
+	}
+
+	var c vc.VCContainer
+
+	err = vcCall(ctx, "create container "+containerID, func() (err error) {
+		_, c, err = vci.CreateContainer(vmID, contConfig)
+		return err
+	})
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	undo.add("container", func() error {
+		return destroyContainer(vmID, containerID)
+	})
+
+	undo.add("pod state", func() error {
+		return removePodState(containerID)
+	})
+
+	err = updatePodState(containerID, func(state *podState) error {
+		*state = podState{SandboxVM: vmID}
+		return nil
+	})
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	err = updatePodState(vmID, func(state *podState) error {
+		state.GroupPods = append(state.GroupPods, containerID)
+		return nil
+	})
+	if err != nil {
+		return vc.Process{}, err
+	}
+
+	undo.add("sandbox group membership", func() error {
+		_, err := leaveSandboxGroup(vmID, containerID)
+		return err
+	})
+
+	ccLog.Infof("Pod %v joined VM %v of sandbox group %v", containerID, vmID, group)
+
+	return c.Process(), nil
+}
+
+// setPodSandboxGroup records in the state of the pod which created the
+// VM of a sandbox group the group and its first member.
+func setPodSandboxGroup(podID, group string) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.SandboxGroup = group
+		state.GroupPods = []string{podID}
+		return nil
+	})
+}
+
+// leaveSandboxGroup removes a pod from the sandbox group of a VM and
+// returns the number of pods left in the VM. A VM which is not shared is
+// left by its only pod.
+func leaveSandboxGroup(vmID, podID string) (int, error) {
+	var group string
+	var pods []string
+
+	err := updatePodState(vmID, func(state *podState) error {
+		group = state.SandboxGroup
+
+		for _, p := range state.GroupPods {
+			if p != podID {
+				pods = append(pods, p)
+			}
+		}
+
+		state.GroupPods = pods
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if group == "" {
+		return 0, nil
+	}
+
+	if len(pods) == 0 {
+		if err := releaseLocks(sandboxGroupLockDir, []string{group}, vmID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(pods), nil
+}
+
+// deleteSandbox deletes the sandbox of a pod, and the VM running it once
+// no other pod of its sandbox group runs in the VM.
+func deleteSandbox(ctx context.Context, vmID, containerID string, forceStop bool) error {
+	remaining, err := leaveSandboxGroup(vmID, containerID)
+	if err != nil {
+		return err
+	}
+
+	if remaining > 0 {
+		if err := deleteContainer(ctx, vmID, containerID, forceStop); err != nil {
+			return err
+		}
+	} else if err := deletePod(ctx, vmID); err != nil {
+		return err
+	}
+
+	if containerID != vmID {
+		return removePodState(containerID)
+	}
+
+	return nil
+}
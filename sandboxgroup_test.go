@@ -0,0 +1,240 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupSandboxGroupTest creates a private state directory and enables
+// sandbox groups, returning a function to undo the changes.
+func setupSandboxGroupTest(t *testing.T) func() {
+	dir, err := ioutil.TempDir(testDir, "sandboxgroup-")
+	assert.NoError(t, err)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedRuntimeOptions := runtimeOptions
+
+	runtimeStateDir = dir
+	runtimeOptions.EnableSandboxGroups = true
+
+	return func() {
+		runtimeStateDir = savedRuntimeStateDir
+		runtimeOptions = savedRuntimeOptions
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetSandboxGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupSandboxGroupTest(t)()
+
+	spec := oci.CompatOCISpec{}
+
+	group, err := getSandboxGroup(spec)
+	assert.NoError(err)
+	assert.Empty(group)
+
+	spec.Annotations = map[string]string{sandboxGroupAnnotation: "web.frontend-1"}
+
+	group, err = getSandboxGroup(spec)
+	assert.NoError(err)
+	assert.Equal("web.frontend-1", group)
+
+	for _, invalid := range []string{"-web", "web/frontend", "../web"} {
+		spec.Annotations[sandboxGroupAnnotation] = invalid
+		_, err = getSandboxGroup(spec)
+		assert.Error(err, invalid)
+	}
+
+	// the annotation is ignored unless sandbox groups are enabled
+	runtimeOptions.EnableSandboxGroups = false
+
+	group, err = getSandboxGroup(spec)
+	assert.NoError(err)
+	assert.Empty(group)
+}
+
+func TestPodVMID(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupSandboxGroupTest(t)()
+
+	vmID, err := podVMID("pod1")
+	assert.NoError(err)
+	assert.Equal("pod1", vmID)
+
+	assert.NoError(savePodState("pod2", podState{SandboxVM: "pod1"}))
+
+	vmID, err = podVMID("pod2")
+	assert.NoError(err)
+	assert.Equal("pod1", vmID)
+
+	sandbox := vc.ContainerStatus{
+		ID:          "pod1",
+		Annotations: map[string]string{oci.ContainerTypeKey: string(vc.PodSandbox)},
+	}
+
+	owns, err := ownsVM(sandbox)
+	assert.NoError(err)
+	assert.True(owns)
+
+	// the sandbox of a pod which joined the VM of pod1
+	sandbox.ID = "pod2"
+	owns, err = ownsVM(sandbox)
+	assert.NoError(err)
+	assert.False(owns)
+
+	container := vc.ContainerStatus{
+		ID:          "container",
+		Annotations: map[string]string{oci.ContainerTypeKey: string(vc.PodContainer)},
+	}
+
+	owns, err = ownsVM(container)
+	assert.NoError(err)
+	assert.False(owns)
+
+	_, err = ownsVM(vc.ContainerStatus{})
+	assert.Error(err)
+}
+
+func TestCreateGroupedPodJoin(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupSandboxGroupTest(t)()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+	assert.NoError(makeOCIBundle(bundlePath))
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	var createdIn string
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{ID: podID}, nil
+	}
+	testingImpl.CreateContainerFunc = func(podID string, containerConfig vc.ContainerConfig) (vc.VCPod, vc.VCContainer, error) {
+		createdIn = podID
+		return &vcMock.Pod{}, &vcMock.Container{}, nil
+	}
+	defer func() {
+		testingImpl.StatusPodFunc = nil
+		testingImpl.CreateContainerFunc = nil
+	}()
+
+	// pod1 created the VM of the group
+	taken, _, err := takeLock(sandboxGroupLockDir, "web", "pod1")
+	assert.NoError(err)
+	assert.True(taken)
+	assert.NoError(setPodSandboxGroup("pod1", "web"))
+
+	_, err = createGroupedPod(context.Background(), &undoLog{}, spec, oci.RuntimeConfig{}, "web", "pod2", bundlePath, testConsole, true)
+	assert.NoError(err)
+	assert.Equal("pod1", createdIn)
+
+	state, err := loadPodState("pod1")
+	assert.NoError(err)
+	assert.Equal([]string{"pod1", "pod2"}, state.GroupPods)
+
+	vmID, err := podVMID("pod2")
+	assert.NoError(err)
+	assert.Equal("pod1", vmID)
+
+	// the VM of the group is gone and creating a new one fails
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{}, errors.New("no such pod")
+	}
+
+	var undo undoLog
+
+	_, err = createGroupedPod(context.Background(), &undo, spec, oci.RuntimeConfig{}, "web", "pod3", bundlePath, testConsole, true)
+	assert.Error(err)
+
+	// the lock taken to create the VM is released by the rollback
+	undo.rollback()
+
+	owner, err := lockOwner(sandboxGroupLockDir, "web")
+	assert.NoError(err)
+	assert.Empty(owner)
+}
+
+func TestDeleteSandbox(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupSandboxGroupTest(t)()
+
+	var calls []string
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		calls = append(calls, "stop-pod "+podID)
+		return &vcMock.Pod{}, nil
+	}
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		calls = append(calls, "delete-pod "+podID)
+		return &vcMock.Pod{}, nil
+	}
+	testingImpl.DeleteContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		calls = append(calls, "delete-container "+containerID)
+		return &vcMock.Container{}, nil
+	}
+	defer func() {
+		testingImpl.StopPodFunc = nil
+		testingImpl.DeletePodFunc = nil
+		testingImpl.DeleteContainerFunc = nil
+	}()
+
+	taken, _, err := takeLock(sandboxGroupLockDir, "web", "pod1")
+	assert.NoError(err)
+	assert.True(taken)
+	assert.NoError(savePodState("pod1", podState{SandboxGroup: "web", GroupPods: []string{"pod1", "pod2"}}))
+	assert.NoError(savePodState("pod2", podState{SandboxVM: "pod1"}))
+
+	// the pod which created the VM leaves first
+	assert.NoError(deleteSandbox(context.Background(), "pod1", "pod1", false))
+	assert.Equal([]string{"delete-container pod1"}, calls)
+
+	// the VM goes with the last pod of the group
+	calls = nil
+	assert.NoError(deleteSandbox(context.Background(), "pod1", "pod2", false))
+	assert.Equal([]string{"stop-pod pod1", "delete-pod pod1"}, calls)
+
+	assert.False(fileExists(podStateDir("pod1")))
+	assert.False(fileExists(podStateDir("pod2")))
+
+	owner, err := lockOwner(sandboxGroupLockDir, "web")
+	assert.NoError(err)
+	assert.Empty(owner)
+
+	// a VM which is not shared
+	calls = nil
+	assert.NoError(deleteSandbox(context.Background(), "pod3", "pod3", false))
+	assert.Equal([]string{"stop-pod pod3", "delete-pod pod3"}, calls)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// notifySocketEnv is the environment variable systemd sets to the
+// socket a service of type "notify" reports its state to.
+const notifySocketEnv = "NOTIFY_SOCKET"
+
+// sdNotify sends the specified "KEY=value" assignments to systemd, as
+// sd_notify(3) does. Nothing is sent if the runtime is not run by
+// systemd.
+func sdNotify(assignments ...string) error {
+	path := os.Getenv(notifySocketEnv)
+	if path == "" {
+		return nil
+	}
+
+	// abstract socket
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(assignments, "\n")))
+	return err
+}
+
+// notifySystemd reports the state of the runtime to systemd. This is
+// best effort: the container keeps running if systemd cannot be told.
+func notifySystemd(assignments ...string) {
+	if err := sdNotify(assignments...); err != nil {
+		ccLog.Warnf("Unable to notify systemd: %v", err)
+	}
+}
+
+// notifyStatus reports a human readable status to systemd.
+func notifyStatus(format string, args ...interface{}) {
+	notifySystemd("STATUS=" + fmt.Sprintf(format, args...))
+}
+
+// notifyReady tells systemd the container has started. When the
+// container is detached, the runtime exits and its shim becomes the
+// main process of the service.
+func notifyReady(containerID string, shimPid int, detach bool) {
+	assignments := []string{
+		"READY=1",
+		fmt.Sprintf("STATUS=Container %s running", containerID),
+	}
+
+	if detach {
+		assignments = append(assignments, fmt.Sprintf("MAINPID=%d", shimPid))
+	}
+
+	notifySystemd(assignments...)
+}
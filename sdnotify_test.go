@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listenNotifySocket creates a socket like the one systemd passes in
+// NOTIFY_SOCKET, returning a function to read the next message.
+func listenNotifySocket(assert *assert.Assertions, path string) (*net.UnixConn, func() string) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	assert.NoError(err)
+
+	return conn, func() string {
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		assert.NoError(err)
+		return string(buf[:n])
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "sdnotify-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedNotifySocket, wasSet := os.LookupEnv(notifySocketEnv)
+	defer func() {
+		if wasSet {
+			os.Setenv(notifySocketEnv, savedNotifySocket)
+		} else {
+			os.Unsetenv(notifySocketEnv)
+		}
+	}()
+
+	// not run by systemd
+	os.Unsetenv(notifySocketEnv)
+	assert.NoError(sdNotify("READY=1"))
+
+	path := filepath.Join(dir, "notify")
+	os.Setenv(notifySocketEnv, path)
+
+	// nobody listening
+	assert.Error(sdNotify("READY=1"))
+
+	conn, read := listenNotifySocket(assert, path)
+	defer conn.Close()
+
+	assert.NoError(sdNotify("READY=1", "STATUS=ready"))
+	assert.Equal("READY=1\nSTATUS=ready", read())
+
+	notifyStatus("Container %s running", testContainerID)
+	assert.Equal("STATUS=Container "+testContainerID+" running", read())
+
+	notifyReady(testContainerID, 1234, false)
+	assert.Equal(fmt.Sprintf("READY=1\nSTATUS=Container %s running", testContainerID), read())
+
+	notifyReady(testContainerID, 1234, true)
+	assert.Equal(fmt.Sprintf("READY=1\nSTATUS=Container %s running\nMAINPID=1234", testContainerID), read())
+
+	// abstract socket
+	name := fmt.Sprintf("cc-runtime-test-%d", os.Getpid())
+
+	abstract, readAbstract := listenNotifySocket(assert, "\x00"+name)
+	defer abstract.Close()
+
+	os.Setenv(notifySocketEnv, "@"+name)
+	assert.NoError(sdNotify("STOPPING=1"))
+	assert.Equal("STOPPING=1", readAbstract())
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// supported handling of the Kubernetes secret volumes
+const (
+	// secretVolumesShared shares secret volumes with the guest like
+	// any other volume.
+	secretVolumesShared = "shared"
+
+	// secretVolumesTmpfs only shares secret volumes held in memory on
+	// the host, and never copies them to host storage.
+	secretVolumesTmpfs = "tmpfs"
+)
+
+const defaultSecretVolumes = secretVolumesShared
+
+// secretVolumeDirs are the kubelet directories of the volumes holding
+// secrets: secret volumes and projected volumes, which hold the service
+// account tokens.
+var secretVolumeDirs = []string{
+	"/volumes/kubernetes.io~secret/",
+	"/volumes/kubernetes.io~projected/",
+}
+
+// memoryFSTypes are the types of the filesystems held in memory.
+var memoryFSTypes = map[string]bool{
+	"tmpfs": true,
+	"ramfs": true,
+}
+
+func (r runtime) secretVolumes() string {
+	if r.SecretVolumes == "" {
+		return defaultSecretVolumes
+	}
+
+	return r.SecretVolumes
+}
+
+func validSecretVolumes(mode string) bool {
+	return mode == secretVolumesShared || mode == secretVolumesTmpfs
+}
+
+// isSecretVolume returns true if the host path is in a Kubernetes
+// secret volume.
+func isSecretVolume(p string) bool {
+	for _, dir := range secretVolumeDirs {
+		if strings.Contains(p, dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkSecretVolumes returns an error if the container mounts a secret
+// volume which is not held in memory on the host, when the secret
+// volumes must be.
+func checkSecretVolumes(ociSpec oci.CompatOCISpec, mode string) error {
+	if mode != secretVolumesTmpfs {
+		return nil
+	}
+
+	var mounts []mountEntry
+
+	for _, m := range ociSpec.Mounts {
+		if !isBindMount(m) || !isSecretVolume(m.Source) {
+			continue
+		}
+
+		if mounts == nil {
+			var err error
+			if mounts, err = getMounts(); err != nil {
+				return err
+			}
+		}
+
+		source, err := filepath.EvalSymlinks(m.Source)
+		if err != nil {
+			return err
+		}
+
+		entry, err := findMount(mounts, source)
+		if err != nil {
+			return err
+		}
+
+		if !memoryFSTypes[entry.fsType] {
+			return fmt.Errorf("Secret volume %v is on a %s filesystem: secret_volumes %q requires secrets held in memory (tmpfs)",
+				m.Source, entry.fsType, secretVolumesTmpfs)
+		}
+	}
+
+	return nil
+}
+
+// checkSecretCopy returns an error if a file copied between the host
+// and a container is in a secret volume, when the secret volumes may
+// not be copied to host storage.
+func checkSecretCopy(hostPath, mode string) error {
+	if mode == secretVolumesTmpfs && isSecretVolume(hostPath) {
+		return fmt.Errorf("Copying secret volume files is not permitted with secret_volumes %q", secretVolumesTmpfs)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidSecretVolumes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(secretVolumesShared, runtime{}.secretVolumes())
+	assert.Equal(secretVolumesTmpfs, runtime{SecretVolumes: secretVolumesTmpfs}.secretVolumes())
+
+	assert.True(validSecretVolumes(secretVolumesShared))
+	assert.True(validSecretVolumes(secretVolumesTmpfs))
+	assert.False(validSecretVolumes("guest"))
+}
+
+func TestIsSecretVolume(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isSecretVolume("/var/lib/kubelet/pods/1234/volumes/kubernetes.io~secret/creds"))
+	assert.True(isSecretVolume("/var/lib/kubelet/pods/1234/volumes/kubernetes.io~projected/token/token"))
+	assert.False(isSecretVolume("/var/lib/kubelet/pods/1234/volumes/kubernetes.io~empty-dir/cache"))
+	assert.False(isSecretVolume("/srv/secret"))
+}
+
+func TestCheckSecretVolumes(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "secrets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	dir, err = filepath.EvalSymlinks(dir)
+	assert.NoError(err)
+
+	savedProcMounts := procMounts
+	procMounts = filepath.Join(dir, "mounts")
+	defer func() {
+		procMounts = savedProcMounts
+	}()
+
+	volumes := filepath.Join(dir, "pods", "1234", "volumes")
+	secret := filepath.Join(volumes, "kubernetes.io~secret", "creds")
+	emptyDir := filepath.Join(volumes, "kubernetes.io~empty-dir", "cache")
+
+	for _, p := range []string{secret, emptyDir} {
+		assert.NoError(os.MkdirAll(p, testDirMode))
+	}
+
+	assert.NoError(createFile(procMounts, fmt.Sprintf("/dev/sda1 / ext4 rw 0 0\ntmpfs %s tmpfs rw 0 0\n", secret)))
+
+	spec := oci.CompatOCISpec{}
+	spec.Mounts = []specs.Mount{
+		{Source: secret, Destination: "/etc/creds", Type: "bind"},
+		{Source: emptyDir, Destination: "/cache", Type: "bind"},
+	}
+
+	assert.NoError(checkSecretVolumes(spec, secretVolumesShared))
+	assert.NoError(checkSecretVolumes(spec, secretVolumesTmpfs))
+
+	// secret written to the disk of the host
+	assert.NoError(createFile(procMounts, "/dev/sda1 / ext4 rw 0 0\n"))
+
+	assert.NoError(checkSecretVolumes(spec, secretVolumesShared))
+	assert.Error(checkSecretVolumes(spec, secretVolumesTmpfs))
+
+	spec.Mounts[0].Source = filepath.Join(volumes, "kubernetes.io~secret", "missing")
+	assert.Error(checkSecretVolumes(spec, secretVolumesTmpfs))
+}
+
+func TestCheckSecretCopy(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := "/var/lib/kubelet/pods/1234/volumes/kubernetes.io~secret/creds/password"
+
+	assert.NoError(checkSecretCopy(secret, secretVolumesShared))
+	assert.Error(checkSecretCopy(secret, secretVolumesTmpfs))
+	assert.NoError(checkSecretCopy("/run/rootfs/etc/hosts", secretVolumesTmpfs))
+}
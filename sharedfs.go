@@ -0,0 +1,185 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// supported guest cache modes for the filesystems shared with the host
+const (
+	sharedFSCacheNone    = "none"
+	sharedFSCacheLoose   = "loose"
+	sharedFSCacheFSCache = "fscache"
+	sharedFSCacheMmap    = "mmap"
+)
+
+const (
+	// Kernel parameters for a guest image mounting the filesystems
+	// shared with the host. hyperstart does not read them.
+	sharedFSCacheParam     = "agent.9p_cache"
+	sharedFSCacheSizeParam = "agent.fscache_size"
+
+	// sharedFSCacheSizeAnnotation is the OCI annotation used to
+	// override the shared filesystem cache size (in MiB) of a pod.
+	sharedFSCacheSizeAnnotation = ccAnnotationPrefix + "shared_fs.cache_size"
+)
+
+func validSharedFSCache(mode string) bool {
+	switch mode {
+	case sharedFSCacheNone, sharedFSCacheLoose, sharedFSCacheFSCache, sharedFSCacheMmap:
+		return true
+	}
+
+	return false
+}
+
+// sharedFSKernelParams returns the kernel parameters selecting how the
+// guest caches the contents of the filesystems shared with the host.
+// Caching avoids reading the same image layers from the host
+// repeatedly. The cache size (in MiB) is only meaningful with
+// "fscache", where it caps the guest cache; zero means no cap.
+func sharedFSKernelParams(mode string, sizeMiB uint32) ([]vc.Param, error) {
+	if mode == "" {
+		if sizeMiB != 0 {
+			return nil, fmt.Errorf("Shared filesystem cache size requires cache mode %q", sharedFSCacheFSCache)
+		}
+
+		return nil, nil
+	}
+
+	if !validSharedFSCache(mode) {
+		return nil, fmt.Errorf("Invalid shared filesystem cache mode %q", mode)
+	}
+
+	params := []vc.Param{{Key: sharedFSCacheParam, Value: mode}}
+
+	if sizeMiB != 0 {
+		if mode != sharedFSCacheFSCache {
+			return nil, fmt.Errorf("Shared filesystem cache size requires cache mode %q", sharedFSCacheFSCache)
+		}
+
+		params = append(params, vc.Param{Key: sharedFSCacheSizeParam, Value: strconv.FormatUint(uint64(sizeMiB), 10)})
+	}
+
+	return params, nil
+}
+
+// kernelParamValue returns the value of the specified kernel parameter.
+func kernelParamValue(params []vc.Param, key string) (string, bool) {
+	for _, p := range params {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// setKernelParam returns a copy of params where the specified parameter
+// replaces any existing parameter of the same name.
+func setKernelParam(params []vc.Param, param vc.Param) []vc.Param {
+	var result []vc.Param
+
+	for _, p := range params {
+		if p.Key != param.Key {
+			result = append(result, p)
+		}
+	}
+
+	return append(result, param)
+}
+
+// removeParam returns a copy of params without the specified parameter.
+func removeParam(params []vc.Param, key string) []vc.Param {
+	var result []vc.Param
+
+	for _, p := range params {
+		if p.Key != key {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+// getSharedFSCacheSize returns the shared filesystem cache size of the
+// pod in MiB, overriding the configured size with the one from the OCI
+// annotation if specified.
+func getSharedFSCacheSize(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig) (uint64, error) {
+	value, ok := ociSpec.Annotations[sharedFSCacheSizeAnnotation]
+	if !ok {
+		value, ok = kernelParamValue(runtimeConfig.HypervisorConfig.KernelParams, sharedFSCacheSizeParam)
+		if !ok {
+			return 0, nil
+		}
+	}
+
+	size, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid shared filesystem cache size %q: %v", value, err)
+	}
+
+	if mode, _ := kernelParamValue(runtimeConfig.HypervisorConfig.KernelParams, sharedFSCacheParam); size != 0 && mode != sharedFSCacheFSCache {
+		return 0, fmt.Errorf("Shared filesystem cache size requires cache mode %q", sharedFSCacheFSCache)
+	}
+
+	return size, nil
+}
+
+// setPodSharedFSCacheSize records the shared filesystem cache size of
+// the pod for reporting.
+func setPodSharedFSCacheSize(podID string, sizeMiB uint64) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.SharedFSCacheSize = sizeMiB
+		return nil
+	})
+}
+
+// getSharedFSMetrics returns the shared filesystem cache size cap of
+// each pod.
+func getSharedFSMetrics() ([]metric, error) {
+	podStatusList, err := vci.ListPod()
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []metric
+
+	for _, podStatus := range podStatusList {
+		state, err := loadPodState(podStatus.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if state.SharedFSCacheSize == 0 {
+			continue
+		}
+
+		metrics = append(metrics, metric{
+			name:   "shared_fs_cache_limit_bytes",
+			help:   "Maximum size of the guest cache of the filesystems shared with the host",
+			kind:   "gauge",
+			labels: podMetricLabels(podStatus.ID, state.Labels),
+			value:  state.SharedFSCacheSize * 1024 * 1024,
+		})
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedFSKernelParams(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		mode        string
+		size        uint32
+		expected    []vc.Param
+		expectError bool
+	}
+
+	data := []testData{
+		{"", 0, nil, false},
+		{"", 100, nil, true},
+		{"floppy", 0, nil, true},
+		{sharedFSCacheLoose, 100, nil, true},
+		{sharedFSCacheNone, 0, []vc.Param{{Key: sharedFSCacheParam, Value: "none"}}, false},
+		{sharedFSCacheLoose, 0, []vc.Param{{Key: sharedFSCacheParam, Value: "loose"}}, false},
+		{sharedFSCacheFSCache, 512, []vc.Param{
+			{Key: sharedFSCacheParam, Value: "fscache"},
+			{Key: sharedFSCacheSizeParam, Value: "512"},
+		}, false},
+	}
+
+	for _, d := range data {
+		params, err := sharedFSKernelParams(d.mode, d.size)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, params, "%+v", d)
+	}
+}
+
+func TestRemoveParam(t *testing.T) {
+	assert := assert.New(t)
+
+	params := []vc.Param{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}
+
+	assert.Equal([]vc.Param{{Key: "b", Value: "2"}}, removeParam(params, "a"))
+	assert.Equal(params, removeParam(params, "c"))
+}
+
+func TestSetKernelParam(t *testing.T) {
+	assert := assert.New(t)
+
+	params := []vc.Param{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}
+
+	result := setKernelParam(params, vc.Param{Key: "a", Value: "3"})
+	assert.Equal([]vc.Param{{Key: "b", Value: "2"}, {Key: "a", Value: "3"}}, result)
+
+	// original unchanged
+	assert.Equal([]vc.Param{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}, params)
+
+	value, ok := kernelParamValue(result, "a")
+	assert.True(ok)
+	assert.Equal("3", value)
+
+	_, ok = kernelParamValue(result, "c")
+	assert.False(ok)
+}
+
+func TestGetSharedFSCacheSize(t *testing.T) {
+	assert := assert.New(t)
+
+	var spec oci.CompatOCISpec
+	var runtimeConfig oci.RuntimeConfig
+
+	size, err := getSharedFSCacheSize(spec, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal(uint64(0), size)
+
+	runtimeConfig.HypervisorConfig.KernelParams = []vc.Param{
+		{Key: sharedFSCacheParam, Value: sharedFSCacheFSCache},
+		{Key: sharedFSCacheSizeParam, Value: "256"},
+	}
+
+	size, err = getSharedFSCacheSize(spec, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal(uint64(256), size)
+
+	spec.Annotations = map[string]string{
+		sharedFSCacheSizeAnnotation: "1024",
+	}
+
+	size, err = getSharedFSCacheSize(spec, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal(uint64(1024), size)
+
+	spec.Annotations[sharedFSCacheSizeAnnotation] = "foo"
+	_, err = getSharedFSCacheSize(spec, runtimeConfig)
+	assert.Error(err)
+
+	// cache size requires fscache
+	spec.Annotations[sharedFSCacheSizeAnnotation] = "1024"
+	runtimeConfig.HypervisorConfig.KernelParams = []vc.Param{
+		{Key: sharedFSCacheParam, Value: sharedFSCacheLoose},
+	}
+
+	_, err = getSharedFSCacheSize(spec, runtimeConfig)
+	assert.Error(err)
+}
+
+func TestGetSharedFSMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "sharedfs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		testingImpl.ListPodFunc = nil
+	}()
+
+	runtimeStateDir = dir
+
+	// ListPod fails
+	_, err = getSharedFSMetrics()
+	assert.Error(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: "pod1"}, {ID: "pod2"}}, nil
+	}
+
+	err = setPodSharedFSCacheSize("pod1", 2)
+	assert.NoError(err)
+
+	metrics, err := getSharedFSMetrics()
+	assert.NoError(err)
+	assert.Equal([]metric{{
+		name:   "shared_fs_cache_limit_bytes",
+		help:   "Maximum size of the guest cache of the filesystems shared with the host",
+		kind:   "gauge",
+		labels: map[string]string{"pod": "pod1"},
+		value:  2 * 1024 * 1024,
+	}}, metrics)
+}
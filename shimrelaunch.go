@@ -0,0 +1,314 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// shimsDir is the directory below runtimeStateDir holding the shim of
+// each container. The leading dot avoids clashes with pod IDs.
+const shimsDir = ".shims"
+
+// healthEventShimRelaunched is the type of the health event emitted when
+// the shim of a running container died and was relaunched.
+const healthEventShimRelaunched = "shim-relaunched"
+
+// containerShim records the shim of the workload of a container, so that
+// it can be relaunched if it dies while the container is running.
+type containerShim struct {
+	// PID is the PID of the shim.
+	PID int `json:"pid"`
+
+	// ShimStart is the start time of the shim, in clock ticks after
+	// boot, which tells a shim from a process reusing its PID.
+	ShimStart uint64 `json:"shimStart"`
+
+	// Token identifies the IO session of the workload on the proxy at
+	// URL. The proxy keeps the session of a shim which disconnected
+	// without closing it for a new shim to claim.
+	Token string `json:"token"`
+	URL   string `json:"url"`
+
+	// Console is the terminal of the workload, if any.
+	Console string `json:"console,omitempty"`
+
+	// Stdio are the paths of the standard input, output and error of
+	// the shim, empty for those which cannot be reopened, such as
+	// pipes.
+	Stdio []string `json:"stdio,omitempty"`
+
+	// Relaunches is the number of times the shim was relaunched.
+	Relaunches uint32 `json:"relaunches,omitempty"`
+}
+
+func containerShimPath(containerID string) string {
+	return filepath.Join(runtimeStateDir, shimsDir, containerID+".json")
+}
+
+// loadContainerShim returns the shim of the specified container, and
+// false if none was recorded.
+func loadContainerShim(containerID string) (containerShim, bool, error) {
+	var s containerShim
+
+	bytes, err := ioutil.ReadFile(containerShimPath(containerID))
+	if os.IsNotExist(err) {
+		return s, false, nil
+	} else if err != nil {
+		return s, false, err
+	}
+
+	if err := json.Unmarshal(bytes, &s); err != nil {
+		return s, false, fmt.Errorf("Invalid shim of container %v: %v", containerID, err)
+	}
+
+	return s, true, nil
+}
+
+// saveContainerShim atomically replaces the shim of the specified
+// container.
+func saveContainerShim(containerID string, s containerShim) error {
+	bytes, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	path := containerShimPath(containerID)
+
+	if err := os.MkdirAll(filepath.Dir(path), podStateDirMode); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, bytes, podStateFileMode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// removeContainerShim removes the shim of a deleted container.
+func removeContainerShim(containerID string) error {
+	if err := os.Remove(containerShimPath(containerID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// shimStdio returns the paths of the standard input, output and error
+// of a shim which can be reopened. It is a variable rather than a
+// function to allow tests to modify it.
+var shimStdio = func(pid int) []string {
+	stdio := make([]string, 3)
+
+	for fd := range stdio {
+		// Pipes and sockets are not paths, such as "pipe:[1234]".
+		path, err := processFDPath(pid, fd)
+		if err == nil && filepath.IsAbs(path) {
+			stdio[fd] = path
+		}
+	}
+
+	return stdio
+}
+
+// recordShim records the shim of the workload of a container just
+// created. Shims which cannot be relaunched, without a proxy session or
+// already gone, are not recorded.
+func recordShim(containerID string, process vc.Process, console string, runtimeConfig oci.RuntimeConfig) error {
+	proxyConfig, ok := runtimeConfig.ProxyConfig.(vc.CCProxyConfig)
+	if !ok || process.Token == "" {
+		return nil
+	}
+
+	start, err := procStartTime(process.Pid)
+	if err != nil {
+		ccLog.Warnf("Unable to record shim %d of container %v: %v", process.Pid, containerID, err)
+		return nil
+	}
+
+	return saveContainerShim(containerID, containerShim{
+		PID:       process.Pid,
+		ShimStart: start,
+		Token:     process.Token,
+		URL:       proxyConfig.URL,
+		Console:   console,
+		Stdio:     shimStdio(process.Pid),
+	})
+}
+
+// running returns true if the shim is still running.
+func (s containerShim) running() bool {
+	start, err := procStartTime(s.PID)
+	return err == nil && start == s.ShimStart
+}
+
+// openShimStdio opens the standard input, output and error of a
+// relaunched shim. FIFOs are opened for reading and writing, so as not
+// to block until their other end is opened.
+func openShimStdio(s containerShim) ([]*os.File, error) {
+	files := make([]*os.File, 3)
+
+	for fd, path := range s.Stdio {
+		if path == "" || fd >= len(files) {
+			continue
+		}
+
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+		if err != nil {
+			for _, f := range files {
+				if f != nil {
+					f.Close()
+				}
+			}
+
+			return nil, err
+		}
+
+		files[fd] = f
+	}
+
+	return files, nil
+}
+
+// launchShim starts a shim claiming the proxy session of a dead one, in
+// a session of its own, and returns its PID. It is a variable rather
+// than a function to allow tests to modify it.
+var launchShim = func(shimPath string, s containerShim) (int, error) {
+	cmd := exec.Command(shimPath, "-t", s.Token, "-u", s.URL)
+	cmd.Env = os.Environ()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	var files []*os.File
+
+	if s.Console != "" {
+		f, err := os.OpenFile(s.Console, os.O_RDWR, 0)
+		if err != nil {
+			return -1, err
+		}
+
+		files = []*os.File{f, f, f}
+
+		cmd.SysProcAttr.Setctty = true
+		cmd.SysProcAttr.Ctty = int(f.Fd())
+	} else {
+		var err error
+
+		if files, err = openShimStdio(s); err != nil {
+			return -1, err
+		}
+	}
+
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+
+	// A nil file is /dev/null.
+	if files[0] != nil {
+		cmd.Stdin = files[0]
+	}
+	if files[1] != nil {
+		cmd.Stdout = files[1]
+	}
+	if files[2] != nil {
+		cmd.Stderr = files[2]
+	}
+
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+
+	pid := cmd.Process.Pid
+
+	return pid, cmd.Process.Release()
+}
+
+// relaunchShim relaunches the shim of a running container of the
+// specified pod if it died, and returns the new shim, or nil if the shim
+// is running or was not recorded. The exit of the new shim is recorded
+// in the state of the pod by r, if not nil.
+func relaunchShim(podID, containerID, shimPath string, r *reaper) (*containerShim, error) {
+	s, ok, err := loadContainerShim(containerID)
+	if err != nil || !ok || s.running() {
+		return nil, err
+	}
+
+	if shimPath == "" {
+		return nil, fmt.Errorf("Unable to relaunch the shim of container %v: no shim configured", containerID)
+	}
+
+	launch := func() (int, error) {
+		return launchShim(shimPath, s)
+	}
+
+	var pid int
+
+	if r != nil {
+		pid, err = r.startTracked(podID, "shim", launch)
+	} else {
+		pid, err = launch()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to relaunch the shim of container %v: %v", containerID, err)
+	}
+
+	start, err := procStartTime(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	ccLog.Warnf("Relaunched shim of container %v: process %d replaces process %d", containerID, pid, s.PID)
+
+	s.PID = pid
+	s.ShimStart = start
+	s.Relaunches++
+
+	if err := saveContainerShim(containerID, s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// getShimPID returns the PID of the shim of a container: the PID known
+// by virtcontainers, unless the shim was relaunched.
+func getShimPID(containerID string, pid int) (int, error) {
+	s, ok, err := loadContainerShim(containerID)
+	if err != nil {
+		return 0, err
+	}
+
+	if ok && s.Relaunches > 0 {
+		return s.PID, nil
+	}
+
+	return pid, nil
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupShimTest creates a private state directory and fake process
+// start times, returning a function to undo the changes.
+func setupShimTest(t *testing.T, starts map[int]uint64) func() {
+	dir, err := ioutil.TempDir(testDir, "shim-")
+	assert.NoError(t, err)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedProcStartTime := procStartTime
+	savedShimStdio := shimStdio
+	savedLaunchShim := launchShim
+
+	runtimeStateDir = dir
+
+	procStartTime = func(pid int) (uint64, error) {
+		start, ok := starts[pid]
+		if !ok {
+			return 0, errors.New("no such process")
+		}
+
+		return start, nil
+	}
+
+	shimStdio = func(pid int) []string {
+		return []string{"/dev/null", "", ""}
+	}
+
+	return func() {
+		runtimeStateDir = savedRuntimeStateDir
+		procStartTime = savedProcStartTime
+		shimStdio = savedShimStdio
+		launchShim = savedLaunchShim
+		os.RemoveAll(dir)
+	}
+}
+
+func TestContainerShimStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupShimTest(t, nil)()
+
+	_, ok, err := loadContainerShim(testContainerID)
+	assert.NoError(err)
+	assert.False(ok)
+
+	s := containerShim{PID: 1234, ShimStart: 42, Token: "token", URL: "unix:///proxy.sock"}
+	assert.NoError(saveContainerShim(testContainerID, s))
+
+	loaded, ok, err := loadContainerShim(testContainerID)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(s, loaded)
+
+	assert.NoError(removeContainerShim(testContainerID))
+	assert.NoError(removeContainerShim(testContainerID))
+
+	_, ok, err = loadContainerShim(testContainerID)
+	assert.NoError(err)
+	assert.False(ok)
+
+	assert.NoError(ioutil.WriteFile(containerShimPath(testContainerID), []byte("{"), testFileMode))
+
+	_, _, err = loadContainerShim(testContainerID)
+	assert.Error(err)
+}
+
+func TestShimStdio(t *testing.T) {
+	assert := assert.New(t)
+
+	stdio := shimStdio(os.Getpid())
+	assert.Len(stdio, 3)
+
+	for _, path := range stdio {
+		assert.True(path == "" || filepath.IsAbs(path), path)
+	}
+}
+
+func TestRecordShim(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupShimTest(t, map[int]uint64{1234: 42})()
+
+	runtimeConfig := oci.RuntimeConfig{
+		ProxyConfig: vc.CCProxyConfig{URL: "unix:///proxy.sock"},
+	}
+
+	// no proxy session
+	assert.NoError(recordShim(testContainerID, vc.Process{Pid: 1234}, "", runtimeConfig))
+	assert.NoError(recordShim(testContainerID, vc.Process{Pid: 1234, Token: "token"}, "", oci.RuntimeConfig{}))
+
+	// shim already gone
+	assert.NoError(recordShim(testContainerID, vc.Process{Pid: 5678, Token: "token"}, "", runtimeConfig))
+
+	_, ok, err := loadContainerShim(testContainerID)
+	assert.NoError(err)
+	assert.False(ok)
+
+	assert.NoError(recordShim(testContainerID, vc.Process{Pid: 1234, Token: "token"}, "/dev/pts/3", runtimeConfig))
+
+	s, ok, err := loadContainerShim(testContainerID)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(containerShim{
+		PID:       1234,
+		ShimStart: 42,
+		Token:     "token",
+		URL:       "unix:///proxy.sock",
+		Console:   "/dev/pts/3",
+		Stdio:     []string{"/dev/null", "", ""},
+	}, s)
+}
+
+func TestRelaunchShim(t *testing.T) {
+	assert := assert.New(t)
+
+	starts := map[int]uint64{1234: 42}
+	defer setupShimTest(t, starts)()
+
+	var launched []containerShim
+
+	launchShim = func(shimPath string, s containerShim) (int, error) {
+		assert.Equal("/usr/bin/cc-shim", shimPath)
+		launched = append(launched, s)
+		starts[5678] = 99
+		return 5678, nil
+	}
+
+	// not recorded
+	s, err := relaunchShim(testPodID, testContainerID, "/usr/bin/cc-shim", nil)
+	assert.NoError(err)
+	assert.Nil(s)
+
+	assert.NoError(saveContainerShim(testContainerID, containerShim{PID: 1234, ShimStart: 42, Token: "token"}))
+
+	// running
+	s, err = relaunchShim(testPodID, testContainerID, "/usr/bin/cc-shim", nil)
+	assert.NoError(err)
+	assert.Nil(s)
+
+	// the PID was reused
+	starts[1234] = 43
+
+	_, err = relaunchShim(testPodID, testContainerID, "", nil)
+	assert.Error(err)
+
+	s, err = relaunchShim(testPodID, testContainerID, "/usr/bin/cc-shim", nil)
+	assert.NoError(err)
+	assert.NotNil(s)
+	assert.Len(launched, 1)
+	assert.Equal("token", launched[0].Token)
+
+	saved, ok, err := loadContainerShim(testContainerID)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(*s, saved)
+	assert.Equal(5678, saved.PID)
+	assert.Equal(uint64(99), saved.ShimStart)
+	assert.Equal(uint32(1), saved.Relaunches)
+
+	pid, err := getShimPID(testContainerID, 1234)
+	assert.NoError(err)
+	assert.Equal(5678, pid)
+
+	// the relaunched shim died too and cannot be relaunched
+	starts[5678] = 0
+	launchShim = func(shimPath string, s containerShim) (int, error) {
+		return -1, errors.New("launch failed")
+	}
+
+	_, err = relaunchShim(testPodID, testContainerID, "/usr/bin/cc-shim", nil)
+	assert.Error(err)
+}
+
+func TestGetShimPID(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setupShimTest(t, nil)()
+
+	pid, err := getShimPID(testContainerID, 1234)
+	assert.NoError(err)
+	assert.Equal(1234, pid)
+
+	// recorded but not relaunched
+	assert.NoError(saveContainerShim(testContainerID, containerShim{PID: 1234}))
+
+	pid, err = getShimPID(testContainerID, 1234)
+	assert.NoError(err)
+	assert.Equal(1234, pid)
+}
+
+func TestLaunchShim(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "shim-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	shimPath := filepath.Join(dir, "shim")
+	assert.NoError(ioutil.WriteFile(shimPath, []byte("#!/bin/sh\necho \"$@\"\n"), 0755))
+
+	output := filepath.Join(dir, "output")
+	assert.NoError(createEmptyFile(output))
+
+	_, err = launchShim(shimPath, containerShim{
+		Token: "token",
+		URL:   "unix:///proxy.sock",
+		Stdio: []string{"", output, filepath.Join(dir, "missing")},
+	})
+	assert.Error(err)
+
+	pid, err := launchShim(shimPath, containerShim{
+		Token: "token",
+		URL:   "unix:///proxy.sock",
+		Stdio: []string{"", output, ""},
+	})
+	assert.NoError(err)
+	assert.True(pid > 0)
+
+	var contents string
+	for i := 0; i < 100 && contents == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+		contents, err = getFileContents(output)
+		assert.NoError(err)
+	}
+
+	assert.Equal("-t token -u unix:///proxy.sock", strings.TrimSpace(contents))
+}
+
+func TestHealthCheckerCheckShims(t *testing.T) {
+	assert := assert.New(t)
+
+	starts := map[int]uint64{}
+	defer setupShimTest(t, starts)()
+
+	launchShim = func(shimPath string, s containerShim) (int, error) {
+		starts[5678] = 99
+		return 5678, nil
+	}
+
+	assert.NoError(saveContainerShim("running", containerShim{PID: 1234, ShimStart: 42}))
+	assert.NoError(saveContainerShim("stopped", containerShim{PID: 1234, ShimStart: 42}))
+
+	h := healthChecker{shimPath: "/usr/bin/cc-shim"}
+
+	events := h.checkShims(vc.PodStatus{
+		ID: testPodID,
+		ContainersStatus: []vc.ContainerStatus{
+			{ID: "running", State: vc.State{State: vc.StateRunning}},
+			{ID: "stopped", State: vc.State{State: vc.StateStopped}},
+			{ID: "unknown", State: vc.State{State: vc.StateRunning}},
+		},
+	})
+
+	assert.Len(events, 1)
+	assert.Equal(healthEventShimRelaunched, events[0].Type)
+	assert.Equal(testPodID, events[0].PodID)
+
+	s, _, err := loadContainerShim("stopped")
+	assert.NoError(err)
+	assert.Equal(1234, s.PID)
+
+	// the shim cannot be relaunched
+	h.shimPath = ""
+	starts[5678] = 100
+
+	events = h.checkShims(vc.PodStatus{
+		ID: testPodID,
+		ContainersStatus: []vc.ContainerStatus{
+			{ID: "running", State: vc.State{State: vc.StateRunning}},
+		},
+	})
+
+	assert.Len(events, 1)
+	assert.Equal(healthEventFailed, events[0].Type)
+}
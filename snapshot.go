@@ -0,0 +1,469 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/urfave/cli"
+)
+
+const (
+	// snapshotManifestVersion is the version of the format of the
+	// snapshot manifests.
+	snapshotManifestVersion = 1
+
+	// Names of the snapshot archive entries.
+	snapshotManifestName   = "manifest.json"
+	snapshotMemoryName     = "memory.elf"
+	snapshotContainersName = "containers"
+)
+
+// snapshotFile describes a regular file of a snapshot archive.
+type snapshotFile struct {
+	// Name is the name of the archive entry.
+	Name string `json:"name"`
+
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// snapshotContainer describes the writable layer of a container in a
+// snapshot archive.
+type snapshotContainer struct {
+	ID     string `json:"id"`
+	RootFs string `json:"rootfs"`
+
+	// WritableLayer is the host directory the files were read from.
+	WritableLayer string `json:"writableLayer"`
+
+	// Full is true when the root filesystem has no separate writable
+	// layer, in which case the whole root filesystem is exported.
+	Full bool `json:"full,omitempty"`
+
+	Files []snapshotFile `json:"files"`
+}
+
+// snapshotManifest is the last entry of a snapshot archive. It lists
+// the exported files with their digests so that the archive can be
+// verified before being analysed.
+type snapshotManifest struct {
+	Version   uint32    `json:"version"`
+	PodID     string    `json:"podID"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	RuntimeVersion string `json:"runtimeVersion"`
+	RuntimeCommit  string `json:"runtimeCommit"`
+
+	// Memory is the ELF core dump of the guest memory, if exported.
+	Memory *snapshotFile `json:"memory,omitempty"`
+
+	Containers []snapshotContainer `json:"containers"`
+}
+
+var snapshotCLICommand = cli.Command{
+	Name:  "cc-snapshot",
+	Usage: "export the memory and writable layers of a paused pod",
+	ArgsUsage: `<container-id>
+
+   Where "<container-id>" is the name of a container of the pod to export.`,
+	Description: `The cc-snapshot command exports the state of a pod for forensic
+   analysis, for example after a container was compromised. It writes a
+   gzip-compressed tar archive holding:
+
+     memory.elf          the guest memory, as an ELF core dump
+     containers/<id>/    the writable layer of each container, that is
+                         the changes made to its root filesystem
+     manifest.json       the list of the exported files with their
+                         SHA-256 digests
+
+   The pod must be paused, so that the snapshot is consistent and the
+   workload cannot notice or interfere with it. Specify "--pause" to
+   pause it first; it is then left paused for further analysis.
+
+   The files of the pod are only read: the archive must be created
+   outside of the root filesystems of the pod.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "path of the archive to create",
+		},
+		cli.BoolFlag{
+			Name:  "pause",
+			Usage: "pause the pod if it is running",
+		},
+		cli.BoolFlag{
+			Name:  "no-memory",
+			Usage: "do not export the guest memory",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 1 {
+			return errors.New("Expecting a single container ID")
+		}
+
+		output := context.String("output")
+		if output == "" {
+			return errors.New("Missing output archive path")
+		}
+
+		_, podID, err := getExistingContainerInfo(context.Args().First())
+		if err != nil {
+			return err
+		}
+
+		return snapshotPod(podID, output, context.Bool("pause"), !context.Bool("no-memory"))
+	},
+}
+
+// dumpGuestMemory writes the memory of the VM of the specified pod to
+// path, as an ELF core dump.
+var dumpGuestMemory = func(ctx context.Context, podID, path string) error {
+	socket := filepath.Join(vcRunStoragePath, podID, hypervisorControlSocket)
+
+	return qmpExecute(ctx, socket, "dump-guest-memory", map[string]interface{}{
+		"paging":   false,
+		"protocol": "file:" + path,
+	})
+}
+
+// isBelow returns true if path is below dir.
+func isBelow(dir, path string) bool {
+	return strings.HasPrefix(filepath.Clean(path), strings.TrimSuffix(dir, "/")+"/")
+}
+
+// qmpExecute runs a single QMP command on the specified control socket.
+// The QMP client of the ciao package only supports a fixed set of
+// commands, which does not include dump-guest-memory.
+func qmpExecute(ctx context.Context, socket, command string, args map[string]interface{}) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+
+	var greeting map[string]json.RawMessage
+	if err := decoder.Decode(&greeting); err != nil {
+		return err
+	}
+
+	if _, ok := greeting["QMP"]; !ok {
+		return fmt.Errorf("Unexpected QMP greeting on %v", socket)
+	}
+
+	commands := []map[string]interface{}{
+		{"execute": "qmp_capabilities"},
+		{"execute": command, "arguments": args},
+	}
+
+	for _, cmd := range commands {
+		if err := encoder.Encode(cmd); err != nil {
+			return err
+		}
+
+		if err := qmpReadReply(decoder); err != nil {
+			return fmt.Errorf("QMP command %v failed: %v", cmd["execute"], err)
+		}
+	}
+
+	return nil
+}
+
+// qmpReadReply waits for the reply to a QMP command, skipping the
+// asynchronous events.
+func qmpReadReply(decoder *json.Decoder) error {
+	for {
+		var reply struct {
+			Event  string           `json:"event"`
+			Return *json.RawMessage `json:"return"`
+			Error  *struct {
+				Class string `json:"class"`
+				Desc  string `json:"desc"`
+			} `json:"error"`
+		}
+
+		if err := decoder.Decode(&reply); err != nil {
+			return err
+		}
+
+		switch {
+		case reply.Error != nil:
+			return fmt.Errorf("%s: %s", reply.Error.Class, reply.Error.Desc)
+		case reply.Return != nil:
+			return nil
+		}
+	}
+}
+
+// snapshotPod exports the snapshot of the specified pod to output,
+// pausing the pod first if requested.
+func snapshotPod(podID, output string, pause, memory bool) error {
+	status, err := vci.StatusPod(podID)
+	if err != nil {
+		return err
+	}
+
+	if status.State.State != vc.StatePaused {
+		if !pause {
+			return fmt.Errorf("Pod %s is not paused: pause it first, or specify --pause", podID)
+		}
+
+		if _, err := vci.PausePod(podID); err != nil {
+			return err
+		}
+
+		ccLog.Infof("Paused pod %s for snapshot", podID)
+	}
+
+	return exportSnapshot(status, output, memory)
+}
+
+// exportSnapshot writes the snapshot archive of the specified paused pod
+// to output, which must not exist yet.
+func exportSnapshot(status vc.PodStatus, output string, memory bool) (err error) {
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range status.ContainersStatus {
+		if c.RootFs != "" && (output == filepath.Clean(c.RootFs) || isBelow(c.RootFs, output)) {
+			return fmt.Errorf("Snapshot archive %v must not be created inside container %s", output, c.ID)
+		}
+	}
+
+	mounts, err := getMounts()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(output)
+		}
+	}()
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest := snapshotManifest{
+		Version:        snapshotManifestVersion,
+		PodID:          status.ID,
+		CreatedAt:      timeNow().UTC(),
+		RuntimeVersion: version,
+		RuntimeCommit:  commit,
+	}
+
+	if memory {
+		file, err := exportGuestMemory(tw, status.ID, filepath.Dir(output))
+		if err != nil {
+			return err
+		}
+
+		manifest.Memory = &file
+	}
+
+	for _, c := range status.ContainersStatus {
+		container, err := exportWritableLayer(tw, mounts, c)
+		if err != nil {
+			return err
+		}
+
+		manifest.Containers = append(manifest.Containers, container)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     snapshotManifestName,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  manifest.CreatedAt,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// exportGuestMemory dumps the guest memory of the specified pod in a
+// temporary file of dir and adds it to the archive.
+func exportGuestMemory(tw *tar.Writer, podID, dir string) (snapshotFile, error) {
+	tmpDir, err := ioutil.TempDir(dir, ".snapshot-")
+	if err != nil {
+		return snapshotFile{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dump := filepath.Join(tmpDir, snapshotMemoryName)
+
+	if err := dumpGuestMemory(context.Background(), podID, dump); err != nil {
+		return snapshotFile{}, fmt.Errorf("Unable to dump the memory of pod %s: %v", podID, err)
+	}
+
+	info, err := os.Lstat(dump)
+	if err != nil {
+		return snapshotFile{}, err
+	}
+
+	return addSnapshotFile(tw, dump, snapshotMemoryName, info)
+}
+
+// exportWritableLayer adds the writable layer of the specified container
+// to the archive.
+func exportWritableLayer(tw *tar.Writer, mounts []mountEntry, status vc.ContainerStatus) (snapshotContainer, error) {
+	layer, err := writableLayerDir(mounts, status.RootFs)
+	if err != nil {
+		return snapshotContainer{}, err
+	}
+
+	container := snapshotContainer{
+		ID:            status.ID,
+		RootFs:        status.RootFs,
+		WritableLayer: layer,
+		Full:          layer == status.RootFs,
+	}
+
+	prefix := path.Join(snapshotContainersName, status.ID)
+
+	err = filepath.Walk(layer, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(layer, p)
+		if err != nil {
+			return err
+		}
+
+		name := path.Join(prefix, filepath.ToSlash(rel))
+
+		if info.Mode().IsRegular() {
+			file, err := addSnapshotFile(tw, p, name, info)
+			if err != nil {
+				return err
+			}
+
+			container.Files = append(container.Files, file)
+			return nil
+		}
+
+		// Directories, symbolic links and the character devices
+		// overlay uses to record deleted files.
+		var target string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, target)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		return tw.WriteHeader(hdr)
+	})
+
+	return container, err
+}
+
+// addSnapshotFile adds the regular file p to the archive, returning its
+// description for the manifest.
+func addSnapshotFile(tw *tar.Writer, p, name string, info os.FileInfo) (snapshotFile, error) {
+	f, err := os.OpenFile(p, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return snapshotFile{}, err
+	}
+	defer f.Close()
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return snapshotFile{}, err
+	}
+
+	hdr.Name = name
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return snapshotFile{}, err
+	}
+
+	h := sha256.New()
+
+	if _, err := io.CopyN(io.MultiWriter(tw, h), f, hdr.Size); err != nil {
+		return snapshotFile{}, fmt.Errorf("Unable to export %v: %v", p, err)
+	}
+
+	return snapshotFile{
+		Name:   name,
+		Size:   hdr.Size,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQMPServer answers the QMP commands sent on socket with the replies
+// returned by handler, after sending an event.
+func fakeQMPServer(t *testing.T, socket string, handler func(command string, args map[string]interface{}) string) (commands chan string) {
+	l, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+
+	commands = make(chan string, 10)
+
+	go func() {
+		defer l.Close()
+		defer close(commands)
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte(`{"QMP": {"version": {}, "capabilities": []}}` + "\n"))
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var cmd struct {
+				Execute   string                 `json:"execute"`
+				Arguments map[string]interface{} `json:"arguments"`
+			}
+
+			if json.Unmarshal(scanner.Bytes(), &cmd) != nil {
+				return
+			}
+
+			commands <- cmd.Execute
+
+			conn.Write([]byte(`{"event": "STOP", "timestamp": {}}` + "\n"))
+			conn.Write([]byte(handler(cmd.Execute, cmd.Arguments) + "\n"))
+		}
+	}()
+
+	return commands
+}
+
+func TestQMPExecute(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "qmp-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(os.MkdirAll(filepath.Join(dir, testPodID), testDirMode))
+
+	socket := filepath.Join(dir, testPodID, hypervisorControlSocket)
+	dump := filepath.Join(dir, "dump")
+
+	commands := fakeQMPServer(t, socket, func(command string, args map[string]interface{}) string {
+		if command == "dump-guest-memory" {
+			assert.Equal(false, args["paging"])
+			assert.NoError(createFile(strings.TrimPrefix(args["protocol"].(string), "file:"), "core"))
+		}
+
+		return `{"return": {}}`
+	})
+
+	savedRunStoragePath := vcRunStoragePath
+	vcRunStoragePath = dir
+	defer func() {
+		vcRunStoragePath = savedRunStoragePath
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(dumpGuestMemory(ctx, testPodID, dump))
+
+	data, err := getFileContents(dump)
+	assert.NoError(err)
+	assert.Equal("core", data)
+
+	assert.Equal("qmp_capabilities", <-commands)
+	assert.Equal("dump-guest-memory", <-commands)
+}
+
+func TestQMPExecuteError(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "qmp-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "ctrl.sock")
+
+	fakeQMPServer(t, socket, func(command string, args map[string]interface{}) string {
+		if command == "qmp_capabilities" {
+			return `{"return": {}}`
+		}
+
+		return `{"error": {"class": "GenericError", "desc": "no space left"}}`
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = qmpExecute(ctx, socket, "dump-guest-memory", nil)
+	assert.Error(err)
+	assert.Contains(err.Error(), "no space left")
+
+	// no hypervisor
+	assert.Error(qmpExecute(ctx, filepath.Join(dir, "missing.sock"), "stop", nil))
+}
+
+// readSnapshot returns the entries of a snapshot archive and the
+// contents of its regular files.
+func readSnapshot(t *testing.T, archive string) (map[string]*tar.Header, map[string]string) {
+	f, err := os.Open(archive)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+
+		headers[hdr.Name] = hdr
+
+		if hdr.Typeflag == tar.TypeReg {
+			data, err := ioutil.ReadAll(tr)
+			assert.NoError(t, err)
+			contents[hdr.Name] = string(data)
+		}
+	}
+
+	return headers, contents
+}
+
+func setupSnapshotTest(t *testing.T) (dir string, status vc.PodStatus, cleanup func()) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "snapshot-")
+	assert.NoError(err)
+
+	savedProcMounts := procMounts
+	savedDumpGuestMemory := dumpGuestMemory
+	savedTimeNow := timeNow
+
+	procMounts = filepath.Join(dir, "mounts")
+	dumpGuestMemory = func(ctx context.Context, podID, path string) error {
+		return createFile(path, "memory of "+podID)
+	}
+	timeNow = func() time.Time {
+		return time.Unix(10000, 0)
+	}
+
+	rootfs := filepath.Join(dir, "rootfs")
+	upper := filepath.Join(dir, "upper")
+
+	assert.NoError(createFile(procMounts, "/dev/sda1 / ext4 rw 0 0\noverlay "+rootfs+" overlay rw,lowerdir=/lower,upperdir="+upper+",workdir=/work 0 0\n"))
+
+	assert.NoError(os.MkdirAll(filepath.Join(upper, "etc"), testDirMode))
+	assert.NoError(createFile(filepath.Join(upper, "etc", "passwd"), "root:x:0:0::/root:/bin/sh\n"))
+	assert.NoError(os.Symlink("/etc/passwd", filepath.Join(upper, "link")))
+
+	status = vc.PodStatus{
+		ID:    testPodID,
+		State: vc.State{State: vc.StatePaused},
+		ContainersStatus: []vc.ContainerStatus{
+			{ID: testContainerID, RootFs: rootfs},
+		},
+	}
+
+	return dir, status, func() {
+		procMounts = savedProcMounts
+		dumpGuestMemory = savedDumpGuestMemory
+		timeNow = savedTimeNow
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExportSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, status, cleanup := setupSnapshotTest(t)
+	defer cleanup()
+
+	archive := filepath.Join(dir, "snapshot.tar.gz")
+
+	assert.NoError(exportSnapshot(status, archive, true))
+
+	headers, contents := readSnapshot(t, archive)
+
+	assert.Equal("memory of "+testPodID, contents[snapshotMemoryName])
+
+	prefix := snapshotContainersName + "/" + testContainerID + "/"
+
+	assert.Equal("root:x:0:0::/root:/bin/sh\n", contents[prefix+"etc/passwd"])
+	assert.Equal(byte(tar.TypeSymlink), headers[prefix+"link"].Typeflag)
+	assert.Equal("/etc/passwd", headers[prefix+"link"].Linkname)
+	assert.Equal(byte(tar.TypeDir), headers[prefix+"etc/"].Typeflag)
+
+	var manifest snapshotManifest
+	assert.NoError(json.Unmarshal([]byte(contents[snapshotManifestName]), &manifest))
+
+	assert.Equal(uint32(snapshotManifestVersion), manifest.Version)
+	assert.Equal(testPodID, manifest.PodID)
+	assert.True(manifest.CreatedAt.Equal(time.Unix(10000, 0)))
+	assert.Equal(version, manifest.RuntimeVersion)
+
+	assert.NotNil(manifest.Memory)
+	assert.Len(manifest.Containers, 1)
+
+	c := manifest.Containers[0]
+	assert.Equal(testContainerID, c.ID)
+	assert.Equal(filepath.Join(dir, "upper"), c.WritableLayer)
+	assert.False(c.Full)
+
+	files := append([]snapshotFile{*manifest.Memory}, c.Files...)
+	assert.Len(files, 2)
+
+	for _, file := range files {
+		sum := sha256.Sum256([]byte(contents[file.Name]))
+		assert.Equal(hex.EncodeToString(sum[:]), file.SHA256, file.Name)
+		assert.Equal(int64(len(contents[file.Name])), file.Size, file.Name)
+	}
+
+	// The temporary memory dump is removed
+	entries, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	for _, e := range entries {
+		assert.False(strings.HasPrefix(e.Name(), ".snapshot-"), e.Name())
+	}
+
+	// Existing archives are not overwritten
+	assert.Error(exportSnapshot(status, archive, true))
+}
+
+func TestExportSnapshotNoMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, status, cleanup := setupSnapshotTest(t)
+	defer cleanup()
+
+	dumpGuestMemory = func(ctx context.Context, podID, path string) error {
+		return errors.New("should not be called")
+	}
+
+	// No separate writable layer
+	assert.NoError(createFile(procMounts, "/dev/sda1 / ext4 rw 0 0\n"))
+	assert.NoError(os.MkdirAll(status.ContainersStatus[0].RootFs, testDirMode))
+
+	archive := filepath.Join(dir, "snapshot.tar.gz")
+
+	assert.NoError(exportSnapshot(status, archive, false))
+
+	_, contents := readSnapshot(t, archive)
+
+	_, ok := contents[snapshotMemoryName]
+	assert.False(ok)
+
+	var manifest snapshotManifest
+	assert.NoError(json.Unmarshal([]byte(contents[snapshotManifestName]), &manifest))
+	assert.Nil(manifest.Memory)
+	assert.True(manifest.Containers[0].Full)
+}
+
+func TestExportSnapshotFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, status, cleanup := setupSnapshotTest(t)
+	defer cleanup()
+
+	// The archive cannot be created in the pod
+	rootfs := status.ContainersStatus[0].RootFs
+	assert.Error(exportSnapshot(status, filepath.Join(rootfs, "tmp", "snapshot.tar.gz"), true))
+	assert.Error(exportSnapshot(status, rootfs, true))
+
+	dumpGuestMemory = func(ctx context.Context, podID, path string) error {
+		return errors.New("hypervisor not responding")
+	}
+
+	archive := filepath.Join(dir, "snapshot.tar.gz")
+
+	assert.Error(exportSnapshot(status, archive, true))
+	assert.False(fileExists(archive))
+}
+
+func TestSnapshotPod(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, status, cleanup := setupSnapshotTest(t)
+	defer cleanup()
+
+	status.State.State = vc.StateRunning
+
+	paused := false
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return status, nil
+	}
+	testingImpl.PausePodFunc = func(podID string) (vc.VCPod, error) {
+		paused = true
+		return testPausePodFuncReturnNil(podID)
+	}
+	defer func() {
+		testingImpl.StatusPodFunc = nil
+		testingImpl.PausePodFunc = nil
+	}()
+
+	archive := filepath.Join(dir, "snapshot.tar.gz")
+
+	assert.Error(snapshotPod(testPodID, archive, false, true))
+	assert.False(paused)
+	assert.False(fileExists(archive))
+
+	assert.NoError(snapshotPod(testPodID, archive, true, true))
+	assert.True(paused)
+	assert.True(fileExists(archive))
+}
@@ -16,10 +16,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
@@ -38,8 +38,11 @@ var startCLICommand = cli.Command{
 			return fmt.Errorf("Missing container ID, should at least provide one")
 		}
 
+		ctx, cancel := commandContext(runtimeOptions.Timeouts.start())
+		defer cancel()
+
 		for _, cID := range []string(args) {
-			if _, err := start(cID); err != nil {
+			if _, err := start(ctx, cID); err != nil {
 				return err
 			}
 		}
@@ -48,28 +51,51 @@ var startCLICommand = cli.Command{
 	},
 }
 
-func start(containerID string) (vc.VCPod, error) {
+func start(ctx context.Context, containerID string) (vc.VCPod, error) {
 	// Checks the MUST and MUST NOT from OCI runtime specification
 	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
 		return nil, err
 	}
 
+	// The pod may have been paused because it was idle.
+	status, err = wakeContainer(status, podID)
+	if err != nil {
+		return nil, err
+	}
+
 	containerID = status.ID
 
-	containerType, err := oci.GetContainerType(status.Annotations)
+	wholePod, err := ownsVM(status)
 	if err != nil {
 		return nil, err
 	}
 
-	if containerType.IsPod() {
-		return vci.StartPod(podID)
+	var pod vc.VCPod
+
+	if wholePod {
+		err = vcCall(ctx, "start pod "+podID, func() (err error) {
+			pod, err = vci.StartPod(podID)
+			return err
+		})
+	} else {
+		err = vcCall(ctx, "start container "+containerID, func() error {
+			c, err := vci.StartContainer(podID, containerID)
+			if err == nil {
+				pod = c.Pod()
+			}
+
+			return err
+		})
 	}
 
-	c, err := vci.StartContainer(podID, containerID)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.Pod(), nil
+	if err := recordStarted(containerID); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
 }
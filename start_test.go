@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"testing"
 
@@ -29,12 +30,12 @@ func TestStartInvalidArgs(t *testing.T) {
 	assert := assert.New(t)
 
 	// Missing container id
-	_, err := start("")
+	_, err := start(context.Background(), "")
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 
 	// Mock Listpod error
-	_, err = start(testContainerID)
+	_, err = start(context.Background(), testContainerID)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -47,7 +48,7 @@ func TestStartInvalidArgs(t *testing.T) {
 	}()
 
 	// Container missing in ListPod
-	_, err = start(testContainerID)
+	_, err = start(context.Background(), testContainerID)
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 }
@@ -79,7 +80,7 @@ func TestStartPod(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	_, err := start(pod.ID())
+	_, err := start(context.Background(), pod.ID())
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -91,7 +92,7 @@ func TestStartPod(t *testing.T) {
 		testingImpl.StartPodFunc = nil
 	}()
 
-	_, err = start(pod.ID())
+	_, err = start(context.Background(), pod.ID())
 	assert.Nil(err)
 }
 
@@ -120,7 +121,7 @@ func TestStartMissingAnnotation(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	_, err := start(pod.ID())
+	_, err := start(context.Background(), pod.ID())
 	assert.Error(err)
 	assert.False(vcMock.IsMockError(err))
 }
@@ -159,7 +160,7 @@ func TestStartContainerSucessFailure(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	_, err := start(testContainerID)
+	_, err := start(context.Background(), testContainerID)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -171,7 +172,7 @@ func TestStartContainerSucessFailure(t *testing.T) {
 		testingImpl.StartContainerFunc = nil
 	}()
 
-	_, err = start(testContainerID)
+	_, err = start(context.Background(), testContainerID)
 	assert.Nil(err)
 }
 
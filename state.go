@@ -19,7 +19,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 
+	ccruntime "github.com/clearcontainers/runtime/pkg/runtime"
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
@@ -43,16 +45,12 @@ instance of a container.`,
 }
 
 func state(containerID string) error {
-	// Checks the MUST and MUST NOT from OCI runtime specification
-	status, _, err := getExistingContainerInfo(containerID)
+	containerState, err := getContainerState(containerID)
 	if err != nil {
 		return err
 	}
 
-	// Convert the status to the expected State structure
-	state := oci.StatusToOCIState(status)
-
-	stateJSON, err := json.MarshalIndent(state, "", "  ")
+	stateJSON, err := json.MarshalIndent(containerState, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -62,3 +60,47 @@ func state(containerID string) error {
 
 	return nil
 }
+
+// getContainerState returns the state of the specified container.
+func getContainerState(containerID string) (ccruntime.ContainerState, error) {
+	// Checks the MUST and MUST NOT from OCI runtime specification
+	status, podID, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return ccruntime.ContainerState{}, err
+	}
+
+	// Convert the status to the expected State structure
+	state := oci.StatusToOCIState(status)
+
+	if state.Pid, err = getShimPID(status.ID, state.Pid); err != nil {
+		return ccruntime.ContainerState{}, err
+	}
+
+	restarts, err := getRestartCount(podID)
+	if err != nil {
+		return ccruntime.ContainerState{}, err
+	}
+
+	if restarts > 0 {
+		state.Annotations = make(map[string]string)
+		for k, v := range status.Annotations {
+			state.Annotations[k] = v
+		}
+
+		state.Annotations[restartCountAnnotation] = strconv.FormatUint(uint64(restarts), 10)
+	}
+
+	var lifecycle containerLifecycle
+
+	if state.Status == oci.StateStopped {
+		lifecycle, err = recordFinished(status.ID)
+	} else {
+		lifecycle, err = loadLifecycle(status.ID)
+	}
+
+	if err != nil {
+		return ccruntime.ContainerState{}, err
+	}
+
+	return ccruntime.NewContainerState(state, lifecycle), nil
+}
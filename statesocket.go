@@ -0,0 +1,205 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+const (
+	// stateContainersPath is the REST endpoint listing the containers,
+	// followed by "/<container-id>" for the state of a container and
+	// "/<container-id>/stats" for its statistics.
+	stateContainersPath = "/v1/containers"
+
+	// stateMetricsPath is the REST endpoint of the runtime metrics.
+	stateMetricsPath = "/v1/metrics"
+
+	defaultStateSocketMode = "0660"
+)
+
+// stateServer serves the read-only state of the containers on a socket
+// of the daemon, for the monitoring agents of the node. The access to the
+// socket is controlled by its permissions, independently of the socket
+// running commands.
+type stateServer struct {
+	d *daemon
+}
+
+// writeCommandOutput sends the output of a command run by the daemon.
+func writeCommandOutput(w http.ResponseWriter, resp daemonResponse) {
+	if resp.Error != "" {
+		http.Error(w, resp.Error, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, resp.Output)
+}
+
+// containerExists returns true if the container exists. Like every
+// direct call to virtcontainers, it must be serialised with the commands
+// run by the daemon.
+func (s *stateServer) containerExists(containerID string) (bool, error) {
+	s.d.Lock()
+	defer s.d.Unlock()
+
+	status, _, err := getContainerInfo(containerID)
+	if err != nil {
+		return false, err
+	}
+
+	return status.ID != "", nil
+}
+
+func (s *stateServer) serveMetrics(w http.ResponseWriter) {
+	s.d.Lock()
+	defer s.d.Unlock()
+
+	metrics, err := getMetrics()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if err := writeMetrics(w, metrics); err != nil {
+		ccLog.Warnf("Unable to send metrics: %v", err)
+	}
+}
+
+func (s *stateServer) serveStats(w http.ResponseWriter, containerID string) {
+	s.d.Lock()
+	defer s.d.Unlock()
+
+	stats, err := containerStats(containerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(event{Type: "stats", ID: containerID, Data: stats}); err != nil {
+		ccLog.Warnf("Unable to send stats: %v", err)
+	}
+}
+
+func (s *stateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path == stateMetricsPath {
+		s.serveMetrics(w)
+		return
+	}
+
+	if r.URL.Path == stateContainersPath {
+		writeCommandOutput(w, s.d.run([]string{"list", "--format", "json", "--cc-all"}))
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, stateContainersPath+"/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, stateContainersPath+"/"), "/")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "stats") {
+		http.NotFound(w, r)
+		return
+	}
+
+	containerID := parts[0]
+
+	exists, err := s.containerExists(containerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !exists {
+		http.Error(w, fmt.Sprintf("No such container %v", containerID), http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 2 {
+		s.serveStats(w, containerID)
+		return
+	}
+
+	writeCommandOutput(w, s.d.run([]string{"state", containerID}))
+}
+
+// parseSocketMode parses the octal permissions of a socket.
+func parseSocketMode(mode string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("Invalid socket mode %q", mode)
+	}
+
+	return os.FileMode(perm), nil
+}
+
+// lookupGroup returns the ID of a group given by name or ID.
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(g.Gid)
+}
+
+// stateListener returns the state socket, with the specified mode and
+// owned by the specified group, if any.
+func stateListener(path, mode, group string) (net.Listener, error) {
+	perm, err := parseSocketMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	gid := -1
+
+	if group != "" {
+		if gid, err = lookupGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := unixListener(path, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chown(path, -1, gid); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
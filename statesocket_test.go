@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateServerServeHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "daemon-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	server := &stateServer{d: newTestDaemon(t, dir)}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, vc.State{}, vc.State{}, map[string]string{}), nil
+	}
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	type testData struct {
+		method   string
+		path     string
+		expected int
+	}
+
+	data := []testData{
+		{"POST", stateContainersPath, http.StatusMethodNotAllowed},
+		{"GET", "/v1/foo", http.StatusNotFound},
+		{"GET", stateContainersPath + "/", http.StatusNotFound},
+		{"GET", stateContainersPath + "/" + testContainerID + "/foo", http.StatusNotFound},
+		{"GET", stateContainersPath + "/" + testContainerID + "/stats/foo", http.StatusNotFound},
+		{"GET", stateContainersPath + "/enoent", http.StatusNotFound},
+		{"GET", stateContainersPath + "/enoent/stats", http.StatusNotFound},
+		{"GET", stateContainersPath, http.StatusOK},
+		{"GET", stateContainersPath + "/" + testContainerID, http.StatusOK},
+
+		// the container has no bundle
+		{"GET", stateContainersPath + "/" + testContainerID + "/stats", http.StatusInternalServerError},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, nil)
+		w := httptest.NewRecorder()
+
+		server.ServeHTTP(w, req)
+		assert.Equal(d.expected, w.Code, "%+v", d)
+	}
+
+	req := httptest.NewRequest("GET", stateMetricsPath, nil)
+	w := httptest.NewRecorder()
+
+	server.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.True(strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+}
+
+func TestWriteCommandOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	w := httptest.NewRecorder()
+	writeCommandOutput(w, daemonResponse{Output: "[]\n"})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("[]\n", w.Body.String())
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	writeCommandOutput(w, daemonResponse{Error: "failed", ExitCode: 1})
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Contains(w.Body.String(), "failed")
+}
+
+func TestParseSocketMode(t *testing.T) {
+	assert := assert.New(t)
+
+	mode, err := parseSocketMode(defaultStateSocketMode)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0660), mode)
+
+	mode, err = parseSocketMode("600")
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), mode)
+
+	for _, invalid := range []string{"", "rw", "0999", "01777"} {
+		_, err = parseSocketMode(invalid)
+		assert.Error(err, invalid)
+	}
+}
+
+func TestStateListener(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "daemon-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "state.sock")
+
+	_, err = stateListener(socket, "rw", "")
+	assert.Error(err)
+
+	_, err = stateListener(socket, "0640", "no-such-group-for-cc-tests")
+	assert.Error(err)
+
+	gid := strconv.Itoa(os.Getgid())
+
+	// the group of the socket, by name or ID
+	groups := []string{gid}
+	if g, err := user.LookupGroupId(gid); err == nil {
+		groups = append(groups, g.Name)
+	}
+
+	for _, group := range groups {
+		l, err := stateListener(socket, "0640", group)
+		assert.NoError(err, group)
+
+		info, err := os.Stat(socket)
+		assert.NoError(err)
+		assert.Equal(os.FileMode(0640), info.Mode().Perm())
+
+		l.Close()
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// supported guest swap device types
+const (
+	guestSwapZram = "zram"
+	guestSwapFile = "file"
+)
+
+// supported guest memory compression modes
+const (
+	memoryCompressionNone  = ""
+	memoryCompressionZram  = "zram"
+	memoryCompressionZswap = "zswap"
+)
+
+const (
+	defaultGuestSwapType = guestSwapZram
+
+	// maxSwappiness is the maximum value of vm.swappiness
+	maxSwappiness = 100
+
+	// Kernel parameters used to configure swap inside the guest. The
+	// "agent." parameters are not read by hyperstart: the swap device
+	// is only created by a guest image handling them at boot.
+	swapTypeParam   = "agent.swap_type"
+	swapSizeParam   = "agent.swap_size"
+	swappinessParam = "sysctl.vm.swappiness"
+	zramDevsParam   = "zram.num_devices"
+
+	zramCompressorParam  = "agent.zram_compressor"
+	zramSizePercentParam = "agent.zram_size_percent"
+	zswapEnabledParam    = "zswap.enabled"
+	zswapCompressorParam = "zswap.compressor"
+	zswapMaxPoolParam    = "zswap.max_pool_percent"
+
+	// defaultZramSizePercent is the default size of the zram swap
+	// device as a percentage of the guest memory.
+	defaultZramSizePercent = 50
+)
+
+// memoryCompressors lists the compression algorithms the guest kernel
+// may use for zram and zswap.
+var memoryCompressors = []string{"842", "deflate", "lz4", "lz4hc", "lzo", "lzo-rle", "zstd"}
+
+// guestSwap describes the swap configuration of a guest.
+type guestSwap struct {
+	// swapType is the kind of device backing the swap
+	swapType string
+
+	// sizeMiB is the size of the swap device. Zero means no swap.
+	sizeMiB uint64
+
+	// swappiness is the value to use for vm.swappiness. Nil means the
+	// guest kernel default.
+	swappiness *uint64
+}
+
+func validGuestSwapType(swapType string) bool {
+	switch swapType {
+	case guestSwapZram, guestSwapFile:
+		return true
+	}
+
+	return false
+}
+
+// newGuestSwap determines the swap configuration of the guest from the
+// OCI memory.swap and memory.swappiness settings. Note that, as for
+// runc, memory.swap is the total amount of memory plus swap the
+// container may use.
+func newGuestSwap(ociSpec oci.CompatOCISpec, swapType string, vmMemMiB uint64) (guestSwap, error) {
+	swap := guestSwap{
+		swapType: swapType,
+	}
+
+	if ociSpec.Linux == nil ||
+		ociSpec.Linux.Resources == nil ||
+		ociSpec.Linux.Resources.Memory == nil {
+		return swap, nil
+	}
+
+	memory := ociSpec.Linux.Resources.Memory
+
+	if memory.Swappiness != nil {
+		if *memory.Swappiness > maxSwappiness {
+			return guestSwap{}, fmt.Errorf("Invalid OCI memory swappiness %d (maximum %d)",
+				*memory.Swappiness, maxSwappiness)
+		}
+
+		swap.swappiness = memory.Swappiness
+	}
+
+	if memory.Swap == nil {
+		return swap, nil
+	}
+
+	total := *memory.Swap
+
+	// -1 is used to request unlimited swap: size the swap device
+	// like the VM memory.
+	if total == math.MaxUint64 {
+		swap.sizeMiB = vmMemMiB
+		return swap, nil
+	}
+
+	var limit uint64
+	if memory.Limit != nil {
+		limit = *memory.Limit
+	}
+
+	if total < limit {
+		return guestSwap{}, fmt.Errorf("Invalid OCI memory swap %d: must be greater than the memory limit %d",
+			total, limit)
+	}
+
+	// round up to 1MB
+	swap.sizeMiB = (total - limit + (1024*1024 - 1)) / (1024 * 1024)
+
+	return swap, nil
+}
+
+// kernelParams returns the guest kernel parameters required to set up
+// swap inside the guest.
+func (s guestSwap) kernelParams() []vc.Param {
+	var params []vc.Param
+
+	if s.sizeMiB > 0 {
+		if s.swapType == guestSwapZram {
+			params = append(params, vc.Param{Key: zramDevsParam, Value: "1"})
+		}
+
+		params = append(params,
+			vc.Param{Key: swapTypeParam, Value: s.swapType},
+			vc.Param{Key: swapSizeParam, Value: strconv.FormatUint(s.sizeMiB, 10)})
+	}
+
+	if s.swappiness != nil {
+		params = append(params, vc.Param{
+			Key:   swappinessParam,
+			Value: strconv.FormatUint(*s.swappiness, 10),
+		})
+	}
+
+	return params
+}
+
+// getGuestSwapKernelParams returns the kernel parameters required to
+// honour the swap settings of the OCI spec, or nothing if guest swap has
+// not been enabled in the configuration file.
+func getGuestSwapKernelParams(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig) ([]vc.Param, error) {
+	if !runtimeOptions.EnableGuestSwap {
+		if ociSpec.Linux != nil && ociSpec.Linux.Resources != nil &&
+			ociSpec.Linux.Resources.Memory != nil &&
+			(ociSpec.Linux.Resources.Memory.Swap != nil || ociSpec.Linux.Resources.Memory.Swappiness != nil) {
+			ccLog.Info("Guest swap disabled: ignoring OCI memory swap settings")
+		}
+
+		return nil, nil
+	}
+
+	vmMemMiB := uint64(runtimeConfig.HypervisorConfig.DefaultMemSz)
+
+	if ociSpec.Linux != nil && ociSpec.Linux.Resources != nil &&
+		ociSpec.Linux.Resources.Memory != nil && ociSpec.Linux.Resources.Memory.Limit != nil {
+		vmMemMiB = (*ociSpec.Linux.Resources.Memory.Limit + (1024*1024 - 1)) / (1024 * 1024)
+	}
+
+	swap, err := newGuestSwap(ociSpec, runtimeOptions.guestSwapType(), vmMemMiB)
+	if err != nil {
+		return nil, err
+	}
+
+	return swap.kernelParams(), nil
+}
+
+func validMemoryCompressor(compressor string) bool {
+	for _, c := range memoryCompressors {
+		if c == compressor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// memoryCompressionKernelParams returns the guest kernel parameters
+// required to enable compressed memory inside the guest. For zram, a
+// guest image handling the "agent." parameters creates a swap device on
+// a compressed RAM disk sized as a percentage of the guest memory:
+// hyperstart ignores them. For zswap, the guest kernel compresses pages
+// before they are written to swap.
+//
+// A compressor or percentage of zero means the kernel default.
+func memoryCompressionKernelParams(mode, compressor string, percent uint32) ([]vc.Param, error) {
+	if compressor != "" && !validMemoryCompressor(compressor) {
+		return nil, fmt.Errorf("Invalid memory compressor %q (supported: %v)", compressor, memoryCompressors)
+	}
+
+	if percent > 100 {
+		return nil, fmt.Errorf("Invalid memory compression percentage %d", percent)
+	}
+
+	var params []vc.Param
+
+	switch mode {
+	case memoryCompressionNone:
+		return nil, nil
+
+	case memoryCompressionZram:
+		if percent == 0 {
+			percent = defaultZramSizePercent
+		}
+
+		params = append(params,
+			vc.Param{Key: zramDevsParam, Value: "1"},
+			vc.Param{Key: zramSizePercentParam, Value: strconv.FormatUint(uint64(percent), 10)})
+
+		if compressor != "" {
+			params = append(params, vc.Param{Key: zramCompressorParam, Value: compressor})
+		}
+
+	case memoryCompressionZswap:
+		params = append(params, vc.Param{Key: zswapEnabledParam, Value: "1"})
+
+		if compressor != "" {
+			params = append(params, vc.Param{Key: zswapCompressorParam, Value: compressor})
+		}
+
+		if percent != 0 {
+			params = append(params, vc.Param{Key: zswapMaxPoolParam, Value: strconv.FormatUint(uint64(percent), 10)})
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid memory compression mode %q", mode)
+	}
+
+	return params, nil
+}
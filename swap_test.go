@@ -0,0 +1,215 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMiB = uint64(1024 * 1024)
+
+func newTestSwapSpec(limit, swap, swappiness *uint64) oci.CompatOCISpec {
+	var spec oci.CompatOCISpec
+
+	spec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			Memory: &specs.LinuxMemory{
+				Limit:      limit,
+				Swap:       swap,
+				Swappiness: swappiness,
+			},
+		},
+	}
+
+	return spec
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+func TestNewGuestSwap(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		spec        oci.CompatOCISpec
+		expected    guestSwap
+		expectError bool
+	}
+
+	data := []testData{
+		{oci.CompatOCISpec{}, guestSwap{swapType: guestSwapZram}, false},
+		{newTestSwapSpec(nil, nil, nil), guestSwap{swapType: guestSwapZram}, false},
+		{newTestSwapSpec(nil, nil, uint64Ptr(101)), guestSwap{}, true},
+		{newTestSwapSpec(nil, nil, uint64Ptr(60)), guestSwap{swapType: guestSwapZram, swappiness: uint64Ptr(60)}, false},
+		{newTestSwapSpec(uint64Ptr(256*testMiB), uint64Ptr(128*testMiB), nil), guestSwap{}, true},
+		{newTestSwapSpec(uint64Ptr(256*testMiB), uint64Ptr(256*testMiB), nil), guestSwap{swapType: guestSwapZram}, false},
+		{newTestSwapSpec(uint64Ptr(256*testMiB), uint64Ptr(384*testMiB), nil), guestSwap{swapType: guestSwapZram, sizeMiB: 128}, false},
+		{newTestSwapSpec(uint64Ptr(256*testMiB), uint64Ptr(256*testMiB+1), nil), guestSwap{swapType: guestSwapZram, sizeMiB: 1}, false},
+		{newTestSwapSpec(nil, uint64Ptr(64*testMiB), nil), guestSwap{swapType: guestSwapZram, sizeMiB: 64}, false},
+		{newTestSwapSpec(uint64Ptr(256*testMiB), uint64Ptr(math.MaxUint64), nil), guestSwap{swapType: guestSwapZram, sizeMiB: 2048}, false},
+	}
+
+	for _, d := range data {
+		swap, err := newGuestSwap(d.spec, guestSwapZram, 2048)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, swap, "%+v", d)
+	}
+}
+
+func TestGuestSwapKernelParams(t *testing.T) {
+	assert := assert.New(t)
+
+	swap := guestSwap{swapType: guestSwapZram}
+	assert.Empty(swap.kernelParams())
+
+	swap.sizeMiB = 128
+	swap.swappiness = uint64Ptr(10)
+
+	expected := []vc.Param{
+		{Key: zramDevsParam, Value: "1"},
+		{Key: swapTypeParam, Value: guestSwapZram},
+		{Key: swapSizeParam, Value: "128"},
+		{Key: swappinessParam, Value: "10"},
+	}
+
+	assert.Equal(expected, swap.kernelParams())
+
+	swap.swapType = guestSwapFile
+	swap.swappiness = nil
+
+	expected = []vc.Param{
+		{Key: swapTypeParam, Value: guestSwapFile},
+		{Key: swapSizeParam, Value: "128"},
+	}
+
+	assert.Equal(expected, swap.kernelParams())
+}
+
+func TestGetGuestSwapKernelParams(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	runtimeConfig := oci.RuntimeConfig{
+		HypervisorConfig: vc.HypervisorConfig{
+			DefaultMemSz: 1024,
+		},
+	}
+
+	spec := newTestSwapSpec(uint64Ptr(512*testMiB), uint64Ptr(math.MaxUint64), nil)
+
+	// disabled
+	runtimeOptions = runtime{}
+	params, err := getGuestSwapKernelParams(spec, runtimeConfig)
+	assert.NoError(err)
+	assert.Empty(params)
+
+	runtimeOptions.EnableGuestSwap = true
+	runtimeOptions.GuestSwapType = guestSwapFile
+
+	params, err = getGuestSwapKernelParams(spec, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal([]vc.Param{
+		{Key: swapTypeParam, Value: guestSwapFile},
+		{Key: swapSizeParam, Value: "512"},
+	}, params)
+
+	// no memory limit: use the VM default
+	spec = newTestSwapSpec(nil, uint64Ptr(math.MaxUint64), nil)
+	params, err = getGuestSwapKernelParams(spec, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal([]vc.Param{
+		{Key: swapTypeParam, Value: guestSwapFile},
+		{Key: swapSizeParam, Value: "1024"},
+	}, params)
+
+	spec = newTestSwapSpec(nil, nil, uint64Ptr(200))
+	_, err = getGuestSwapKernelParams(spec, runtimeConfig)
+	assert.Error(err)
+}
+
+func TestRuntimeValidateGuestSwapType(t *testing.T) {
+	assert := assert.New(t)
+
+	r := runtime{}
+	assert.Equal(defaultGuestSwapType, r.guestSwapType())
+	assert.NoError(r.validate())
+
+	for _, swapType := range []string{guestSwapZram, guestSwapFile} {
+		r.GuestSwapType = swapType
+		assert.Equal(swapType, r.guestSwapType())
+		assert.NoError(r.validate())
+	}
+
+	r.GuestSwapType = "floppy"
+	assert.Error(r.validate())
+}
+
+func TestMemoryCompressionKernelParams(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		mode        string
+		compressor  string
+		percent     uint32
+		expected    []vc.Param
+		expectError bool
+	}
+
+	data := []testData{
+		{"", "", 0, nil, false},
+		{"", "foo", 0, nil, true},
+		{"zram", "", 101, nil, true},
+		{"floppy", "", 0, nil, true},
+		{"zram", "", 0, []vc.Param{{Key: zramDevsParam, Value: "1"}, {Key: zramSizePercentParam, Value: "50"}}, false},
+		{"zram", "zstd", 25, []vc.Param{
+			{Key: zramDevsParam, Value: "1"},
+			{Key: zramSizePercentParam, Value: "25"},
+			{Key: zramCompressorParam, Value: "zstd"},
+		}, false},
+		{"zswap", "", 0, []vc.Param{{Key: zswapEnabledParam, Value: "1"}}, false},
+		{"zswap", "lz4", 20, []vc.Param{
+			{Key: zswapEnabledParam, Value: "1"},
+			{Key: zswapCompressorParam, Value: "lz4"},
+			{Key: zswapMaxPoolParam, Value: "20"},
+		}, false},
+	}
+
+	for _, d := range data {
+		params, err := memoryCompressionKernelParams(d.mode, d.compressor, d.percent)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expected, params, "%+v", d)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// teardownDir is the directory, below the state directory of the
+// daemon, holding a record for each pod whose deletion was deferred.
+const teardownDir = ".teardown"
+
+const (
+	defaultTeardownMaxRetries    = 5
+	defaultTeardownRetryInterval = 30 * time.Second
+)
+
+// States of a deferred deletion. Completed deletions are not recorded.
+const (
+	teardownPending = "pending"
+	teardownFailed  = "failed"
+)
+
+// deferredDelete describes how the daemon defers the deletion of pods.
+type deferredDelete struct {
+	Enable bool `toml:"enable"`
+
+	// MaxRetries is the number of attempts after which a deletion is
+	// given up.
+	MaxRetries uint32 `toml:"max_retries"`
+
+	// RetryInterval is the delay between two attempts.
+	RetryInterval string `toml:"retry_interval"`
+}
+
+func (d deferredDelete) maxRetries() uint32 {
+	if d.MaxRetries == 0 {
+		return defaultTeardownMaxRetries
+	}
+
+	return d.MaxRetries
+}
+
+func (d deferredDelete) retryInterval() time.Duration {
+	return parseTimeout(d.RetryInterval, defaultTeardownRetryInterval)
+}
+
+// validate checks the deferred deletion settings.
+func (d deferredDelete) validate() error {
+	if d.RetryInterval == "" {
+		return nil
+	}
+
+	if i, err := time.ParseDuration(d.RetryInterval); err != nil || i <= 0 {
+		return fmt.Errorf("Invalid deferred_delete retry_interval %q", d.RetryInterval)
+	}
+
+	return nil
+}
+
+// teardownRecord describes a deferred deletion.
+type teardownRecord struct {
+	ID string `json:"id"`
+
+	// Root and SocketDir are the instance directories of the delete
+	// command.
+	Root      string `json:"root"`
+	SocketDir string `json:"socketDir,omitempty"`
+
+	RequestedAt time.Time `json:"requestedAt"`
+	State       string    `json:"state"`
+	Attempts    uint32    `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// teardownQueue deletes pods in the background of the daemon.
+type teardownQueue struct {
+	dir    string
+	config deferredDelete
+
+	// lock serializes the deletions with the commands of the daemon.
+	lock sync.Locker
+
+	notify chan struct{}
+}
+
+// teardowns is the queue of the daemon, if it defers the deletion of
+// pods.
+var teardowns *teardownQueue
+
+func newTeardownQueue(stateDir string, config deferredDelete, lock sync.Locker) *teardownQueue {
+	return &teardownQueue{
+		dir:    filepath.Join(stateDir, teardownDir),
+		config: config,
+		lock:   lock,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *teardownQueue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *teardownQueue) load(id string) (teardownRecord, error) {
+	var rec teardownRecord
+
+	bytes, err := ioutil.ReadFile(q.path(id))
+	if err != nil {
+		return rec, err
+	}
+
+	if err := json.Unmarshal(bytes, &rec); err != nil {
+		return rec, fmt.Errorf("Invalid teardown record of pod %v: %v", id, err)
+	}
+
+	return rec, nil
+}
+
+func (q *teardownQueue) save(rec teardownRecord) error {
+	bytes, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(q.dir, podStateDirMode); err != nil {
+		return err
+	}
+
+	path := q.path(rec.ID)
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, bytes, podStateFileMode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (q *teardownQueue) remove(id string) error {
+	if err := os.Remove(q.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// records returns the deferred deletions.
+func (q *teardownQueue) records() ([]teardownRecord, error) {
+	entries, err := ioutil.ReadDir(q.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var recs []teardownRecord
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		rec, err := q.load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+
+		recs = append(recs, rec)
+	}
+
+	return recs, nil
+}
+
+// request defers the deletion of a pod sandbox. The deletion of other
+// containers, which does not shut a VM down, is not deferred. Requesting
+// the deletion of a pod whose deletion failed retries it.
+func (q *teardownQueue) request(ctx context.Context, containerID string, force bool) error {
+	status, _, err := getContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+
+	if status.ID == "" {
+		return delete(ctx, containerID, force)
+	}
+
+	containerType, err := oci.GetContainerType(status.Annotations)
+	if err != nil {
+		return err
+	}
+
+	if containerType != vc.PodSandbox {
+		return delete(ctx, containerID, force)
+	}
+
+	if oci.StateToOCIState(status.State) == oci.StateRunning && !force {
+		return fmt.Errorf("Container still running, should be stopped")
+	}
+
+	rec, err := q.load(status.ID)
+	if err == nil && rec.State == teardownPending {
+		return nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	now := timeNow()
+
+	rec = teardownRecord{
+		ID:          status.ID,
+		Root:        runtimeStateDir,
+		SocketDir:   agentSocketDir,
+		RequestedAt: now,
+		State:       teardownPending,
+		NextAttempt: now,
+	}
+
+	if err := q.save(rec); err != nil {
+		return err
+	}
+
+	ccLog.WithField("pod", status.ID).Info("Deletion of the pod deferred")
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// teardown deletes a pod in the instance directories of its request.
+func (q *teardownQueue) teardown(rec teardownRecord) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedAgentSocketDir := agentSocketDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	runtimeStateDir = rec.Root
+	agentSocketDir = rec.SocketDir
+
+	ctx, cancel := withTimeout(context.Background(), runtimeOptions.Timeouts.delete())
+	defer cancel()
+
+	if err := delete(ctx, rec.ID, true); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// process attempts the pending deletions which are due.
+func (q *teardownQueue) process() error {
+	recs, err := q.records()
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		if rec.State != teardownPending || timeNow().Before(rec.NextAttempt) {
+			continue
+		}
+
+		log := ccLog.WithField("pod", rec.ID)
+
+		err := q.teardown(rec)
+		if err == nil {
+			log.WithField("teardown", "complete").Infof("Deferred deletion of the pod completed after %v",
+				timeNow().Sub(rec.RequestedAt))
+
+			if err := q.remove(rec.ID); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		rec.Attempts++
+		rec.LastError = err.Error()
+		rec.NextAttempt = timeNow().Add(q.config.retryInterval())
+
+		if rec.Attempts >= q.config.maxRetries() {
+			rec.State = teardownFailed
+			log.WithField("teardown", teardownFailed).Errorf("Deferred deletion of the pod failed after %d attempts: %v",
+				rec.Attempts, err)
+		} else {
+			log.Warnf("Deferred deletion of the pod failed, retrying in %v: %v", q.config.retryInterval(), err)
+		}
+
+		if err := q.save(rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run processes the deletions as they are requested and retries the
+// failed ones, until stop is closed.
+func (q *teardownQueue) run(stop <-chan struct{}) {
+	for {
+		if err := q.process(); err != nil {
+			ccLog.Errorf("Unable to process the deferred deletions: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-q.notify:
+		case <-time.After(q.config.retryInterval()):
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTeardownTest(t *testing.T, now *time.Time, state vc.State) (*teardownQueue, func()) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "teardown-")
+	assert.NoError(err)
+
+	savedRuntimeStateDir := runtimeStateDir
+	savedTimeNow := timeNow
+
+	runtimeStateDir = dir
+	timeNow = func() time.Time { return *now }
+
+	configPath := testConfigSetup(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testPodID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodSandbox),
+							oci.ConfigPathKey:    configPath,
+						},
+						State: state,
+					},
+				},
+			},
+		}, nil
+	}
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	q := newTeardownQueue(dir, deferredDelete{
+		Enable:        true,
+		MaxRetries:    2,
+		RetryInterval: "1m",
+	}, &sync.Mutex{})
+
+	return q, func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.StopPodFunc = nil
+		testingImpl.DeletePodFunc = nil
+		runtimeStateDir = savedRuntimeStateDir
+		timeNow = savedTimeNow
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDeferredDeleteConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	d := deferredDelete{}
+	assert.NoError(d.validate())
+	assert.Equal(uint32(defaultTeardownMaxRetries), d.maxRetries())
+	assert.Equal(defaultTeardownRetryInterval, d.retryInterval())
+
+	d = deferredDelete{MaxRetries: 3, RetryInterval: "10s"}
+	assert.NoError(d.validate())
+	assert.Equal(uint32(3), d.maxRetries())
+	assert.Equal(10*time.Second, d.retryInterval())
+
+	for _, interval := range []string{"foo", "0s", "-1s"} {
+		d = deferredDelete{RetryInterval: interval}
+		assert.Error(d.validate(), interval)
+	}
+}
+
+func TestTeardownRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	q, cleanup := setupTeardownTest(t, &now, vc.State{State: vc.StateReady})
+	defer cleanup()
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		t.Fatal("the deletion of the pod should be deferred")
+		return nil, nil
+	}
+
+	assert.NoError(q.request(context.Background(), testPodID, false))
+
+	rec, err := q.load(testPodID)
+	assert.NoError(err)
+	assert.Equal(teardownPending, rec.State)
+	assert.Equal(runtimeStateDir, rec.Root)
+	assert.Equal(now, rec.RequestedAt)
+	assert.Equal(now, rec.NextAttempt)
+
+	// a pending deletion is not requested again
+	now = now.Add(time.Second)
+	assert.NoError(q.request(context.Background(), testPodID, false))
+
+	rec, err = q.load(testPodID)
+	assert.NoError(err)
+	assert.Equal(now.Add(-time.Second), rec.RequestedAt)
+
+	// unknown containers are deleted synchronously
+	err = q.request(context.Background(), "unknown", false)
+	assert.Error(err)
+	assert.True(isNotFound(err))
+}
+
+func TestTeardownRequestRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	q, cleanup := setupTeardownTest(t, &now, vc.State{State: vc.StateRunning})
+	defer cleanup()
+
+	assert.Error(q.request(context.Background(), testPodID, false))
+
+	_, err := q.load(testPodID)
+	assert.True(os.IsNotExist(err))
+
+	assert.NoError(q.request(context.Background(), testPodID, true))
+
+	rec, err := q.load(testPodID)
+	assert.NoError(err)
+	assert.Equal(teardownPending, rec.State)
+}
+
+func TestTeardownProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	q, cleanup := setupTeardownTest(t, &now, vc.State{State: vc.StateReady})
+	defer cleanup()
+
+	var deleted []string
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		deleted = append(deleted, podID)
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	assert.NoError(q.request(context.Background(), testPodID, false))
+	assert.NoError(q.process())
+
+	assert.Equal([]string{testPodID}, deleted)
+
+	recs, err := q.records()
+	assert.NoError(err)
+	assert.Empty(recs)
+}
+
+func TestTeardownProcessRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	q, cleanup := setupTeardownTest(t, &now, vc.State{State: vc.StateReady})
+	defer cleanup()
+
+	attempts := 0
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		attempts++
+		return nil, errors.New("delete failed")
+	}
+
+	assert.NoError(q.request(context.Background(), testPodID, false))
+	assert.NoError(q.process())
+
+	rec, err := q.load(testPodID)
+	assert.NoError(err)
+	assert.Equal(teardownPending, rec.State)
+	assert.Equal(uint32(1), rec.Attempts)
+	assert.Equal(now.Add(time.Minute), rec.NextAttempt)
+	assert.Contains(rec.LastError, "delete failed")
+
+	// not retried before the retry interval
+	assert.NoError(q.process())
+	assert.Equal(1, attempts)
+
+	now = now.Add(time.Minute)
+	assert.NoError(q.process())
+	assert.Equal(2, attempts)
+
+	rec, err = q.load(testPodID)
+	assert.NoError(err)
+	assert.Equal(teardownFailed, rec.State)
+	assert.Equal(uint32(2), rec.Attempts)
+
+	// a failed deletion is given up
+	now = now.Add(time.Hour)
+	assert.NoError(q.process())
+	assert.Equal(2, attempts)
+
+	// until it is requested again
+	assert.NoError(q.request(context.Background(), testPodID, false))
+
+	rec, err = q.load(testPodID)
+	assert.NoError(err)
+	assert.Equal(teardownPending, rec.State)
+	assert.Equal(uint32(0), rec.Attempts)
+}
+
+func TestTeardownRun(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+	q, cleanup := setupTeardownTest(t, &now, vc.State{State: vc.StateReady})
+	defer cleanup()
+
+	deleted := make(chan string, 1)
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		deleted <- podID
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		q.run(stop)
+		close(done)
+	}()
+
+	assert.NoError(q.request(context.Background(), testPodID, false))
+
+	select {
+	case id := <-deleted:
+		assert.Equal(testPodID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pod was not deleted")
+	}
+
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queue did not stop")
+	}
+}
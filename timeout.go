@@ -0,0 +1,194 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// The default timeouts are long enough for a VM to boot on a
+	// loaded host.
+	defaultCreateTimeout = 5 * time.Minute
+	defaultStartTimeout  = 2 * time.Minute
+	defaultDeleteTimeout = 2 * time.Minute
+)
+
+// cancelSignals are the signals interrupting the current command, rather
+// than killing the runtime, so that it can roll back what it did.
+var cancelSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// killHypervisor kills the hypervisor of the specified pod, if it runs.
+// It is a variable rather than a function to allow tests to modify it.
+var killHypervisor = func(vmID string) error {
+	pid, err := findHypervisorPID(vmID)
+	if err != nil || pid == 0 {
+		return err
+	}
+
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// operationTimeouts limits how long the operations on containers may
+// take. Hung hypervisors or agents then make the operations fail rather
+// than block their caller forever. A timeout of "0" disables it.
+type operationTimeouts struct {
+	Create string `toml:"create"`
+	Start  string `toml:"start"`
+	Delete string `toml:"delete"`
+}
+
+// parseTimeout returns the duration of the specified timeout setting.
+func parseTimeout(timeout string, defaultTimeout time.Duration) time.Duration {
+	if timeout == "" {
+		return defaultTimeout
+	}
+
+	// checked by validate()
+	d, _ := time.ParseDuration(timeout)
+	return d
+}
+
+func (t operationTimeouts) create() time.Duration {
+	return parseTimeout(t.Create, defaultCreateTimeout)
+}
+
+func (t operationTimeouts) start() time.Duration {
+	return parseTimeout(t.Start, defaultStartTimeout)
+}
+
+func (t operationTimeouts) delete() time.Duration {
+	return parseTimeout(t.Delete, defaultDeleteTimeout)
+}
+
+// validate checks the timeout settings.
+func (t operationTimeouts) validate() error {
+	for option, timeout := range map[string]string{
+		"create": t.Create,
+		"start":  t.Start,
+		"delete": t.Delete,
+	} {
+		if timeout == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			return fmt.Errorf("Invalid %s timeout %q", option, timeout)
+		}
+	}
+
+	return nil
+}
+
+// interruptedError is returned when an operation times out or is
+// cancelled.
+type interruptedError struct {
+	operation string
+	err       error
+}
+
+func (e interruptedError) Error() string {
+	if e.err == context.DeadlineExceeded {
+		return fmt.Sprintf("Timed out while trying to %s", e.operation)
+	}
+
+	return fmt.Sprintf("Interrupted while trying to %s", e.operation)
+}
+
+func isInterrupted(err error) bool {
+	_, ok := err.(interruptedError)
+	return ok
+}
+
+// withTimeout returns a context derived from ctx which is done after
+// timeout, unless it is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// commandContext returns the context of a command run from the
+// command-line: it is done after timeout, unless it is zero, or when the
+// runtime receives one of the cancelSignals.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := withTimeout(context.Background(), timeout)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, cancelSignals...)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			ccLog.Warnf("Received %v, cancelling", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigCh)
+		cancel()
+	}
+}
+
+// vcCalls tracks the virtcontainers calls run by vcCall, including those
+// it gave up on.
+var vcCalls sync.WaitGroup
+
+// vcCall runs fn, a virtcontainers call, returning an interruptedError
+// if ctx is done first. As virtcontainers calls cannot be interrupted,
+// fn then keeps running in the background: the caller must roll back
+// what fn may have done, and the processes running several commands
+// must wait for fn with waitVCCalls before running the next one.
+func vcCall(ctx context.Context, operation string, fn func() error) error {
+	defer timer.record(operation, timeNow())
+
+	if err := ctx.Err(); err != nil {
+		return interruptedError{operation: operation, err: err}
+	}
+
+	errCh := make(chan error, 1)
+
+	vcCalls.Add(1)
+	go func() {
+		defer vcCalls.Done()
+		errCh <- fn()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		ccLog.Warnf("Gave up trying to %s: %v", operation, ctx.Err())
+		return interruptedError{operation: operation, err: ctx.Err()}
+	}
+}
+
+// waitVCCalls waits for the virtcontainers calls vcCall gave up on to
+// return. They still modify the state of their pod, and use the settings
+// of the command which started them.
+func waitVCCalls() {
+	vcCalls.Wait()
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	var timeouts operationTimeouts
+
+	assert.NoError(timeouts.validate())
+	assert.Equal(defaultCreateTimeout, timeouts.create())
+	assert.Equal(defaultStartTimeout, timeouts.start())
+	assert.Equal(defaultDeleteTimeout, timeouts.delete())
+
+	timeouts = operationTimeouts{Create: "90s", Start: "0", Delete: "1m"}
+
+	assert.NoError(timeouts.validate())
+	assert.Equal(90*time.Second, timeouts.create())
+	assert.Equal(time.Duration(0), timeouts.start())
+	assert.Equal(time.Minute, timeouts.delete())
+
+	for _, timeouts := range []operationTimeouts{
+		{Create: "forever"},
+		{Start: "10"},
+		{Delete: "-1s"},
+	} {
+		assert.Error(timeouts.validate(), "%+v", timeouts)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := withTimeout(context.Background(), 0)
+	_, ok := ctx.Deadline()
+	assert.False(ok)
+	cancel()
+	assert.Equal(context.Canceled, ctx.Err())
+
+	ctx, cancel = withTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.True(ok)
+}
+
+func TestVCCall(t *testing.T) {
+	assert := assert.New(t)
+
+	err := vcCall(context.Background(), "create pod", func() error {
+		return nil
+	})
+	assert.NoError(err)
+
+	failure := errors.New("failure")
+
+	err = vcCall(context.Background(), "create pod", func() error {
+		return failure
+	})
+	assert.Equal(failure, err)
+
+	// context already done: the call is not made
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err = vcCall(ctx, "create pod", func() error {
+		called = true
+		return nil
+	})
+	assert.True(isInterrupted(err))
+	assert.Equal("Interrupted while trying to create pod", err.Error())
+	assert.False(called)
+
+	// hung call
+	hung := make(chan struct{})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = vcCall(ctx, "start pod", func() error {
+		<-hung
+		return nil
+	})
+	assert.True(isInterrupted(err))
+	assert.Equal("Timed out while trying to start pod", err.Error())
+
+	// the abandoned call is waited for
+	waited := make(chan struct{})
+	go func() {
+		waitVCCalls()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("waitVCCalls returned before the abandoned call")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(hung)
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitVCCalls did not return after the abandoned call")
+	}
+}
+
+func TestCommandContextSignal(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	assert.NoError(syscall.Kill(os.Getpid(), syscall.SIGINT))
+
+	select {
+	case <-ctx.Done():
+		assert.Equal(context.Canceled, ctx.Err())
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGINT did not cancel the command context")
+	}
+}
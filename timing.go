@@ -0,0 +1,225 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const (
+	defaultSlowCommandThreshold = 30 * time.Second
+	defaultSlowPhaseThreshold   = 10 * time.Second
+)
+
+// timedCommands are the commands whose execution is timed. Commands
+// waiting for the workload, like exec or run, or running until stopped,
+// like cc-daemon, are not.
+var timedCommands = []string{
+	"cc-health",
+	"cc-idle-pause",
+	"cc-restart",
+	"cc-snapshot",
+	"create",
+	"delete",
+	"kill",
+	"list",
+	"pause",
+	"resume",
+	"start",
+	"state",
+	"update",
+}
+
+// slowLog describes when commands are logged as slow. A threshold of
+// "0" disables the logging.
+type slowLog struct {
+	// Threshold applies to the whole command.
+	Threshold string `toml:"threshold"`
+
+	// PhaseThreshold applies to each phase of a command.
+	PhaseThreshold string `toml:"phase_threshold"`
+
+	// Commands overrides Threshold for the specified commands.
+	Commands map[string]string `toml:"commands"`
+}
+
+func (s slowLog) threshold(command string) time.Duration {
+	if threshold, ok := s.Commands[command]; ok {
+		return parseTimeout(threshold, defaultSlowCommandThreshold)
+	}
+
+	return parseTimeout(s.Threshold, defaultSlowCommandThreshold)
+}
+
+func (s slowLog) phaseThreshold() time.Duration {
+	return parseTimeout(s.PhaseThreshold, defaultSlowPhaseThreshold)
+}
+
+// validate checks the slow command settings.
+func (s slowLog) validate() error {
+	thresholds := map[string]string{
+		"threshold":       s.Threshold,
+		"phase_threshold": s.PhaseThreshold,
+	}
+
+	for command, threshold := range s.Commands {
+		if !isTimedCommand(command) {
+			return fmt.Errorf("Invalid slow_log command %q: its execution is not timed", command)
+		}
+
+		thresholds["commands."+command] = threshold
+	}
+
+	for option, threshold := range thresholds {
+		if threshold == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(threshold)
+		if err != nil || d < 0 {
+			return fmt.Errorf("Invalid slow_log %s %q", option, threshold)
+		}
+	}
+
+	return nil
+}
+
+func isTimedCommand(command string) bool {
+	for _, c := range timedCommands {
+		if c == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// phaseTiming is the wall time of a phase of a command.
+type phaseTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// commandTimer records the wall time of a command and of its phases.
+type commandTimer struct {
+	command string
+	start   time.Time
+	phases  []phaseTiming
+}
+
+// timer is the timer of the current command, if it is timed.
+var timer *commandTimer
+
+// record records that the specified phase of the command, begun at
+// start, completed.
+func (t *commandTimer) record(phase string, start time.Time) {
+	if t == nil {
+		return
+	}
+
+	t.phases = append(t.phases, phaseTiming{
+		name:     phase,
+		duration: timeNow().Sub(start),
+	})
+}
+
+// finish logs the wall time of the command, at warning level for the
+// command and the phases slower than the thresholds of config.
+func (t *commandTimer) finish(config slowLog, err error) {
+	elapsed := timeNow().Sub(t.start)
+
+	var phases []string
+	for _, p := range t.phases {
+		phases = append(phases, fmt.Sprintf("%s=%v", p.name, p.duration))
+	}
+
+	log := ccLog.WithFields(logrus.Fields{
+		"command":  t.command,
+		"duration": elapsed.String(),
+		"phases":   strings.Join(phases, ", "),
+	})
+
+	if err != nil {
+		log = log.WithField("error", err)
+	}
+
+	log.Debug("Command completed")
+
+	if threshold := config.threshold(t.command); threshold != 0 && elapsed > threshold {
+		log.Warnf("Slow command: %s took %v (threshold %v)", t.command, elapsed, threshold)
+	}
+
+	threshold := config.phaseThreshold()
+	if threshold == 0 {
+		return
+	}
+
+	for _, p := range t.phases {
+		if p.duration > threshold {
+			log.WithField("phase", p.name).Warnf("Slow phase of command %s: %s took %v (threshold %v)",
+				t.command, p.name, p.duration, threshold)
+		}
+	}
+}
+
+// timePhase runs fn, a phase of the current command, recording its
+// wall time if the command is timed.
+func timePhase(phase string, fn func() error) error {
+	defer timer.record(phase, timeNow())
+
+	return fn()
+}
+
+// timeCommands returns commands, their execution timed if they are
+// timedCommands.
+func timeCommands(commands []cli.Command) []cli.Command {
+	timed := make([]cli.Command, len(commands))
+
+	for i, c := range commands {
+		timed[i] = c
+
+		action, ok := c.Action.(func(*cli.Context) error)
+		if !ok || !isTimedCommand(c.Name) {
+			continue
+		}
+
+		command := c.Name
+
+		timed[i].Action = func(context *cli.Context) error {
+			savedTimer := timer
+			timer = &commandTimer{
+				command: command,
+				start:   timeNow(),
+			}
+
+			defer func() {
+				timer = savedTimer
+			}()
+
+			err := action(context)
+
+			timer.finish(runtimeOptions.SlowLog, err)
+
+			return err
+		}
+	}
+
+	return timed
+}
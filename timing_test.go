@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestSlowLogConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	s := slowLog{}
+	assert.NoError(s.validate())
+	assert.Equal(defaultSlowCommandThreshold, s.threshold("create"))
+	assert.Equal(defaultSlowPhaseThreshold, s.phaseThreshold())
+
+	s = slowLog{
+		Threshold:      "5s",
+		PhaseThreshold: "0",
+		Commands:       map[string]string{"create": "1m"},
+	}
+	assert.NoError(s.validate())
+	assert.Equal(5*time.Second, s.threshold("start"))
+	assert.Equal(time.Minute, s.threshold("create"))
+	assert.Equal(time.Duration(0), s.phaseThreshold())
+
+	for _, s := range []slowLog{
+		{Threshold: "foo"},
+		{PhaseThreshold: "-1s"},
+		{Commands: map[string]string{"create": "foo"}},
+		{Commands: map[string]string{"exec": "1s"}},
+	} {
+		assert.Error(s.validate(), "%+v", s)
+	}
+}
+
+func TestTimeCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(10000, 0).UTC()
+
+	savedTimeNow := timeNow
+	savedLogOutput := ccLog.Out
+	savedLogLevel := ccLog.Level
+	savedSlowLog := runtimeOptions.SlowLog
+
+	defer func() {
+		timeNow = savedTimeNow
+		ccLog.Out = savedLogOutput
+		ccLog.Level = savedLogLevel
+		runtimeOptions.SlowLog = savedSlowLog
+	}()
+
+	timeNow = func() time.Time { return now }
+
+	buf := &bytes.Buffer{}
+	ccLog.Out = buf
+	ccLog.Level = logrus.DebugLevel
+
+	runtimeOptions.SlowLog = slowLog{
+		Threshold:      "10s",
+		PhaseThreshold: "3s",
+	}
+
+	action := func(context *cli.Context) error {
+		assert.NotNil(timer)
+
+		assert.NoError(timePhase("fast phase", func() error {
+			now = now.Add(time.Second)
+			return nil
+		}))
+
+		err := timePhase("slow phase", func() error {
+			now = now.Add(5 * time.Second)
+			return errors.New("phase failed")
+		})
+		assert.Error(err)
+
+		now = now.Add(5 * time.Second)
+
+		return err
+	}
+
+	commands := timeCommands([]cli.Command{
+		{Name: "create", Action: action},
+	})
+
+	ctx := cli.NewContext(&cli.App{}, flag.NewFlagSet("", 0), nil)
+
+	err := commands[0].Action.(func(*cli.Context) error)(ctx)
+	assert.Error(err)
+	assert.Nil(timer)
+
+	log := buf.String()
+	assert.Contains(log, "Command completed")
+	assert.Contains(log, "fast phase=1s, slow phase=5s")
+	assert.Contains(log, "Slow command: create took 11s (threshold 10s)")
+	assert.Contains(log, "Slow phase of command create: slow phase took 5s (threshold 3s)")
+	assert.NotContains(log, "Slow phase of command create: fast phase")
+
+	// phases of commands which are not timed are not recorded
+	buf.Reset()
+	assert.NoError(timePhase("untimed", func() error { return nil }))
+	assert.Empty(buf.String())
+
+	// thresholds of "0" disable the warnings
+	buf.Reset()
+	runtimeOptions.SlowLog = slowLog{
+		Threshold:      "0",
+		PhaseThreshold: "0",
+	}
+
+	assert.Error(commands[0].Action.(func(*cli.Context) error)(ctx))
+
+	log = buf.String()
+	assert.Contains(log, "Command completed")
+	assert.NotContains(log, "Slow")
+}
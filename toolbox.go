@@ -0,0 +1,303 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// toolboxPath is the directory of a container where the toolbox
+// binaries are installed.
+const toolboxPath = "/.cc-toolbox"
+
+// toolboxesDir is the directory of the runtime state directory holding
+// the host directories of the toolbox mounts.
+const toolboxesDir = ".toolboxes"
+
+// defaultExecPath is the search path of processes whose environment
+// has no PATH.
+const defaultExecPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// isStaticExecutable returns true if p is an executable ELF file without
+// a program interpreter, which runs in containers without a C library.
+func isStaticExecutable(p string) (bool, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return false, err
+	}
+
+	if !fi.Mode().IsRegular() || fi.Mode().Perm()&0111 == 0 {
+		return false, nil
+	}
+
+	f, err := elf.Open(p)
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return false, nil
+		}
+	}
+
+	return f.Type == elf.ET_EXEC || f.Type == elf.ET_DYN, nil
+}
+
+// toolboxBinaries returns the names of the static executables of dir the
+// policy allows. Other files are ignored with a warning.
+func toolboxBinaries(dir string, p *policy) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, fi := range files {
+		name := fi.Name()
+
+		static, err := isStaticExecutable(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		if !static {
+			ccLog.Warnf("Ignoring toolbox file %v: not a statically linked executable", name)
+			continue
+		}
+
+		if p.allowToolbox(name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// toolboxHostPath returns the host directory shared with a container at
+// toolboxPath.
+func toolboxHostPath(containerID string) string {
+	return filepath.Join(runtimeStateDir, toolboxesDir, containerID)
+}
+
+// addToolboxMount returns the specification of a container with a read
+// only bind mount of an empty host directory at toolboxPath, into which
+// exec installs the toolbox. The container can only be given the
+// toolbox this way: virtcontainers shares the mounts of a container
+// when it starts, and the root filesystem of the container is not
+// modified. Nothing is added if the toolbox is not configured or the
+// policy denies it.
+func addToolboxMount(ociSpec oci.CompatOCISpec, containerID string, p *policy) (oci.CompatOCISpec, error) {
+	if runtimeOptions.ToolboxDir == "" || p.checkToolbox() != nil {
+		return ociSpec, nil
+	}
+
+	for _, m := range ociSpec.Mounts {
+		if filepath.Clean(m.Destination) == toolboxPath {
+			return ociSpec, fmt.Errorf("Container path %v is reserved for the toolbox", toolboxPath)
+		}
+	}
+
+	dir := toolboxHostPath(containerID)
+
+	if err := os.MkdirAll(dir, podStateDirMode); err != nil {
+		return ociSpec, err
+	}
+
+	mounts := make([]specs.Mount, len(ociSpec.Mounts), len(ociSpec.Mounts)+1)
+	copy(mounts, ociSpec.Mounts)
+
+	ociSpec.Mounts = append(mounts, specs.Mount{
+		Destination: toolboxPath,
+		Type:        "bind",
+		Source:      dir,
+		Options:     []string{"bind", "ro"},
+	})
+
+	return ociSpec, nil
+}
+
+// removeToolboxMount removes the host directory of the toolbox of a
+// container.
+func removeToolboxMount(containerID string) error {
+	dir := toolboxHostPath(containerID)
+
+	if !strings.HasPrefix(dir, filepath.Join(runtimeStateDir, toolboxesDir)+"/") {
+		// not below the toolboxes directory: an invalid ID
+		return nil
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// installToolbox copies the toolbox binaries of dir into the host
+// directory of the toolbox mount of the container. It returns the names
+// of the binaries installed.
+func installToolbox(containerID, dir string, p *policy) ([]string, error) {
+	names, err := toolboxBinaries(dir, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No toolbox binaries allowed in %v", dir)
+	}
+
+	hostDir := toolboxHostPath(containerID)
+
+	if !fileExists(hostDir) {
+		return nil, fmt.Errorf("Container %v was created without the toolbox mount", containerID)
+	}
+
+	for _, name := range names {
+		if err := installToolboxBinary(hostDir, filepath.Join(dir, name), name); err != nil {
+			return nil, err
+		}
+	}
+
+	ccLog.WithField("container", containerID).Infof("Installed toolbox %v", strings.Join(names, ", "))
+
+	return names, nil
+}
+
+// installToolboxBinary copies the binary src to name in the toolbox
+// directory dir. Binaries of a previous install may be running: they
+// are replaced rather than written to.
+func installToolboxBinary(dir, src, name string) error {
+	in, err := os.OpenFile(src, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := filepath.Join(dir, name+".tmp")
+
+	os.Remove(tmp)
+
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0555)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(dir, name))
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+	}
+
+	return err
+}
+
+// removeToolbox removes the binaries of the toolbox of the container,
+// unless another exec session using them is running. The mount itself
+// stays until the container is deleted.
+func removeToolbox(podID, containerID string) error {
+	sessions, err := listExecSessions(podID, containerID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if s.Toolbox && s.running() {
+			return nil
+		}
+	}
+
+	dir := toolboxHostPath(containerID)
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setupExecToolbox installs the toolbox in the container for the exec
+// params, and adds it to the search path of the process.
+func setupExecToolbox(containerID string, p *policy, params *execParams) error {
+	if err := p.checkToolbox(); err != nil {
+		return err
+	}
+
+	if runtimeOptions.ToolboxDir == "" {
+		return fmt.Errorf("No toolbox: the toolbox_dir of the configuration is not set")
+	}
+
+	if _, err := installToolbox(containerID, runtimeOptions.ToolboxDir, p); err != nil {
+		return fmt.Errorf("Unable to install the toolbox: %v", err)
+	}
+
+	params.ociProcess.Env = toolboxEnv(params.ociProcess.Env)
+
+	return nil
+}
+
+// toolboxEnv returns env with the toolbox directory appended to PATH, so
+// that the binaries of the container take precedence.
+func toolboxEnv(env []string) []string {
+	result := make([]string, 0, len(env)+1)
+	found := false
+
+	for _, e := range env {
+		if strings.HasPrefix(e, "PATH=") {
+			found = true
+
+			if e == "PATH=" {
+				e = "PATH=" + toolboxPath
+			} else {
+				e += ":" + toolboxPath
+			}
+		}
+
+		result = append(result, e)
+	}
+
+	if !found {
+		result = append(result, "PATH="+defaultExecPath+":"+toolboxPath)
+	}
+
+	return result
+}
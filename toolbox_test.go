@@ -0,0 +1,339 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestELF creates an executable ELF file, dynamically linked if
+// interp is true.
+func writeTestELF(t *testing.T, p string, interp bool) {
+	var b bytes.Buffer
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    64,
+		Phentsize: 56,
+	}
+
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	if interp {
+		header.Phoff = 64
+		header.Phnum = 1
+	}
+
+	assert.NoError(t, binary.Write(&b, binary.LittleEndian, header))
+
+	if interp {
+		assert.NoError(t, binary.Write(&b, binary.LittleEndian, elf.Prog64{Type: uint32(elf.PT_INTERP)}))
+	}
+
+	assert.NoError(t, ioutil.WriteFile(p, b.Bytes(), 0755))
+}
+
+// setupToolboxTest creates a toolbox directory with the static busybox
+// and strace binaries, and a container root filesystem. It returns the
+// temporary directory.
+func setupToolboxTest(t *testing.T) (string, func()) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "toolbox-")
+	assert.NoError(err)
+
+	toolbox := filepath.Join(dir, "toolbox")
+	assert.NoError(os.MkdirAll(toolbox, testDirMode))
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "rootfs"), testDirMode))
+
+	writeTestELF(t, filepath.Join(toolbox, "busybox"), false)
+	writeTestELF(t, filepath.Join(toolbox, "strace"), false)
+	writeTestELF(t, filepath.Join(toolbox, "gdb"), true)
+	assert.NoError(createFile(filepath.Join(toolbox, "README"), "tools"))
+
+	savedRuntimeOptions := runtimeOptions
+	savedRuntimeStateDir := runtimeStateDir
+
+	runtimeStateDir = filepath.Join(dir, "state")
+
+	return dir, func() {
+		runtimeOptions = savedRuntimeOptions
+		runtimeStateDir = savedRuntimeStateDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIsStaticExecutable(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, cleanup := setupToolboxTest(t)
+	defer cleanup()
+
+	toolbox := filepath.Join(dir, "toolbox")
+
+	static, err := isStaticExecutable(filepath.Join(toolbox, "busybox"))
+	assert.NoError(err)
+	assert.True(static)
+
+	static, err = isStaticExecutable(filepath.Join(toolbox, "gdb"))
+	assert.NoError(err)
+	assert.False(static)
+
+	static, err = isStaticExecutable(filepath.Join(toolbox, "README"))
+	assert.NoError(err)
+	assert.False(static)
+
+	static, err = isStaticExecutable(toolbox)
+	assert.NoError(err)
+	assert.False(static)
+
+	// not executable
+	assert.NoError(os.Chmod(filepath.Join(toolbox, "strace"), 0644))
+	static, err = isStaticExecutable(filepath.Join(toolbox, "strace"))
+	assert.NoError(err)
+	assert.False(static)
+
+	_, err = isStaticExecutable(filepath.Join(toolbox, "missing"))
+	assert.Error(err)
+}
+
+func TestToolboxBinaries(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, cleanup := setupToolboxTest(t)
+	defer cleanup()
+
+	toolbox := filepath.Join(dir, "toolbox")
+
+	names, err := toolboxBinaries(toolbox, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"busybox", "strace"}, names)
+
+	p := &policy{}
+	p.Toolbox.Allowed = []string{"strace"}
+
+	names, err = toolboxBinaries(toolbox, p)
+	assert.NoError(err)
+	assert.Equal([]string{"strace"}, names)
+
+	_, err = toolboxBinaries(filepath.Join(dir, "missing"), nil)
+	assert.Error(err)
+}
+
+func TestAddToolboxMount(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, cleanup := setupToolboxTest(t)
+	defer cleanup()
+
+	spec := oci.CompatOCISpec{}
+	spec.Mounts = []specs.Mount{{Destination: "/data", Type: "bind", Source: dir}}
+
+	// no toolbox configured
+	runtimeOptions = runtime{}
+
+	result, err := addToolboxMount(spec, testContainerID, nil)
+	assert.NoError(err)
+	assert.Equal(spec.Mounts, result.Mounts)
+
+	runtimeOptions.ToolboxDir = filepath.Join(dir, "toolbox")
+
+	// denied by the policy
+	p := &policy{}
+	p.Toolbox.Deny = true
+
+	result, err = addToolboxMount(spec, testContainerID, p)
+	assert.NoError(err)
+	assert.Equal(spec.Mounts, result.Mounts)
+
+	result, err = addToolboxMount(spec, testContainerID, nil)
+	assert.NoError(err)
+	assert.Len(spec.Mounts, 1)
+	assert.Equal(specs.Mount{
+		Destination: toolboxPath,
+		Type:        "bind",
+		Source:      toolboxHostPath(testContainerID),
+		Options:     []string{"bind", "ro"},
+	}, result.Mounts[1])
+	assert.True(fileExists(toolboxHostPath(testContainerID)))
+
+	assert.NoError(removeToolboxMount(testContainerID))
+	assert.False(fileExists(toolboxHostPath(testContainerID)))
+
+	// the path is already mounted
+	spec.Mounts = append(spec.Mounts, specs.Mount{Destination: toolboxPath + "/", Type: "bind", Source: dir})
+
+	_, err = addToolboxMount(spec, testContainerID, nil)
+	assert.Error(err)
+
+	// invalid ID
+	assert.NoError(removeToolboxMount(".."))
+	assert.True(fileExists(runtimeStateDir))
+}
+
+func TestInstallToolbox(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, cleanup := setupToolboxTest(t)
+	defer cleanup()
+
+	toolbox := filepath.Join(dir, "toolbox")
+	hostDir := toolboxHostPath(testContainerID)
+
+	// created without the toolbox mount
+	_, err := installToolbox(testContainerID, toolbox, nil)
+	assert.Error(err)
+
+	runtimeOptions.ToolboxDir = toolbox
+
+	_, err = addToolboxMount(oci.CompatOCISpec{}, testContainerID, nil)
+	assert.NoError(err)
+
+	names, err := installToolbox(testContainerID, toolbox, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"busybox", "strace"}, names)
+
+	fi, err := os.Stat(filepath.Join(hostDir, "busybox"))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0555), fi.Mode().Perm())
+
+	_, err = os.Stat(filepath.Join(hostDir, "gdb"))
+	assert.True(os.IsNotExist(err))
+
+	// the root filesystem is not modified
+	_, err = os.Stat(filepath.Join(dir, "rootfs", toolboxPath))
+	assert.True(os.IsNotExist(err))
+
+	// the binaries are replaced
+	assert.NoError(os.Chmod(filepath.Join(hostDir, "busybox"), 0755))
+	assert.NoError(createFile(filepath.Join(hostDir, "busybox"), "modified"))
+
+	_, err = installToolbox(testContainerID, toolbox, nil)
+	assert.NoError(err)
+
+	contents, err := getFileContents(filepath.Join(hostDir, "busybox"))
+	assert.NoError(err)
+	assert.NotEqual("modified", contents)
+
+	// no binaries allowed
+	p := &policy{}
+	p.Toolbox.Allowed = []string{"tcpdump"}
+
+	_, err = installToolbox(testContainerID, toolbox, p)
+	assert.Error(err)
+}
+
+func TestRemoveToolbox(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, cleanup := setupToolboxTest(t)
+	defer cleanup()
+
+	savedProcStartTime := procStartTime
+	defer func() {
+		procStartTime = savedProcStartTime
+	}()
+
+	running := map[int]uint64{100: 1000}
+	procStartTime = func(pid int) (uint64, error) {
+		start, ok := running[pid]
+		if !ok {
+			return 0, os.ErrNotExist
+		}
+
+		return start, nil
+	}
+
+	runtimeOptions.ToolboxDir = filepath.Join(dir, "toolbox")
+	hostDir := toolboxHostPath(testContainerID)
+
+	// no toolbox mount
+	assert.NoError(removeToolbox(testPodID, testContainerID))
+
+	_, err := addToolboxMount(oci.CompatOCISpec{}, testContainerID, nil)
+	assert.NoError(err)
+
+	_, err = installToolbox(testContainerID, runtimeOptions.ToolboxDir, nil)
+	assert.NoError(err)
+
+	// another process uses the toolbox
+	_, err = registerExecSession(testPodID, testContainerID, 100, []string{"strace", "-p", "1"}, true, true)
+	assert.NoError(err)
+
+	assert.NoError(removeToolbox(testPodID, testContainerID))
+
+	_, err = os.Stat(filepath.Join(hostDir, "strace"))
+	assert.NoError(err)
+
+	// the process exited: the binaries are removed, not the mount
+	running[100] = 1001
+
+	assert.NoError(removeToolbox(testPodID, testContainerID))
+
+	files, err := ioutil.ReadDir(hostDir)
+	assert.NoError(err)
+	assert.Empty(files)
+}
+
+func TestSetupExecToolbox(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, cleanup := setupToolboxTest(t)
+	defer cleanup()
+
+	params := execParams{
+		ociProcess: oci.CompatOCIProcess{Args: []string{"strace", "-p", "1"}},
+		toolbox:    true,
+	}
+
+	// no toolbox directory
+	runtimeOptions = runtime{}
+	assert.Error(setupExecToolbox(testContainerID, nil, &params))
+
+	runtimeOptions.ToolboxDir = filepath.Join(dir, "toolbox")
+
+	p := &policy{}
+	p.Toolbox.Deny = true
+	assert.Error(setupExecToolbox(testContainerID, p, &params))
+
+	_, err := addToolboxMount(oci.CompatOCISpec{}, testContainerID, nil)
+	assert.NoError(err)
+
+	assert.NoError(setupExecToolbox(testContainerID, nil, &params))
+	assert.Equal([]string{"PATH=" + defaultExecPath + ":" + toolboxPath}, params.ociProcess.Env)
+}
+
+func TestToolboxEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"PATH=" + defaultExecPath + ":" + toolboxPath}, toolboxEnv(nil))
+	assert.Equal([]string{"HOME=/", "PATH=/bin:" + toolboxPath}, toolboxEnv([]string{"HOME=/", "PATH=/bin"}))
+	assert.Equal([]string{"PATH=" + toolboxPath}, toolboxEnv([]string{"PATH="}))
+}
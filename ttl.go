@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// ttlAnnotation is the OCI annotation setting how long a pod may live,
+// as a duration such as "90m". The pod is deleted by "cc-health" once
+// it expires.
+const ttlAnnotation = ccAnnotationPrefix + "ttl"
+
+// healthEventExpired is emitted when a pod is deleted because its TTL
+// expired.
+const healthEventExpired = "expired"
+
+// getPodTTL returns the lifetime requested by the TTL annotation, or
+// zero if the pod may live forever.
+func getPodTTL(ociSpec oci.CompatOCISpec) (time.Duration, error) {
+	value, ok := ociSpec.Annotations[ttlAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("Invalid annotation %v: %q is not a positive duration", ttlAnnotation, value)
+	}
+
+	return ttl, nil
+}
+
+// setPodExpiry records in the pod state when the pod expires.
+func setPodExpiry(podID string, ttl time.Duration) error {
+	return updatePodState(podID, func(state *podState) error {
+		state.ExpiresAt = timeNow().Add(ttl)
+		return nil
+	})
+}
+
+// expirePods deletes the pods whose TTL expired and returns the events
+// this caused. A pod which cannot be deleted is retried on the next
+// run.
+func expirePods(podStatusList []vc.PodStatus) ([]healthEvent, error) {
+	var events []healthEvent
+
+	now := timeNow()
+
+	for _, podStatus := range podStatusList {
+		state, err := loadPodState(podStatus.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if state.ExpiresAt.IsZero() || now.Before(state.ExpiresAt) {
+			continue
+		}
+
+		event := healthEvent{
+			Type:  healthEventExpired,
+			PodID: podStatus.ID,
+			Time:  now,
+		}
+
+		ctx, cancel := withTimeout(context.Background(), runtimeOptions.Timeouts.delete())
+		err = delete(ctx, podStatus.ID, true)
+		cancel()
+
+		if err != nil {
+			event.Error = err.Error()
+		} else {
+			ccLog.WithField("pod", podStatus.ID).Infof("Deleted pod expired since %v", state.ExpiresAt)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPodTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	var ociSpec oci.CompatOCISpec
+
+	ttl, err := getPodTTL(ociSpec)
+	assert.NoError(err)
+	assert.Equal(time.Duration(0), ttl)
+
+	ociSpec.Annotations = map[string]string{ttlAnnotation: "90m"}
+	ttl, err = getPodTTL(ociSpec)
+	assert.NoError(err)
+	assert.Equal(90*time.Minute, ttl)
+
+	for _, value := range []string{"", "forever", "0s", "-1h"} {
+		ociSpec.Annotations[ttlAnnotation] = value
+		_, err = getPodTTL(ociSpec)
+		assert.Error(err, "%q", value)
+	}
+}
+
+func TestSetPodExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	var probeErr error
+	now := time.Unix(10000, 0).UTC()
+	defer setupHealthTest(t, now, &probeErr)()
+
+	assert.NoError(setPodExpiry(testPodID, time.Hour))
+
+	state, err := loadPodState(testPodID)
+	assert.NoError(err)
+	assert.Equal(now.Add(time.Hour), state.ExpiresAt)
+}
+
+func TestHealthCheckerRunExpirePods(t *testing.T) {
+	assert := assert.New(t)
+
+	var probeErr error
+	now := time.Unix(10000, 0).UTC()
+	defer setupHealthTest(t, now, &probeErr)()
+
+	configPath := testConfigSetup(t)
+
+	const livePodID = "live"
+
+	podStatus := func(id string) vc.PodStatus {
+		return vc.PodStatus{
+			ID:    id,
+			State: vc.State{State: vc.StateRunning},
+			ContainersStatus: []vc.ContainerStatus{
+				{
+					ID: id,
+					Annotations: map[string]string{
+						oci.ContainerTypeKey: string(vc.PodSandbox),
+						oci.ConfigPathKey:    configPath,
+					},
+					State: vc.State{State: vc.StateRunning},
+				},
+			},
+		}
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{podStatus(testPodID), podStatus(livePodID)}, nil
+	}
+
+	var deleted []string
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		deleted = append(deleted, podID)
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	defer func() {
+		testingImpl.StopPodFunc = nil
+		testingImpl.DeletePodFunc = nil
+	}()
+
+	assert.NoError(setPodExpiry(testPodID, -time.Second))
+	assert.NoError(setPodExpiry(livePodID, time.Hour))
+
+	h := healthChecker{timeout: time.Second, retries: 1}
+	buf := &bytes.Buffer{}
+
+	assert.NoError(h.run(buf))
+
+	assert.Equal([]string{testPodID}, deleted)
+
+	events := decodeHealthEvents(t, buf)
+	assert.Len(events, 1)
+	assert.Equal(healthEventExpired, events[0].Type)
+	assert.Equal(testPodID, events[0].PodID)
+	assert.Empty(events[0].Error)
+
+	// the health of the deleted pod is not checked
+	state, err := loadPodState(livePodID)
+	assert.NoError(err)
+	assert.NotNil(state.Health)
+
+	// a pod which cannot be deleted is reported, then retried
+	deleted = nil
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		return nil, errors.New("delete failed")
+	}
+
+	assert.NoError(setPodExpiry(testPodID, -time.Second))
+
+	events, err = expirePods([]vc.PodStatus{podStatus(testPodID)})
+	assert.NoError(err)
+	assert.Len(events, 1)
+	assert.Contains(events[0].Error, "delete failed")
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+)
+
+// undoStep is how to undo a step of an operation.
+type undoStep struct {
+	// what names what the step provisioned, for the logs.
+	what string
+	undo func() error
+}
+
+// undoLog records how to undo each step of an operation that succeeded,
+// so that the operation can be rolled back as a whole if a later step
+// fails.
+type undoLog struct {
+	steps []undoStep
+}
+
+// add records how to undo a step. Steps whose failure may leave partial
+// state behind are recorded before being run: their undo function must
+// then cope with what was not done.
+func (u *undoLog) add(what string, undo func() error) {
+	u.steps = append(u.steps, undoStep{what: what, undo: undo})
+}
+
+// rollback undoes the recorded steps, the most recent first. It carries
+// on after failures, which are logged rather than returned so as not to
+// hide the error that caused the rollback.
+func (u *undoLog) rollback() {
+	for i := len(u.steps) - 1; i >= 0; i-- {
+		step := u.steps[i]
+
+		if err := step.undo(); err != nil {
+			ccLog.Warnf("Unable to roll back %s: %v", step.what, err)
+		} else {
+			ccLog.Debugf("Rolled back %s", step.what)
+		}
+	}
+
+	u.steps = nil
+}
+
+// rollbackContext returns the context of the virtcontainers calls made
+// by a rollback. It does not derive from the context of the operation,
+// which may be why the operation is rolled back.
+func rollbackContext() (context.Context, context.CancelFunc) {
+	return withTimeout(context.Background(), runtimeOptions.Timeouts.delete())
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUndoLogRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	var undo undoLog
+	var undone []string
+
+	for _, what := range []string{"first", "second", "third"} {
+		what := what
+		undo.add(what, func() error {
+			undone = append(undone, what)
+
+			if what == "second" {
+				return errors.New("failed")
+			}
+
+			return nil
+		})
+	}
+
+	undo.rollback()
+
+	// Steps are undone most recent first, and failures do not stop
+	// the rollback.
+	assert.Equal([]string{"third", "second", "first"}, undone)
+
+	// A rolled back log is empty
+	undone = nil
+	undo.rollback()
+	assert.Empty(undone)
+}
+
+func TestUndoLogEmpty(t *testing.T) {
+	var undo undoLog
+
+	// nothing to do
+	undo.rollback()
+}
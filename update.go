@@ -0,0 +1,143 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+// updateInput is read for the resources when the resources file is "-".
+var updateInput io.Reader = os.Stdin
+
+var updateCLICommand = cli.Command{
+	Name:  "update",
+	Usage: "update container resource constraints",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container.`,
+	Description: `The update command changes the resource constraints of a container.
+
+   The resources of a pod using the static resource management mode cannot
+   change: updating them fails. The VM of other pods is not resized.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "resources, r",
+			Usage: `path to a JSON file of the linux resources of the OCI spec ("-" for stdin)`,
+		},
+		cli.Uint64Flag{
+			Name:  "memory",
+			Usage: "memory limit in bytes",
+		},
+		cli.Int64Flag{
+			Name:  "cpu-quota",
+			Usage: "CPU CFS quota in microseconds",
+		},
+		cli.Uint64Flag{
+			Name:  "cpu-period",
+			Usage: "CPU CFS period in microseconds",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		resources, err := updateResources(context)
+		if err != nil {
+			return err
+		}
+
+		return update(context.Args().First(), resources)
+	},
+}
+
+// updateResources returns the resources given by the resources file, if
+// any, overridden by the resource flags.
+func updateResources(context *cli.Context) (specs.LinuxResources, error) {
+	var resources specs.LinuxResources
+
+	switch path := context.String("resources"); path {
+	case "":
+	case "-":
+		if err := json.NewDecoder(updateInput).Decode(&resources); err != nil {
+			return specs.LinuxResources{}, err
+		}
+	default:
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return specs.LinuxResources{}, err
+		}
+
+		if err := json.Unmarshal(data, &resources); err != nil {
+			return specs.LinuxResources{}, err
+		}
+	}
+
+	if context.IsSet("memory") {
+		memory := context.Uint64("memory")
+		if resources.Memory == nil {
+			resources.Memory = &specs.LinuxMemory{}
+		}
+		resources.Memory.Limit = &memory
+	}
+
+	if context.IsSet("cpu-quota") || context.IsSet("cpu-period") {
+		if resources.CPU == nil {
+			resources.CPU = &specs.LinuxCPU{}
+		}
+
+		if context.IsSet("cpu-quota") {
+			quota := context.Int64("cpu-quota")
+			resources.CPU.Quota = &quota
+		}
+
+		if context.IsSet("cpu-period") {
+			period := context.Uint64("cpu-period")
+			resources.CPU.Period = &period
+		}
+	}
+
+	return resources, nil
+}
+
+func update(containerID string, resources specs.LinuxResources) error {
+	// Checks the MUST and MUST NOT from OCI runtime specification
+	_, podID, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+
+	if err := reapplyHostCPUSet(podID); err != nil {
+		return err
+	}
+
+	state, err := loadPodState(podID)
+	if err != nil {
+		return err
+	}
+
+	if state.StaticResources {
+		return unsupportedUpdateError{
+			podID:  podID,
+			reason: "the pod uses static resource management",
+		}
+	}
+
+	ccLog.WithField("container", containerID).Warn("Resources updated but the VM of the pod is not resized")
+
+	return nil
+}
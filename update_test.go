@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestUpdateResources(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "update-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	resourcesFile := filepath.Join(dir, "resources.json")
+	err = createFile(resourcesFile, `{"memory": {"limit": 1024}, "cpu": {"quota": 1000, "period": 2000}}`)
+	assert.NoError(err)
+
+	set := flag.NewFlagSet("", 0)
+	set.String("resources", "", "")
+	set.Uint64("memory", 0, "")
+	set.Int64("cpu-quota", 0, "")
+	set.Uint64("cpu-period", 0, "")
+	set.Parse([]string{"--resources", resourcesFile, "--cpu-quota", "3000", testContainerID})
+
+	resources, err := updateResources(cli.NewContext(cli.NewApp(), set, nil))
+	assert.NoError(err)
+	assert.Equal(uint64(1024), *resources.Memory.Limit)
+	assert.Equal(int64(3000), *resources.CPU.Quota)
+	assert.Equal(uint64(2000), *resources.CPU.Period)
+
+	savedUpdateInput := updateInput
+	defer func() {
+		updateInput = savedUpdateInput
+	}()
+
+	updateInput = strings.NewReader(`{"memory": {"limit": 4096}}`)
+
+	set = flag.NewFlagSet("", 0)
+	set.String("resources", "", "")
+	set.Parse([]string{"--resources", "-", testContainerID})
+
+	resources, err = updateResources(cli.NewContext(cli.NewApp(), set, nil))
+	assert.NoError(err)
+	assert.Equal(uint64(4096), *resources.Memory.Limit)
+	assert.Nil(resources.CPU)
+}
+
+func TestUpdateCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "update-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRuntimeStateDir := runtimeStateDir
+	defer func() {
+		runtimeStateDir = savedRuntimeStateDir
+	}()
+
+	runtimeStateDir = dir
+
+	state := vc.State{
+		State: vc.StateRunning,
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, state, state, map[string]string{}), nil
+	}
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	set := flag.NewFlagSet("", 0)
+	set.Parse([]string{testContainerID})
+
+	execCLICommandFunc(assert, updateCLICommand, set, false)
+
+	assert.NoError(setPodStaticResources(testPodID))
+
+	execCLICommandFunc(assert, updateCLICommand, set, true)
+
+	err = update(testContainerID, specs.LinuxResources{})
+	assert.True(isUnsupportedUpdate(err))
+}
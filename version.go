@@ -15,13 +15,43 @@
 package main
 
 import (
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
 
+// versionInfo describes the runtime version in JSON.
+type versionInfo struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Commit     string `json:"commit"`
+	OCIVersion string `json:"ociVersion"`
+}
+
+func getVersionInfo() versionInfo {
+	info := versionInfo{
+		Name:       name,
+		Version:    version,
+		Commit:     commit,
+		OCIVersion: specs.Version,
+	}
+
+	for _, field := range []*string{&info.Version, &info.Commit, &info.OCIVersion} {
+		if *field == "" {
+			*field = unknown
+		}
+	}
+
+	return info
+}
+
 var versionCLICommand = cli.Command{
 	Name:  "version",
 	Usage: "display version details",
 	Action: func(context *cli.Context) error {
+		if wantJSONOutput() {
+			return writeJSON(getVersionInfo())
+		}
+
 		cli.VersionPrinter(context)
 		return nil
 	},
@@ -0,0 +1,266 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// Prefixes of the kernel parameters the runtime adds for the guest.
+const (
+	// agentKernelParamPrefix is the prefix of the parameters meant for
+	// the guest agent, such as the swap, shared filesystem cache and
+	// OOM settings. hyperstart does not read them: they are only
+	// applied by a guest image handling them at boot.
+	agentKernelParamPrefix = "agent."
+
+	// sysctlKernelParamPrefix is the prefix of the sysctls set on the
+	// kernel command line, which only guest kernels from Linux 5.8
+	// apply.
+	sysctlKernelParamPrefix = "sysctl."
+)
+
+// kernelOptionParamPrefixes are the prefixes of the parameters of guest
+// kernel features, which the guest kernel applies itself if it has the
+// feature. The kernel check makes sure it does.
+var kernelOptionParamPrefixes = []string{"zram.", "zswap."}
+
+// runtimeHypervisorParams are the hypervisor parameters the runtime
+// reads back itself. virtcontainers does not pass any hypervisor
+// parameter to the hypervisor.
+var runtimeHypervisorParams = []string{hostCPUsParam}
+
+// Codes of the warnings reported when a container is created with a
+// degraded configuration.
+const (
+	warningKSMUnavailable       = "ksm-unavailable"
+	warningGuestConsole         = "guest-console-unavailable"
+	warningCorePattern          = "core-pattern"
+	warningNetworkFS            = "network-fs"
+	warningNetNSNoInterface     = "netns-no-interface"
+	warningSeccompNotEnforced   = "seccomp-not-enforced"
+	warningSysctlNotApplied     = "sysctl-not-applied"
+	warningDevicesNotCreated    = "devices-not-created"
+	warningOOMNotApplied        = "oom-not-applied"
+	warningKernelUnchecked      = "kernel-unchecked"
+	warningCoreSchedUnavailable = "core-scheduling-unavailable"
+	warningBlkioNotEnforced     = "blkio-throttle-not-enforced"
+	warningGuestImageRequired   = "guest-image-required"
+	warningGuestKernelRequired  = "guest-kernel-required"
+	warningHypervisorParams     = "hypervisor-params-ignored"
+)
+
+// progressWarning is the phase of the progress events reporting a
+// warning.
+const progressWarning = "warning"
+
+// warning is a non-fatal degradation of the requested configuration.
+type warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (w warning) String() string {
+	return fmt.Sprintf("WARNING: %s (%s)", w.Message, w.Code)
+}
+
+// warnings are the warnings reported by the current operation.
+var warnings []warning
+
+// warn reports a non-fatal degradation. logrus has no custom levels:
+// warnings are logged at the warning level with a "warning" field
+// holding their code, which makes them easy to filter.
+func warn(code, format string, args ...interface{}) {
+	w := warning{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	ccLog.WithField("warning", code).Warn(w.Message)
+
+	warnings = append(warnings, w)
+	progress.reportWarning(w)
+}
+
+// writeWarnings displays the specified warnings, one per line, in JSON
+// if requested.
+func writeWarnings(w io.Writer, list []warning) error {
+	for _, item := range list {
+		var err error
+
+		if wantJSONOutput() {
+			err = json.NewEncoder(w).Encode(item)
+		} else {
+			_, err = fmt.Fprintln(w, item)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unenforcedSpec returns the settings of the OCI specification which
+// virtcontainers ignores: the container runs without them.
+func unenforcedSpec(ociSpec oci.CompatOCISpec) []warning {
+	if ociSpec.Linux == nil {
+		return nil
+	}
+
+	var list []warning
+
+	add := func(code, format string, args ...interface{}) {
+		list = append(list, warning{
+			Code:    code,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if ociSpec.Linux.Seccomp != nil {
+		add(warningSeccompNotEnforced, "The seccomp profile of the container is not enforced by the agent")
+	}
+
+	if len(ociSpec.Linux.Sysctl) > 0 {
+		var keys []string
+		for key := range ociSpec.Linux.Sysctl {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		add(warningSysctlNotApplied, "The sysctls %v of the container are not applied in the guest", keys)
+	}
+
+	if len(ociSpec.Linux.Devices) > 0 {
+		var paths []string
+		for _, d := range ociSpec.Linux.Devices {
+			paths = append(paths, d.Path)
+		}
+
+		add(warningDevicesNotCreated, "The devices %v of the container are not created in the guest", paths)
+	}
+
+	if r := ociSpec.Linux.Resources; r != nil && r.BlockIO != nil &&
+		(len(r.BlockIO.ThrottleReadBpsDevice) > 0 || len(r.BlockIO.ThrottleWriteBpsDevice) > 0 ||
+			len(r.BlockIO.ThrottleReadIOPSDevice) > 0 || len(r.BlockIO.ThrottleWriteIOPSDevice) > 0) {
+		add(warningBlkioNotEnforced, "The block IO rate limits of the container are not enforced")
+	}
+
+	return list
+}
+
+// checkUnenforcedSpec warns about the settings of the OCI specification
+// which are not enforced, or refuses them in strict mode.
+func checkUnenforcedSpec(ociSpec oci.CompatOCISpec, strict bool) error {
+	return checkUnenforced(unenforcedSpec(ociSpec), strict)
+}
+
+// checkUnenforced reports the specified unenforced settings as
+// warnings, or refuses them in strict mode.
+func checkUnenforced(list []warning, strict bool) error {
+	if strict && len(list) > 0 {
+		var messages []string
+		for _, w := range list {
+			messages = append(messages, fmt.Sprintf("%s (%s)", w.Message, w.Code))
+		}
+
+		return fmt.Errorf("Strict mode refuses settings which cannot be enforced: %s",
+			strings.Join(messages, "; "))
+	}
+
+	for _, w := range list {
+		warn(w.Code, "%s", w.Message)
+	}
+
+	return nil
+}
+
+// unenforcedParams returns the parameters of the hypervisor
+// configuration of a pod which are not known to be applied, whether
+// they come from the configuration or were added by the runtime to apply
+// its settings: the agent parameters, which the stock guest image
+// ignores, the sysctls, which older guest kernels ignore, the parameters
+// of guest kernel features unless the kernel is checked to have them,
+// and the hypervisor parameters, which virtcontainers never passes to
+// the hypervisor, but those the runtime reads back itself.
+func unenforcedParams(config vc.HypervisorConfig, kernelChecked bool) []warning {
+	var agentKeys, sysctlKeys, uncheckedKeys, hypervisorKeys []string
+
+	for _, p := range config.KernelParams {
+		switch {
+		case strings.HasPrefix(p.Key, agentKernelParamPrefix):
+			agentKeys = append(agentKeys, p.Key)
+		case strings.HasPrefix(p.Key, sysctlKernelParamPrefix):
+			sysctlKeys = append(sysctlKeys, p.Key)
+		case !kernelChecked && hasParamPrefix(p.Key, kernelOptionParamPrefixes):
+			uncheckedKeys = append(uncheckedKeys, p.Key)
+		}
+	}
+
+	for _, p := range config.HypervisorParams {
+		if !hasParamPrefix(p.Key, runtimeHypervisorParams) {
+			hypervisorKeys = append(hypervisorKeys, p.Key)
+		}
+	}
+
+	var list []warning
+
+	add := func(keys []string, code, format string) {
+		if len(keys) > 0 {
+			list = append(list, warning{
+				Code:    code,
+				Message: fmt.Sprintf(format, keys),
+			})
+		}
+	}
+
+	add(agentKeys, warningGuestImageRequired,
+		"The kernel parameters %v are not read by the hyperstart agent: they are only applied by a guest image handling them")
+	add(sysctlKeys, warningGuestKernelRequired,
+		"The kernel parameters %v are only applied by guest kernels from Linux 5.8")
+	add(uncheckedKeys, warningKernelUnchecked,
+		"The kernel parameters %v are only applied by a guest kernel with the matching options, which is not checked")
+	add(hypervisorKeys, warningHypervisorParams,
+		"The hypervisor parameters %v are not passed to the hypervisor by virtcontainers")
+
+	return list
+}
+
+// hasParamPrefix returns true if key is one of the parameters or starts
+// with one of the prefixes, which end with a dot.
+func hasParamPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if key == prefix || (strings.HasSuffix(prefix, ".") && strings.HasPrefix(key, prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkUnenforcedParams warns about the parameters of the hypervisor
+// configuration of a pod which are not known to be applied, or refuses
+// them in strict mode.
+func checkUnenforcedParams(config vc.HypervisorConfig, kernelChecked, strict bool) error {
+	return checkUnenforced(unenforcedParams(config, kernelChecked), strict)
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func warningCodes(list []warning) []string {
+	var codes []string
+	for _, w := range list {
+		codes = append(codes, w.Code)
+	}
+
+	return codes
+}
+
+func TestWarn(t *testing.T) {
+	assert := assert.New(t)
+
+	savedWarnings := warnings
+	defer func() {
+		warnings = savedWarnings
+	}()
+
+	warnings = nil
+
+	var buf bytes.Buffer
+	err := withProgress(progressStderr, testContainerID, func() error {
+		progress.w = &buf
+
+		warn(warningKSMUnavailable, "Unable to enable KSM: %v", "no ksm")
+		return nil
+	})
+	assert.NoError(err)
+
+	expected := warning{
+		Code:    warningKSMUnavailable,
+		Message: "Unable to enable KSM: no ksm",
+	}
+	assert.Equal([]warning{expected}, warnings)
+
+	events := readProgressEvents(assert, buf.String())
+	assert.Equal([]string{progressWarning}, progressPhases(events))
+	assert.Equal(&expected, events[0].Warning)
+
+	// reported without progress
+	warn(warningCorePattern, "Core dumps will not be written")
+	assert.Equal([]string{warningKSMUnavailable, warningCorePattern}, warningCodes(warnings))
+}
+
+func TestWriteWarnings(t *testing.T) {
+	assert := assert.New(t)
+
+	savedOutputFormat := outputFormat
+	defer func() {
+		outputFormat = savedOutputFormat
+	}()
+
+	list := []warning{
+		{Code: warningNetworkFS, Message: "Root filesystem on NFS"},
+		{Code: warningSeccompNotEnforced, Message: "No seccomp"},
+	}
+
+	var buf bytes.Buffer
+
+	outputFormat = outputText
+	assert.NoError(writeWarnings(&buf, list))
+	assert.Equal("WARNING: Root filesystem on NFS (network-fs)\nWARNING: No seccomp (seccomp-not-enforced)\n", buf.String())
+
+	buf.Reset()
+	outputFormat = outputJSON
+	assert.NoError(writeWarnings(&buf, list))
+
+	var decoded []warning
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var w warning
+		assert.NoError(decoder.Decode(&w))
+		decoded = append(decoded, w)
+	}
+	assert.Equal(list, decoded)
+
+	assert.Error(writeWarnings(failingWriter{}, list))
+	assert.NoError(writeWarnings(failingWriter{}, nil))
+}
+
+func TestUnenforcedSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	var ociSpec oci.CompatOCISpec
+	assert.Empty(unenforcedSpec(ociSpec))
+
+	ociSpec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			Devices: []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}},
+		},
+	}
+	assert.Empty(unenforcedSpec(ociSpec))
+
+	ociSpec.Linux.Seccomp = &specs.LinuxSeccomp{DefaultAction: specs.ActErrno}
+	ociSpec.Linux.Sysctl = map[string]string{
+		"net.ipv4.ip_forward":    "1",
+		"kernel.shm_rmid_forced": "1",
+	}
+	ociSpec.Linux.Devices = []specs.LinuxDevice{{Path: "/dev/fuse"}}
+
+	list := unenforcedSpec(ociSpec)
+	assert.Equal([]string{warningSeccompNotEnforced, warningSysctlNotApplied, warningDevicesNotCreated}, warningCodes(list))
+	assert.Contains(list[1].Message, "[kernel.shm_rmid_forced net.ipv4.ip_forward]")
+	assert.Contains(list[2].Message, "/dev/fuse")
+
+	ociSpec.Linux.Resources.BlockIO = &specs.LinuxBlockIO{
+		ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{{Rate: 1048576}},
+	}
+
+	list = unenforcedSpec(ociSpec)
+	assert.Equal([]string{warningSeccompNotEnforced, warningSysctlNotApplied, warningDevicesNotCreated, warningBlkioNotEnforced},
+		warningCodes(list))
+}
+
+func TestCheckUnenforcedSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	savedWarnings := warnings
+	defer func() {
+		warnings = savedWarnings
+	}()
+
+	warnings = nil
+
+	var ociSpec oci.CompatOCISpec
+	assert.NoError(checkUnenforcedSpec(ociSpec, true))
+
+	ociSpec.Linux = &specs.Linux{
+		Seccomp: &specs.LinuxSeccomp{DefaultAction: specs.ActErrno},
+		Devices: []specs.LinuxDevice{{Path: "/dev/fuse"}},
+	}
+
+	assert.NoError(checkUnenforcedSpec(ociSpec, false))
+	assert.Equal([]string{warningSeccompNotEnforced, warningDevicesNotCreated}, warningCodes(warnings))
+
+	warnings = nil
+
+	err := checkUnenforcedSpec(ociSpec, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), warningSeccompNotEnforced)
+	assert.Contains(err.Error(), "/dev/fuse")
+	assert.Empty(warnings)
+}
+
+func TestCheckUnenforcedParams(t *testing.T) {
+	assert := assert.New(t)
+
+	savedWarnings := warnings
+	defer func() {
+		warnings = savedWarnings
+	}()
+
+	warnings = nil
+
+	config := vc.HypervisorConfig{
+		KernelParams: append(getKernelParams(testContainerID),
+			vc.Param{Key: "vsyscall", Value: "emulate"},
+			vc.Param{Key: zramDevsParam, Value: "1"},
+			vc.Param{Key: zswapEnabledParam, Value: "1"}),
+		HypervisorParams: []vc.Param{
+			{Key: hostCPUsParam, Value: "2-3"},
+		},
+	}
+
+	assert.NoError(checkUnenforcedParams(config, true, true))
+	assert.Empty(warnings)
+
+	// the kernel options are not checked
+	assert.NoError(checkUnenforcedParams(config, false, false))
+	assert.Equal([]string{warningKernelUnchecked}, warningCodes(warnings))
+	assert.Contains(warnings[0].Message, zramDevsParam)
+	assert.Contains(warnings[0].Message, zswapEnabledParam)
+
+	warnings = nil
+
+	config.KernelParams = append(config.KernelParams,
+		vc.Param{Key: swapTypeParam, Value: guestSwapZram},
+		vc.Param{Key: sharedFSCacheParam, Value: sharedFSCacheLoose},
+		vc.Param{Key: swappinessParam, Value: "10"})
+	config.HypervisorParams = append(config.HypervisorParams, vc.Param{Key: "mem-merge", Value: "on"})
+
+	assert.NoError(checkUnenforcedParams(config, true, false))
+	assert.Equal([]string{warningGuestImageRequired, warningGuestKernelRequired, warningHypervisorParams},
+		warningCodes(warnings))
+	assert.Contains(warnings[0].Message, swapTypeParam)
+	assert.Contains(warnings[0].Message, sharedFSCacheParam)
+	assert.Contains(warnings[1].Message, swappinessParam)
+	assert.Contains(warnings[2].Message, "mem-merge")
+	assert.NotContains(warnings[2].Message, hostCPUsParam)
+
+	warnings = nil
+
+	err := checkUnenforcedParams(config, true, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), warningGuestImageRequired)
+	assert.Contains(err.Error(), warningGuestKernelRequired)
+	assert.Contains(err.Error(), warningHypervisorParams)
+	assert.Empty(warnings)
+}
+
+// TestUnenforcedParamsCoverage checks that all the parameters the runtime
+// adds for its settings, but those the guest kernel applies itself, are
+// reported.
+func TestUnenforcedParamsCoverage(t *testing.T) {
+	assert := assert.New(t)
+
+	savedRuntimeOptions := runtimeOptions
+	defer func() {
+		runtimeOptions = savedRuntimeOptions
+	}()
+
+	runtimeOptions.EnableGuestSwap = true
+
+	var params []vc.Param
+
+	limit := uint64(512 * 1024 * 1024)
+	swap := uint64(1024 * 1024 * 1024)
+	swappiness := uint64(10)
+
+	ociSpec := oci.CompatOCISpec{}
+	ociSpec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			Memory: &specs.LinuxMemory{Limit: &limit, Swap: &swap, Swappiness: &swappiness},
+		},
+	}
+
+	swapParams, err := getGuestSwapKernelParams(ociSpec, oci.RuntimeConfig{})
+	assert.NoError(err)
+	params = append(params, swapParams...)
+
+	for _, mode := range []string{memoryCompressionZram, memoryCompressionZswap} {
+		compressionParams, err := memoryCompressionKernelParams(mode, "lz4", 25)
+		assert.NoError(err)
+		params = append(params, compressionParams...)
+	}
+
+	sharedFSParams, err := sharedFSKernelParams(sharedFSCacheFSCache, 512)
+	assert.NoError(err)
+	params = append(params, sharedFSParams...)
+
+	params = append(params, guestOOM{ScoreAdj: 100, KillDisable: true, Panic: true}.kernelParams()...)
+
+	reported := make(map[string]bool)
+	for _, w := range unenforcedParams(vc.HypervisorConfig{KernelParams: params}, false) {
+		for _, p := range params {
+			if strings.Contains(w.Message, p.Key) {
+				reported[p.Key] = true
+			}
+		}
+	}
+
+	for _, p := range params {
+		assert.True(reported[p.Key], "parameter %v is not reported", p.Key)
+	}
+}